@@ -0,0 +1,179 @@
+// Package accounts looks after user accounts: the settings users change
+// themselves, and deleting accounts once their grace period is over.
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/navid-m/versed/exports"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+)
+
+var logger = logging.For("accounts")
+
+// How often due deletions are looked for
+const checkInterval = time.Hour
+
+// Returned when cancelling a deletion that was never scheduled
+var ErrNotScheduled = errors.New("account deletion is not scheduled")
+
+// Configures how account deletion behaves
+type Config struct {
+	// How long after a user asks to be deleted the account is actually deleted
+	GracePeriod time.Duration
+	// Prefix of links in notification emails
+	BaseURL string
+	// Key email verification links are signed with
+	VerificationSecret []byte
+}
+
+// Schedules account deletions and carries them out when they come due
+type Service struct {
+	users     repository.Users
+	deletions repository.AccountDeletions
+	mailer    *mailer.Mailer
+	exports   *exports.Service
+	cfg       Config
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Creates a new account deletion service over the given repositories. The
+// archives of a deleted user's data exports are removed through exporter,
+// which may be nil.
+func NewService(users repository.Users, deletions repository.AccountDeletions, m *mailer.Mailer, exporter *exports.Service, cfg Config) *Service {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Service{
+		users:     users,
+		deletions: deletions,
+		mailer:    m,
+		exports:   exporter,
+		cfg:       cfg,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// Begins deleting accounts whose grace period has passed
+func (s *Service) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.RunDue(time.Now())
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.RunDue(time.Now())
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stops the service and waits for a deletion in progress to finish
+func (s *Service) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// Schedules a user's account for deletion once the grace period is over,
+// returning when that will be
+func (s *Service) Schedule(userID int, now time.Time) (time.Time, error) {
+	at := now.Add(s.cfg.GracePeriod)
+	if err := s.deletions.Schedule(userID, at); err != nil {
+		return time.Time{}, err
+	}
+	logger.Info("Scheduled account deletion", "user_id", userID, "at", at.UTC())
+
+	if err := s.notify(userID, at); err != nil {
+		logger.Error("Failed to email user about their account deletion", "user_id", userID, "err", err)
+	}
+	return at, nil
+}
+
+// Calls off a user's scheduled account deletion
+func (s *Service) Cancel(userID int) error {
+	scheduled, err := s.Scheduled(userID)
+	if err != nil {
+		return err
+	}
+	if scheduled == nil {
+		return ErrNotScheduled
+	}
+	if err := s.deletions.Cancel(userID); err != nil {
+		return err
+	}
+	logger.Info("Cancelled account deletion", "user_id", userID)
+	return nil
+}
+
+// Returns when a user's account is scheduled to be deleted, or nil if it is not
+func (s *Service) Scheduled(userID int) (*time.Time, error) {
+	return s.deletions.Scheduled(userID)
+}
+
+// Deletes a user's account straight away
+func (s *Service) Delete(userID int, now time.Time) error {
+	if s.exports != nil {
+		if err := s.exports.RemoveUser(userID); err != nil {
+			return fmt.Errorf("failed to remove data exports: %w", err)
+		}
+	}
+	if err := s.deletions.Delete(userID, now); err != nil {
+		return err
+	}
+	logger.Info("Deleted account", "user_id", userID)
+	return nil
+}
+
+// Deletes every account whose grace period has passed
+func (s *Service) RunDue(now time.Time) {
+	metrics.WorkersBusy.Inc("accounts")
+	defer metrics.WorkersBusy.Dec("accounts")
+
+	due, err := s.deletions.Due(now)
+	if err != nil {
+		logger.Error("Failed to get due account deletions", "err", err)
+		return
+	}
+	for _, userID := range due {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+		if err := s.Delete(userID, now); err != nil {
+			logger.Error("Failed to delete account", "user_id", userID, "err", err)
+		}
+	}
+}
+
+// Emails the user when their account will be deleted, if SMTP is configured
+func (s *Service) notify(userID int, at time.Time) error {
+	if !s.mailer.Enabled() {
+		return nil
+	}
+	user, err := s.users.ByID(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Versed account is scheduled for deletion",
+		Text: fmt.Sprintf("Hi %s,\n\nYour Versed account will be deleted on %s. Your categories, reading list and votes "+
+			"will be removed, and your comments and posts will be shown as %s.\n\n"+
+			"Changed your mind? Sign in and cancel the deletion from your profile before then:\n\n%s/profile\n",
+			user.Username, at.UTC().Format("Jan 2, 2006 15:04 MST"), models.DeletedUsername, s.cfg.BaseURL),
+	})
+}
@@ -0,0 +1,71 @@
+package accounts
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/mailer/mailertest"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/repository/repositorytest"
+)
+
+func TestService(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repos.Users.ByEmail("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := mailertest.NewServer(t)
+	s := NewService(repos.Users, repos.AccountDeletions, mailer.New(server.Config()), nil, Config{GracePeriod: 24 * time.Hour, BaseURL: "https://versed.test"})
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := s.Cancel(user.ID); !errors.Is(err, ErrNotScheduled) {
+		t.Errorf("Cancel without a scheduled deletion = %v, want ErrNotScheduled", err)
+	}
+
+	at, err := s.Schedule(user.ID, now)
+	if err != nil {
+		t.Fatalf("Schedule: %v", err)
+	}
+	if !at.Equal(now.Add(24 * time.Hour)) {
+		t.Errorf("scheduled for %v, want a day later", at)
+	}
+
+	messages := server.WaitFor(1, 5*time.Second)
+	if len(messages) != 1 {
+		t.Fatalf("got %d emails, want 1", len(messages))
+	}
+	msg, err := messages[0].Parse()
+	if err != nil {
+		t.Fatalf("failed to parse email: %v", err)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if !strings.Contains(string(body), "https://versed.test/profile") {
+		t.Errorf("email lacks a link to cancel:\n%s", body)
+	}
+
+	s.RunDue(now.Add(time.Hour))
+	if _, err := repos.Users.ByEmail("reader@example.com"); err != nil {
+		t.Fatalf("account deleted during its grace period: %v", err)
+	}
+
+	s.RunDue(at)
+	if _, err := repos.Users.ByEmail("reader@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatal("account not deleted once its grace period was over")
+	}
+	scheduled, err := s.Scheduled(user.ID)
+	if err != nil {
+		t.Fatalf("Scheduled: %v", err)
+	}
+	if scheduled != nil {
+		t.Errorf("deleted account still scheduled for %v", scheduled)
+	}
+}
@@ -0,0 +1,215 @@
+package accounts
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/template/django/v3"
+
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/ratelimit"
+	"github.com/navid-m/versed/repository"
+)
+
+// How long a password reset link works for
+const ResetTokenLifetime = time.Hour
+
+// How many reset emails may be asked for within resetRateWindow, for one
+// email address and from one IP address
+const (
+	resetsPerEmail  = 3
+	resetsPerIP     = 10
+	resetRateWindow = time.Hour
+)
+
+var (
+	// Returned when too many resets have been asked for an email address or
+	// from an IP address
+	ErrResetRateLimited = errors.New("too many password reset requests")
+	// Returned when a reset token is unknown, used up or expired
+	ErrInvalidResetToken = errors.New("password reset link is invalid or has expired")
+	// Returned when no SMTP server is configured to send reset emails
+	ErrResetUnavailable = errors.New("password reset by email is not available")
+)
+
+// Lets users who forgot their password set a new one through a single-use
+// link sent to their email address
+type PasswordResets struct {
+	users     repository.Users
+	sessions  repository.Sessions
+	apiTokens repository.APITokens
+	resets    repository.ResetTokens
+	engine    *django.Engine
+	mailer    *mailer.Mailer
+	baseURL   string
+	byEmail   *ratelimit.Limiter
+	byIP      *ratelimit.Limiter
+	wg        sync.WaitGroup
+}
+
+// Creates a password reset service over the given repositories. Reset
+// emails are rendered with the engine's templates and link to baseURL.
+func NewPasswordResets(users repository.Users, sessions repository.Sessions, apiTokens repository.APITokens, resets repository.ResetTokens, engine *django.Engine, m *mailer.Mailer, baseURL string) *PasswordResets {
+	return &PasswordResets{
+		users:     users,
+		sessions:  sessions,
+		apiTokens: apiTokens,
+		resets:    resets,
+		engine:    engine,
+		mailer:    m,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		byEmail:   ratelimit.New(resetsPerEmail, resetRateWindow),
+		byIP:      ratelimit.New(resetsPerIP, resetRateWindow),
+	}
+}
+
+// Emails a reset link to the account with the given address, if there is
+// one.
+//
+// Whether the account exists is never reported, and the email is sent in
+// the background so that the time taken does not give it away either. Fails
+// with ErrResetRateLimited or ErrResetUnavailable.
+func (r *PasswordResets) Request(email, ip string, now time.Time) error {
+	if !r.mailer.Enabled() {
+		return ErrResetUnavailable
+	}
+	// Addresses are matched ignoring case, so they are limited that way too
+	email = strings.ToLower(strings.TrimSpace(email))
+	allowedIP := r.byIP.Allow(ip, now)
+	allowedEmail := r.byEmail.Allow(email, now)
+	if !allowedIP || !allowedEmail {
+		return ErrResetRateLimited
+	}
+
+	if err := r.resets.DeleteExpired(now); err != nil {
+		logger.Warn("Failed to delete expired password resets", "err", err)
+	}
+
+	user, err := r.users.ByEmail(email)
+	if errors.Is(err, repository.ErrNotFound) {
+		logger.Info("Password reset asked for an unknown email")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		return err
+	}
+	if err := r.resets.Create(user.ID, hashResetToken(token), ip, now.Add(ResetTokenLifetime)); err != nil {
+		return err
+	}
+
+	message, err := r.render(user.Username, token)
+	if err != nil {
+		return err
+	}
+	message.To = user.Email
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		if err := r.mailer.Send(message); err != nil {
+			logger.Error("Failed to send password reset email", "user_id", user.ID, "err", err)
+			return
+		}
+		logger.Info("Sent password reset email", "user_id", user.ID)
+	}()
+	return nil
+}
+
+// Reports whether a reset token can still be used, so the reset form can say
+// so before the user types a new password
+func (r *PasswordResets) Valid(token string, now time.Time) bool {
+	_, err := r.resets.User(hashResetToken(token), now)
+	return err == nil
+}
+
+// Sets a new password with a token from a reset email, using up the token,
+// ending every session the user has and revoking their API tokens. Fails
+// with ErrInvalidResetToken or a *ValidationError.
+func (r *PasswordResets) Reset(token, password, confirm string, now time.Time) error {
+	hash := hashResetToken(token)
+	userID, err := r.resets.User(hash, now)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get password reset: %w", err)
+	}
+	user, err := r.users.ByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if password != confirm {
+		return invalid("Passwords do not match")
+	}
+	if err := CheckPassword(password, user.Email, user.Username); err != nil {
+		return err
+	}
+
+	// Used up before the password changes, so a token can only ever set one
+	if _, err := r.resets.Use(hash, now); errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidResetToken
+	} else if err != nil {
+		return fmt.Errorf("failed to use password reset: %w", err)
+	}
+	if err := r.users.Update(userID, user.Email, user.Username, password); err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if err := r.sessions.DeleteForUser(userID); err != nil {
+		return fmt.Errorf("failed to end sessions: %w", err)
+	}
+	if err := r.apiTokens.DeleteForUser(userID); err != nil {
+		return fmt.Errorf("failed to revoke API tokens: %w", err)
+	}
+	logger.Info("Password reset, sessions ended and API tokens revoked", "user_id", userID)
+	return nil
+}
+
+// Waits for reset emails still being sent
+func (r *PasswordResets) Stop() {
+	r.wg.Wait()
+}
+
+// Renders the HTML and plain-text reset email
+func (r *PasswordResets) render(username, token string) (mailer.Message, error) {
+	binding := map[string]any{
+		"Username": username,
+		"ResetURL": r.baseURL + "/reset-password/" + token,
+		"Lifetime": "1 hour",
+	}
+	var html, text bytes.Buffer
+	if err := r.engine.Render(&html, "emails/password-reset", binding); err != nil {
+		return mailer.Message{}, fmt.Errorf("failed to render password reset html: %w", err)
+	}
+	if err := r.engine.Render(&text, "emails/password-reset-text", binding); err != nil {
+		return mailer.Message{}, fmt.Errorf("failed to render password reset text: %w", err)
+	}
+	return mailer.Message{Subject: "Reset your Versed password", Text: text.String(), HTML: html.String()}, nil
+}
+
+// Returns a new random token to put in a reset link
+func newResetToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Returns the form a reset token is stored in
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,170 @@
+package accounts
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gofiber/template/django/v3"
+
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/mailer/mailertest"
+	"github.com/navid-m/versed/passwords"
+	"github.com/navid-m/versed/repository/repositorytest"
+)
+
+var resetLink = regexp.MustCompile(`https://versed\.test/reset-password/([0-9a-f]{64})`)
+
+// Returns the plain-text part of an email
+func textPart(t *testing.T, message mailertest.Message) string {
+	t.Helper()
+	msg, err := message.Parse()
+	if err != nil {
+		t.Fatalf("failed to parse email: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %v", err)
+	}
+	part, err := multipart.NewReader(msg.Body, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatalf("failed to read text part: %v", err)
+	}
+	text, _ := io.ReadAll(part)
+	return string(text)
+}
+
+// Returns the token from the reset link in an email
+func resetTokenFrom(t *testing.T, message mailertest.Message) string {
+	t.Helper()
+	text := textPart(t, message)
+	match := resetLink.FindStringSubmatch(text)
+	if match == nil {
+		t.Fatalf("email lacks a reset link:\n%s", text)
+	}
+	return match[1]
+}
+
+func TestPasswordResets(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "old password", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repos.Users.ByEmail("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var session bytes.Buffer
+	if err := gob.NewEncoder(&session).Encode(map[string]any{"user_id": user.ID}); err != nil {
+		t.Fatalf("failed to encode session: %v", err)
+	}
+	if err := repos.Sessions.Set("reader-session", session.Bytes(), time.Hour); err != nil {
+		t.Fatalf("failed to store session: %v", err)
+	}
+	if _, err := repos.APITokens.Create(user.ID, "Scripts", "token-hash", []string{"read"}); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := django.New("../views", ".html")
+	if err := engine.Load(); err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	server := mailertest.NewServer(t)
+	r := NewPasswordResets(repos.Users, repos.Sessions, repos.APITokens, repos.ResetTokens, engine, mailer.New(server.Config()), "https://versed.test/")
+	now := time.Now()
+
+	if err := r.Request("nobody@example.com", "10.0.0.1", now); err != nil {
+		t.Errorf("Request for an unknown email = %v, want nil", err)
+	}
+	if err := r.Request(" Reader@Example.com ", "10.0.0.1", now); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	r.Stop()
+	messages := server.WaitFor(1, 5*time.Second)
+	if len(messages) != 1 {
+		t.Fatalf("got %d emails, want 1 for the known address only", len(messages))
+	}
+	if len(messages[0].To) != 1 || messages[0].To[0] != "reader@example.com" {
+		t.Errorf("email sent to %v", messages[0].To)
+	}
+	token := resetTokenFrom(t, messages[0])
+
+	if !r.Valid(token, now) {
+		t.Error("fresh token not valid")
+	}
+	if r.Valid(token, now.Add(ResetTokenLifetime+time.Minute)) {
+		t.Error("token still valid after it expired")
+	}
+	if err := r.Reset(token, "new password", "new password", now.Add(ResetTokenLifetime+time.Minute)); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("Reset with an expired token = %v, want ErrInvalidResetToken", err)
+	}
+	var invalid *ValidationError
+	if err := r.Reset(token, "new password", "other password", now); !errors.As(err, &invalid) {
+		t.Errorf("Reset with mismatched passwords = %v, want a ValidationError", err)
+	}
+	if err := r.Reset(token, "short", "short", now); !errors.As(err, &invalid) {
+		t.Errorf("Reset with a short password = %v, want a ValidationError", err)
+	}
+
+	if err := r.Reset(token, "new password", "new password", now); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	user, err = repos.Users.ByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := passwords.Verify(user.Password, "new password"); err != nil {
+		t.Errorf("new password rejected: %v", err)
+	}
+	if data, err := repos.Sessions.Get("reader-session"); err != nil || data != nil {
+		t.Errorf("session after the reset = %q, %v; want it deleted", data, err)
+	}
+	if tokens, err := repos.APITokens.List(user.ID); err != nil || len(tokens) != 0 {
+		t.Errorf("API tokens after the reset = %+v, %v; want them revoked", tokens, err)
+	}
+	if err := r.Reset(token, "another password", "another password", now); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("second Reset with the same token = %v, want ErrInvalidResetToken", err)
+	}
+	if err := r.Reset("not-a-token", "another password", "another password", now); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("Reset with an unknown token = %v, want ErrInvalidResetToken", err)
+	}
+}
+
+func TestPasswordResetRateLimits(t *testing.T) {
+	repos := repositorytest.New()
+
+	engine := django.New("../views", ".html")
+	server := mailertest.NewServer(t)
+	r := NewPasswordResets(repos.Users, repos.Sessions, repos.APITokens, repos.ResetTokens, engine, mailer.New(server.Config()), "https://versed.test")
+	now := time.Now()
+
+	for i := 0; i < resetsPerEmail; i++ {
+		if err := r.Request("nobody@example.com", "10.0.0.1", now); err != nil {
+			t.Fatalf("Request %d: %v", i+1, err)
+		}
+	}
+	if err := r.Request("NOBODY@example.com", "10.0.0.2", now); !errors.Is(err, ErrResetRateLimited) {
+		t.Errorf("Request over the per-email limit = %v, want ErrResetRateLimited", err)
+	}
+	if err := r.Request("nobody@example.com", "10.0.0.2", now.Add(resetRateWindow)); err != nil {
+		t.Errorf("Request once the window passed = %v, want nil", err)
+	}
+
+	for i := 0; i < resetsPerIP; i++ {
+		r.Request("someone@example.com", "10.0.0.3", now)
+	}
+	if err := r.Request("else@example.com", "10.0.0.3", now); !errors.Is(err, ErrResetRateLimited) {
+		t.Errorf("Request over the per-IP limit = %v, want ErrResetRateLimited", err)
+	}
+
+	disabled := NewPasswordResets(repos.Users, repos.Sessions, repos.APITokens, repos.ResetTokens, engine, mailer.New(mailer.Config{}), "https://versed.test")
+	if err := disabled.Request("nobody@example.com", "10.0.0.4", now); !errors.Is(err, ErrResetUnavailable) {
+		t.Errorf("Request without a mailer = %v, want ErrResetUnavailable", err)
+	}
+}
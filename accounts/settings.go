@@ -0,0 +1,185 @@
+package accounts
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/navid-m/versed/passwords"
+	"github.com/navid-m/versed/repository"
+)
+
+// Password length limits. bcrypt ignores everything past the 72nd byte.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// Returned when a settings change is made with the wrong current password
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+// A value users cannot choose, with a message fit to show them
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string { return e.Message }
+
+func invalid(format string, args ...any) error {
+	return &ValidationError{Message: fmt.Sprintf(format, args...)}
+}
+
+// Checks that an email address is a bare address such as reader@example.com
+func ValidateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return invalid("Enter a valid email address")
+	}
+	if domain := email[strings.LastIndex(email, "@")+1:]; !strings.Contains(domain, ".") {
+		return invalid("Enter a valid email address")
+	}
+	return nil
+}
+
+// Checks that a username is 3 to 20 letters, numbers and underscores
+func ValidateUsername(username string) error {
+	if len(username) < 3 || len(username) > 20 {
+		return invalid("Username must be between 3 and 20 characters")
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' {
+			return invalid("Username can only contain letters, numbers, and underscores")
+		}
+	}
+	return nil
+}
+
+// Checks a new password against the password policy. The email address and
+// username it is for may be empty.
+func CheckPassword(password, email, username string) error {
+	switch {
+	case len(password) < MinPasswordLength:
+		return invalid("Password must be at least %d characters long", MinPasswordLength)
+	case len(password) > MaxPasswordLength:
+		return invalid("Password must be at most %d bytes long", MaxPasswordLength)
+	case email != "" && strings.EqualFold(password, email),
+		username != "" && strings.EqualFold(password, username):
+		return invalid("Password must not be your email address or username")
+	}
+	return nil
+}
+
+// What a user asks to change about their account
+type SettingsChange struct {
+	Email           string
+	Username        string
+	CurrentPassword string
+	// Left empty to keep the current password
+	NewPassword     string
+	ConfirmPassword string
+}
+
+// What came of a settings change
+type SettingsResult struct {
+	// The user's email address once the change is applied
+	Email string
+	// A new address that only takes effect once it is verified
+	PendingEmail    string
+	PasswordChanged bool
+}
+
+// Changes the account settings users manage themselves
+type Settings struct {
+	users     repository.Users
+	sessions  repository.Sessions
+	apiTokens repository.APITokens
+	verifier  *Verifier
+}
+
+// Creates a settings service over the given repositories. New email
+// addresses are verified through verifier before they take effect.
+func NewSettings(users repository.Users, sessions repository.Sessions, apiTokens repository.APITokens, verifier *Verifier) *Settings {
+	return &Settings{users: users, sessions: sessions, apiTokens: apiTokens, verifier: verifier}
+}
+
+// Applies a user's changes once their current password checks out.
+//
+// A new email address is only recorded as pending until the user follows
+// the link sent to it, unless verification is not required. Changing the
+// password ends every session the user has and revokes their API tokens,
+// since either may be how someone else got in, so callers should give the
+// session the change was made from a new ID before saving it again. Fails
+// with ErrWrongPassword, a *ValidationError, or repository.ErrEmailTaken or
+// ErrUsernameTaken.
+func (s *Settings) Update(userID int, change SettingsChange) (SettingsResult, error) {
+	email := strings.TrimSpace(change.Email)
+	username := strings.TrimSpace(change.Username)
+	if err := ValidateEmail(email); err != nil {
+		return SettingsResult{}, err
+	}
+	if err := ValidateUsername(username); err != nil {
+		return SettingsResult{}, err
+	}
+
+	user, err := s.users.ByID(userID)
+	if err != nil {
+		return SettingsResult{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := passwords.Verify(user.Password, change.CurrentPassword); err != nil {
+		return SettingsResult{}, ErrWrongPassword
+	}
+
+	if change.NewPassword != "" {
+		if change.NewPassword != change.ConfirmPassword {
+			return SettingsResult{}, invalid("New passwords do not match")
+		}
+		if err := CheckPassword(change.NewPassword, email, username); err != nil {
+			return SettingsResult{}, err
+		}
+	}
+
+	result := SettingsResult{Email: email, PendingEmail: user.PendingEmail}
+	verify := email != user.Email && s.verifier.Required()
+	if verify {
+		// Checked up front so a taken address does not leave the rest of the
+		// change half applied
+		if other, err := s.users.ByEmail(email); err == nil && other.ID != userID {
+			return SettingsResult{}, repository.ErrEmailTaken
+		}
+		result.Email = user.Email
+	}
+
+	if err := s.users.Update(userID, result.Email, username, change.NewPassword); err != nil {
+		return SettingsResult{}, fmt.Errorf("failed to update user: %w", err)
+	}
+	switch {
+	case verify:
+		user.Username = username
+		if err := s.verifier.ChangeEmail(user, email, time.Now()); err != nil {
+			return SettingsResult{}, err
+		}
+		result.PendingEmail = email
+	case user.PendingEmail != "":
+		// Keeping or directly setting the address drops the pending change
+		if err := s.users.SetPendingEmail(userID, ""); err != nil {
+			return SettingsResult{}, fmt.Errorf("failed to clear pending email: %w", err)
+		}
+		result.PendingEmail = ""
+	}
+	if change.NewPassword == "" {
+		return result, nil
+	}
+
+	result.PasswordChanged = true
+	if err := s.sessions.DeleteForUser(userID); err != nil {
+		return result, fmt.Errorf("failed to end sessions: %w", err)
+	}
+	if err := s.apiTokens.DeleteForUser(userID); err != nil {
+		return result, fmt.Errorf("failed to revoke API tokens: %w", err)
+	}
+	logger.Info("Password changed, sessions ended and API tokens revoked", "user_id", userID)
+	return result, nil
+}
@@ -0,0 +1,147 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+)
+
+// What personal access tokens may be used for
+const (
+	// Reading feeds, posts, comments and the user's own data
+	ScopeRead = "read"
+	// Creating, changing and deleting categories and their feeds
+	ScopeCategories = "categories"
+	// Voting, commenting and posting
+	ScopeInteract = "interact"
+	// Admin features, for admins only
+	ScopeAdmin = "admin"
+)
+
+// Every scope, in the order they are shown and stored
+var Scopes = []string{ScopeRead, ScopeCategories, ScopeInteract, ScopeAdmin}
+
+// Starts every token, so they are easy to tell from other bearer tokens such
+// as the metrics scraper's, and for secret scanners to spot
+const TokenPrefix = "versed_"
+
+const (
+	maxTokenNameLength = 100
+	// How stale a token's last-used time may get, so that every request
+	// does not write to the database
+	tokenUsageResolution = time.Minute
+)
+
+// Returned for a bearer token that is malformed, unknown or revoked
+var ErrInvalidToken = errors.New("invalid API token")
+
+// Manages the personal access tokens users create for scripts
+type Tokens struct {
+	store repository.APITokens
+	users repository.Users
+}
+
+// Creates a token service over the given repositories
+func NewTokens(store repository.APITokens, users repository.Users) *Tokens {
+	return &Tokens{store: store, users: users}
+}
+
+// Creates a named token with the given scopes, returning the token itself.
+// Only its hash is stored, so this is the one time it can be shown. Fails with
+// a *ValidationError for a bad name or scope.
+func (t *Tokens) Create(userID int, name string, scopes []string) (string, *models.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxTokenNameLength {
+		return "", nil, invalid("Token name must be between 1 and %d characters", maxTokenNameLength)
+	}
+	if len(scopes) == 0 {
+		return "", nil, invalid("Choose at least one scope")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return "", nil, invalid("Unknown scope %q", scope)
+		}
+	}
+	if slices.Contains(scopes, ScopeAdmin) {
+		isAdmin, err := t.users.IsAdmin(userID)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to check admin status: %w", err)
+		}
+		if !isAdmin {
+			return "", nil, invalid("Only admins can create tokens with the admin scope")
+		}
+	}
+	var ordered []string
+	for _, scope := range Scopes {
+		if slices.Contains(scopes, scope) {
+			ordered = append(ordered, scope)
+		}
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to generate API token: %w", err)
+	}
+	token := TokenPrefix + hex.EncodeToString(buf)
+	created, err := t.store.Create(userID, name, hashToken(token), ordered)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to store API token: %w", err)
+	}
+	logger.Info("API token created", "user_id", userID, "token_id", created.ID, "scopes", ordered)
+	return token, created, nil
+}
+
+// Returns a user's tokens, newest first
+func (t *Tokens) List(userID int) ([]models.APIToken, error) {
+	tokens, err := t.store.List(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// Revokes one of a user's tokens. Fails with repository.ErrNotFound if they
+// have no such token.
+func (t *Tokens) Revoke(userID, id int) error {
+	if err := t.store.Delete(userID, id); err != nil {
+		return err
+	}
+	logger.Info("API token revoked", "user_id", userID, "token_id", id)
+	return nil
+}
+
+// Returns the token a bearer token stands for, recording that it was used.
+// Fails with ErrInvalidToken.
+func (t *Tokens) Authenticate(token string, now time.Time) (*models.APIToken, error) {
+	if !strings.HasPrefix(token, TokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+	found, err := t.store.ByHash(hashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	if found.LastUsedAt == nil || now.Sub(*found.LastUsedAt) >= tokenUsageResolution {
+		// Not worth failing the request over
+		if err := t.store.MarkUsed(found.ID); err != nil {
+			logger.Warn("Failed to record API token use", "token_id", found.ID, "err", err)
+		}
+	}
+	return found, nil
+}
+
+// Returns the form a token is stored in
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
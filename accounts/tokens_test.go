@@ -0,0 +1,73 @@
+package accounts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/repository/repositorytest"
+)
+
+func TestTokens(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "password", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := repos.Users.ByEmail("reader@example.com")
+	tokens := NewTokens(repos.APITokens, repos.Users)
+	now := time.Now()
+
+	for _, tt := range []struct {
+		name   string
+		scopes []string
+		want   string
+	}{
+		{"", []string{ScopeRead}, "between 1 and"},
+		{strings.Repeat("x", maxTokenNameLength+1), []string{ScopeRead}, "between 1 and"},
+		{"Scripts", nil, "at least one scope"},
+		{"Scripts", []string{"write"}, "Unknown scope"},
+		{"Scripts", []string{ScopeAdmin}, "Only admins"},
+	} {
+		_, _, err := tokens.Create(user.ID, tt.name, tt.scopes)
+		var invalid *ValidationError
+		if !errors.As(err, &invalid) || !strings.Contains(invalid.Message, tt.want) {
+			t.Errorf("Create(%q, %q) = %v, want an error about %q", tt.name, tt.scopes, err, tt.want)
+		}
+	}
+
+	raw, created, err := tokens.Create(user.ID, " Scripts ", []string{ScopeInteract, ScopeRead, ScopeRead})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !strings.HasPrefix(raw, TokenPrefix) || created.Name != "Scripts" || strings.Join(created.Scopes, " ") != "read interact" {
+		t.Errorf("Create = %q, %+v", raw, created)
+	}
+	if _, err := repos.APITokens.ByHash(raw); err == nil {
+		t.Error("token was stored as it is rather than hashed")
+	}
+
+	for _, bad := range []string{"", "versed_nope", strings.TrimPrefix(raw, TokenPrefix)} {
+		if _, err := tokens.Authenticate(bad, now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+	found, err := tokens.Authenticate(raw, now)
+	if err != nil || found.ID != created.ID || found.UserID != user.ID {
+		t.Fatalf("Authenticate = %+v, %v", found, err)
+	}
+	if list, _ := tokens.List(user.ID); len(list) != 1 || list[0].LastUsedAt == nil {
+		t.Errorf("List after use = %+v, want the use recorded", list)
+	}
+
+	if err := tokens.Revoke(user.ID+1, created.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Revoke by another user = %v, want ErrNotFound", err)
+	}
+	if err := tokens.Revoke(user.ID, created.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := tokens.Authenticate(raw, now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate after Revoke = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,332 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/passwords"
+	"github.com/navid-m/versed/ratelimit"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/totp"
+)
+
+const (
+	// How many recovery codes users get when turning two-factor sign-in on
+	RecoveryCodeCount = 10
+	// How many codes may be tried for one user within twoFactorWindow
+	twoFactorAttempts = 5
+	twoFactorWindow   = 5 * time.Minute
+	// Characters recovery codes are made of: lowercase base32, which leaves
+	// out 0 and 1 so they are not mistaken for o and l
+	recoveryCodeAlphabet = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
+var (
+	// Returned for a code that is wrong, expired or already used
+	ErrInvalidCode = errors.New("invalid two-factor code")
+	// Returned when too many codes were tried for a user in a short while
+	ErrTooManyAttempts = errors.New("too many two-factor attempts")
+	// Returned when setting up two-factor sign-in for a user who has it on
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+	// Returned when an action needs two-factor sign-in that the user does not
+	// have on
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// Returned when an admin tries to turn off two-factor sign-in while it is
+	// required for admins
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for admins")
+)
+
+// A secret waiting for the user to add it to their authenticator app
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	// otpauth:// URI for the app to scan as a QR code
+	URI string `json:"uri"`
+}
+
+// Where a user stands with two-factor sign-in
+type TwoFactorStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+	// Whether the user is an admin who cannot turn it off
+	Required bool `json:"required"`
+}
+
+// Manages TOTP two-factor sign-in and recovery codes
+type TwoFactor struct {
+	store    repository.TwoFactor
+	users    repository.Users
+	issuer   string
+	attempts *ratelimit.Limiter
+}
+
+// Creates a two-factor service; issuer names the site in authenticator apps
+func NewTwoFactor(store repository.TwoFactor, users repository.Users, issuer string) *TwoFactor {
+	return &TwoFactor{
+		store:    store,
+		users:    users,
+		issuer:   issuer,
+		attempts: ratelimit.New(twoFactorAttempts, twoFactorWindow),
+	}
+}
+
+// Reports whether a user must enter a code when signing in
+func (t *TwoFactor) Enabled(userID int) (bool, error) {
+	tf, err := t.store.ByUser(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get two-factor settings: %w", err)
+	}
+	return tf.EnabledAt != nil, nil
+}
+
+// Returns where a user stands with two-factor sign-in
+func (t *TwoFactor) Status(user *models.User) (TwoFactorStatus, error) {
+	var status TwoFactorStatus
+	var err error
+	if status.Enabled, err = t.Enabled(user.ID); err != nil {
+		return status, err
+	}
+	if status.Enabled {
+		if status.RecoveryCodesLeft, err = t.store.RecoveryCodesLeft(user.ID); err != nil {
+			return status, fmt.Errorf("failed to count recovery codes: %w", err)
+		}
+	}
+	if user.IsAdmin {
+		if status.Required, err = t.store.RequiredForAdmins(); err != nil {
+			return status, fmt.Errorf("failed to get site setting: %w", err)
+		}
+	}
+	return status, nil
+}
+
+// Starts setting up two-factor sign-in once the user's password checks out.
+// It only takes effect when Enable is given a code for the new secret.
+func (t *TwoFactor) Setup(userID int, password string) (TwoFactorSetup, error) {
+	user, err := t.users.ByID(userID)
+	if err != nil {
+		return TwoFactorSetup{}, fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := passwords.Verify(user.Password, password); err != nil {
+		return TwoFactorSetup{}, ErrWrongPassword
+	}
+	if enabled, err := t.Enabled(userID); err != nil {
+		return TwoFactorSetup{}, err
+	} else if enabled {
+		return TwoFactorSetup{}, ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+	if err := t.store.SetSecret(userID, secret); err != nil {
+		return TwoFactorSetup{}, fmt.Errorf("failed to store secret: %w", err)
+	}
+	return TwoFactorSetup{Secret: secret, URI: totp.ProvisioningURI(secret, t.issuer, user.Email)}, nil
+}
+
+// Turns two-factor sign-in on once the user enters a code for the secret
+// from Setup, returning their recovery codes. These are only stored hashed,
+// so this is the one time they can be shown.
+func (t *TwoFactor) Enable(userID int, code string, now time.Time) ([]string, error) {
+	if !t.attempts.Allow(strconv.Itoa(userID), now) {
+		return nil, ErrTooManyAttempts
+	}
+	tf, err := t.store.ByUser(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor settings: %w", err)
+	}
+	if tf.EnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	step, ok := totp.Validate(tf.Secret, code, now)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.store.Enable(userID, step, hashes); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrTwoFactorEnabled
+		}
+		return nil, fmt.Errorf("failed to enable two-factor: %w", err)
+	}
+	logger.Info("Two-factor authentication enabled", "user_id", userID)
+	return codes, nil
+}
+
+// Checks a code from the user's authenticator app or one of their recovery
+// codes, using it up. Fails with ErrInvalidCode, ErrTooManyAttempts or
+// ErrTwoFactorNotEnabled.
+func (t *TwoFactor) Verify(userID int, code string, now time.Time) error {
+	if !t.attempts.Allow(strconv.Itoa(userID), now) {
+		return ErrTooManyAttempts
+	}
+	tf, err := t.store.ByUser(userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get two-factor settings: %w", err)
+	}
+	if tf.EnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(tf.Secret, code, now); ok {
+		// A code seen once, even by an attacker watching over the user's
+		// shoulder, is not accepted again
+		fresh, err := t.store.UseStep(userID, step)
+		if err != nil {
+			return fmt.Errorf("failed to record code: %w", err)
+		}
+		if !fresh {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	used, err := t.store.UseRecoveryCode(userID, hashRecoveryCode(code))
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	logger.Info("Recovery code used", "user_id", userID)
+	return nil
+}
+
+// Turns two-factor sign-in off once the user's password and a current code
+// check out. Admins cannot while it is required for them.
+func (t *TwoFactor) Disable(userID int, password, code string, now time.Time) error {
+	user, err := t.users.ByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := passwords.Verify(user.Password, password); err != nil {
+		return ErrWrongPassword
+	}
+	if user.IsAdmin {
+		required, err := t.store.RequiredForAdmins()
+		if err != nil {
+			return fmt.Errorf("failed to get site setting: %w", err)
+		}
+		if required {
+			return ErrTwoFactorRequired
+		}
+	}
+	if err := t.Verify(userID, code, now); err != nil {
+		return err
+	}
+	if err := t.store.Disable(userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor: %w", err)
+	}
+	logger.Info("Two-factor authentication disabled", "user_id", userID)
+	return nil
+}
+
+// Replaces a user's recovery codes once a current code checks out, returning
+// the new ones
+func (t *TwoFactor) RegenerateRecoveryCodes(userID int, code string, now time.Time) ([]string, error) {
+	if err := t.Verify(userID, code, now); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.store.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, fmt.Errorf("failed to store recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Reports whether admins must have two-factor sign-in on to use admin
+// features
+func (t *TwoFactor) RequiredForAdmins() (bool, error) {
+	required, err := t.store.RequiredForAdmins()
+	if err != nil {
+		return false, fmt.Errorf("failed to get site setting: %w", err)
+	}
+	return required, nil
+}
+
+// Sets whether admins must have two-factor sign-in on. The admin making it
+// required must have it on themselves, so they are not locked out.
+func (t *TwoFactor) SetRequiredForAdmins(adminID int, required bool) error {
+	if required {
+		enabled, err := t.Enabled(adminID)
+		if err != nil {
+			return err
+		}
+		if !enabled {
+			return ErrTwoFactorNotEnabled
+		}
+	}
+	if err := t.store.SetRequiredForAdmins(required); err != nil {
+		return fmt.Errorf("failed to set site setting: %w", err)
+	}
+	logger.Info("Two-factor requirement for admins changed", "admin_id", adminID, "required", required)
+	return nil
+}
+
+// Reports whether an admin is kept from admin features until they turn on
+// two-factor sign-in, as it is required for admins
+func (t *TwoFactor) SetupRequired(adminID int) (bool, error) {
+	required, err := t.RequiredForAdmins()
+	if err != nil || !required {
+		return false, err
+	}
+	enabled, err := t.Enabled(adminID)
+	return !enabled, err
+}
+
+// Returns a fresh set of recovery codes such as "k3m9p-x2qrt", along with
+// the hashes to store
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	buf := make([]byte, 10*RecoveryCodeCount)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+	for i := range RecoveryCodeCount {
+		var code strings.Builder
+		for j, b := range buf[i*10 : (i+1)*10] {
+			if j == 5 {
+				code.WriteByte('-')
+			}
+			code.WriteByte(recoveryCodeAlphabet[b%32])
+		}
+		codes = append(codes, code.String())
+		hashes = append(hashes, hashRecoveryCode(code.String()))
+	}
+	return codes, hashes, nil
+}
+
+// Returns the form a recovery code is stored in, ignoring case, spaces and
+// dashes in what the user typed
+func hashRecoveryCode(code string) string {
+	normalized := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
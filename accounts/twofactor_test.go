@@ -0,0 +1,156 @@
+package accounts
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/repository/repositorytest"
+	"github.com/navid-m/versed/totp"
+)
+
+func TestTwoFactor(t *testing.T) {
+	repos := repositorytest.New()
+	for _, email := range []string{"reader@example.com", "other@example.com"} {
+		if err := repos.Users.Create(email, email[:5], "password", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, _ := repos.Users.ByEmail("reader@example.com")
+	other, _ := repos.Users.ByEmail("other@example.com")
+
+	tf := NewTwoFactor(repos.TwoFactor, repos.Users, "Versed")
+	start := time.Now()
+	// Spaced out so the attempt limit never kicks in
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * 2 * time.Minute) }
+
+	if _, err := tf.Setup(user.ID, "wrong"); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Setup with the wrong password = %v, want ErrWrongPassword", err)
+	}
+	setup, err := tf.Setup(user.ID, "password")
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	if !strings.HasPrefix(setup.URI, "otpauth://totp/Versed:reader@example.com?") || !strings.Contains(setup.URI, "secret="+setup.Secret) {
+		t.Errorf("provisioning URI = %q", setup.URI)
+	}
+	if enabled, _ := tf.Enabled(user.ID); enabled {
+		t.Error("enabled before a code was entered")
+	}
+	codeAt := func(i int) string {
+		code, err := totp.Code(setup.Secret, totp.Step(at(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	if _, err := tf.Enable(user.ID, "12345", at(0)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Enable with a wrong code = %v, want ErrInvalidCode", err)
+	}
+	recovery, err := tf.Enable(user.ID, codeAt(1), at(1))
+	if err != nil {
+		t.Fatalf("Enable: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, code := range recovery {
+		seen[code] = true
+	}
+	if len(recovery) != RecoveryCodeCount || len(seen) != RecoveryCodeCount {
+		t.Errorf("got recovery codes %q, want %d distinct ones", recovery, RecoveryCodeCount)
+	}
+	if _, err := tf.Setup(user.ID, "password"); !errors.Is(err, ErrTwoFactorEnabled) {
+		t.Errorf("Setup once enabled = %v, want ErrTwoFactorEnabled", err)
+	}
+
+	if err := tf.Verify(user.ID, codeAt(1), at(1)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Verify replaying the enabling code = %v, want ErrInvalidCode", err)
+	}
+	if err := tf.Verify(user.ID, codeAt(2), at(2)); err != nil {
+		t.Errorf("Verify with a fresh code: %v", err)
+	}
+	typed := strings.ToUpper(strings.ReplaceAll(recovery[0], "-", " "))
+	if err := tf.Verify(user.ID, typed, at(3)); err != nil {
+		t.Errorf("Verify with recovery code %q: %v", typed, err)
+	}
+	if err := tf.Verify(user.ID, recovery[0], at(4)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Verify with a used recovery code = %v, want ErrInvalidCode", err)
+	}
+	if err := tf.Verify(other.ID, codeAt(5), at(5)); !errors.Is(err, ErrTwoFactorNotEnabled) {
+		t.Errorf("Verify for a user without two-factor = %v, want ErrTwoFactorNotEnabled", err)
+	}
+	if status, err := tf.Status(user); err != nil || !status.Enabled || status.RecoveryCodesLeft != RecoveryCodeCount-1 {
+		t.Errorf("Status = %+v, %v", status, err)
+	}
+
+	fresh, err := tf.RegenerateRecoveryCodes(user.ID, codeAt(6), at(6))
+	if err != nil || len(fresh) != RecoveryCodeCount {
+		t.Fatalf("RegenerateRecoveryCodes = %q, %v", fresh, err)
+	}
+	if err := tf.Verify(user.ID, recovery[1], at(7)); !errors.Is(err, ErrInvalidCode) {
+		t.Errorf("Verify with a replaced recovery code = %v, want ErrInvalidCode", err)
+	}
+
+	if err := tf.SetRequiredForAdmins(other.ID, true); !errors.Is(err, ErrTwoFactorNotEnabled) {
+		t.Errorf("requiring two-factor without having it = %v, want ErrTwoFactorNotEnabled", err)
+	}
+	if err := tf.SetRequiredForAdmins(user.ID, true); err != nil {
+		t.Fatalf("SetRequiredForAdmins: %v", err)
+	}
+	if blocked, err := tf.SetupRequired(user.ID); err != nil || blocked {
+		t.Errorf("SetupRequired with two-factor on = %v, %v", blocked, err)
+	}
+	if blocked, err := tf.SetupRequired(other.ID); err != nil || !blocked {
+		t.Errorf("SetupRequired with two-factor off = %v, %v", blocked, err)
+	}
+	if err := tf.SetRequiredForAdmins(other.ID, false); err != nil {
+		t.Fatalf("SetRequiredForAdmins: %v", err)
+	}
+
+	if err := tf.Disable(user.ID, "wrong", fresh[0], at(8)); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("Disable with the wrong password = %v, want ErrWrongPassword", err)
+	}
+	if err := tf.Disable(user.ID, "password", fresh[0], at(9)); err != nil {
+		t.Fatalf("Disable: %v", err)
+	}
+	if enabled, _ := tf.Enabled(user.ID); enabled {
+		t.Error("still enabled after Disable")
+	}
+}
+
+func TestTwoFactorAttemptLimit(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "password", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := repos.Users.ByEmail("reader@example.com")
+	tf := NewTwoFactor(repos.TwoFactor, repos.Users, "Versed")
+	now := time.Now()
+
+	setup, err := tf.Setup(user.ID, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := totp.Code(setup.Secret, totp.Step(now))
+	if _, err := tf.Enable(user.ID, code, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// Enabling took the first attempt
+	for i := 1; i < twoFactorAttempts; i++ {
+		if err := tf.Verify(user.ID, "wrong", now); !errors.Is(err, ErrInvalidCode) {
+			t.Fatalf("attempt %d = %v, want ErrInvalidCode", i+1, err)
+		}
+	}
+	later := now.Add(totp.Period)
+	code, _ = totp.Code(setup.Secret, totp.Step(later))
+	if err := tf.Verify(user.ID, code, later); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("right code over the limit = %v, want ErrTooManyAttempts", err)
+	}
+	later = now.Add(twoFactorWindow)
+	code, _ = totp.Code(setup.Secret, totp.Step(later))
+	if err := tf.Verify(user.ID, code, later); err != nil {
+		t.Errorf("right code once the window passed: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package accounts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/template/django/v3"
+
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/ratelimit"
+	"github.com/navid-m/versed/repository"
+)
+
+const (
+	// How long an email verification link works for
+	VerificationLinkLifetime = 48 * time.Hour
+	// How many verification emails a user may ask to be sent again within an
+	// hour
+	verificationResends = 3
+)
+
+var (
+	// Returned when a user asks for verification emails too often
+	ErrVerificationRateLimited = errors.New("too many verification emails requested")
+	// Returned for verification links that were tampered with, have expired or
+	// are for an address the user no longer has or wants
+	ErrInvalidVerificationLink = errors.New("verification link is invalid or has expired")
+	// Returned when asking to verify an address that already is
+	ErrAlreadyVerified = errors.New("email address is already verified")
+)
+
+// Proves users own their email address by mailing them signed links.
+//
+// Verification is only required when email can be sent; otherwise new
+// addresses are trusted as they are, since there would be no way to verify
+// them.
+type Verifier struct {
+	users   repository.Users
+	engine  *django.Engine
+	mailer  *mailer.Mailer
+	baseURL string
+	secret  []byte
+	resends *ratelimit.Limiter
+	wg      sync.WaitGroup
+}
+
+// Creates a verifier that renders its emails with the engine's templates.
+//
+// Without a secret a random one is generated, so links stop working when the
+// process restarts.
+func NewVerifier(users repository.Users, engine *django.Engine, m *mailer.Mailer, cfg Config) *Verifier {
+	secret := cfg.VerificationSecret
+	if len(secret) == 0 {
+		if m.Enabled() {
+			logger.Warn("No verification secret is configured, verification links will not survive a restart")
+		}
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &Verifier{
+		users:   users,
+		engine:  engine,
+		mailer:  m,
+		baseURL: strings.TrimRight(cfg.BaseURL, "/"),
+		secret:  secret,
+		resends: ratelimit.New(verificationResends, time.Hour),
+	}
+}
+
+// Reports whether users must verify their email address before posting,
+// commenting or voting
+func (v *Verifier) Required() bool {
+	return v.mailer.Enabled()
+}
+
+// Starts verifying a new user's address, or marks it verified straight away
+// when verification is not required
+func (v *Verifier) Begin(user *models.User, now time.Time) error {
+	if !v.Required() {
+		if err := v.users.ConfirmEmail(user.ID, user.Email); err != nil {
+			return fmt.Errorf("failed to confirm email: %w", err)
+		}
+		return nil
+	}
+	return v.send(user.ID, user.Username, user.Email, now)
+}
+
+// Records the address a user wants to change to and emails it a link that
+// makes the change. Fails with repository.ErrEmailTaken.
+func (v *Verifier) ChangeEmail(user *models.User, email string, now time.Time) error {
+	if err := v.users.SetPendingEmail(user.ID, email); err != nil {
+		return fmt.Errorf("failed to set pending email: %w", err)
+	}
+	return v.send(user.ID, user.Username, email, now)
+}
+
+// Sends the verification email again, to the address the user is changing to
+// if there is one. Fails with ErrAlreadyVerified or
+// ErrVerificationRateLimited.
+func (v *Verifier) Resend(userID int, now time.Time) error {
+	user, err := v.users.ByID(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerified || !v.Required() {
+			return ErrAlreadyVerified
+		}
+		email = user.Email
+	}
+	if !v.resends.Allow(strconv.Itoa(userID), now) {
+		return ErrVerificationRateLimited
+	}
+	return v.send(user.ID, user.Username, email, now)
+}
+
+// Checks a verification link and marks its address verified, making it the
+// user's address when it was a pending change. Fails with
+// ErrInvalidVerificationLink or repository.ErrEmailTaken.
+func (v *Verifier) Confirm(userID int, email, expires, signature string, now time.Time) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > unix {
+		return ErrInvalidVerificationLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(v.sign(userID, email, expires))) {
+		return ErrInvalidVerificationLink
+	}
+	err = v.users.ConfirmEmail(userID, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidVerificationLink
+	}
+	if err != nil {
+		return fmt.Errorf("failed to confirm email: %w", err)
+	}
+	logger.Info("Email verified", "user_id", userID)
+	return nil
+}
+
+// Returns a signed link that verifies email for a user
+func (v *Verifier) Link(userID int, email string, now time.Time) string {
+	expires := strconv.FormatInt(now.Add(VerificationLinkLifetime).Unix(), 10)
+	query := url.Values{}
+	query.Set("user", strconv.Itoa(userID))
+	query.Set("email", email)
+	query.Set("expires", expires)
+	query.Set("signature", v.sign(userID, email, expires))
+	return v.baseURL + "/verify-email?" + query.Encode()
+}
+
+// Waits for verification emails still being sent
+func (v *Verifier) Stop() {
+	v.wg.Wait()
+}
+
+// Signs a user's ID and the address being verified along with the link's
+// expiry
+func (v *Verifier) sign(userID int, email, expires string) string {
+	mac := hmac.New(sha256.New, v.secret)
+	fmt.Fprintf(mac, "%d.%s.%s", userID, email, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Renders a verification email for the address and sends it in the
+// background
+func (v *Verifier) send(userID int, username, email string, now time.Time) error {
+	binding := map[string]any{
+		"Username":  username,
+		"Email":     email,
+		"VerifyURL": v.Link(userID, email, now),
+		"Lifetime":  "48 hours",
+	}
+	var html, text bytes.Buffer
+	if err := v.engine.Render(&html, "emails/verify-email", binding); err != nil {
+		return fmt.Errorf("failed to render verification html: %w", err)
+	}
+	if err := v.engine.Render(&text, "emails/verify-email-text", binding); err != nil {
+		return fmt.Errorf("failed to render verification text: %w", err)
+	}
+	message := mailer.Message{
+		To:      email,
+		Subject: "Verify your email address for Versed",
+		Text:    text.String(),
+		HTML:    html.String(),
+	}
+
+	v.wg.Add(1)
+	go func() {
+		defer v.wg.Done()
+		if err := v.mailer.Send(message); err != nil {
+			logger.Error("Failed to send verification email", "user_id", userID, "err", err)
+			return
+		}
+		logger.Info("Sent verification email", "user_id", userID)
+	}()
+	return nil
+}
@@ -0,0 +1,154 @@
+package accounts
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/template/django/v3"
+
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/mailer/mailertest"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/repository/repositorytest"
+)
+
+var verifyLink = regexp.MustCompile(`https://versed\.test/verify-email\?\S+`)
+
+// Returns the query of the verification link in an email
+func verifyQueryFrom(t *testing.T, message mailertest.Message) url.Values {
+	t.Helper()
+	text := textPart(t, message)
+	link, err := url.Parse(verifyLink.FindString(text))
+	if err != nil || link.RawQuery == "" {
+		t.Fatalf("email lacks a verification link:\n%s", text)
+	}
+	return link.Query()
+}
+
+func TestVerifier(t *testing.T) {
+	repos := repositorytest.New()
+	for _, email := range []string{"reader@example.com", "taken@example.com"} {
+		if err := repos.Users.Create(email, email[:5], "old password", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	user, err := repos.Users.ByEmail("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := django.New("../views", ".html")
+	if err := engine.Load(); err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	server := mailertest.NewServer(t)
+	v := NewVerifier(repos.Users, engine, mailer.New(server.Config()), Config{BaseURL: "https://versed.test/", VerificationSecret: []byte("secret")})
+	now := time.Now()
+	confirm := func(query url.Values, at time.Time) error {
+		userID, _ := strconv.Atoi(query.Get("user"))
+		return v.Confirm(userID, query.Get("email"), query.Get("expires"), query.Get("signature"), at)
+	}
+
+	if err := v.Begin(user, now); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	v.Stop()
+	messages := server.WaitFor(1, 5*time.Second)
+	if len(messages) != 1 || messages[0].To[0] != "reader@example.com" {
+		t.Fatalf("got %d emails, want 1 to the reader", len(messages))
+	}
+	query := verifyQueryFrom(t, messages[0])
+
+	tampered := url.Values{}
+	for key, values := range query {
+		tampered[key] = values
+	}
+	tampered.Set("email", "taken@example.com")
+	if err := confirm(tampered, now); !errors.Is(err, ErrInvalidVerificationLink) {
+		t.Errorf("Confirm with another address = %v, want ErrInvalidVerificationLink", err)
+	}
+	if err := confirm(query, now.Add(VerificationLinkLifetime+time.Minute)); !errors.Is(err, ErrInvalidVerificationLink) {
+		t.Errorf("Confirm after the link expired = %v, want ErrInvalidVerificationLink", err)
+	}
+	if err := confirm(query, now); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if user, _ = repos.Users.ByID(user.ID); !user.EmailVerified {
+		t.Error("user not verified after following the link")
+	}
+	if err := v.Resend(user.ID, now); !errors.Is(err, ErrAlreadyVerified) {
+		t.Errorf("Resend once verified = %v, want ErrAlreadyVerified", err)
+	}
+
+	if err := v.ChangeEmail(user, "taken@example.com", now); !errors.Is(err, repository.ErrEmailTaken) {
+		t.Errorf("ChangeEmail to another user's address = %v, want ErrEmailTaken", err)
+	}
+	if err := v.ChangeEmail(user, "new@example.com", now); err != nil {
+		t.Fatalf("ChangeEmail: %v", err)
+	}
+	v.Stop()
+	messages = server.WaitFor(2, 5*time.Second)
+	if len(messages) != 2 || messages[1].To[0] != "new@example.com" {
+		t.Fatalf("got %d emails, want the second to the new address", len(messages))
+	}
+	if user, _ = repos.Users.ByID(user.ID); user.Email != "reader@example.com" {
+		t.Errorf("email changed to %q before it was verified", user.Email)
+	}
+	if err := confirm(verifyQueryFrom(t, messages[1]), now); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	if user, _ = repos.Users.ByID(user.ID); user.Email != "new@example.com" || user.PendingEmail != "" {
+		t.Errorf("after confirming the new address the user is %+v", user)
+	}
+	// The link for the old address no longer applies
+	if err := confirm(query, now); !errors.Is(err, ErrInvalidVerificationLink) {
+		t.Errorf("Confirm for the replaced address = %v, want ErrInvalidVerificationLink", err)
+	}
+}
+
+func TestVerifierResendLimit(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "old password", ""); err != nil {
+		t.Fatal(err)
+	}
+	engine := django.New("../views", ".html")
+	server := mailertest.NewServer(t)
+	v := NewVerifier(repos.Users, engine, mailer.New(server.Config()), Config{BaseURL: "https://versed.test"})
+	defer v.Stop()
+	now := time.Now()
+
+	for i := 0; i < verificationResends; i++ {
+		if err := v.Resend(1, now); err != nil {
+			t.Fatalf("Resend %d: %v", i+1, err)
+		}
+	}
+	if err := v.Resend(1, now); !errors.Is(err, ErrVerificationRateLimited) {
+		t.Errorf("Resend over the limit = %v, want ErrVerificationRateLimited", err)
+	}
+	if err := v.Resend(1, now.Add(time.Hour)); err != nil {
+		t.Errorf("Resend an hour later = %v, want nil", err)
+	}
+}
+
+func TestVerifierWithoutMail(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "old password", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := repos.Users.ByID(1)
+	v := NewVerifier(repos.Users, nil, mailer.New(mailer.Config{}), Config{})
+
+	if v.Required() {
+		t.Error("verification required without a way to send email")
+	}
+	if err := v.Begin(user, time.Now()); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if user, _ = repos.Users.ByID(1); !user.EmailVerified {
+		t.Error("address not trusted when verification is not required")
+	}
+}
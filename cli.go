@@ -0,0 +1,184 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/navid-m/versed/config"
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/models"
+)
+
+const usage = `usage: versed [-config PATH] [command] [arguments]
+
+commands:
+  serve        run the web server and background workers (default)
+  worker       run only the feed scheduler
+  fetch        fetch one feed source now and show what it found
+  migrate      manage the database schema
+  backup       copy the live SQLite database
+  restore      replace the SQLite database with a backup
+  user         list, create, promote, demote, reset-password or delete users
+  feeds        list, add, remove, disable or enable feed sources
+  import-opml  add the feeds in an OPML file
+  export-opml  write feed sources as OPML
+
+Run versed COMMAND -h for the details of a command. "versed prod" is short
+for "versed serve -tls".
+
+The configuration is read from PATH, VERSED_CONFIG or ./versed.yaml, see
+versed.example.yaml.`
+
+// The configuration file given with -config, or "" to look in the usual places
+var configPath string
+
+// Runs the command named by the arguments and returns the process exit code
+func run(args []string) int {
+	flags := flag.NewFlagSet("versed", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flags.StringVar(&configPath, "config", "", "configuration file")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	args = flags.Args()
+
+	command := "serve"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		return runServeCommand(args)
+	case "prod":
+		return runServeCommand(append([]string{"-tls"}, args...))
+	case "worker":
+		return runWorkerCommand(args)
+	case "fetch":
+		return runFetchCommand(args)
+	case "migrate":
+		return runMigrateCommand(args)
+	case "backup":
+		return runBackupCommand(args)
+	case "restore":
+		return runRestoreCommand(args)
+	case "user":
+		return runUserCommand(args)
+	case "feeds":
+		return runFeedsCommand(args)
+	case "import-opml":
+		return runImportOPMLCommand(args)
+	case "export-opml":
+		return runExportOPMLCommand(args)
+	case "help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", command, usage)
+		return 2
+	}
+}
+
+// Loads the configuration and applies the settings that live in package
+// variables
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := logging.Setup(os.Stderr, cfg.LogConfig()); err != nil {
+		return nil, err
+	}
+	models.DefaultCategories = cfg.Feeds.DefaultCategories
+	feeds.DefaultUpdateInterval = int(time.Duration(cfg.Feeds.UpdateInterval).Seconds())
+	return cfg, nil
+}
+
+// Loads the configuration and returns the database it names
+func configuredDatabaseURL() (string, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	return cfg.Database.URL, nil
+}
+
+// Loads the configuration and opens the database, migrating it the way the
+// server does. Problems are reported on stderr.
+func openConfiguredDatabase() (*config.Config, bool) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	if err := database.InitDatabase(cfg.Database.URL); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to initialize database:", err)
+		return nil, false
+	}
+	return cfg, true
+}
+
+// Parses a subcommand's flags, which may come before or after its arguments,
+// and returns the arguments. False means the flags were bad and the usage has
+// been printed.
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, bool) {
+	var rest []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, false
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return rest, true
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// Finds a user by ID or email address
+func findUser(db *sqldb.DB, ref string) (*models.User, error) {
+	var (
+		user *models.User
+		err  error
+	)
+	if id, convErr := strconv.Atoi(ref); convErr == nil {
+		user, err = database.GetUserByID(db, id)
+	} else {
+		user, err = database.GetUserByEmail(db, ref)
+	}
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.Username == models.DeletedUsername) {
+		return nil, fmt.Errorf("no user matches %q", ref)
+	}
+	return user, err
+}
+
+// Finds a feed source by ID, URL or name
+func findFeedSource(db *sqldb.DB, ref string) (*feeds.FeedSource, error) {
+	var (
+		source *feeds.FeedSource
+		err    error
+	)
+	if id, convErr := strconv.Atoi(ref); convErr == nil {
+		source, err = feeds.GetFeedSourceByID(db, id)
+	} else if strings.Contains(ref, "://") {
+		source, err = feeds.GetFeedSourceByURL(db, ref)
+	} else {
+		source, err = feeds.GetFeedSourceByName(db, ref)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("no feed source matches %q: %w", ref, err)
+	}
+	return source, err
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/passwords"
+)
+
+// Writes a configuration naming a fresh SQLite database, with no default
+// categories for new users, returning its path and the database's
+func writeCLIConfig(t *testing.T) (configFile, dbFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	dbFile = filepath.Join(dir, "versed.db")
+	configFile = filepath.Join(dir, "versed.yaml")
+	contents := fmt.Sprintf("database:\n  url: %s\nfeeds:\n  default_categories: []\nlog:\n  level: warn\n", dbFile)
+	if err := os.WriteFile(configFile, []byte(contents), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return configFile, dbFile
+}
+
+// Replaces *file with a temporary one for the rest of the test, returning
+// a function that reads what was written to it
+func captureFile(t *testing.T, file **os.File, contents string) func() string {
+	t.Helper()
+	temp, err := os.CreateTemp(t.TempDir(), "cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := temp.WriteString(contents); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	saved := *file
+	*file = temp
+	t.Cleanup(func() {
+		*file = saved
+		temp.Close()
+	})
+	return func() string {
+		out, err := os.ReadFile(temp.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+}
+
+// Runs versed with the given arguments and stdin, returning the exit code
+// and what it wrote to stdout and stderr
+func runCLI(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	readStdout := captureFile(t, &os.Stdout, "")
+	readStderr := captureFile(t, &os.Stderr, "")
+	captureFile(t, &os.Stdin, stdin)
+	// loadConfig points the logger at the captured stderr; point it back
+	t.Cleanup(func() { logging.Setup(os.Stderr, logging.Config{Level: "warn"}) })
+
+	code = run(args)
+	return code, readStdout(), readStderr()
+}
+
+// Opens the database a CLI test configured, once the commands have created it
+func openCLIDatabase(t *testing.T, dbFile string) *sqldb.DB {
+	t.Helper()
+	db, err := sqldb.Open(dbFile)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantCode int
+		// Expected in stdout for a zero exit code, stderr otherwise
+		want string
+	}{
+		{[]string{"help"}, 0, "commands:"},
+		{[]string{"-h"}, 0, ""},
+		{[]string{"-nope"}, 2, "flag provided but not defined"},
+		{[]string{"frobnicate"}, 2, `unknown command "frobnicate"`},
+		{[]string{"worker", "extra"}, 2, "usage: versed worker"},
+		{[]string{"fetch"}, 2, "usage: versed fetch"},
+		{[]string{"fetch", "-nope", "1"}, 2, "usage: versed fetch"},
+		{[]string{"user"}, 2, "usage: versed user"},
+		{[]string{"user", "frobnicate", "1"}, 2, "usage: versed user"},
+		{[]string{"user", "promote"}, 2, "usage: versed user"},
+		{[]string{"user", "create", "a@example.com"}, 2, "usage: versed user"},
+		{[]string{"user", "list", "-nope"}, 2, "usage: versed user"},
+		{[]string{"feeds"}, 2, "usage: versed feeds"},
+		{[]string{"feeds", "add", "Only a name"}, 2, "usage: versed feeds"},
+		{[]string{"feeds", "remove", "1", "2"}, 2, "usage: versed feeds"},
+		{[]string{"import-opml"}, 2, "usage: versed import-opml"},
+		{[]string{"import-opml", "-user"}, 2, "usage: versed import-opml"},
+		{[]string{"import-opml", "missing.opml"}, 1, "missing.opml"},
+		{[]string{"export-opml", "extra"}, 2, "usage: versed export-opml"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, "", tt.args...)
+		out := stdout
+		if tt.wantCode != 0 {
+			out = stderr
+		}
+		if code != tt.wantCode || !strings.Contains(out, tt.want) {
+			t.Errorf("versed %s = %d, %q; want %d and output containing %q", strings.Join(tt.args, " "), code, out, tt.wantCode, tt.want)
+		}
+	}
+}
+
+func TestUserCommand(t *testing.T) {
+	configFile, dbFile := writeCLIConfig(t)
+	tests := []struct {
+		args     []string
+		stdin    string
+		wantCode int
+		want     string
+	}{
+		{[]string{"create", "-password", "correct-horse-battery", "admin@example.com", "admin"}, "", 0, "Created user 1, admin (admin@example.com)"},
+		// Flags may follow the arguments
+		{[]string{"create", "reader@example.com", "reader", "-admin"}, "staple-of-the-day\n", 0, "Created user 2, reader (reader@example.com)"},
+		{[]string{"create", "-password", "correct-horse-battery", "admin@example.com", "other"}, "", 1, "Failed to create user"},
+		{[]string{"create", "-password", "short", "new@example.com", "new"}, "", 1, ""},
+		{[]string{"create", "new@example.com", "new"}, "\n", 1, "A password is required"},
+		{[]string{"create", "new@example.com", "new"}, "", 1, "Failed to read password"},
+		{[]string{"list"}, "", 0, "reader@example.com"},
+		{[]string{"demote", "reader@example.com"}, "", 0, "reader@example.com is no longer an admin"},
+		{[]string{"promote", "1"}, "", 0, "admin@example.com is now an admin"},
+		{[]string{"promote", "nobody@example.com"}, "", 1, `no user matches "nobody@example.com"`},
+		{[]string{"verify", "2"}, "", 0, "reader@example.com is now verified"},
+		{[]string{"disable-2fa", "2"}, "", 0, "Two-factor authentication disabled for reader@example.com"},
+		{[]string{"reset-password", "reader@example.com"}, "", 0, "New password: "},
+		{[]string{"reset-password", "-password", "another-long-passphrase", "2"}, "", 0, "Password for reader@example.com reset"},
+		{[]string{"delete", "reader@example.com"}, "", 0, "Deleted reader@example.com (user 2)"},
+		{[]string{"delete", "reader@example.com"}, "", 1, "no user matches"},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-config", configFile, "user"}, tt.args...)
+		code, stdout, stderr := runCLI(t, tt.stdin, args...)
+		out := stdout
+		if tt.wantCode != 0 {
+			out = stderr
+		}
+		if code != tt.wantCode || !strings.Contains(out, tt.want) {
+			t.Errorf("versed user %s = %d, stdout %q, stderr %q; want %d and %q", strings.Join(tt.args, " "), code, stdout, stderr, tt.wantCode, tt.want)
+		}
+	}
+
+	db := openCLIDatabase(t, dbFile)
+	admin, err := database.GetUserByEmail(db, "admin@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if !admin.IsAdmin || !admin.EmailVerified {
+		t.Errorf("admin = %+v, want a verified admin", admin)
+	}
+	if passwords.Verify(admin.Password, "correct-horse-battery") != nil {
+		t.Error("admin's password was not the one given")
+	}
+
+	if _, err := database.CreateAPIToken(db, admin.ID, "Scripts", "token-hash", []string{"read"}); err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if code, stdout, stderr := runCLI(t, "", "-config", configFile, "user", "reset-password", "admin@example.com"); code != 0 || !strings.Contains(stdout, "API tokens revoked") {
+		t.Errorf("versed user reset-password = %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if tokens, err := database.GetAPITokens(db, admin.ID); err != nil || len(tokens) != 0 {
+		t.Errorf("API tokens after reset-password = %+v, %v; want them revoked", tokens, err)
+	}
+}
+
+func TestFeedsCommand(t *testing.T) {
+	configFile, dbFile := writeCLIConfig(t)
+	tests := []struct {
+		args     []string
+		wantCode int
+		want     string
+	}{
+		{[]string{"add", "Example", "https://example.com/feed"}, 0, "Feed source 1 is Example (https://example.com/feed)"},
+		{[]string{"add", "Other", "ftp://example.com/feed"}, 1, "is not an http or https URL"},
+		{[]string{"list"}, 0, "https://example.com/feed"},
+		{[]string{"disable", "Example"}, 0, "Example is disabled"},
+		{[]string{"list"}, 0, "disabled"},
+		{[]string{"enable", "1"}, 0, "Example is enabled"},
+		{[]string{"remove", "https://example.com/feed"}, 0, "Removed Example"},
+		{[]string{"remove", "Example"}, 1, `no feed source matches "Example"`},
+	}
+	for _, tt := range tests {
+		args := append([]string{"-config", configFile, "feeds"}, tt.args...)
+		code, stdout, stderr := runCLI(t, "", args...)
+		out := stdout
+		if tt.wantCode != 0 {
+			out = stderr
+		}
+		if code != tt.wantCode || !strings.Contains(out, tt.want) {
+			t.Errorf("versed feeds %s = %d, stdout %q, stderr %q; want %d and %q", strings.Join(tt.args, " "), code, stdout, stderr, tt.wantCode, tt.want)
+		}
+	}
+
+	if sources, err := feeds.GetAllFeedSources(openCLIDatabase(t, dbFile)); err != nil || len(sources) != 0 {
+		t.Errorf("sources after removing = %+v, %v", sources, err)
+	}
+}
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Test feed</title>
+<item><title>First post</title><link>https://example.com/first</link><pubDate>Mon, 02 Feb 2026 10:00:00 GMT</pubDate></item>
+<item><title>Second post</title><link>https://example.com/second</link><pubDate>Tue, 03 Feb 2026 10:00:00 GMT</pubDate></item>
+</channel></rss>`
+
+func TestFetchCommand(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		io.WriteString(w, testRSS)
+	}))
+	defer server.Close()
+	configFile, dbFile := writeCLIConfig(t)
+
+	tests := []struct {
+		args     []string
+		wantCode int
+		want     string
+	}{
+		{[]string{"fetch", "-dry-run", server.URL + "/feed"}, 0, "Dry run, nothing saved"},
+		{[]string{"fetch", "Test feed"}, 1, `no feed source matches "Test feed"`},
+		{[]string{"fetch", server.URL + "/feed", "-name", "Test feed"}, 0, "Saved 2 items, 2 of them new"},
+		{[]string{"fetch", "Test feed"}, 0, "Saved 2 items, 0 of them new"},
+		{[]string{"fetch", server.URL + "/missing"}, 1, "Fetch failed"},
+	}
+	for _, tt := range tests {
+		code, stdout, stderr := runCLI(t, "", append([]string{"-config", configFile}, tt.args...)...)
+		out := stdout
+		if tt.wantCode != 0 {
+			out = stderr
+		}
+		if code != tt.wantCode || !strings.Contains(out, tt.want) {
+			t.Errorf("versed %s = %d, stdout %q, stderr %q; want %d and %q", strings.Join(tt.args, " "), code, stdout, stderr, tt.wantCode, tt.want)
+		}
+	}
+
+	db := openCLIDatabase(t, dbFile)
+	source, err := feeds.GetFeedSourceByName(db, "Test feed")
+	if err != nil {
+		t.Fatalf("GetFeedSourceByName: %v", err)
+	}
+	if items, err := feeds.GetFeedItemsBySource(db, source.ID, 10); err != nil || len(items) != 2 {
+		t.Errorf("saved items = %d, %v; want 2", len(items), err)
+	}
+}
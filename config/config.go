@@ -0,0 +1,576 @@
+// Package config loads the server's settings from a YAML file, lets VERSED_*
+// environment variables override them and checks the result before anything
+// starts.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/navid-m/versed/accounts"
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/exports"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/newsletters"
+)
+
+// The file read when neither a path nor VERSED_CONFIG is given. It is fine
+// for it not to exist.
+const DefaultPath = "versed.yaml"
+
+// What secrets are replaced with when the configuration is printed
+const redacted = "REDACTED"
+
+// A time.Duration written the way time.ParseDuration reads it, e.g. "90m"
+type Duration time.Duration
+
+// Parses a duration string such as "24h"
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var s string
+	if err := value.Decode(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("line %d: %w", value.Line, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Writes the duration as a string such as "24h0m0s"
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+// Everything the server can be configured with
+type Config struct {
+	Server    Server    `yaml:"server"`
+	Database  Database  `yaml:"database"`
+	Session   Session   `yaml:"session"`
+	Scheduler Scheduler `yaml:"scheduler"`
+	Snapshots Snapshots `yaml:"snapshots"`
+	Feeds     Feeds     `yaml:"feeds"`
+	Mail      Mail      `yaml:"mail"`
+	Inbound   Inbound   `yaml:"inbound"`
+	Exports   Exports   `yaml:"exports"`
+	Accounts  Accounts  `yaml:"accounts"`
+	Log       Log       `yaml:"log"`
+	Metrics   Metrics   `yaml:"metrics"`
+
+	// The file the configuration was read from, or "" if there was none
+	Path string `yaml:"-"`
+}
+
+// HTTP server settings
+type Server struct {
+	// Address plain HTTP is served on when TLS is off
+	Addr string `yaml:"addr"`
+	// Public URL of the site, used for links in emails
+	BaseURL string `yaml:"base_url"`
+	// Directory the HTML templates are loaded from
+	ViewsDir string `yaml:"views_dir"`
+	// How long /readyz fails before the server stops on shutdown, giving load
+	// balancers time to stop sending requests
+	DrainDelay Duration `yaml:"drain_delay"`
+	TLS        TLS      `yaml:"tls"`
+}
+
+// HTTPS settings
+type TLS struct {
+	Enabled  bool   `yaml:"enabled"`
+	Addr     string `yaml:"addr"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// Database settings
+type Database struct {
+	// A postgres:// URL or a SQLite path
+	URL string `yaml:"url"`
+}
+
+// Login session settings
+type Session struct {
+	Expiration Duration `yaml:"expiration"`
+}
+
+// Feed scheduler settings
+type Scheduler struct {
+	// How often every feed is updated
+	Interval Duration `yaml:"interval"`
+	// How long after the last finished update cycle /readyz starts failing
+	Staleness Duration `yaml:"staleness"`
+}
+
+// Scheduled SQLite snapshot settings
+type Snapshots struct {
+	// Where snapshots are written; snapshots are off when empty
+	Dir      string   `yaml:"dir"`
+	Interval Duration `yaml:"interval"`
+	// How many of the newest snapshots to keep, or every one when 0
+	Keep int  `yaml:"keep"`
+	Gzip bool `yaml:"gzip"`
+}
+
+// Feed settings
+type Feeds struct {
+	// How often new feed sources are due to be fetched
+	UpdateInterval Duration `yaml:"update_interval"`
+	// The categories and feeds every new user starts with
+	DefaultCategories []models.DefaultCategory `yaml:"default_categories"`
+}
+
+// Outgoing email settings. Email is off when no host is set.
+type Mail struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+// Inbound newsletter email settings
+type Inbound struct {
+	Domain string `yaml:"domain"`
+	// Address of the built-in SMTP listener, which is off when empty
+	SMTPAddr string `yaml:"smtp_addr"`
+	// Secret mail forwarders must present, which turns the HTTP endpoint off
+	// when empty
+	Secret string `yaml:"secret"`
+}
+
+// Data export settings
+type Exports struct {
+	Dir string `yaml:"dir"`
+	// Key download links are signed with; a random one is used when empty
+	Secret string `yaml:"secret"`
+}
+
+// Account deletion settings
+type Accounts struct {
+	DeletionGrace Duration `yaml:"deletion_grace"`
+	// Key email verification links are signed with; a random one is used
+	// when empty
+	VerificationSecret string `yaml:"verification_secret"`
+}
+
+// Log output settings
+type Log struct {
+	// One of debug, info, warn or error
+	Level string `yaml:"level"`
+	// text, or json for one object per line as log collectors expect
+	Format string `yaml:"format"`
+}
+
+// Settings for /metrics, which admins can always read
+type Metrics struct {
+	// Bearer token scrapers can present; token access is off when empty
+	Token string `yaml:"token"`
+	// Addresses and CIDR ranges that may scrape without a token
+	Allow []string `yaml:"allow"`
+}
+
+// Returns the settings used when nothing overrides them
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:     ":3000",
+			BaseURL:  "http://localhost:3000",
+			ViewsDir: "./views",
+			TLS:      TLS{Addr: ":443"},
+		},
+		Session:   Session{Expiration: Duration(24 * time.Hour)},
+		Scheduler: Scheduler{Interval: Duration(time.Hour), Staleness: Duration(3 * time.Hour)},
+		Snapshots: Snapshots{Interval: Duration(24 * time.Hour), Keep: 7},
+		Feeds: Feeds{
+			UpdateInterval:    Duration(time.Hour),
+			DefaultCategories: models.DefaultCategories,
+		},
+		Mail: Mail{
+			Port: 587,
+			From: "Versed <no-reply@versed.cc>",
+		},
+		Inbound:  Inbound{Domain: "in.versed.cc"},
+		Exports:  Exports{Dir: "./data-exports"},
+		Accounts: Accounts{DeletionGrace: Duration(14 * 24 * time.Hour)},
+		Log:      Log{Level: "info", Format: "text"},
+	}
+}
+
+// Loads the configuration.
+//
+// The defaults are overlaid with the YAML file at path, or at VERSED_CONFIG
+// when path is empty, or at DefaultPath if that exists. Environment variables
+// are applied on top and the result is validated.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv("VERSED_CONFIG")
+	}
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+	if err := cfg.loadFile(path); err != nil {
+		if explicit || !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	} else {
+		cfg.Path = path
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Overlays the settings in a YAML file. Unknown keys are an error so that
+// typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Overrides settings from VERSED_* environment variables. Empty variables are
+// ignored.
+func (c *Config) applyEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	duration := func(name string, dst *Duration) {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = Duration(d)
+		}
+	}
+	integer := func(name string, dst *int) {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v := os.Getenv(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	str("VERSED_ADDR", &c.Server.Addr)
+	str("VERSED_BASE_URL", &c.Server.BaseURL)
+	str("VERSED_VIEWS_DIR", &c.Server.ViewsDir)
+	duration("VERSED_DRAIN_DELAY", &c.Server.DrainDelay)
+	boolean("VERSED_TLS", &c.Server.TLS.Enabled)
+	str("VERSED_TLS_ADDR", &c.Server.TLS.Addr)
+	str("VERSED_TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	str("VERSED_TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+
+	str("VERSED_DATABASE_URL", &c.Database.URL)
+
+	duration("VERSED_SESSION_EXPIRATION", &c.Session.Expiration)
+	duration("VERSED_SCHEDULER_INTERVAL", &c.Scheduler.Interval)
+	duration("VERSED_SCHEDULER_STALENESS", &c.Scheduler.Staleness)
+
+	str("VERSED_SNAPSHOT_DIR", &c.Snapshots.Dir)
+	duration("VERSED_SNAPSHOT_INTERVAL", &c.Snapshots.Interval)
+	integer("VERSED_SNAPSHOT_KEEP", &c.Snapshots.Keep)
+	boolean("VERSED_SNAPSHOT_GZIP", &c.Snapshots.Gzip)
+
+	duration("VERSED_FEED_UPDATE_INTERVAL", &c.Feeds.UpdateInterval)
+
+	str("VERSED_SMTP_HOST", &c.Mail.Host)
+	integer("VERSED_SMTP_PORT", &c.Mail.Port)
+	str("VERSED_SMTP_USERNAME", &c.Mail.Username)
+	str("VERSED_SMTP_PASSWORD", &c.Mail.Password)
+	str("VERSED_SMTP_FROM", &c.Mail.From)
+
+	str("VERSED_INBOUND_DOMAIN", &c.Inbound.Domain)
+	str("VERSED_INBOUND_SMTP_ADDR", &c.Inbound.SMTPAddr)
+	str("VERSED_INBOUND_SECRET", &c.Inbound.Secret)
+
+	str("VERSED_EXPORT_DIR", &c.Exports.Dir)
+	str("VERSED_EXPORT_SECRET", &c.Exports.Secret)
+
+	duration("VERSED_DELETION_GRACE", &c.Accounts.DeletionGrace)
+	str("VERSED_VERIFICATION_SECRET", &c.Accounts.VerificationSecret)
+
+	str("VERSED_LOG_LEVEL", &c.Log.Level)
+	str("VERSED_LOG_FORMAT", &c.Log.Format)
+
+	str("VERSED_METRICS_TOKEN", &c.Metrics.Token)
+	if v := os.Getenv("VERSED_METRICS_ALLOW"); v != "" {
+		c.Metrics.Allow = strings.Split(v, ",")
+	}
+
+	return errors.Join(errs...)
+}
+
+// Checks that the settings make sense together, reporting every problem found
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Server.TLS.Enabled {
+		if c.Server.TLS.Addr == "" {
+			fail("server.tls.addr is required when TLS is enabled")
+		}
+		if c.Server.TLS.CertFile == "" || c.Server.TLS.KeyFile == "" {
+			fail("server.tls.cert_file and server.tls.key_file are required when TLS is enabled")
+		}
+	} else if c.Server.Addr == "" {
+		fail("server.addr is required")
+	}
+	if u, err := url.Parse(c.Server.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		fail("server.base_url must be an absolute http or https URL, got %q", c.Server.BaseURL)
+	}
+	if c.Server.ViewsDir == "" {
+		fail("server.views_dir is required")
+	}
+	if c.Server.DrainDelay < 0 {
+		fail("server.drain_delay must not be negative")
+	}
+
+	if strings.HasPrefix(c.Database.URL, "postgres://") || strings.HasPrefix(c.Database.URL, "postgresql://") {
+		if _, err := url.Parse(c.Database.URL); err != nil {
+			fail("database.url is not a valid URL")
+		}
+	}
+
+	if c.Session.Expiration <= 0 {
+		fail("session.expiration must be positive")
+	}
+	if c.Scheduler.Interval <= 0 {
+		fail("scheduler.interval must be positive")
+	}
+	if c.Scheduler.Staleness <= c.Scheduler.Interval {
+		fail("scheduler.staleness must be longer than scheduler.interval")
+	}
+	if c.Snapshots.Dir != "" && c.Snapshots.Interval <= 0 {
+		fail("snapshots.interval must be positive")
+	}
+	if c.Snapshots.Keep < 0 {
+		fail("snapshots.keep must not be negative")
+	}
+
+	if time.Duration(c.Feeds.UpdateInterval) < time.Second {
+		fail("feeds.update_interval must be at least 1s")
+	}
+	seen := make(map[string]bool)
+	for i, category := range c.Feeds.DefaultCategories {
+		name := strings.TrimSpace(category.Name)
+		if name == "" {
+			fail("feeds.default_categories[%d] has no name", i)
+			continue
+		}
+		if seen[strings.ToLower(name)] {
+			fail("feeds.default_categories has %q more than once", name)
+		}
+		seen[strings.ToLower(name)] = true
+		for j, feed := range category.Feeds {
+			if feed.Name == "" {
+				fail("feeds.default_categories[%d].feeds[%d] has no name", i, j)
+			}
+			if u, err := url.Parse(feed.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail("feeds.default_categories[%d].feeds[%d] has an invalid URL %q", i, j, feed.URL)
+			}
+		}
+	}
+
+	if c.Mail.Port < 1 || c.Mail.Port > 65535 {
+		fail("mail.port must be between 1 and 65535")
+	}
+	if c.Mail.Host != "" {
+		if _, err := mail.ParseAddress(c.Mail.From); err != nil {
+			fail("mail.from is not a valid address: %v", err)
+		}
+	}
+
+	if c.Inbound.Domain == "" {
+		fail("inbound.domain is required")
+	}
+	if c.Exports.Dir == "" {
+		fail("exports.dir is required")
+	}
+	if c.Accounts.DeletionGrace < 0 {
+		fail("accounts.deletion_grace must not be negative")
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		fail("log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		fail("log.format must be text or json, got %q", c.Log.Format)
+	}
+	if _, err := metrics.ParseAllowList(c.Metrics.Allow); err != nil {
+		fail("metrics.allow has an %v", err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Returns the configuration as YAML with passwords and secrets replaced, fit
+// for printing to logs
+func (c *Config) Redacted() string {
+	out, err := yaml.Marshal(c.redacted())
+	if err != nil {
+		return fmt.Sprintf("failed to print config: %v", err)
+	}
+	return string(out)
+}
+
+// Logs the configuration as nested groups holding the same values Redacted
+// prints, so it stays a single record in either log format
+func (c *Config) LogValue() slog.Value {
+	var node yaml.Node
+	if err := node.Encode(c.redacted()); err != nil {
+		return slog.StringValue(fmt.Sprintf("failed to log config: %v", err))
+	}
+	return yamlLogValue(&node)
+}
+
+// Returns a copy of the configuration with passwords and secrets replaced
+func (c *Config) redacted() *Config {
+	copied := *c
+	for _, secret := range []*string{&copied.Mail.Password, &copied.Inbound.Secret, &copied.Exports.Secret, &copied.Accounts.VerificationSecret, &copied.Metrics.Token} {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	if u, err := url.Parse(copied.Database.URL); err == nil && u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			copied.Database.URL = u.String()
+		}
+	}
+	return &copied
+}
+
+// Turns an encoded YAML node into a log value, with mappings as groups in
+// the order they were written
+func yamlLogValue(node *yaml.Node) slog.Value {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 1 {
+			return yamlLogValue(node.Content[0])
+		}
+	case yaml.MappingNode:
+		attrs := make([]slog.Attr, 0, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			attrs = append(attrs, slog.Attr{Key: node.Content[i].Value, Value: yamlLogValue(node.Content[i+1])})
+		}
+		return slog.GroupValue(attrs...)
+	}
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return slog.StringValue(node.Value)
+	}
+	return slog.AnyValue(value)
+}
+
+// Returns the settings for outgoing email
+func (c *Config) MailerConfig() mailer.Config {
+	return mailer.Config{
+		Host:     c.Mail.Host,
+		Port:     strconv.Itoa(c.Mail.Port),
+		Username: c.Mail.Username,
+		Password: c.Mail.Password,
+		From:     c.Mail.From,
+	}
+}
+
+// Returns the settings for scheduled snapshots
+func (c *Config) SnapshotConfig() database.SnapshotConfig {
+	return database.SnapshotConfig{
+		Dir:      c.Snapshots.Dir,
+		Interval: time.Duration(c.Snapshots.Interval),
+		Keep:     c.Snapshots.Keep,
+		Compress: c.Snapshots.Gzip,
+	}
+}
+
+// Returns the settings for inbound newsletter email
+func (c *Config) NewslettersConfig() newsletters.Config {
+	return newsletters.Config{
+		Domain:   c.Inbound.Domain,
+		SMTPAddr: c.Inbound.SMTPAddr,
+		Secret:   c.Inbound.Secret,
+	}
+}
+
+// Returns the settings for data exports
+func (c *Config) ExportsConfig() exports.Config {
+	return exports.Config{
+		Dir:     c.Exports.Dir,
+		Secret:  []byte(c.Exports.Secret),
+		BaseURL: c.Server.BaseURL,
+	}
+}
+
+// Returns the settings for log output
+func (c *Config) LogConfig() logging.Config {
+	return logging.Config{Level: c.Log.Level, Format: c.Log.Format}
+}
+
+// Returns who besides admins may read /metrics. The allowlist must have
+// passed Validate.
+func (c *Config) MetricsAccess() metrics.Access {
+	allow, _ := metrics.ParseAllowList(c.Metrics.Allow)
+	return metrics.Access{Token: c.Metrics.Token, Allow: allow}
+}
+
+// Returns the settings for account deletion
+func (c *Config) AccountsConfig() accounts.Config {
+	return accounts.Config{
+		GracePeriod:        time.Duration(c.Accounts.DeletionGrace),
+		BaseURL:            c.Server.BaseURL,
+		VerificationSecret: []byte(c.Accounts.VerificationSecret),
+	}
+}
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/models"
+)
+
+// Schedules a user's account to be deleted at the given time
+func ScheduleAccountDeletion(db *sqldb.DB, userID int, at time.Time) error {
+	result, err := db.Exec(`UPDATE users SET deletion_scheduled_at = ? WHERE id = ? AND deleted_at IS NULL`, at.UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to schedule account deletion: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Calls off a scheduled account deletion
+func CancelAccountDeletion(db *sqldb.DB, userID int) error {
+	_, err := db.Exec(`UPDATE users SET deletion_scheduled_at = NULL WHERE id = ? AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+	return nil
+}
+
+// Returns when a user's account is scheduled to be deleted, or nil if it is not
+func GetAccountDeletion(db *sqldb.DB, userID int) (*time.Time, error) {
+	var scheduledAt sql.NullTime
+	err := db.QueryRow(`SELECT deletion_scheduled_at FROM users WHERE id = ?`, userID).Scan(&scheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	if !scheduledAt.Valid {
+		return nil, nil
+	}
+	return &scheduledAt.Time, nil
+}
+
+// Returns the users whose grace period is over and who are due to be deleted
+func GetDueAccountDeletions(db *sqldb.DB, now time.Time) ([]int, error) {
+	rows, err := db.Query(`SELECT id FROM users
+	                       WHERE deleted_at IS NULL AND deletion_scheduled_at IS NOT NULL AND `+
+		db.Dialect.Datetime("deletion_scheduled_at")+` <= ?
+	                       ORDER BY id`, now.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due account deletions: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Deletes a user's account.
+//
+// Personal rows such as categories, the reading list, hidden posts, votes,
+// webhooks, saved searches and newsletter addresses are removed, and the
+// scores the user's votes went into are taken back. Comments and posts stay
+// up but are shown under models.DeletedUsername. The users row itself is kept with
+// its details wiped, since comments and posts still point at it, and the
+// user's sessions are ended.
+func DeleteAccount(db *sqldb.DB, userID int, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deletedAt sql.NullTime
+	if err := tx.QueryRow(`SELECT deleted_at FROM users WHERE id = ?`, userID).Scan(&deletedAt); err != nil {
+		return err
+	}
+	if deletedAt.Valid {
+		return nil
+	}
+
+	// Feed item scores may start from the upstream feed's own score, so the
+	// user's votes are subtracted rather than the score being recounted
+	_, err = tx.Exec(`UPDATE feed_items
+	                  SET score = score - (SELECT CASE WHEN v.vote_type = 'upvote' THEN 1 ELSE -1 END
+	                                       FROM upvotes v WHERE v.item_id = feed_items.id AND v.user_id = ?)
+	                  WHERE id IN (SELECT item_id FROM upvotes WHERE user_id = ?)`, userID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to take back item votes: %w", err)
+	}
+
+	var postIDs []string
+	rows, err := tx.Query(`SELECT post_id FROM post_votes WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get post votes: %w", err)
+	}
+	for rows.Next() {
+		var postID string
+		if err := rows.Scan(&postID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan post vote: %w", err)
+		}
+		postIDs = append(postIDs, postID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, query := range []string{
+		`DELETE FROM post_votes WHERE user_id = ?`,
+		`DELETE FROM upvotes WHERE user_id = ?`,
+		`DELETE FROM reading_list WHERE user_id = ?`,
+		`DELETE FROM hidden_posts WHERE user_id = ?`,
+		`DELETE FROM user_category_feeds WHERE user_id = ?`,
+		`DELETE FROM user_categories WHERE user_id = ?`,
+		`DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)`,
+		`DELETE FROM webhooks WHERE user_id = ?`,
+		`DELETE FROM digest_subscriptions WHERE user_id = ?`,
+		`DELETE FROM saved_search_matches WHERE search_id IN (SELECT id FROM saved_searches WHERE user_id = ?)`,
+		`DELETE FROM saved_searches WHERE user_id = ?`,
+		`DELETE FROM newsletter_messages WHERE user_id = ?`,
+		`DELETE FROM newsletter_addresses WHERE user_id = ?`,
+		`DELETE FROM data_exports WHERE user_id = ?`,
+		`DELETE FROM password_resets WHERE user_id = ?`,
+		`DELETE FROM recovery_codes WHERE user_id = ?`,
+		`DELETE FROM two_factor WHERE user_id = ?`,
+		`DELETE FROM api_tokens WHERE user_id = ?`,
+		`UPDATE comments SET username = '` + models.DeletedUsername + `' WHERE user_id = ?`,
+		`UPDATE post_comments SET username = '` + models.DeletedUsername + `' WHERE user_id = ?`,
+	} {
+		if _, err := tx.Exec(query, userID); err != nil {
+			return fmt.Errorf("failed to delete account data: %w", err)
+		}
+	}
+
+	for _, postID := range postIDs {
+		if err := updatePostScore(tx, postID); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE users
+	                  SET email = ?, username = ?, password = '', ip_address = NULL, is_admin = ?, pending_email = NULL,
+	                      deletion_scheduled_at = NULL, deleted_at = ?
+	                  WHERE id = ?`,
+		fmt.Sprintf("deleted-%d@deleted.invalid", userID), models.DeletedUsername, false, now.UTC(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return DeleteUserSessions(db, userID)
+}
+
+// Ends every session signed in as the given user
+func DeleteUserSessions(db *sqldb.DB, userID int) error {
+	rows, err := db.Query(`SELECT session_id, data FROM sessions`)
+	if err != nil {
+		return fmt.Errorf("failed to get sessions: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id, data string
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan session: %w", err)
+		}
+		// Sessions are stored the way fiber encodes them, as a gob of their values
+		var values map[string]any
+		if err := gob.NewDecoder(bytes.NewReader([]byte(data))).Decode(&values); err != nil {
+			continue
+		}
+		if owner, ok := values["user_id"].(int); ok && owner == userID {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := db.Exec(`DELETE FROM sessions WHERE session_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		testDeleteAccount(t, db)
+	})
+}
+
+// Stores a session the way fiber does
+func storeSession(t *testing.T, db *sqldb.DB, id string, values map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+		t.Fatalf("failed to encode session: %v", err)
+	}
+	if err := NewDBSessionStorage(db).Set(id, buf.Bytes(), time.Hour); err != nil {
+		t.Fatalf("failed to store session: %v", err)
+	}
+}
+
+func testDeleteAccount(t *testing.T, db *sqldb.DB) {
+	for _, name := range []string{"leaving", "staying"} {
+		if err := CreateUser(db, name+"@example.com", name, "secret", "10.0.0.1"); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	leaving, err := GetUserByEmail(db, "leaving@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	staying, err := GetUserByEmail(db, "staying@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+
+	source, err := feeds.CreateOrUpdateFeedSource(db, "Example", "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("CreateOrUpdateFeedSource: %v", err)
+	}
+	// The item starts with a score from its upstream feed
+	_, err = db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author, score) VALUES ('item-1', ?, 'Title', 'https://example.com/1', '', '', 10)`, source.ID)
+	if err != nil {
+		t.Fatalf("failed to insert item: %v", err)
+	}
+	itemScore := func() int {
+		t.Helper()
+		var score int
+		if err := db.QueryRow(`SELECT score FROM feed_items WHERE id = 'item-1'`).Scan(&score); err != nil {
+			t.Fatalf("failed to get item score: %v", err)
+		}
+		return score
+	}
+
+	if _, err := feeds.HandleVote(db, "item-1", leaving.ID, "upvote"); err != nil {
+		t.Fatalf("HandleVote: %v", err)
+	}
+	if _, err := feeds.HandleVote(db, "item-1", staying.ID, "upvote"); err != nil {
+		t.Fatalf("HandleVote: %v", err)
+	}
+	if _, err := SaveToReadingList(db, leaving.ID, "item-1"); err != nil {
+		t.Fatalf("SaveToReadingList: %v", err)
+	}
+	if err := HideFeedItem(db, leaving.ID, "item-1"); err != nil {
+		t.Fatalf("HideFeedItem: %v", err)
+	}
+	comment, err := CreateComment(db, "item-1", leaving.ID, leaving.Username, "Leaving soon", nil)
+	if err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	subverse, err := CreateSubverse(db, "golang")
+	if err != nil {
+		t.Fatalf("CreateSubverse: %v", err)
+	}
+	post, err := CreatePost(db, subverse.ID, leaving.ID, leaving.Username, "My post", "Body", "text", "")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	otherPost, err := CreatePost(db, subverse.ID, staying.ID, staying.Username, "Their post", "Body", "text", "")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if _, err := CreatePostComment(db, otherPost.ID, leaving.ID, leaving.Username, "Nice post", nil); err != nil {
+		t.Fatalf("CreatePostComment: %v", err)
+	}
+	if err := VoteOnPost(db, leaving.ID, otherPost.ID, "downvote"); err != nil {
+		t.Fatalf("VoteOnPost: %v", err)
+	}
+	if err := VoteOnPost(db, staying.ID, otherPost.ID, "upvote"); err != nil {
+		t.Fatalf("VoteOnPost: %v", err)
+	}
+	if _, err := CreateSavedSearch(db, leaving.ID, "Go", "golang"); err != nil {
+		t.Fatalf("CreateSavedSearch: %v", err)
+	}
+	if _, err := CreateDataExport(db, leaving.ID); err != nil {
+		t.Fatalf("CreateDataExport: %v", err)
+	}
+	storeSession(t, db, "leaving-session", map[string]any{"user_id": leaving.ID, "user_email": leaving.Email})
+	storeSession(t, db, "staying-session", map[string]any{"user_id": staying.ID, "user_email": staying.Email})
+	storeSession(t, db, "anonymous-session", map[string]any{})
+
+	if score := itemScore(); score != 12 {
+		t.Fatalf("item score before deletion = %d, want 12", score)
+	}
+
+	// Scheduling and cancelling
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	if err := ScheduleAccountDeletion(db, leaving.ID, now.Add(time.Hour)); err != nil {
+		t.Fatalf("ScheduleAccountDeletion: %v", err)
+	}
+	scheduledAt, err := GetAccountDeletion(db, leaving.ID)
+	if err != nil {
+		t.Fatalf("GetAccountDeletion: %v", err)
+	}
+	if scheduledAt == nil || !scheduledAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("scheduled at %v, want %v", scheduledAt, now.Add(time.Hour))
+	}
+	if due, err := GetDueAccountDeletions(db, now); err != nil || len(due) != 0 {
+		t.Errorf("GetDueAccountDeletions before the grace period ended = %v, %v", due, err)
+	}
+	if err := CancelAccountDeletion(db, leaving.ID); err != nil {
+		t.Fatalf("CancelAccountDeletion: %v", err)
+	}
+	if due, err := GetDueAccountDeletions(db, now.Add(2*time.Hour)); err != nil || len(due) != 0 {
+		t.Errorf("GetDueAccountDeletions after cancelling = %v, %v", due, err)
+	}
+	if err := ScheduleAccountDeletion(db, leaving.ID, now.Add(time.Hour)); err != nil {
+		t.Fatalf("ScheduleAccountDeletion: %v", err)
+	}
+	due, err := GetDueAccountDeletions(db, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GetDueAccountDeletions: %v", err)
+	}
+	if len(due) != 1 || due[0] != leaving.ID {
+		t.Fatalf("due deletions = %v, want [%d]", due, leaving.ID)
+	}
+
+	if err := CreatePasswordReset(db, leaving.ID, "reset-hash", "", now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreatePasswordReset: %v", err)
+	}
+
+	if err := DeleteAccount(db, leaving.ID, now.Add(time.Hour)); err != nil {
+		t.Fatalf("DeleteAccount: %v", err)
+	}
+	if err := DeleteAccount(db, leaving.ID, now.Add(2*time.Hour)); err != nil {
+		t.Errorf("deleting an already deleted account: %v", err)
+	}
+	if err := DeleteAccount(db, 9999, now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting a missing account = %v, want sql.ErrNoRows", err)
+	}
+
+	for _, table := range []string{"upvotes", "post_votes", "reading_list", "hidden_posts",
+		"user_categories", "user_category_feeds", "saved_searches", "data_exports", "digest_subscriptions", "password_resets"} {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE user_id = ?`, leaving.ID).Scan(&n); err != nil {
+			t.Fatalf("failed to count %s: %v", table, err)
+		}
+		if n != 0 {
+			t.Errorf("%s still has %d rows for the deleted user", table, n)
+		}
+	}
+
+	if score := itemScore(); score != 11 {
+		t.Errorf("item score after deletion = %d, want 11", score)
+	}
+	updated, err := GetPostByID(db, otherPost.ID)
+	if err != nil {
+		t.Fatalf("GetPostByID: %v", err)
+	}
+	if updated.Score != 1 {
+		t.Errorf("post score after deletion = %d, want 1", updated.Score)
+	}
+
+	kept, err := GetPostByID(db, post.ID)
+	if err != nil {
+		t.Fatalf("deleted user's post is gone: %v", err)
+	}
+	if kept.Username != models.DeletedUsername {
+		t.Errorf("post username = %q, want %q", kept.Username, models.DeletedUsername)
+	}
+	var username string
+	if err := db.QueryRow(`SELECT username FROM comments WHERE id = ?`, comment.ID).Scan(&username); err != nil {
+		t.Fatalf("deleted user's comment is gone: %v", err)
+	}
+	if username != models.DeletedUsername {
+		t.Errorf("comment username = %q, want %q", username, models.DeletedUsername)
+	}
+	if err := db.QueryRow(`SELECT username FROM post_comments WHERE user_id = ?`, leaving.ID).Scan(&username); err != nil {
+		t.Fatalf("deleted user's post comment is gone: %v", err)
+	}
+	if username != models.DeletedUsername {
+		t.Errorf("post comment username = %q, want %q", username, models.DeletedUsername)
+	}
+
+	tombstone, err := GetUserByID(db, leaving.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if tombstone.Email == leaving.Email || tombstone.Username != models.DeletedUsername || tombstone.Password != "" || tombstone.IPAddress != "" {
+		t.Errorf("deleted user = %+v", tombstone)
+	}
+	if _, err := GetUserByEmail(db, leaving.Email); err == nil {
+		t.Error("deleted user can still be found by email")
+	}
+	users, err := GetAllUsers(db)
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	for _, user := range users {
+		if user.ID == leaving.ID {
+			t.Error("GetAllUsers lists the deleted user")
+		}
+	}
+
+	storage := NewDBSessionStorage(db)
+	for id, want := range map[string]bool{"leaving-session": false, "staying-session": true, "anonymous-session": true} {
+		data, err := storage.Get(id)
+		if err != nil {
+			t.Fatalf("failed to get session: %v", err)
+		}
+		if got := data != nil; got != want {
+			t.Errorf("session %s exists = %v, want %v", id, got, want)
+		}
+	}
+}
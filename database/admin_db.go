@@ -3,11 +3,12 @@ package database
 import (
 	"database/sql"
 
+	"github.com/navid-m/versed/database/sqldb"
 	"github.com/navid-m/versed/models"
 )
 
 // CreateBannedIPTable creates the banned_ips table if it doesn't exist
-func CreateBannedIPTable(db *sql.DB) error {
+func CreateBannedIPTable(db *sqldb.DB) error {
 	query := `
 		CREATE TABLE IF NOT EXISTS banned_ips (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -27,55 +28,55 @@ func CreateBannedIPTable(db *sql.DB) error {
 }
 
 // BanIP bans an IP address
-func BanIP(ipAddress, reason string, bannedBy int) error {
+func BanIP(db *sqldb.DB, ipAddress, reason string, bannedBy int) error {
 	query := `
 		INSERT INTO banned_ips (ip_address, banned_by, reason, is_active)
-		VALUES (?, ?, ?, 1)
+		VALUES (?, ?, ?, TRUE)
 		ON CONFLICT(ip_address) DO UPDATE SET
 			banned_at = CURRENT_TIMESTAMP,
 			banned_by = ?,
 			reason = ?,
-			is_active = 1,
+			is_active = TRUE,
 			unbanned_at = NULL,
 			unbanned_by = NULL
 	`
-	_, err := GetDB().Exec(query, ipAddress, bannedBy, reason, bannedBy, reason)
+	_, err := db.Exec(query, ipAddress, bannedBy, reason, bannedBy, reason)
 	return err
 }
 
 // UnbanIP unbans an IP address
-func UnbanIP(ipAddress string, unbannedBy int) error {
+func UnbanIP(db *sqldb.DB, ipAddress string, unbannedBy int) error {
 	query := `
 		UPDATE banned_ips
-		SET is_active = 0,
+		SET is_active = FALSE,
 			unbanned_at = CURRENT_TIMESTAMP,
 			unbanned_by = ?
-		WHERE ip_address = ? AND is_active = 1
+		WHERE ip_address = ? AND is_active = TRUE
 	`
-	_, err := GetDB().Exec(query, unbannedBy, ipAddress)
+	_, err := db.Exec(query, unbannedBy, ipAddress)
 	return err
 }
 
 // IsIPBanned checks if an IP address is currently banned
-func IsIPBanned(ipAddress string) (bool, error) {
+func IsIPBanned(db *sqldb.DB, ipAddress string) (bool, error) {
 	query := `
 		SELECT COUNT(*) > 0
 		FROM banned_ips
-		WHERE ip_address = ? AND is_active = 1
+		WHERE ip_address = ? AND is_active = TRUE
 	`
 	var isBanned bool
-	err := GetDB().QueryRow(query, ipAddress).Scan(&isBanned)
+	err := db.QueryRow(query, ipAddress).Scan(&isBanned)
 	return isBanned, err
 }
 
 // GetAllBannedIPs retrieves all banned IP addresses
-func GetAllBannedIPs() ([]models.BannedIP, error) {
+func GetAllBannedIPs(db *sqldb.DB) ([]models.BannedIP, error) {
 	query := `
 		SELECT id, ip_address, banned_at, banned_by, reason, is_active, unbanned_at, unbanned_by
 		FROM banned_ips
 		ORDER BY banned_at DESC
 	`
-	rows, err := GetDB().Query(query)
+	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -116,7 +117,7 @@ func GetAllBannedIPs() ([]models.BannedIP, error) {
 }
 
 // GetBannedIPByID retrieves a banned IP by its ID
-func GetBannedIPByID(id int) (*models.BannedIP, error) {
+func GetBannedIPByID(db *sqldb.DB, id int) (*models.BannedIP, error) {
 	query := `
 		SELECT id, ip_address, banned_at, banned_by, reason, is_active, unbanned_at, unbanned_by
 		FROM banned_ips
@@ -126,7 +127,7 @@ func GetBannedIPByID(id int) (*models.BannedIP, error) {
 	var unbannedAt sql.NullTime
 	var unbannedBy sql.NullInt64
 
-	err := GetDB().QueryRow(query, id).Scan(
+	err := db.QueryRow(query, id).Scan(
 		&bannedIP.ID,
 		&bannedIP.IPAddress,
 		&bannedIP.BannedAt,
@@ -152,16 +153,16 @@ func GetBannedIPByID(id int) (*models.BannedIP, error) {
 }
 
 // UpdateUserAdminStatus updates a user's admin status
-func UpdateUserAdminStatus(userID int, isAdmin bool) error {
+func UpdateUserAdminStatus(db *sqldb.DB, userID int, isAdmin bool) error {
 	query := `UPDATE users SET is_admin = ? WHERE id = ?`
-	_, err := GetDB().Exec(query, isAdmin, userID)
+	_, err := db.Exec(query, isAdmin, userID)
 	return err
 }
 
 // IsUserAdmin checks if a user is an admin
-func IsUserAdmin(userID int) (bool, error) {
+func IsUserAdmin(db *sqldb.DB, userID int) (bool, error) {
 	query := `SELECT is_admin FROM users WHERE id = ?`
 	var isAdmin bool
-	err := GetDB().QueryRow(query, userID).Scan(&isAdmin)
+	err := db.QueryRow(query, userID).Scan(&isAdmin)
 	return isAdmin, err
 }
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/models"
+)
+
+const apiTokenSelect = `SELECT id, user_id, name, scopes, created_at, last_used_at FROM api_tokens`
+
+// Scans an API token row
+func scanAPIToken(row interface{ Scan(...any) error }) (*models.APIToken, error) {
+	var token models.APIToken
+	var scopes string
+	var lastUsedAt sql.NullTime
+	if err := row.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.CreatedAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	token.Scopes = strings.Fields(scopes)
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return &token, nil
+}
+
+// Stores a new personal access token by its hash
+func CreateAPIToken(db *sqldb.DB, userID int, name, hash string, scopes []string) (*models.APIToken, error) {
+	var id int
+	err := db.QueryRow(`INSERT INTO api_tokens (user_id, name, token_hash, scopes) VALUES (?, ?, ?, ?) RETURNING id`,
+		userID, name, hash, strings.Join(scopes, " ")).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+	return scanAPIToken(db.QueryRow(apiTokenSelect+` WHERE id = ?`, id))
+}
+
+// Retrieves a user's personal access tokens, newest first
+func GetAPITokens(db *sqldb.DB, userID int) ([]models.APIToken, error) {
+	rows, err := db.Query(apiTokenSelect+` WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		tokens = append(tokens, *token)
+	}
+	return tokens, rows.Err()
+}
+
+// Retrieves a personal access token by its hash, or sql.ErrNoRows if there is
+// no such token
+func GetAPITokenByHash(db *sqldb.DB, hash string) (*models.APIToken, error) {
+	return scanAPIToken(db.QueryRow(apiTokenSelect+` WHERE token_hash = ?`, hash))
+}
+
+// Records that a personal access token was just used
+func MarkAPITokenUsed(db *sqldb.DB, id int, now time.Time) error {
+	if _, err := db.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now.UTC(), id); err != nil {
+		return fmt.Errorf("failed to mark API token used: %w", err)
+	}
+	return nil
+}
+
+// Revokes every personal access token a user has
+func DeleteUserAPITokens(db *sqldb.DB, userID int) error {
+	if _, err := db.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete API tokens: %w", err)
+	}
+	return nil
+}
+
+// Revokes one of a user's personal access tokens, returning sql.ErrNoRows if
+// they have no such token
+func DeleteAPIToken(db *sqldb.DB, userID, id int) error {
+	result, err := db.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
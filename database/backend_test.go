@@ -0,0 +1,140 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+// Exercises queries whose SQL differs between dialects against each backend
+func TestBackendQueries(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+
+		var userID int
+		err := db.QueryRow(`INSERT INTO users (email, username, password) VALUES (?, ?, ?) RETURNING id`,
+			"a@example.com", "alice", "x").Scan(&userID)
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+
+		category, err := CreateUserCategory(db, userID, "Tech", "")
+		if err != nil {
+			t.Fatalf("CreateUserCategory: %v", err)
+		}
+		var sourceID int
+		query, args, _ := FeedInsertionBuilder.Values("Example", "https://example.com/rss", "2000-01-01 00:00:00", 3600).ToSql()
+		if err := db.QueryRow(query, args...).Scan(&sourceID); err != nil {
+			t.Fatalf("failed to create feed source: %v", err)
+		}
+		for range 2 {
+			if err := AddFeedToUserCategory(db, userID, category.ID, sourceID); err != nil {
+				t.Fatalf("AddFeedToUserCategory: %v", err)
+			}
+		}
+
+		_, err = db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author, published_at, score) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			"item-1", sourceID, "Go 2 released", "https://example.com/1", "", "", time.Now().UTC(), 10)
+		if err != nil {
+			t.Fatalf("failed to create feed item: %v", err)
+		}
+		digest, err := GetDigestCategories(db, userID, time.Now().Add(-time.Hour), 5)
+		if err != nil {
+			t.Fatalf("GetDigestCategories: %v", err)
+		}
+		if len(digest) != 1 || len(digest[0].Items) != 1 {
+			t.Errorf("digest = %+v, want one category with one item", digest)
+		}
+
+		if err := SetDigestFrequency(db, userID, models.DigestDaily); err != nil {
+			t.Fatalf("SetDigestFrequency: %v", err)
+		}
+		if due, err := GetDueDigestSubscriptions(db, time.Now()); err != nil || len(due) != 0 {
+			t.Errorf("due digests for an unverified address = %d, %v; want 0", len(due), err)
+		}
+		if err := ConfirmUserEmail(db, userID, "a@example.com", time.Now()); err != nil {
+			t.Fatalf("ConfirmUserEmail: %v", err)
+		}
+		if due, err := GetDueDigestSubscriptions(db, time.Now()); err != nil || len(due) != 1 {
+			t.Errorf("due digests = %d, %v; want 1", len(due), err)
+		}
+		if err := MarkDigestSent(db, userID, time.Now()); err != nil {
+			t.Fatalf("MarkDigestSent: %v", err)
+		}
+		if due, err := GetDueDigestSubscriptions(db, time.Now()); err != nil || len(due) != 0 {
+			t.Errorf("due digests after sending = %d, %v; want 0", len(due), err)
+		}
+
+		if _, err := CreateWebhook(db, userID, "hook", "https://example.com/hook", "secret", "keyword", "go"); err != nil {
+			t.Fatalf("CreateWebhook: %v", err)
+		}
+		if hooks, err := GetEnabledWebhooks(db); err != nil || len(hooks) != 1 {
+			t.Errorf("enabled webhooks = %d, %v; want 1", len(hooks), err)
+		}
+
+		sessions := NewDBSessionStorage(db)
+		if err := sessions.Set("session", []byte("data"), time.Hour); err != nil {
+			t.Fatalf("session Set: %v", err)
+		}
+		if data, err := sessions.Get("session"); err != nil || string(data) != "data" {
+			t.Errorf("session Get = %q, %v", data, err)
+		}
+
+		subverse, err := CreateSubverse(db, "golang")
+		if err != nil {
+			t.Fatalf("CreateSubverse: %v", err)
+		}
+		if _, err := CreatePost(db, subverse.ID, userID, "alice", "Generics", "Type Parameters", "text", ""); err != nil {
+			t.Fatalf("CreatePost: %v", err)
+		}
+		if posts, err := SearchPostsBySubverse(db, subverse.ID, "type param", 10, 0); err != nil || len(posts) != 1 {
+			t.Errorf("case-insensitive search found %d posts, %v; want 1", len(posts), err)
+		}
+	})
+}
+
+// Refetching an item takes the source's new score without losing local votes
+func TestSaveFeedItemsRefreshesUpstreamScore(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+
+		var userID, sourceID int
+		err := db.QueryRow(`INSERT INTO users (email, username, password) VALUES (?, ?, ?) RETURNING id`,
+			"a@example.com", "alice", "x").Scan(&userID)
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		query, args, _ := FeedInsertionBuilder.Values("Hacker News", "https://news.ycombinator.com/rss", "2000-01-01 00:00:00", 3600).ToSql()
+		if err := db.QueryRow(query, args...).Scan(&sourceID); err != nil {
+			t.Fatalf("failed to create feed source: %v", err)
+		}
+
+		now := time.Now().UTC()
+		item := feeds.FeedItem{ID: "hn-1", SourceID: sourceID, Title: "Show HN", URL: "https://example.com/hn", Score: 10, PublishedAt: &now, CreatedAt: &now}
+		if _, err := feeds.SaveNewFeedItems(db, []feeds.FeedItem{item}); err != nil {
+			t.Fatalf("SaveNewFeedItems: %v", err)
+		}
+		if score, err := feeds.HandleVote(db, item.ID, userID, "upvote"); err != nil || score != 11 {
+			t.Fatalf("HandleVote = %d, %v; want 11", score, err)
+		}
+
+		item.Score = 50
+		if inserted, err := feeds.SaveNewFeedItems(db, []feeds.FeedItem{item}); err != nil || len(inserted) != 0 {
+			t.Fatalf("SaveNewFeedItems again = %d, %v; want nothing inserted", len(inserted), err)
+		}
+		var score int
+		if err := db.QueryRow(`SELECT score FROM feed_items WHERE id = ?`, item.ID).Scan(&score); err != nil || score != 51 {
+			t.Errorf("score after the source reported 50 = %d, %v; want 51", score, err)
+		}
+		if score, err := feeds.HandleVote(db, item.ID, userID, "upvote"); err != nil || score != 50 {
+			t.Errorf("HandleVote undoing the vote = %d, %v; want 50", score, err)
+		}
+	})
+}
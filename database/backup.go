@@ -0,0 +1,352 @@
+package database
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+// Returned when a backup or restore is attempted on a PostgreSQL database,
+// which should be backed up with pg_dump instead
+var ErrBackupUnsupported = errors.New("backups are only supported for SQLite databases")
+
+// Suffix of compressed backups
+const gzipSuffix = ".gz"
+
+// Copies a live SQLite database to path with SQLite's online backup API.
+//
+// Writers are not blocked while the copy is made, and the copy is consistent
+// even in WAL mode. The backup is gzipped when compress is set. It is written
+// next to path first and renamed into place, so a failed backup never leaves
+// a partial file behind.
+func Backup(db *sqldb.DB, path string, compress bool) error {
+	if db.Dialect != sqldb.SQLite {
+		return ErrBackupUnsupported
+	}
+
+	tmp, err := tempPath(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := copySQLite(db.DB, tmp); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	if compress {
+		if err := gzipFile(tmp, path); err != nil {
+			return fmt.Errorf("failed to compress backup: %w", err)
+		}
+		return nil
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to move backup into place: %w", err)
+	}
+	return nil
+}
+
+// Replaces the SQLite database at dsn with a backup, returning the backup's
+// schema version.
+//
+// The backup, gzipped or not, must pass PRAGMA integrity_check and be at a
+// schema version this binary knows about; older versions are migrated up on
+// the next start. It is copied in with the online backup API, so the
+// database's WAL is dealt with properly, but the server should still be
+// stopped while restoring.
+func Restore(backupPath, dsn string) (int, error) {
+	dialect, targetPath := sqldb.ParseDSN(dsn)
+	if dialect != sqldb.SQLite {
+		return 0, ErrBackupUnsupported
+	}
+	if _, err := os.Stat(backupPath); err != nil {
+		return 0, err
+	}
+
+	// Checking the schema version may write to the database, so the checks
+	// run against a copy and the backup itself is left alone
+	source, err := tempPath(targetPath)
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(source)
+	if strings.HasSuffix(backupPath, gzipSuffix) {
+		err = gunzipFile(backupPath, source)
+	} else {
+		err = copyFile(backupPath, source)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	raw, err := sql.Open("sqlite3", source)
+	if err != nil {
+		return 0, err
+	}
+	defer raw.Close()
+	backup := sqldb.New(raw, sqldb.SQLite)
+
+	if err := CheckIntegrity(backup); err != nil {
+		return 0, err
+	}
+	version, err := SchemaVersion(backup)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("backup has no schema")
+	}
+	if err := CheckSchemaVersion(backup); err != nil {
+		return 0, err
+	}
+
+	target, err := sqldb.Open(dsn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer target.Close()
+	if err := onlineBackup(raw, target.DB); err != nil {
+		return 0, fmt.Errorf("failed to restore database: %w", err)
+	}
+	return version, nil
+}
+
+// Runs PRAGMA integrity_check, failing with the problems it finds
+func CheckIntegrity(db *sqldb.DB) error {
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return fmt.Errorf("failed to check integrity: %w", err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return fmt.Errorf("failed to check integrity: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check integrity: %w", err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Configures periodic snapshots of the database
+type SnapshotConfig struct {
+	// Where snapshots are written; snapshots are off when empty
+	Dir      string
+	Interval time.Duration
+	// How many of the newest snapshots to keep, or every one when 0
+	Keep     int
+	Compress bool
+}
+
+// Snapshot files are named after the time they were taken, so they sort oldest first
+const (
+	snapshotPrefix = "versed-"
+	snapshotLayout = "20060102T150405Z"
+)
+
+// Backs the database up into the snapshot directory, then deletes the oldest
+// snapshots beyond cfg.Keep. Returns the new snapshot's path.
+func Snapshot(db *sqldb.DB, cfg SnapshotConfig, now time.Time) (string, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	path := filepath.Join(cfg.Dir, snapshotPrefix+now.UTC().Format(snapshotLayout)+".db")
+	if cfg.Compress {
+		path += gzipSuffix
+	}
+	if err := Backup(db, path, cfg.Compress); err != nil {
+		return "", err
+	}
+	if err := pruneSnapshots(cfg.Dir, cfg.Keep); err != nil {
+		return path, err
+	}
+	return path, nil
+}
+
+// Lists the snapshots in dir, oldest first
+func Snapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) &&
+			(strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db"+gzipSuffix)) {
+			snapshots = append(snapshots, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// Deletes all but the newest keep snapshots
+func pruneSnapshots(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	snapshots, err := Snapshots(dir)
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return fmt.Errorf("failed to delete old snapshot: %w", err)
+		}
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
+
+// A path next to the given one for writing a file before renaming it into place
+func tempPath(path string) (string, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// Copies every page of a SQLite database into a new database file
+func copySQLite(src *sql.DB, path string) error {
+	// The temporary file is empty, which SQLite treats as a new database
+	dst, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	return onlineBackup(src, dst)
+}
+
+// Runs the online backup API from the main schema of src into that of dst
+func onlineBackup(src, dst *sql.DB) error {
+	return withSQLiteConn(dst, func(dstConn *sqlite3.SQLiteConn) error {
+		return withSQLiteConn(src, func(srcConn *sqlite3.SQLiteConn) error {
+			backup, err := dstConn.Backup("main", srcConn, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := backup.Step(-1)
+				if err != nil {
+					backup.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// Runs fn with the driver connection underneath one of the pool's connections
+func withSQLiteConn(db *sql.DB, fn func(*sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return ErrBackupUnsupported
+		}
+		return fn(sqliteConn)
+	})
+}
+
+// Writes a gzipped copy of src to dst, going through a temporary file
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := tempPath(dst)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(strings.TrimSuffix(dst, gzipSuffix))
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// Decompresses a gzipped file into dst
+func gunzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	return writeFile(dst, zr)
+}
+
+// Copies src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return writeFile(dst, in)
+}
+
+// Writes everything read from r to path
+func writeFile(path string, r io.Reader) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, r); err != nil {
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+// Opens a migrated SQLite database at path holding one user
+func openBackupSource(t *testing.T, path, username string) *sqldb.DB {
+	t.Helper()
+	db, err := sqldb.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := CreateUser(db, username+"@example.com", username, "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return db
+}
+
+// Returns the usernames in the SQLite database at path
+func usernamesIn(t *testing.T, path string) []string {
+	t.Helper()
+	db, err := sqldb.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	users, err := GetAllUsers(db)
+	if err != nil {
+		t.Fatalf("GetAllUsers: %v", err)
+	}
+	var names []string
+	for _, user := range users {
+		names = append(names, user.Username)
+	}
+	return names
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	db := openBackupSource(t, filepath.Join(dir, "data.db"), "original")
+
+	for _, name := range []string{"backup.db", "backup.db.gz"} {
+		t.Run(name, func(t *testing.T) {
+			backup := filepath.Join(dir, name)
+			if err := Backup(db, backup, filepath.Ext(name) == ".gz"); err != nil {
+				t.Fatalf("Backup: %v", err)
+			}
+
+			// Restoring replaces whatever the target holds
+			target := filepath.Join(t.TempDir(), "restored.db")
+			openBackupSource(t, target, "replaced").Close()
+			version, err := Restore(backup, target)
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			if latest, _ := LatestSchemaVersion(sqldb.SQLite); version != latest {
+				t.Errorf("restored version = %d, want %d", version, latest)
+			}
+			if names := usernamesIn(t, target); len(names) != 1 || names[0] != "original" {
+				t.Errorf("restored users = %v, want [original]", names)
+			}
+		})
+	}
+
+	if leftovers, _ := filepath.Glob(filepath.Join(dir, ".*.tmp")); len(leftovers) > 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+}
+
+func TestRestoreChecksBackup(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "data.db")
+
+	garbage := filepath.Join(dir, "garbage.db")
+	if err := os.WriteFile(garbage, []byte("not a database, just some bytes that go on for a while"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(garbage, target); err == nil {
+		t.Error("restored a file that is not a database")
+	}
+
+	newer := openBackupSource(t, filepath.Join(dir, "newer.db"), "future")
+	if _, err := newer.Exec(`INSERT INTO schema_migrations (version, name) VALUES (999, 'from_the_future')`); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, "newer-backup.db")
+	if err := Backup(newer, backup, false); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if _, err := Restore(backup, target); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("restoring a newer schema = %v, want ErrSchemaTooNew", err)
+	}
+
+	if _, err := Restore(backup, "postgres://localhost/versed"); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("restoring into postgres = %v, want ErrBackupUnsupported", err)
+	}
+	if err := Backup(&sqldb.DB{Dialect: sqldb.Postgres}, backup, false); !errors.Is(err, ErrBackupUnsupported) {
+		t.Errorf("backing up postgres = %v, want ErrBackupUnsupported", err)
+	}
+}
+
+func TestSnapshotRotation(t *testing.T) {
+	db := openBackupSource(t, filepath.Join(t.TempDir(), "data.db"), "snapper")
+	cfg := SnapshotConfig{Dir: filepath.Join(t.TempDir(), "snapshots"), Keep: 2, Compress: true}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var taken []string
+	for i := range 3 {
+		path, err := Snapshot(db, cfg, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+		taken = append(taken, path)
+	}
+
+	kept, err := Snapshots(cfg.Dir)
+	if err != nil {
+		t.Fatalf("Snapshots: %v", err)
+	}
+	if len(kept) != 2 || kept[0] != taken[1] || kept[1] != taken[2] {
+		t.Errorf("kept snapshots = %v, want the newest two of %v", kept, taken)
+	}
+	if filepath.Base(kept[1]) != "versed-20260101T020000Z.db.gz" {
+		t.Errorf("snapshot name = %s", kept[1])
+	}
+}
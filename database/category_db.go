@@ -5,25 +5,21 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/navid-m/versed/database/sqldb"
 	"github.com/navid-m/versed/feeds"
 	"github.com/navid-m/versed/models"
 )
 
 // Creates a new category for a user
-func CreateUserCategory(db *sql.DB, userID int, name, description string) (*models.UserCategory, error) {
-	query := `INSERT INTO user_categories (user_id, name, description) VALUES (?, ?, ?)`
-	result, err := db.Exec(query, userID, name, description)
-	if err != nil {
+func CreateUserCategory(db *sqldb.DB, userID int, name, description string) (*models.UserCategory, error) {
+	query := `INSERT INTO user_categories (user_id, name, description) VALUES (?, ?, ?) RETURNING id`
+	var id int
+	if err := db.QueryRow(query, userID, name, description).Scan(&id); err != nil {
 		return nil, fmt.Errorf("failed to create user category: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get category ID: %w", err)
-	}
-
 	category := &models.UserCategory{
-		ID:          int(id),
+		ID:          id,
 		UserID:      userID,
 		Name:        name,
 		Description: description,
@@ -34,7 +30,7 @@ func CreateUserCategory(db *sql.DB, userID int, name, description string) (*mode
 }
 
 // Retrieves all categories for a user
-func GetUserCategories(db *sql.DB, userID int) ([]models.UserCategory, error) {
+func GetUserCategories(db *sqldb.DB, userID int) ([]models.UserCategory, error) {
 	query := `SELECT id, user_id, name, description, created_at FROM user_categories WHERE user_id = ? ORDER BY name`
 	rows, err := db.Query(query, userID)
 	if err != nil {
@@ -56,7 +52,7 @@ func GetUserCategories(db *sql.DB, userID int) ([]models.UserCategory, error) {
 }
 
 // Retrieves a specific category for a user
-func GetUserCategoryByID(db *sql.DB, userID, categoryID int) (*models.UserCategory, error) {
+func GetUserCategoryByID(db *sqldb.DB, userID, categoryID int) (*models.UserCategory, error) {
 	query := `SELECT id, user_id, name, description, created_at FROM user_categories WHERE id = ? AND user_id = ?`
 	row := db.QueryRow(query, categoryID, userID)
 
@@ -64,7 +60,7 @@ func GetUserCategoryByID(db *sql.DB, userID, categoryID int) (*models.UserCatego
 	err := row.Scan(&category.ID, &category.UserID, &category.Name, &category.Description, &category.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("category not found")
+			return nil, fmt.Errorf("category not found: %w", err)
 		}
 		return nil, fmt.Errorf("failed to get category: %w", err)
 	}
@@ -72,8 +68,21 @@ func GetUserCategoryByID(db *sql.DB, userID, categoryID int) (*models.UserCatego
 	return &category, nil
 }
 
+// Retrieves one of a user's categories by name, ignoring case
+func GetUserCategoryByName(db *sqldb.DB, userID int, name string) (*models.UserCategory, error) {
+	query := `SELECT id, user_id, name, description, created_at FROM user_categories WHERE user_id = ? AND LOWER(name) = LOWER(?)`
+
+	var category models.UserCategory
+	err := db.QueryRow(query, userID, name).Scan(&category.ID, &category.UserID, &category.Name, &category.Description, &category.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
 // Updates a category's name and description
-func UpdateUserCategory(db *sql.DB, userID, categoryID int, name, description string) error {
+func UpdateUserCategory(db *sqldb.DB, userID, categoryID int, name, description string) error {
 	query := `UPDATE user_categories SET name = ?, description = ? WHERE id = ? AND user_id = ?`
 	result, err := db.Exec(query, name, description, categoryID, userID)
 	if err != nil {
@@ -93,7 +102,7 @@ func UpdateUserCategory(db *sql.DB, userID, categoryID int, name, description st
 }
 
 // Deletes a category and all its feed associations
-func DeleteUserCategory(db *sql.DB, userID, categoryID int) error {
+func DeleteUserCategory(db *sqldb.DB, userID, categoryID int) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -121,7 +130,7 @@ func DeleteUserCategory(db *sql.DB, userID, categoryID int) error {
 }
 
 // Adds a feed source to a user's category
-func AddFeedToUserCategory(db *sql.DB, userID, categoryID, feedSourceID int) error {
+func AddFeedToUserCategory(db *sqldb.DB, userID, categoryID, feedSourceID int) error {
 	_, err := GetUserCategoryByID(db, userID, categoryID)
 	if err != nil {
 		return fmt.Errorf("invalid category: %w", err)
@@ -136,7 +145,7 @@ func AddFeedToUserCategory(db *sql.DB, userID, categoryID, feedSourceID int) err
 		return fmt.Errorf("feed source not found")
 	}
 
-	query := `INSERT OR IGNORE INTO user_category_feeds (user_id, category_id, feed_source_id) VALUES (?, ?, ?)`
+	query := `INSERT INTO user_category_feeds (user_id, category_id, feed_source_id) VALUES (?, ?, ?) ON CONFLICT DO NOTHING`
 	_, err = db.Exec(query, userID, categoryID, feedSourceID)
 	if err != nil {
 		return fmt.Errorf("failed to add feed to category: %w", err)
@@ -146,7 +155,7 @@ func AddFeedToUserCategory(db *sql.DB, userID, categoryID, feedSourceID int) err
 }
 
 // Removes a feed source from a user's category
-func RemoveFeedFromUserCategory(db *sql.DB, userID, categoryID, feedSourceID int) error {
+func RemoveFeedFromUserCategory(db *sqldb.DB, userID, categoryID, feedSourceID int) error {
 	query := `DELETE FROM user_category_feeds WHERE user_id = ? AND category_id = ? AND feed_source_id = ?`
 	result, err := db.Exec(query, userID, categoryID, feedSourceID)
 	if err != nil {
@@ -166,8 +175,8 @@ func RemoveFeedFromUserCategory(db *sql.DB, userID, categoryID, feedSourceID int
 }
 
 // Gets all feed sources in a user's category
-func GetFeedsInUserCategory(db *sql.DB, userID, categoryID int) ([]feeds.FeedSource, error) {
-	query := `SELECT fs.id, fs.name, fs.url, fs.last_updated, fs.update_interval
+func GetFeedsInUserCategory(db *sqldb.DB, userID, categoryID int) ([]feeds.FeedSource, error) {
+	query := `SELECT fs.id, fs.name, fs.url, fs.last_updated, fs.update_interval, fs.disabled
 	          FROM feed_sources fs
 	          JOIN user_category_feeds ucf ON fs.id = ucf.feed_source_id
 	          WHERE ucf.user_id = ? AND ucf.category_id = ?
@@ -181,7 +190,7 @@ func GetFeedsInUserCategory(db *sql.DB, userID, categoryID int) ([]feeds.FeedSou
 	var sources []feeds.FeedSource
 	for rows.Next() {
 		var source feeds.FeedSource
-		err := rows.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval)
+		err := rows.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval, &source.Disabled)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan feed source: %w", err)
 		}
@@ -192,7 +201,7 @@ func GetFeedsInUserCategory(db *sql.DB, userID, categoryID int) ([]feeds.FeedSou
 }
 
 // Gets all categories for a user that contain a specific feed
-func GetUserCategoriesForFeed(db *sql.DB, userID, feedSourceID int) ([]models.UserCategory, error) {
+func GetUserCategoriesForFeed(db *sqldb.DB, userID, feedSourceID int) ([]models.UserCategory, error) {
 	query := `SELECT uc.id, uc.user_id, uc.name, uc.description, uc.created_at
 	          FROM user_categories uc
 	          JOIN user_category_feeds ucf ON uc.id = ucf.category_id
@@ -216,6 +225,3 @@ func GetUserCategoriesForFeed(db *sql.DB, userID, feedSourceID int) ([]models.Us
 
 	return categories, nil
 }
-
-// Variation of category query that only returns the ID
-var CategoryQueryVariation = "SELECT id FROM user_categories WHERE user_id = ? AND LOWER(name) = LOWER(?)"
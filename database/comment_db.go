@@ -1,90 +1,55 @@
 package database
 
 import (
-	"log"
-	"time"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/models"
 )
 
-// Represents a comment on a feed item
-type Comment struct {
-	ID        int       `json:"id"`
-	ItemID    string    `json:"item_id"`
-	UserID    int       `json:"user_id"`
-	Username  string    `json:"username"`
-	Content   string    `json:"content"`
-	ParentID  *int      `json:"parent_id"`
-	Replies   []Comment `json:"replies,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-}
-
 // Adds a new comment to the database
 //
 // Connected to POST request
-func CreateComment(itemID string, userID int, username, content string, parentID *int) (*Comment, error) {
-	log.Printf("=== CreateComment called with parentID: %v ===", parentID)
-	if parentID != nil {
-		log.Printf("=== CreateComment parentID value: %d ===", *parentID)
-	} else {
-		log.Printf("=== CreateComment parentID is nil ===")
-	}
-
+func CreateComment(db *sqldb.DB, itemID string, userID int, username, content string, parentID *int) (*models.Comment, error) {
 	query := `
 		INSERT INTO comments (item_id, user_id, username, content, parent_id)
-		VALUES (?, ?, ?, ?, ?)`
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id`
 
-	log.Printf("=== CreateComment executing query with params: itemID=%s, userID=%d, username=%s, content=%s, parentID=%v ===",
-		itemID, userID, username, content, parentID)
-
-	result, err := GetDB().Exec(query, itemID, userID, username, content, parentID)
+	var id int
+	err := db.QueryRow(query, itemID, userID, username, content, parentID).Scan(&id)
 	if err != nil {
-		log.Printf("=== CreateComment ERROR executing query: %v ===", err)
 		return nil, err
 	}
-	log.Printf("=== CreateComment query executed successfully ===")
+	logger.Debug("Created comment", "comment_id", id, "item_id", itemID, "user_id", userID, "parent_id", parentID)
 
-	id, err := result.LastInsertId()
+	_, err = db.Exec("UPDATE feed_items SET comments_count = comments_count + 1 WHERE id = ?", itemID)
 	if err != nil {
-		log.Printf("=== CreateComment ERROR getting last insert ID: %v ===", err)
 		return nil, err
 	}
-	log.Printf("=== CreateComment inserted comment with ID: %d ===", id)
 
-	_, err = GetDB().Exec("UPDATE feed_items SET comments_count = comments_count + 1 WHERE id = ?", itemID)
+	comment, err := GetCommentByID(db, id)
 	if err != nil {
-		log.Printf("=== CreateComment ERROR updating comments_count: %v ===", err)
 		return nil, err
 	}
-
-	comment, err := GetCommentByID(int(id))
-	if err != nil {
-		log.Printf("=== CreateComment ERROR getting created comment: %v ===", err)
-		return nil, err
-	}
-	log.Printf("=== CreateComment returning comment with ParentID: %v ===", comment.ParentID)
-
 	return comment, nil
 }
 
 // Retrieves all comments for a specific feed item
-func GetCommentsByItemID(itemID string) ([]Comment, error) {
-	log.Printf("=== GetCommentsByItemID called with itemID: %s ===", itemID)
+func GetCommentsByItemID(db *sqldb.DB, itemID string) ([]models.Comment, error) {
 	query := `
 		SELECT id, item_id, user_id, username, content, parent_id, created_at, updated_at
 		FROM comments
 		WHERE item_id = ?
 		ORDER BY created_at ASC`
 
-	rows, err := GetDB().Query(query, itemID)
+	rows, err := db.Query(query, itemID)
 	if err != nil {
-		log.Printf("=== GetCommentsByItemID ERROR querying database: %v ===", err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var allComments []Comment
+	var allComments []models.Comment
 	for rows.Next() {
-		var comment Comment
+		var comment models.Comment
 		err := rows.Scan(
 			&comment.ID,
 			&comment.ItemID,
@@ -96,40 +61,26 @@ func GetCommentsByItemID(itemID string) ([]Comment, error) {
 			&comment.UpdatedAt,
 		)
 		if err != nil {
-			log.Printf("=== GetCommentsByItemID ERROR scanning row: %v ===", err)
 			return nil, err
 		}
 		allComments = append(allComments, comment)
 	}
 
 	// Build hierarchical structure
-	log.Printf("=== BUILDING HIERARCHY: Processing %d comments ===", len(allComments))
-	for i, comment := range allComments {
-		log.Printf("=== HIERARCHY INPUT: Comment %d: ID=%d, Content='%s', ParentID=%v ===", i+1, comment.ID, comment.Content, comment.ParentID)
-	}
 	topLevelComments := buildCommentHierarchy(allComments)
-
-	log.Printf("=== HIERARCHY RESULT: %d top-level comments ===", len(topLevelComments))
-	for i, comment := range topLevelComments {
-		log.Printf("=== HIERARCHY OUTPUT: Top-level %d: ID=%d, Content='%s', Replies=%d ===", i+1, comment.ID, comment.Content, len(comment.Replies))
-		for j, reply := range comment.Replies {
-			log.Printf("=== HIERARCHY OUTPUT:   Reply %d.%d: ID=%d, Content='%s' ===", i+1, j+1, reply.ID, reply.Content)
-		}
-	}
-
-	log.Printf("=== GetCommentsByItemID returning %d top-level comments ===", len(topLevelComments))
+	logger.Debug("Loaded comments", "item_id", itemID, "comments", len(allComments), "top_level", len(topLevelComments))
 	return topLevelComments, nil
 }
 
 // Retrieves a single comment by its ID
-func GetCommentByID(commentID int) (*Comment, error) {
+func GetCommentByID(db *sqldb.DB, commentID int) (*models.Comment, error) {
 	query := `
 		SELECT id, item_id, user_id, username, content, parent_id, created_at, updated_at
 		FROM comments
 		WHERE id = ?`
 
-	var comment Comment
-	err := GetDB().QueryRow(query, commentID).Scan(
+	var comment models.Comment
+	err := db.QueryRow(query, commentID).Scan(
 		&comment.ID,
 		&comment.ItemID,
 		&comment.UserID,
@@ -148,54 +99,54 @@ func GetCommentByID(commentID int) (*Comment, error) {
 }
 
 // Updates the content of a comment
-func UpdateComment(commentID int, content string) error {
+func UpdateComment(db *sqldb.DB, commentID int, content string) error {
 	query := `
 		UPDATE comments
 		SET content = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?`
 
-	_, err := GetDB().Exec(query, content, commentID)
+	_, err := db.Exec(query, content, commentID)
 	return err
 }
 
 // Removes a comment from the database
-func DeleteComment(commentID int) error {
+func DeleteComment(db *sqldb.DB, commentID int) error {
 	var itemID string
-	err := GetDB().QueryRow("SELECT item_id FROM comments WHERE id = ?", commentID).Scan(&itemID)
+	err := db.QueryRow("SELECT item_id FROM comments WHERE id = ?", commentID).Scan(&itemID)
 	if err != nil {
 		return err
 	}
 
 	query := `DELETE FROM comments WHERE id = ?`
-	_, err = GetDB().Exec(query, commentID)
+	_, err = db.Exec(query, commentID)
 	if err != nil {
 		return err
 	}
 
-	_, err = GetDB().Exec("UPDATE feed_items SET comments_count = comments_count - 1 WHERE id = ?", itemID)
+	_, err = db.Exec("UPDATE feed_items SET comments_count = comments_count - 1 WHERE id = ?", itemID)
 	return err
 }
 
 // Returns the number of comments for a feed item
-func GetCommentCountByItemID(itemID string) (int, error) {
+func GetCommentCountByItemID(db *sqldb.DB, itemID string) (int, error) {
 	query := `SELECT COUNT(*) FROM comments WHERE item_id = ?`
 	var count int
-	err := GetDB().QueryRow(query, itemID).Scan(&count)
+	err := db.QueryRow(query, itemID).Scan(&count)
 	return count, err
 }
 
 // Builds hierarchical comment structure from flat comments array
-func buildCommentHierarchy(comments []Comment) []Comment {
+func buildCommentHierarchy(comments []models.Comment) []models.Comment {
 	var (
-		commentMap       = make(map[int]*Comment)
-		replyMap         = make(map[int][]*Comment)
-		topLevelComments []Comment
+		commentMap       = make(map[int]*models.Comment)
+		replyMap         = make(map[int][]*models.Comment)
+		topLevelComments []models.Comment
 	)
 
 	for i := range comments {
 		comment := &comments[i]
 		commentMap[comment.ID] = comment
-		replyMap[comment.ID] = []*Comment{}
+		replyMap[comment.ID] = []*models.Comment{}
 	}
 
 	for i := range comments {
@@ -209,10 +160,10 @@ func buildCommentHierarchy(comments []Comment) []Comment {
 		}
 	}
 
-	var buildReplies func(comment *Comment)
-	buildReplies = func(comment *Comment) {
+	var buildReplies func(comment *models.Comment)
+	buildReplies = func(comment *models.Comment) {
 		replies := replyMap[comment.ID]
-		comment.Replies = make([]Comment, len(replies))
+		comment.Replies = make([]models.Comment, len(replies))
 
 		for i, reply := range replies {
 			comment.Replies[i] = *reply
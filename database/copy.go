@@ -0,0 +1,306 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+// Rows inserted per statement when copying data between databases
+const copyBatchSize = 500
+
+// Copies every row from src into dst, which must be empty.
+//
+// dst is migrated to the latest schema first, and src must already be at
+// that version so both sides have the same tables. Everything is written in
+// a single transaction, so a failed copy leaves dst empty. Returns the number
+// of rows copied per table.
+func CopyData(src, dst *sqldb.DB) (map[string]int, error) {
+	if err := CheckSchemaVersion(src); err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+	srcVersion, err := SchemaVersion(src)
+	if err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+	latest, err := LatestSchemaVersion(src.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	if srcVersion != latest {
+		return nil, fmt.Errorf("source database is at version %d, run migrations on it first (latest is %d)", srcVersion, latest)
+	}
+
+	if err := CheckSchemaVersion(dst); err != nil {
+		return nil, fmt.Errorf("destination: %w", err)
+	}
+	if _, err := Migrate(dst); err != nil {
+		return nil, fmt.Errorf("failed to migrate destination: %w", err)
+	}
+
+	tables, err := listTables(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source tables: %w", err)
+	}
+	for _, table := range tables {
+		var count int
+		if err := dst.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&count); err != nil {
+			return nil, fmt.Errorf("destination is missing table %s: %w", table, err)
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("destination table %s is not empty", table)
+		}
+	}
+
+	tx, err := dst.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	copied := make(map[string]int, len(tables))
+	for _, table := range tables {
+		n, err := copyTable(src, dst, tx, table)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", table, err)
+		}
+		copied[table] = n
+		logger.Info("Copied rows", "table", table, "rows", n)
+	}
+
+	if dst.Dialect == sqldb.Postgres {
+		for _, table := range tables {
+			if err := resetSequence(tx, table); err != nil {
+				return nil, fmt.Errorf("failed to reset sequence for %s: %w", table, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// Lists the application tables in a database, leaving out migration bookkeeping
+func listTables(db *sqldb.DB) ([]string, error) {
+	query := `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`
+	if db.Dialect == sqldb.Postgres {
+		query = `SELECT table_name FROM information_schema.tables
+		         WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'`
+	}
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if name != "schema_migrations" && !isSearchIndexTable(name) {
+			tables = append(tables, name)
+		}
+	}
+	sort.Strings(tables)
+	return tables, rows.Err()
+}
+
+// Returns the lower-cased declared type of every column in a table
+func columnTypes(db *sqldb.DB, table string) (map[string]string, error) {
+	query := `SELECT name, type FROM pragma_table_info(?)`
+	if db.Dialect == sqldb.Postgres {
+		query = `SELECT column_name, data_type FROM information_schema.columns
+		         WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	rows, err := db.Query(query, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		types[name] = strings.ToLower(typ)
+	}
+	return types, rows.Err()
+}
+
+// Copies one table in batches, converting values to what the destination column expects
+func copyTable(src, dst *sqldb.DB, tx *sqldb.Tx, table string) (int, error) {
+	srcTypes, err := columnTypes(src, table)
+	if err != nil {
+		return 0, err
+	}
+	dstTypes, err := columnTypes(dst, table)
+	if err != nil {
+		return 0, err
+	}
+
+	var columns []string
+	for column := range srcTypes {
+		if _, ok := dstTypes[column]; ok {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		return 0, nil
+	}
+	sort.Strings(columns)
+
+	rows, err := src.Query(`SELECT ` + strings.Join(columns, ", ") + ` FROM ` + table)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var (
+		copied int
+		batch  = squirrel.Insert(table).Columns(columns...)
+		queued int
+	)
+	flush := func() error {
+		if queued == 0 {
+			return nil
+		}
+		query, args, err := batch.ToSql()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+		copied += queued
+		batch = squirrel.Insert(table).Columns(columns...)
+		queued = 0
+		return nil
+	}
+
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return copied, err
+		}
+		row := make([]any, len(columns))
+		for i, column := range columns {
+			row[i], err = convertValue(values[i], dstTypes[column])
+			if err != nil {
+				return copied, fmt.Errorf("row %d, column %s: %w", copied+queued+1, column, err)
+			}
+		}
+		batch = batch.Values(row...)
+		queued++
+		if queued == copyBatchSize {
+			if err := flush(); err != nil {
+				return copied, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return copied, err
+	}
+	return copied, flush()
+}
+
+// Converts a value read from one database into one the destination column accepts.
+//
+// SQLite is loosely typed: booleans come back as integers, timestamps as
+// either time.Time or text, and text sometimes as bytes.
+func convertValue(value any, columnType string) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if b, ok := value.([]byte); ok && !strings.Contains(columnType, "blob") && columnType != "bytea" {
+		value = string(b)
+	}
+
+	switch {
+	case columnType == "boolean":
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			return v != 0, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(v)) {
+			case "1", "t", "true":
+				return true, nil
+			case "0", "f", "false", "":
+				return false, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot convert %v to boolean", value)
+
+	case strings.HasPrefix(columnType, "timestamp"), columnType == "datetime", columnType == "date":
+		switch v := value.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return nil, nil
+			}
+			for _, layout := range sqliteTimeLayouts {
+				if t, err := time.Parse(layout, v); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("cannot parse timestamp %q", v)
+		case int64:
+			return time.Unix(v, 0).UTC(), nil
+		}
+		return nil, fmt.Errorf("cannot convert %v to timestamp", value)
+	}
+
+	return value, nil
+}
+
+// Layouts SQLite timestamps may have been written in, tried in order
+var sqliteTimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+}
+
+// Moves a PostgreSQL serial sequence past the highest copied ID
+func resetSequence(tx *sqldb.Tx, table string) error {
+	var hasID int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM information_schema.columns
+	                    WHERE table_schema = current_schema() AND table_name = ? AND column_name = 'id'`, table).Scan(&hasID)
+	if err != nil || hasID == 0 {
+		return err
+	}
+
+	var sequence sql.NullString
+	if err := tx.QueryRow(`SELECT pg_get_serial_sequence(?, 'id')`, table).Scan(&sequence); err != nil {
+		return err
+	}
+	if !sequence.Valid {
+		return nil
+	}
+	_, err = tx.Exec(`SELECT setval(?, COALESCE((SELECT MAX(id) FROM `+table+`), 0) + 1, false)`, sequence.String)
+	return err
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+// Fills a freshly migrated SQLite database with a little of everything
+func seedCopySource(t *testing.T) *sqldb.DB {
+	t.Helper()
+	src := openTestDB(t)
+	if _, err := Migrate(src); err != nil {
+		t.Fatalf("Migrate source: %v", err)
+	}
+
+	seed := []string{
+		`INSERT INTO users (id, email, username, password, is_admin) VALUES (1, 'a@example.com', 'alice', 'x', 1)`,
+		`INSERT INTO users (id, email, username, password, is_admin) VALUES (7, 'b@example.com', 'bob', 'y', 0)`,
+		`INSERT INTO feed_sources (id, name, url, last_updated) VALUES (3, 'Example', 'https://example.com/rss', '2024-05-01 10:30:00')`,
+		`INSERT INTO feed_items (id, source_id, title, url, published_at) VALUES ('item-1', 3, 'Hello', 'https://example.com/1', '2024-05-01T09:00:00Z')`,
+		`INSERT INTO webhooks (user_id, name, url, secret, match_type, match_value, enabled) VALUES (1, 'hook', 'https://example.com/hook', 's', 'keyword', 'go', 0)`,
+	}
+	for _, query := range seed {
+		if _, err := src.Exec(query); err != nil {
+			t.Fatalf("failed to seed source: %v", err)
+		}
+	}
+	return src
+}
+
+func TestCopyData(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, dst *sqldb.DB) {
+		src := seedCopySource(t)
+
+		copied, err := CopyData(src, dst)
+		if err != nil {
+			t.Fatalf("CopyData: %v", err)
+		}
+		if copied["users"] != 2 || copied["feed_items"] != 1 || copied["webhooks"] != 1 {
+			t.Errorf("copied = %v", copied)
+		}
+
+		var isAdmin bool
+		if err := dst.QueryRow(`SELECT is_admin FROM users WHERE id = ?`, 1).Scan(&isAdmin); err != nil || !isAdmin {
+			t.Errorf("is_admin = %v, %v", isAdmin, err)
+		}
+		var enabled bool
+		if err := dst.QueryRow(`SELECT enabled FROM webhooks`).Scan(&enabled); err != nil || enabled {
+			t.Errorf("enabled = %v, %v", enabled, err)
+		}
+		var lastUpdated time.Time
+		if err := dst.QueryRow(`SELECT last_updated FROM feed_sources WHERE id = ?`, 3).Scan(&lastUpdated); err != nil {
+			t.Fatalf("failed to read last_updated: %v", err)
+		}
+		if want := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC); !lastUpdated.Equal(want) {
+			t.Errorf("last_updated = %v, want %v", lastUpdated, want)
+		}
+
+		// New rows must not collide with copied IDs
+		var id int
+		if err := dst.QueryRow(`INSERT INTO users (email, password) VALUES ('c@example.com', 'z') RETURNING id`).Scan(&id); err != nil {
+			t.Fatalf("failed to insert after copy: %v", err)
+		}
+		if id <= 7 {
+			t.Errorf("new user got id %d, want one past the copied ids", id)
+		}
+
+		if _, err := CopyData(src, dst); err == nil {
+			t.Error("CopyData into a non-empty database succeeded")
+		}
+	})
+}
+
+func TestCopyDataRequiresMigratedSource(t *testing.T) {
+	src := openTestDB(t)
+	if _, err := MigrateTo(src, 1); err != nil {
+		t.Fatalf("MigrateTo(1): %v", err)
+	}
+	if _, err := CopyData(src, openTestDB(t)); err == nil {
+		t.Error("CopyData from an outdated source succeeded")
+	}
+}
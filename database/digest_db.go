@@ -0,0 +1,184 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+// Top items for one of a user's categories, as shown in a digest
+type DigestCategory struct {
+	Name  string
+	Items []feeds.FeedItem
+}
+
+// Generates a random token for unsubscribe links
+func generateDigestToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Retrieves a user's digest subscription, creating a disabled one if none exists
+func GetDigestSubscription(db *sqldb.DB, userID int) (*models.DigestSubscription, error) {
+	token, err := generateDigestToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+
+	_, err = db.Exec(`INSERT INTO digest_subscriptions (user_id, frequency, unsubscribe_token) VALUES (?, ?, ?)
+	                  ON CONFLICT(user_id) DO NOTHING`, userID, models.DigestOff, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create digest subscription: %w", err)
+	}
+
+	query := `SELECT ds.user_id, u.email, COALESCE(u.username, ''), ds.frequency, ds.last_sent_at, ds.unsubscribe_token, ds.created_at
+	          FROM digest_subscriptions ds
+	          JOIN users u ON u.id = ds.user_id
+	          WHERE ds.user_id = ?`
+	return scanDigestSubscription(db.QueryRow(query, userID))
+}
+
+// Scans a subscription row joined with the user's email and username
+func scanDigestSubscription(row interface{ Scan(...any) error }) (*models.DigestSubscription, error) {
+	var sub models.DigestSubscription
+	var lastSentAt sql.NullTime
+	err := row.Scan(&sub.UserID, &sub.Email, &sub.Username, &sub.Frequency, &lastSentAt, &sub.UnsubscribeToken, &sub.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastSentAt.Valid {
+		sub.LastSentAt = &lastSentAt.Time
+	}
+	return &sub, nil
+}
+
+// Sets how often a user receives digests
+func SetDigestFrequency(db *sqldb.DB, userID int, frequency string) error {
+	switch frequency {
+	case models.DigestOff, models.DigestDaily, models.DigestWeekly:
+	default:
+		return fmt.Errorf("invalid digest frequency")
+	}
+
+	if _, err := GetDigestSubscription(db, userID); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`UPDATE digest_subscriptions SET frequency = ? WHERE user_id = ?`, frequency, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update digest frequency: %w", err)
+	}
+	return nil
+}
+
+// Turns off digests for the subscription owning the given unsubscribe token
+//
+// Returns false if the token does not match any subscription.
+func UnsubscribeDigest(db *sqldb.DB, token string) (bool, error) {
+	result, err := db.Exec(`UPDATE digest_subscriptions SET frequency = ? WHERE unsubscribe_token = ?`, models.DigestOff, token)
+	if err != nil {
+		return false, fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// Retrieves subscriptions whose daily or weekly digest is due at the given
+// time. Unverified addresses are left out: digests need a mail server, and
+// with one every address must be verified before anything is sent to it.
+func GetDueDigestSubscriptions(db *sqldb.DB, now time.Time) ([]models.DigestSubscription, error) {
+	lastSent := db.Dialect.Datetime("ds.last_sent_at")
+	query := `SELECT ds.user_id, u.email, COALESCE(u.username, ''), ds.frequency, ds.last_sent_at, ds.unsubscribe_token, ds.created_at
+	          FROM digest_subscriptions ds
+	          JOIN users u ON u.id = ds.user_id
+	          WHERE u.email_verified_at IS NOT NULL
+	            AND ((ds.frequency = ? AND (ds.last_sent_at IS NULL OR ` + lastSent + ` <= ?))
+	              OR (ds.frequency = ? AND (ds.last_sent_at IS NULL OR ` + lastSent + ` <= ?)))`
+
+	const layout = "2006-01-02 15:04:05"
+	dailyCutoff := now.UTC().Add(-24 * time.Hour).Format(layout)
+	weeklyCutoff := now.UTC().Add(-7 * 24 * time.Hour).Format(layout)
+
+	rows, err := db.Query(query, models.DigestDaily, dailyCutoff, models.DigestWeekly, weeklyCutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due digests: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []models.DigestSubscription
+	for rows.Next() {
+		sub, err := scanDigestSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan digest subscription: %w", err)
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, nil
+}
+
+// Records when a user's last digest went out
+func MarkDigestSent(db *sqldb.DB, userID int, sentAt time.Time) error {
+	_, err := db.Exec(`UPDATE digest_subscriptions SET last_sent_at = ? WHERE user_id = ?`, sentAt.UTC(), userID)
+	return err
+}
+
+// Gets the highest ranked items ingested since the given time for each of a user's categories.
+//
+// Items are ranked by score plus comment count; categories with no new items are omitted.
+func GetDigestCategories(db *sqldb.DB, userID int, since time.Time, perCategory int) ([]DigestCategory, error) {
+	categories, err := GetUserCategories(db, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author, fi.published_at,
+	                 COALESCE(fi.score, 0), COALESCE(fi.comments_count, 0), fi.created_at, fs.name
+	          FROM feed_items fi
+	          JOIN feed_sources fs ON fi.source_id = fs.id
+	          JOIN user_category_feeds ucf ON fs.id = ucf.feed_source_id
+	          LEFT JOIN hidden_posts hp ON fi.id = hp.item_id AND hp.user_id = ucf.user_id
+	          WHERE ucf.user_id = ? AND ucf.category_id = ? AND hp.item_id IS NULL
+	            AND ` + db.Dialect.Datetime("fi.created_at") + ` >= ?
+	          ORDER BY (COALESCE(fi.score, 0) + COALESCE(fi.comments_count, 0)) DESC, fi.published_at DESC
+	          LIMIT ?`
+	sinceStr := since.UTC().Format("2006-01-02 15:04:05")
+
+	var result []DigestCategory
+	for _, category := range categories {
+		rows, err := db.Query(query, userID, category.ID, sinceStr, perCategory)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get digest items: %w", err)
+		}
+
+		var items []feeds.FeedItem
+		for rows.Next() {
+			var item feeds.FeedItem
+			err := rows.Scan(&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
+				&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &item.SourceName)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan digest item: %w", err)
+			}
+			items = append(items, item)
+		}
+		rows.Close()
+
+		if len(items) > 0 {
+			result = append(result, DigestCategory{Name: category.Name, Items: items})
+		}
+	}
+
+	return result, nil
+}
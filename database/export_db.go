@@ -0,0 +1,299 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+)
+
+const dataExportColumns = `id, user_id, status, file_size, COALESCE(error, ''), created_at, completed_at, expires_at`
+
+// Scans a data export row
+func scanDataExport(row interface{ Scan(...any) error }) (*models.DataExport, error) {
+	var export models.DataExport
+	var completedAt, expiresAt sql.NullTime
+	err := row.Scan(&export.ID, &export.UserID, &export.Status, &export.FileSize, &export.Error,
+		&export.CreatedAt, &completedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if completedAt.Valid {
+		export.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		export.ExpiresAt = &expiresAt.Time
+	}
+	return &export, nil
+}
+
+// Queues a data export for a user
+func CreateDataExport(db *sqldb.DB, userID int) (*models.DataExport, error) {
+	var id int
+	err := db.QueryRow(`INSERT INTO data_exports (user_id, status) VALUES (?, ?) RETURNING id`,
+		userID, models.ExportPending).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data export: %w", err)
+	}
+	return GetDataExport(db, id)
+}
+
+// Retrieves a data export
+func GetDataExport(db *sqldb.DB, id int) (*models.DataExport, error) {
+	return scanDataExport(db.QueryRow(`SELECT `+dataExportColumns+` FROM data_exports WHERE id = ?`, id))
+}
+
+// Retrieves a user's data exports, newest first
+func GetDataExports(db *sqldb.DB, userID int) ([]models.DataExport, error) {
+	return queryDataExports(db, `SELECT `+dataExportColumns+` FROM data_exports WHERE user_id = ? ORDER BY id DESC`, userID)
+}
+
+// Retrieves the exports still waiting to be built, oldest first.
+//
+// Exports left running by a previous process are included so they get rebuilt.
+func GetPendingDataExports(db *sqldb.DB) ([]models.DataExport, error) {
+	return queryDataExports(db, `SELECT `+dataExportColumns+` FROM data_exports WHERE status IN (?, ?) ORDER BY id`,
+		models.ExportPending, models.ExportRunning)
+}
+
+func queryDataExports(db *sqldb.DB, query string, args ...any) ([]models.DataExport, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data exports: %w", err)
+	}
+	defer rows.Close()
+
+	var exports []models.DataExport
+	for rows.Next() {
+		export, err := scanDataExport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan data export: %w", err)
+		}
+		exports = append(exports, *export)
+	}
+	return exports, rows.Err()
+}
+
+// Records that an export is being built
+func MarkDataExportRunning(db *sqldb.DB, id int) error {
+	_, err := db.Exec(`UPDATE data_exports SET status = ? WHERE id = ?`, models.ExportRunning, id)
+	return err
+}
+
+// Records that an export's archive is ready to download until expiresAt
+func MarkDataExportReady(db *sqldb.DB, id int, fileSize int64, completedAt, expiresAt time.Time) error {
+	_, err := db.Exec(`UPDATE data_exports SET status = ?, file_size = ?, error = NULL, completed_at = ?, expires_at = ? WHERE id = ?`,
+		models.ExportReady, fileSize, completedAt.UTC(), expiresAt.UTC(), id)
+	return err
+}
+
+// Records why an export could not be built
+func MarkDataExportFailed(db *sqldb.DB, id int, reason string, completedAt time.Time) error {
+	_, err := db.Exec(`UPDATE data_exports SET status = ?, error = ?, completed_at = ? WHERE id = ?`,
+		models.ExportFailed, reason, completedAt.UTC(), id)
+	return err
+}
+
+// Marks ready exports whose download window has passed as expired, returning their IDs
+func ExpireDataExports(db *sqldb.DB, now time.Time) ([]int, error) {
+	rows, err := db.Query(`SELECT id FROM data_exports WHERE status = ? AND `+db.Dialect.Datetime("expires_at")+` <= ?`,
+		models.ExportReady, now.UTC().Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get expired data exports: %w", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan data export: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, err := db.Exec(`UPDATE data_exports SET status = ? WHERE id = ?`, models.ExportExpired, id); err != nil {
+			return nil, fmt.Errorf("failed to expire data export: %w", err)
+		}
+	}
+	return ids, nil
+}
+
+// Retrieves a user by ID
+func GetUserByID(db *sqldb.DB, userID int) (*models.User, error) {
+	var user models.User
+	var username, ipAddress, pendingEmail sql.NullString
+	var isAdmin sql.NullBool
+
+	err := db.QueryRow("SELECT id, email, username, password, is_admin, ip_address, email_verified_at IS NOT NULL, pending_email FROM users WHERE id = ?", userID).
+		Scan(&user.ID, &user.Email, &username, &user.Password, &isAdmin, &ipAddress, &user.EmailVerified, &pendingEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Username = username.String
+	user.IsAdmin = isAdmin.Bool
+	user.IPAddress = ipAddress.String
+	user.PendingEmail = pendingEmail.String
+	return &user, nil
+}
+
+// Gathers everything a user has put into Versed
+func GetUserData(db *sqldb.DB, userID int) (*repository.UserData, error) {
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	data := &repository.UserData{User: *user}
+
+	categories, err := GetUserCategories(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, category := range categories {
+		sources, err := GetFeedsInUserCategory(db, userID, category.ID)
+		if err != nil {
+			return nil, err
+		}
+		data.Categories = append(data.Categories, repository.CategoryFeeds{UserCategory: category, Feeds: sources})
+	}
+
+	if data.ReadingList, err = GetReadingList(db, userID); err != nil {
+		return nil, err
+	}
+	if data.Hidden, err = getUserHiddenItems(db, userID); err != nil {
+		return nil, err
+	}
+	if data.ItemVotes, err = getUserItemVotes(db, userID); err != nil {
+		return nil, err
+	}
+	if data.PostVotes, err = getUserPostVotes(db, userID); err != nil {
+		return nil, err
+	}
+	if data.Comments, err = getUserComments(db, userID); err != nil {
+		return nil, err
+	}
+	if data.PostComments, err = getUserPostComments(db, userID); err != nil {
+		return nil, err
+	}
+	if data.Posts, err = getUserPosts(db, userID); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Runs a query for one user's rows, scanning each with scan
+func queryUserRows[T any](db *sqldb.DB, what, query string, userID int, scan func(*sql.Rows) (T, error)) ([]T, error) {
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	var results []T
+	for rows.Next() {
+		result, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan %s: %w", what, err)
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+func getUserHiddenItems(db *sqldb.DB, userID int) ([]models.HiddenItem, error) {
+	return queryUserRows(db, "hidden items", `SELECT h.item_id, COALESCE(fi.title, ''), h.hidden_at
+	                                            FROM hidden_posts h
+	                                            LEFT JOIN feed_items fi ON fi.id = h.item_id
+	                                            WHERE h.user_id = ?
+	                                            ORDER BY h.hidden_at`, userID,
+		func(rows *sql.Rows) (models.HiddenItem, error) {
+			var item models.HiddenItem
+			err := rows.Scan(&item.ItemID, &item.Title, &item.HiddenAt)
+			return item, err
+		})
+}
+
+func getUserItemVotes(db *sqldb.DB, userID int) ([]models.ItemVote, error) {
+	return queryUserRows(db, "item votes", `SELECT v.item_id, COALESCE(fi.title, ''), v.vote_type, v.created_at
+	                                          FROM upvotes v
+	                                          LEFT JOIN feed_items fi ON fi.id = v.item_id
+	                                          WHERE v.user_id = ?
+	                                          ORDER BY v.created_at`, userID,
+		func(rows *sql.Rows) (models.ItemVote, error) {
+			var vote models.ItemVote
+			err := rows.Scan(&vote.ItemID, &vote.Title, &vote.VoteType, &vote.CreatedAt)
+			return vote, err
+		})
+}
+
+func getUserPostVotes(db *sqldb.DB, userID int) ([]models.Vote, error) {
+	return queryUserRows(db, "post votes", `SELECT user_id, post_id, vote_type, created_at, updated_at
+	                                          FROM post_votes
+	                                          WHERE user_id = ?
+	                                          ORDER BY created_at`, userID,
+		func(rows *sql.Rows) (models.Vote, error) {
+			var vote models.Vote
+			err := rows.Scan(&vote.UserID, &vote.PostID, &vote.VoteType, &vote.CreatedAt, &vote.UpdatedAt)
+			return vote, err
+		})
+}
+
+func getUserComments(db *sqldb.DB, userID int) ([]models.Comment, error) {
+	return queryUserRows(db, "comments", `SELECT id, item_id, user_id, username, content, parent_id, created_at, updated_at
+	                                        FROM comments
+	                                        WHERE user_id = ?
+	                                        ORDER BY created_at`, userID,
+		func(rows *sql.Rows) (models.Comment, error) {
+			var comment models.Comment
+			var parentID sql.NullInt64
+			err := rows.Scan(&comment.ID, &comment.ItemID, &comment.UserID, &comment.Username, &comment.Content,
+				&parentID, &comment.CreatedAt, &comment.UpdatedAt)
+			if parentID.Valid {
+				id := int(parentID.Int64)
+				comment.ParentID = &id
+			}
+			return comment, err
+		})
+}
+
+func getUserPostComments(db *sqldb.DB, userID int) ([]models.PostComment, error) {
+	return queryUserRows(db, "post comments", `SELECT id, post_id, user_id, username, content, parent_id, created_at, updated_at
+	                                             FROM post_comments
+	                                             WHERE user_id = ?
+	                                             ORDER BY created_at`, userID,
+		func(rows *sql.Rows) (models.PostComment, error) {
+			var comment models.PostComment
+			var parentID sql.NullString
+			err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Username, &comment.Content,
+				&parentID, &comment.CreatedAt, &comment.UpdatedAt)
+			if parentID.Valid {
+				comment.ParentID = &parentID.String
+			}
+			return comment, err
+		})
+}
+
+func getUserPosts(db *sqldb.DB, userID int) ([]models.Post, error) {
+	return queryUserRows(db, "posts", `SELECT p.id, p.subverse_id, p.user_id, u.username, p.title, p.content, p.post_type, p.url, p.score, p.created_at, p.updated_at
+	                                     FROM posts p
+	                                     JOIN users u ON p.user_id = u.id
+	                                     WHERE p.user_id = ?
+	                                     ORDER BY p.created_at`, userID,
+		func(rows *sql.Rows) (models.Post, error) {
+			var post models.Post
+			var content, url sql.NullString
+			err := rows.Scan(&post.ID, &post.SubverseID, &post.UserID, &post.Username, &post.Title, &content,
+				&post.PostType, &url, &post.Score, &post.CreatedAt, &post.UpdatedAt)
+			post.Content = content.String
+			post.URL = url.String
+			return post, err
+		})
+}
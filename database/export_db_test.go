@@ -0,0 +1,210 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+func TestDataExports(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		testDataExports(t, db)
+		testGetUserData(t, db)
+	})
+}
+
+// Walks an export through its lifecycle
+func testDataExports(t *testing.T, db *sqldb.DB) {
+	if err := CreateUser(db, "exporter@example.com", "exporter", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := GetUserByEmail(db, "exporter@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+
+	first, err := CreateDataExport(db, user.ID)
+	if err != nil {
+		t.Fatalf("CreateDataExport: %v", err)
+	}
+	if first.Status != models.ExportPending || first.CompletedAt != nil || first.ExpiresAt != nil {
+		t.Errorf("new export = %+v", first)
+	}
+	second, err := CreateDataExport(db, user.ID)
+	if err != nil {
+		t.Fatalf("CreateDataExport: %v", err)
+	}
+
+	if err := MarkDataExportRunning(db, first.ID); err != nil {
+		t.Fatalf("MarkDataExportRunning: %v", err)
+	}
+	pending, err := GetPendingDataExports(db)
+	if err != nil {
+		t.Fatalf("GetPendingDataExports: %v", err)
+	}
+	if len(pending) != 2 || pending[0].ID != first.ID || pending[0].Status != models.ExportRunning {
+		t.Errorf("pending exports = %+v", pending)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := MarkDataExportReady(db, first.ID, 1234, now, now.Add(time.Hour)); err != nil {
+		t.Fatalf("MarkDataExportReady: %v", err)
+	}
+	if err := MarkDataExportFailed(db, second.ID, "disk full", now); err != nil {
+		t.Fatalf("MarkDataExportFailed: %v", err)
+	}
+
+	list, err := GetDataExports(db, user.ID)
+	if err != nil {
+		t.Fatalf("GetDataExports: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != second.ID {
+		t.Fatalf("exports = %+v, want newest first", list)
+	}
+	if list[0].Status != models.ExportFailed || list[0].Error != "disk full" {
+		t.Errorf("failed export = %+v", list[0])
+	}
+	ready := list[1]
+	if ready.Status != models.ExportReady || ready.FileSize != 1234 || ready.ExpiresAt == nil || !ready.ExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("ready export = %+v", ready)
+	}
+
+	expired, err := ExpireDataExports(db, now.Add(30*time.Minute))
+	if err != nil {
+		t.Fatalf("ExpireDataExports: %v", err)
+	}
+	if len(expired) != 0 {
+		t.Errorf("expired %v before the download window passed", expired)
+	}
+	expired, err = ExpireDataExports(db, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ExpireDataExports: %v", err)
+	}
+	if len(expired) != 1 || expired[0] != first.ID {
+		t.Errorf("expired = %v, want [%d]", expired, first.ID)
+	}
+	export, err := GetDataExport(db, first.ID)
+	if err != nil {
+		t.Fatalf("GetDataExport: %v", err)
+	}
+	if export.Status != models.ExportExpired {
+		t.Errorf("status = %q, want expired", export.Status)
+	}
+}
+
+// Checks that everything a user made is gathered and nobody else's data is
+func testGetUserData(t *testing.T, db *sqldb.DB) {
+	for _, name := range []string{"owner", "other"} {
+		if err := CreateUser(db, name+"@example.com", name, "secret", "10.0.0.1"); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	owner, err := GetUserByEmail(db, "owner@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	other, err := GetUserByEmail(db, "other@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+
+	source, err := feeds.CreateOrUpdateFeedSource(db, "Example", "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("CreateOrUpdateFeedSource: %v", err)
+	}
+	for _, id := range []string{"item-1", "item-2"} {
+		_, err := db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author, published_at) VALUES (?, ?, ?, ?, '', '', ?)`,
+			id, source.ID, "Title of "+id, "https://example.com/"+id, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+
+	category, err := CreateUserCategory(db, owner.ID, "Exported", "Daily reading")
+	if err != nil {
+		t.Fatalf("CreateUserCategory: %v", err)
+	}
+	if err := AddFeedToUserCategory(db, owner.ID, category.ID, source.ID); err != nil {
+		t.Fatalf("AddFeedToUserCategory: %v", err)
+	}
+	if _, err := SaveToReadingList(db, owner.ID, "item-1"); err != nil {
+		t.Fatalf("SaveToReadingList: %v", err)
+	}
+	if err := HideFeedItem(db, owner.ID, "item-2"); err != nil {
+		t.Fatalf("HideFeedItem: %v", err)
+	}
+	if _, err := feeds.HandleVote(db, "item-1", owner.ID, "up"); err != nil {
+		t.Fatalf("HandleVote: %v", err)
+	}
+	if _, err := feeds.HandleVote(db, "item-1", other.ID, "down"); err != nil {
+		t.Fatalf("HandleVote: %v", err)
+	}
+	parent, err := CreateComment(db, "item-1", owner.ID, owner.Username, "First", nil)
+	if err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	if _, err := CreateComment(db, "item-1", owner.ID, owner.Username, "Reply", &parent.ID); err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	if _, err := CreateComment(db, "item-1", other.ID, other.Username, "Not mine", nil); err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	subverse, err := CreateSubverse(db, "golang")
+	if err != nil {
+		t.Fatalf("CreateSubverse: %v", err)
+	}
+	post, err := CreatePost(db, subverse.ID, owner.ID, owner.Username, "Hello", "Body", "text", "")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if _, err := CreatePostComment(db, post.ID, owner.ID, owner.Username, "On my post", nil); err != nil {
+		t.Fatalf("CreatePostComment: %v", err)
+	}
+	if err := VoteOnPost(db, owner.ID, post.ID, "upvote"); err != nil {
+		t.Fatalf("VoteOnPost: %v", err)
+	}
+
+	data, err := GetUserData(db, owner.ID)
+	if err != nil {
+		t.Fatalf("GetUserData: %v", err)
+	}
+	if data.User.Username != "owner" || data.User.IPAddress != "10.0.0.1" {
+		t.Errorf("user = %+v", data.User)
+	}
+	found := false
+	for _, c := range data.Categories {
+		if c.ID == category.ID {
+			found = len(c.Feeds) == 1 && c.Feeds[0].URL == "https://example.com/feed"
+		}
+	}
+	if !found {
+		t.Errorf("categories = %+v, want %q with its feed", data.Categories, category.Name)
+	}
+	if len(data.ReadingList) != 1 || data.ReadingList[0].ID != "item-1" {
+		t.Errorf("reading list = %+v", data.ReadingList)
+	}
+	if len(data.Hidden) != 1 || data.Hidden[0].ItemID != "item-2" || data.Hidden[0].Title != "Title of item-2" {
+		t.Errorf("hidden = %+v", data.Hidden)
+	}
+	if len(data.ItemVotes) != 1 || data.ItemVotes[0].VoteType != "up" || data.ItemVotes[0].Title != "Title of item-1" {
+		t.Errorf("item votes = %+v", data.ItemVotes)
+	}
+	if len(data.PostVotes) != 1 || data.PostVotes[0].PostID != post.ID {
+		t.Errorf("post votes = %+v", data.PostVotes)
+	}
+	if len(data.Comments) != 2 || data.Comments[1].ParentID == nil || *data.Comments[1].ParentID != parent.ID {
+		t.Errorf("comments = %+v", data.Comments)
+	}
+	if len(data.PostComments) != 1 || data.PostComments[0].Content != "On my post" {
+		t.Errorf("post comments = %+v", data.PostComments)
+	}
+	if len(data.Posts) != 1 || data.Posts[0].Title != "Hello" || data.Posts[0].Content != "Body" {
+		t.Errorf("posts = %+v", data.Posts)
+	}
+}
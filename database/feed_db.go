@@ -2,14 +2,14 @@ package database
 
 import (
 	"database/sql"
-	"strings"
 
 	"github.com/Masterminds/squirrel"
-	"github.com/gofiber/fiber/v2"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
 )
 
-// Build feed items search query using Squirrel
-var FeedItemsQueryBuilder = squirrel.Select(
+// The standard feed item columns followed by the source name, as read by scanFeedItems
+var feedItemColumns = []string{
 	"fi.id",
 	"fi.source_id",
 	"fi.title",
@@ -21,101 +21,80 @@ var FeedItemsQueryBuilder = squirrel.Select(
 	"fi.comments_count",
 	"fi.created_at",
 	"fs.name as source_name",
-).From("feed_items fi").
+}
+
+// Build feed items search query using Squirrel
+var FeedItemsQueryBuilder = squirrel.Select(feedItemColumns...).
+	From("feed_items fi").
 	Join("feed_sources fs ON fi.source_id = fs.id").
 	OrderBy("fi.published_at DESC").
 	Limit(50)
 
-// Build feed insertion query using Squirrel
+// Build feed insertion query using Squirrel, returning the new ID
 var FeedInsertionBuilder = squirrel.Insert("feed_sources").
 	Columns("name", "url", "last_updated", "update_interval").
-	Values(squirrel.Expr("?, ?, datetime('2000-01-01 00:00:00'), 3600"))
-
-// Primarily for search purposes
-func GetFeedItemsToQuery(query string) (*sql.Rows, error) {
-	var (
-		searchQuery = `%` + strings.ToLower(query) + `%`
-	)
-	sqlQuery, args, err := FeedItemsQueryBuilder.Where(
-		squirrel.Or{
-			squirrel.Expr("LOWER(fi.title) LIKE ?", searchQuery),
-			squirrel.Expr("LOWER(fi.description) LIKE ?", searchQuery),
-			squirrel.Expr("LOWER(fi.author) LIKE ?", searchQuery),
-		},
-	).ToSql()
+	Suffix("RETURNING id")
+
+// Scans rows of the standard feed item columns followed by the source name
+func scanFeedItems(rows *sql.Rows) ([]feeds.FeedItem, error) {
+	defer rows.Close()
+
+	var items []feeds.FeedItem
+	for rows.Next() {
+		var item feeds.FeedItem
+		err := rows.Scan(&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
+			&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &item.SourceName)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
 
+// Retrieves a single feed item along with its source name
+func GetFeedItemByID(db *sqldb.DB, itemID string) (*feeds.FeedItem, error) {
+	var item feeds.FeedItem
+	err := db.QueryRow(FeedItemsQueryVariation, itemID).Scan(&item.ID, &item.SourceID, &item.Title, &item.URL,
+		&item.Description, &item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &item.SourceName)
 	if err != nil {
 		return nil, err
 	}
-
-	rows, err := GetDB().Query(sqlQuery, args...)
-	return rows, err
+	return &item, nil
 }
 
-func BuildFiQuery(userID int, categoryID int, c *fiber.Ctx) (string, []interface{}, error) {
-	sq := squirrel.Select(
-		"fi.id", "fi.source_id", "fi.title", "fi.url", "fi.description", "fi.author", "fi.published_at", "fi.score", "fi.comments_count", "fi.created_at", "fs.name as source_name",
-	).From("feed_items fi").
-		Join("feed_sources fs ON fi.source_id = fs.id").
+// Gets the newest items from the feeds in one of a user's categories
+func GetCategoryFeedItems(db *sqldb.DB, userID, categoryID, limit int) ([]feeds.FeedItem, error) {
+	sqlQuery, args, err := FeedItemsQueryBuilder.
 		Join("user_category_feeds ucf ON fs.id = ucf.feed_source_id").
 		Where(squirrel.Eq{"ucf.user_id": userID, "ucf.category_id": categoryID}).
-		OrderBy("fi.published_at DESC").
-		Limit(50)
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
 
-	sql, args, err := sq.ToSql()
+	rows, err := db.Query(sqlQuery, args...)
 	if err != nil {
-		return "", nil, c.Status(500).JSON(fiber.Map{
-			"error": "Failed to build query",
-		})
+		return nil, err
 	}
-	return sql, args, nil
+	return scanFeedItems(rows)
 }
 
-func GraphFeedQuery(db *sql.DB, userID int, catID int) (*sql.Rows, error) {
-	postRows, err := db.Query(`
-				SELECT fi.id, fi.title
-				FROM feed_items fi
-				JOIN user_category_feeds ucf ON fi.source_id = ucf.feed_source_id
-				WHERE ucf.user_id = ? AND ucf.category_id = ?
-				LIMIT 50
-			`, userID, catID)
-	return postRows, err
+// Marks every feed in a user's category as stale so the next check refetches it
+//
+// Returns the number of feeds reset.
+func ResetCategoryFeedTimestamps(db *sqldb.DB, userID, categoryID int) (int64, error) {
+	result, err := db.Exec(ResetQuery, userID, categoryID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
-var PostFeedQuery = `
-SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author,
-	   fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name as source_name
-FROM feed_items fi
-JOIN feed_sources fs ON fi.source_id = fs.id
-WHERE fi.id = ?`
-
-var FeedsQuery = `
-SELECT fs.id, fs.name, fs.url, fs.last_updated
-FROM feed_sources fs
-JOIN user_category_feeds ucf ON fs.id = ucf.feed_source_id
-WHERE ucf.user_id = ? AND ucf.category_id = ?
-`
-
-var SurpFeedsQuery = `
-SELECT fs.id, fs.name, fs.url
-FROM feed_sources fs
-JOIN user_category_feeds ucf ON fs.id = ucf.feed_source_id
-WHERE ucf.user_id = ? AND ucf.category_id = ?
-`
-
-var PostFeedNextQuery = `
-SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author, fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name as source_name
-FROM feed_items fi
-JOIN feed_sources fs ON fi.source_id = fs.id
-JOIN user_category_feeds ucf ON fs.id = ucf.feed_source_id
-WHERE ucf.user_id = ? AND ucf.category_id = ?
-ORDER BY fi.published_at DESC
-LIMIT 50
-`
-
 var ResetQuery = `
 UPDATE feed_sources
-SET last_updated = datetime('2000-01-01 00:00:00')
+SET last_updated = '2000-01-01 00:00:00'
 WHERE id IN (
 	SELECT feed_source_id
 	FROM user_category_feeds
@@ -128,4 +107,4 @@ FROM feed_items fi
 JOIN feed_sources fs ON fi.source_id = fs.id
 WHERE fi.id = ?`
 
-var ResetAllFeedTimestampsQuery = `UPDATE feed_sources SET last_updated = datetime('2000-01-01 00:00:00')`
+var ResetAllFeedTimestampsQuery = `UPDATE feed_sources SET last_updated = '2000-01-01 00:00:00'`
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+// Returned when deleting a feed source that a newsletter address delivers into
+var ErrNewsletterFeedSource = errors.New("feed source belongs to a newsletter address")
+
+// Deletes a feed source along with its items.
+//
+// The source is taken out of every category and subverse, and the votes,
+// comments, reading list entries and saved search matches on its items go
+// with them.
+func DeleteFeedSource(db *sqldb.DB, sourceID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id int
+	if err := tx.QueryRow(`SELECT id FROM feed_sources WHERE id = ?`, sourceID).Scan(&id); err != nil {
+		return err
+	}
+	var newsletters int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM newsletter_addresses WHERE feed_source_id = ?`, sourceID).Scan(&newsletters); err != nil {
+		return fmt.Errorf("failed to check newsletter addresses: %w", err)
+	}
+	if newsletters > 0 {
+		return ErrNewsletterFeedSource
+	}
+
+	items := `(SELECT id FROM feed_items WHERE source_id = ?)`
+	for _, query := range []string{
+		`DELETE FROM upvotes WHERE item_id IN ` + items,
+		`DELETE FROM reading_list WHERE item_id IN ` + items,
+		`DELETE FROM hidden_posts WHERE item_id IN ` + items,
+		`DELETE FROM comments WHERE item_id IN ` + items,
+		`DELETE FROM saved_search_matches WHERE item_id IN ` + items,
+		`DELETE FROM feed_items WHERE source_id = ?`,
+		`DELETE FROM user_category_feeds WHERE feed_source_id = ?`,
+		`DELETE FROM subverse_feeds WHERE feed_source_id = ?`,
+		`DELETE FROM feed_sources WHERE id = ?`,
+	} {
+		if _, err := tx.Exec(query, sourceID); err != nil {
+			return fmt.Errorf("failed to delete feed source: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+)
+
+func TestFeedSources(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		testFeedSources(t, db)
+	})
+}
+
+func testFeedSources(t *testing.T, db *sqldb.DB) {
+	if err := CreateUser(db, "reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := GetUserByEmail(db, "reader@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+
+	removed, err := feeds.CreateOrUpdateFeedSource(db, "Removed", "https://example.com/removed")
+	if err != nil {
+		t.Fatalf("CreateOrUpdateFeedSource: %v", err)
+	}
+	kept, err := feeds.CreateOrUpdateFeedSource(db, "Kept", "https://example.com/kept")
+	if err != nil {
+		t.Fatalf("CreateOrUpdateFeedSource: %v", err)
+	}
+
+	// Disabling
+	if removed.Disabled {
+		t.Error("new feed source is disabled")
+	}
+	if err := feeds.SetFeedSourceDisabled(db, removed.ID, true); err != nil {
+		t.Fatalf("SetFeedSourceDisabled: %v", err)
+	}
+	source, err := feeds.GetFeedSourceByID(db, removed.ID)
+	if err != nil {
+		t.Fatalf("GetFeedSourceByID: %v", err)
+	}
+	if !source.Disabled {
+		t.Error("feed source not disabled")
+	}
+	if err := feeds.SetFeedSourceDisabled(db, 9999, true); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("disabling a missing feed source = %v, want sql.ErrNoRows", err)
+	}
+
+	// Deleting
+	for _, id := range []string{"removed-1", "kept-1"} {
+		sourceID := removed.ID
+		if id == "kept-1" {
+			sourceID = kept.ID
+		}
+		_, err := db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author) VALUES (?, ?, 'Title', ?, '', '')`,
+			id, sourceID, "https://example.com/"+id)
+		if err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+		if _, err := feeds.HandleVote(db, id, user.ID, "upvote"); err != nil {
+			t.Fatalf("HandleVote: %v", err)
+		}
+		if _, err := SaveToReadingList(db, user.ID, id); err != nil {
+			t.Fatalf("SaveToReadingList: %v", err)
+		}
+		if _, err := CreateComment(db, id, user.ID, user.Username, "Comment", nil); err != nil {
+			t.Fatalf("CreateComment: %v", err)
+		}
+	}
+	category, err := CreateUserCategory(db, user.ID, "Both", "")
+	if err != nil {
+		t.Fatalf("CreateUserCategory: %v", err)
+	}
+	for _, id := range []int{removed.ID, kept.ID} {
+		if err := AddFeedToUserCategory(db, user.ID, category.ID, id); err != nil {
+			t.Fatalf("AddFeedToUserCategory: %v", err)
+		}
+	}
+
+	if err := DeleteFeedSource(db, removed.ID); err != nil {
+		t.Fatalf("DeleteFeedSource: %v", err)
+	}
+	if err := DeleteFeedSource(db, removed.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleting a missing feed source = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := feeds.GetFeedSourceByID(db, removed.ID); err == nil {
+		t.Error("deleted feed source still exists")
+	}
+
+	for table, column := range map[string]string{"feed_items": "id", "upvotes": "item_id", "reading_list": "item_id", "comments": "item_id"} {
+		var removedRows, keptRows int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE ` + column + ` = 'removed-1'`).Scan(&removedRows); err != nil {
+			t.Fatalf("failed to count %s: %v", table, err)
+		}
+		if err := db.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE ` + column + ` = 'kept-1'`).Scan(&keptRows); err != nil {
+			t.Fatalf("failed to count %s: %v", table, err)
+		}
+		if removedRows != 0 || keptRows != 1 {
+			t.Errorf("%s has %d rows for the deleted source's item and %d for the other, want 0 and 1", table, removedRows, keptRows)
+		}
+	}
+	sources, err := GetFeedsInUserCategory(db, user.ID, category.ID)
+	if err != nil {
+		t.Fatalf("GetFeedsInUserCategory: %v", err)
+	}
+	if len(sources) != 1 || sources[0].ID != kept.ID {
+		t.Errorf("category feeds = %+v, want only the kept source", sources)
+	}
+
+	// Newsletter sources belong to their address
+	addr, err := CreateNewsletterAddress(db, user.ID, "Weekly", "weekly.abcd1234")
+	if err != nil {
+		t.Fatalf("CreateNewsletterAddress: %v", err)
+	}
+	if err := DeleteFeedSource(db, addr.FeedSourceID); !errors.Is(err, ErrNewsletterFeedSource) {
+		t.Errorf("deleting a newsletter feed source = %v, want ErrNewsletterFeedSource", err)
+	}
+}
@@ -0,0 +1,216 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/search"
+)
+
+// Most facet values listed per facet
+const maxFacetValues = 20
+
+// Searches feed items, posts, comments, subverses and users at once.
+//
+// Each content type gets its own page of results, best matches first, unless
+// opts.Type narrows the search to one of them. The facet counts always cover
+// every match of the query.
+func SearchAll(db *sqldb.DB, query *search.Query, opts repository.SearchOptions) (*repository.SearchResults, error) {
+	results := &repository.SearchResults{
+		Facets: repository.SearchFacets{
+			Types:     make(map[string]int),
+			Sources:   []repository.FacetCount{},
+			Subverses: []repository.FacetCount{},
+		},
+	}
+	if query.Empty() {
+		return results, nil
+	}
+
+	// Field filters only make sense for feed items
+	texts := query.Text()
+	textOnly := len(texts) == len(query.Exprs)
+	wants := func(contentType string) bool {
+		return opts.Type == "" || opts.Type == contentType
+	}
+
+	var err error
+	count := func(builder squirrel.SelectBuilder, _ bool) (int, error) {
+		return countRows(db, builder)
+	}
+
+	if results.Facets.Types[repository.SearchFeedItems], err = count(selectFeedItemSearch(db, query, "COUNT(*)")); err != nil {
+		return nil, fmt.Errorf("failed to count feed items: %w", err)
+	}
+	bySource, _ := selectFeedItemSearch(db, query, "fs.name", "COUNT(*)")
+	if results.Facets.Sources, err = facetCounts(db, bySource.GroupBy("fs.name")); err != nil {
+		return nil, fmt.Errorf("failed to count feed items by source: %w", err)
+	}
+	if wants(repository.SearchFeedItems) {
+		narrowed := query
+		if opts.Source != "" {
+			exprs := append([]search.Expr{search.Match{Field: search.Source, Value: opts.Source}}, query.Exprs...)
+			narrowed = &search.Query{Exprs: exprs}
+		}
+		if results.FeedItems, err = SearchFeedItems(db, narrowed, opts.Limit, opts.Offset); err != nil {
+			return nil, err
+		}
+	}
+	if !textOnly {
+		return results, nil
+	}
+
+	posts := func(columns ...string) (squirrel.SelectBuilder, bool) {
+		builder, ranked := selectPostSearch(db, texts, columns...)
+		return builder.Join("subverses s ON p.subverse_id = s.id"), ranked
+	}
+	if results.Facets.Types[repository.SearchPosts], err = count(posts("COUNT(*)")); err != nil {
+		return nil, fmt.Errorf("failed to count posts: %w", err)
+	}
+	bySubverse, _ := posts("s.name", "COUNT(*)")
+	if results.Facets.Subverses, err = facetCounts(db, bySubverse.GroupBy("s.name")); err != nil {
+		return nil, fmt.Errorf("failed to count posts by subverse: %w", err)
+	}
+	if wants(repository.SearchPosts) {
+		builder, ranked := posts(postSearchColumns...)
+		if opts.Subverse != "" {
+			builder = builder.Where("LOWER(s.name) = LOWER(?)", opts.Subverse)
+		}
+		if results.Posts, err = queryPosts(db, builder, ranked, opts.Limit, opts.Offset); err != nil {
+			return nil, err
+		}
+	}
+
+	if results.Facets.Types[repository.SearchComments], err = count(selectCommentSearch(db, texts, "COUNT(*)")); err != nil {
+		return nil, fmt.Errorf("failed to count comments: %w", err)
+	}
+	if wants(repository.SearchComments) {
+		builder, ranked := selectCommentSearch(db, texts, commentSearchColumns...)
+		if results.Comments, err = queryComments(db, builder, ranked, opts.Limit, opts.Offset); err != nil {
+			return nil, err
+		}
+	}
+
+	if results.Facets.Types[repository.SearchPostComments], err = count(selectPostCommentSearch(db, texts, "COUNT(*)")); err != nil {
+		return nil, fmt.Errorf("failed to count post comments: %w", err)
+	}
+	if wants(repository.SearchPostComments) {
+		builder, ranked := selectPostCommentSearch(db, texts, postCommentSearchColumns...)
+		if results.PostComments, err = queryPostComments(db, builder, ranked, opts.Limit, opts.Offset); err != nil {
+			return nil, err
+		}
+	}
+
+	subverses := func(columns ...string) (squirrel.SelectBuilder, bool) {
+		return subverseNames.selectText(squirrel.Select(columns...), "s", texts, false)
+	}
+	if results.Facets.Types[repository.SearchSubverses], err = count(subverses("COUNT(*)")); err != nil {
+		return nil, fmt.Errorf("failed to count subverses: %w", err)
+	}
+	if wants(repository.SearchSubverses) {
+		builder, _ := subverses("s.id", "s.name", "s.created_at")
+		if results.Subverses, err = querySubverses(db, builder, opts.Limit, opts.Offset); err != nil {
+			return nil, err
+		}
+	}
+
+	users := func(columns ...string) (squirrel.SelectBuilder, bool) {
+		builder, ranked := usernames.selectText(squirrel.Select(columns...), "u", texts, false)
+		return builder.Where("u.deleted_at IS NULL"), ranked
+	}
+	if results.Facets.Types[repository.SearchUsers], err = count(users("COUNT(*)")); err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+	if wants(repository.SearchUsers) {
+		builder, _ := users("u.id", "u.username")
+		if results.Users, err = queryUsers(db, builder, opts.Limit, opts.Offset); err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// Runs a select of one count
+func countRows(db *sqldb.DB, builder squirrel.SelectBuilder) (int, error) {
+	sqlQuery, args, err := builder.ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = db.QueryRow(sqlQuery, args...).Scan(&n)
+	return n, err
+}
+
+// Runs a grouped select of facet values and their counts, most matches first
+func facetCounts(db *sqldb.DB, builder squirrel.SelectBuilder) ([]repository.FacetCount, error) {
+	sqlQuery, args, err := builder.OrderBy("2 DESC", "1").Limit(maxFacetValues).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := []repository.FacetCount{}
+	for rows.Next() {
+		var facet repository.FacetCount
+		if err := rows.Scan(&facet.Value, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets = append(facets, facet)
+	}
+	return facets, rows.Err()
+}
+
+// Runs a subverse search selecting id, name and created_at, by name
+func querySubverses(db *sqldb.DB, builder squirrel.SelectBuilder, limit, offset int) ([]models.Subverse, error) {
+	sqlQuery, args, err := builder.OrderBy("s.name").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search subverses: %w", err)
+	}
+	defer rows.Close()
+
+	var subverses []models.Subverse
+	for rows.Next() {
+		var subverse models.Subverse
+		if err := rows.Scan(&subverse.ID, &subverse.Name, &subverse.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan subverse: %w", err)
+		}
+		subverses = append(subverses, subverse)
+	}
+	return subverses, rows.Err()
+}
+
+// Runs a user search selecting id and username, by username
+func queryUsers(db *sqldb.DB, builder squirrel.SelectBuilder, limit, offset int) ([]repository.UserMatch, error) {
+	sqlQuery, args, err := builder.OrderBy("u.username").Limit(uint64(limit)).Offset(uint64(offset)).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []repository.UserMatch
+	for rows.Next() {
+		var user repository.UserMatch
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/search"
+)
+
+func TestSearchAll(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if err := EnsureSearchIndex(db); err != nil {
+			t.Fatalf("EnsureSearchIndex: %v", err)
+		}
+		testSearchAll(t, db)
+	})
+}
+
+// Searches one word that appears in every kind of content
+func testSearchAll(t *testing.T, db *sqldb.DB) {
+	if err := CreateUser(db, "kernel@example.com", "kernelhacker", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := GetUserByEmail(db, "kernel@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	var sourceID int
+	if err := db.QueryRow(`INSERT INTO feed_sources (name, url) VALUES ('Example', 'https://example.com/feed') RETURNING id`).Scan(&sourceID); err != nil {
+		t.Fatalf("failed to insert source: %v", err)
+	}
+	for id, title := range map[string]string{"linux": "Linux kernel 7.0", "bsd": "A kernel without Linux", "cooking": "Cooking for one"} {
+		_, err := db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author) VALUES (?, ?, ?, ?, '', '')`,
+			id, sourceID, title, "https://example.com/"+id)
+		if err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+	if _, err := CreateComment(db, "cooking", user.ID, user.Username, "Needs more kernel corn", nil); err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+
+	kernels, err := CreateSubverse(db, "kernels")
+	if err != nil {
+		t.Fatalf("CreateSubverse: %v", err)
+	}
+	food, err := CreateSubverse(db, "food")
+	if err != nil {
+		t.Fatalf("CreateSubverse: %v", err)
+	}
+	post, err := CreatePost(db, kernels.ID, user.ID, user.Username, "Kernel panic", "Help", "text", "")
+	if err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if _, err := CreatePost(db, food.ID, user.ID, user.Username, "Popcorn kernel tips", "Salt early", "text", ""); err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if _, err := CreatePostComment(db, post.ID, user.ID, user.Username, "Rebuild the kernel", nil); err != nil {
+		t.Fatalf("CreatePostComment: %v", err)
+	}
+
+	run := func(query string, opts repository.SearchOptions) *repository.SearchResults {
+		t.Helper()
+		parsed, err := search.Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", query, err)
+		}
+		if opts.Limit == 0 {
+			opts.Limit = 10
+		}
+		results, err := SearchAll(db, parsed, opts)
+		if err != nil {
+			t.Fatalf("SearchAll(%q): %v", query, err)
+		}
+		return results
+	}
+
+	results := run("kernel", repository.SearchOptions{})
+	want := map[string]int{
+		repository.SearchFeedItems:    2,
+		repository.SearchPosts:        2,
+		repository.SearchComments:     1,
+		repository.SearchPostComments: 1,
+		repository.SearchSubverses:    1,
+		repository.SearchUsers:        1,
+	}
+	for contentType, n := range want {
+		if got := results.Facets.Types[contentType]; got != n {
+			t.Errorf("%s count = %d, want %d", contentType, got, n)
+		}
+	}
+	if len(results.FeedItems) != 2 || len(results.Posts) != 2 || len(results.Comments) != 1 ||
+		len(results.PostComments) != 1 || len(results.Subverses) != 1 || len(results.Users) != 1 {
+		t.Errorf("results = %+v", results)
+	}
+	if len(results.Facets.Subverses) != 2 || results.Facets.Subverses[0].Value != "food" {
+		t.Errorf("subverse facets = %+v, want food and kernels by name", results.Facets.Subverses)
+	}
+
+	// Narrowing returns one type but keeps every count
+	narrowed := run("kernel", repository.SearchOptions{Type: repository.SearchPosts, Subverse: "Kernels"})
+	if len(narrowed.Posts) != 1 || narrowed.Posts[0].ID != post.ID || len(narrowed.FeedItems) != 0 || len(narrowed.Users) != 0 {
+		t.Errorf("narrowed results = %+v", narrowed)
+	}
+	if narrowed.Facets.Types[repository.SearchFeedItems] != 2 || narrowed.Facets.Types[repository.SearchPosts] != 2 {
+		t.Errorf("narrowed counts = %+v", narrowed.Facets.Types)
+	}
+	if bySource := run("kernel", repository.SearchOptions{Source: "Elsewhere"}); len(bySource.FeedItems) != 0 {
+		t.Errorf("items from another source = %+v", bySource.FeedItems)
+	}
+
+	// Field filters only apply to feed items
+	filtered := run("kernel -without source:Example", repository.SearchOptions{})
+	if len(filtered.FeedItems) != 1 || filtered.FeedItems[0].ID != "linux" || len(filtered.Posts) != 0 || filtered.Facets.Types[repository.SearchPosts] != 0 {
+		t.Errorf("filtered results = %+v", filtered)
+	}
+
+	if empty := run(" ", repository.SearchOptions{}); len(empty.Facets.Types) != 0 || empty.Facets.Sources == nil {
+		t.Errorf("empty query = %+v", empty)
+	}
+}
@@ -1,3 +0,0 @@
-package database
-
-var CategoryQuery = "SELECT id, name FROM user_categories WHERE user_id = ?"
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"github.com/navid-m/versed/metrics"
+)
+
+// Read from the database opened by OpenDatabase whenever metrics are scraped
+var (
+	_ = metrics.NewGaugeFunc("versed_sessions_open", "Sign-in sessions that have not expired.", nil,
+		func(emit func(float64, ...string)) {
+			if db == nil {
+				return
+			}
+			count, err := CountActiveSessions(db)
+			if err != nil {
+				logger.Error("Failed to count sessions", "err", err)
+				return
+			}
+			emit(float64(count))
+		})
+
+	_ = metrics.NewGaugeFunc("versed_db_connections", "Database connections in the pool, by state.", []string{"state"},
+		func(emit func(float64, ...string)) {
+			if db == nil {
+				return
+			}
+			stats := db.Stats()
+			emit(float64(stats.InUse), "in_use")
+			emit(float64(stats.Idle), "idle")
+		})
+)
@@ -0,0 +1,390 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Returned when the database was migrated by a newer binary than this one
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// Returned when the database has migrations left to apply
+var ErrSchemaOutdated = errors.New("database schema has pending migrations")
+
+// A numbered schema change with its forward and reverse SQL
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// The applied state of a single migration
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Loads the embedded migrations for a dialect in version order.
+//
+// Each dialect has its own copy of every migration under the same version and name.
+func Migrations(dialect sqldb.Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Returns the version of the newest embedded migration
+func LatestSchemaVersion(dialect sqldb.Dialect) (int, error) {
+	migrations, err := Migrations(dialect)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].Version, nil
+}
+
+// Reports whether a table exists in the database
+func tableExists(db *sqldb.DB, name string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if db.Dialect == sqldb.Postgres {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?`
+	}
+	var count int
+	if err := db.QueryRow(query, name).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Creates the schema_migrations table, adopting databases created before migrations existed
+func ensureMigrationsTable(db *sqldb.DB) error {
+	exists, err := tableExists(db, "schema_migrations")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	if db.Dialect == sqldb.SQLite {
+		if err := adoptLegacySchema(db); err != nil {
+			return fmt.Errorf("failed to adopt existing schema: %w", err)
+		}
+	}
+
+	appliedAt := "DATETIME"
+	if db.Dialect == sqldb.Postgres {
+		appliedAt = "TIMESTAMPTZ"
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at ` + appliedAt + ` DEFAULT CURRENT_TIMESTAMP
+	)`)
+	return err
+}
+
+// Brings SQLite tables created by older releases up to the initial migration's shape.
+//
+// Those releases added columns ad hoc on startup, so a database from before
+// migrations may be missing some of them. The initial migration only creates
+// tables that do not exist yet, so these columns have to be added here.
+func adoptLegacySchema(db *sqldb.DB) error {
+	legacyColumns := []struct{ table, column, definition string }{
+		{"users", "ip_address", "TEXT"},
+		{"comments", "parent_id", "INTEGER"},
+	}
+	for _, c := range legacyColumns {
+		exists, err := tableExists(db, c.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+
+		var count int
+		err = db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, c.table, c.column).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			logger.Info("Adding legacy column", "table", c.table, "column", c.column)
+			if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.definition)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the highest applied migration version, or 0 for an empty database
+func SchemaVersion(db *sqldb.DB) (int, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Fails with ErrSchemaTooNew if the database has migrations this binary does not know about
+func CheckSchemaVersion(db *sqldb.DB) error {
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest, err := LatestSchemaVersion(db.Dialect)
+	if err != nil {
+		return err
+	}
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, current, latest)
+	}
+	return nil
+}
+
+// Fails unless the database is at exactly the newest version this binary knows,
+// with ErrSchemaOutdated or ErrSchemaTooNew
+func CheckSchemaCurrent(db *sqldb.DB) error {
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest, err := LatestSchemaVersion(db.Dialect)
+	if err != nil {
+		return err
+	}
+	switch {
+	case current > latest:
+		return fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, current, latest)
+	case current < latest:
+		return fmt.Errorf("%w: database is at version %d, latest is %d", ErrSchemaOutdated, current, latest)
+	}
+	return nil
+}
+
+// Returns every known migration with the time it was applied, if it has been
+func MigrationStatuses(db *sqldb.DB) ([]MigrationStatus, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]time.Time)
+	names := make(map[int]string)
+	rows, err := db.Query(`SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var name string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &name, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[version] = appliedAt
+		names[version] = name
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			status.AppliedAt = &at
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, at := range applied {
+		statuses = append(statuses, MigrationStatus{Version: version, Name: names[version] + " (unknown)", AppliedAt: &at})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Applies every pending migration
+func Migrate(db *sqldb.DB) ([]Migration, error) {
+	latest, err := LatestSchemaVersion(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	return MigrateTo(db, latest)
+}
+
+// Applies or rolls back migrations until the database is at the target version
+func MigrateTo(db *sqldb.DB, target int) ([]Migration, error) {
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	if target < current {
+		steps := 0
+		for _, m := range migrations {
+			if m.Version > target && m.Version <= current {
+				steps++
+			}
+		}
+		return Rollback(db, steps)
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		if err := runMigration(db, m, true); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// Reverts the most recently applied migrations, newest first
+func Rollback(db *sqldb.DB, steps int) ([]Migration, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	rows, err := db.Query(`SELECT version FROM schema_migrations ORDER BY version DESC LIMIT ?`, steps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	var versions []int
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	rows.Close()
+
+	var reverted []Migration
+	for _, version := range versions {
+		m, ok := byVersion[version]
+		if !ok {
+			return reverted, fmt.Errorf("%w: cannot roll back unknown migration %d", ErrSchemaTooNew, version)
+		}
+		if err := runMigration(db, m, false); err != nil {
+			return reverted, err
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// Runs one direction of a migration and records it, all in a single transaction
+func runMigration(db *sqldb.DB, m Migration, up bool) error {
+	direction, script := "up", m.Up
+	if !up {
+		direction, script = "down", m.Down
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("migration %d_%s (%s) failed: %w", m.Version, m.Name, direction, err)
+	}
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, m.Version, m.Name)
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logger.Info("Migrated "+direction, "version", m.Version, "name", m.Name)
+	return nil
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+func TestMigrationsAreNumberedAndPaired(t *testing.T) {
+	for _, dialect := range []sqldb.Dialect{sqldb.SQLite, sqldb.Postgres} {
+		migrations, err := Migrations(dialect)
+		if err != nil {
+			t.Fatalf("Migrations(%s): %v", dialect, err)
+		}
+		if len(migrations) == 0 {
+			t.Fatalf("no %s migrations embedded", dialect)
+		}
+		for i, m := range migrations {
+			if m.Version != i+1 {
+				t.Errorf("%s migration %d_%s is out of sequence, want version %d", dialect, m.Version, m.Name, i+1)
+			}
+		}
+	}
+}
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	sqlite, err := Migrations(sqldb.SQLite)
+	if err != nil {
+		t.Fatalf("Migrations(sqlite): %v", err)
+	}
+	postgres, err := Migrations(sqldb.Postgres)
+	if err != nil {
+		t.Fatalf("Migrations(postgres): %v", err)
+	}
+	if len(sqlite) != len(postgres) {
+		t.Fatalf("%d sqlite migrations but %d postgres ones", len(sqlite), len(postgres))
+	}
+	for i := range sqlite {
+		if sqlite[i].Version != postgres[i].Version || sqlite[i].Name != postgres[i].Name {
+			t.Errorf("sqlite migration %d_%s has postgres counterpart %d_%s",
+				sqlite[i].Version, sqlite[i].Name, postgres[i].Version, postgres[i].Name)
+		}
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	forEachDatabase(t, testMigrateUpAndDown)
+}
+
+func testMigrateUpAndDown(t *testing.T, db *sqldb.DB) {
+
+	applied, err := Migrate(db)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	latest, _ := LatestSchemaVersion(db.Dialect)
+	if len(applied) != latest {
+		t.Fatalf("applied %d migrations, want %d", len(applied), latest)
+	}
+	if version, _ := SchemaVersion(db); version != latest {
+		t.Fatalf("SchemaVersion = %d, want %d", version, latest)
+	}
+	if !hasColumn(t, db, "subverses", "post_count") {
+		t.Error("subverses.post_count missing after migrating")
+	}
+
+	applied, err = Migrate(db)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("second Migrate applied %d migrations, err %v", len(applied), err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO subverses (name) VALUES ('golang')`); err != nil {
+		t.Fatalf("failed to insert subverse: %v", err)
+	}
+	if _, err := MigrateTo(db, 4); err != nil {
+		t.Fatalf("MigrateTo(4): %v", err)
+	}
+	if hasColumn(t, db, "subverses", "post_count") {
+		t.Error("subverses.post_count still present after rollback")
+	}
+	var name string
+	if err := db.QueryRow(`SELECT name FROM subverses`).Scan(&name); err != nil || name != "golang" {
+		t.Errorf("subverse lost during rollback: %q, %v", name, err)
+	}
+
+	if _, err := MigrateTo(db, 0); err != nil {
+		t.Fatalf("MigrateTo(0): %v", err)
+	}
+	if hasTable(t, db, "users") {
+		t.Error("users table still present after rolling back everything")
+	}
+	if version, _ := SchemaVersion(db); version != 0 {
+		t.Errorf("SchemaVersion = %d after full rollback", version)
+	}
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate after full rollback: %v", err)
+	}
+}
+
+func TestMigrationStatuses(t *testing.T) {
+	forEachDatabase(t, testMigrationStatuses)
+}
+
+func testMigrationStatuses(t *testing.T, db *sqldb.DB) {
+	if _, err := MigrateTo(db, 2); err != nil {
+		t.Fatalf("MigrateTo(2): %v", err)
+	}
+
+	statuses, err := MigrationStatuses(db)
+	if err != nil {
+		t.Fatalf("MigrationStatuses: %v", err)
+	}
+	latest, _ := LatestSchemaVersion(db.Dialect)
+	if len(statuses) != latest {
+		t.Fatalf("got %d statuses, want %d", len(statuses), latest)
+	}
+	for _, s := range statuses {
+		if applied := s.AppliedAt != nil; applied != (s.Version <= 2) {
+			t.Errorf("migration %d applied = %v", s.Version, applied)
+		}
+	}
+}
+
+func TestCheckSchemaVersionRejectsNewerDatabase(t *testing.T) {
+	forEachDatabase(t, testCheckSchemaVersionRejectsNewerDatabase)
+}
+
+func testCheckSchemaVersionRejectsNewerDatabase(t *testing.T, db *sqldb.DB) {
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := CheckSchemaVersion(db); err != nil {
+		t.Fatalf("CheckSchemaVersion on current schema: %v", err)
+	}
+
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version, name) VALUES (9999, 'from_the_future')`); err != nil {
+		t.Fatalf("failed to record future migration: %v", err)
+	}
+	if err := CheckSchemaVersion(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("CheckSchemaVersion = %v, want ErrSchemaTooNew", err)
+	}
+	if _, err := Rollback(db, 1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Rollback of unknown migration = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestCheckSchemaCurrent(t *testing.T) {
+	forEachDatabase(t, testCheckSchemaCurrent)
+}
+
+func testCheckSchemaCurrent(t *testing.T, db *sqldb.DB) {
+	if _, err := MigrateTo(db, 1); err != nil {
+		t.Fatalf("MigrateTo: %v", err)
+	}
+	if err := CheckSchemaCurrent(db); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("CheckSchemaCurrent with pending migrations = %v, want ErrSchemaOutdated", err)
+	}
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := CheckSchemaCurrent(db); err != nil {
+		t.Fatalf("CheckSchemaCurrent on current schema: %v", err)
+	}
+}
+
+func TestMigrateAdoptsLegacyDatabase(t *testing.T) {
+	db := openTestDB(t)
+	legacy := []string{
+		`CREATE TABLE users (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			email TEXT UNIQUE NOT NULL,
+			username TEXT,
+			password TEXT NOT NULL,
+			is_admin BOOLEAN DEFAULT 0
+		)`,
+		`CREATE TABLE comments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			post_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE subverses (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			post_count INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`INSERT INTO users (email, password) VALUES ('a@example.com', 'x')`,
+		`INSERT INTO subverses (name, post_count) VALUES ('golang', 7)`,
+	}
+	for _, query := range legacy {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("failed to build legacy schema: %v", err)
+		}
+	}
+
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if !hasColumn(t, db, "users", "ip_address") || !hasColumn(t, db, "comments", "parent_id") {
+		t.Error("legacy columns were not added")
+	}
+	var users int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&users); err != nil || users != 1 {
+		t.Errorf("users = %d, %v", users, err)
+	}
+	var postCount int
+	if err := db.QueryRow(`SELECT post_count FROM subverses WHERE name = 'golang'`).Scan(&postCount); err != nil || postCount != 0 {
+		t.Errorf("post_count = %d, %v; want recount from posts", postCount, err)
+	}
+}
@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS hidden_posts;
+DROP TABLE IF EXISTS post_comments;
+DROP TABLE IF EXISTS post_votes;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS subverse_feeds;
+DROP TABLE IF EXISTS subverses;
+DROP TABLE IF EXISTS banned_ips;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS user_category_feeds;
+DROP TABLE IF EXISTS user_categories;
+DROP TABLE IF EXISTS reading_list;
+DROP TABLE IF EXISTS upvotes;
+DROP TABLE IF EXISTS feed_items;
+DROP TABLE IF EXISTS feed_sources;
+DROP TABLE IF EXISTS users;
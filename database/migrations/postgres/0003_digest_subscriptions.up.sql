@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+    user_id INTEGER PRIMARY KEY,
+    frequency TEXT NOT NULL DEFAULT 'off' CHECK(frequency IN ('off', 'daily', 'weekly')),
+    last_sent_at TIMESTAMPTZ,
+    unsubscribe_token TEXT UNIQUE NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
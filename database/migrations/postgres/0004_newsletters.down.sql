@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS newsletter_messages;
+DROP TABLE IF EXISTS newsletter_addresses;
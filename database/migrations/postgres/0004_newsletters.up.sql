@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS newsletter_addresses (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    local_part TEXT UNIQUE NOT NULL,
+    feed_source_id INTEGER NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS newsletter_messages (
+    item_id TEXT PRIMARY KEY,
+    address_id INTEGER NOT NULL,
+    from_address TEXT NOT NULL,
+    from_name TEXT,
+    subject TEXT,
+    html TEXT,
+    text TEXT,
+    received_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1 @@
+ALTER TABLE subverses DROP COLUMN IF EXISTS post_count;
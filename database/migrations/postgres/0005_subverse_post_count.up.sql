@@ -0,0 +1,4 @@
+ALTER TABLE subverses ADD COLUMN IF NOT EXISTS post_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE subverses s
+SET post_count = (SELECT COUNT(*) FROM posts p WHERE p.subverse_id = s.id);
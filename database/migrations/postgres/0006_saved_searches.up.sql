@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    seen_match_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS saved_search_matches (
+    id SERIAL PRIMARY KEY,
+    search_id INTEGER NOT NULL,
+    item_id TEXT NOT NULL,
+    matched_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(search_id, item_id)
+);
@@ -0,0 +1 @@
+ALTER TABLE feed_sources DROP COLUMN IF EXISTS disabled;
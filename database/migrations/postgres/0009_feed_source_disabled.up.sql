@@ -0,0 +1 @@
+ALTER TABLE feed_sources ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
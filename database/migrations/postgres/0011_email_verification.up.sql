@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;
+-- Accounts from before verification existed are trusted as they are
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS site_settings;
+DROP INDEX IF EXISTS idx_recovery_codes_user;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS two_factor;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_newsletter_messages_user;
+ALTER TABLE newsletter_messages DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1 @@
+ALTER TABLE feed_items DROP COLUMN IF EXISTS upstream_score;
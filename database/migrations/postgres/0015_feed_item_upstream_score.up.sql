@@ -0,0 +1,7 @@
+-- The score reported by the source, kept apart from local votes so that
+-- refreshing it leaves those votes in place
+ALTER TABLE feed_items ADD COLUMN IF NOT EXISTS upstream_score INTEGER NOT NULL DEFAULT 0;
+UPDATE feed_items
+SET upstream_score = COALESCE(score, 0) - COALESCE((SELECT SUM(CASE WHEN v.vote_type = 'upvote' THEN 1 ELSE -1 END)
+                                                    FROM upvotes v
+                                                    WHERE v.item_id = feed_items.id), 0);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+    user_id INTEGER PRIMARY KEY,
+    frequency TEXT NOT NULL DEFAULT 'off' CHECK(frequency IN ('off', 'daily', 'weekly')),
+    last_sent_at DATETIME,
+    unsubscribe_token TEXT UNIQUE NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS newsletter_addresses (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    local_part TEXT UNIQUE NOT NULL,
+    feed_source_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (feed_source_id) REFERENCES feed_sources(id)
+);
+
+CREATE TABLE IF NOT EXISTS newsletter_messages (
+    item_id TEXT PRIMARY KEY,
+    address_id INTEGER NOT NULL,
+    from_address TEXT NOT NULL,
+    from_name TEXT,
+    subject TEXT,
+    html TEXT,
+    text TEXT,
+    received_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (item_id) REFERENCES feed_items(id),
+    FOREIGN KEY (address_id) REFERENCES newsletter_addresses(id)
+);
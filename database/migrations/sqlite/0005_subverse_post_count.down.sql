@@ -0,0 +1,11 @@
+CREATE TABLE subverses_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO subverses_old (id, name, created_at)
+SELECT id, name, created_at FROM subverses;
+
+DROP TABLE subverses;
+ALTER TABLE subverses_old RENAME TO subverses;
@@ -0,0 +1,15 @@
+-- Rebuilds subverses with a post_count column. Some older databases already
+-- have the column, so the table is rebuilt rather than altered.
+CREATE TABLE subverses_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT UNIQUE NOT NULL,
+    post_count INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO subverses_new (id, name, post_count, created_at)
+SELECT s.id, s.name, (SELECT COUNT(*) FROM posts p WHERE p.subverse_id = s.id), s.created_at
+FROM subverses s;
+
+DROP TABLE subverses;
+ALTER TABLE subverses_new RENAME TO subverses;
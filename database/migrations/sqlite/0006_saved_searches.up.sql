@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    query TEXT NOT NULL,
+    seen_match_id INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS saved_search_matches (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    search_id INTEGER NOT NULL,
+    item_id TEXT NOT NULL,
+    matched_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(search_id, item_id),
+    FOREIGN KEY (search_id) REFERENCES saved_searches(id),
+    FOREIGN KEY (item_id) REFERENCES feed_items(id)
+);
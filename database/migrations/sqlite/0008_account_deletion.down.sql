@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN deleted_at;
+ALTER TABLE users DROP COLUMN deletion_scheduled_at;
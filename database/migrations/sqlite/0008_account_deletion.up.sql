@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN deletion_scheduled_at DATETIME;
+ALTER TABLE users ADD COLUMN deleted_at DATETIME;
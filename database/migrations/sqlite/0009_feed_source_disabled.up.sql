@@ -0,0 +1 @@
+ALTER TABLE feed_sources ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- Newsletters are private to whoever owns the address they were sent to,
+-- and stay theirs after the address is deleted
+ALTER TABLE newsletter_messages ADD COLUMN user_id INTEGER;
+UPDATE newsletter_messages SET user_id = (SELECT user_id FROM newsletter_addresses WHERE id = newsletter_messages.address_id);
+
+CREATE INDEX IF NOT EXISTS idx_newsletter_messages_user ON newsletter_messages(user_id);
@@ -0,0 +1 @@
+ALTER TABLE feed_items DROP COLUMN upstream_score;
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+// Creates an inbound newsletter address along with the feed source its mail is filed under.
+//
+// Feed source names are unique, so the local part is appended to the name if it is already taken.
+func CreateNewsletterAddress(db *sqldb.DB, userID int, name, localPart string) (*models.NewsletterAddress, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sourceName := name
+	var exists int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM feed_sources WHERE name = ?`, sourceName).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check feed source name: %w", err)
+	}
+	if exists > 0 {
+		sourceName = fmt.Sprintf("%s (%s)", name, localPart)
+	}
+
+	var sourceID int
+	err = tx.QueryRow(`INSERT INTO feed_sources (name, url, last_updated, update_interval)
+	                   VALUES (?, ?, CURRENT_TIMESTAMP, ?) RETURNING id`, sourceName, feeds.NewsletterURLPrefix+localPart, feeds.DefaultUpdateInterval).Scan(&sourceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create newsletter feed source: %w", err)
+	}
+
+	var id int
+	err = tx.QueryRow(`INSERT INTO newsletter_addresses (user_id, name, local_part, feed_source_id) VALUES (?, ?, ?, ?) RETURNING id`,
+		userID, name, localPart, sourceID).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create newsletter address: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetNewsletterAddressByID(db, id)
+}
+
+// Scans a newsletter address row
+func scanNewsletterAddress(row interface{ Scan(...any) error }) (*models.NewsletterAddress, error) {
+	var addr models.NewsletterAddress
+	err := row.Scan(&addr.ID, &addr.UserID, &addr.Name, &addr.LocalPart, &addr.FeedSourceID, &addr.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &addr, nil
+}
+
+const newsletterAddressColumns = `id, user_id, name, local_part, feed_source_id, created_at`
+
+// Retrieves a newsletter address by ID
+func GetNewsletterAddressByID(db *sqldb.DB, id int) (*models.NewsletterAddress, error) {
+	query := `SELECT ` + newsletterAddressColumns + ` FROM newsletter_addresses WHERE id = ?`
+	return scanNewsletterAddress(db.QueryRow(query, id))
+}
+
+// Retrieves the newsletter address with the given local part
+func GetNewsletterAddressByLocalPart(db *sqldb.DB, localPart string) (*models.NewsletterAddress, error) {
+	query := `SELECT ` + newsletterAddressColumns + ` FROM newsletter_addresses WHERE local_part = ?`
+	return scanNewsletterAddress(db.QueryRow(query, localPart))
+}
+
+// Retrieves all newsletter addresses for a user
+func GetUserNewsletterAddresses(db *sqldb.DB, userID int) ([]models.NewsletterAddress, error) {
+	query := `SELECT ` + newsletterAddressColumns + ` FROM newsletter_addresses WHERE user_id = ? ORDER BY name`
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get newsletter addresses: %w", err)
+	}
+	defer rows.Close()
+
+	var addrs []models.NewsletterAddress
+	for rows.Next() {
+		addr, err := scanNewsletterAddress(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan newsletter address: %w", err)
+		}
+		addrs = append(addrs, *addr)
+	}
+	return addrs, nil
+}
+
+// Deletes a user's newsletter address so it stops accepting mail.
+//
+// The feed source and items already received are kept, so categories holding it are unaffected.
+func DeleteNewsletterAddress(db *sqldb.DB, userID, id int) error {
+	result, err := db.Exec(`DELETE FROM newsletter_addresses WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete newsletter address: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Stores the full body of a received newsletter
+func SaveNewsletterMessage(db *sqldb.DB, msg models.NewsletterMessage) error {
+	_, err := db.Exec(`INSERT INTO newsletter_messages (item_id, address_id, user_id, from_address, from_name, subject, html, text, received_at)
+	                   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	                   ON CONFLICT(item_id) DO NOTHING`,
+		msg.ItemID, msg.AddressID, msg.UserID, msg.FromAddress, msg.FromName, msg.Subject, msg.HTML, msg.Text, msg.ReceivedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to save newsletter message: %w", err)
+	}
+	return nil
+}
+
+// Retrieves the body of the newsletter filed as the given feed item, or
+// sql.ErrNoRows unless it was sent to the user
+func GetNewsletterMessage(db *sqldb.DB, userID int, itemID string) (*models.NewsletterMessage, error) {
+	query := `SELECT item_id, address_id, COALESCE(user_id, 0), from_address, COALESCE(from_name, ''), COALESCE(subject, ''),
+	                 COALESCE(html, ''), COALESCE(text, ''), received_at
+	          FROM newsletter_messages WHERE item_id = ? AND user_id = ?`
+
+	var msg models.NewsletterMessage
+	err := db.QueryRow(query, itemID, userID).Scan(&msg.ItemID, &msg.AddressID, &msg.UserID, &msg.FromAddress, &msg.FromName,
+		&msg.Subject, &msg.HTML, &msg.Text, &msg.ReceivedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+// Records a password reset token for a user. Only the token's hash is
+// stored, so the database alone cannot be used to reset passwords.
+func CreatePasswordReset(db *sqldb.DB, userID int, tokenHash, ipAddress string, expiresAt time.Time) error {
+	_, err := db.Exec(`INSERT INTO password_resets (user_id, token_hash, ip_address, expires_at) VALUES (?, ?, ?, ?)`,
+		userID, tokenHash, ipAddress, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create password reset: %w", err)
+	}
+	return nil
+}
+
+// Returns the user an unused, unexpired reset token belongs to, or
+// sql.ErrNoRows if there is no such token
+func GetPasswordResetUser(db *sqldb.DB, tokenHash string, now time.Time) (int, error) {
+	var userID int
+	err := db.QueryRow(`SELECT r.user_id FROM password_resets r
+	                    JOIN users u ON u.id = r.user_id
+	                    WHERE r.token_hash = ? AND r.used_at IS NULL AND r.expires_at > ? AND u.deleted_at IS NULL`,
+		tokenHash, now.UTC()).Scan(&userID)
+	return userID, err
+}
+
+// Uses up a reset token, along with every other token its user has, and
+// returns the user it belongs to. Fails with sql.ErrNoRows if the token was
+// used or expired in the meantime.
+func UsePasswordReset(db *sqldb.DB, tokenHash string, now time.Time) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`UPDATE password_resets SET used_at = ?
+	                   WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+	                   RETURNING user_id`, now.UTC(), tokenHash, now.UTC()).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`, now.UTC(), userID); err != nil {
+		return 0, fmt.Errorf("failed to use up other password resets: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// Deletes the reset tokens that expired before the given time
+func DeleteExpiredPasswordResets(db *sqldb.DB, before time.Time) error {
+	if _, err := db.Exec(`DELETE FROM password_resets WHERE expires_at < ?`, before.UTC()); err != nil {
+		return fmt.Errorf("failed to delete expired password resets: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+func TestPasswordResets(t *testing.T) {
+	forEachDatabase(t, testPasswordResets)
+}
+
+func testPasswordResets(t *testing.T, db *sqldb.DB) {
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := CreateUser(db, "reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := GetUserByEmail(db, "reader@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, hash := range []string{"first", "second"} {
+		if err := CreatePasswordReset(db, user.ID, hash, "10.0.0.1", now.Add(time.Hour)); err != nil {
+			t.Fatalf("CreatePasswordReset: %v", err)
+		}
+	}
+	if err := CreatePasswordReset(db, user.ID, "stale", "", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("CreatePasswordReset: %v", err)
+	}
+
+	if id, err := GetPasswordResetUser(db, "first", now); err != nil || id != user.ID {
+		t.Errorf("GetPasswordResetUser = %d, %v, want %d", id, err, user.ID)
+	}
+	if _, err := GetPasswordResetUser(db, "stale", now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetPasswordResetUser for an expired token = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := GetPasswordResetUser(db, "first", now.Add(2*time.Hour)); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetPasswordResetUser after expiry = %v, want sql.ErrNoRows", err)
+	}
+
+	if id, err := UsePasswordReset(db, "first", now); err != nil || id != user.ID {
+		t.Fatalf("UsePasswordReset = %d, %v, want %d", id, err, user.ID)
+	}
+	for _, hash := range []string{"first", "second"} {
+		if _, err := UsePasswordReset(db, hash, now); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UsePasswordReset(%s) after a reset = %v, want sql.ErrNoRows", hash, err)
+		}
+	}
+
+	if err := DeleteExpiredPasswordResets(db, now); err != nil {
+		t.Fatalf("DeleteExpiredPasswordResets: %v", err)
+	}
+	var left int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM password_resets`).Scan(&left); err != nil {
+		t.Fatal(err)
+	}
+	if left != 2 {
+		t.Errorf("%d password resets left, want the 2 unexpired ones", left)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
 )
 
 // Build reading list query using Squirrel for feed items
@@ -43,7 +45,7 @@ var PostReadingListQueryBuilder = squirrel.Select(
 	OrderBy("rl.created_at DESC")
 
 // Retrieve feed items from reading list.
-func RetrieveFeedReadingList(userID int) (*sql.Rows, error) {
+func RetrieveFeedReadingList(db *sqldb.DB, userID int) (*sql.Rows, error) {
 	sqlQuery, args, err := FeedReadingListQueryBuilder.Where(
 		squirrel.Eq{"rl.user_id": userID},
 	).ToSql()
@@ -52,12 +54,12 @@ func RetrieveFeedReadingList(userID int) (*sql.Rows, error) {
 		return nil, err
 	}
 
-	rows, err := GetDB().Query(sqlQuery, args...)
+	rows, err := db.Query(sqlQuery, args...)
 	return rows, err
 }
 
 // Retrieve posts from reading list.
-func RetrievePostReadingList(userID int) (*sql.Rows, error) {
+func RetrievePostReadingList(db *sqldb.DB, userID int) (*sql.Rows, error) {
 	sqlQuery, args, err := PostReadingListQueryBuilder.Where(
 		squirrel.Eq{"rl.user_id": userID},
 	).ToSql()
@@ -66,12 +68,12 @@ func RetrievePostReadingList(userID int) (*sql.Rows, error) {
 		return nil, err
 	}
 
-	rows, err := GetDB().Query(sqlQuery, args...)
+	rows, err := db.Query(sqlQuery, args...)
 	return rows, err
 }
 
 // Retrieve combined reading list (feed items + posts).
-func RetrieveReadingList(userID int) (*sql.Rows, error) {
+func RetrieveReadingList(db *sqldb.DB, userID int) (*sql.Rows, error) {
 	query := `
 		SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author,
 		       fi.published_at, fi.score,
@@ -106,8 +108,17 @@ func RetrieveReadingList(userID int) (*sql.Rows, error) {
 		ORDER BY 10 DESC
 	`
 
-	rows, err := GetDB().Query(query, userID)
+	rows, err := db.Query(query, userID)
 	return rows, err
 }
 
-var SubverseQuery = "SELECT id, name, created_at FROM subverses WHERE id = ?"
+// Gets the combined reading list as feed items, newest first
+//
+// Saved subverse posts are returned with source "Subverse Post".
+func GetReadingList(db *sqldb.DB, userID int) ([]feeds.FeedItem, error) {
+	rows, err := RetrieveReadingList(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanFeedItems(rows)
+}
@@ -3,11 +3,10 @@ package database
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/navid-m/versed/database/sqldb"
 	"github.com/navid-m/versed/models"
 )
 
@@ -17,46 +16,32 @@ func generateUUID() string {
 }
 
 // Creates some post in a subverse
-func CreatePost(db *sql.DB, subverseID, userID int, username, title, content, postType, url string) (*models.Post, error) {
-	log.Printf("CreatePost called with subverseID=%d, userID=%d, username='%s', title='%s', postType='%s', url='%s', content length=%d",
-		subverseID, userID, username, title, postType, url, len(content))
-
+func CreatePost(db *sqldb.DB, subverseID, userID int, username, title, content, postType, url string) (*models.Post, error) {
 	if postType != "text" && postType != "link" {
-		log.Printf("CreatePost error: invalid post type '%s'", postType)
 		return nil, fmt.Errorf("invalid post type: must be 'text' or 'link'")
 	}
 
 	if postType == "link" && url == "" {
-		log.Printf("CreatePost error: URL is required for link posts")
 		return nil, fmt.Errorf("URL is required for link posts")
 	}
 
 	if postType == "text" && content == "" {
-		log.Printf("CreatePost error: content is required for text posts")
 		return nil, fmt.Errorf("content is required for text posts")
 	}
 
 	postID := generateUUID()
-	log.Printf("Generated post ID: %s", postID)
 
 	query := `INSERT INTO posts (id, subverse_id, user_id, title, content, post_type, url, score, created_at, updated_at)
 	          VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?)`
 
 	now := time.Now()
 	nowStr := now.Format("2006-01-02 15:04:05")
-	log.Printf("Executing INSERT query with values: id=%s, subverse_id=%d, user_id=%d, title='%s', post_type='%s', timestamp=%s",
-		postID, subverseID, userID, title, postType, nowStr)
-
 	_, err := db.Exec(query, postID, subverseID, userID, title, content, postType, url, nowStr, nowStr)
 	if err != nil {
-		log.Printf("CreatePost database error: %v", err)
-		log.Printf("Failed query: %s", query)
-		log.Printf("Parameters: postID=%s, subverseID=%d, userID=%d, title='%s', content='%s', postType='%s', url='%s'",
-			postID, subverseID, userID, title, content, postType, url)
 		return nil, fmt.Errorf("failed to create post: %w", err)
 	}
 
-	log.Printf("Successfully created post with ID: %s", postID)
+	logger.Debug("Created post", "post_id", postID, "subverse_id", subverseID, "user_id", userID, "post_type", postType)
 
 	post := &models.Post{
 		ID:         postID,
@@ -76,7 +61,7 @@ func CreatePost(db *sql.DB, subverseID, userID int, username, title, content, po
 }
 
 // Retrieves a post by its ID
-func GetPostByID(db *sql.DB, postID string) (*models.Post, error) {
+func GetPostByID(db *sqldb.DB, postID string) (*models.Post, error) {
 	query := `SELECT p.id, p.subverse_id, p.user_id, u.username, p.title, p.content, p.post_type, p.url, p.score, p.created_at, p.updated_at
 	          FROM posts p
 	          JOIN users u ON p.user_id = u.id
@@ -104,7 +89,7 @@ func GetPostByID(db *sql.DB, postID string) (*models.Post, error) {
 }
 
 // Retrieves posts for a specific subverse
-func GetPostsBySubverse(db *sql.DB, subverseID int, limit, offset int) ([]models.Post, error) {
+func GetPostsBySubverse(db *sqldb.DB, subverseID int, limit, offset int) ([]models.Post, error) {
 	query := `SELECT p.id, p.subverse_id, p.user_id, u.username, p.title, p.content, p.post_type, p.url, p.score, p.created_at, p.updated_at
 	          FROM posts p
 	          JOIN users u ON p.user_id = u.id
@@ -137,13 +122,11 @@ func GetPostsBySubverse(db *sql.DB, subverseID int, limit, offset int) ([]models
 		posts = append(posts, post)
 	}
 
-	log.Printf("GetPostsBySubverse: returning %d posts", len(posts))
-
 	return posts, nil
 }
 
 // Updates a post's title and content
-func UpdatePost(db *sql.DB, postID string, userID int, title, content string) error {
+func UpdatePost(db *sqldb.DB, postID string, userID int, title, content string) error {
 	query := `UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE id = ? AND user_id = ?`
 	result, err := db.Exec(query, title, content, time.Now(), postID, userID)
 	if err != nil {
@@ -163,7 +146,7 @@ func UpdatePost(db *sql.DB, postID string, userID int, title, content string) er
 }
 
 // Deletes a post and all its comments
-func DeletePost(db *sql.DB, postID string, userID int) error {
+func DeletePost(db *sqldb.DB, postID string, userID int) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -193,47 +176,26 @@ func DeletePost(db *sql.DB, postID string, userID int) error {
 }
 
 // Creates a new comment on a post
-func CreatePostComment(db *sql.DB, postID string, userID int, username, content string, parentID *string) (*models.PostComment, error) {
-	log.Printf("CreatePostComment called with postID='%s', userID=%d, username='%s', content='%s', parentID=%v", postID, userID, username, content, parentID)
-
+func CreatePostComment(db *sqldb.DB, postID string, userID int, username, content string, parentID *string) (*models.PostComment, error) {
 	now := time.Now()
 
 	query := `INSERT INTO post_comments (post_id, user_id, username, content, created_at, updated_at)
-	          VALUES (?, ?, ?, ?, ?, ?)`
-
-	log.Printf("Executing query: %s with params: postID=%s, userID=%d, username=%s, content=%s", query, postID, userID, username, content)
+	          VALUES (?, ?, ?, ?, ?, ?)
+	          RETURNING id`
 
-	result, err := db.Exec(query, postID, userID, username, content, now, now)
+	var commentIDInt int64
+	err := db.QueryRow(query, postID, userID, username, content, now, now).Scan(&commentIDInt)
 	if err != nil {
-		log.Printf("Failed to insert comment: %v", err)
 		return nil, fmt.Errorf("failed to create comment: %w", err)
 	}
 
-	commentIDInt, err := result.LastInsertId()
-	if err != nil {
-		log.Printf("Failed to get comment ID: %v", err)
-		return nil, fmt.Errorf("failed to get comment ID: %w", err)
-	}
-
 	commentID := fmt.Sprintf("%d", commentIDInt)
-	log.Printf("Created comment with ID: %s", commentID)
-
-	if parentID != nil {
-		log.Printf("ParentID is not nil, value: '%s'", *parentID)
-		if *parentID != "" && *parentID != "undefined" && *parentID != "null" {
-			log.Printf("Updating parent_id to: %s", *parentID)
-			updateQuery := `UPDATE post_comments SET parent_id = ? WHERE id = ?`
-			_, err = db.Exec(updateQuery, *parentID, commentID)
-			if err != nil {
-				log.Printf("Failed to update parent_id: %v", err)
-			} else {
-				log.Printf("Successfully updated parent_id")
-			}
-		} else {
-			log.Printf("ParentID is empty string or invalid (%s), skipping update", *parentID)
+
+	if parentID != nil && *parentID != "" && *parentID != "undefined" && *parentID != "null" {
+		updateQuery := `UPDATE post_comments SET parent_id = ? WHERE id = ?`
+		if _, err := db.Exec(updateQuery, *parentID, commentID); err != nil {
+			logger.Error("Failed to set comment parent", "comment_id", commentID, "parent_id", *parentID, "err", err)
 		}
-	} else {
-		log.Printf("ParentID is nil")
 	}
 
 	comment := &models.PostComment{
@@ -247,12 +209,12 @@ func CreatePostComment(db *sql.DB, postID string, userID int, username, content
 		UpdatedAt: now,
 	}
 
-	log.Printf("Successfully created comment: %+v", comment)
+	logger.Debug("Created post comment", "comment_id", commentID, "post_id", postID, "user_id", userID)
 	return comment, nil
 }
 
 // GetPostComments retrieves comments for a specific post
-func GetPostComments(db *sql.DB, postID string) ([]models.PostComment, error) {
+func GetPostComments(db *sqldb.DB, postID string) ([]models.PostComment, error) {
 	query := `SELECT id, post_id, user_id, username, content, parent_id, created_at, updated_at
 	          FROM post_comments
 	          WHERE post_id = ?
@@ -283,38 +245,29 @@ func GetPostComments(db *sql.DB, postID string) ([]models.PostComment, error) {
 		}
 
 		comment.Replies = []models.PostComment{}
-		log.Printf("DEBUG: Loaded comment ID=%s, ParentID=%v", comment.ID, comment.ParentID)
 		commentMap[comment.ID] = &comment
 	}
 
 	var rootComments []models.PostComment
-	log.Printf("DEBUG: Starting hierarchy building, total comments: %d", len(commentMap))
 	for _, comment := range commentMap {
 		if comment.ParentID == nil {
-			log.Printf("DEBUG: Adding root comment ID=%s", comment.ID)
 			rootComments = append(rootComments, *comment)
 		} else {
 			if parent, exists := commentMap[*comment.ParentID]; exists {
-				log.Printf("DEBUG: Adding reply ID=%s to parent ID=%s", comment.ID, *comment.ParentID)
 				parent.Replies = append(parent.Replies, *comment)
 			} else {
 				// Parent doesn't exist, treat as root comment
-				log.Printf("Warning: Comment %s has parent_id %s but parent not found, treating as root comment", comment.ID, *comment.ParentID)
+				logger.Warn("Comment's parent not found, treating it as a root comment", "comment_id", comment.ID, "parent_id", *comment.ParentID)
 				rootComments = append(rootComments, *comment)
 			}
 		}
 	}
 
-	log.Printf("DEBUG: Returning %d root comments", len(rootComments))
-	for i, rootComment := range rootComments {
-		log.Printf("DEBUG: Root comment %d: ID=%s, Replies=%d", i+1, rootComment.ID, len(rootComment.Replies))
-	}
-
 	return rootComments, nil
 }
 
 // UpdatePostComment updates a comment's content
-func UpdatePostComment(db *sql.DB, commentID string, userID int, content string) error {
+func UpdatePostComment(db *sqldb.DB, commentID string, userID int, content string) error {
 	query := `UPDATE post_comments SET content = ?, updated_at = ? WHERE id = ? AND user_id = ?`
 	result, err := db.Exec(query, content, time.Now(), commentID, userID)
 	if err != nil {
@@ -334,7 +287,7 @@ func UpdatePostComment(db *sql.DB, commentID string, userID int, content string)
 }
 
 // DeletePostComment deletes a comment and all its replies
-func DeletePostComment(db *sql.DB, commentID string, userID int) error {
+func DeletePostComment(db *sqldb.DB, commentID string, userID int) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -364,7 +317,7 @@ func DeletePostComment(db *sql.DB, commentID string, userID int) error {
 }
 
 // VoteOnPost creates or updates a vote on a post and updates the post score
-func VoteOnPost(db *sql.DB, userID int, postID string, voteType string) error {
+func VoteOnPost(db *sqldb.DB, userID int, postID string, voteType string) error {
 	if voteType != "upvote" && voteType != "downvote" {
 		return fmt.Errorf("invalid vote type: must be 'upvote' or 'downvote'")
 	}
@@ -412,7 +365,7 @@ func VoteOnPost(db *sql.DB, userID int, postID string, voteType string) error {
 }
 
 // GetUserVoteOnPost gets the user's current vote on a specific post (if any)
-func GetUserVoteOnPost(db *sql.DB, userID int, postID string) (string, error) {
+func GetUserVoteOnPost(db *sqldb.DB, userID int, postID string) (string, error) {
 	var voteType string
 	err := db.QueryRow("SELECT vote_type FROM post_votes WHERE user_id = ? AND post_id = ?", userID, postID).Scan(&voteType)
 	if err != nil {
@@ -425,7 +378,7 @@ func GetUserVoteOnPost(db *sql.DB, userID int, postID string) (string, error) {
 }
 
 // updatePostScore recalculates and updates the score for a post based on votes
-func updatePostScore(tx *sql.Tx, postID string) error {
+func updatePostScore(tx *sqldb.Tx, postID string) error {
 	var upvotes, downvotes int
 
 	err := tx.QueryRow("SELECT COUNT(*) FROM post_votes WHERE post_id = ? AND vote_type = 'upvote'", postID).Scan(&upvotes)
@@ -447,45 +400,3 @@ func updatePostScore(tx *sql.Tx, postID string) error {
 
 	return nil
 }
-
-// Searches for posts within a specific subverse
-func SearchPostsBySubverse(db *sql.DB, subverseID int, query string, limit, offset int) ([]models.Post, error) {
-	if strings.TrimSpace(query) == "" {
-		return GetPostsBySubverse(db, subverseID, limit, offset)
-	}
-
-	searchQuery := `SELECT p.id, p.subverse_id, p.user_id, u.username, p.title, p.content, p.post_type, p.url, p.score, p.created_at, p.updated_at
-	               FROM posts p
-	               JOIN users u ON p.user_id = u.id
-	               WHERE p.subverse_id = ? AND (p.title LIKE ? OR p.content LIKE ?)
-	               ORDER BY p.created_at DESC
-	               LIMIT ? OFFSET ?`
-
-	searchPattern := "%" + query + "%"
-	rows, err := db.Query(searchQuery, subverseID, searchPattern, searchPattern, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to search posts: %w", err)
-	}
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var content, url sql.NullString
-		err := rows.Scan(
-			&post.ID, &post.SubverseID, &post.UserID, &post.Username,
-			&post.Title, &content, &post.PostType, &url, &post.Score,
-			&post.CreatedAt, &post.UpdatedAt,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan post: %w", err)
-		}
-
-		post.Content = content.String
-		post.URL = url.String
-
-		posts = append(posts, post)
-	}
-
-	return posts, nil
-}
@@ -0,0 +1,599 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/search"
+)
+
+// Returns repositories backed by the given database
+func NewRepositories(db *sqldb.DB) repository.Repositories {
+	return repository.Repositories{
+		FeedItems:        feedItemRepo{db},
+		Sources:          sourceRepo{db},
+		Users:            userRepo{db},
+		Categories:       categoryRepo{db},
+		Comments:         commentRepo{db},
+		Posts:            postRepo{db},
+		Subverses:        subverseRepo{db},
+		SavedSearches:    savedSearchRepo{db},
+		Search:           searchRepo{db},
+		Bans:             banRepo{db},
+		Sessions:         NewDBSessionStorage(db),
+		TwoFactor:        twoFactorRepo{db},
+		APITokens:        apiTokenRepo{db},
+		Webhooks:         webhookRepo{db},
+		Digests:          digestRepo{db},
+		Newsletters:      newsletterRepo{db},
+		ResetTokens:      resetTokenRepo{db},
+		AccountDeletions: accountDeletionRepo{db},
+		DataExports:      dataExportRepo{db},
+	}
+}
+
+// Translates a missing row into repository.ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrNotFound
+	}
+	return err
+}
+
+type feedItemRepo struct{ db *sqldb.DB }
+
+func (r feedItemRepo) Latest(userID, limit, offset int) ([]feeds.FeedItem, error) {
+	if userID != 0 {
+		return feeds.GetAllFeedItemsWithPaginationForUser(r.db, userID, limit, offset)
+	}
+	return feeds.GetAllFeedItemsWithPagination(r.db, limit, offset)
+}
+
+func (r feedItemRepo) BySource(sourceID, limit int) ([]feeds.FeedItem, error) {
+	return feeds.GetFeedItemsBySource(r.db, sourceID, limit)
+}
+
+func (r feedItemRepo) ByID(itemID string) (*feeds.FeedItem, error) {
+	item, err := GetFeedItemByID(r.db, itemID)
+	return item, notFound(err)
+}
+
+func (r feedItemRepo) ForCategory(userID, categoryID, limit int) ([]feeds.FeedItem, error) {
+	return GetCategoryFeedItems(r.db, userID, categoryID, limit)
+}
+
+func (r feedItemRepo) Search(query *search.Query, limit, offset int) ([]feeds.FeedItem, error) {
+	return SearchFeedItems(r.db, query, limit, offset)
+}
+
+func (r feedItemRepo) Save(items []feeds.FeedItem) error {
+	return feeds.SaveFeedItems(r.db, items)
+}
+
+func (r feedItemRepo) Vote(userID int, itemID, voteType string) (int, error) {
+	return feeds.HandleVote(r.db, itemID, userID, voteType)
+}
+
+type sourceRepo struct{ db *sqldb.DB }
+
+func (r sourceRepo) ByID(id int) (*feeds.FeedSource, error) {
+	source, err := feeds.GetFeedSourceByID(r.db, id)
+	return source, notFound(err)
+}
+
+func (r sourceRepo) ByName(name string) (*feeds.FeedSource, error) {
+	source, err := feeds.GetFeedSourceByName(r.db, name)
+	return source, notFound(err)
+}
+
+func (r sourceRepo) CreateOrUpdate(name, url string) (*feeds.FeedSource, error) {
+	return feeds.CreateOrUpdateFeedSource(r.db, name, url)
+}
+
+func (r sourceRepo) All() ([]feeds.FeedSource, error) {
+	return feeds.GetAllFeedSources(r.db)
+}
+
+func (r sourceRepo) MarkUpdated(id int) error {
+	return feeds.UpdateFeedSourceTimestamp(r.db, id)
+}
+
+func (r sourceRepo) ResetForCategory(userID, categoryID int) (int64, error) {
+	return ResetCategoryFeedTimestamps(r.db, userID, categoryID)
+}
+
+type userRepo struct{ db *sqldb.DB }
+
+func (r userRepo) Create(email, username, password, ipAddress string) error {
+	return CreateUser(r.db, email, username, password, ipAddress)
+}
+
+func (r userRepo) ByID(userID int) (*models.User, error) {
+	user, err := GetUserByID(r.db, userID)
+	return user, notFound(err)
+}
+
+func (r userRepo) ByEmail(email string) (*models.User, error) {
+	user, err := GetUserByEmail(r.db, email)
+	return user, notFound(err)
+}
+
+func (r userRepo) Update(userID int, email, username, password string) error {
+	return UpdateUser(r.db, userID, email, username, password)
+}
+
+func (r userRepo) SetPendingEmail(userID int, email string) error {
+	return notFound(SetPendingEmail(r.db, userID, email))
+}
+
+func (r userRepo) ConfirmEmail(userID int, email string) error {
+	return notFound(ConfirmUserEmail(r.db, userID, email, time.Now()))
+}
+
+func (r userRepo) All() ([]models.User, error) {
+	return GetAllUsers(r.db)
+}
+
+func (r userRepo) IsAdmin(userID int) (bool, error) {
+	return IsUserAdmin(r.db, userID)
+}
+
+func (r userRepo) SaveToReadingList(userID int, itemID string) (bool, error) {
+	return SaveToReadingList(r.db, userID, itemID)
+}
+
+func (r userRepo) RemoveFromReadingList(userID int, itemID string) error {
+	return RemoveFromReadingList(r.db, userID, itemID)
+}
+
+func (r userRepo) IsInReadingList(userID int, itemID string) (bool, error) {
+	return IsInReadingList(r.db, userID, itemID)
+}
+
+func (r userRepo) ReadingList(userID int) ([]feeds.FeedItem, error) {
+	return GetReadingList(r.db, userID)
+}
+
+func (r userRepo) Hide(userID int, itemID string) error {
+	return HideFeedItem(r.db, userID, itemID)
+}
+
+func (r userRepo) Unhide(userID int, itemID string) error {
+	return UnhideFeedItem(r.db, userID, itemID)
+}
+
+func (r userRepo) IsHidden(userID int, itemID string) (bool, error) {
+	return IsFeedItemHidden(r.db, userID, itemID)
+}
+
+func (r userRepo) HiddenIDs(userID int) ([]string, error) {
+	return GetHiddenFeedItems(r.db, userID)
+}
+
+type categoryRepo struct{ db *sqldb.DB }
+
+func (r categoryRepo) Create(userID int, name, description string) (*models.UserCategory, error) {
+	return CreateUserCategory(r.db, userID, name, description)
+}
+
+func (r categoryRepo) List(userID int) ([]models.UserCategory, error) {
+	return GetUserCategories(r.db, userID)
+}
+
+func (r categoryRepo) ByID(userID, categoryID int) (*models.UserCategory, error) {
+	category, err := GetUserCategoryByID(r.db, userID, categoryID)
+	return category, notFound(err)
+}
+
+func (r categoryRepo) ByName(userID int, name string) (*models.UserCategory, error) {
+	category, err := GetUserCategoryByName(r.db, userID, name)
+	return category, notFound(err)
+}
+
+func (r categoryRepo) Update(userID, categoryID int, name, description string) error {
+	return UpdateUserCategory(r.db, userID, categoryID, name, description)
+}
+
+func (r categoryRepo) Delete(userID, categoryID int) error {
+	return DeleteUserCategory(r.db, userID, categoryID)
+}
+
+func (r categoryRepo) AddFeed(userID, categoryID, feedSourceID int) error {
+	return AddFeedToUserCategory(r.db, userID, categoryID, feedSourceID)
+}
+
+func (r categoryRepo) RemoveFeed(userID, categoryID, feedSourceID int) error {
+	return RemoveFeedFromUserCategory(r.db, userID, categoryID, feedSourceID)
+}
+
+func (r categoryRepo) Feeds(userID, categoryID int) ([]feeds.FeedSource, error) {
+	return GetFeedsInUserCategory(r.db, userID, categoryID)
+}
+
+type commentRepo struct{ db *sqldb.DB }
+
+func (r commentRepo) Create(itemID string, userID int, username, content string, parentID *int) (*models.Comment, error) {
+	return CreateComment(r.db, itemID, userID, username, content, parentID)
+}
+
+func (r commentRepo) ForItem(itemID string) ([]models.Comment, error) {
+	return GetCommentsByItemID(r.db, itemID)
+}
+
+func (r commentRepo) ByID(commentID int) (*models.Comment, error) {
+	comment, err := GetCommentByID(r.db, commentID)
+	return comment, notFound(err)
+}
+
+func (r commentRepo) Search(query string, limit, offset int) ([]models.Comment, error) {
+	return SearchComments(r.db, query, limit, offset)
+}
+
+func (r commentRepo) Update(commentID int, content string) error {
+	return UpdateComment(r.db, commentID, content)
+}
+
+func (r commentRepo) Delete(commentID int) error {
+	return notFound(DeleteComment(r.db, commentID))
+}
+
+type postRepo struct{ db *sqldb.DB }
+
+func (r postRepo) Create(subverseID, userID int, username, title, content, postType, url string) (*models.Post, error) {
+	return CreatePost(r.db, subverseID, userID, username, title, content, postType, url)
+}
+
+func (r postRepo) ByID(postID string) (*models.Post, error) {
+	post, err := GetPostByID(r.db, postID)
+	return post, notFound(err)
+}
+
+func (r postRepo) ForSubverse(subverseID, limit, offset int) ([]models.Post, error) {
+	return GetPostsBySubverse(r.db, subverseID, limit, offset)
+}
+
+func (r postRepo) Search(subverseID int, query string, limit, offset int) ([]models.Post, error) {
+	return SearchPostsBySubverse(r.db, subverseID, query, limit, offset)
+}
+
+func (r postRepo) Update(postID string, userID int, title, content string) error {
+	return UpdatePost(r.db, postID, userID, title, content)
+}
+
+func (r postRepo) Delete(postID string, userID int) error {
+	return DeletePost(r.db, postID, userID)
+}
+
+func (r postRepo) Vote(userID int, postID, voteType string) error {
+	return VoteOnPost(r.db, userID, postID, voteType)
+}
+
+func (r postRepo) CreateComment(postID string, userID int, username, content string, parentID *string) (*models.PostComment, error) {
+	return CreatePostComment(r.db, postID, userID, username, content, parentID)
+}
+
+func (r postRepo) Comments(postID string) ([]models.PostComment, error) {
+	return GetPostComments(r.db, postID)
+}
+
+func (r postRepo) UpdateComment(commentID string, userID int, content string) error {
+	return UpdatePostComment(r.db, commentID, userID, content)
+}
+
+func (r postRepo) DeleteComment(commentID string, userID int) error {
+	return DeletePostComment(r.db, commentID, userID)
+}
+
+type subverseRepo struct{ db *sqldb.DB }
+
+func (r subverseRepo) Create(name string) (*models.Subverse, error) {
+	return CreateSubverse(r.db, name)
+}
+
+func (r subverseRepo) List() ([]models.Subverse, error) {
+	return GetSubverses(r.db)
+}
+
+func (r subverseRepo) ByID(id int) (*models.Subverse, error) {
+	subverse, err := GetSubverseByID(r.db, id)
+	return subverse, notFound(err)
+}
+
+func (r subverseRepo) ByName(name string) (*models.Subverse, error) {
+	subverse, err := GetSubverseByName(r.db, name)
+	return subverse, notFound(err)
+}
+
+func (r subverseRepo) AddFeed(subverseID, feedSourceID int) error {
+	return AddFeedToSubverse(r.db, subverseID, feedSourceID)
+}
+
+func (r subverseRepo) RemoveFeed(subverseID, feedSourceID int) error {
+	return RemoveFeedFromSubverse(r.db, subverseID, feedSourceID)
+}
+
+func (r subverseRepo) Feeds(subverseID int) ([]feeds.FeedSource, error) {
+	return GetSubverseFeeds(r.db, subverseID)
+}
+
+func (r subverseRepo) UpdatePostCount(subverseID int) error {
+	return UpdateSubversePostCount(r.db, subverseID)
+}
+
+type savedSearchRepo struct{ db *sqldb.DB }
+
+func (r savedSearchRepo) Create(userID int, name, query string) (*models.SavedSearch, error) {
+	return CreateSavedSearch(r.db, userID, name, query)
+}
+
+func (r savedSearchRepo) List(userID int) ([]models.SavedSearch, error) {
+	return GetSavedSearches(r.db, userID)
+}
+
+func (r savedSearchRepo) ByID(userID, id int) (*models.SavedSearch, error) {
+	saved, err := GetSavedSearchByID(r.db, userID, id)
+	return saved, notFound(err)
+}
+
+func (r savedSearchRepo) ByName(userID int, name string) (*models.SavedSearch, error) {
+	saved, err := GetSavedSearchByName(r.db, userID, name)
+	return saved, notFound(err)
+}
+
+func (r savedSearchRepo) Update(userID, id int, name, query string) error {
+	return UpdateSavedSearch(r.db, userID, id, name, query)
+}
+
+func (r savedSearchRepo) Delete(userID, id int) error {
+	return DeleteSavedSearch(r.db, userID, id)
+}
+
+func (r savedSearchRepo) MarkSeen(userID, id int) error {
+	return MarkSavedSearchSeen(r.db, userID, id)
+}
+
+type searchRepo struct{ db *sqldb.DB }
+
+func (r searchRepo) All(query *search.Query, opts repository.SearchOptions) (*repository.SearchResults, error) {
+	return SearchAll(r.db, query, opts)
+}
+
+type banRepo struct{ db *sqldb.DB }
+
+func (r banRepo) Ban(ipAddress, reason string, bannedBy int) error {
+	return BanIP(r.db, ipAddress, reason, bannedBy)
+}
+
+func (r banRepo) Unban(ipAddress string, unbannedBy int) error {
+	return UnbanIP(r.db, ipAddress, unbannedBy)
+}
+
+func (r banRepo) IsBanned(ipAddress string) (bool, error) {
+	return IsIPBanned(r.db, ipAddress)
+}
+
+func (r banRepo) List() ([]models.BannedIP, error) {
+	return GetAllBannedIPs(r.db)
+}
+
+type twoFactorRepo struct{ db *sqldb.DB }
+
+func (r twoFactorRepo) ByUser(userID int) (*models.TwoFactor, error) {
+	tf, err := GetTwoFactor(r.db, userID)
+	return tf, notFound(err)
+}
+
+func (r twoFactorRepo) SetSecret(userID int, secret string) error {
+	return SetTwoFactorSecret(r.db, userID, secret)
+}
+
+func (r twoFactorRepo) Enable(userID int, step int64, recoveryHashes []string) error {
+	return notFound(EnableTwoFactor(r.db, userID, step, recoveryHashes, time.Now()))
+}
+
+func (r twoFactorRepo) Disable(userID int) error {
+	return DisableTwoFactor(r.db, userID)
+}
+
+func (r twoFactorRepo) UseStep(userID int, step int64) (bool, error) {
+	return UseTwoFactorStep(r.db, userID, step)
+}
+
+func (r twoFactorRepo) UseRecoveryCode(userID int, hash string) (bool, error) {
+	return UseRecoveryCode(r.db, userID, hash, time.Now())
+}
+
+func (r twoFactorRepo) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	return ReplaceRecoveryCodes(r.db, userID, hashes)
+}
+
+func (r twoFactorRepo) RecoveryCodesLeft(userID int) (int, error) {
+	return CountRecoveryCodes(r.db, userID)
+}
+
+func (r twoFactorRepo) RequiredForAdmins() (bool, error) {
+	return AdminTwoFactorRequired(r.db)
+}
+
+func (r twoFactorRepo) SetRequiredForAdmins(required bool) error {
+	return SetAdminTwoFactorRequired(r.db, required)
+}
+
+type apiTokenRepo struct{ db *sqldb.DB }
+
+func (r apiTokenRepo) Create(userID int, name, hash string, scopes []string) (*models.APIToken, error) {
+	return CreateAPIToken(r.db, userID, name, hash, scopes)
+}
+
+func (r apiTokenRepo) List(userID int) ([]models.APIToken, error) {
+	return GetAPITokens(r.db, userID)
+}
+
+func (r apiTokenRepo) ByHash(hash string) (*models.APIToken, error) {
+	token, err := GetAPITokenByHash(r.db, hash)
+	return token, notFound(err)
+}
+
+func (r apiTokenRepo) MarkUsed(id int) error {
+	return MarkAPITokenUsed(r.db, id, time.Now())
+}
+
+func (r apiTokenRepo) Delete(userID, id int) error {
+	return notFound(DeleteAPIToken(r.db, userID, id))
+}
+
+func (r apiTokenRepo) DeleteForUser(userID int) error {
+	return DeleteUserAPITokens(r.db, userID)
+}
+
+type webhookRepo struct{ db *sqldb.DB }
+
+func (r webhookRepo) Create(userID int, name, url, secret, matchType, matchValue string) (*models.Webhook, error) {
+	return CreateWebhook(r.db, userID, name, url, secret, matchType, matchValue)
+}
+
+func (r webhookRepo) List(userID int) ([]models.Webhook, error) {
+	return GetUserWebhooks(r.db, userID)
+}
+
+func (r webhookRepo) ByID(userID, id int) (*models.Webhook, error) {
+	hook, err := GetUserWebhookByID(r.db, userID, id)
+	return hook, notFound(err)
+}
+
+func (r webhookRepo) Update(userID, id int, name, url, matchType, matchValue string, enabled bool) error {
+	return notFound(UpdateWebhook(r.db, userID, id, name, url, matchType, matchValue, enabled))
+}
+
+func (r webhookRepo) Delete(userID, id int) error {
+	return notFound(DeleteWebhook(r.db, userID, id))
+}
+
+func (r webhookRepo) Deliveries(webhookID, limit int) ([]models.WebhookDelivery, error) {
+	return GetWebhookDeliveries(r.db, webhookID, limit)
+}
+
+type digestRepo struct{ db *sqldb.DB }
+
+func (r digestRepo) Subscription(userID int) (*models.DigestSubscription, error) {
+	return GetDigestSubscription(r.db, userID)
+}
+
+func (r digestRepo) SetFrequency(userID int, frequency string) error {
+	return SetDigestFrequency(r.db, userID, frequency)
+}
+
+func (r digestRepo) Unsubscribe(token string) (bool, error) {
+	return UnsubscribeDigest(r.db, token)
+}
+
+type newsletterRepo struct{ db *sqldb.DB }
+
+func (r newsletterRepo) CreateAddress(userID int, name, localPart string) (*models.NewsletterAddress, error) {
+	return CreateNewsletterAddress(r.db, userID, name, localPart)
+}
+
+func (r newsletterRepo) Addresses(userID int) ([]models.NewsletterAddress, error) {
+	return GetUserNewsletterAddresses(r.db, userID)
+}
+
+func (r newsletterRepo) DeleteAddress(userID, id int) error {
+	return notFound(DeleteNewsletterAddress(r.db, userID, id))
+}
+
+func (r newsletterRepo) SaveMessage(msg models.NewsletterMessage) error {
+	return SaveNewsletterMessage(r.db, msg)
+}
+
+func (r newsletterRepo) Message(userID int, itemID string) (*models.NewsletterMessage, error) {
+	msg, err := GetNewsletterMessage(r.db, userID, itemID)
+	return msg, notFound(err)
+}
+
+type resetTokenRepo struct{ db *sqldb.DB }
+
+func (r resetTokenRepo) Create(userID int, hash, ipAddress string, expiresAt time.Time) error {
+	return CreatePasswordReset(r.db, userID, hash, ipAddress, expiresAt)
+}
+
+func (r resetTokenRepo) User(hash string, now time.Time) (int, error) {
+	userID, err := GetPasswordResetUser(r.db, hash, now)
+	return userID, notFound(err)
+}
+
+func (r resetTokenRepo) Use(hash string, now time.Time) (int, error) {
+	userID, err := UsePasswordReset(r.db, hash, now)
+	return userID, notFound(err)
+}
+
+func (r resetTokenRepo) DeleteExpired(before time.Time) error {
+	return DeleteExpiredPasswordResets(r.db, before)
+}
+
+type accountDeletionRepo struct{ db *sqldb.DB }
+
+func (r accountDeletionRepo) Schedule(userID int, at time.Time) error {
+	return notFound(ScheduleAccountDeletion(r.db, userID, at))
+}
+
+func (r accountDeletionRepo) Cancel(userID int) error {
+	return CancelAccountDeletion(r.db, userID)
+}
+
+func (r accountDeletionRepo) Scheduled(userID int) (*time.Time, error) {
+	at, err := GetAccountDeletion(r.db, userID)
+	return at, notFound(err)
+}
+
+func (r accountDeletionRepo) Due(now time.Time) ([]int, error) {
+	return GetDueAccountDeletions(r.db, now)
+}
+
+func (r accountDeletionRepo) Delete(userID int, now time.Time) error {
+	return notFound(DeleteAccount(r.db, userID, now))
+}
+
+type dataExportRepo struct{ db *sqldb.DB }
+
+func (r dataExportRepo) Create(userID int) (*models.DataExport, error) {
+	return CreateDataExport(r.db, userID)
+}
+
+func (r dataExportRepo) ByID(id int) (*models.DataExport, error) {
+	export, err := GetDataExport(r.db, id)
+	return export, notFound(err)
+}
+
+func (r dataExportRepo) List(userID int) ([]models.DataExport, error) {
+	return GetDataExports(r.db, userID)
+}
+
+func (r dataExportRepo) Pending() ([]models.DataExport, error) {
+	return GetPendingDataExports(r.db)
+}
+
+func (r dataExportRepo) MarkRunning(id int) error {
+	return MarkDataExportRunning(r.db, id)
+}
+
+func (r dataExportRepo) MarkReady(id int, fileSize int64, completedAt, expiresAt time.Time) error {
+	return MarkDataExportReady(r.db, id, fileSize, completedAt, expiresAt)
+}
+
+func (r dataExportRepo) MarkFailed(id int, reason string, completedAt time.Time) error {
+	return MarkDataExportFailed(r.db, id, reason, completedAt)
+}
+
+func (r dataExportRepo) Expire(now time.Time) ([]int, error) {
+	return ExpireDataExports(r.db, now)
+}
+
+func (r dataExportRepo) UserData(userID int) (*repository.UserData, error) {
+	data, err := GetUserData(r.db, userID)
+	return data, notFound(err)
+}
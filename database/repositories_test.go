@@ -0,0 +1,795 @@
+package database
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/passwords"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/repository/repositorytest"
+	"github.com/navid-m/versed/search"
+)
+
+// Runs the same checks against the SQL repositories on each backend and the
+// in-memory fake, so handler tests written against the fake stay honest
+func TestRepositoriesContract(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if err := EnsureSearchIndex(db); err != nil {
+			t.Fatalf("EnsureSearchIndex: %v", err)
+		}
+		testRepositories(t, NewRepositories(db))
+	})
+	t.Run("memory", func(t *testing.T) {
+		testRepositories(t, repositorytest.New())
+	})
+}
+
+func testRepositories(t *testing.T, repos repository.Repositories) {
+	if err := repos.Users.Create("reader@example.com", "reader", "secret", "127.0.0.1"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repos.Users.Create("reader@example.com", "other", "secret", ""); !errors.Is(err, repository.ErrEmailTaken) {
+		t.Errorf("duplicate email: %v", err)
+	}
+	if err := repos.Users.Create("other@example.com", "reader", "secret", ""); !errors.Is(err, repository.ErrUsernameTaken) {
+		t.Errorf("duplicate username: %v", err)
+	}
+	user, err := repos.Users.ByEmail("reader@example.com")
+	if err != nil {
+		t.Fatalf("ByEmail: %v", err)
+	}
+	if err := passwords.Verify(user.Password, "secret"); err != nil {
+		t.Errorf("password was not hashed with bcrypt: %v", err)
+	}
+	if _, err := repos.Users.ByEmail("nobody@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ByEmail for a missing user = %v, want ErrNotFound", err)
+	}
+	if found, err := repos.Users.ByEmail("Reader@Example.COM"); err != nil || found.ID != user.ID {
+		t.Errorf("ByEmail ignoring case = %v, %v", found, err)
+	}
+	if byID, err := repos.Users.ByID(user.ID); err != nil || byID.Email != user.Email {
+		t.Errorf("ByID = %v, %v", byID, err)
+	}
+	if _, err := repos.Users.ByID(user.ID + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ByID for a missing user = %v, want ErrNotFound", err)
+	}
+
+	if err := repos.Users.Create("other@example.com", "other", "secret", ""); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repos.Users.Update(user.ID, "other@example.com", "reader", ""); !errors.Is(err, repository.ErrEmailTaken) {
+		t.Errorf("Update to another user's email = %v, want ErrEmailTaken", err)
+	}
+	if err := repos.Users.Update(user.ID, "reader@example.com", "other", ""); !errors.Is(err, repository.ErrUsernameTaken) {
+		t.Errorf("Update to another user's username = %v, want ErrUsernameTaken", err)
+	}
+	if err := repos.Users.Update(user.ID, "reader@example.com", "reader_2", ""); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated, _ := repos.Users.ByID(user.ID); updated.Username != "reader_2" || updated.Password != user.Password {
+		t.Errorf("Update without a password = %+v, want the username changed and the password kept", updated)
+	}
+	if err := repos.Users.Update(user.ID, "reader@example.com", "reader", "n3w-password"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if updated, _ := repos.Users.ByID(user.ID); passwords.Verify(updated.Password, "n3w-password") != nil {
+		t.Error("Update did not hash the new password")
+	}
+
+	if user.EmailVerified {
+		t.Error("new user starts out verified")
+	}
+	if err := repos.Users.SetPendingEmail(user.ID, "other@example.com"); !errors.Is(err, repository.ErrEmailTaken) {
+		t.Errorf("SetPendingEmail to another user's email = %v, want ErrEmailTaken", err)
+	}
+	if err := repos.Users.SetPendingEmail(user.ID, "new@example.com"); err != nil {
+		t.Fatalf("SetPendingEmail: %v", err)
+	}
+	if pending, _ := repos.Users.ByID(user.ID); pending.Email != "reader@example.com" || pending.PendingEmail != "new@example.com" {
+		t.Errorf("after SetPendingEmail = %+v, want the email kept until it is confirmed", pending)
+	}
+	if err := repos.Users.ConfirmEmail(user.ID, "elsewhere@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ConfirmEmail for an unrelated address = %v, want ErrNotFound", err)
+	}
+	if err := repos.Users.ConfirmEmail(user.ID, "reader@example.com"); err != nil {
+		t.Fatalf("ConfirmEmail: %v", err)
+	}
+	if verified, _ := repos.Users.ByID(user.ID); !verified.EmailVerified || verified.PendingEmail != "new@example.com" {
+		t.Errorf("after confirming the current email = %+v", verified)
+	}
+	if err := repos.Users.ConfirmEmail(user.ID, "new@example.com"); err != nil {
+		t.Fatalf("ConfirmEmail: %v", err)
+	}
+	if changed, _ := repos.Users.ByID(user.ID); changed.Email != "new@example.com" || changed.PendingEmail != "" || !changed.EmailVerified {
+		t.Errorf("after confirming the pending email = %+v", changed)
+	}
+	if err := repos.Users.Update(user.ID, "reader@example.com", "reader", ""); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	for key, owner := range map[string]int{"mine-1": user.ID, "mine-2": user.ID, "theirs": user.ID + 1} {
+		var data bytes.Buffer
+		if err := gob.NewEncoder(&data).Encode(map[string]any{"user_id": owner}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Sessions.Set(key, data.Bytes(), time.Hour); err != nil {
+			t.Fatalf("Sessions.Set: %v", err)
+		}
+	}
+	if err := repos.Sessions.DeleteForUser(user.ID); err != nil {
+		t.Fatalf("DeleteForUser: %v", err)
+	}
+	for key, want := range map[string]bool{"mine-1": false, "mine-2": false, "theirs": true} {
+		if data, err := repos.Sessions.Get(key); err != nil || (data != nil) != want {
+			t.Errorf("session %s kept = %v (%v), want %v", key, data != nil, err, want)
+		}
+	}
+
+	categories, err := repos.Categories.List(user.ID)
+	if err != nil || len(categories) != 3 {
+		t.Fatalf("default categories = %v, %v", categories, err)
+	}
+	tech, err := repos.Categories.ByName(user.ID, "technology")
+	if err != nil || tech.Name != "Technology" {
+		t.Fatalf("ByName ignoring case = %v, %v", tech, err)
+	}
+	if _, err := repos.Categories.ByID(user.ID+1, tech.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("another user's category = %v, want ErrNotFound", err)
+	}
+
+	source, err := repos.Sources.CreateOrUpdate("Example", "https://example.com/feed")
+	if err != nil {
+		t.Fatalf("CreateOrUpdate: %v", err)
+	}
+	again, err := repos.Sources.CreateOrUpdate("Renamed", "https://example.com/feed")
+	if err != nil || again.ID != source.ID {
+		t.Errorf("CreateOrUpdate with a known URL = %v, %v; want source %d", again, err, source.ID)
+	}
+	if err := repos.Categories.AddFeed(user.ID, tech.ID, source.ID); err != nil {
+		t.Fatalf("AddFeed: %v", err)
+	}
+	if err := repos.Categories.AddFeed(user.ID, tech.ID, source.ID); err != nil {
+		t.Errorf("adding a feed twice: %v", err)
+	}
+	if err := repos.Categories.AddFeed(user.ID, tech.ID, source.ID+1000); err == nil {
+		t.Error("adding a missing feed source succeeded")
+	}
+
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	err = repos.FeedItems.Save([]feeds.FeedItem{
+		{ID: "old", SourceID: source.ID, Title: "Older post", URL: "https://example.com/old", PublishedAt: &older},
+		{ID: "new", SourceID: source.ID, Title: "Newer post", URL: "https://example.com/new", PublishedAt: &newer},
+	})
+	if err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	items, err := repos.FeedItems.ForCategory(user.ID, tech.ID, 10)
+	if err != nil || len(items) != 2 || items[0].ID != "new" || items[0].SourceName != "Example" {
+		t.Errorf("ForCategory = %+v, %v", items, err)
+	}
+	if found, _ := repos.FeedItems.Search(search.ParseText("NEWER"), 10, 0); len(found) != 1 || found[0].ID != "new" {
+		t.Errorf("Search = %+v", found)
+	}
+	if _, err := repos.FeedItems.ByID("missing"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ByID for a missing item = %v, want ErrNotFound", err)
+	}
+
+	for _, step := range []struct {
+		vote string
+		want int
+	}{{"upvote", 1}, {"downvote", -1}, {"downvote", 0}} {
+		score, err := repos.FeedItems.Vote(user.ID, "old", step.vote)
+		if err != nil || score != step.want {
+			t.Errorf("Vote %s = %d, %v; want %d", step.vote, score, err, step.want)
+		}
+	}
+
+	if saved, err := repos.Users.SaveToReadingList(user.ID, "old"); err != nil || !saved {
+		t.Errorf("SaveToReadingList = %v, %v", saved, err)
+	}
+	if saved, _ := repos.Users.SaveToReadingList(user.ID, "old"); saved {
+		t.Error("saving an item twice reported it as newly saved")
+	}
+	if list, err := repos.Users.ReadingList(user.ID); err != nil || len(list) != 1 || list[0].ID != "old" {
+		t.Errorf("ReadingList = %+v, %v", list, err)
+	}
+
+	if err := repos.Users.Hide(user.ID, "new"); err != nil {
+		t.Fatalf("Hide: %v", err)
+	}
+	if latest, _ := repos.FeedItems.Latest(user.ID, 10, 0); len(latest) != 1 || latest[0].ID != "old" {
+		t.Errorf("Latest for a user with a hidden item = %+v", latest)
+	}
+	if latest, _ := repos.FeedItems.Latest(0, 10, 0); len(latest) != 2 {
+		t.Errorf("anonymous Latest = %+v", latest)
+	}
+
+	parent, err := repos.Comments.Create("old", user.ID, user.Username, "First", nil)
+	if err != nil {
+		t.Fatalf("Comments.Create: %v", err)
+	}
+	if _, err := repos.Comments.Create("old", user.ID, user.Username, "Reply", &parent.ID); err != nil {
+		t.Fatalf("Comments.Create reply: %v", err)
+	}
+	thread, err := repos.Comments.ForItem("old")
+	if err != nil || len(thread) != 1 || len(thread[0].Replies) != 1 {
+		t.Errorf("ForItem = %+v, %v", thread, err)
+	}
+	if found, err := repos.Comments.Search("reply", 10, 0); err != nil || len(found) != 1 || found[0].Content != "Reply" {
+		t.Errorf("Comments.Search = %+v, %v", found, err)
+	}
+	if err := repos.Comments.Delete(parent.ID + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("deleting a missing comment = %v, want ErrNotFound", err)
+	}
+
+	subverse, err := repos.Subverses.Create(" Golang ")
+	if err != nil || subverse.Name != "golang" {
+		t.Fatalf("Subverses.Create = %v, %v", subverse, err)
+	}
+	if byName, err := repos.Subverses.ByName("golang"); err != nil || byName.ID != subverse.ID {
+		t.Errorf("Subverses.ByName = %v, %v", byName, err)
+	}
+	post, err := repos.Posts.Create(subverse.ID, user.ID, user.Username, "Hello", "World", "text", "")
+	if err != nil {
+		t.Fatalf("Posts.Create: %v", err)
+	}
+	if err := repos.Posts.Update(post.ID, user.ID+1, "Hijacked", ""); err == nil || err.Error() != "post not found or user not authorized" {
+		t.Errorf("updating someone else's post: %v", err)
+	}
+	if err := repos.Posts.Vote(user.ID, post.ID, "upvote"); err != nil {
+		t.Fatalf("Posts.Vote: %v", err)
+	}
+	if got, _ := repos.Posts.ByID(post.ID); got == nil || got.Score != 1 {
+		t.Errorf("post after upvote = %+v", got)
+	}
+
+	results, err := repos.Search.All(search.ParseText("post"), repository.SearchOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("Search.All: %v", err)
+	}
+	if len(results.FeedItems) != 2 || results.Facets.Types[repository.SearchFeedItems] != 2 {
+		t.Errorf("Search.All feed items = %+v, facets %+v", results.FeedItems, results.Facets)
+	}
+	if len(results.Facets.Sources) != 1 || results.Facets.Sources[0] != (repository.FacetCount{Value: "Example", Count: 2}) {
+		t.Errorf("Search.All source facets = %+v", results.Facets.Sources)
+	}
+	results, err = repos.Search.All(search.ParseText("hello"), repository.SearchOptions{Type: repository.SearchPosts, Limit: 10})
+	if err != nil || len(results.Posts) != 1 || len(results.FeedItems) != 0 {
+		t.Fatalf("Search.All for posts = %+v, %v", results, err)
+	}
+	if len(results.Facets.Subverses) != 1 || results.Facets.Subverses[0] != (repository.FacetCount{Value: "golang", Count: 1}) {
+		t.Errorf("Search.All subverse facets = %+v", results.Facets.Subverses)
+	}
+	if results, _ := repos.Search.All(search.ParseText("hello"), repository.SearchOptions{Subverse: "rust", Limit: 10}); len(results.Posts) != 0 || results.Facets.Types[repository.SearchPosts] != 1 {
+		t.Errorf("Search.All narrowed to another subverse = %+v", results)
+	}
+	results, err = repos.Search.All(search.ParseText("golang"), repository.SearchOptions{Limit: 10})
+	if err != nil || len(results.Subverses) != 1 || results.Subverses[0].Name != "golang" {
+		t.Errorf("Search.All for subverses = %+v, %v", results, err)
+	}
+	results, err = repos.Search.All(search.ParseText(user.Username), repository.SearchOptions{Limit: 10})
+	if err != nil || len(results.Users) != 1 || results.Users[0].ID != user.ID {
+		t.Errorf("Search.All for users = %+v, %v", results, err)
+	}
+
+	if err := repos.Bans.Ban("203.0.113.9", "spam", user.ID); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if banned, _ := repos.Bans.IsBanned("203.0.113.9"); !banned {
+		t.Error("IP not banned after Ban")
+	}
+	if err := repos.Bans.Unban("203.0.113.9", user.ID); err != nil {
+		t.Fatalf("Unban: %v", err)
+	}
+	if banned, _ := repos.Bans.IsBanned("203.0.113.9"); banned {
+		t.Error("IP still banned after Unban")
+	}
+
+	saved, err := repos.SavedSearches.Create(user.ID, "Rust", "rust source:Example")
+	if err != nil || saved.Query != "rust source:Example" || saved.Unseen != 0 {
+		t.Fatalf("SavedSearches.Create = %+v, %v", saved, err)
+	}
+	if _, err := repos.SavedSearches.Create(user.ID, "Rust", "rust"); err == nil {
+		t.Error("SavedSearches.Create allowed a duplicate name")
+	}
+	if found, err := repos.SavedSearches.ByName(user.ID, "rust"); err != nil || found.ID != saved.ID {
+		t.Errorf("SavedSearches.ByName ignoring case = %+v, %v", found, err)
+	}
+	if _, err := repos.SavedSearches.ByID(user.ID+1, saved.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("SavedSearches.ByID for another user = %v, want ErrNotFound", err)
+	}
+	if err := repos.SavedSearches.Update(user.ID, saved.ID, "Rust news", "rust"); err != nil {
+		t.Fatalf("SavedSearches.Update: %v", err)
+	}
+	if err := repos.SavedSearches.MarkSeen(user.ID, saved.ID); err != nil {
+		t.Fatalf("SavedSearches.MarkSeen: %v", err)
+	}
+	if searches, err := repos.SavedSearches.List(user.ID); err != nil || len(searches) != 1 || searches[0].Name != "Rust news" {
+		t.Errorf("SavedSearches.List = %+v, %v", searches, err)
+	}
+	if err := repos.SavedSearches.Delete(user.ID+1, saved.ID); err == nil {
+		t.Error("SavedSearches.Delete removed another user's search")
+	}
+	if err := repos.SavedSearches.Delete(user.ID, saved.ID); err != nil {
+		t.Fatalf("SavedSearches.Delete: %v", err)
+	}
+	if searches, _ := repos.SavedSearches.List(user.ID); len(searches) != 0 {
+		t.Errorf("SavedSearches.List after Delete = %+v", searches)
+	}
+
+	if err := repos.Sessions.Set("sid", []byte("data"), time.Hour); err != nil {
+		t.Fatalf("Sessions.Set: %v", err)
+	}
+	if data, _ := repos.Sessions.Get("sid"); string(data) != "data" {
+		t.Errorf("Sessions.Get = %q", data)
+	}
+	if err := repos.Sessions.Delete("sid"); err != nil {
+		t.Fatalf("Sessions.Delete: %v", err)
+	}
+	if data, _ := repos.Sessions.Get("sid"); data != nil {
+		t.Errorf("Sessions.Get after Delete = %q", data)
+	}
+
+	if _, err := repos.TwoFactor.ByUser(user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("TwoFactor.ByUser before setup = %v, want ErrNotFound", err)
+	}
+	if err := repos.TwoFactor.Enable(user.ID, 1, nil); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("TwoFactor.Enable without a secret = %v, want ErrNotFound", err)
+	}
+	if err := repos.TwoFactor.SetSecret(user.ID, "FIRST"); err != nil {
+		t.Fatalf("TwoFactor.SetSecret: %v", err)
+	}
+	if err := repos.TwoFactor.SetSecret(user.ID, "SECOND"); err != nil {
+		t.Fatalf("TwoFactor.SetSecret again: %v", err)
+	}
+	if tf, err := repos.TwoFactor.ByUser(user.ID); err != nil || tf.Secret != "SECOND" || tf.EnabledAt != nil {
+		t.Errorf("TwoFactor.ByUser before Enable = %+v, %v", tf, err)
+	}
+	if err := repos.TwoFactor.Enable(user.ID, 100, []string{"hash-a", "hash-b"}); err != nil {
+		t.Fatalf("TwoFactor.Enable: %v", err)
+	}
+	if err := repos.TwoFactor.SetSecret(user.ID, "THIRD"); err != nil {
+		t.Fatalf("TwoFactor.SetSecret once enabled: %v", err)
+	}
+	if tf, err := repos.TwoFactor.ByUser(user.ID); err != nil || tf.Secret != "SECOND" || tf.EnabledAt == nil || tf.LastStep != 100 {
+		t.Errorf("TwoFactor.ByUser after Enable = %+v, %v", tf, err)
+	}
+	for _, step := range []int64{100, 99} {
+		if ok, err := repos.TwoFactor.UseStep(user.ID, step); err != nil || ok {
+			t.Errorf("TwoFactor.UseStep(%d) = %v, %v; want a replay refused", step, ok, err)
+		}
+	}
+	if ok, err := repos.TwoFactor.UseStep(user.ID, 101); err != nil || !ok {
+		t.Errorf("TwoFactor.UseStep(101) = %v, %v", ok, err)
+	}
+	if ok, err := repos.TwoFactor.UseRecoveryCode(user.ID, "hash-a"); err != nil || !ok {
+		t.Errorf("TwoFactor.UseRecoveryCode = %v, %v", ok, err)
+	}
+	if ok, _ := repos.TwoFactor.UseRecoveryCode(user.ID, "hash-a"); ok {
+		t.Error("recovery code was accepted twice")
+	}
+	if ok, _ := repos.TwoFactor.UseRecoveryCode(user.ID+1, "hash-b"); ok {
+		t.Error("recovery code was accepted for another user")
+	}
+	if left, err := repos.TwoFactor.RecoveryCodesLeft(user.ID); err != nil || left != 1 {
+		t.Errorf("TwoFactor.RecoveryCodesLeft = %d, %v; want 1", left, err)
+	}
+	if err := repos.TwoFactor.ReplaceRecoveryCodes(user.ID, []string{"hash-c", "hash-d", "hash-e"}); err != nil {
+		t.Fatalf("TwoFactor.ReplaceRecoveryCodes: %v", err)
+	}
+	if ok, _ := repos.TwoFactor.UseRecoveryCode(user.ID, "hash-b"); ok {
+		t.Error("replaced recovery code was still accepted")
+	}
+	if left, _ := repos.TwoFactor.RecoveryCodesLeft(user.ID); left != 3 {
+		t.Errorf("TwoFactor.RecoveryCodesLeft after replacing = %d, want 3", left)
+	}
+	if err := repos.TwoFactor.Disable(user.ID); err != nil {
+		t.Fatalf("TwoFactor.Disable: %v", err)
+	}
+	if _, err := repos.TwoFactor.ByUser(user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("TwoFactor.ByUser after Disable = %v, want ErrNotFound", err)
+	}
+	if left, _ := repos.TwoFactor.RecoveryCodesLeft(user.ID); left != 0 {
+		t.Errorf("TwoFactor.RecoveryCodesLeft after Disable = %d, want 0", left)
+	}
+	if required, err := repos.TwoFactor.RequiredForAdmins(); err != nil || required {
+		t.Errorf("TwoFactor.RequiredForAdmins by default = %v, %v", required, err)
+	}
+	for _, want := range []bool{true, false} {
+		if err := repos.TwoFactor.SetRequiredForAdmins(want); err != nil {
+			t.Fatalf("TwoFactor.SetRequiredForAdmins: %v", err)
+		}
+		if required, _ := repos.TwoFactor.RequiredForAdmins(); required != want {
+			t.Errorf("TwoFactor.RequiredForAdmins = %v, want %v", required, want)
+		}
+	}
+
+	other, err := repos.Users.ByEmail("other@example.com")
+	if err != nil {
+		t.Fatalf("ByEmail: %v", err)
+	}
+	first, err := repos.APITokens.Create(user.ID, "Scripts", "hash-1", []string{"read", "categories"})
+	if err != nil || first.Name != "Scripts" || len(first.Scopes) != 2 || first.LastUsedAt != nil {
+		t.Fatalf("APITokens.Create = %+v, %v", first, err)
+	}
+	second, err := repos.APITokens.Create(user.ID, "CI", "hash-2", []string{"read"})
+	if err != nil {
+		t.Fatalf("APITokens.Create: %v", err)
+	}
+	if _, err := repos.APITokens.Create(user.ID, "Copy", "hash-1", []string{"read"}); err == nil {
+		t.Error("APITokens.Create allowed a duplicate hash")
+	}
+	if tokens, err := repos.APITokens.List(user.ID); err != nil || len(tokens) != 2 || tokens[0].ID != second.ID {
+		t.Errorf("APITokens.List = %+v, %v; want the newest first", tokens, err)
+	}
+	if found, err := repos.APITokens.ByHash("hash-1"); err != nil || found.ID != first.ID || found.UserID != user.ID || found.Scopes[1] != "categories" {
+		t.Errorf("APITokens.ByHash = %+v, %v", found, err)
+	}
+	if _, err := repos.APITokens.ByHash("hash-3"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("APITokens.ByHash for an unknown hash = %v, want ErrNotFound", err)
+	}
+	if err := repos.APITokens.MarkUsed(first.ID); err != nil {
+		t.Fatalf("APITokens.MarkUsed: %v", err)
+	}
+	if found, _ := repos.APITokens.ByHash("hash-1"); found.LastUsedAt == nil {
+		t.Error("APITokens.MarkUsed did not record the time")
+	}
+	if err := repos.APITokens.Delete(user.ID+1, first.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("APITokens.Delete of another user's token = %v, want ErrNotFound", err)
+	}
+	if err := repos.APITokens.Delete(user.ID, first.ID); err != nil {
+		t.Fatalf("APITokens.Delete: %v", err)
+	}
+	if _, err := repos.APITokens.ByHash("hash-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("APITokens.ByHash after Delete = %v, want ErrNotFound", err)
+	}
+	if _, err := repos.APITokens.Create(other.ID, "Theirs", "hash-other", []string{"read"}); err != nil {
+		t.Fatalf("APITokens.Create: %v", err)
+	}
+	if err := repos.APITokens.DeleteForUser(user.ID); err != nil {
+		t.Fatalf("APITokens.DeleteForUser: %v", err)
+	}
+	if tokens, err := repos.APITokens.List(user.ID); err != nil || len(tokens) != 0 {
+		t.Errorf("APITokens.List after DeleteForUser = %+v, %v; want none", tokens, err)
+	}
+	if tokens, _ := repos.APITokens.List(other.ID); len(tokens) != 1 {
+		t.Errorf("APITokens.DeleteForUser left another user with %d tokens, want 1", len(tokens))
+	}
+
+	hook, err := repos.Webhooks.Create(user.ID, "Go news", "https://example.com/hook", "whsec_1", models.WebhookMatchKeyword, "golang")
+	if err != nil || !hook.Enabled || hook.Secret != "whsec_1" {
+		t.Fatalf("Webhooks.Create = %+v, %v", hook, err)
+	}
+	if hooks, err := repos.Webhooks.List(user.ID); err != nil || len(hooks) != 1 || hooks[0].ID != hook.ID || hooks[0].Secret != "" {
+		t.Errorf("Webhooks.List = %+v, %v; want the webhook without its secret", hooks, err)
+	}
+	if _, err := repos.Webhooks.ByID(user.ID+1, hook.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Webhooks.ByID of another user's webhook = %v, want ErrNotFound", err)
+	}
+	if err := repos.Webhooks.Update(user.ID+1, hook.ID, "Taken", hook.URL, hook.MatchType, hook.MatchValue, true); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Webhooks.Update of another user's webhook = %v, want ErrNotFound", err)
+	}
+	if err := repos.Webhooks.Update(user.ID, hook.ID, "Rust news", hook.URL, models.WebhookMatchTag, "rust", false); err != nil {
+		t.Fatalf("Webhooks.Update: %v", err)
+	}
+	if found, err := repos.Webhooks.ByID(user.ID, hook.ID); err != nil || found.Name != "Rust news" || found.MatchType != models.WebhookMatchTag ||
+		found.Enabled || found.Secret != "whsec_1" {
+		t.Errorf("Webhooks.ByID after Update = %+v, %v", found, err)
+	}
+	if deliveries, err := repos.Webhooks.Deliveries(hook.ID, 10); err != nil || len(deliveries) != 0 {
+		t.Errorf("Webhooks.Deliveries = %+v, %v; want none", deliveries, err)
+	}
+	if err := repos.Webhooks.Delete(user.ID+1, hook.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Webhooks.Delete of another user's webhook = %v, want ErrNotFound", err)
+	}
+	if err := repos.Webhooks.Delete(user.ID, hook.ID); err != nil {
+		t.Fatalf("Webhooks.Delete: %v", err)
+	}
+	if _, err := repos.Webhooks.ByID(user.ID, hook.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Webhooks.ByID after Delete = %v, want ErrNotFound", err)
+	}
+
+	sub, err := repos.Digests.Subscription(user.ID)
+	if err != nil || sub.Frequency != models.DigestOff || sub.Email != "reader@example.com" || sub.UnsubscribeToken == "" {
+		t.Fatalf("Digests.Subscription = %+v, %v; want digests off", sub, err)
+	}
+	if again, _ := repos.Digests.Subscription(user.ID); again.UnsubscribeToken != sub.UnsubscribeToken {
+		t.Error("Digests.Subscription replaced the unsubscribe token")
+	}
+	if err := repos.Digests.SetFrequency(user.ID, "hourly"); err == nil {
+		t.Error("Digests.SetFrequency accepted an unknown frequency")
+	}
+	if err := repos.Digests.SetFrequency(user.ID, models.DigestWeekly); err != nil {
+		t.Fatalf("Digests.SetFrequency: %v", err)
+	}
+	if updated, _ := repos.Digests.Subscription(user.ID); updated.Frequency != models.DigestWeekly {
+		t.Errorf("Digests.Subscription after SetFrequency = %+v", updated)
+	}
+	if ok, err := repos.Digests.Unsubscribe("not-a-token"); err != nil || ok {
+		t.Errorf("Digests.Unsubscribe with an unknown token = %v, %v", ok, err)
+	}
+	if ok, err := repos.Digests.Unsubscribe(sub.UnsubscribeToken); err != nil || !ok {
+		t.Errorf("Digests.Unsubscribe = %v, %v", ok, err)
+	}
+	if updated, _ := repos.Digests.Subscription(user.ID); updated.Frequency != models.DigestOff {
+		t.Errorf("Digests.Subscription after Unsubscribe = %+v, want digests off", updated)
+	}
+
+	weekly, err := repos.Newsletters.CreateAddress(user.ID, "Weekly", "weekly.abcd1234")
+	if err != nil || weekly.LocalPart != "weekly.abcd1234" {
+		t.Fatalf("Newsletters.CreateAddress = %+v, %v", weekly, err)
+	}
+	if source, err := repos.Sources.ByID(weekly.FeedSourceID); err != nil || source.Name != "Weekly" {
+		t.Errorf("newsletter feed source = %+v, %v", source, err)
+	}
+	renamed, err := repos.Newsletters.CreateAddress(user.ID, "Weekly", "weekly.efgh5678")
+	if err != nil {
+		t.Fatalf("Newsletters.CreateAddress: %v", err)
+	}
+	if source, _ := repos.Sources.ByID(renamed.FeedSourceID); source == nil || source.Name != "Weekly (weekly.efgh5678)" {
+		t.Errorf("newsletter feed source with a taken name = %+v", source)
+	}
+
+	// Newsletters are the address owner's alone
+	received := time.Now()
+	if err := repos.FeedItems.Save([]feeds.FeedItem{{ID: "letter", SourceID: weekly.FeedSourceID, Title: "Private newsletter", URL: "/newsletters/items/letter", PublishedAt: &received}}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := repos.Newsletters.SaveMessage(models.NewsletterMessage{ItemID: "letter", AddressID: weekly.ID, UserID: user.ID, FromAddress: "editor@example.com", ReceivedAt: received}); err != nil {
+		t.Fatalf("Newsletters.SaveMessage: %v", err)
+	}
+	for _, userID := range []int{0, user.ID} {
+		if latest, _ := repos.FeedItems.Latest(userID, 10, 0); slices.ContainsFunc(latest, func(item feeds.FeedItem) bool { return item.ID == "letter" }) {
+			t.Errorf("Latest for user %d lists a newsletter", userID)
+		}
+	}
+	if found, _ := repos.FeedItems.Search(search.ParseText("private"), 10, 0); len(found) != 0 {
+		t.Errorf("Search found newsletters %+v", found)
+	}
+	if results, _ := repos.Search.All(search.ParseText("private"), repository.SearchOptions{Limit: 10}); len(results.FeedItems) != 0 || results.Facets.Types[repository.SearchFeedItems] != 0 {
+		t.Errorf("Search.All found newsletters %+v", results)
+	}
+	if _, err := repos.Newsletters.Message(other.ID, "letter"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Newsletters.Message for another user = %v, want ErrNotFound", err)
+	}
+
+	if _, err := repos.Newsletters.CreateAddress(user.ID, "Copy", "weekly.abcd1234"); err == nil {
+		t.Error("Newsletters.CreateAddress allowed a duplicate local part")
+	}
+	if addrs, err := repos.Newsletters.Addresses(user.ID); err != nil || len(addrs) != 2 {
+		t.Errorf("Newsletters.Addresses = %+v, %v", addrs, err)
+	}
+	if err := repos.Newsletters.DeleteAddress(user.ID+1, weekly.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Newsletters.DeleteAddress of another user's address = %v, want ErrNotFound", err)
+	}
+	if err := repos.Newsletters.DeleteAddress(user.ID, weekly.ID); err != nil {
+		t.Fatalf("Newsletters.DeleteAddress: %v", err)
+	}
+	if addrs, _ := repos.Newsletters.Addresses(user.ID); len(addrs) != 1 || addrs[0].ID != renamed.ID {
+		t.Errorf("Newsletters.Addresses after DeleteAddress = %+v", addrs)
+	}
+	if _, err := repos.Sources.ByID(weekly.FeedSourceID); err != nil {
+		t.Errorf("deleting an address removed its feed source: %v", err)
+	}
+	if msg, err := repos.Newsletters.Message(user.ID, "letter"); err != nil || msg.FromAddress != "editor@example.com" {
+		t.Errorf("Newsletters.Message after deleting its address = %+v, %v", msg, err)
+	}
+	if _, err := repos.Newsletters.Message(user.ID, "missing-item"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Newsletters.Message for an unknown item = %v, want ErrNotFound", err)
+	}
+
+	now := time.Now()
+	for _, token := range []struct {
+		userID    int
+		hash      string
+		expiresAt time.Time
+	}{
+		{user.ID, "reset-1", now.Add(time.Hour)},
+		{user.ID, "reset-2", now.Add(time.Hour)},
+		{user.ID, "reset-old", now.Add(-time.Hour)},
+		{other.ID, "reset-other", now.Add(time.Hour)},
+	} {
+		if err := repos.ResetTokens.Create(token.userID, token.hash, "127.0.0.1", token.expiresAt); err != nil {
+			t.Fatalf("ResetTokens.Create(%q): %v", token.hash, err)
+		}
+	}
+	if userID, err := repos.ResetTokens.User("reset-1", now); err != nil || userID != user.ID {
+		t.Errorf("ResetTokens.User = %d, %v; want %d", userID, err, user.ID)
+	}
+	for _, hash := range []string{"reset-old", "reset-unknown"} {
+		if _, err := repos.ResetTokens.User(hash, now); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("ResetTokens.User(%q) = %v, want ErrNotFound", hash, err)
+		}
+		if _, err := repos.ResetTokens.Use(hash, now); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("ResetTokens.Use(%q) = %v, want ErrNotFound", hash, err)
+		}
+	}
+	if userID, err := repos.ResetTokens.Use("reset-1", now); err != nil || userID != user.ID {
+		t.Errorf("ResetTokens.Use = %d, %v; want %d", userID, err, user.ID)
+	}
+	// Using one token uses up the user's others, and nobody else's
+	for _, hash := range []string{"reset-1", "reset-2"} {
+		if _, err := repos.ResetTokens.Use(hash, now); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("ResetTokens.Use(%q) after using a token = %v, want ErrNotFound", hash, err)
+		}
+	}
+	if userID, err := repos.ResetTokens.User("reset-other", now); err != nil || userID != other.ID {
+		t.Errorf("another user's token after Use = %d, %v", userID, err)
+	}
+	if err := repos.ResetTokens.DeleteExpired(now.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("ResetTokens.DeleteExpired: %v", err)
+	}
+	if err := repos.ResetTokens.Create(other.ID, "reset-other", "127.0.0.1", now.Add(time.Hour)); err != nil {
+		t.Errorf("ResetTokens.Create after DeleteExpired removed the hash = %v", err)
+	}
+
+	export, err := repos.DataExports.Create(user.ID)
+	if err != nil || export.Status != models.ExportPending || export.UserID != user.ID {
+		t.Fatalf("DataExports.Create = %+v, %v", export, err)
+	}
+	failed, err := repos.DataExports.Create(user.ID)
+	if err != nil {
+		t.Fatalf("DataExports.Create: %v", err)
+	}
+	if _, err := repos.DataExports.ByID(failed.ID + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("DataExports.ByID for a missing export = %v, want ErrNotFound", err)
+	}
+	if err := repos.DataExports.MarkRunning(export.ID); err != nil {
+		t.Fatalf("DataExports.MarkRunning: %v", err)
+	}
+	if pending, err := repos.DataExports.Pending(); err != nil || len(pending) != 2 || pending[0].ID != export.ID || pending[0].Status != models.ExportRunning {
+		t.Errorf("DataExports.Pending = %+v, %v; want both exports, oldest first", pending, err)
+	}
+	if err := repos.DataExports.MarkFailed(failed.ID, "disk full", now); err != nil {
+		t.Fatalf("DataExports.MarkFailed: %v", err)
+	}
+	if err := repos.DataExports.MarkReady(export.ID, 512, now, now.Add(time.Hour)); err != nil {
+		t.Fatalf("DataExports.MarkReady: %v", err)
+	}
+	if list, err := repos.DataExports.List(user.ID); err != nil || len(list) != 2 || list[0].ID != failed.ID ||
+		list[0].Error != "disk full" || list[1].FileSize != 512 || list[1].ExpiresAt == nil {
+		t.Errorf("DataExports.List = %+v, %v; want the newest first", list, err)
+	}
+	if pending, _ := repos.DataExports.Pending(); len(pending) != 0 {
+		t.Errorf("DataExports.Pending once built = %+v", pending)
+	}
+	if ids, err := repos.DataExports.Expire(now); err != nil || len(ids) != 0 {
+		t.Errorf("DataExports.Expire before the download window passed = %v, %v", ids, err)
+	}
+	if ids, err := repos.DataExports.Expire(now.Add(2 * time.Hour)); err != nil || len(ids) != 1 || ids[0] != export.ID {
+		t.Errorf("DataExports.Expire = %v, %v; want [%d]", ids, err, export.ID)
+	}
+	if expired, _ := repos.DataExports.ByID(export.ID); expired == nil || expired.Status != models.ExportExpired {
+		t.Errorf("export after Expire = %+v", expired)
+	}
+
+	data, err := repos.DataExports.UserData(user.ID)
+	if err != nil {
+		t.Fatalf("DataExports.UserData: %v", err)
+	}
+	if data.User.ID != user.ID || len(data.Categories) != 3 || len(data.Categories[2].Feeds) == 0 {
+		t.Errorf("UserData user and categories = %+v, %+v", data.User, data.Categories)
+	}
+	if len(data.ReadingList) != 1 || len(data.Hidden) != 1 || data.Hidden[0].Title != "Newer post" || len(data.ItemVotes) != 0 {
+		t.Errorf("UserData items = %+v, %+v, %+v", data.ReadingList, data.Hidden, data.ItemVotes)
+	}
+	if len(data.PostVotes) != 1 || len(data.Comments) != 2 || len(data.Posts) != 1 || data.Posts[0].Username != user.Username {
+		t.Errorf("UserData votes, comments and posts = %+v, %+v, %+v", data.PostVotes, data.Comments, data.Posts)
+	}
+	if _, err := repos.DataExports.UserData(other.ID + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("DataExports.UserData for a missing user = %v, want ErrNotFound", err)
+	}
+
+	if at, err := repos.AccountDeletions.Scheduled(user.ID); err != nil || at != nil {
+		t.Errorf("AccountDeletions.Scheduled before scheduling = %v, %v", at, err)
+	}
+	if _, err := repos.AccountDeletions.Scheduled(other.ID + 1000); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("AccountDeletions.Scheduled for a missing user = %v, want ErrNotFound", err)
+	}
+	if err := repos.AccountDeletions.Schedule(other.ID+1000, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("AccountDeletions.Schedule for a missing user = %v, want ErrNotFound", err)
+	}
+	if err := repos.AccountDeletions.Schedule(user.ID, now.Add(time.Hour)); err != nil {
+		t.Fatalf("AccountDeletions.Schedule: %v", err)
+	}
+	if at, err := repos.AccountDeletions.Scheduled(user.ID); err != nil || at == nil || at.Sub(now.Add(time.Hour)).Abs() > time.Second {
+		t.Errorf("AccountDeletions.Scheduled = %v, %v", at, err)
+	}
+	if due, err := repos.AccountDeletions.Due(now); err != nil || len(due) != 0 {
+		t.Errorf("AccountDeletions.Due within the grace period = %v, %v", due, err)
+	}
+	if due, err := repos.AccountDeletions.Due(now.Add(2 * time.Hour)); err != nil || len(due) != 1 || due[0] != user.ID {
+		t.Errorf("AccountDeletions.Due = %v, %v; want [%d]", due, err, user.ID)
+	}
+	if err := repos.AccountDeletions.Cancel(user.ID); err != nil {
+		t.Fatalf("AccountDeletions.Cancel: %v", err)
+	}
+	if due, _ := repos.AccountDeletions.Due(now.Add(2 * time.Hour)); len(due) != 0 {
+		t.Errorf("AccountDeletions.Due after Cancel = %v", due)
+	}
+
+	// Deleting an account takes back its votes and keeps its posts up
+	for _, voter := range []int{user.ID, other.ID} {
+		if _, err := repos.FeedItems.Vote(voter, "new", "upvote"); err != nil {
+			t.Fatalf("Vote: %v", err)
+		}
+	}
+	var sessionData bytes.Buffer
+	if err := gob.NewEncoder(&sessionData).Encode(map[string]any{"user_id": user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Sessions.Set("doomed", sessionData.Bytes(), time.Hour); err != nil {
+		t.Fatalf("Sessions.Set: %v", err)
+	}
+	if err := repos.AccountDeletions.Schedule(user.ID, now); err != nil {
+		t.Fatalf("AccountDeletions.Schedule: %v", err)
+	}
+	if err := repos.AccountDeletions.Delete(user.ID, now); err != nil {
+		t.Fatalf("AccountDeletions.Delete: %v", err)
+	}
+	if err := repos.AccountDeletions.Delete(user.ID, now); err != nil {
+		t.Errorf("deleting an account twice: %v", err)
+	}
+	if err := repos.AccountDeletions.Delete(other.ID+1000, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("AccountDeletions.Delete for a missing user = %v, want ErrNotFound", err)
+	}
+	if deleted, err := repos.Users.ByID(user.ID); err != nil || deleted.Username != models.DeletedUsername ||
+		deleted.Email == "reader@example.com" || deleted.Password != "" || deleted.IPAddress != "" {
+		t.Errorf("user after Delete = %+v, %v", deleted, err)
+	}
+	if _, err := repos.Users.ByEmail("reader@example.com"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("ByEmail for a deleted user = %v, want ErrNotFound", err)
+	}
+	if data, _ := repos.Sessions.Get("doomed"); data != nil {
+		t.Error("deleting an account kept its session")
+	}
+	if due, _ := repos.AccountDeletions.Due(now); len(due) != 0 {
+		t.Errorf("AccountDeletions.Due after Delete = %v", due)
+	}
+	if err := repos.AccountDeletions.Schedule(user.ID, now); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("AccountDeletions.Schedule for a deleted user = %v, want ErrNotFound", err)
+	}
+	if item, err := repos.FeedItems.ByID("new"); err != nil || item.Score != 1 {
+		t.Errorf("item after its voter was deleted = %+v, %v; want a score of 1", item, err)
+	}
+	if got, err := repos.Posts.ByID(post.ID); err != nil || got.Score != 0 || got.Username != models.DeletedUsername {
+		t.Errorf("post after its author was deleted = %+v, %v", got, err)
+	}
+	if thread, _ := repos.Comments.ForItem("old"); len(thread) != 1 || thread[0].Username != models.DeletedUsername {
+		t.Errorf("comments after their author was deleted = %+v", thread)
+	}
+	if categories, _ := repos.Categories.List(user.ID); len(categories) != 0 {
+		t.Errorf("categories after Delete = %+v", categories)
+	}
+	if list, _ := repos.Users.ReadingList(user.ID); len(list) != 0 {
+		t.Errorf("reading list after Delete = %+v", list)
+	}
+	if list, _ := repos.DataExports.List(user.ID); len(list) != 0 {
+		t.Errorf("data exports after Delete = %+v", list)
+	}
+	if _, err := repos.ResetTokens.User("reset-other", now); err != nil {
+		t.Errorf("deleting an account removed another user's reset token: %v", err)
+	}
+
+	// Addresses that differ only in case predate matching ignoring case
+	if err := repos.Users.Create("OTHER@example.com", "shouty", "secret", ""); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if found, err := repos.Users.ByEmail("other@example.com"); err != nil || found.ID != other.ID {
+		t.Errorf("ByEmail with an exact match = %v, %v; want user %d", found, err, other.ID)
+	}
+	if found, err := repos.Users.ByEmail("OTHER@example.com"); err != nil || found.Username != "shouty" {
+		t.Errorf("ByEmail with an exact match = %v, %v; want shouty", found, err)
+	}
+}
@@ -0,0 +1,219 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/search"
+)
+
+// Selects saved searches along with their unseen match counts.
+//
+// A search's seen_match_id is the high-water mark of the matches its owner
+// has already seen, so the unseen ones are those recorded after it.
+const savedSearchSelect = `SELECT s.id, s.user_id, s.name, s.query,
+	(SELECT COUNT(*) FROM saved_search_matches m WHERE m.search_id = s.id AND m.id > s.seen_match_id),
+	s.created_at
+	FROM saved_searches s`
+
+// Scans a saved search row
+func scanSavedSearch(row interface{ Scan(...any) error }) (*models.SavedSearch, error) {
+	var saved models.SavedSearch
+	err := row.Scan(&saved.ID, &saved.UserID, &saved.Name, &saved.Query, &saved.Unseen, &saved.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// Saves a search query for a user
+func CreateSavedSearch(db *sqldb.DB, userID int, name, query string) (*models.SavedSearch, error) {
+	var id int
+	err := db.QueryRow(`INSERT INTO saved_searches (user_id, name, query) VALUES (?, ?, ?) RETURNING id`,
+		userID, name, query).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create saved search: %w", err)
+	}
+	return GetSavedSearchByID(db, userID, id)
+}
+
+// Retrieves all of a user's saved searches by name
+func GetSavedSearches(db *sqldb.DB, userID int) ([]models.SavedSearch, error) {
+	rows, err := db.Query(savedSearchSelect+` WHERE s.user_id = ? ORDER BY s.name`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get saved searches: %w", err)
+	}
+	defer rows.Close()
+
+	var searches []models.SavedSearch
+	for rows.Next() {
+		saved, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan saved search: %w", err)
+		}
+		searches = append(searches, *saved)
+	}
+	return searches, rows.Err()
+}
+
+// Retrieves one of a user's saved searches
+func GetSavedSearchByID(db *sqldb.DB, userID, id int) (*models.SavedSearch, error) {
+	return scanSavedSearch(db.QueryRow(savedSearchSelect+` WHERE s.id = ? AND s.user_id = ?`, id, userID))
+}
+
+// Retrieves one of a user's saved searches by name, ignoring case
+func GetSavedSearchByName(db *sqldb.DB, userID int, name string) (*models.SavedSearch, error) {
+	return scanSavedSearch(db.QueryRow(savedSearchSelect+` WHERE s.user_id = ? AND LOWER(s.name) = LOWER(?)`, userID, name))
+}
+
+// Renames a saved search and changes its query.
+//
+// A changed query starts over with no matches, since the old ones no longer apply.
+func UpdateSavedSearch(db *sqldb.DB, userID, id int, name, query string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(`SELECT query FROM saved_searches WHERE id = ? AND user_id = ?`, id, userID).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("saved search not found: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE saved_searches SET name = ?, query = ? WHERE id = ?`, name, query, id); err != nil {
+		return fmt.Errorf("failed to update saved search: %w", err)
+	}
+	if query != current {
+		if _, err := tx.Exec(`DELETE FROM saved_search_matches WHERE search_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete saved search matches: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Deletes a saved search and its matches
+func DeleteSavedSearch(db *sqldb.DB, userID, id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM saved_searches WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete saved search: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("saved search not found")
+	}
+	if _, err := tx.Exec(`DELETE FROM saved_search_matches WHERE search_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete saved search matches: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Moves a saved search's high-water mark past every match recorded so far
+func MarkSavedSearchSeen(db *sqldb.DB, userID, id int) error {
+	_, err := db.Exec(`UPDATE saved_searches
+	                   SET seen_match_id = COALESCE((SELECT MAX(m.id) FROM saved_search_matches m WHERE m.search_id = saved_searches.id), 0)
+	                   WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark saved search seen: %w", err)
+	}
+	return nil
+}
+
+// Runs every saved search against newly ingested feed items, recording the matches.
+//
+// Meant to be run with the new items of each ingest cycle, so searches only
+// alert on items that arrive after they are saved, and each cycle costs one
+// query per saved search however large the archive grows. Items already
+// recorded for a search are skipped. Returns the number of new matches
+// across all searches.
+func RunSavedSearches(db *sqldb.DB, itemIDs []string) (int, error) {
+	if len(itemIDs) == 0 {
+		return 0, nil
+	}
+
+	rows, err := db.Query(`SELECT id, query FROM saved_searches`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get saved searches: %w", err)
+	}
+	type savedQuery struct {
+		id    int
+		query string
+	}
+	var searches []savedQuery
+	for rows.Next() {
+		var s savedQuery
+		if err := rows.Scan(&s.id, &s.query); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan saved search: %w", err)
+		}
+		searches = append(searches, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	matched := 0
+	for _, s := range searches {
+		query, err := search.Parse(s.query)
+		if err != nil {
+			logger.Warn("Skipping saved search with a malformed query", "saved_search_id", s.id, "err", err)
+			continue
+		}
+		ids, err := matchFeedItems(db, query, itemIDs)
+		if err != nil {
+			return matched, fmt.Errorf("failed to run saved search %d: %w", s.id, err)
+		}
+		for _, itemID := range ids {
+			result, err := db.Exec(`INSERT INTO saved_search_matches (search_id, item_id) VALUES (?, ?)
+			                        ON CONFLICT (search_id, item_id) DO NOTHING`, s.id, itemID)
+			if err != nil {
+				return matched, fmt.Errorf("failed to record saved search match: %w", err)
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				matched++
+			}
+		}
+	}
+	return matched, nil
+}
+
+// Returns which of the given feed items match a query
+func matchFeedItems(db *sqldb.DB, query *search.Query, itemIDs []string) ([]string, error) {
+	if query.Empty() {
+		return nil, nil
+	}
+	builder, _ := selectFeedItemSearch(db, query, "fi.id")
+	sqlQuery, args, err := builder.Where(squirrel.Eq{"fi.id": itemIDs}).ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+func TestSavedSearches(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if err := EnsureSearchIndex(db); err != nil {
+			t.Fatalf("EnsureSearchIndex: %v", err)
+		}
+		testSavedSearches(t, db)
+	})
+}
+
+// Runs saved searches over a few ingest cycles and checks the unseen counts
+func testSavedSearches(t *testing.T, db *sqldb.DB) {
+	if err := CreateUser(db, "watcher@example.com", "watcher", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := GetUserByEmail(db, "watcher@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	var sourceID int
+	if err := db.QueryRow(`INSERT INTO feed_sources (name, url) VALUES ('Example', 'https://example.com/feed') RETURNING id`).Scan(&sourceID); err != nil {
+		t.Fatalf("failed to insert source: %v", err)
+	}
+
+	published := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	ingest := func(items map[string]string) {
+		t.Helper()
+		var ids []string
+		for id, title := range items {
+			_, err := db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author, published_at) VALUES (?, ?, ?, ?, '', '', ?)`,
+				id, sourceID, title, "https://example.com/"+id, published)
+			if err != nil {
+				t.Fatalf("failed to insert item: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		if _, err := RunSavedSearches(db, ids); err != nil {
+			t.Fatalf("RunSavedSearches: %v", err)
+		}
+	}
+	unseen := func(id int) int {
+		t.Helper()
+		saved, err := GetSavedSearchByID(db, user.ID, id)
+		if err != nil {
+			t.Fatalf("GetSavedSearchByID: %v", err)
+		}
+		return saved.Unseen
+	}
+
+	// Items ingested before a search is saved never count
+	ingest(map[string]string{"old": "Rust before saving"})
+
+	rust, err := CreateSavedSearch(db, user.ID, "Rust", "rust -crypto")
+	if err != nil {
+		t.Fatalf("CreateSavedSearch: %v", err)
+	}
+	gophers, err := CreateSavedSearch(db, user.ID, "Gophers", "go source:Example")
+	if err != nil {
+		t.Fatalf("CreateSavedSearch: %v", err)
+	}
+	if _, err := CreateSavedSearch(db, user.ID, "Rust", "rust"); err == nil {
+		t.Error("CreateSavedSearch allowed a duplicate name")
+	}
+	if n := unseen(rust.ID); n != 0 {
+		t.Errorf("new saved search has %d unseen matches", n)
+	}
+
+	ingest(map[string]string{
+		"rust-1": "Rust 2.0 released",
+		"rust-2": "Rust crypto scams",
+		"go-1":   "Go generics in practice",
+		"other":  "Cooking for one",
+	})
+	if n := unseen(rust.ID); n != 1 {
+		t.Errorf("Rust unseen = %d, want 1", n)
+	}
+	if n := unseen(gophers.ID); n != 1 {
+		t.Errorf("Gophers unseen = %d, want 1", n)
+	}
+
+	// Running a cycle's items again records nothing new
+	if matched, err := RunSavedSearches(db, []string{"rust-1", "go-1"}); err != nil || matched != 0 {
+		t.Errorf("RunSavedSearches again = %d, %v, want 0 new matches", matched, err)
+	}
+
+	if err := MarkSavedSearchSeen(db, user.ID, rust.ID); err != nil {
+		t.Fatalf("MarkSavedSearchSeen: %v", err)
+	}
+	if n := unseen(rust.ID); n != 0 {
+		t.Errorf("Rust unseen after marking seen = %d, want 0", n)
+	}
+
+	ingest(map[string]string{"rust-3": "Rust in the kernel"})
+	if n := unseen(rust.ID); n != 1 {
+		t.Errorf("Rust unseen after another cycle = %d, want 1", n)
+	}
+
+	searches, err := GetSavedSearches(db, user.ID)
+	if err != nil {
+		t.Fatalf("GetSavedSearches: %v", err)
+	}
+	if len(searches) != 2 || searches[0].Name != "Gophers" || searches[1].Name != "Rust" {
+		t.Fatalf("GetSavedSearches = %+v, want Gophers and Rust", searches)
+	}
+	if saved, err := GetSavedSearchByName(db, user.ID, "rust"); err != nil || saved.ID != rust.ID {
+		t.Errorf("GetSavedSearchByName = %+v, %v", saved, err)
+	}
+
+	// Changing the query drops the old matches, renaming alone keeps them
+	if err := UpdateSavedSearch(db, user.ID, rust.ID, "Rust news", "rust -crypto"); err != nil {
+		t.Fatalf("UpdateSavedSearch: %v", err)
+	}
+	if n := unseen(rust.ID); n != 1 {
+		t.Errorf("Rust unseen after renaming = %d, want 1", n)
+	}
+	if err := UpdateSavedSearch(db, user.ID, rust.ID, "Rust news", "rust kernel"); err != nil {
+		t.Fatalf("UpdateSavedSearch: %v", err)
+	}
+	if n := unseen(rust.ID); n != 0 {
+		t.Errorf("Rust unseen after changing the query = %d, want 0", n)
+	}
+
+	if err := DeleteSavedSearch(db, user.ID+1, gophers.ID); err == nil {
+		t.Error("DeleteSavedSearch removed another user's search")
+	}
+	if err := DeleteSavedSearch(db, user.ID, gophers.ID); err != nil {
+		t.Fatalf("DeleteSavedSearch: %v", err)
+	}
+	var matches int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM saved_search_matches WHERE search_id = ?`, gophers.ID).Scan(&matches); err != nil || matches != 0 {
+		t.Errorf("deleted search left %d matches, %v", matches, err)
+	}
+}
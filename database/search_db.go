@@ -0,0 +1,587 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/search"
+)
+
+// Wrapped around matched terms in search snippets before they are escaped for HTML
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+// A table kept in the SQLite full-text index.
+//
+// The index lives in <table>_fts, an FTS5 table holding the row's key plus the
+// indexed columns. Its rowid mirrors the source row's rowid so the triggers
+// can find the entry to replace without scanning the index.
+type searchIndex struct {
+	table   string
+	key     string
+	columns []string
+	// BM25 weight per indexed column, in the same order as columns
+	weights []float64
+}
+
+var (
+	feedItemsIndex    = searchIndex{table: "feed_items", key: "id", columns: []string{"title", "description", "author"}, weights: []float64{10, 4, 2}}
+	postsIndex        = searchIndex{table: "posts", key: "id", columns: []string{"title", "content"}, weights: []float64{10, 4}}
+	commentsIndex     = searchIndex{table: "comments", key: "id", columns: []string{"content"}, weights: []float64{1}}
+	postCommentsIndex = searchIndex{table: "post_comments", key: "id", columns: []string{"content"}, weights: []float64{1}}
+
+	searchIndexes = []searchIndex{feedItemsIndex, postsIndex, commentsIndex, postCommentsIndex}
+
+	// Names are short enough to always match with LIKE, so these have no full-text index
+	subverseNames = searchIndex{table: "subverses", key: "id", columns: []string{"name"}}
+	usernames     = searchIndex{table: "users", key: "id", columns: []string{"username"}}
+)
+
+func (ix searchIndex) ftsTable() string {
+	return ix.table + "_fts"
+}
+
+func (ix searchIndex) triggerNames() []string {
+	return []string{ix.ftsTable() + "_insert", ix.ftsTable() + "_delete", ix.ftsTable() + "_update"}
+}
+
+// Orders matches best first; the key column carries no weight
+func (ix searchIndex) rank() string {
+	weights := []string{"0"}
+	for _, w := range ix.weights {
+		weights = append(weights, fmt.Sprint(w))
+	}
+	return fmt.Sprintf("bm25(%s, %s)", ix.ftsTable(), strings.Join(weights, ", "))
+}
+
+// A short extract of the best matching column with the matched terms marked
+func (ix searchIndex) snippet() string {
+	return fmt.Sprintf("snippet(%s, -1, '%s', '%s', '…', 16)", ix.ftsTable(), snippetStart, snippetEnd)
+}
+
+func (ix searchIndex) createStatements() []string {
+	fts := ix.ftsTable()
+	cols := strings.Join(ix.columns, ", ")
+	newCols := "new." + strings.Join(ix.columns, ", new.")
+	insert := fmt.Sprintf("INSERT INTO %s (rowid, %s, %s) VALUES (new.rowid, new.%s, %s);", fts, ix.key, cols, ix.key, newCols)
+	remove := fmt.Sprintf("DELETE FROM %s WHERE rowid = old.rowid;", fts)
+	names := ix.triggerNames()
+
+	return []string{
+		fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s UNINDEXED, %s, tokenize = 'porter unicode61 remove_diacritics 2', prefix = '2 3')`,
+			fts, ix.key, cols),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s AFTER INSERT ON %s BEGIN %s END", names[0], ix.table, insert),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s BEGIN %s END", names[1], ix.table, remove),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE OF %s, %s ON %s BEGIN %s %s END",
+			names[2], ix.key, cols, ix.table, remove, insert),
+	}
+}
+
+// Reports whether a table is part of the full-text index, including FTS5's own shadow tables
+func isSearchIndexTable(name string) bool {
+	for _, ix := range searchIndexes {
+		if strings.HasPrefix(name, ix.ftsTable()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the SQLite library was compiled with FTS5, which needs the sqlite_fts5 build tag
+func hasFTS5(db *sqldb.DB) bool {
+	if db.Dialect != sqldb.SQLite {
+		return false
+	}
+	var enabled bool
+	err := db.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled)
+	return err == nil && enabled
+}
+
+// Reports whether searches on db can use the full-text index
+func useSearchIndex(db *sqldb.DB) bool {
+	if db.Dialect != sqldb.SQLite {
+		return false
+	}
+	exists, err := tableExists(db, feedItemsIndex.ftsTable())
+	return err == nil && exists && hasFTS5(db)
+}
+
+// Creates the SQLite full-text index and the triggers that keep it in sync.
+//
+// The index sits outside the versioned migrations because FTS5 is only there
+// when the binary was built with -tags sqlite_fts5. Whenever a table's
+// triggers are missing, because the index is new or a rollback dropped the
+// table, its index is refilled from the existing rows.
+//
+// Without FTS5 any leftover triggers are dropped, since they would make every
+// write to the indexed tables fail, and searches fall back to LIKE. It does
+// nothing on PostgreSQL.
+func EnsureSearchIndex(db *sqldb.DB) error {
+	if db.Dialect != sqldb.SQLite {
+		return nil
+	}
+
+	if !hasFTS5(db) {
+		for _, ix := range searchIndexes {
+			for _, name := range ix.triggerNames() {
+				if _, err := db.Exec("DROP TRIGGER IF EXISTS " + name); err != nil {
+					return fmt.Errorf("failed to drop search trigger %s: %w", name, err)
+				}
+			}
+		}
+		logger.Warn("SQLite was built without FTS5, search will use slower LIKE matching (build with -tags sqlite_fts5)")
+		return nil
+	}
+
+	for _, ix := range searchIndexes {
+		if err := ensureSearchIndex(db, ix); err != nil {
+			return fmt.Errorf("failed to set up search index for %s: %w", ix.table, err)
+		}
+	}
+	return nil
+}
+
+func ensureSearchIndex(db *sqldb.DB, ix searchIndex) error {
+	names := ix.triggerNames()
+	var triggers int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name IN (?, ?, ?)`,
+		names[0], names[1], names[2]).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	if triggers == len(names) {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range ix.createStatements() {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	cols := strings.Join(ix.columns, ", ")
+	if _, err := tx.Exec("DELETE FROM " + ix.ftsTable()); err != nil {
+		return err
+	}
+	result, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (rowid, %s, %s) SELECT rowid, %s, %s FROM %s",
+		ix.ftsTable(), ix.key, cols, ix.key, cols, ix.table))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	indexed, _ := result.RowsAffected()
+	logger.Info("Built search index", "table", ix.table, "rows", indexed)
+	return nil
+}
+
+// Adds the free-text expressions of a query to a select over the index's table, aliased as alias.
+//
+// With the full-text index and at least one positive term, the select is
+// driven by the index and ranked is true, so the caller can order by rank
+// and select a snippet. Otherwise the words are matched with LIKE.
+func (ix searchIndex) selectText(b squirrel.SelectBuilder, alias string, texts []search.Text, indexed bool) (_ squirrel.SelectBuilder, ranked bool) {
+	var include, exclude []search.Text
+	for _, text := range texts {
+		if text.Not {
+			exclude = append(exclude, text)
+		} else {
+			include = append(include, text)
+		}
+	}
+
+	fts := ix.ftsTable()
+	key := alias + "." + ix.key
+	if indexed && len(include) > 0 {
+		b = b.From(fts).
+			Join(fmt.Sprintf("%s %s ON %s = %s.%s", ix.table, alias, key, fts, ix.key)).
+			Where(fts+" MATCH ?", ftsMatch(include, " "))
+		ranked = true
+	} else {
+		b = b.From(ix.table + " " + alias)
+	}
+
+	if !indexed {
+		for _, text := range include {
+			b = b.Where(ix.like(alias, text))
+		}
+		for _, text := range exclude {
+			b = b.Where(not{ix.like(alias, text)})
+		}
+	} else if len(exclude) > 0 {
+		b = b.Where(fmt.Sprintf("%s NOT IN (SELECT %s FROM %s WHERE %s MATCH ?)", key, ix.key, fts, fts), ftsMatch(exclude, " OR "))
+	}
+	return b, ranked
+}
+
+// Matches a word or phrase anywhere in the indexed columns, for databases without the full-text index
+func (ix searchIndex) like(alias string, text search.Text) squirrel.Or {
+	pattern := "%" + escapeLike(strings.ToLower(strings.Join(text.Words, " "))) + "%"
+	match := squirrel.Or{}
+	for _, column := range ix.columns {
+		match = append(match, squirrel.Expr("LOWER(COALESCE("+alias+"."+column+", '')) LIKE ? ESCAPE '\\'", pattern))
+	}
+	return match
+}
+
+// Renders text expressions as an FTS5 MATCH expression, joined by sep.
+//
+// Every word is quoted so none is read as an FTS5 operator.
+func ftsMatch(texts []search.Text, sep string) string {
+	parts := make([]string, len(texts))
+	for i, text := range texts {
+		parts[i] = `"` + strings.Join(text.Words, " ") + `"`
+		if text.Prefix {
+			parts[i] += "*"
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Escapes LIKE's wildcards so a value matches literally, for patterns
+// compared with ESCAPE '\'
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+// Negates a condition
+type not struct {
+	squirrel.Sqlizer
+}
+
+func (n not) ToSql() (string, []any, error) {
+	clause, args, err := n.Sqlizer.ToSql()
+	return "NOT (" + clause + ")", args, err
+}
+
+// Turns a field filter into a condition on the fi and fs aliases used by the feed item queries
+func feedItemFilter(dialect sqldb.Dialect, expr search.Expr) squirrel.Sqlizer {
+	var cond squirrel.Sqlizer
+	switch e := expr.(type) {
+	case search.Match:
+		switch e.Field {
+		case search.Source:
+			cond = squirrel.Expr("LOWER(fs.name) = LOWER(?)", e.Value)
+		case search.Author:
+			cond = squirrel.Expr("LOWER(COALESCE(fi.author, '')) LIKE ? ESCAPE '\\'", "%"+escapeLike(strings.ToLower(e.Value))+"%")
+		case search.Domain:
+			// The domain itself or any subdomain, with or without a path
+			url := "LOWER(fi.url) LIKE ? ESCAPE '\\'"
+			domain := escapeLike(e.Value)
+			cond = squirrel.Or{
+				squirrel.Expr(url, "%://"+domain),
+				squirrel.Expr(url, "%://"+domain+"/%"),
+				squirrel.Expr(url, "%://%."+domain),
+				squirrel.Expr(url, "%://%."+domain+"/%"),
+			}
+		case search.Tag:
+			// Tags are the subverses a source belongs to, as in webhook tag rules
+			cond = squirrel.Expr(`EXISTS (
+				SELECT 1 FROM subverse_feeds sf
+				JOIN subverses s ON s.id = sf.subverse_id
+				WHERE sf.feed_source_id = fi.source_id AND s.name = LOWER(?)
+			)`, e.Value)
+		}
+
+	case search.Compare:
+		column := "COALESCE(fi.score, 0)"
+		if e.Field == search.Comments {
+			column = "COALESCE(fi.comments_count, 0)"
+		}
+		cond = squirrel.Expr(column+" "+string(e.Op)+" ?", e.Value)
+
+	case search.Date:
+		op := ">="
+		if e.Field == search.Before {
+			op = "<"
+		}
+		cond = squirrel.Expr(dialect.Datetime("fi.published_at")+" "+op+" ?", e.Value.UTC().Format("2006-01-02 15:04:05"))
+	}
+
+	if cond == nil {
+		return squirrel.Expr("1 = 1")
+	}
+	if expr.Negated() {
+		return not{cond}
+	}
+	return cond
+}
+
+// Escapes a snippet for HTML and turns the match markers into <mark> tags
+func highlight(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(snippetStart, "<mark>", snippetEnd, "</mark>").Replace(escaped)
+}
+
+// Selects the given columns of the feed items matching a query.
+//
+// The builder reads from feed items aliased fi joined with their source as
+// fs. It is ranked when the free text was looked up in the full-text index.
+func selectFeedItemSearch(db *sqldb.DB, query *search.Query, columns ...string) (_ squirrel.SelectBuilder, ranked bool) {
+	builder, ranked := feedItemsIndex.selectText(squirrel.Select(columns...), "fi", query.Text(), useSearchIndex(db))
+	builder = builder.
+		Join("feed_sources fs ON fi.source_id = fs.id").
+		Where("fs.url NOT LIKE ?", feeds.NewsletterURLPrefix+"%")
+	for _, expr := range query.Exprs {
+		if _, ok := expr.(search.Text); !ok {
+			builder = builder.Where(feedItemFilter(db.Dialect, expr))
+		}
+	}
+	return builder, ranked
+}
+
+// Runs a feed item search query, best matches first.
+//
+// Free text is looked up in the full-text index when there is one, in which
+// case each result carries a highlighted snippet; otherwise it is matched with
+// LIKE and results come newest first. Field filters narrow the results either
+// way.
+func SearchFeedItems(db *sqldb.DB, query *search.Query, limit, offset int) ([]feeds.FeedItem, error) {
+	if query.Empty() {
+		return nil, nil
+	}
+
+	ix := feedItemsIndex
+	builder, ranked := selectFeedItemSearch(db, query, feedItemColumns...)
+	if ranked {
+		builder = builder.Column(ix.snippet()).OrderBy(ix.rank())
+	}
+	sqlQuery, args, err := builder.
+		OrderBy("fi.published_at DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search feed items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []feeds.FeedItem
+	for rows.Next() {
+		var item feeds.FeedItem
+		var description, author, snippet sql.NullString
+		dest := []any{&item.ID, &item.SourceID, &item.Title, &item.URL, &description,
+			&author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &item.SourceName}
+		if ranked {
+			dest = append(dest, &snippet)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		item.Description = description.String
+		item.Author = author.String
+		if ranked {
+			item.Snippet = highlight(snippet.String)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Columns of posts read by queryPosts
+var postSearchColumns = []string{"p.id", "p.subverse_id", "p.user_id", "u.username", "p.title",
+	"p.content", "p.post_type", "p.url", "p.score", "p.created_at", "p.updated_at"}
+
+// Selects the given columns of the posts matching free text, from posts
+// aliased p joined with their author as u
+func selectPostSearch(db *sqldb.DB, texts []search.Text, columns ...string) (_ squirrel.SelectBuilder, ranked bool) {
+	builder, ranked := postsIndex.selectText(squirrel.Select(columns...), "p", texts, useSearchIndex(db))
+	return builder.Join("users u ON p.user_id = u.id"), ranked
+}
+
+// Runs a post search selecting postSearchColumns, best matches first
+func queryPosts(db *sqldb.DB, builder squirrel.SelectBuilder, ranked bool, limit, offset int) ([]models.Post, error) {
+	if ranked {
+		builder = builder.Column(postsIndex.snippet()).OrderBy(postsIndex.rank())
+	}
+	sqlQuery, args, err := builder.
+		OrderBy("p.created_at DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		var content, url, snippet sql.NullString
+		dest := []any{
+			&post.ID, &post.SubverseID, &post.UserID, &post.Username,
+			&post.Title, &content, &post.PostType, &url, &post.Score,
+			&post.CreatedAt, &post.UpdatedAt,
+		}
+		if ranked {
+			dest = append(dest, &snippet)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan post: %w", err)
+		}
+
+		post.Content = content.String
+		post.URL = url.String
+		if ranked {
+			post.Snippet = highlight(snippet.String)
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// Searches post titles and content within a subverse, best matches first.
+//
+// The query is free text only (see search.ParseText); an empty one lists the
+// subverse's posts instead.
+func SearchPostsBySubverse(db *sqldb.DB, subverseID int, query string, limit, offset int) ([]models.Post, error) {
+	parsed := search.ParseText(query)
+	if parsed.Empty() {
+		return GetPostsBySubverse(db, subverseID, limit, offset)
+	}
+
+	builder, ranked := selectPostSearch(db, parsed.Text(), postSearchColumns...)
+	return queryPosts(db, builder.Where(squirrel.Eq{"p.subverse_id": subverseID}), ranked, limit, offset)
+}
+
+// Columns of feed item comments read by queryComments
+var commentSearchColumns = []string{"c.id", "c.item_id", "c.user_id", "c.username", "c.content",
+	"c.parent_id", "c.created_at", "c.updated_at"}
+
+// Selects the given columns of the feed item comments matching free text, aliased c
+func selectCommentSearch(db *sqldb.DB, texts []search.Text, columns ...string) (_ squirrel.SelectBuilder, ranked bool) {
+	return commentsIndex.selectText(squirrel.Select(columns...), "c", texts, useSearchIndex(db))
+}
+
+// Runs a feed item comment search selecting commentSearchColumns, best matches first
+func queryComments(db *sqldb.DB, builder squirrel.SelectBuilder, ranked bool, limit, offset int) ([]models.Comment, error) {
+	if ranked {
+		builder = builder.Column(commentsIndex.snippet()).OrderBy(commentsIndex.rank())
+	}
+	sqlQuery, args, err := builder.
+		OrderBy("c.created_at DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		var snippet sql.NullString
+		dest := []any{
+			&comment.ID, &comment.ItemID, &comment.UserID, &comment.Username,
+			&comment.Content, &comment.ParentID, &comment.CreatedAt, &comment.UpdatedAt,
+		}
+		if ranked {
+			dest = append(dest, &snippet)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		if ranked {
+			comment.Snippet = highlight(snippet.String)
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// Searches the content of comments on feed items, best matches first.
+//
+// The query is free text only, see search.ParseText.
+func SearchComments(db *sqldb.DB, query string, limit, offset int) ([]models.Comment, error) {
+	parsed := search.ParseText(query)
+	if parsed.Empty() {
+		return nil, nil
+	}
+
+	builder, ranked := selectCommentSearch(db, parsed.Text(), commentSearchColumns...)
+	return queryComments(db, builder, ranked, limit, offset)
+}
+
+// Columns of post comments read by queryPostComments
+var postCommentSearchColumns = []string{"pc.id", "pc.post_id", "pc.user_id", "pc.username", "pc.content",
+	"pc.parent_id", "pc.created_at", "pc.updated_at"}
+
+// Selects the given columns of the post comments matching free text, aliased pc
+func selectPostCommentSearch(db *sqldb.DB, texts []search.Text, columns ...string) (_ squirrel.SelectBuilder, ranked bool) {
+	return postCommentsIndex.selectText(squirrel.Select(columns...), "pc", texts, useSearchIndex(db))
+}
+
+// Runs a post comment search selecting postCommentSearchColumns, best matches first
+func queryPostComments(db *sqldb.DB, builder squirrel.SelectBuilder, ranked bool, limit, offset int) ([]models.PostComment, error) {
+	if ranked {
+		builder = builder.Column(postCommentsIndex.snippet()).OrderBy(postCommentsIndex.rank())
+	}
+	sqlQuery, args, err := builder.
+		OrderBy("pc.created_at DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset)).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search post comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []models.PostComment
+	for rows.Next() {
+		var comment models.PostComment
+		var parentID, snippet sql.NullString
+		dest := []any{
+			&comment.ID, &comment.PostID, &comment.UserID, &comment.Username,
+			&comment.Content, &parentID, &comment.CreatedAt, &comment.UpdatedAt,
+		}
+		if ranked {
+			dest = append(dest, &snippet)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan post comment: %w", err)
+		}
+		if parentID.Valid {
+			comment.ParentID = &parentID.String
+		}
+		if ranked {
+			comment.Snippet = highlight(snippet.String)
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
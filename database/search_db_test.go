@@ -0,0 +1,327 @@
+package database
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/search"
+)
+
+func TestFTSMatch(t *testing.T) {
+	q := search.ParseText(`"open sour"* NEAR rust* -go`)
+	if got, want := ftsMatch(q.Text(), " "), `"open sour"* "NEAR" "rust"* "go"`; got != want {
+		t.Errorf("ftsMatch = %q, want %q", got, want)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight("a <b> " + snippetStart + "match" + snippetEnd + " & more")
+	if want := "a &lt;b&gt; <mark>match</mark> &amp; more"; got != want {
+		t.Errorf("highlight = %q, want %q", got, want)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if err := EnsureSearchIndex(db); err != nil {
+			t.Fatalf("EnsureSearchIndex: %v", err)
+		}
+		testSearch(t, db)
+	})
+}
+
+// Seeds a few rows and checks the matching rules shared by the FTS5 and LIKE searches
+func testSearch(t *testing.T, db *sqldb.DB) {
+	indexed := useSearchIndex(db)
+	t.Logf("full-text index in use: %v", indexed)
+
+	if err := CreateUser(db, "reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := GetUserByEmail(db, "reader@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	var sourceID int
+	if err := db.QueryRow(`INSERT INTO feed_sources (name, url) VALUES ('Example', 'https://example.com/feed') RETURNING id`).Scan(&sourceID); err != nil {
+		t.Fatalf("failed to insert source: %v", err)
+	}
+
+	published := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	items := []struct{ id, title, description string }{
+		{"databases", "Databases in practice", "Open source engines compared"},
+		{"source", "Open by default", "Why the tools we read matter"},
+		{"cooking", "Cooking for one", "Recipes for open kitchens"},
+	}
+	for i, item := range items {
+		_, err := db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author, published_at) VALUES (?, ?, ?, ?, ?, '', ?)`,
+			item.id, sourceID, item.title, "https://example.com/"+item.id, item.description, published.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+
+	ids := func(query string, limit, offset int) []string {
+		t.Helper()
+		parsed, err := search.Parse(query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", query, err)
+		}
+		found, err := SearchFeedItems(db, parsed, limit, offset)
+		if err != nil {
+			t.Fatalf("SearchFeedItems(%q): %v", query, err)
+		}
+		var ids []string
+		for _, item := range found {
+			ids = append(ids, item.ID)
+		}
+		return ids
+	}
+
+	if got := ids(`"open source"`, 10, 0); !reflect.DeepEqual(got, []string{"databases"}) {
+		t.Errorf("phrase search = %v, want [databases]", got)
+	}
+	if got := ids("databa*", 10, 0); !reflect.DeepEqual(got, []string{"databases"}) {
+		t.Errorf("prefix search = %v, want [databases]", got)
+	}
+	if got := ids("open recipes", 10, 0); !reflect.DeepEqual(got, []string{"cooking"}) {
+		t.Errorf("search with two words = %v, want [cooking]", got)
+	}
+	if got := ids("missing", 10, 0); len(got) != 0 {
+		t.Errorf("search without matches = %v", got)
+	}
+	if got := ids(`" "`, 10, 0); len(got) != 0 {
+		t.Errorf("search without words = %v", got)
+	}
+
+	all := ids("open", 10, 0)
+	if len(all) != 3 {
+		t.Fatalf("search for open = %v, want every item", all)
+	}
+	if indexed && all[0] != "source" {
+		t.Errorf("ranked results = %v, want the title match first", all)
+	}
+	paged := append(ids("open", 2, 0), ids("open", 2, 2)...)
+	if !reflect.DeepEqual(paged, all) {
+		t.Errorf("paged results = %v, want %v", paged, all)
+	}
+
+	if indexed {
+		found, _ := SearchFeedItems(db, search.ParseText("engines"), 10, 0)
+		if len(found) != 1 || !strings.Contains(found[0].Snippet, "<mark>engines</mark>") {
+			t.Errorf("snippet = %+v", found)
+		}
+
+		// The triggers keep the index in step with updates and deletes
+		if _, err := db.Exec(`UPDATE feed_items SET title = 'Baking for one' WHERE id = 'cooking'`); err != nil {
+			t.Fatal(err)
+		}
+		if got := ids("baking", 10, 0); !reflect.DeepEqual(got, []string{"cooking"}) {
+			t.Errorf("search after update = %v", got)
+		}
+		if got := ids("cooking", 10, 0); len(got) != 0 {
+			t.Errorf("old title still indexed: %v", got)
+		}
+		if _, err := db.Exec(`DELETE FROM feed_items WHERE id = 'cooking'`); err != nil {
+			t.Fatal(err)
+		}
+		if got := ids("baking", 10, 0); len(got) != 0 {
+			t.Errorf("deleted item still indexed: %v", got)
+		}
+	}
+
+	subverse, err := CreateSubverse(db, "golang")
+	if err != nil {
+		t.Fatalf("CreateSubverse: %v", err)
+	}
+	if _, err := CreatePost(db, subverse.ID, user.ID, user.Username, "Generics explained", "Type parameters in depth", "text", ""); err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	if _, err := CreatePost(db, subverse.ID, user.ID, user.Username, "Errors", "Wrapping with %w", "text", ""); err != nil {
+		t.Fatalf("CreatePost: %v", err)
+	}
+	// Words never carry LIKE's wildcards out of the parser, but they must
+	// still match literally if they get there
+	query, args, err := squirrel.Select("p.title").From("posts p").Where(postsIndex.like("p", search.Text{Words: []string{"%"}})).ToSql()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("LIKE search for %%: %v", err)
+	}
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			t.Fatal(err)
+		}
+		titles = append(titles, title)
+	}
+	rows.Close()
+	if !reflect.DeepEqual(titles, []string{"Errors"}) {
+		t.Errorf("LIKE search for a literal %% = %v, want [Errors]", titles)
+	}
+
+	posts, err := SearchPostsBySubverse(db, subverse.ID, "param*", 10, 0)
+	if err != nil || len(posts) != 1 || posts[0].Title != "Generics explained" {
+		t.Errorf("SearchPostsBySubverse = %+v, %v", posts, err)
+	}
+	if posts, _ := SearchPostsBySubverse(db, subverse.ID, "", 10, 0); len(posts) != 2 {
+		t.Errorf("empty post search = %d posts, want every post", len(posts))
+	}
+
+	if _, err := CreateComment(db, "databases", user.ID, user.Username, "Great comparison of engines", nil); err != nil {
+		t.Fatalf("CreateComment: %v", err)
+	}
+	comments, err := SearchComments(db, "comparison", 10, 0)
+	if err != nil || len(comments) != 1 || comments[0].ItemID != "databases" {
+		t.Errorf("SearchComments = %+v, %v", comments, err)
+	}
+}
+
+func TestEnsureSearchIndexRebuilds(t *testing.T) {
+	db := openTestDB(t)
+	if !hasFTS5(db) {
+		t.Skip("SQLite built without FTS5, run with -tags sqlite_fts5")
+	}
+	if _, err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO feed_sources (name, url) VALUES ('Example', 'https://example.com/feed')`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author) VALUES ('old', 1, 'Written before indexing', 'https://example.com/old', '', '')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EnsureSearchIndex(db); err != nil {
+		t.Fatalf("EnsureSearchIndex: %v", err)
+	}
+	if found, _ := SearchFeedItems(db, search.ParseText("indexing"), 10, 0); len(found) != 1 {
+		t.Errorf("existing rows were not indexed: %+v", found)
+	}
+
+	// Losing a trigger means the index may have missed writes, so it is rebuilt
+	db.Exec(`DROP TRIGGER feed_items_fts_insert`)
+	db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author) VALUES ('missed', 1, 'Written while unindexed', 'https://example.com/missed', '', '')`)
+	if err := EnsureSearchIndex(db); err != nil {
+		t.Fatalf("EnsureSearchIndex: %v", err)
+	}
+	if found, _ := SearchFeedItems(db, search.ParseText("unindexed"), 10, 0); len(found) != 1 {
+		t.Errorf("index was not rebuilt: %+v", found)
+	}
+
+	tables, err := listTables(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range tables {
+		if isSearchIndexTable(table) {
+			t.Errorf("listTables includes search index table %s", table)
+		}
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if err := EnsureSearchIndex(db); err != nil {
+			t.Fatalf("EnsureSearchIndex: %v", err)
+		}
+		testSearchFilters(t, db)
+	})
+}
+
+func testSearchFilters(t *testing.T, db *sqldb.DB) {
+	sources := map[string]int{}
+	for _, name := range []string{"Hacker News", "Lobsters", "Blogs"} {
+		var id int
+		err := db.QueryRow(`INSERT INTO feed_sources (name, url) VALUES (?, ?) RETURNING id`, name, "https://"+name+"/feed").Scan(&id)
+		if err != nil {
+			t.Fatalf("failed to insert source: %v", err)
+		}
+		sources[name] = id
+	}
+	golang, err := CreateSubverse(db, "go")
+	if err != nil {
+		t.Fatalf("CreateSubverse: %v", err)
+	}
+	if err := AddFeedToSubverse(db, golang.ID, sources["Lobsters"]); err != nil {
+		t.Fatalf("AddFeedToSubverse: %v", err)
+	}
+
+	items := []struct {
+		id, source, title, url, author string
+		score, comments                int
+		published                      string
+	}{
+		{"hn-go", "Hacker News", "Go 1.26 released", "https://go.dev/blog/go1.26", "gopher", 250, 80, "2026-02-10"},
+		{"hn-crypto", "Hacker News", "Crypto winter again", "https://news.example.com/crypto", "satoshi", 120, 10, "2026-03-01"},
+		{"lob-gh", "Lobsters", "A Go linter on GitHub", "https://github.com/foo/lint", "foo", 40, 25, "2025-12-24"},
+		{"lob-gist", "Lobsters", "Go snippets", "https://gist.github.com/bar/1", "bar", 5, 0, "2026-07-01"},
+		// Underscores and percent signs have to match literally, not as LIKE wildcards
+		{"blog-under", "Blogs", "Notes", "https://my_blog.example.org/notes", "jane_doe", 1, 0, "2026-08-01"},
+		{"blog-plain", "Blogs", "More notes", "https://myxblog.example.org/notes", "janeXdoe 100%", 1, 0, "2026-08-01"},
+	}
+	for _, item := range items {
+		published, _ := time.Parse("2006-01-02", item.published)
+		_, err := db.Exec(`INSERT INTO feed_items (id, source_id, title, url, description, author, published_at, score, comments_count) VALUES (?, ?, ?, ?, '', ?, ?, ?, ?)`,
+			item.id, sources[item.source], item.title, item.url, item.author, published, item.score, item.comments)
+		if err != nil {
+			t.Fatalf("failed to insert item: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`source:"hacker news"`, []string{"hn-crypto", "hn-go"}},
+		{"-source:lobsters go", []string{"hn-go"}},
+		{"author:GOPH", []string{"hn-go"}},
+		{"score:>100", []string{"hn-crypto", "hn-go"}},
+		{"score:<=40 comments:>20", []string{"lob-gh"}},
+		{"score:5", []string{"lob-gist"}},
+		{"after:2026-01-01 before:2026-06-01", []string{"hn-crypto", "hn-go"}},
+		{"before:2026-02-10", []string{"lob-gh"}},
+		{"domain:github.com", []string{"lob-gh", "lob-gist"}},
+		{"domain:gist.github.com", []string{"lob-gist"}},
+		{"tag:Go", []string{"lob-gh", "lob-gist"}},
+		{"author:jane_doe", []string{"blog-under"}},
+		{"author:%", []string{"blog-plain"}},
+		{`author:\`, nil},
+		{"domain:my_blog.example.org", []string{"blog-under"}},
+		{"go -crypto -github", []string{"hn-go", "lob-gist"}},
+		{`source:"Hacker News" author:foo score:>100 comments:>20 after:2026-01-01 before:2026-06-01 domain:github.com tag:go -crypto`, nil},
+	}
+	for _, tt := range tests {
+		parsed, err := search.Parse(tt.query)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.query, err)
+		}
+		found, err := SearchFeedItems(db, parsed, 10, 0)
+		if err != nil {
+			t.Errorf("SearchFeedItems(%q): %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, item := range found {
+			got = append(got, item.ID)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchFeedItems(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -5,15 +5,16 @@ import (
 	"time"
 
 	"github.com/Masterminds/squirrel"
+	"github.com/navid-m/versed/database/sqldb"
 )
 
 // Implements database-backed session storage
 type DBSessionStorage struct {
-	db *sql.DB
+	db *sqldb.DB
 }
 
 // Creates a new database-backed session storage
-func NewDBSessionStorage(db *sql.DB) *DBSessionStorage {
+func NewDBSessionStorage(db *sqldb.DB) *DBSessionStorage {
 	return &DBSessionStorage{db: db}
 }
 
@@ -27,7 +28,7 @@ func (s *DBSessionStorage) Get(key string) ([]byte, error) {
 		Where(squirrel.Eq{"session_id": key}).
 		Where(squirrel.Or{
 			squirrel.Eq{"expires_at": nil},
-			squirrel.Expr("expires_at > datetime('now')"),
+			squirrel.Expr("expires_at > CURRENT_TIMESTAMP"),
 		}).ToSql()
 
 	if err != nil {
@@ -57,7 +58,7 @@ func (s *DBSessionStorage) Set(key string, val []byte, exp time.Duration) error
 
 	sqlQuery, args, err := squirrel.Insert("sessions").
 		Columns("session_id", "data", "updated_at", "expires_at").
-		Values(key, data, squirrel.Expr("datetime('now')"), expiresAt).
+		Values(key, data, squirrel.Expr("CURRENT_TIMESTAMP"), expiresAt).
 		Suffix("ON CONFLICT(session_id) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at, expires_at = EXCLUDED.expires_at").
 		ToSql()
 
@@ -91,6 +92,27 @@ func (s *DBSessionStorage) Reset() error {
 	return err
 }
 
+// Ends every session signed in as the given user
+func (s *DBSessionStorage) DeleteForUser(userID int) error {
+	return DeleteUserSessions(s.db, userID)
+}
+
+// Counts the sessions that have not expired
+func CountActiveSessions(db *sqldb.DB) (int, error) {
+	sqlQuery, args, err := squirrel.Select("COUNT(*)").
+		From("sessions").
+		Where(squirrel.Or{
+			squirrel.Eq{"expires_at": nil},
+			squirrel.Expr("expires_at > CURRENT_TIMESTAMP"),
+		}).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	err = db.QueryRow(sqlQuery, args...).Scan(&count)
+	return count, err
+}
+
 // Close is a no-op for database storage
 func (s *DBSessionStorage) Close() error {
 	return nil
@@ -0,0 +1,228 @@
+// Package sqldb wraps database/sql with awareness of the SQL dialect behind
+// it, so the rest of the code can write queries once with ? placeholders and
+// run them against either SQLite or PostgreSQL.
+//
+// Every query passed through DB or Tx is rebound with the dialect's squirrel
+// placeholder format, which covers both hand-written SQL and the output of
+// squirrel builders using the default question-mark format.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/navid-m/versed/metrics"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// How long statements take, by kind. For queries returning rows the time is
+// until the first row is ready, not until every row has been read.
+var queryDuration = metrics.NewHistogram("versed_db_query_duration_seconds",
+	"Time taken by database statements, by kind of statement.", metrics.DefaultBuckets, "op")
+
+// The SQL dialect spoken by a database
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Used when no DSN is configured
+const DefaultDSN = "./data.db"
+
+// Returns the squirrel placeholder format for the dialect
+func (d Dialect) PlaceholderFormat() squirrel.PlaceholderFormat {
+	if d == Postgres {
+		return squirrel.Dollar
+	}
+	return squirrel.Question
+}
+
+// Rewrites ? placeholders into the dialect's format
+func (d Dialect) Rebind(query string) string {
+	if d == SQLite || !strings.Contains(query, "?") {
+		return query
+	}
+	rebound, err := d.PlaceholderFormat().ReplacePlaceholders(query)
+	if err != nil {
+		return query
+	}
+	return rebound
+}
+
+// Wraps a timestamp column so it compares correctly against a
+// "2006-01-02 15:04:05" UTC string.
+//
+// SQLite stores timestamps as text in whatever format they were written in,
+// so they are normalised with datetime(). PostgreSQL compares them natively.
+func (d Dialect) Datetime(expr string) string {
+	if d == Postgres {
+		return expr
+	}
+	return "datetime(" + expr + ")"
+}
+
+// Works out the dialect and driver-specific data source from a DSN.
+//
+// postgres:// and postgresql:// URLs select PostgreSQL. Anything else is
+// treated as a SQLite path, optionally prefixed with sqlite://.
+func ParseDSN(dsn string) (Dialect, string) {
+	switch {
+	case dsn == "":
+		return SQLite, DefaultDSN
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return Postgres, dsn
+	case strings.HasPrefix(dsn, "sqlite://"):
+		return SQLite, strings.TrimPrefix(dsn, "sqlite://")
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return SQLite, strings.TrimPrefix(dsn, "sqlite:")
+	}
+	return SQLite, dsn
+}
+
+// A database handle that rebinds queries for its dialect
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Wraps an already opened database
+func New(db *sql.DB, dialect Dialect) *DB {
+	return &DB{DB: db, Dialect: dialect}
+}
+
+// Opens the database described by dsn
+func Open(dsn string) (*DB, error) {
+	dialect, source := ParseDSN(dsn)
+
+	switch dialect {
+	case Postgres:
+		config, err := pgx.ParseConfig(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid postgres DSN: %w", err)
+		}
+		// Timestamps are written as UTC strings throughout, so the session
+		// has to agree on what a zone-less timestamp means.
+		config.RuntimeParams["timezone"] = "UTC"
+		db := stdlib.OpenDB(*config)
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+		}
+		return New(db, Postgres), nil
+
+	default:
+		db, err := sql.Open("sqlite3", source)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return New(db, SQLite), nil
+	}
+}
+
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	defer queryDuration.ObserveSince(time.Now(), "exec")
+	return db.DB.Exec(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer queryDuration.ObserveSince(time.Now(), "exec")
+	return db.DB.ExecContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	defer queryDuration.ObserveSince(time.Now(), "query")
+	return db.DB.Query(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer queryDuration.ObserveSince(time.Now(), "query")
+	return db.DB.QueryContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	defer queryDuration.ObserveSince(time.Now(), "query_row")
+	return db.DB.QueryRow(db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer queryDuration.ObserveSince(time.Now(), "query_row")
+	return db.DB.QueryRowContext(ctx, db.Dialect.Rebind(query), args...)
+}
+
+func (db *DB) Prepare(query string) (*sql.Stmt, error) {
+	return db.DB.Prepare(db.Dialect.Rebind(query))
+}
+
+func (db *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return db.DB.PrepareContext(ctx, db.Dialect.Rebind(query))
+}
+
+func (db *DB) Begin() (*Tx, error) {
+	return db.BeginTx(context.Background(), nil)
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, Dialect: db.Dialect}, nil
+}
+
+// A transaction that rebinds queries for its dialect
+type Tx struct {
+	*sql.Tx
+	Dialect Dialect
+}
+
+func (tx *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	defer queryDuration.ObserveSince(time.Now(), "exec")
+	return tx.Tx.Exec(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	defer queryDuration.ObserveSince(time.Now(), "exec")
+	return tx.Tx.ExecContext(ctx, tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	defer queryDuration.ObserveSince(time.Now(), "query")
+	return tx.Tx.Query(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	defer queryDuration.ObserveSince(time.Now(), "query")
+	return tx.Tx.QueryContext(ctx, tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryRow(query string, args ...any) *sql.Row {
+	defer queryDuration.ObserveSince(time.Now(), "query_row")
+	return tx.Tx.QueryRow(tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	defer queryDuration.ObserveSince(time.Now(), "query_row")
+	return tx.Tx.QueryRowContext(ctx, tx.Dialect.Rebind(query), args...)
+}
+
+func (tx *Tx) Prepare(query string) (*sql.Stmt, error) {
+	return tx.Tx.Prepare(tx.Dialect.Rebind(query))
+}
+
+func (tx *Tx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return tx.Tx.PrepareContext(ctx, tx.Dialect.Rebind(query))
+}
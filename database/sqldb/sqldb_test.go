@@ -0,0 +1,35 @@
+package sqldb
+
+import "testing"
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		dialect Dialect
+		source  string
+	}{
+		{"", SQLite, DefaultDSN},
+		{"./data.db", SQLite, "./data.db"},
+		{"sqlite:///var/lib/versed.db", SQLite, "/var/lib/versed.db"},
+		{"sqlite:versed.db", SQLite, "versed.db"},
+		{"postgres://versed@localhost/versed", Postgres, "postgres://versed@localhost/versed"},
+		{"postgresql://localhost/versed?sslmode=disable", Postgres, "postgresql://localhost/versed?sslmode=disable"},
+	}
+	for _, tt := range tests {
+		dialect, source := ParseDSN(tt.dsn)
+		if dialect != tt.dialect || source != tt.source {
+			t.Errorf("ParseDSN(%q) = %s, %q; want %s, %q", tt.dsn, dialect, source, tt.dialect, tt.source)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := `SELECT * FROM users WHERE email = ? AND id > ?`
+	if got := SQLite.Rebind(query); got != query {
+		t.Errorf("SQLite.Rebind changed the query: %s", got)
+	}
+	want := `SELECT * FROM users WHERE email = $1 AND id > $2`
+	if got := Postgres.Rebind(query); got != want {
+		t.Errorf("Postgres.Rebind = %s, want %s", got, want)
+	}
+}
@@ -1,35 +1,30 @@
 package database
 
 import (
-	"database/sql"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/navid-m/versed/database/sqldb"
 	"github.com/navid-m/versed/feeds"
 	"github.com/navid-m/versed/models"
 )
 
 // Creates a new subverse
-func CreateSubverse(db *sql.DB, name string) (*models.Subverse, error) {
+func CreateSubverse(db *sqldb.DB, name string) (*models.Subverse, error) {
 	name = strings.ToLower(strings.TrimSpace(name))
 	if name == "" {
 		return nil, fmt.Errorf("subverse name cannot be empty")
 	}
 
-	query := `INSERT INTO subverses (name) VALUES (?)`
-	result, err := db.Exec(query, name)
-	if err != nil {
+	query := `INSERT INTO subverses (name) VALUES (?) RETURNING id`
+	var id int
+	if err := db.QueryRow(query, name).Scan(&id); err != nil {
 		return nil, fmt.Errorf("failed to create subverse: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get subverse ID: %w", err)
-	}
-
 	subverse := &models.Subverse{
-		ID:        int(id),
+		ID:        id,
 		Name:      name,
 		CreatedAt: time.Now(),
 	}
@@ -38,7 +33,7 @@ func CreateSubverse(db *sql.DB, name string) (*models.Subverse, error) {
 }
 
 // Retrieves all subverses
-func GetSubverses(db *sql.DB) ([]models.Subverse, error) {
+func GetSubverses(db *sqldb.DB) ([]models.Subverse, error) {
 	query := `SELECT id, name, created_at FROM subverses ORDER BY name`
 	rows, err := db.Query(query)
 	if err != nil {
@@ -59,24 +54,46 @@ func GetSubverses(db *sql.DB) ([]models.Subverse, error) {
 	return subverses, nil
 }
 
+// Retrieves a subverse by its ID
+func GetSubverseByID(db *sqldb.DB, id int) (*models.Subverse, error) {
+	var subverse models.Subverse
+	err := db.QueryRow(`SELECT id, name, created_at FROM subverses WHERE id = ?`, id).
+		Scan(&subverse.ID, &subverse.Name, &subverse.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &subverse, nil
+}
+
+// Retrieves a subverse by its name
+func GetSubverseByName(db *sqldb.DB, name string) (*models.Subverse, error) {
+	var subverse models.Subverse
+	err := db.QueryRow(`SELECT id, name, created_at FROM subverses WHERE name = ?`, name).
+		Scan(&subverse.ID, &subverse.Name, &subverse.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &subverse, nil
+}
+
 // Adds a feed source to a subverse
-func AddFeedToSubverse(db *sql.DB, subverseID, feedSourceID int) error {
+func AddFeedToSubverse(db *sqldb.DB, subverseID, feedSourceID int) error {
 	query := `INSERT INTO subverse_feeds (subverse_id, feed_source_id) VALUES (?, ?)`
 	_, err := db.Exec(query, subverseID, feedSourceID)
 	return err
 }
 
 // Removes a feed source from a subverse
-func RemoveFeedFromSubverse(db *sql.DB, subverseID, feedSourceID int) error {
+func RemoveFeedFromSubverse(db *sqldb.DB, subverseID, feedSourceID int) error {
 	query := `DELETE FROM subverse_feeds WHERE subverse_id = ? AND feed_source_id = ?`
 	_, err := db.Exec(query, subverseID, feedSourceID)
 	return err
 }
 
 // Gets all feed sources associated with a subverse
-func GetSubverseFeeds(db *sql.DB, subverseID int) ([]feeds.FeedSource, error) {
+func GetSubverseFeeds(db *sqldb.DB, subverseID int) ([]feeds.FeedSource, error) {
 	query := `
-		SELECT fs.id, fs.name, fs.url, fs.last_updated, fs.update_interval
+		SELECT fs.id, fs.name, fs.url, fs.last_updated, fs.update_interval, fs.disabled
 		FROM feed_sources fs
 		INNER JOIN subverse_feeds sf ON fs.id = sf.feed_source_id
 		WHERE sf.subverse_id = ?
@@ -91,7 +108,7 @@ func GetSubverseFeeds(db *sql.DB, subverseID int) ([]feeds.FeedSource, error) {
 	var sources []feeds.FeedSource
 	for rows.Next() {
 		var source feeds.FeedSource
-		err := rows.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval)
+		err := rows.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval, &source.Disabled)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan feed: %w", err)
 		}
@@ -102,7 +119,7 @@ func GetSubverseFeeds(db *sql.DB, subverseID int) ([]feeds.FeedSource, error) {
 }
 
 // Gets feed items from feeds associated with a subverse
-func GetSubverseFeedItems(db *sql.DB, subverseID int, limit int) ([]feeds.FeedItem, error) {
+func GetSubverseFeedItems(db *sqldb.DB, subverseID int, limit int) ([]feeds.FeedItem, error) {
 	query := `
 		SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author, fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name
 		FROM feed_items fi
@@ -132,17 +149,8 @@ func GetSubverseFeedItems(db *sql.DB, subverseID int, limit int) ([]feeds.FeedIt
 }
 
 // Updates the post count for a subverse
-func UpdateSubversePostCount(db *sql.DB, subverseID int) error {
-	var column string
-	err := db.QueryRow("SELECT 1 FROM pragma_table_info('subverses') WHERE name='post_count'").Scan(&column)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil
-		} else {
-			return err
-		}
-	}
+func UpdateSubversePostCount(db *sqldb.DB, subverseID int) error {
 	query := `UPDATE subverses SET post_count = post_count + 1 WHERE id = ?`
-	_, err = db.Exec(query, subverseID)
+	_, err := db.Exec(query, subverseID)
 	return err
 }
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+// Set to a postgres:// URL to also run the database tests against PostgreSQL.
+// Each test gets its own schema, which is dropped afterwards.
+const testPostgresEnv = "VERSED_TEST_POSTGRES_DSN"
+
+// Opens an empty SQLite database in a temporary directory
+func openTestDB(t *testing.T) *sqldb.DB {
+	t.Helper()
+	testDB, err := sqldb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { testDB.Close() })
+	return testDB
+}
+
+// Opens a fresh schema in the PostgreSQL database named by VERSED_TEST_POSTGRES_DSN,
+// skipping the test when it is unset
+func openTestPostgres(t *testing.T) *sqldb.DB {
+	t.Helper()
+	dsn := os.Getenv(testPostgresEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", testPostgresEnv)
+	}
+
+	admin, err := sqldb.Open(dsn)
+	if err != nil {
+		t.Fatalf("failed to open postgres: %v", err)
+	}
+	schema := fmt.Sprintf("versed_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", testPostgresEnv, err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	testDB, err := sqldb.Open(u.String())
+	if err != nil {
+		t.Fatalf("failed to open postgres schema: %v", err)
+	}
+	t.Cleanup(func() { testDB.Close() })
+	return testDB
+}
+
+// Runs fn against a SQLite database and, when configured, a PostgreSQL one
+func forEachDatabase(t *testing.T, fn func(t *testing.T, db *sqldb.DB)) {
+	t.Run("sqlite", func(t *testing.T) { fn(t, openTestDB(t)) })
+	t.Run("postgres", func(t *testing.T) { fn(t, openTestPostgres(t)) })
+}
+
+func hasTable(t *testing.T, db *sqldb.DB, name string) bool {
+	t.Helper()
+	exists, err := tableExists(db, name)
+	if err != nil {
+		t.Fatalf("failed to check table %s: %v", name, err)
+	}
+	return exists
+}
+
+func hasColumn(t *testing.T, db *sqldb.DB, table, column string) bool {
+	t.Helper()
+	types, err := columnTypes(db, table)
+	if err != nil {
+		t.Fatalf("failed to check column %s.%s: %v", table, column, err)
+	}
+	_, ok := types[strings.ToLower(column)]
+	return ok
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/models"
+)
+
+// Site setting that makes admins use two-factor sign-in before they may use
+// admin features
+const requireAdminTwoFactorSetting = "require_admin_two_factor"
+
+// Returns a user's two-factor settings, or sql.ErrNoRows if they never
+// started setting it up
+func GetTwoFactor(db *sqldb.DB, userID int) (*models.TwoFactor, error) {
+	var tf models.TwoFactor
+	var enabledAt sql.NullTime
+	err := db.QueryRow(`SELECT user_id, secret, enabled_at, last_step FROM two_factor WHERE user_id = ?`, userID).
+		Scan(&tf.UserID, &tf.Secret, &enabledAt, &tf.LastStep)
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt.Valid {
+		tf.EnabledAt = &enabledAt.Time
+	}
+	return &tf, nil
+}
+
+// Stores a secret awaiting its first code, replacing any earlier one that
+// was never confirmed. The secret of a user who already has two-factor
+// sign-in on is left alone.
+func SetTwoFactorSecret(db *sqldb.DB, userID int, secret string) error {
+	_, err := db.Exec(`INSERT INTO two_factor (user_id, secret) VALUES (?, ?)
+	                   ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_step = 0
+	                   WHERE two_factor.enabled_at IS NULL`, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to store two-factor secret: %w", err)
+	}
+	return nil
+}
+
+// Turns two-factor sign-in on for a user whose secret is awaiting its first
+// code, which checked out at step, and replaces their recovery codes. Fails
+// with sql.ErrNoRows if there is no such secret.
+func EnableTwoFactor(db *sqldb.DB, userID int, step int64, recoveryHashes []string, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE two_factor SET enabled_at = ?, last_step = ? WHERE user_id = ? AND enabled_at IS NULL`,
+		now.UTC(), step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to enable two-factor: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := replaceRecoveryCodes(tx, userID, recoveryHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Turns two-factor sign-in off for a user, forgetting their secret and
+// recovery codes
+func DisableTwoFactor(db *sqldb.DB, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM two_factor WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete two-factor secret: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Records the time step of an accepted code, returning false if a code from
+// that step or a later one was already used
+func UseTwoFactorStep(db *sqldb.DB, userID int, step int64) (bool, error) {
+	result, err := db.Exec(`UPDATE two_factor SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record two-factor code: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// Uses up one of a user's recovery codes by its hash, returning false if they
+// have no such unused code
+func UseRecoveryCode(db *sqldb.DB, userID int, hash string, now time.Time) (bool, error) {
+	result, err := db.Exec(`UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		now.UTC(), userID, hash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// Replaces all of a user's recovery codes with the given hashes
+func ReplaceRecoveryCodes(db *sqldb.DB, userID int, hashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, hashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sqldb.Tx, userID int, hashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range hashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hash); err != nil {
+			return fmt.Errorf("failed to store recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// Returns how many unused recovery codes a user has
+func CountRecoveryCodes(db *sqldb.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// Reports whether admins must use two-factor sign-in before they may use
+// admin features
+func AdminTwoFactorRequired(db *sqldb.DB) (bool, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM site_settings WHERE key = ?`, requireAdminTwoFactorSetting).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get site setting: %w", err)
+	}
+	return value == "true", nil
+}
+
+// Sets whether admins must use two-factor sign-in
+func SetAdminTwoFactorRequired(db *sqldb.DB, required bool) error {
+	_, err := db.Exec(`INSERT INTO site_settings (key, value) VALUES (?, ?)
+	                   ON CONFLICT (key) DO UPDATE SET value = excluded.value`,
+		requireAdminTwoFactorSetting, fmt.Sprint(required))
+	if err != nil {
+		return fmt.Errorf("failed to set site setting: %w", err)
+	}
+	return nil
+}
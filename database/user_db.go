@@ -3,22 +3,26 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
 	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/passwords"
+	"github.com/navid-m/versed/repository"
 
 	"github.com/Masterminds/squirrel"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Creates a new user in the database with a hashed password and IP address tracking
-func CreateUser(email, username, password, ipAddress string) error {
+func CreateUser(db *sqldb.DB, email, username, password, ipAddress string) error {
 	var emailCount int
 	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", email).Scan(&emailCount)
 	if err != nil {
 		return fmt.Errorf("error checking email: %v", err)
 	}
 	if emailCount > 0 {
-		return fmt.Errorf("email already in use")
+		return repository.ErrEmailTaken
 	}
 
 	var usernameCount int
@@ -27,17 +31,17 @@ func CreateUser(email, username, password, ipAddress string) error {
 		return fmt.Errorf("error checking username: %v", err)
 	}
 	if usernameCount > 0 {
-		return fmt.Errorf("username already taken")
+		return repository.ErrUsernameTaken
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := passwords.Hash(password)
 	if err != nil {
-		return fmt.Errorf("error hashing password: %v", err)
+		return err
 	}
 
 	sqlQuery, args, err := squirrel.Insert("users").
 		Columns("email", "username", "password", "ip_address").
-		Values(email, username, string(hashedPassword), ipAddress).
+		Values(email, username, hashedPassword, ipAddress).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("error preparing query: %v", err)
@@ -48,12 +52,12 @@ func CreateUser(email, username, password, ipAddress string) error {
 		return fmt.Errorf("error creating user: %v", err)
 	}
 
-	user, err := GetUserByEmail(email)
+	user, err := GetUserByEmail(db, email)
 	if err != nil {
 		return fmt.Errorf("error retrieving new user: %v", err)
 	}
 
-	if err := CreateDefaultCategoriesForUser(user.ID); err != nil {
+	if err := CreateDefaultCategoriesForUser(db, user.ID); err != nil {
 		return fmt.Errorf("error creating default categories: %v", err)
 	}
 
@@ -61,34 +65,15 @@ func CreateUser(email, username, password, ipAddress string) error {
 }
 
 // Creates default categories and adds popular feeds for a new user
-func CreateDefaultCategoriesForUser(userID int) error {
-	defaultCategories := map[string][]struct {
-		name string
-		url  string
-	}{
-		"Technology": {
-			{"Hacker News", "https://hnrss.org/frontpage"},
-			{"Reddit - Programming", "https://www.reddit.com/r/programming/.rss"},
-			{"Lobsters", "https://lobste.rs/rss"},
-		},
-		"News": {
-			{"Reddit - Technology", "https://www.reddit.com/r/technology/.rss"},
-			{"BBC News - Technology", "http://feeds.bbci.co.uk/news/technology/rss.xml"},
-		},
-		"Science": {
-			{"Reddit - Science", "https://www.reddit.com/r/science/.rss"},
-			{"Nature News", "https://www.nature.com/nature.rss"},
-		},
-	}
-
-	for categoryName, feeds := range defaultCategories {
-		category, err := CreateUserCategory(db, userID, categoryName, "Default "+categoryName+" feeds")
+func CreateDefaultCategoriesForUser(db *sqldb.DB, userID int) error {
+	for _, defaults := range models.DefaultCategories {
+		category, err := CreateUserCategory(db, userID, defaults.Name, "Default "+defaults.Name+" feeds")
 		if err != nil {
 			continue
 		}
 
-		for _, feed := range feeds {
-			feedSourceID, err := EnsureFeedSourceExists(feed.name, feed.url)
+		for _, feed := range defaults.Feeds {
+			feedSourceID, err := EnsureFeedSourceExists(db, feed.Name, feed.URL)
 			if err != nil {
 				continue
 			}
@@ -104,69 +89,83 @@ func CreateDefaultCategoriesForUser(userID int) error {
 }
 
 // Creates a feed source if it doesn't exist and returns its ID
-func EnsureFeedSourceExists(name, url string) (int, error) {
+func EnsureFeedSourceExists(db *sqldb.DB, name, url string) (int, error) {
 	var id int
 	err := db.QueryRow("SELECT id FROM feed_sources WHERE name = ?", name).Scan(&id)
 	if err == nil {
 		return id, nil
 	}
 
-	sqlQuery, args, err := squirrel.Insert("feed_sources").
-		Columns("name", "url", "last_updated", "update_interval").
-		Values(name, url, squirrel.Expr("datetime('2000-01-01 00:00:00')"), 3600).
+	sqlQuery, args, err := FeedInsertionBuilder.
+		Values(name, url, "2000-01-01 00:00:00", feeds.DefaultUpdateInterval).
 		ToSql()
 	if err != nil {
 		return 0, err
 	}
 
-	result, err := db.Exec(sqlQuery, args...)
-	if err != nil {
+	if err := db.QueryRow(sqlQuery, args...).Scan(&id); err != nil {
 		return 0, err
 	}
 
-	id64, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return int(id64), nil
+	return id, nil
 }
 
-// Retrieves the user object given some email address
-func GetUserByEmail(email string) (*models.User, error) {
+// Retrieves the user object given some email address, ignoring case. An
+// exact match wins over accounts whose address differs only in case.
+func GetUserByEmail(db *sqldb.DB, email string) (*models.User, error) {
 	var user models.User
 	var isAdmin sql.NullBool
+	var pendingEmail sql.NullString
 
-	err := db.QueryRow("SELECT id, email, username, password, is_admin FROM users WHERE email = ?", email).
-		Scan(&user.ID, &user.Email, &user.Username, &user.Password, &isAdmin)
+	err := db.QueryRow(`SELECT id, email, username, password, is_admin, email_verified_at IS NOT NULL, pending_email FROM users
+	                    WHERE LOWER(email) = LOWER(?)
+	                    ORDER BY CASE WHEN email = ? THEN 0 ELSE 1 END, id
+	                    LIMIT 1`, email, email).
+		Scan(&user.ID, &user.Email, &user.Username, &user.Password, &isAdmin, &user.EmailVerified, &pendingEmail)
 
 	if err != nil {
 		return nil, err
 	}
 
 	user.IsAdmin = isAdmin.Bool
+	user.PendingEmail = pendingEmail.String
 
 	return &user, nil
 }
 
-// VerifyPassword checks if the provided password matches the hashed password
-func VerifyPassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
-}
+// Updates user information in the database. The password is only changed
+// when one is given.
+//
+// Fails with repository.ErrEmailTaken or repository.ErrUsernameTaken when
+// another user already has the email address or username.
+func UpdateUser(db *sqldb.DB, userID int, email, username, password string) error {
+	var taken int
+	err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? AND id <> ?", email, userID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("error checking email: %v", err)
+	}
+	if taken > 0 {
+		return repository.ErrEmailTaken
+	}
+	err = db.QueryRow("SELECT COUNT(*) FROM users WHERE username = ? AND id <> ?", username, userID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("error checking username: %v", err)
+	}
+	if taken > 0 {
+		return repository.ErrUsernameTaken
+	}
 
-// Updates user information in the database
-func UpdateUser(userID int, email, username, password string) error {
 	update := squirrel.Update("users").
 		Set("email", email).
 		Set("username", username).
 		Where(squirrel.Eq{"id": userID})
 
 	if password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		hashedPassword, err := passwords.Hash(password)
 		if err != nil {
 			return err
 		}
-		update = update.Set("password", string(hashedPassword))
+		update = update.Set("password", hashedPassword)
 	}
 
 	sqlQuery, args, err := update.ToSql()
@@ -178,11 +177,92 @@ func UpdateUser(userID int, email, username, password string) error {
 	return err
 }
 
+// Replaces a user's password with a hash of the given one
+func SetUserPassword(db *sqldb.DB, userID int, password string) error {
+	hashedPassword, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	result, err := db.Exec(`UPDATE users SET password = ? WHERE id = ? AND deleted_at IS NULL`, hashedPassword, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Records the address a user wants to change to, which only replaces their
+// current one once ConfirmUserEmail is called for it. An empty email clears
+// it.
+//
+// Fails with repository.ErrEmailTaken when another user has the address.
+func SetPendingEmail(db *sqldb.DB, userID int, email string) error {
+	var pending any
+	if email != "" {
+		var taken int
+		err := db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? AND id <> ?", email, userID).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("error checking email: %v", err)
+		}
+		if taken > 0 {
+			return repository.ErrEmailTaken
+		}
+		pending = email
+	}
+	result, err := db.Exec("UPDATE users SET pending_email = ? WHERE id = ? AND deleted_at IS NULL", pending, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set pending email: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Marks email as verified for a user. When it is the address they are
+// changing to, it replaces their current one.
+//
+// Fails with sql.ErrNoRows when email is neither the user's address nor
+// their pending one, and with repository.ErrEmailTaken when another user took
+// the pending address in the meantime.
+func ConfirmUserEmail(db *sqldb.DB, userID int, email string, now time.Time) error {
+	var current string
+	var pending sql.NullString
+	err := db.QueryRow("SELECT email, pending_email FROM users WHERE id = ? AND deleted_at IS NULL", userID).
+		Scan(&current, &pending)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case email == current:
+		_, err = db.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?", now.UTC(), userID)
+	case pending.Valid && email == pending.String:
+		var taken int
+		err = db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ? AND id <> ?", email, userID).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("error checking email: %v", err)
+		}
+		if taken > 0 {
+			return repository.ErrEmailTaken
+		}
+		_, err = db.Exec("UPDATE users SET email = ?, pending_email = NULL, email_verified_at = ? WHERE id = ?", email, now.UTC(), userID)
+	default:
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("failed to confirm email: %w", err)
+	}
+	return nil
+}
+
 // Adds a feed item to user's reading list
 //
 // Returns (saved or not -> bool, error)
-func SaveToReadingList(userID int, itemID string) (bool, error) {
-	exists, err := IsInReadingList(userID, itemID)
+func SaveToReadingList(db *sqldb.DB, userID int, itemID string) (bool, error) {
+	exists, err := IsInReadingList(db, userID, itemID)
 	if err != nil {
 		return false, err
 	}
@@ -207,7 +287,7 @@ func SaveToReadingList(userID int, itemID string) (bool, error) {
 }
 
 // Removes a feed item from user's reading list
-func RemoveFromReadingList(userID int, itemID string) error {
+func RemoveFromReadingList(db *sqldb.DB, userID int, itemID string) error {
 	sqlQuery, args, err := squirrel.Delete("reading_list").
 		Where(squirrel.Eq{"user_id": userID, "item_id": itemID}).
 		ToSql()
@@ -221,7 +301,7 @@ func RemoveFromReadingList(userID int, itemID string) error {
 }
 
 // Checks if a feed item is in user's reading list
-func IsInReadingList(userID int, itemID string) (bool, error) {
+func IsInReadingList(db *sqldb.DB, userID int, itemID string) (bool, error) {
 	var count int
 
 	sqlQuery, args, err := squirrel.Select("COUNT(*)").
@@ -241,7 +321,7 @@ func IsInReadingList(userID int, itemID string) (bool, error) {
 }
 
 // Hides a feed item for a user
-func HideFeedItem(userID int, itemID string) error {
+func HideFeedItem(db *sqldb.DB, userID int, itemID string) error {
 	sqlQuery, args, err := squirrel.Insert("hidden_posts").
 		Columns("user_id", "item_id").
 		Values(userID, itemID).
@@ -257,7 +337,7 @@ func HideFeedItem(userID int, itemID string) error {
 }
 
 // Unhides a feed item for a user
-func UnhideFeedItem(userID int, itemID string) error {
+func UnhideFeedItem(db *sqldb.DB, userID int, itemID string) error {
 	sqlQuery, args, err := squirrel.Delete("hidden_posts").
 		Where(squirrel.Eq{"user_id": userID, "item_id": itemID}).
 		ToSql()
@@ -271,7 +351,7 @@ func UnhideFeedItem(userID int, itemID string) error {
 }
 
 // Checks if a feed item is hidden by a user
-func IsFeedItemHidden(userID int, itemID string) (bool, error) {
+func IsFeedItemHidden(db *sqldb.DB, userID int, itemID string) (bool, error) {
 	var count int
 
 	sqlQuery, args, err := squirrel.Select("COUNT(*)").
@@ -291,7 +371,7 @@ func IsFeedItemHidden(userID int, itemID string) (bool, error) {
 }
 
 // Gets all hidden feed items for a user
-func GetHiddenFeedItems(userID int) ([]string, error) {
+func GetHiddenFeedItems(db *sqldb.DB, userID int) ([]string, error) {
 	sqlQuery, args, err := squirrel.Select("item_id").
 		From("hidden_posts").
 		Where(squirrel.Eq{"user_id": userID}).
@@ -320,9 +400,9 @@ func GetHiddenFeedItems(userID int) ([]string, error) {
 	return itemIDs, nil
 }
 
-// GetAllUsers retrieves all users from the database
-func GetAllUsers() ([]models.User, error) {
-	rows, err := db.Query("SELECT id, email, username, password, is_admin, ip_address FROM users ORDER BY id")
+// GetAllUsers retrieves every user whose account has not been deleted
+func GetAllUsers(db *sqldb.DB) ([]models.User, error) {
+	rows, err := db.Query("SELECT id, email, username, password, is_admin, ip_address, email_verified_at IS NOT NULL, pending_email FROM users WHERE deleted_at IS NULL ORDER BY id")
 	if err != nil {
 		return nil, err
 	}
@@ -332,12 +412,13 @@ func GetAllUsers() ([]models.User, error) {
 	for rows.Next() {
 		var user models.User
 		var isAdmin sql.NullBool
-		var ipAddress sql.NullString
-		err := rows.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &isAdmin, &ipAddress)
+		var ipAddress, pendingEmail sql.NullString
+		err := rows.Scan(&user.ID, &user.Email, &user.Username, &user.Password, &isAdmin, &ipAddress, &user.EmailVerified, &pendingEmail)
 		if err != nil {
 			return nil, err
 		}
 		user.IsAdmin = isAdmin.Bool
+		user.PendingEmail = pendingEmail.String
 		if ipAddress.Valid {
 			user.IPAddress = ipAddress.String
 		} else {
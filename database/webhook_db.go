@@ -0,0 +1,308 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+const webhookColumns = `id, user_id, name, url, secret, match_type, match_value, enabled, created_at`
+
+const webhookDeliveryColumns = `id, webhook_id, item_id, event, payload, status, attempts, response_status, last_error, next_attempt_at, created_at, updated_at`
+
+// Creates a new webhook for a user
+func CreateWebhook(db *sqldb.DB, userID int, name, url, secret, matchType, matchValue string) (*models.Webhook, error) {
+	query := `INSERT INTO webhooks (user_id, name, url, secret, match_type, match_value, enabled) VALUES (?, ?, ?, ?, ?, ?, TRUE) RETURNING id`
+	var id int
+	if err := db.QueryRow(query, userID, name, url, secret, matchType, matchValue).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return &models.Webhook{
+		ID:         id,
+		UserID:     userID,
+		Name:       name,
+		URL:        url,
+		Secret:     secret,
+		MatchType:  matchType,
+		MatchValue: matchValue,
+		Enabled:    true,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// Scans a webhook row selected with webhookColumns
+func scanWebhook(row interface{ Scan(...any) error }) (*models.Webhook, error) {
+	var hook models.Webhook
+	var enabled sql.NullBool
+	err := row.Scan(&hook.ID, &hook.UserID, &hook.Name, &hook.URL, &hook.Secret,
+		&hook.MatchType, &hook.MatchValue, &enabled, &hook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	hook.Enabled = enabled.Bool
+	return &hook, nil
+}
+
+// Retrieves all webhooks registered by a user
+func GetUserWebhooks(db *sqldb.DB, userID int) ([]models.Webhook, error) {
+	rows, err := db.Query(`SELECT `+webhookColumns+` FROM webhooks WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		hook.Secret = ""
+		hooks = append(hooks, *hook)
+	}
+	return hooks, nil
+}
+
+// Retrieves a webhook owned by a user
+func GetUserWebhookByID(db *sqldb.DB, userID, webhookID int) (*models.Webhook, error) {
+	row := db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ? AND user_id = ?`, webhookID, userID)
+	hook, err := scanWebhook(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	return hook, nil
+}
+
+// Retrieves a webhook by ID regardless of owner, including its secret
+func GetWebhookByID(db *sqldb.DB, webhookID int) (*models.Webhook, error) {
+	row := db.QueryRow(`SELECT `+webhookColumns+` FROM webhooks WHERE id = ?`, webhookID)
+	return scanWebhook(row)
+}
+
+// Retrieves every enabled webhook
+func GetEnabledWebhooks(db *sqldb.DB) ([]models.Webhook, error) {
+	rows, err := db.Query(`SELECT ` + webhookColumns + ` FROM webhooks WHERE enabled = TRUE`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enabled webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var hooks []models.Webhook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		hooks = append(hooks, *hook)
+	}
+	return hooks, nil
+}
+
+// Updates a webhook's endpoint, rule and enabled flag
+func UpdateWebhook(db *sqldb.DB, userID, webhookID int, name, url, matchType, matchValue string, enabled bool) error {
+	query := `UPDATE webhooks SET name = ?, url = ?, match_type = ?, match_value = ?, enabled = ? WHERE id = ? AND user_id = ?`
+	result, err := db.Exec(query, name, url, matchType, matchValue, enabled, webhookID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Deletes a webhook and its delivery log
+func DeleteWebhook(db *sqldb.DB, userID, webhookID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM webhooks WHERE id = ? AND user_id = ?`, webhookID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, webhookID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Reports whether a new feed item satisfies a webhook's match rule.
+//
+// Category rules match against the owner's category names, source rules
+// against the feed source name, keyword rules against the title and
+// description, and tag rules against the subverses the source belongs to.
+func WebhookMatchesItem(db *sqldb.DB, hook models.Webhook, item feeds.FeedItem) (bool, error) {
+	value := strings.TrimSpace(hook.MatchValue)
+	if value == "" {
+		return false, nil
+	}
+
+	switch hook.MatchType {
+	case models.WebhookMatchKeyword:
+		needle := strings.ToLower(value)
+		return strings.Contains(strings.ToLower(item.Title), needle) ||
+			strings.Contains(strings.ToLower(item.Description), needle), nil
+
+	case models.WebhookMatchSource:
+		sourceName := item.SourceName
+		if sourceName == "" {
+			err := db.QueryRow(`SELECT name FROM feed_sources WHERE id = ?`, item.SourceID).Scan(&sourceName)
+			if err != nil && err != sql.ErrNoRows {
+				return false, err
+			}
+		}
+		return strings.EqualFold(sourceName, value), nil
+
+	case models.WebhookMatchCategory:
+		var exists bool
+		err := db.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM user_category_feeds ucf
+				JOIN user_categories uc ON uc.id = ucf.category_id
+				WHERE ucf.user_id = ? AND ucf.feed_source_id = ? AND LOWER(uc.name) = LOWER(?)
+			)`, hook.UserID, item.SourceID, value).Scan(&exists)
+		return exists, err
+
+	case models.WebhookMatchTag:
+		var exists bool
+		err := db.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM subverse_feeds sf
+				JOIN subverses s ON s.id = sf.subverse_id
+				WHERE sf.feed_source_id = ? AND s.name = LOWER(?)
+			)`, item.SourceID, value).Scan(&exists)
+		return exists, err
+	}
+
+	return false, nil
+}
+
+// Queues a delivery for a webhook unless the same event was already queued
+func EnqueueWebhookDelivery(db *sqldb.DB, webhookID int, itemID, event, payload string) error {
+	query := `INSERT INTO webhook_deliveries (webhook_id, item_id, event, payload, status, attempts, next_attempt_at)
+	          VALUES (?, ?, ?, ?, ?, 0, ?)
+	          ON CONFLICT(webhook_id, item_id, event) DO NOTHING`
+	_, err := db.Exec(query, webhookID, itemID, event, payload, models.DeliveryPending, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to enqueue webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// Scans a delivery row selected with webhookDeliveryColumns
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (*models.WebhookDelivery, error) {
+	var (
+		delivery       models.WebhookDelivery
+		responseStatus sql.NullInt64
+		lastError      sql.NullString
+		nextAttemptAt  sql.NullTime
+	)
+	err := row.Scan(&delivery.ID, &delivery.WebhookID, &delivery.ItemID, &delivery.Event, &delivery.Payload,
+		&delivery.Status, &delivery.Attempts, &responseStatus, &lastError, &nextAttemptAt,
+		&delivery.CreatedAt, &delivery.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if responseStatus.Valid {
+		status := int(responseStatus.Int64)
+		delivery.ResponseStatus = &status
+	}
+	delivery.LastError = lastError.String
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	return &delivery, nil
+}
+
+// Retrieves pending deliveries of enabled webhooks whose next attempt is due
+func GetDueWebhookDeliveries(db *sqldb.DB, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT wd.id, wd.webhook_id, wd.item_id, wd.event, wd.payload, wd.status, wd.attempts,
+	                 wd.response_status, wd.last_error, wd.next_attempt_at, wd.created_at, wd.updated_at
+	          FROM webhook_deliveries wd
+	          JOIN webhooks w ON w.id = wd.webhook_id
+	          WHERE wd.status = ? AND w.enabled = TRUE AND wd.next_attempt_at <= ?
+	          ORDER BY wd.next_attempt_at
+	          LIMIT ?`
+	rows, err := db.Query(query, models.DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get due webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
+
+// Records the outcome of a delivery attempt
+//
+// A nil nextAttemptAt means no further attempts will be made.
+func RecordWebhookAttempt(db *sqldb.DB, deliveryID int, status string, attempts int, responseStatus *int, lastError string, nextAttemptAt *time.Time) error {
+	var next any
+	if nextAttemptAt != nil {
+		next = nextAttemptAt.UTC()
+	}
+	query := `UPDATE webhook_deliveries
+	          SET status = ?, attempts = ?, response_status = ?, last_error = ?, next_attempt_at = ?, updated_at = CURRENT_TIMESTAMP
+	          WHERE id = ?`
+	_, err := db.Exec(query, status, attempts, responseStatus, lastError, next, deliveryID)
+	return err
+}
+
+// Retrieves the most recent deliveries for a webhook
+func GetWebhookDeliveries(db *sqldb.DB, webhookID, limit int) ([]models.WebhookDelivery, error) {
+	query := `SELECT ` + webhookDeliveryColumns + `
+	          FROM webhook_deliveries
+	          WHERE webhook_id = ?
+	          ORDER BY created_at DESC, id DESC
+	          LIMIT ?`
+	rows, err := db.Query(query, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+	return deliveries, nil
+}
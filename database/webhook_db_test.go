@@ -0,0 +1,71 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+func TestWebhookMatchesItem(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T, db *sqldb.DB) {
+		if _, err := Migrate(db); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		var userID int
+		err := db.QueryRow(`INSERT INTO users (email, username, password) VALUES (?, ?, ?) RETURNING id`,
+			"a@example.com", "alice", "x").Scan(&userID)
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		source, err := feeds.CreateOrUpdateFeedSource(db, "Lobsters", "https://lobste.rs/rss")
+		if err != nil {
+			t.Fatalf("CreateOrUpdateFeedSource: %v", err)
+		}
+		category, err := CreateUserCategory(db, userID, "Programming", "")
+		if err != nil {
+			t.Fatalf("CreateUserCategory: %v", err)
+		}
+		if err := AddFeedToUserCategory(db, userID, category.ID, source.ID); err != nil {
+			t.Fatalf("AddFeedToUserCategory: %v", err)
+		}
+		subverse, err := CreateSubverse(db, "golang")
+		if err != nil {
+			t.Fatalf("CreateSubverse: %v", err)
+		}
+		if err := AddFeedToSubverse(db, subverse.ID, source.ID); err != nil {
+			t.Fatalf("AddFeedToSubverse: %v", err)
+		}
+
+		item := feeds.FeedItem{ID: "item-1", SourceID: source.ID, Title: "Go 1.30 released", Description: "Faster generics"}
+		tests := []struct {
+			matchType, matchValue string
+			want                  bool
+		}{
+			{models.WebhookMatchKeyword, "GO 1.30", true},
+			{models.WebhookMatchKeyword, "generics", true},
+			{models.WebhookMatchKeyword, "rust", false},
+			{models.WebhookMatchSource, "lobsters", true},
+			{models.WebhookMatchSource, "Hacker News", false},
+			{models.WebhookMatchCategory, "programming", true},
+			{models.WebhookMatchCategory, "Cooking", false},
+			{models.WebhookMatchTag, "GoLang", true},
+			{models.WebhookMatchTag, "rust", false},
+			{models.WebhookMatchKeyword, "  ", false},
+		}
+		for _, tt := range tests {
+			hook := models.Webhook{UserID: userID, MatchType: tt.matchType, MatchValue: tt.matchValue}
+			got, err := WebhookMatchesItem(db, hook, item)
+			if err != nil || got != tt.want {
+				t.Errorf("%s %q matched = %v, %v; want %v", tt.matchType, tt.matchValue, got, err, tt.want)
+			}
+		}
+
+		// Categories belong to the webhook's owner
+		hook := models.Webhook{UserID: userID + 1, MatchType: models.WebhookMatchCategory, MatchValue: "Programming"}
+		if got, err := WebhookMatchesItem(db, hook, item); err != nil || got {
+			t.Errorf("another user's category matched = %v, %v", got, err)
+		}
+	})
+}
@@ -0,0 +1,262 @@
+package digest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/template/django/v3"
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/ratelimit"
+)
+
+var logger = logging.For("digest")
+
+const (
+	checkInterval   = 15 * time.Minute
+	itemsPerSection = 5
+)
+
+// How many test digests a user may ask for in each window
+const (
+	testsPerUser   = 3
+	testRateWindow = time.Hour
+)
+
+var (
+	// Returned when no SMTP server is configured to send digests
+	ErrUnavailable = errors.New("email digests are not available")
+	// Returned when a user has asked for too many test digests
+	ErrTestRateLimited = errors.New("too many test digests requested")
+)
+
+// A rendered digest email
+type Email struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Data passed to the digest email templates
+type Data struct {
+	Username       string
+	Frequency      string
+	Since          time.Time
+	Categories     []database.DigestCategory
+	BaseURL        string
+	UnsubscribeURL string
+}
+
+// Builds and sends per-category email digests on each user's schedule
+type Service struct {
+	db       *sqldb.DB
+	engine   *django.Engine
+	mailer   *mailer.Mailer
+	baseURL  string
+	tests    *ratelimit.Limiter
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Creates a new digest service. Links in digests start with baseURL.
+func NewService(db *sqldb.DB, engine *django.Engine, m *mailer.Mailer, baseURL string) *Service {
+	return &Service{
+		db:       db,
+		engine:   engine,
+		mailer:   m,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		tests:    ratelimit.New(testsPerUser, testRateWindow),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Begins checking for due digests in the background
+func (s *Service) Start() {
+	if !s.mailer.Enabled() {
+		logger.Info("SMTP is not configured, email digests are disabled")
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.SendDue(time.Now())
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.SendDue(time.Now())
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stops the service and waits for the current run to finish
+func (s *Service) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// Sends every digest that is due at the given time.
+//
+// Users with nothing new are marked as sent so the window moves forward.
+func (s *Service) SendDue(now time.Time) {
+	metrics.WorkersBusy.Inc("digests")
+	defer metrics.WorkersBusy.Dec("digests")
+
+	subs, err := database.GetDueDigestSubscriptions(s.db, now)
+	if err != nil {
+		logger.Error("Failed to get due digests", "err", err)
+		return
+	}
+
+	sent := 0
+	for _, sub := range subs {
+		email, err := s.Build(sub, now)
+		if err != nil {
+			logger.Error("Failed to build digest", "user_id", sub.UserID, "err", err)
+			continue
+		}
+		if email != nil {
+			if err := s.send(sub, email); err != nil {
+				logger.Error("Failed to send digest", "user_id", sub.UserID, "err", err)
+				continue
+			}
+			sent++
+		}
+		if err := database.MarkDigestSent(s.db, sub.UserID, now); err != nil {
+			logger.Error("Failed to mark digest sent", "user_id", sub.UserID, "err", err)
+		}
+	}
+
+	if sent > 0 {
+		logger.Info("Sent email digests", "count", sent)
+	}
+}
+
+// Sends a digest to the user immediately, regardless of schedule or
+// frequency. Fails with ErrUnavailable or ErrTestRateLimited.
+func (s *Service) SendTest(userID int, now time.Time) error {
+	if !s.mailer.Enabled() {
+		return ErrUnavailable
+	}
+	if !s.tests.Allow(strconv.Itoa(userID), now) {
+		return ErrTestRateLimited
+	}
+
+	sub, err := database.GetDigestSubscription(s.db, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get digest subscription: %w", err)
+	}
+
+	sub.LastSentAt = nil
+	if sub.Frequency == models.DigestOff {
+		sub.Frequency = models.DigestDaily
+	}
+	email, err := s.Build(*sub, now)
+	if err != nil {
+		return err
+	}
+	if email == nil {
+		data := Data{
+			Username:       sub.Username,
+			Frequency:      sub.Frequency,
+			Since:          windowStart(*sub, now),
+			BaseURL:        s.baseURL,
+			UnsubscribeURL: s.unsubscribeURL(sub.UnsubscribeToken),
+		}
+		if email, err = s.Render(data); err != nil {
+			return err
+		}
+	}
+	return s.send(*sub, email)
+}
+
+// Gathers the top new items per category and renders the email, or returns nil if there are none
+func (s *Service) Build(sub models.DigestSubscription, now time.Time) (*Email, error) {
+	since := windowStart(sub, now)
+	categories, err := database.GetDigestCategories(s.db, sub.UserID, since, itemsPerSection)
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		return nil, nil
+	}
+
+	return s.Render(Data{
+		Username:       sub.Username,
+		Frequency:      sub.Frequency,
+		Since:          since,
+		Categories:     categories,
+		BaseURL:        s.baseURL,
+		UnsubscribeURL: s.unsubscribeURL(sub.UnsubscribeToken),
+	})
+}
+
+// Renders the HTML and plain-text digest templates
+func (s *Service) Render(data Data) (*Email, error) {
+	binding := map[string]any{
+		"Username":       data.Username,
+		"Frequency":      data.Frequency,
+		"Since":          data.Since.UTC().Format("Jan 2, 2006 15:04 MST"),
+		"Categories":     data.Categories,
+		"BaseURL":        data.BaseURL,
+		"UnsubscribeURL": data.UnsubscribeURL,
+	}
+
+	var html, text bytes.Buffer
+	if err := s.engine.Render(&html, "emails/digest", binding); err != nil {
+		return nil, fmt.Errorf("failed to render digest html: %w", err)
+	}
+	if err := s.engine.Render(&text, "emails/digest-text", binding); err != nil {
+		return nil, fmt.Errorf("failed to render digest text: %w", err)
+	}
+
+	subject := "Your daily Versed digest"
+	if data.Frequency == models.DigestWeekly {
+		subject = "Your weekly Versed digest"
+	}
+
+	return &Email{Subject: subject, Text: text.String(), HTML: html.String()}, nil
+}
+
+func (s *Service) send(sub models.DigestSubscription, email *Email) error {
+	unsubscribeURL := s.unsubscribeURL(sub.UnsubscribeToken)
+	return s.mailer.Send(mailer.Message{
+		To:      sub.Email,
+		Subject: email.Subject,
+		Text:    email.Text,
+		HTML:    email.HTML,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+func (s *Service) unsubscribeURL(token string) string {
+	return s.baseURL + "/digest/unsubscribe/" + token
+}
+
+// Returns the start of the digest window: the last send, or one period ago
+func windowStart(sub models.DigestSubscription, now time.Time) time.Time {
+	if sub.LastSentAt != nil {
+		return *sub.LastSentAt
+	}
+	if sub.Frequency == models.DigestWeekly {
+		return now.Add(-7 * 24 * time.Hour)
+	}
+	return now.Add(-24 * time.Hour)
+}
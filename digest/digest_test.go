@@ -0,0 +1,168 @@
+package digest
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/template/django/v3"
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/mailer/mailertest"
+	"github.com/navid-m/versed/models"
+)
+
+func newTestService(t *testing.T) (*Service, *mailertest.Server) {
+	t.Helper()
+	engine := django.New("../views", ".html")
+	if err := engine.Load(); err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	server := mailertest.NewServer(t)
+	return NewService(nil, engine, mailer.New(server.Config()), "https://versed.test/"), server
+}
+
+func sampleData(s *Service) Data {
+	return Data{
+		Username:  "reader",
+		Frequency: models.DigestWeekly,
+		Since:     time.Date(2025, 1, 2, 8, 0, 0, 0, time.UTC),
+		Categories: []database.DigestCategory{{
+			Name: "Programming",
+			Items: []feeds.FeedItem{{
+				ID:            "item-1",
+				Title:         "Go & SQLite <tips>",
+				URL:           "https://example.com/go",
+				SourceName:    "Lobsters",
+				Score:         42,
+				CommentsCount: 7,
+			}},
+		}},
+		BaseURL:        s.baseURL,
+		UnsubscribeURL: s.unsubscribeURL("tok123"),
+	}
+}
+
+func TestRender(t *testing.T) {
+	s, _ := newTestService(t)
+
+	email, err := s.Render(sampleData(s))
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+
+	if email.Subject != "Your weekly Versed digest" {
+		t.Errorf("subject = %q", email.Subject)
+	}
+	for _, want := range []string{
+		"Programming",
+		"Go &amp; SQLite &lt;tips&gt;",
+		"https://versed.test/post/item-1",
+		"https://versed.test/digest/unsubscribe/tok123",
+	} {
+		if !strings.Contains(email.HTML, want) {
+			t.Errorf("html missing %q", want)
+		}
+	}
+	for _, want := range []string{
+		"== Programming ==",
+		"- Go & SQLite <tips>",
+		"Lobsters | 42 points | 7 comments",
+		"Unsubscribe: https://versed.test/digest/unsubscribe/tok123",
+	} {
+		if !strings.Contains(email.Text, want) {
+			t.Errorf("text missing %q\n%s", want, email.Text)
+		}
+	}
+}
+
+func TestSendIncludesUnsubscribeHeader(t *testing.T) {
+	s, server := newTestService(t)
+
+	email, err := s.Render(sampleData(s))
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	sub := models.DigestSubscription{UserID: 1, Email: "reader@example.com", UnsubscribeToken: "tok123"}
+	if err := s.send(sub, email); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	msgs := server.WaitFor(1, 2*time.Second)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	parsed, err := msgs[0].Parse()
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe"); got != "<https://versed.test/digest/unsubscribe/tok123>" {
+		t.Errorf("List-Unsubscribe = %q", got)
+	}
+}
+
+func TestSendTestIsRateLimited(t *testing.T) {
+	s, server := newTestService(t)
+	db, err := sqldb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := database.CreateUser(db, "reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := database.GetUserByEmail(db, "reader@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	s.db = db
+
+	now := time.Now()
+	for i := 0; i < testsPerUser; i++ {
+		if err := s.SendTest(user.ID, now); err != nil {
+			t.Fatalf("SendTest %d: %v", i+1, err)
+		}
+	}
+	if err := s.SendTest(user.ID, now); !errors.Is(err, ErrTestRateLimited) {
+		t.Errorf("SendTest past the limit = %v, want ErrTestRateLimited", err)
+	}
+	if err := s.SendTest(user.ID, now.Add(testRateWindow)); err != nil {
+		t.Errorf("SendTest after the window = %v", err)
+	}
+	if msgs := server.WaitFor(testsPerUser+1, 2*time.Second); len(msgs) != testsPerUser+1 {
+		t.Errorf("got %d messages, want %d", len(msgs), testsPerUser+1)
+	}
+}
+
+func TestSendTestWithoutMailer(t *testing.T) {
+	s := NewService(nil, nil, mailer.New(mailer.Config{}), "")
+	if err := s.SendTest(1, time.Now()); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("SendTest without a mail server = %v, want ErrUnavailable", err)
+	}
+}
+
+func TestWindowStart(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	last := now.Add(-3 * time.Hour)
+
+	cases := []struct {
+		sub  models.DigestSubscription
+		want time.Time
+	}{
+		{models.DigestSubscription{Frequency: models.DigestDaily}, now.Add(-24 * time.Hour)},
+		{models.DigestSubscription{Frequency: models.DigestWeekly}, now.Add(-7 * 24 * time.Hour)},
+		{models.DigestSubscription{Frequency: models.DigestWeekly, LastSentAt: &last}, last},
+	}
+	for _, tc := range cases {
+		if got := windowStart(tc.sub, now); !got.Equal(tc.want) {
+			t.Errorf("windowStart(%s) = %v, want %v", tc.sub.Frequency, got, tc.want)
+		}
+	}
+}
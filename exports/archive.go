@@ -0,0 +1,197 @@
+package exports
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/repository"
+)
+
+// The account details included in an export; the password hash is left out
+type profile struct {
+	ID        int    `json:"id"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	IsAdmin   bool   `json:"is_admin"`
+	IPAddress string `json:"ip_address"`
+}
+
+// One kind of record in an export, written as both NAME.json and NAME.csv
+type table struct {
+	name   string
+	json   any
+	header []string
+	rows   [][]string
+}
+
+// Writes a user's data as a zip archive.
+//
+// Every kind of record is written as JSON and as CSV, and the feeds in the
+// user's categories are also written as OPML for importing into other readers.
+func WriteArchive(w io.Writer, data *repository.UserData, now time.Time) error {
+	zw := zip.NewWriter(w)
+
+	readme := fmt.Sprintf("Versed data export for %s, created %s.\n\n"+
+		"Each kind of record is included as JSON and as CSV. feeds.opml lists the\n"+
+		"feeds in your categories and can be imported into most feed readers.\n",
+		data.User.Username, formatTime(now))
+	if err := writeEntry(zw, "README.txt", now, func(w io.Writer) error {
+		_, err := io.WriteString(w, readme)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	for _, t := range tables(data) {
+		if err := writeEntry(zw, t.name+".json", now, func(w io.Writer) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(t.json)
+		}); err != nil {
+			return err
+		}
+		if err := writeEntry(zw, t.name+".csv", now, func(w io.Writer) error {
+			cw := csv.NewWriter(w)
+			cw.Write(t.header)
+			cw.WriteAll(t.rows)
+			return cw.Error()
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := writeEntry(zw, "feeds.opml", now, func(w io.Writer) error {
+		return writeOPML(w, data, now)
+	}); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// Adds one file to the archive
+func writeEntry(zw *zip.Writer, name string, modified time.Time, write func(io.Writer) error) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	if err := write(w); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Lays out every kind of record in the export
+func tables(data *repository.UserData) []table {
+	user := profile{
+		ID:        data.User.ID,
+		Email:     data.User.Email,
+		Username:  data.User.Username,
+		IsAdmin:   data.User.IsAdmin,
+		IPAddress: data.User.IPAddress,
+	}
+
+	var categoryRows [][]string
+	for _, category := range data.Categories {
+		if len(category.Feeds) == 0 {
+			categoryRows = append(categoryRows, []string{strconv.Itoa(category.ID), category.Name, category.Description, "", "", ""})
+		}
+		for _, feed := range category.Feeds {
+			categoryRows = append(categoryRows, []string{strconv.Itoa(category.ID), category.Name, category.Description,
+				strconv.Itoa(feed.ID), feed.Name, feed.URL})
+		}
+	}
+
+	var readingRows [][]string
+	for _, item := range data.ReadingList {
+		published := ""
+		if item.PublishedAt != nil {
+			published = formatTime(*item.PublishedAt)
+		}
+		readingRows = append(readingRows, []string{item.ID, item.Title, item.URL, item.SourceName, published})
+	}
+
+	var hiddenRows [][]string
+	for _, item := range data.Hidden {
+		hiddenRows = append(hiddenRows, []string{item.ItemID, item.Title, formatTime(item.HiddenAt)})
+	}
+
+	var itemVoteRows [][]string
+	for _, vote := range data.ItemVotes {
+		itemVoteRows = append(itemVoteRows, []string{vote.ItemID, vote.Title, vote.VoteType, formatTime(vote.CreatedAt)})
+	}
+
+	var postVoteRows [][]string
+	for _, vote := range data.PostVotes {
+		postVoteRows = append(postVoteRows, []string{vote.PostID, vote.VoteType, formatTime(vote.CreatedAt), formatTime(vote.UpdatedAt)})
+	}
+
+	var commentRows [][]string
+	for _, comment := range data.Comments {
+		parent := ""
+		if comment.ParentID != nil {
+			parent = strconv.Itoa(*comment.ParentID)
+		}
+		commentRows = append(commentRows, []string{strconv.Itoa(comment.ID), comment.ItemID, parent, comment.Content,
+			formatTime(comment.CreatedAt), formatTime(comment.UpdatedAt)})
+	}
+
+	var postCommentRows [][]string
+	for _, comment := range data.PostComments {
+		parent := ""
+		if comment.ParentID != nil {
+			parent = *comment.ParentID
+		}
+		postCommentRows = append(postCommentRows, []string{comment.ID, comment.PostID, parent, comment.Content,
+			formatTime(comment.CreatedAt), formatTime(comment.UpdatedAt)})
+	}
+
+	var postRows [][]string
+	for _, post := range data.Posts {
+		postRows = append(postRows, []string{post.ID, strconv.Itoa(post.SubverseID), post.Title, post.Content, post.PostType,
+			post.URL, strconv.Itoa(post.Score), formatTime(post.CreatedAt), formatTime(post.UpdatedAt)})
+	}
+
+	return []table{
+		{"profile", user, []string{"id", "email", "username", "is_admin", "ip_address"},
+			[][]string{{strconv.Itoa(user.ID), user.Email, user.Username, strconv.FormatBool(user.IsAdmin), user.IPAddress}}},
+		{"categories", nonNil(data.Categories), []string{"category_id", "category", "description", "feed_id", "feed_name", "feed_url"}, categoryRows},
+		{"reading_list", nonNil(data.ReadingList), []string{"item_id", "title", "url", "source", "published_at"}, readingRows},
+		{"hidden_posts", nonNil(data.Hidden), []string{"item_id", "title", "hidden_at"}, hiddenRows},
+		{"item_votes", nonNil(data.ItemVotes), []string{"item_id", "title", "vote_type", "created_at"}, itemVoteRows},
+		{"post_votes", nonNil(data.PostVotes), []string{"post_id", "vote_type", "created_at", "updated_at"}, postVoteRows},
+		{"comments", nonNil(data.Comments), []string{"id", "item_id", "parent_id", "content", "created_at", "updated_at"}, commentRows},
+		{"post_comments", nonNil(data.PostComments), []string{"id", "post_id", "parent_id", "content", "created_at", "updated_at"}, postCommentRows},
+		{"posts", nonNil(data.Posts), []string{"id", "subverse_id", "title", "content", "post_type", "url", "score", "created_at", "updated_at"}, postRows},
+	}
+}
+
+// Makes empty lists encode as [] rather than null
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Writes the user's categories as OPML folders holding their feeds
+func writeOPML(w io.Writer, data *repository.UserData, now time.Time) error {
+	doc := feeds.NewOPML(data.User.Username+"'s Versed feeds", now)
+	for _, category := range data.Categories {
+		folder := feeds.OPMLOutline{Text: category.Name}
+		for _, feed := range category.Feeds {
+			folder.Outlines = append(folder.Outlines, feeds.OPMLOutline{Text: feed.Name, Type: "rss", XMLURL: feed.URL})
+		}
+		doc.Body = append(doc.Body, folder)
+	}
+	return doc.Write(w)
+}
@@ -0,0 +1,319 @@
+// Package exports builds archives of a user's data in the background and
+// hands them out through signed, time-limited download links.
+package exports
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+)
+
+var logger = logging.For("exports")
+
+const (
+	// How long a finished archive can be downloaded
+	retention = 7 * 24 * time.Hour
+	// How long each signed download link stays valid
+	linkTTL         = 24 * time.Hour
+	cleanupInterval = time.Hour
+)
+
+// Returned when a user asks for an export while another is still being built
+var ErrInProgress = errors.New("an export is already in progress")
+
+// Returned for download links that were tampered with or have expired
+var ErrInvalidLink = errors.New("download link is invalid or has expired")
+
+// Configures where archives go and how links to them are made
+type Config struct {
+	// Directory the archives are written to
+	Dir string
+	// Key download links are signed with
+	Secret []byte
+	// Prefix of download links in notification emails
+	BaseURL string
+}
+
+// Builds data export archives one at a time and emails users when theirs is ready
+type Service struct {
+	users    repository.Users
+	exports  repository.DataExports
+	mailer   *mailer.Mailer
+	cfg      Config
+	wake     chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Creates a new export service over the given repositories.
+//
+// Without a secret a random one is generated, so download links stop working
+// when the process restarts.
+func NewService(users repository.Users, exports repository.DataExports, m *mailer.Mailer, cfg Config) *Service {
+	if len(cfg.Secret) == 0 {
+		logger.Warn("No export secret is configured, export download links will not survive a restart")
+		cfg.Secret = make([]byte, 32)
+		rand.Read(cfg.Secret)
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &Service{
+		users:    users,
+		exports:  exports,
+		mailer:   m,
+		cfg:      cfg,
+		wake:     make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Begins building queued exports in the background, including any a
+// previous process did not finish, and deleting expired archives
+func (s *Service) Start() error {
+	if err := os.MkdirAll(s.cfg.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.RunPending()
+		s.Cleanup(time.Now())
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.wake:
+				s.RunPending()
+			case <-ticker.C:
+				s.Cleanup(time.Now())
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stops the service and waits for the export being built to finish
+func (s *Service) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// Queues an export of the user's data
+func (s *Service) Request(userID int) (*models.DataExport, error) {
+	existing, err := s.exports.List(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, export := range existing {
+		if export.Status == models.ExportPending || export.Status == models.ExportRunning {
+			return nil, ErrInProgress
+		}
+	}
+
+	export, err := s.exports.Create(userID)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return export, nil
+}
+
+// Returns a user's exports, newest first
+func (s *Service) List(userID int) ([]models.DataExport, error) {
+	return s.exports.List(userID)
+}
+
+// Returns an export
+func (s *Service) Get(id int) (*models.DataExport, error) {
+	return s.exports.ByID(id)
+}
+
+// Builds every queued export
+func (s *Service) RunPending() {
+	metrics.WorkersBusy.Inc("exports")
+	defer metrics.WorkersBusy.Dec("exports")
+
+	pending, err := s.exports.Pending()
+	if err != nil {
+		logger.Error("Failed to get pending data exports", "err", err)
+		return
+	}
+	for _, export := range pending {
+		select {
+		case <-s.stopChan:
+			return
+		default:
+		}
+		s.run(export)
+	}
+}
+
+// Builds one export and tells its owner how it went
+func (s *Service) run(export models.DataExport) {
+	if err := s.exports.MarkRunning(export.ID); err != nil {
+		logger.Error("Failed to start data export", "export_id", export.ID, "err", err)
+		return
+	}
+
+	now := time.Now()
+	size, err := s.build(export, now)
+	if err != nil {
+		logger.Error("Failed to build data export", "export_id", export.ID, "err", err)
+		if err := s.exports.MarkFailed(export.ID, "Failed to build the archive", now); err != nil {
+			logger.Error("Failed to record data export failure", "export_id", export.ID, "err", err)
+		}
+		return
+	}
+
+	expiresAt := now.Add(retention)
+	if err := s.exports.MarkReady(export.ID, size, now, expiresAt); err != nil {
+		logger.Error("Failed to record data export", "export_id", export.ID, "err", err)
+		return
+	}
+	export.Status = models.ExportReady
+	export.ExpiresAt = &expiresAt
+	logger.Info("Built data export", "export_id", export.ID, "user_id", export.UserID, "bytes", size)
+
+	if err := s.notify(export, now); err != nil {
+		logger.Error("Failed to email user about data export", "export_id", export.ID, "user_id", export.UserID, "err", err)
+	}
+}
+
+// Writes the export's archive, returning its size
+func (s *Service) build(export models.DataExport, now time.Time) (int64, error) {
+	data, err := s.exports.UserData(export.UserID)
+	if err != nil {
+		return 0, err
+	}
+
+	path := s.Path(export.ID)
+	f, err := os.CreateTemp(s.cfg.Dir, ".export-*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := WriteArchive(f, data, now); err != nil {
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if err := f.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Emails the user a download link, if SMTP is configured
+func (s *Service) notify(export models.DataExport, now time.Time) error {
+	if !s.mailer.Enabled() {
+		return nil
+	}
+	user, err := s.users.ByID(export.UserID)
+	if err != nil {
+		return err
+	}
+
+	link := s.cfg.BaseURL + s.DownloadURL(export, now)
+	return s.mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Versed data export is ready",
+		Text: fmt.Sprintf("Hi %s,\n\nThe export of your Versed data is ready. Download it here within the next %d hours:\n\n%s\n\n"+
+			"After that, a new link can be made from your profile until %s.\n",
+			user.Username, int(linkTTL.Hours()), link, export.ExpiresAt.UTC().Format("Jan 2, 2006 15:04 MST")),
+	})
+}
+
+// Deletes the archives of exports whose download window has passed
+func (s *Service) Cleanup(now time.Time) {
+	expired, err := s.exports.Expire(now)
+	if err != nil {
+		logger.Error("Failed to expire data exports", "err", err)
+		return
+	}
+	for _, id := range expired {
+		if err := os.Remove(s.Path(id)); err != nil && !os.IsNotExist(err) {
+			logger.Error("Failed to delete data export", "export_id", id, "err", err)
+		}
+	}
+}
+
+// Deletes the archives of all of a user's exports
+func (s *Service) RemoveUser(userID int) error {
+	list, err := s.exports.List(userID)
+	if err != nil {
+		return err
+	}
+	for _, export := range list {
+		if err := os.Remove(s.Path(export.ID)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns where an export's archive is written
+func (s *Service) Path(id int) string {
+	return filepath.Join(s.cfg.Dir, fmt.Sprintf("export-%d.zip", id))
+}
+
+// Returns a signed path for downloading a ready export, valid for a day or
+// until the export expires, whichever comes first
+func (s *Service) DownloadURL(export models.DataExport, now time.Time) string {
+	expires := now.Add(linkTTL)
+	if export.ExpiresAt != nil && export.ExpiresAt.Before(expires) {
+		expires = *export.ExpiresAt
+	}
+	unix := strconv.FormatInt(expires.Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", unix)
+	query.Set("signature", s.sign(export, unix))
+	return fmt.Sprintf("/exports/%d/download?%s", export.ID, query.Encode())
+}
+
+// Checks the expiry and signature of a download link
+func (s *Service) Verify(export models.DataExport, expires, signature string, now time.Time) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > unix {
+		return ErrInvalidLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(export, expires))) {
+		return ErrInvalidLink
+	}
+	return nil
+}
+
+// Signs an export's ID and owner along with the link's expiry
+func (s *Service) sign(export models.DataExport, expires string) string {
+	mac := hmac.New(sha256.New, s.cfg.Secret)
+	fmt.Fprintf(mac, "%d.%d.%s", export.ID, export.UserID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
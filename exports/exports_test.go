@@ -0,0 +1,227 @@
+package exports
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/mailer/mailertest"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/repository/repositorytest"
+)
+
+func sampleData() *repository.UserData {
+	parent := 1
+	return &repository.UserData{
+		User: models.User{ID: 7, Email: "reader@example.com", Username: "reader", Password: "hash"},
+		Categories: []repository.CategoryFeeds{{
+			UserCategory: models.UserCategory{ID: 3, Name: "Tech & Code"},
+			Feeds:        []feeds.FeedSource{{ID: 9, Name: "Lobsters", URL: "https://lobste.rs/rss"}},
+		}},
+		Comments: []models.Comment{
+			{ID: 1, ItemID: "item-1", Content: "Nice, \"quoted\""},
+			{ID: 2, ItemID: "item-1", Content: "Reply", ParentID: &parent},
+		},
+	}
+}
+
+func readArchive(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestWriteArchive(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, sampleData(), time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("WriteArchive: %v", err)
+	}
+	files := readArchive(t, buf.Bytes())
+
+	for _, name := range []string{"profile", "categories", "reading_list", "hidden_posts", "item_votes", "post_votes", "comments", "post_comments", "posts"} {
+		for _, ext := range []string{".json", ".csv"} {
+			if _, ok := files[name+ext]; !ok {
+				t.Errorf("archive missing %s%s", name, ext)
+			}
+		}
+	}
+	if !strings.Contains(files["README.txt"], "reader") {
+		t.Errorf("README.txt = %q", files["README.txt"])
+	}
+
+	if strings.Contains(files["profile.json"], "hash") {
+		t.Error("profile.json includes the password hash")
+	}
+	var profile map[string]any
+	if err := json.Unmarshal([]byte(files["profile.json"]), &profile); err != nil {
+		t.Fatalf("profile.json: %v", err)
+	}
+	if profile["email"] != "reader@example.com" {
+		t.Errorf("profile.json = %v", profile)
+	}
+	if strings.TrimSpace(files["posts.json"]) != "[]" {
+		t.Errorf("posts.json = %q, want an empty list", files["posts.json"])
+	}
+
+	rows, err := csv.NewReader(strings.NewReader(files["comments.csv"])).ReadAll()
+	if err != nil {
+		t.Fatalf("comments.csv: %v", err)
+	}
+	if len(rows) != 3 || strings.Join(rows[0], ",") != "id,item_id,parent_id,content,created_at,updated_at" {
+		t.Fatalf("comments.csv = %v", rows)
+	}
+	if rows[1][3] != `Nice, "quoted"` || rows[2][2] != "1" {
+		t.Errorf("comments.csv rows = %v", rows[1:])
+	}
+
+	for _, want := range []string{`<outline text="Tech &amp; Code">`, `xmlUrl="https://lobste.rs/rss"`} {
+		if !strings.Contains(files["feeds.opml"], want) {
+			t.Errorf("feeds.opml missing %q\n%s", want, files["feeds.opml"])
+		}
+	}
+}
+
+func TestDownloadURL(t *testing.T) {
+	s := NewService(nil, nil, nil, Config{Secret: []byte("secret")})
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(retention)
+	export := models.DataExport{ID: 4, UserID: 7, Status: models.ExportReady, ExpiresAt: &expiresAt}
+
+	link, err := url.Parse(s.DownloadURL(export, now))
+	if err != nil {
+		t.Fatalf("invalid download URL: %v", err)
+	}
+	if link.Path != "/exports/4/download" {
+		t.Errorf("path = %q", link.Path)
+	}
+	expires, signature := link.Query().Get("expires"), link.Query().Get("signature")
+
+	if err := s.Verify(export, expires, signature, now.Add(time.Hour)); err != nil {
+		t.Errorf("Verify rejected a valid link: %v", err)
+	}
+	if err := s.Verify(export, expires, signature, now.Add(linkTTL+time.Second)); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("Verify accepted an expired link: %v", err)
+	}
+	if err := s.Verify(export, "9999999999", signature, now); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("Verify accepted a changed expiry: %v", err)
+	}
+	other := export
+	other.ID = 5
+	if err := s.Verify(other, expires, signature, now); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("Verify accepted a link for another export: %v", err)
+	}
+	resigned := NewService(nil, nil, nil, Config{Secret: []byte("other")})
+	if err := resigned.Verify(export, expires, signature, now); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("Verify accepted a link signed with another key: %v", err)
+	}
+
+	// Links never outlive the archive
+	soon := now.Add(time.Hour)
+	export.ExpiresAt = &soon
+	link, _ = url.Parse(s.DownloadURL(export, now))
+	if err := s.Verify(export, link.Query().Get("expires"), link.Query().Get("signature"), now.Add(2*time.Hour)); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("link outlived its export: %v", err)
+	}
+}
+
+func TestService(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+	user, err := repos.Users.ByEmail("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := mailertest.NewServer(t)
+	dir := filepath.Join(t.TempDir(), "exports")
+	s := NewService(repos.Users, repos.DataExports, mailer.New(server.Config()), Config{Dir: dir, Secret: []byte("secret"), BaseURL: "https://versed.test"})
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	export, err := s.Request(user.ID)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if _, err := s.Request(user.ID); !errors.Is(err, ErrInProgress) {
+		t.Errorf("second Request = %v, want ErrInProgress", err)
+	}
+
+	s.RunPending()
+	export, err = s.Get(export.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if export.Status != models.ExportReady || export.ExpiresAt == nil {
+		t.Fatalf("export = %+v, want ready", export)
+	}
+	archive, err := os.ReadFile(s.Path(export.ID))
+	if err != nil {
+		t.Fatalf("archive not written: %v", err)
+	}
+	if int64(len(archive)) != export.FileSize {
+		t.Errorf("file size = %d, recorded %d", len(archive), export.FileSize)
+	}
+	if files := readArchive(t, archive); !strings.Contains(files["categories.csv"], "https://") {
+		t.Errorf("categories.csv lacks the default feeds:\n%s", files["categories.csv"])
+	}
+
+	messages := server.WaitFor(1, 5*time.Second)
+	if len(messages) != 1 {
+		t.Fatalf("got %d emails, want 1", len(messages))
+	}
+	msg, err := messages[0].Parse()
+	if err != nil {
+		t.Fatalf("failed to parse email: %v", err)
+	}
+	body, _ := io.ReadAll(msg.Body)
+	if !strings.Contains(string(body), "https://versed.test/exports/") {
+		t.Errorf("email lacks a download link:\n%s", body)
+	}
+
+	if _, err := s.Request(user.ID); err != nil {
+		t.Errorf("Request after the export finished: %v", err)
+	}
+
+	s.Cleanup(export.ExpiresAt.Add(time.Second))
+	if _, err := os.Stat(s.Path(export.ID)); !os.IsNotExist(err) {
+		t.Errorf("expired archive still exists: %v", err)
+	}
+	export, err = s.Get(export.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if export.Status != models.ExportExpired {
+		t.Errorf("status = %q, want expired", export.Status)
+	}
+}
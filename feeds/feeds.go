@@ -1,25 +1,46 @@
 package feeds
 
 import (
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/mmcdole/gofeed"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/logging"
 )
 
+var logger = logging.For("feeds")
+
 type FeedSource struct {
 	ID             int       `json:"id"`
 	Name           string    `json:"name"`
 	URL            string    `json:"url"`
 	LastUpdated    time.Time `json:"last_updated"`
 	UpdateInterval int       `json:"update_interval"`
+	// Disabled sources are skipped by the scheduler and by category refreshes
+	Disabled bool `json:"disabled"`
 }
 
+// Starts the URL of the feed source each inbound newsletter address files
+// into. Their items belong to the user who owns the address, so they are
+// left out of everything shared between users.
+const NewsletterURLPrefix = "newsletter:"
+
+// Reports whether the source holds a user's inbound newsletters
+func (s FeedSource) IsNewsletter() bool {
+	return strings.HasPrefix(s.URL, NewsletterURLPrefix)
+}
+
+// How often new feed sources are due to be fetched, in seconds
+var DefaultUpdateInterval = 3600
+
 type FeedItem struct {
 	ID            string     `json:"id"`
 	SourceID      int        `json:"source_id"`
@@ -32,6 +53,8 @@ type FeedItem struct {
 	Score         int        `json:"score"`
 	CommentsCount int        `json:"comments_count"`
 	CreatedAt     *time.Time `json:"created_at"`
+	// Highlighted extract of the matching text, only set on search results
+	Snippet string `json:"snippet,omitempty"`
 }
 
 // Interface for different feed sources.
@@ -51,56 +74,57 @@ var client = &http.Client{
 	},
 }
 
-func ResetAllFeedTimestamps(db *sql.DB) error {
-	query := `UPDATE feed_sources SET last_updated = datetime('2000-01-01 00:00:00')`
+func ResetAllFeedTimestamps(db *sqldb.DB) error {
+	query := `UPDATE feed_sources SET last_updated = '2000-01-01 00:00:00'`
 	_, err := db.Exec(query)
 	if err != nil {
 		return fmt.Errorf("failed to reset feed timestamps: %w", err)
 	}
-	log.Println("Reset all feed timestamps to force updates")
+	logger.Info("Reset all feed timestamps to force updates")
 	return nil
 }
 
-func DebugFeeds(db *sql.DB) {
-	log.Println("=== DATABASE DEBUG ===")
+// Logs the feed sources and latest items at debug level
+func DebugFeeds(db *sqldb.DB) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
 
 	sources, err := GetAllFeedSources(db)
 	if err != nil {
-		log.Printf("ERROR getting feed sources: %v", err)
+		logger.Error("Failed to get feed sources", "err", err)
 		return
 	}
-	log.Printf("Feed sources in database: %d", len(sources))
+	logger.Debug("Feed sources in database", "count", len(sources))
 	for _, source := range sources {
-		log.Printf("  - %s (ID: %d, URL: %s, LastUpdated: %v)",
-			source.Name, source.ID, source.URL, source.LastUpdated)
+		logger.Debug("Feed source", "source", source.Name, "source_id", source.ID, "url", source.URL, "last_updated", source.LastUpdated)
 	}
 
 	items, err := GetAllFeedItems(db, 10)
 	if err != nil {
-		log.Printf("ERROR getting feed items: %v", err)
+		logger.Error("Failed to get feed items", "err", err)
 		return
 	}
-	log.Printf("Feed items in database: %d", len(items))
+	logger.Debug("Latest feed items", "count", len(items))
 	for _, item := range items {
-		log.Printf("  - %s (Source: %d)", item.Title, item.SourceID)
+		logger.Debug("Feed item", "item_id", item.ID, "source_id", item.SourceID)
 	}
 }
 
-// Fetches RSS content from URL.
-func FetchFeed(url string) ([]byte, error) {
-	fmt.Println("REQUEST MADE!")
-	log.Printf("=== FetchFeed called ===")
-	log.Printf("Fetching RSS content from: %s", url)
-	resp, err := client.Get(url)
+// Fetches RSS content from URL. The request is abandoned if ctx is cancelled.
+func FetchFeed(ctx context.Context, url string) ([]byte, error) {
+	logger.Debug("Fetching feed", "url", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("HTTP request failed for %s: %v", url, err)
 		return nil, fmt.Errorf("failed to fetch feed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	log.Printf("HTTP response status: %d for URL: %s", resp.StatusCode, url)
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("HTTP error status %d for URL: %s", resp.StatusCode, url)
 		return nil, fmt.Errorf("feed returned status %d", resp.StatusCode)
 	}
 
@@ -115,10 +139,9 @@ func FetchFeed(url string) ([]byte, error) {
 		}
 		if err != nil {
 			if err == io.EOF {
-				log.Printf("Successfully read %d bytes from %s", totalBytes, url)
+				logger.Debug("Fetched feed", "url", url, "bytes", totalBytes)
 				break
 			}
-			log.Printf("Error reading response body from %s: %v", url, err)
 			return nil, fmt.Errorf("failed to read response: %w", err)
 		}
 	}
@@ -173,25 +196,49 @@ func generateItemID(url string) string {
 }
 
 // Saves feed items to database.
-func SaveFeedItems(db *sql.DB, items []FeedItem) error {
+func SaveFeedItems(db *sqldb.DB, items []FeedItem) error {
+	_, err := SaveNewFeedItems(db, items)
+	return err
+}
+
+// Saves feed items to database and returns the ones that did not exist before.
+//
+// Existing rows keep their created_at and the local votes on their score;
+// the fields and score that come from the upstream feed are refreshed.
+func SaveNewFeedItems(db *sqldb.DB, items []FeedItem) ([]FeedItem, error) {
 	tx, err := db.Begin()
 	if err != nil {
-		return err
-	}
-	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO feed_items
-		(id, source_id, title, url, description, author, published_at, score, comments_count, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, 
-			COALESCE((SELECT score FROM feed_items WHERE id = ?), ?), 
-			?, ?)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	insertStmt, err := tx.Prepare(`
+		INSERT INTO feed_items
+		(id, source_id, title, url, description, author, published_at, score, upstream_score, comments_count, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO NOTHING
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer insertStmt.Close()
+
+	// The score moves by however much the source's score has, keeping the
+	// local votes added on top of it
+	updateStmt, err := tx.Prepare(`
+		UPDATE feed_items
+		SET source_id = ?, title = ?, url = ?, description = ?, author = ?, published_at = ?, comments_count = ?,
+		    score = score - upstream_score + ?, upstream_score = ?
+		WHERE id = ?
 	`)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer stmt.Close()
+	defer updateStmt.Close()
 
+	var inserted []FeedItem
 	for _, item := range items {
-		_, err = stmt.Exec(
+		result, err := insertStmt.Exec(
 			item.ID,
 			item.SourceID,
 			item.Title,
@@ -199,33 +246,73 @@ func SaveFeedItems(db *sql.DB, items []FeedItem) error {
 			item.Description,
 			item.Author,
 			item.PublishedAt,
-			item.ID,
+			item.Score,
 			item.Score,
 			item.CommentsCount,
 			item.CreatedAt,
 		)
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if affected > 0 {
+			inserted = append(inserted, item)
+			continue
+		}
+
+		_, err = updateStmt.Exec(
+			item.SourceID,
+			item.Title,
+			item.URL,
+			item.Description,
+			item.Author,
+			item.PublishedAt,
+			item.CommentsCount,
+			item.Score,
+			item.Score,
+			item.ID,
+		)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return inserted, nil
 }
 
 // Updates the last_updated timestamp for a feed source
-func UpdateFeedSourceTimestamp(db *sql.DB, sourceID int) error {
+func UpdateFeedSourceTimestamp(db *sqldb.DB, sourceID int) error {
 	query := `UPDATE feed_sources SET last_updated = CURRENT_TIMESTAMP WHERE id = ?`
 	_, err := db.Exec(query, sourceID)
 	return err
 }
 
+// Turns a feed source off or back on
+func SetFeedSourceDisabled(db *sqldb.DB, sourceID int, disabled bool) error {
+	result, err := db.Exec(`UPDATE feed_sources SET disabled = ? WHERE id = ?`, disabled, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to update feed source: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // Gets a feed source by URL.
-func GetFeedSourceByURL(db *sql.DB, url string) (*FeedSource, error) {
-	query := `SELECT id, name, url, last_updated, update_interval FROM feed_sources WHERE url = ?`
+func GetFeedSourceByURL(db *sqldb.DB, url string) (*FeedSource, error) {
+	query := `SELECT id, name, url, last_updated, update_interval, disabled FROM feed_sources WHERE url = ?`
 	row := db.QueryRow(query, url)
 
 	var source FeedSource
-	err := row.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval)
+	err := row.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval, &source.Disabled)
 	if err != nil {
 		return nil, err
 	}
@@ -233,12 +320,25 @@ func GetFeedSourceByURL(db *sql.DB, url string) (*FeedSource, error) {
 }
 
 // Gets a feed source by name.
-func GetFeedSourceByName(db *sql.DB, name string) (*FeedSource, error) {
-	query := `SELECT id, name, url, last_updated, update_interval FROM feed_sources WHERE name = ?`
+func GetFeedSourceByName(db *sqldb.DB, name string) (*FeedSource, error) {
+	query := `SELECT id, name, url, last_updated, update_interval, disabled FROM feed_sources WHERE name = ?`
 	row := db.QueryRow(query, name)
 
 	var source FeedSource
-	err := row.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval)
+	err := row.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval, &source.Disabled)
+	if err != nil {
+		return nil, err
+	}
+	return &source, nil
+}
+
+// Gets a feed source by ID.
+func GetFeedSourceByID(db *sqldb.DB, id int) (*FeedSource, error) {
+	query := `SELECT id, name, url, last_updated, update_interval, disabled FROM feed_sources WHERE id = ?`
+	row := db.QueryRow(query, id)
+
+	var source FeedSource
+	err := row.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval, &source.Disabled)
 	if err != nil {
 		return nil, err
 	}
@@ -246,52 +346,36 @@ func GetFeedSourceByName(db *sql.DB, name string) (*FeedSource, error) {
 }
 
 // Creates or updates a feed source - FIXED to check by URL instead of name
-func CreateOrUpdateFeedSource(db *sql.DB, name, url string) (*FeedSource, error) {
+func CreateOrUpdateFeedSource(db *sqldb.DB, name, url string) (*FeedSource, error) {
 	existing, err := GetFeedSourceByURL(db, url)
 	if err == nil {
-		log.Printf("Found existing source: %s (ID: %d, LastUpdated: %v)",
-			name, existing.ID, existing.LastUpdated)
 		return existing, nil
 	}
 
-	log.Printf("Creating new feed source: %s", name)
 	query := `INSERT INTO feed_sources (name, url, last_updated, update_interval) 
-			VALUES (?, ?, datetime('2000-01-01 00:00:00'), 3600)`
-	result, err := db.Exec(query, name, url)
-	if err != nil {
+			VALUES (?, ?, '2000-01-01 00:00:00', ?) RETURNING id`
+	var id int
+	if err := db.QueryRow(query, name, url, DefaultUpdateInterval).Scan(&id); err != nil {
 		return nil, fmt.Errorf("failed to insert feed source: %w", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %w", err)
-	}
-
 	source := &FeedSource{
-		ID:             int(id),
+		ID:             id,
 		Name:           name,
 		URL:            url,
 		LastUpdated:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
-		UpdateInterval: 3600,
+		UpdateInterval: DefaultUpdateInterval,
 	}
 
-	log.Printf("Created new feed source with ID: %d", source.ID)
+	logger.Info("Created feed source", "source", name, "source_id", source.ID)
 	return source, nil
 }
 
 func ShouldUpdateFeed(source FeedSource) bool {
 	timeSince := time.Since(source.LastUpdated)
 	threshold := time.Duration(source.UpdateInterval) * time.Second
-
-	log.Printf("=== ShouldUpdateFeed Check ===")
-	log.Printf("Source: %s (ID: %d)", source.Name, source.ID)
-	log.Printf("LastUpdated: %v", source.LastUpdated)
-	log.Printf("Time since: %v", timeSince)
-	log.Printf("Threshold: %v", threshold)
-	log.Printf("UpdateInterval: %d seconds", source.UpdateInterval)
-	shouldUpdate := timeSince > threshold
-	log.Printf("Should update: %v", shouldUpdate)
-	log.Printf("FORCING UPDATE FOR DEBUGGING")
+	logger.Debug("Forcing feed update", "source", source.Name, "source_id", source.ID,
+		"last_updated", source.LastUpdated, "due", timeSince > threshold)
 
 	return true // Force update for debugging
 }
@@ -300,19 +384,15 @@ func ShouldUpdateFeedNormal(source FeedSource) bool {
 	timeSince := time.Since(source.LastUpdated)
 	threshold := time.Duration(source.UpdateInterval) * time.Second
 	shouldUpdate := timeSince > threshold
-
-	log.Printf("DEBUG ShouldUpdateFeed - Source: %s", source.Name)
-	log.Printf("  LastUpdated: %v", source.LastUpdated)
-	log.Printf("  Time since: %v", timeSince)
-	log.Printf("  Threshold: %v (UpdateInterval: %d seconds)", threshold, source.UpdateInterval)
-	log.Printf("  Should update: %v", shouldUpdate)
+	logger.Debug("Checked whether feed is due", "source", source.Name, "source_id", source.ID,
+		"last_updated", source.LastUpdated, "due", shouldUpdate)
 
 	return shouldUpdate
 }
 
 // Gets all feed sources.
-func GetAllFeedSources(db *sql.DB) ([]FeedSource, error) {
-	query := `SELECT id, name, url, last_updated, update_interval FROM feed_sources`
+func GetAllFeedSources(db *sqldb.DB) ([]FeedSource, error) {
+	query := `SELECT id, name, url, last_updated, update_interval, disabled FROM feed_sources`
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
@@ -322,7 +402,7 @@ func GetAllFeedSources(db *sql.DB) ([]FeedSource, error) {
 	var sources []FeedSource
 	for rows.Next() {
 		var source FeedSource
-		err := rows.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval)
+		err := rows.Scan(&source.ID, &source.Name, &source.URL, &source.LastUpdated, &source.UpdateInterval, &source.Disabled)
 		if err != nil {
 			return nil, err
 		}
@@ -332,7 +412,7 @@ func GetAllFeedSources(db *sql.DB) ([]FeedSource, error) {
 }
 
 // Gets feed items for a specific source.
-func GetFeedItemsBySource(db *sql.DB, sourceID int, limit int) ([]FeedItem, error) {
+func GetFeedItemsBySource(db *sqldb.DB, sourceID int, limit int) ([]FeedItem, error) {
 	query := `SELECT id, source_id, title, url, description, author, published_at, score, comments_count, created_at 
 			FROM feed_items 
 			WHERE source_id = ? 
@@ -358,13 +438,14 @@ func GetFeedItemsBySource(db *sql.DB, sourceID int, limit int) ([]FeedItem, erro
 }
 
 // Gets all feed items sorted by published date.
-func GetAllFeedItems(db *sql.DB, limit int) ([]FeedItem, error) {
+func GetAllFeedItems(db *sqldb.DB, limit int) ([]FeedItem, error) {
 	query := `SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author, fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name as source_name
 			FROM feed_items fi
 			JOIN feed_sources fs ON fi.source_id = fs.id
+			WHERE fs.url NOT LIKE ?
 			ORDER BY fi.published_at DESC
 			LIMIT ?`
-	rows, err := db.Query(query, limit)
+	rows, err := db.Query(query, NewsletterURLPrefix+"%", limit)
 	if err != nil {
 		return nil, err
 	}
@@ -386,15 +467,15 @@ func GetAllFeedItems(db *sql.DB, limit int) ([]FeedItem, error) {
 }
 
 // Gets all feed items sorted by published date, excluding hidden ones for a user
-func GetAllFeedItemsForUser(db *sql.DB, userID int, limit int) ([]FeedItem, error) {
+func GetAllFeedItemsForUser(db *sqldb.DB, userID int, limit int) ([]FeedItem, error) {
 	query := `SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author, fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name as source_name
 			FROM feed_items fi
 			JOIN feed_sources fs ON fi.source_id = fs.id
 			LEFT JOIN hidden_posts hp ON fi.id = hp.item_id AND hp.user_id = ?
-			WHERE hp.item_id IS NULL
+			WHERE hp.item_id IS NULL AND fs.url NOT LIKE ?
 			ORDER BY fi.published_at DESC
 			LIMIT ?`
-	rows, err := db.Query(query, userID, limit)
+	rows, err := db.Query(query, userID, NewsletterURLPrefix+"%", limit)
 	if err != nil {
 		return nil, err
 	}
@@ -416,13 +497,14 @@ func GetAllFeedItemsForUser(db *sql.DB, userID int, limit int) ([]FeedItem, erro
 }
 
 // Gets all feed items with pagination support
-func GetAllFeedItemsWithPagination(db *sql.DB, limit, offset int) ([]FeedItem, error) {
+func GetAllFeedItemsWithPagination(db *sqldb.DB, limit, offset int) ([]FeedItem, error) {
 	query := `SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author, fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name as source_name
 			FROM feed_items fi
 			JOIN feed_sources fs ON fi.source_id = fs.id
+			WHERE fs.url NOT LIKE ?
 			ORDER BY fi.published_at DESC
 			LIMIT ? OFFSET ?`
-	rows, err := db.Query(query, limit, offset)
+	rows, err := db.Query(query, NewsletterURLPrefix+"%", limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -444,15 +526,15 @@ func GetAllFeedItemsWithPagination(db *sql.DB, limit, offset int) ([]FeedItem, e
 }
 
 // Gets all feed items with pagination support, excluding hidden ones for a user
-func GetAllFeedItemsWithPaginationForUser(db *sql.DB, userID int, limit, offset int) ([]FeedItem, error) {
+func GetAllFeedItemsWithPaginationForUser(db *sqldb.DB, userID int, limit, offset int) ([]FeedItem, error) {
 	query := `SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author, fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name as source_name
 			FROM feed_items fi
 			JOIN feed_sources fs ON fi.source_id = fs.id
 			LEFT JOIN hidden_posts hp ON fi.id = hp.item_id AND hp.user_id = ?
-			WHERE hp.item_id IS NULL
+			WHERE hp.item_id IS NULL AND fs.url NOT LIKE ?
 			ORDER BY fi.published_at DESC
 			LIMIT ? OFFSET ?`
-	rows, err := db.Query(query, userID, limit, offset)
+	rows, err := db.Query(query, userID, NewsletterURLPrefix+"%", limit, offset)
 	if err != nil {
 		return nil, err
 	}
@@ -473,7 +555,7 @@ func GetAllFeedItemsWithPaginationForUser(db *sql.DB, userID int, limit, offset
 	return items, nil
 }
 
-func HandleVote(db *sql.DB, itemID string, userID int, voteType string) (int, error) {
+func HandleVote(db *sqldb.DB, itemID string, userID int, voteType string) (int, error) {
 	var existingVoteType sql.NullString
 	err := db.QueryRow("SELECT vote_type FROM upvotes WHERE user_id = ? AND item_id = ?", userID, itemID).Scan(&existingVoteType)
 	if err != nil && err != sql.ErrNoRows {
@@ -0,0 +1,75 @@
+package feeds
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// Seeds shared by the description-scraping fuzz targets.
+var descriptionSeeds = []string{
+	"",
+	"<p>Points: 212</p><p># Comments: 87</p>",
+	"<p>142 points by someone | 38 comments</p>",
+	"1 point | 1 comment",
+	"99999999999999999999999 points",
+	`<table><tr><td><a href="https://i.reddit.com/x.png">[link]</a></td></tr></table>`,
+	`<a href="https://imgur.com/a">a</a><a href="https://example.com">b</a>`,
+	`<a href="https://www.reddit.com/user/x">x</a><a href="https://www.reddit.com/r/go/comments/1/t/">[comments]</a>`,
+	`<a href="/r/go/comments/1/t/">relative</a><a href="javascript:alert(1)">js</a>`,
+	"<a href=",
+	"[OC] [Meta] title",
+}
+
+func FuzzExtractScores(f *testing.F) {
+	for _, seed := range descriptionSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, description string) {
+		for name, extract := range map[string]func(string) int{
+			"extractRedditScore":  extractRedditScore,
+			"extractHNScore":      extractHNScore,
+			"extractHNComments":   extractHNComments,
+			"extractLobsterScore": extractLobsterScore,
+		} {
+			if n := extract(description); n < 0 {
+				t.Errorf("%s(%q) = %d, want a non-negative count", name, description, n)
+			}
+		}
+	})
+}
+
+func FuzzCleanRedditTitle(f *testing.F) {
+	for _, seed := range descriptionSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, title string) {
+		cleaned := cleanRedditTitle(title)
+		if len(cleaned) > len(title) {
+			t.Errorf("cleanRedditTitle(%q) grew the title to %q", title, cleaned)
+		}
+		if !strings.HasSuffix(title, cleaned) {
+			t.Errorf("cleanRedditTitle(%q) = %q, want a suffix of the input", title, cleaned)
+		}
+	})
+}
+
+func FuzzExtractRedditInnerLink(f *testing.F) {
+	for _, seed := range descriptionSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, description string) {
+		link := extractRedditInnerLink(description)
+		if link == "" {
+			return
+		}
+		u, err := url.Parse(link)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			t.Fatalf("extractRedditInnerLink(%q) = %q, want empty or an absolute http(s) URL", description, link)
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		if isDirectRedditLink(link) || host == "reddit.com" || host == "www.reddit.com" || host == "old.reddit.com" {
+			t.Errorf("extractRedditInnerLink(%q) = %q, a link back to reddit", description, link)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package feeds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// An OPML document, the format feed readers use to exchange subscription lists
+type OPML struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Created string        `xml:"head>dateCreated,omitempty"`
+	Body    []OPMLOutline `xml:"body>outline"`
+}
+
+// An OPML outline, either a feed or a folder of further outlines
+type OPMLOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	Outlines []OPMLOutline `xml:"outline"`
+}
+
+// A feed found in an OPML document along with the folder it was in
+type OPMLFeed struct {
+	// Name of the top-level folder holding the feed, or "" if it had none
+	Category string
+	Name     string
+	URL      string
+}
+
+// Creates an empty OPML 2.0 document
+func NewOPML(title string, created time.Time) *OPML {
+	return &OPML{
+		Version: "2.0",
+		Title:   title,
+		Created: created.UTC().Format(time.RFC1123Z),
+	}
+}
+
+// Reads an OPML document
+func ParseOPML(r io.Reader) (*OPML, error) {
+	var doc OPML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OPML: %w", err)
+	}
+	return &doc, nil
+}
+
+// Writes the document with an XML header
+func (o *OPML) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(o); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Lists every feed in the document. Feeds in nested folders are counted as
+// part of their top-level folder.
+func (o *OPML) Feeds() []OPMLFeed {
+	var found []OPMLFeed
+	var walk func(category string, outlines []OPMLOutline)
+	walk = func(category string, outlines []OPMLOutline) {
+		for _, outline := range outlines {
+			name := strings.TrimSpace(outline.Text)
+			if name == "" {
+				name = strings.TrimSpace(outline.Title)
+			}
+			if url := strings.TrimSpace(outline.XMLURL); url != "" {
+				if name == "" {
+					name = url
+				}
+				found = append(found, OPMLFeed{Category: category, Name: name, URL: url})
+			}
+			if len(outline.Outlines) > 0 {
+				folder := category
+				if folder == "" {
+					folder = name
+				}
+				walk(folder, outline.Outlines)
+			}
+		}
+	}
+	walk("", o.Body)
+	return found
+}
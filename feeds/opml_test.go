@@ -0,0 +1,66 @@
+package feeds
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOPMLFeeds(t *testing.T) {
+	doc, err := ParseOPML(strings.NewReader(`<?xml version="1.0"?>
+<opml version="1.0">
+  <head><title>Subscriptions</title></head>
+  <body>
+    <outline text="Go">
+      <outline text="Go Blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom"/>
+      <outline title="Nested">
+        <outline title="Titled only" xmlUrl="https://example.com/titled.xml"/>
+      </outline>
+    </outline>
+    <outline xmlUrl="https://example.com/unnamed.xml"/>
+  </body>
+</opml>`))
+	if err != nil {
+		t.Fatalf("ParseOPML: %v", err)
+	}
+
+	want := []OPMLFeed{
+		{Category: "Go", Name: "Go Blog", URL: "https://go.dev/blog/feed.atom"},
+		{Category: "Go", Name: "Titled only", URL: "https://example.com/titled.xml"},
+		{Category: "", Name: "https://example.com/unnamed.xml", URL: "https://example.com/unnamed.xml"},
+	}
+	if got := doc.Feeds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Feeds() = %+v, want %+v", got, want)
+	}
+
+	if _, err := ParseOPML(strings.NewReader("not xml")); err == nil {
+		t.Error("ParseOPML accepted garbage")
+	}
+}
+
+func TestOPMLRoundTrip(t *testing.T) {
+	doc := NewOPML("Versed feeds", time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC))
+	doc.Body = []OPMLOutline{{Text: "Tech & Code", Outlines: []OPMLOutline{{Text: "Lobsters", Type: "rss", XMLURL: "https://lobste.rs/rss"}}}}
+
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "<?xml") {
+		t.Errorf("OPML lacks an XML header:\n%s", buf.String())
+	}
+
+	parsed, err := ParseOPML(&buf)
+	if err != nil {
+		t.Fatalf("ParseOPML: %v", err)
+	}
+	if parsed.Title != "Versed feeds" || parsed.Version != "2.0" {
+		t.Errorf("parsed head = %q version %q", parsed.Title, parsed.Version)
+	}
+	want := []OPMLFeed{{Category: "Tech & Code", Name: "Lobsters", URL: "https://lobste.rs/rss"}}
+	if got := parsed.Feeds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Feeds() = %+v, want %+v", got, want)
+	}
+}
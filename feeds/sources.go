@@ -2,6 +2,7 @@ package feeds
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -106,7 +107,7 @@ func extractRedditInnerLink(description string) string {
 	var links []string
 	doc.Find("a").Each(func(i int, s *goquery.Selection) {
 		href, exists := s.Attr("href")
-		if exists {
+		if exists && isOffRedditLink(href) {
 			links = append(links, href)
 		}
 	})
@@ -127,6 +128,18 @@ func extractRedditInnerLink(description string) string {
 	return ""
 }
 
+// Reports whether href is an absolute http(s) link away from reddit itself,
+// such as the article a post links to rather than its comments or author.
+// i.reddit.com counts as away, since it only serves media.
+func isOffRedditLink(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || isDirectRedditLink(href) {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return host == "i.reddit.com" || (host != "reddit.com" && !strings.HasSuffix(host, ".reddit.com"))
+}
+
 // Determines if a URL is a direct Reddit link that should be avoided
 func isDirectRedditLink(url string) bool {
 	return strings.Contains(url, "reddit.com/r/") && strings.Contains(url, "/comments/")
@@ -185,23 +198,29 @@ func (h *HackerNewsFeed) ParseFeed(content []byte, sourceID int) ([]FeedItem, er
 	return items, nil
 }
 
+// Match counts both as "212 points" and as hnrss's "Points: 212".
+var (
+	hnScorePattern    = regexp.MustCompile(`(?i)(\d+)\s*points?\b|\bpoints?:\s*(\d+)`)
+	hnCommentsPattern = regexp.MustCompile(`(?i)(\d+)\s*comments?\b|\bcomments?:\s*(\d+)`)
+)
+
 func extractHNScore(description string) int {
-	re := regexp.MustCompile(`(\d+)\s*points?`)
-	matches := re.FindStringSubmatch(description)
-	if len(matches) > 1 {
-		if score, err := strconv.Atoi(matches[1]); err == nil {
-			return score
-		}
-	}
-	return 0
+	return extractHNCount(hnScorePattern, description)
 }
 
 func extractHNComments(description string) int {
-	re := regexp.MustCompile(`(\d+)\s*comments?`)
-	matches := re.FindStringSubmatch(description)
-	if len(matches) > 1 {
-		if comments, err := strconv.Atoi(matches[1]); err == nil {
-			return comments
+	return extractHNCount(hnCommentsPattern, description)
+}
+
+// Returns the count captured by whichever side of pattern matched first.
+func extractHNCount(pattern *regexp.Regexp, description string) int {
+	matches := pattern.FindStringSubmatch(description)
+	if len(matches) == 0 {
+		return 0
+	}
+	for _, match := range matches[1:] {
+		if n, err := strconv.Atoi(match); err == nil {
+			return n
 		}
 	}
 	return 0
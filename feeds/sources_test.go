@@ -0,0 +1,169 @@
+package feeds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Rewrites the golden files from the current parser output.
+//
+// Usage: go test ./feeds -run TestParsers -update
+var update = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// Describes a single fixture run through a single parser.
+type parserCase struct {
+	name    string
+	fixture string
+	source  FeedSourceInterface
+}
+
+var parserCases = []parserCase{
+	{"hackernews", "hackernews.xml", &HackerNewsFeed{}},
+	{"reddit", "reddit.xml", &RedditFeed{Subreddit: "programming"}},
+	{"lobsters", "lobsters.xml", &LobsterFeed{}},
+	{"generic_rss", "generic_rss.xml", CreateGenericRSSFeed("", "BBC News - Technology")},
+	{"generic_atom", "generic_atom.xml", CreateGenericRSSFeed("", "Nature News")},
+	{"generic_json", "generic_json.json", CreateGenericRSSFeed("", "Example Engineering Blog")},
+}
+
+// Serves every file in testdata/fixtures with a content type matching its extension.
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	fixtures := http.FileServer(http.Dir(filepath.Join("testdata", "fixtures")))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch filepath.Ext(r.URL.Path) {
+		case ".json":
+			w.Header().Set("Content-Type", "application/feed+json")
+		case ".xml":
+			w.Header().Set("Content-Type", "application/xml")
+		}
+		fixtures.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Fetches a fixture through FetchFeed so the HTTP path is exercised too.
+func fetchFixture(t *testing.T, server *httptest.Server, fixture string) []byte {
+	t.Helper()
+	content, err := FetchFeed(context.Background(), server.URL+"/"+fixture)
+	if err != nil {
+		t.Fatalf("fetching fixture %s: %v", fixture, err)
+	}
+	return content
+}
+
+// Strips fields that depend on the wall clock so output is stable across runs.
+func normalizeItems(items []FeedItem) []FeedItem {
+	out := make([]FeedItem, len(items))
+	for i, item := range items {
+		item.CreatedAt = nil
+		out[i] = item
+	}
+	return out
+}
+
+// Compares items against testdata/golden/<name>.json, rewriting it when -update is set.
+func assertGolden(t *testing.T, name string, items []FeedItem) {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(normalizeItems(items)); err != nil {
+		t.Fatalf("marshalling items: %v", err)
+	}
+	got := buf.Bytes()
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("writing golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match golden output\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func TestParsers(t *testing.T) {
+	server := newFixtureServer(t)
+
+	for _, tc := range parserCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content := fetchFixture(t, server, tc.fixture)
+			items, err := tc.source.ParseFeed(content, 1)
+			if err != nil {
+				t.Fatalf("ParseFeed: %v", err)
+			}
+			if len(items) == 0 {
+				t.Fatalf("ParseFeed returned no items for %s", tc.fixture)
+			}
+			assertGolden(t, tc.name, items)
+		})
+	}
+}
+
+func TestParseFeedWithParser(t *testing.T) {
+	server := newFixtureServer(t)
+
+	for _, tc := range parserCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content := fetchFixture(t, server, tc.fixture)
+			items, err := ParseFeedWithParser(content, 1, tc.source.GetSourceName())
+			if err != nil {
+				t.Fatalf("ParseFeedWithParser: %v", err)
+			}
+			assertGolden(t, "generic_parser_"+tc.name, items)
+		})
+	}
+}
+
+func TestParseFeedRejectsGarbage(t *testing.T) {
+	for _, tc := range parserCases {
+		if _, err := tc.source.ParseFeed([]byte("<html><body>not a feed</body></html>"), 1); err == nil {
+			t.Errorf("%s: expected an error for non-feed content", tc.name)
+		}
+	}
+}
+
+func TestFetchFeedNonOK(t *testing.T) {
+	server := newFixtureServer(t)
+	if _, err := FetchFeed(context.Background(), server.URL+"/missing.xml"); err == nil {
+		t.Fatal("expected an error for a 404 response")
+	}
+}
+
+func TestExtractHNCounts(t *testing.T) {
+	tests := []struct {
+		description     string
+		score, comments int
+	}{
+		{"<p>Points: 212</p>\n<p># Comments: 87</p>", 212, 87},
+		{"<p>142 points by someone | 38 comments</p>", 142, 38},
+		{"<p>1 point | 1 comment</p>", 1, 1},
+		{`<p>Comments URL: <a href="https://news.ycombinator.com/item?id=41000001">link</a></p>`, 0, 0},
+		{"", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := extractHNScore(tt.description); got != tt.score {
+			t.Errorf("extractHNScore(%q) = %d, want %d", tt.description, got, tt.score)
+		}
+		if got := extractHNComments(tt.description); got != tt.comments {
+			t.Errorf("extractHNComments(%q) = %d, want %d", tt.description, got, tt.comments)
+		}
+	}
+}
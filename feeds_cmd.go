@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/feeds"
+)
+
+const feedsUsage = `usage: versed feeds COMMAND [arguments]
+
+commands:
+  list              list feed sources
+  add NAME URL      add a feed source
+  remove SOURCE     delete a feed source along with its items, votes and
+                    comments, taking it out of every category and subverse
+  disable SOURCE    stop fetching a feed source
+  enable SOURCE     start fetching a disabled feed source again
+
+SOURCE is a feed source ID, name or URL.`
+
+// Runs `versed feeds ...` and returns the process exit code
+func runFeedsCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, feedsUsage)
+		return 2
+	}
+	flags := flag.NewFlagSet("feeds "+args[0], flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, feedsUsage) }
+	command := args[0]
+	args, ok := parseFlags(flags, args[1:])
+	if !ok {
+		return 2
+	}
+
+	wantArgs := map[string]int{"list": 0, "add": 2, "remove": 1, "disable": 1, "enable": 1}
+	if n, known := wantArgs[command]; !known || len(args) != n {
+		flags.Usage()
+		return 2
+	}
+
+	if _, ok := openConfiguredDatabase(); !ok {
+		return 1
+	}
+	defer database.CloseConnection()
+	db := database.GetDB()
+
+	switch command {
+	case "list":
+		return listFeedSources()
+	case "add":
+		name, url := args[0], args[1]
+		if !isFeedURL(url) {
+			fmt.Fprintf(os.Stderr, "%q is not an http or https URL\n", url)
+			return 1
+		}
+		source, err := feeds.CreateOrUpdateFeedSource(db, name, url)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to add feed source:", err)
+			return 1
+		}
+		fmt.Printf("Feed source %d is %s (%s)\n", source.ID, source.Name, source.URL)
+		return 0
+	}
+
+	source, err := findFeedSource(db, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch command {
+	case "remove":
+		err := database.DeleteFeedSource(db, source.ID)
+		if errors.Is(err, database.ErrNewsletterFeedSource) {
+			fmt.Fprintf(os.Stderr, "%s belongs to a newsletter address, remove that from the owner's profile instead\n", source.Name)
+			return 1
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to remove feed source:", err)
+			return 1
+		}
+		fmt.Printf("Removed %s\n", source.Name)
+	case "disable", "enable":
+		if err := feeds.SetFeedSourceDisabled(db, source.ID, command == "disable"); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to update feed source:", err)
+			return 1
+		}
+		fmt.Printf("%s is %sd\n", source.Name, command)
+	}
+	return 0
+}
+
+func listFeedSources() int {
+	sources, err := feeds.GetAllFeedSources(database.GetDB())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to list feed sources:", err)
+		return 1
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].ID < sources[j].ID })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tURL\tLAST UPDATED\tSTATUS")
+	for _, source := range sources {
+		status := "enabled"
+		if source.Disabled {
+			status = "disabled"
+		}
+		lastUpdated := "never"
+		if source.LastUpdated.Year() > 2000 {
+			lastUpdated = source.LastUpdated.Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", source.ID, source.Name, source.URL, lastUpdated, status)
+	}
+	w.Flush()
+	return 0
+}
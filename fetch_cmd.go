@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/webhooks"
+)
+
+const workerUsage = `usage: versed worker
+
+Runs only the feed scheduler, which updates feeds, runs saved searches and
+takes the configured snapshots. Webhook deliveries it queues are sent by the
+server, which should be started with versed serve -no-scheduler.`
+
+const fetchUsage = `usage: versed fetch [-dry-run] [-name NAME] SOURCE
+
+Fetches one feed source straight away and prints what was found. SOURCE is a
+feed source ID, name or URL. A URL that is not a feed source yet is added as
+one, named NAME or after the URL.
+
+  -dry-run  fetch and parse the feed without saving anything`
+
+// Runs `versed worker` and returns the process exit code
+func runWorkerCommand(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(os.Stderr, workerUsage)
+		return 2
+	}
+	cfg, ok := openConfiguredDatabase()
+	if !ok {
+		return 1
+	}
+	defer database.CloseConnection()
+
+	var (
+		// Deliveries are only queued here, the server's dispatcher sends them
+		dispatcher = webhooks.NewDispatcher(database.GetDB())
+		scheduler  = NewFeedScheduler(database.GetDB(), dispatcher, time.Duration(cfg.Scheduler.Interval))
+	)
+	scheduler.ScheduleSnapshots(cfg.SnapshotConfig())
+	scheduler.Start()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	schedulerLog.Info("Shutdown signal received, shutting down")
+
+	scheduler.Stop()
+	return 0
+}
+
+// Runs `versed fetch ...` and returns the process exit code
+func runFetchCommand(args []string) int {
+	flags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, fetchUsage) }
+	dryRun := flags.Bool("dry-run", false, "do not save anything")
+	name := flags.String("name", "", "name for a new feed source")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return 2
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return 2
+	}
+	ref := args[0]
+
+	if _, ok := openConfiguredDatabase(); !ok {
+		return 1
+	}
+	defer database.CloseConnection()
+	db := database.GetDB()
+
+	source, err := findFeedSource(db, ref)
+	if errors.Is(err, sql.ErrNoRows) && isFeedURL(ref) {
+		if *name == "" {
+			*name = ref
+		}
+		if *dryRun {
+			source, err = &feeds.FeedSource{Name: *name, URL: ref}, nil
+		} else {
+			fmt.Printf("Adding feed source %s\n", *name)
+			source, err = feeds.CreateOrUpdateFeedSource(db, *name, ref)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if source.Disabled {
+		fmt.Printf("%s is disabled, fetching it anyway\n", source.Name)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Fetching %s from %s\n", source.Name, source.URL)
+	started := time.Now()
+	content, err := feeds.FetchFeed(ctx, source.URL)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Fetch failed:", err)
+		return 1
+	}
+	fmt.Printf("Fetched %d bytes in %s\n", len(content), time.Since(started).Round(time.Millisecond))
+
+	items, err := parserFor(source).ParseFeed(content, source.ID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Parse failed:", err)
+		return 1
+	}
+	fmt.Printf("Parsed %d items\n", len(items))
+	for i := range items {
+		items[i].SourceName = source.Name
+		printFeedItem(items[i])
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing saved")
+		return 0
+	}
+	return saveFetchedItems(db, source, items)
+}
+
+// Saves freshly fetched items and hands the new ones to saved searches and
+// webhooks, as the scheduler does
+func saveFetchedItems(db *sqldb.DB, source *feeds.FeedSource, items []feeds.FeedItem) int {
+	newItems, err := feeds.SaveNewFeedItems(db, items)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to save items:", err)
+		return 1
+	}
+	if err := feeds.UpdateFeedSourceTimestamp(db, source.ID); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to update feed source timestamp:", err)
+		return 1
+	}
+	fmt.Printf("Saved %d items, %d of them new\n", len(items), len(newItems))
+	if len(newItems) == 0 {
+		return 0
+	}
+
+	webhooks.NewDispatcher(db).Notify(newItems)
+	ids := make([]string, len(newItems))
+	for i, item := range newItems {
+		ids[i] = item.ID
+	}
+	matched, err := database.RunSavedSearches(db, ids)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to run saved searches:", err)
+		return 1
+	}
+	if matched > 0 {
+		fmt.Printf("Saved searches matched %d times\n", matched)
+	}
+	return 0
+}
+
+// Returns the parser for a feed source: the built-in one for the sources the
+// scheduler knows, and the generic RSS parser for the rest
+func parserFor(source *feeds.FeedSource) feeds.FeedSourceInterface {
+	for _, builtIn := range feeds.NewFeedManager().Sources {
+		if builtIn.GetFeedURL() == source.URL {
+			return builtIn
+		}
+	}
+	return feeds.CreateGenericRSSFeed(source.URL, source.Name)
+}
+
+func printFeedItem(item feeds.FeedItem) {
+	published := "unknown date"
+	if item.PublishedAt != nil {
+		published = item.PublishedAt.Format("2006-01-02 15:04")
+	}
+	fmt.Printf("  %s  %s\n", published, item.Title)
+	fmt.Printf("  %16s  %s (score %d, %d comments)\n", "", item.URL, item.Score, item.CommentsCount)
+}
+
+// Reports whether a feed source reference is a URL rather than an ID or name
+func isFeedURL(ref string) bool {
+	return strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://")
+}
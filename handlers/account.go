@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/navid-m/versed/accounts"
+	"github.com/navid-m/versed/passwords"
+)
+
+// Reports whether the authenticated user's account is scheduled for deletion
+func (a *App) GetAccountDeletion(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	scheduledAt, err := a.Accounts.Scheduled(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get account deletion", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get account deletion",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"scheduled":    scheduledAt != nil,
+		"scheduled_at": scheduledAt,
+	})
+}
+
+// Schedules the authenticated user's account for deletion after they confirm
+// their password
+func (a *App) ScheduleAccountDeletion(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+	email, _ := c.Locals("userEmail").(string)
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Password == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Password is required",
+		})
+	}
+
+	user, err := a.Users.ByEmail(email)
+	if err != nil || user.ID != userID {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+	if err := passwords.Verify(user.Password, req.Password); err != nil {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Incorrect password",
+		})
+	}
+
+	scheduledAt, err := a.Accounts.Schedule(userID, time.Now())
+	if err != nil {
+		requestLog(c).Error("Failed to schedule account deletion", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to schedule account deletion",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":      "Your account is scheduled for deletion",
+		"scheduled":    true,
+		"scheduled_at": scheduledAt,
+	})
+}
+
+// Calls off the authenticated user's scheduled account deletion
+func (a *App) CancelAccountDeletion(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	err := a.Accounts.Cancel(userID)
+	if errors.Is(err, accounts.ErrNotScheduled) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Account deletion is not scheduled",
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to cancel account deletion", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to cancel account deletion",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "Account deletion cancelled",
+		"scheduled": false,
+	})
+}
+
+// Deletes a user's account straight away, skipping the grace period
+func (a *App) AdminDeleteUser(c *fiber.Ctx) error {
+	adminID := c.Locals("userID").(int)
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	if userID == adminID {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Delete your own account from your profile instead",
+		})
+	}
+
+	err = a.Accounts.Delete(userID, time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to delete user", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to delete user",
+		})
+	}
+
+	requestLog(c).Info("Admin deleted user", "admin_id", adminID, "user_id", userID)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "User deleted successfully",
+	})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/navid-m/versed/models"
+)
+
+// Lets only admins through, setting the isAdmin local for later handlers
+func (a *App) RequireAdmin(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).Redirect("/signin")
+	}
+
+	isAdmin, err := a.Users.IsAdmin(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to check admin status", "user_id", userID, "err", err)
+		return c.Status(500).SendString("Internal server error")
+	}
+
+	if !isAdmin {
+		return c.Status(403).SendString("Access denied. Admin privileges required.")
+	}
+
+	setupRequired, err := a.TwoFactorAuth.SetupRequired(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to check two-factor status", "user_id", userID, "err", err)
+		return c.Status(500).SendString("Internal server error")
+	}
+	if setupRequired {
+		return c.Status(403).SendString("Access denied. Enable two-factor authentication on your profile to use admin features.")
+	}
+
+	c.Locals("isAdmin", isAdmin)
+	return c.Next()
+}
+
+// Renders the admin dashboard
+func (a *App) AdminPage(c *fiber.Ctx) error {
+	userEmail := c.Locals("userEmail")
+	userUsername := c.Locals("userUsername")
+
+	data := fiber.Map{}
+	if userEmail != nil {
+		data["Email"] = userEmail
+	}
+	if userUsername != nil {
+		data["Username"] = userUsername
+	}
+
+	return c.Render("admin", data)
+}
+
+// Returns every registered user
+func (a *App) GetUsers(c *fiber.Ctx) error {
+	users, err := a.Users.All()
+	if err != nil {
+		requestLog(c).Error("Failed to get users", "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve users",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"users": users,
+	})
+}
+
+// Returns every IP ban, active or lifted
+func (a *App) GetBannedIPs(c *fiber.Ctx) error {
+	bannedIPs, err := a.Bans.List()
+	if err != nil {
+		requestLog(c).Error("Failed to get banned IPs", "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve banned IPs",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"bannedIPs": bannedIPs,
+	})
+}
+
+// Bans an IP address from the site
+func (a *App) BanIP(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var banRequest struct {
+		IPAddress string `json:"ipAddress"`
+		Reason    string `json:"reason"`
+	}
+
+	if err := c.BodyParser(&banRequest); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if banRequest.IPAddress == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "IP address is required",
+		})
+	}
+
+	err := a.Bans.Ban(banRequest.IPAddress, banRequest.Reason, userID)
+	if err != nil {
+		requestLog(c).Error("Failed to ban IP", "ip", banRequest.IPAddress, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to ban IP address",
+		})
+	}
+
+	requestLog(c).Info("Admin banned IP", "admin_id", userID, "ip", banRequest.IPAddress)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "IP address banned successfully",
+	})
+}
+
+// Lifts the ban on an IP address
+func (a *App) UnbanIP(c *fiber.Ctx) error {
+	userID := c.Locals("userID").(int)
+
+	var unbanRequest struct {
+		IPAddress string `json:"ipAddress"`
+	}
+
+	if err := c.BodyParser(&unbanRequest); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	if unbanRequest.IPAddress == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "IP address is required",
+		})
+	}
+
+	err := a.Bans.Unban(unbanRequest.IPAddress, userID)
+	if err != nil {
+		requestLog(c).Error("Failed to unban IP", "ip", unbanRequest.IPAddress, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to unban IP address",
+		})
+	}
+
+	requestLog(c).Info("Admin unbanned IP", "admin_id", userID, "ip", unbanRequest.IPAddress)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "IP address unbanned successfully",
+	})
+}
+
+// Reports whether the current user is an admin and has verified their email
+// address, along with their saved searches and how many new matches they have
+// not seen yet
+func (a *App) UserStatus(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.JSON(fiber.Map{
+			"isAdmin": false,
+		})
+	}
+
+	user, err := a.Users.ByID(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to check admin status", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check admin status",
+		})
+	}
+
+	searches, err := a.SavedSearches.List(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get saved searches", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get saved searches",
+		})
+	}
+	if searches == nil {
+		searches = []models.SavedSearch{}
+	}
+	unseen := 0
+	for _, saved := range searches {
+		unseen += saved.Unseen
+	}
+
+	return c.JSON(fiber.Map{
+		"isAdmin":       user.IsAdmin,
+		"emailVerified": user.EmailVerified || !a.Verifier.Required(),
+		"savedSearches": searches,
+		"unseenMatches": unseen,
+	})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/navid-m/versed/accounts"
+	"github.com/navid-m/versed/repository"
+)
+
+// Returns the personal access token in an Authorization: Bearer header.
+// Other bearer tokens, such as the metrics scraper's, are left to the
+// handlers that expect them.
+func bearerToken(c *fiber.Ctx) (string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, strings.HasPrefix(token, accounts.TokenPrefix)
+}
+
+// Signs a request in as the owner of a personal access token, as long as the
+// token has the scope the request needs
+func (a *App) tokenLocals(c *fiber.Ctx, raw string) error {
+	token, err := a.Tokens.Authenticate(raw, time.Now())
+	if errors.Is(err, accounts.ErrInvalidToken) {
+		requestLog(c).Info("Request with an invalid API token")
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Invalid API token",
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to check API token", "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check API token",
+		})
+	}
+
+	scope := tokenScope(c.Method(), c.Path())
+	if scope == "" {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "API tokens cannot be used for this request",
+		})
+	}
+	if !slices.Contains(token.Scopes, scope) {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "This API token lacks the " + scope + " scope",
+		})
+	}
+
+	user, err := a.Users.ByID(token.UserID)
+	if err != nil {
+		requestLog(c).Error("Failed to get API token owner", "token_id", token.ID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check API token",
+		})
+	}
+	c.Locals("userID", user.ID)
+	c.Locals("userEmail", user.Email)
+	c.Locals("userUsername", user.Username)
+	c.Locals("apiToken", token)
+	return c.Next()
+}
+
+// Returns the scope a token needs for a request, or "" for requests tokens
+// may not make at all, such as managing the account or its tokens
+func tokenScope(method, path string) string {
+	// Routes match whatever the case, so /API/ACCOUNT reaches /api/account
+	path = strings.ToLower(path)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "admin" || parts[0] == "metrics" ||
+		len(parts) > 1 && parts[0] == "api" && parts[1] == "admin":
+		return accounts.ScopeAdmin
+	case len(parts) > 1 && parts[0] == "api" && parts[1] == "account":
+		return ""
+	case method == fiber.MethodGet || method == fiber.MethodHead:
+		return accounts.ScopeRead
+	case len(parts) > 1 && parts[0] == "api" && parts[1] == "categories":
+		return accounts.ScopeCategories
+	case path == "/api/vote",
+		len(parts) == 4 && parts[0] == "api" && parts[1] == "posts" && (parts[3] == "comments" || parts[3] == "vote"),
+		len(parts) == 3 && parts[0] == "api" && parts[1] == "comments",
+		len(parts) == 3 && parts[0] == "s" && parts[2] == "posts",
+		len(parts) == 2 && parts[0] == "posts":
+		return accounts.ScopeInteract
+	}
+	return ""
+}
+
+// Lists the signed-in user's personal access tokens
+func (a *App) GetAPITokens(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	tokens, err := a.Tokens.List(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get API tokens", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get API tokens",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"tokens": tokens,
+		"scopes": accounts.Scopes,
+	})
+}
+
+// Creates a personal access token, returning the token itself this once
+func (a *App) CreateAPIToken(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	raw, token, err := a.Tokens.Create(userID, req.Name, req.Scopes)
+	var invalid *accounts.ValidationError
+	if errors.As(err, &invalid) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": invalid.Message,
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to create API token", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create API token",
+		})
+	}
+	return c.Status(201).JSON(fiber.Map{
+		"token":     raw,
+		"api_token": token,
+	})
+}
+
+// Revokes one of the signed-in user's personal access tokens
+func (a *App) RevokeAPIToken(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid token ID",
+		})
+	}
+
+	err = a.Tokens.Revoke(userID, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "API token not found",
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to revoke API token", "user_id", userID, "token_id", id, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to revoke API token",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "API token revoked",
+	})
+}
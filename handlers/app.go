@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2/middleware/session"
+
+	"github.com/navid-m/versed/accounts"
+	"github.com/navid-m/versed/digest"
+	"github.com/navid-m/versed/exports"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/newsletters"
+	"github.com/navid-m/versed/repository"
+)
+
+// Holds everything the HTTP handlers depend on.
+//
+// Handlers reach storage only through the embedded repositories, so tests
+// can swap in repositorytest.New.
+type App struct {
+	repository.Repositories
+
+	Store          *session.Store
+	DigestSender   *digest.Service
+	Inbound        *newsletters.Service
+	Exports        *exports.Service
+	Accounts       *accounts.Service
+	PasswordResets *accounts.PasswordResets
+	Verifier       *accounts.Verifier
+	Settings       *accounts.Settings
+	TwoFactorAuth  *accounts.TwoFactor
+	Tokens         *accounts.Tokens
+
+	// Who besides admins may read /metrics
+	MetricsAccess metrics.Access
+	// What /readyz checks
+	ReadinessChecks []ReadinessCheck
+
+	// Set by Drain once shutdown begins
+	draining atomic.Bool
+}
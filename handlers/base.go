@@ -1,20 +1,19 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"strings"
-	"unicode"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/session"
-	"github.com/gofiber/template/django/v3"
-	"github.com/navid-m/versed/database"
-	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/accounts"
 	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/passwords"
+	"github.com/navid-m/versed/repository"
 )
 
-func SignUpHandler(c *fiber.Ctx, store *session.Store) error {
+func (a *App) SignUpHandler(c *fiber.Ctx) error {
 	email := c.FormValue("email")
 	username := c.FormValue("username")
 	password := c.FormValue("password")
@@ -22,45 +21,39 @@ func SignUpHandler(c *fiber.Ctx, store *session.Store) error {
 		return c.Status(400).SendString("Email, username, and password are required")
 	}
 
-	if !strings.Contains(email, "@") || !strings.Contains(email, ".") {
-		return c.Status(400).SendString("Enter a valid email address")
-	}
-
-	if len(username) < 3 || len(username) > 20 {
-		return c.Status(400).SendString("Username must be between 3 and 20 characters")
-	}
-	for _, r := range username {
-		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' {
-			return c.Status(400).SendString("Username can only contain letters, numbers, and underscores")
+	for _, err := range []error{
+		accounts.ValidateEmail(email),
+		accounts.ValidateUsername(username),
+		accounts.CheckPassword(password, email, username),
+	} {
+		if err != nil {
+			return c.Status(400).SendString(err.Error())
 		}
 	}
 
-	if len(password) < 3 {
-		return c.Status(400).SendString("Password must be at least 3 characters long")
-	}
-
-	err := database.CreateUser(email, username, password, c.IP())
-	if err != nil {
-		switch err.Error() {
-		case "email already in use":
-			return c.Status(400).SendString("This email is already registered")
-		case "username already taken":
-			return c.Status(400).SendString("This username is already taken")
-		default:
-			log.Printf("Error creating user: %v", err)
-			return c.Status(500).SendString("An error occurred while creating your account")
-		}
+	err := a.Users.Create(email, username, password, c.IP())
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		return c.Status(400).SendString("This email is already registered")
+	case errors.Is(err, repository.ErrUsernameTaken):
+		return c.Status(400).SendString("This username is already taken")
+	case err != nil:
+		requestLog(c).Error("Failed to create user", "err", err)
+		return c.Status(500).SendString("An error occurred while creating your account")
 	}
 
-	user, err := database.GetUserByEmail(email)
+	user, err := a.Users.ByEmail(email)
 	if err != nil {
-		log.Printf("Error getting new user after signup: %v", err)
+		requestLog(c).Error("Failed to get new user after signup", "err", err)
 		return c.Redirect("/signin")
 	}
+	if err := a.Verifier.Begin(user, time.Now()); err != nil {
+		requestLog(c).Error("Failed to start email verification", "user_id", user.ID, "err", err)
+	}
 
-	sess, err := store.Get(c)
+	sess, err := a.Store.Get(c)
 	if err != nil {
-		log.Printf("Error getting session: %v", err)
+		requestLog(c).Error("Failed to get session", "err", err)
 		return c.Redirect("/signin")
 	}
 
@@ -69,14 +62,14 @@ func SignUpHandler(c *fiber.Ctx, store *session.Store) error {
 	sess.Set("user_username", user.Username)
 
 	if err := sess.Save(); err != nil {
-		log.Printf("Error saving session: %v", err)
+		requestLog(c).Error("Failed to save session", "user_id", user.ID, "err", err)
 		return c.Redirect("/signin")
 	}
 
 	return c.Redirect("/")
 }
 
-func AboutHandler(c *fiber.Ctx) error {
+func (a *App) AboutHandler(c *fiber.Ctx) error {
 	userEmail := c.Locals("userEmail")
 	userUsername := c.Locals("userUsername")
 
@@ -91,22 +84,14 @@ func AboutHandler(c *fiber.Ctx) error {
 	return c.Render("about", data)
 }
 
-func IndexHandler(c *fiber.Ctx) error {
+func (a *App) IndexHandler(c *fiber.Ctx) error {
 	userEmail := c.Locals("userEmail")
 	userUsername := c.Locals("userUsername")
-	userID := c.Locals("userID")
-
-	var feedItems []feeds.FeedItem
-	var err error
-
-	if userID != nil {
-		feedItems, err = feeds.GetAllFeedItemsForUser(database.GetDB(), userID.(int), 20)
-	} else {
-		feedItems, err = feeds.GetAllFeedItems(database.GetDB(), 20)
-	}
+	userID, _ := c.Locals("userID").(int)
 
+	feedItems, err := a.FeedItems.Latest(userID, 20, 0)
 	if err != nil {
-		log.Printf("Failed to get feed items: %v", err)
+		requestLog(c).Error("Failed to get feed items", "err", err)
 	}
 
 	for i, f := range feedItems {
@@ -128,13 +113,11 @@ func IndexHandler(c *fiber.Ctx) error {
 	if userUsername != nil {
 		data["Username"] = userUsername
 	}
-	err = django.New("./views", ".html").Render(c, "index", data)
-	fmt.Println(err)
 	return c.Render("index", data)
 }
 
-func SignOutHandler(store *session.Store, c *fiber.Ctx) error {
-	sess, err := store.Get(c)
+func (a *App) SignOutHandler(c *fiber.Ctx) error {
+	sess, err := a.Store.Get(c)
 	if err == nil {
 		sess.Delete("user_id")
 		sess.Delete("user_email")
@@ -144,7 +127,7 @@ func SignOutHandler(store *session.Store, c *fiber.Ctx) error {
 	return c.Redirect("/")
 }
 
-func SignInHandler(c *fiber.Ctx, store *session.Store) error {
+func (a *App) SignInHandler(c *fiber.Ctx) error {
 	var (
 		email    = c.FormValue("email")
 		password = c.FormValue("password")
@@ -157,9 +140,9 @@ func SignInHandler(c *fiber.Ctx, store *session.Store) error {
 			},
 		})
 	}
-	user, err := database.GetUserByEmail(email)
+	user, err := a.Users.ByEmail(email)
 	if err != nil {
-		log.Printf("Login failed for email %s: %v", email, err)
+		requestLog(c).Info("Sign-in failed for unknown email", "err", err)
 		return c.Status(401).JSON(fiber.Map{
 			"toast": fiber.Map{
 				"type":    "error",
@@ -167,9 +150,9 @@ func SignInHandler(c *fiber.Ctx, store *session.Store) error {
 			},
 		})
 	}
-	err = database.VerifyPassword(user.Password, password)
+	err = passwords.Verify(user.Password, password)
 	if err != nil {
-		log.Printf("Invalid password attempt for user %s", email)
+		requestLog(c).Info("Sign-in failed with wrong password", "user_id", user.ID)
 		return c.Status(401).JSON(fiber.Map{
 			"toast": fiber.Map{
 				"type":    "error",
@@ -178,7 +161,18 @@ func SignInHandler(c *fiber.Ctx, store *session.Store) error {
 		})
 	}
 
-	sess, err := store.Get(c)
+	twoFactor, err := a.TwoFactorAuth.Enabled(user.ID)
+	if err != nil {
+		requestLog(c).Error("Failed to check two-factor status", "user_id", user.ID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"toast": fiber.Map{
+				"type":    "error",
+				"message": "Failed to sign in",
+			},
+		})
+	}
+
+	sess, err := a.Store.Get(c)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"toast": fiber.Map{
@@ -187,6 +181,29 @@ func SignInHandler(c *fiber.Ctx, store *session.Store) error {
 			},
 		})
 	}
+	if twoFactor {
+		// Not signed in until the code checks out on /signin/2fa
+		sess.Delete("user_id")
+		sess.Delete("user_email")
+		sess.Delete("user_username")
+		sess.Set("pending_user_id", user.ID)
+		sess.Set("pending_since", time.Now().Unix())
+		if err := sess.Save(); err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"toast": fiber.Map{
+					"type":    "error",
+					"message": "Failed to save session",
+				},
+			})
+		}
+		return c.JSON(fiber.Map{
+			"success":    true,
+			"two_factor": true,
+			"redirect":   "/signin/2fa",
+		})
+	}
+	sess.Delete("pending_user_id")
+	sess.Delete("pending_since")
 	sess.Set("user_id", user.ID)
 	sess.Set("user_email", user.Email)
 	sess.Set("user_username", user.Username)
@@ -204,7 +221,8 @@ func SignInHandler(c *fiber.Ctx, store *session.Store) error {
 	})
 }
 
-func GraphHandler(c *fiber.Ctx) error {
+// Returns the user's categories and their items as nodes and links for the graph view
+func (a *App) GraphHandler(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -212,120 +230,79 @@ func GraphHandler(c *fiber.Ctx) error {
 		})
 	}
 
-	log.Printf("Graph API called for user %d", userID)
-
-	db := database.GetDB()
-	categoryRows, err := db.Query(database.CategoryQuery, userID)
+	categories, err := a.Categories.List(userID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to get categories",
 		})
 	}
-	defer categoryRows.Close()
 
-	var nodes []fiber.Map
-	var links []fiber.Map
-	categoryMap := make(map[int]string)
-
-	nodes = append(nodes, fiber.Map{
+	nodes := []fiber.Map{{
 		"id":   "root",
 		"name": "Categories",
 		"type": "root",
-	})
-
-	for categoryRows.Next() {
-		var catID int
-		var catName string
-		err := categoryRows.Scan(&catID, &catName)
-		if err != nil {
-			continue
-		}
+	}}
+	var links []fiber.Map
 
+	for _, category := range categories {
+		categoryNode := fmt.Sprintf("cat_%d", category.ID)
 		nodes = append(nodes, fiber.Map{
-			"id":   fmt.Sprintf("cat_%d", catID),
-			"name": catName,
+			"id":   categoryNode,
+			"name": category.Name,
 			"type": "category",
 		})
-		categoryMap[catID] = catName
-
 		links = append(links, fiber.Map{
 			"source": "root",
-			"target": fmt.Sprintf("cat_%d", catID),
+			"target": categoryNode,
 		})
 
-		postRows, err := database.GraphFeedQuery(db, userID, catID)
+		items, err := a.FeedItems.ForCategory(userID, category.ID, 50)
 		if err != nil {
-			log.Printf("Error querying posts for category %d: %v", catID, err)
+			requestLog(c).Error("Failed to get category items", "category_id", category.ID, "err", err)
 			continue
 		}
 
-		postCount := 0
-		for postRows.Next() {
-			var postID string
-			var postTitle string
-			err := postRows.Scan(&postID, &postTitle)
-			if err != nil {
-				log.Printf("Error scanning post row: %v", err)
-				continue
-			}
-			postCount++
-
+		for _, item := range items {
 			nodes = append(nodes, fiber.Map{
-				"id":   fmt.Sprintf("post_%s", postID),
-				"name": postTitle,
+				"id":   fmt.Sprintf("post_%s", item.ID),
+				"name": item.Title,
 				"type": "post",
 			})
-
 			links = append(links, fiber.Map{
-				"source": fmt.Sprintf("cat_%d", catID),
-				"target": fmt.Sprintf("post_%s", postID),
+				"source": categoryNode,
+				"target": fmt.Sprintf("post_%s", item.ID),
 			})
 		}
-		postRows.Close()
-		log.Printf("Category %d (%s): %d posts", catID, catName, postCount)
 	}
 
-	log.Printf("Graph API returning %d nodes, %d links", len(nodes), len(links))
-
 	return c.JSON(fiber.Map{
 		"nodes": nodes,
 		"links": links,
 	})
 }
 
-func PostItemHandler(c *fiber.Ctx) error {
+func (a *App) PostItemHandler(c *fiber.Ctx) error {
 	itemID := c.Params("itemId")
 	userEmail := c.Locals("userEmail")
 	userUsername := c.Locals("userUsername")
 	userID := c.Locals("userID")
 
-	db := database.GetDB()
-	var post feeds.FeedItem
-	var sourceName string
-
-	err := db.QueryRow(database.PostFeedQuery, itemID).Scan(
-		&post.ID, &post.SourceID, &post.Title, &post.URL, &post.Description,
-		&post.Author, &post.PublishedAt, &post.Score, &post.CommentsCount,
-		&post.CreatedAt, &sourceName,
-	)
-
+	post, err := a.FeedItems.ByID(itemID)
 	if err != nil {
-		postObj, postErr := database.GetPostByID(db, itemID)
+		postObj, postErr := a.Posts.ByID(itemID)
 		if postErr != nil {
 			return c.Status(404).SendString("Post not found")
 		}
 
-		var subverse models.Subverse
-		subverseErr := db.QueryRow(database.SubverseQuery, postObj.SubverseID).Scan(
-			&subverse.ID, &subverse.Name, &subverse.CreatedAt)
+		subverse, subverseErr := a.Subverses.ByID(postObj.SubverseID)
 		if subverseErr != nil {
 			return c.Status(500).SendString("Failed to get subverse information")
 		}
 
-		comments, commentErr := database.GetCommentsByItemID(itemID)
+		comments, commentErr := a.Comments.ForItem(itemID)
 		if commentErr != nil {
-			log.Printf("Failed to get comments: %v", commentErr)
-			comments = []database.Comment{}
+			requestLog(c).Error("Failed to get comments", "item_id", itemID, "err", commentErr)
+			comments = []models.Comment{}
 		}
 
 		data := fiber.Map{
@@ -348,23 +325,10 @@ func PostItemHandler(c *fiber.Ctx) error {
 		return c.Render("subverse-post", data)
 	}
 
-	post.SourceName = sourceName
-
-	comments, err := database.GetCommentsByItemID(itemID)
-	fmt.Println(comments)
-	log.Printf("=== POST PAGE DEBUG: Retrieved %d comments for item %s ===", len(comments), itemID)
-	for i, comment := range comments {
-		log.Printf("=== POST PAGE DEBUG: Comment %d: ID=%d, Content='%s', ParentID=%v, Replies=%d ===",
-			i+1, comment.ID, comment.Content, comment.ParentID, len(comment.Replies))
-		for j, reply := range comment.Replies {
-			log.Printf("=== POST PAGE DEBUG:   Reply %d.%d: ID=%d, Content='%s' ===",
-				i+1, j+1, reply.ID, reply.Content)
-		}
-	}
-
+	comments, err := a.Comments.ForItem(itemID)
 	if err != nil {
-		log.Printf("Failed to get comments: %v", err)
-		comments = []database.Comment{}
+		requestLog(c).Error("Failed to get comments", "item_id", itemID, "err", err)
+		comments = []models.Comment{}
 	}
 
 	data := fiber.Map{
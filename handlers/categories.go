@@ -1,28 +1,27 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
-	"github.com/navid-m/versed/database"
 	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/repository"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 // Returns all categories for the authenticated user
-func GetUserCategories(c *fiber.Ctx) error {
+func (a *App) GetUserCategories(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
 			"error": "Unauthorized",
 		})
 	}
-	db := database.GetDB()
 
-	categories, err := database.GetUserCategories(db, userID)
+	categories, err := a.Categories.List(userID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to get user categories",
@@ -36,14 +35,13 @@ func GetUserCategories(c *fiber.Ctx) error {
 }
 
 // Creates a new category for the authenticated user
-func CreateUserCategory(c *fiber.Ctx) error {
+func (a *App) CreateUserCategory(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
 			"error": "Unauthorized",
 		})
 	}
-	db := database.GetDB()
 
 	var req struct {
 		Name        string `json:"name"`
@@ -63,7 +61,7 @@ func CreateUserCategory(c *fiber.Ctx) error {
 		})
 	}
 
-	category, err := database.CreateUserCategory(db, userID, req.Name, req.Description)
+	category, err := a.Categories.Create(userID, req.Name, req.Description)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create category",
@@ -74,7 +72,7 @@ func CreateUserCategory(c *fiber.Ctx) error {
 }
 
 // Updates an existing category
-func UpdateUserCategory(c *fiber.Ctx) error {
+func (a *App) UpdateUserCategory(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -82,7 +80,6 @@ func UpdateUserCategory(c *fiber.Ctx) error {
 		})
 	}
 	categoryIDStr := c.Params("id")
-	db := database.GetDB()
 
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil {
@@ -109,7 +106,7 @@ func UpdateUserCategory(c *fiber.Ctx) error {
 		})
 	}
 
-	err = database.UpdateUserCategory(db, userID, categoryID, req.Name, req.Description)
+	err = a.Categories.Update(userID, categoryID, req.Name, req.Description)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to update category",
@@ -122,7 +119,7 @@ func UpdateUserCategory(c *fiber.Ctx) error {
 }
 
 // Deletes a category and all its feed associations
-func DeleteUserCategory(c *fiber.Ctx) error {
+func (a *App) DeleteUserCategory(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -130,7 +127,6 @@ func DeleteUserCategory(c *fiber.Ctx) error {
 		})
 	}
 	categoryIDStr := c.Params("id")
-	db := database.GetDB()
 
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil {
@@ -139,7 +135,7 @@ func DeleteUserCategory(c *fiber.Ctx) error {
 		})
 	}
 
-	err = database.DeleteUserCategory(db, userID, categoryID)
+	err = a.Categories.Delete(userID, categoryID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to delete category",
@@ -152,7 +148,7 @@ func DeleteUserCategory(c *fiber.Ctx) error {
 }
 
 // Returns all feeds in a specific category
-func GetCategoryFeeds(c *fiber.Ctx) error {
+func (a *App) GetCategoryFeeds(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -160,7 +156,6 @@ func GetCategoryFeeds(c *fiber.Ctx) error {
 		})
 	}
 	categoryIDStr := c.Params("id")
-	db := database.GetDB()
 
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil {
@@ -169,14 +164,14 @@ func GetCategoryFeeds(c *fiber.Ctx) error {
 		})
 	}
 
-	_, err = database.GetUserCategoryByID(db, userID, categoryID)
+	_, err = a.Categories.ByID(userID, categoryID)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Category not found",
 		})
 	}
 
-	feeds, err := database.GetFeedsInUserCategory(db, userID, categoryID)
+	feeds, err := a.Categories.Feeds(userID, categoryID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to get category feeds",
@@ -190,7 +185,7 @@ func GetCategoryFeeds(c *fiber.Ctx) error {
 }
 
 // Returns feed items from all feeds in a specific category
-func GetCategoryFeedItems(c *fiber.Ctx) error {
+func (a *App) GetCategoryFeedItems(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -198,7 +193,6 @@ func GetCategoryFeedItems(c *fiber.Ctx) error {
 		})
 	}
 	categoryIDStr := c.Params("id")
-	db := database.GetDB()
 
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil {
@@ -207,41 +201,19 @@ func GetCategoryFeedItems(c *fiber.Ctx) error {
 		})
 	}
 
-	_, err = database.GetUserCategoryByID(db, userID, categoryID)
+	_, err = a.Categories.ByID(userID, categoryID)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Category not found",
 		})
 	}
-	sql, args, err := database.BuildFiQuery(userID, categoryID, c)
-	if err != nil {
-		return err
-	}
 
-	rows, err := db.Query(sql, args...)
+	items, err := a.FeedItems.ForCategory(userID, categoryID, 50)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to get category feed items",
 		})
 	}
-	defer rows.Close()
-
-	var items []feeds.FeedItem
-	for rows.Next() {
-		var item feeds.FeedItem
-		var sourceName string
-		var publishedAt time.Time
-		var createdAt time.Time
-		err := rows.Scan(&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
-			&item.Author, &publishedAt, &item.Score, &item.CommentsCount, &createdAt, &sourceName)
-		if err != nil {
-			continue
-		}
-		item.PublishedAt = &publishedAt
-		item.CreatedAt = &createdAt
-		item.SourceName = sourceName
-		items = append(items, item)
-	}
 
 	return c.JSON(fiber.Map{
 		"items": items,
@@ -250,12 +222,7 @@ func GetCategoryFeedItems(c *fiber.Ctx) error {
 }
 
 // Adds a feed source to a user's category
-func AddFeedToCategory(c *fiber.Ctx) error {
-	fmt.Printf("=== AddFeedToCategory handler called ===\n")
-	fmt.Printf("Method: %s, Path: %s\n", c.Method(), c.Path())
-	fmt.Printf("Params: %v\n", c.AllParams())
-	fmt.Printf("Body: %s\n", string(c.Body()))
-
+func (a *App) AddFeedToCategory(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -263,16 +230,10 @@ func AddFeedToCategory(c *fiber.Ctx) error {
 		})
 	}
 
-	var (
-		categoryIDStr = c.Params("id")
-		db            = database.GetDB()
-	)
-
-	fmt.Printf("UserID: %d, CategoryIDStr: %s\n", userID, categoryIDStr)
+	categoryIDStr := c.Params("id")
 
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil {
-		fmt.Printf("Invalid category ID: %v\n", err)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid category ID",
 		})
@@ -283,37 +244,65 @@ func AddFeedToCategory(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		fmt.Printf("Body parsing error: %v\n", err)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	fmt.Printf("Parsed request: FeedSourceID=%d\n", req.FeedSourceID)
-
 	if req.FeedSourceID <= 0 {
-		fmt.Printf("Validation failed: FeedSourceID=%d is invalid\n", req.FeedSourceID)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Valid feed source ID is required",
 		})
 	}
 
-	err = database.AddFeedToUserCategory(db, userID, categoryID, req.FeedSourceID)
+	if owned, err := a.mayAddSource(userID, req.FeedSourceID); err != nil {
+		requestLog(c).Error("Failed to check feed source", "user_id", userID, "source_id", req.FeedSourceID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to add feed to category",
+		})
+	} else if !owned {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Feed source not found",
+		})
+	}
+
+	err = a.Categories.AddFeed(userID, categoryID, req.FeedSourceID)
 	if err != nil {
-		fmt.Printf("Failed to add feed to category: %v\n", err)
+		requestLog(c).Error("Failed to add feed to category", "user_id", userID, "category_id", categoryID, "source_id", req.FeedSourceID, "err", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to add feed to category",
 		})
 	}
 
-	fmt.Printf("=== Successfully added feed to category ===\n")
 	return c.JSON(fiber.Map{
 		"message": "Feed added to category successfully",
 	})
 }
 
+// Reports whether a user may add a feed source to their categories: any
+// source but someone else's newsletters
+func (a *App) mayAddSource(userID, sourceID int) (bool, error) {
+	source, err := a.Sources.ByID(sourceID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil || !source.IsNewsletter() {
+		return err == nil, err
+	}
+	addrs, err := a.Newsletters.Addresses(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, addr := range addrs {
+		if addr.FeedSourceID == sourceID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // Removes a feed source from a user's category
-func RemoveFeedFromCategory(c *fiber.Ctx) error {
+func (a *App) RemoveFeedFromCategory(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -322,7 +311,6 @@ func RemoveFeedFromCategory(c *fiber.Ctx) error {
 	}
 	categoryIDStr := c.Params("categoryId")
 	feedSourceIDStr := c.Params("feedId")
-	db := database.GetDB()
 
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil {
@@ -338,7 +326,7 @@ func RemoveFeedFromCategory(c *fiber.Ctx) error {
 		})
 	}
 
-	err = database.RemoveFeedFromUserCategory(db, userID, categoryID, feedSourceID)
+	err = a.Categories.RemoveFeed(userID, categoryID, feedSourceID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to remove feed from category",
@@ -351,14 +339,7 @@ func RemoveFeedFromCategory(c *fiber.Ctx) error {
 }
 
 // Creates a new feed source and adds it to a category
-func CreateAndAddFeedToCategory(c *fiber.Ctx) error {
-	fmt.Printf("=== CreateAndAddFeedToCategory handler called ===\n")
-	fmt.Printf("Method: %s, Path: %s\n", c.Method(), c.Path())
-	fmt.Printf("Params: %v\n", c.AllParams())
-	fmt.Printf("Headers: %v\n", c.GetReqHeaders())
-	rawBody := string(c.Body())
-	fmt.Printf("Raw Body: %s\n", rawBody)
-
+func (a *App) CreateAndAddFeedToCategory(c *fiber.Ctx) error {
 	userID, ok := c.Locals("userID").(int)
 	if !ok {
 		return c.Status(401).JSON(fiber.Map{
@@ -367,13 +348,9 @@ func CreateAndAddFeedToCategory(c *fiber.Ctx) error {
 	}
 
 	categoryIDStr := c.Params("id")
-	db := database.GetDB()
-
-	fmt.Printf("UserID: %d, CategoryIDStr: %s\n", userID, categoryIDStr)
 
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil {
-		fmt.Printf("Invalid category ID: %v\n", err)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid category ID",
 		})
@@ -386,88 +363,191 @@ func CreateAndAddFeedToCategory(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		fmt.Printf("Body parsing error: %v\n", err)
-		fmt.Printf("Failed to parse body: %s\n", rawBody)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	fmt.Printf("Parsed request: type='%s', url='%s', name='%s'\n", req.Type, req.URL, req.Name)
-
 	req.URL = strings.TrimSpace(req.URL)
 	req.Name = strings.TrimSpace(req.Name)
 
-	fmt.Printf("After trimming: type='%s', url='%s', name='%s'\n", req.Type, req.URL, req.Name)
-
 	if req.URL == "" || req.Name == "" {
-		fmt.Printf("Validation failed: URL='%s', Name='%s'\n", req.URL, req.Name)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "URL and name are required",
 		})
 	}
 
 	if req.Type == "" {
-		fmt.Printf("Validation failed: Type='%s'\n", req.Type)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Feed type is required",
 		})
 	}
 
+	if strings.HasPrefix(req.URL, feeds.NewsletterURLPrefix) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid feed URL",
+		})
+	}
+
 	var source *feeds.FeedSource
 	if req.Type == "reddit" {
 		if !strings.Contains(req.URL, "reddit.com/r/") {
-			fmt.Printf("Reddit validation failed: URL='%s' doesn't contain 'reddit.com/r/'\n", req.URL)
 			return c.Status(400).JSON(fiber.Map{
 				"error": "Invalid Reddit URL format",
 			})
 		}
-		source, err = feeds.CreateOrUpdateFeedSource(db, req.Name, req.URL)
+		source, err = a.Sources.CreateOrUpdate(req.Name, req.URL)
 	} else {
-		source, err = feeds.CreateOrUpdateFeedSource(db, req.Name, req.URL)
+		source, err = a.Sources.CreateOrUpdate(req.Name, req.URL)
 	}
 
 	if err != nil {
-		fmt.Printf("Failed to create feed source: %v\n", err)
+		requestLog(c).Error("Failed to create feed source", "user_id", userID, "url", req.URL, "err", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create feed source",
 		})
 	}
 
-	err = database.AddFeedToUserCategory(db, userID, categoryID, source.ID)
+	err = a.Categories.AddFeed(userID, categoryID, source.ID)
 	if err != nil {
-		fmt.Printf("Failed to add feed to category: %v\n", err)
+		requestLog(c).Error("Failed to add feed to category", "user_id", userID, "category_id", categoryID, "source_id", source.ID, "err", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to add feed to category",
 		})
 	}
 
-	fmt.Printf("Processing new feed: %s\n", source.URL)
-	content, fetchErr := feeds.FetchFeed(source.URL)
+	logger := requestLog(c).With("source", source.Name, "source_id", source.ID)
+	var (
+		content  []byte
+		fetchErr error
+	)
+	if source.Disabled {
+		fetchErr = fmt.Errorf("feed source is disabled")
+	} else {
+		content, fetchErr = feeds.FetchFeed(c.UserContext(), source.URL)
+	}
 	if fetchErr != nil {
-		fmt.Printf("Failed to fetch feed %s: %v\n", source.URL, fetchErr)
+		logger.Warn("Failed to fetch new feed", "url", source.URL, "err", fetchErr)
 	} else {
 		parsedItems, parseErr := feeds.ParseFeedWithParser(content, source.ID, source.Name)
 		if parseErr != nil {
-			fmt.Printf("Failed to parse feed %s: %v\n", source.URL, parseErr)
+			logger.Warn("Failed to parse new feed", "err", parseErr)
 		} else {
-			fmt.Printf("Parsed %d items from new feed %s\n", len(parsedItems), source.Name)
-			saveErr := feeds.SaveFeedItems(db, parsedItems)
+			saveErr := a.FeedItems.Save(parsedItems)
 			if saveErr != nil {
-				fmt.Printf("Failed to save feed items for %s: %v\n", source.Name, saveErr)
+				logger.Error("Failed to save feed items", "err", saveErr)
 			} else {
-				fmt.Printf("Successfully saved %d items for new feed %s\n", len(parsedItems), source.Name)
-				updateErr := feeds.UpdateFeedSourceTimestamp(db, source.ID)
+				logger.Debug("Saved new feed's items", "items", len(parsedItems))
+				updateErr := a.Sources.MarkUpdated(source.ID)
 				if updateErr != nil {
-					fmt.Printf("Failed to update timestamp for %s: %v\n", source.Name, updateErr)
+					logger.Error("Failed to update feed source timestamp", "err", updateErr)
 				}
 			}
 		}
 	}
 
-	fmt.Printf("=== Successfully added feed to category ===\n")
 	return c.Status(201).JSON(fiber.Map{
 		"feed_source": source,
 		"message":     "Feed created and added to category successfully",
 	})
 }
+
+// Renders the items in one of the signed-in user's categories.
+//
+// If the category has feeds but no items yet, the feeds are fetched right
+// away so that the next visit has something to show.
+func (a *App) CategoryPage(c *fiber.Ctx) error {
+	username := c.Params("username")
+	userEmail := c.Locals("userEmail")
+	userUsername := c.Locals("userUsername")
+	userID, ok := c.Locals("userID").(int)
+	if userEmail == nil || !ok {
+		return c.Redirect("/signin")
+	}
+
+	categoryName := strings.TrimSpace(c.Params("categoryName"))
+	categoryName = strings.ReplaceAll(categoryName, "-", " ")
+
+	category, err := a.Categories.ByName(userID, categoryName)
+	if err != nil {
+		requestLog(c).Debug("Category not found", "user_id", userID, "err", err)
+		return c.Status(404).SendString("Category not found")
+	}
+
+	sources, err := a.Categories.Feeds(userID, category.ID)
+	if err != nil {
+		requestLog(c).Error("Failed to get category feeds", "user_id", userID, "category_id", category.ID, "err", err)
+	}
+
+	items, err := a.FeedItems.ForCategory(userID, category.ID, 50)
+	if err != nil {
+		requestLog(c).Error("Failed to get category feed items", "user_id", userID, "category_id", category.ID, "err", err)
+	}
+
+	if len(sources) > 0 && len(items) == 0 {
+		a.refreshCategoryFeeds(c, userID, category.ID, sources)
+	}
+
+	for i, item := range items {
+		if strings.TrimSpace(item.Description) == "" {
+			items[i].Description = "No description."
+		}
+		if strings.TrimSpace(item.Description) == "Comments" {
+			items[i].Description = "No description."
+		}
+	}
+
+	data := fiber.Map{
+		"FeedItems":    items,
+		"CategoryName": categoryName,
+		"Username":     username,
+	}
+
+	data["Email"] = userEmail
+	if userUsername != nil {
+		data["Username"] = userUsername
+	}
+
+	return c.Render("index", data)
+}
+
+// Fetches and saves the feeds of a category that has no items yet
+func (a *App) refreshCategoryFeeds(c *fiber.Ctx, userID, categoryID int, sources []feeds.FeedSource) {
+	logger := requestLog(c).With("user_id", userID, "category_id", categoryID)
+	reset, err := a.Sources.ResetForCategory(userID, categoryID)
+	if err != nil {
+		logger.Error("Failed to reset feed timestamps", "err", err)
+		return
+	}
+	if reset == 0 {
+		return
+	}
+
+	for _, source := range sources {
+		if source.Disabled {
+			continue
+		}
+		content, err := feeds.FetchFeed(c.UserContext(), source.URL)
+		if err != nil {
+			logger.Warn("Failed to fetch feed", "source_id", source.ID, "url", source.URL, "err", err)
+			continue
+		}
+
+		parsedItems, err := feeds.ParseFeedWithParser(content, source.ID, source.Name)
+		if err != nil {
+			logger.Warn("Failed to parse feed", "source_id", source.ID, "err", err)
+			continue
+		}
+		if len(parsedItems) == 0 {
+			continue
+		}
+
+		if err := a.FeedItems.Save(parsedItems); err != nil {
+			logger.Error("Failed to save feed items", "source_id", source.ID, "err", err)
+			continue
+		}
+		if err := a.Sources.MarkUpdated(source.ID); err != nil {
+			logger.Error("Failed to update feed source timestamp", "source_id", source.ID, "err", err)
+		}
+	}
+}
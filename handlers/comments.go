@@ -2,17 +2,14 @@ package handlers
 
 import (
 	"fmt"
-	"log"
 	"regexp"
 	"strconv"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/navid-m/versed/database"
-	"github.com/navid-m/versed/feeds"
 )
 
 // Retrieves all comments for a specific feed item
-func GetComments(c *fiber.Ctx) error {
+func (a *App) GetComments(c *fiber.Ctx) error {
 	itemID := c.Params("itemId")
 
 	if itemID == "" {
@@ -21,7 +18,7 @@ func GetComments(c *fiber.Ctx) error {
 		})
 	}
 
-	comments, err := database.GetCommentsByItemID(itemID)
+	comments, err := a.Comments.ForItem(itemID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to get comments",
@@ -35,7 +32,7 @@ func GetComments(c *fiber.Ctx) error {
 }
 
 // Adds a new comment to a feed item
-func CreateComment(c *fiber.Ctx) error {
+func (a *App) CreateComment(c *fiber.Ctx) error {
 	userIDLocal := c.Locals("userID")
 	if userIDLocal == nil {
 		return c.Status(401).JSON(fiber.Map{
@@ -77,16 +74,12 @@ func CreateComment(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		log.Printf("=== CreateComment ERROR parsing request body: %v ===", err)
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	log.Printf("=== CreateComment parsed request: Content='%s', ParentIDStr='%s' ===", req.Content, req.ParentIDStr)
-
 	if req.Content == "" {
-		log.Printf("=== CreateComment ERROR: Content is empty ===")
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Comment content is required",
 		})
@@ -95,14 +88,13 @@ func CreateComment(c *fiber.Ctx) error {
 	urlPattern := `(https?:\/\/)?([\w-]+\.)+[\w-]+(\/[\w- .\/?%&=]*)?`
 	regex, err := regexp.Compile(urlPattern)
 	if err != nil {
-		log.Printf("=== CreateComment ERROR compiling URL regex: %v ===", err)
+		requestLog(c).Error("Failed to compile URL pattern", "err", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Internal server error",
 		})
 	}
 
 	if regex.MatchString(req.Content) {
-		log.Printf("=== CreateComment ERROR: Comment contains URL ===")
 		return c.Status(400).JSON(fiber.Map{
 			"error": "Links are not allowed in comments",
 		})
@@ -111,24 +103,20 @@ func CreateComment(c *fiber.Ctx) error {
 	var parentID *int
 	if req.ParentIDStr != "" {
 		if parsedID, err := strconv.Atoi(req.ParentIDStr); err != nil {
-			log.Printf("=== CreateComment ERROR parsing parent_id '%s': %v ===", req.ParentIDStr, err)
 			return c.Status(400).JSON(fiber.Map{
 				"error": "Invalid parent_id format",
 			})
 		} else {
 			parentID = &parsedID
-			log.Printf("=== CreateComment parsed parent_id: %d ===", *parentID)
 			if req.Content != "" {
 				req.Content = fmt.Sprintf("@%d %s", *parentID, req.Content)
-				log.Printf("=== CreateComment added @mention: '%s' ===", req.Content)
 			}
 		}
 	}
 
-	log.Printf("=== CreateComment calling database with parentID: %v ===", parentID)
-
-	comment, err := database.CreateComment(itemID, userID, username, req.Content, parentID)
+	comment, err := a.Comments.Create(itemID, userID, username, req.Content, parentID)
 	if err != nil {
+		requestLog(c).Error("Failed to create comment", "user_id", userID, "item_id", itemID, "err", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to create comment",
 		})
@@ -138,7 +126,7 @@ func CreateComment(c *fiber.Ctx) error {
 }
 
 // Updates an existing comment
-func UpdateComment(c *fiber.Ctx) error {
+func (a *App) UpdateComment(c *fiber.Ctx) error {
 	userIDLocal := c.Locals("userID")
 	if userIDLocal == nil {
 		return c.Status(401).JSON(fiber.Map{
@@ -184,7 +172,7 @@ func UpdateComment(c *fiber.Ctx) error {
 		})
 	}
 
-	comment, err := database.GetCommentByID(commentID)
+	comment, err := a.Comments.ByID(commentID)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Comment not found",
@@ -197,14 +185,14 @@ func UpdateComment(c *fiber.Ctx) error {
 		})
 	}
 
-	err = database.UpdateComment(commentID, req.Content)
+	err = a.Comments.Update(commentID, req.Content)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to update comment",
 		})
 	}
 
-	updatedComment, err := database.GetCommentByID(commentID)
+	updatedComment, err := a.Comments.ByID(commentID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to retrieve updated comment",
@@ -215,7 +203,7 @@ func UpdateComment(c *fiber.Ctx) error {
 }
 
 // Removes a comment
-func DeleteComment(c *fiber.Ctx) error {
+func (a *App) DeleteComment(c *fiber.Ctx) error {
 	userIDLocal := c.Locals("userID")
 	if userIDLocal == nil {
 		return c.Status(401).JSON(fiber.Map{
@@ -245,7 +233,7 @@ func DeleteComment(c *fiber.Ctx) error {
 		})
 	}
 
-	comment, err := database.GetCommentByID(commentID)
+	comment, err := a.Comments.ByID(commentID)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Comment not found",
@@ -258,7 +246,7 @@ func DeleteComment(c *fiber.Ctx) error {
 		})
 	}
 
-	err = database.DeleteComment(commentID)
+	err = a.Comments.Delete(commentID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to delete comment",
@@ -271,7 +259,7 @@ func DeleteComment(c *fiber.Ctx) error {
 }
 
 // Retrieves a single comment by its ID
-func GetComment(c *fiber.Ctx) error {
+func (a *App) GetComment(c *fiber.Ctx) error {
 	commentIDStr := c.Params("commentId")
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
@@ -280,7 +268,7 @@ func GetComment(c *fiber.Ctx) error {
 		})
 	}
 
-	comment, err := database.GetCommentByID(commentID)
+	comment, err := a.Comments.ByID(commentID)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Comment not found",
@@ -291,7 +279,7 @@ func GetComment(c *fiber.Ctx) error {
 }
 
 // Retrieves a single post with its comments for viewing
-func GetPostView(c *fiber.Ctx) error {
+func (a *App) GetPostView(c *fiber.Ctx) error {
 	itemID := c.Params("itemId")
 	if itemID == "" {
 		return c.Status(400).JSON(fiber.Map{
@@ -299,32 +287,14 @@ func GetPostView(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-	var item feeds.FeedItem
-	var sourceName string
-
-	query := `
-		SELECT fi.id, fi.source_id, fi.title, fi.url, fi.description, fi.author,
-			   fi.published_at, fi.score, fi.comments_count, fi.created_at, fs.name as source_name
-		FROM feed_items fi
-		JOIN feed_sources fs ON fi.source_id = fs.id
-		WHERE fi.id = ?`
-
-	err := db.QueryRow(query, itemID).Scan(
-		&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
-		&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount,
-		&item.CreatedAt, &sourceName,
-	)
-
+	item, err := a.FeedItems.ByID(itemID)
 	if err != nil {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Post not found",
 		})
 	}
 
-	item.SourceName = sourceName
-
-	comments, err := database.GetCommentsByItemID(itemID)
+	comments, err := a.Comments.ForItem(itemID)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to get comments",
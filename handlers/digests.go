@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/navid-m/versed/digest"
+)
+
+// Returns the authenticated user's digest settings
+func (a *App) GetDigestSettings(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	sub, err := a.Digests.Subscription(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get digest subscription", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get digest settings",
+		})
+	}
+
+	return c.JSON(sub)
+}
+
+// Sets how often the authenticated user receives digests
+func (a *App) UpdateDigestSettings(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req struct {
+		Frequency string `json:"frequency"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	frequency := strings.ToLower(strings.TrimSpace(req.Frequency))
+	if err := a.Digests.SetFrequency(userID, frequency); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Frequency must be one of off, daily or weekly",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message":   "Digest settings updated successfully",
+		"frequency": frequency,
+	})
+}
+
+// Sends the authenticated user a digest immediately
+func (a *App) SendTestDigest(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	err := a.DigestSender.SendTest(userID, time.Now())
+	switch {
+	case errors.Is(err, digest.ErrTestRateLimited):
+		requestLog(c).Warn("Test digest rate limited", "user_id", userID)
+		return c.Status(429).JSON(fiber.Map{
+			"error": "Too many test digests, please try again later",
+		})
+	case errors.Is(err, digest.ErrUnavailable):
+		return c.Status(503).JSON(fiber.Map{
+			"error": "Email digests are not available on this server",
+		})
+	case err != nil:
+		requestLog(c).Error("Failed to send test digest", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to send test digest",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Test digest sent",
+	})
+}
+
+// Asks to confirm turning off digests from an unsubscribe link. Nothing
+// changes until the form is posted, so link scanners that follow the link
+// do not unsubscribe anyone.
+func (a *App) UnsubscribeDigestPage(c *fiber.Ctx) error {
+	data := fiber.Map{"Token": c.Params("token")}
+	if userEmail := c.Locals("userEmail"); userEmail != nil {
+		data["Email"] = userEmail
+	}
+	if userUsername := c.Locals("userUsername"); userUsername != nil {
+		data["Username"] = userUsername
+	}
+	return c.Render("digest-unsubscribe", data)
+}
+
+// Turns off digests from the unsubscribe page or a one-click unsubscribe
+// request sent by a mail client; no sign in is required
+func (a *App) UnsubscribeDigest(c *fiber.Ctx) error {
+	unsubscribed, err := a.Digests.Unsubscribe(c.Params("token"))
+	if err != nil {
+		requestLog(c).Error("Failed to unsubscribe from digest", "err", err)
+		return c.Status(500).SendString("Failed to unsubscribe")
+	}
+	if !unsubscribed {
+		return c.Status(404).SendString("Unsubscribe link is invalid")
+	}
+
+	// Mail clients post List-Unsubscribe=One-Click and show no page
+	if c.FormValue("List-Unsubscribe") == "One-Click" {
+		return c.SendStatus(200)
+	}
+
+	data := fiber.Map{}
+	if userEmail := c.Locals("userEmail"); userEmail != nil {
+		data["Email"] = userEmail
+	}
+	if userUsername := c.Locals("userUsername"); userUsername != nil {
+		data["Username"] = userUsername
+	}
+	return c.Render("digest-unsubscribed", data)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/navid-m/versed/exports"
+	"github.com/navid-m/versed/models"
+)
+
+// A data export along with a fresh download link when it is ready
+type dataExportResponse struct {
+	models.DataExport
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// Queues an export of the authenticated user's data
+func (a *App) RequestDataExport(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	export, err := a.Exports.Request(userID)
+	if errors.Is(err, exports.ErrInProgress) {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "An export is already being prepared",
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to request data export", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to request data export",
+		})
+	}
+
+	return c.Status(202).JSON(export)
+}
+
+// Returns the authenticated user's data exports, newest first
+func (a *App) GetDataExports(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	list, err := a.Exports.List(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get data exports", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get data exports",
+		})
+	}
+
+	now := time.Now()
+	results := make([]dataExportResponse, 0, len(list))
+	for _, export := range list {
+		result := dataExportResponse{DataExport: export}
+		if export.Status == models.ExportReady {
+			result.DownloadURL = a.Exports.DownloadURL(export, now)
+		}
+		results = append(results, result)
+	}
+
+	return c.JSON(fiber.Map{
+		"exports": results,
+		"count":   len(results),
+	})
+}
+
+// Sends an export's archive to anyone holding a valid signed link
+func (a *App) DownloadDataExport(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Export not found",
+		})
+	}
+
+	export, err := a.Exports.Get(id)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Export not found",
+		})
+	}
+
+	now := time.Now()
+	if err := a.Exports.Verify(*export, c.Query("expires"), c.Query("signature"), now); err != nil {
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Download link is invalid or has expired",
+		})
+	}
+	if export.Status != models.ExportReady {
+		return c.Status(410).JSON(fiber.Map{
+			"error": "This export is no longer available",
+		})
+	}
+
+	filename := fmt.Sprintf("versed-export-%s.zip", export.CreatedAt.UTC().Format("2006-01-02"))
+	return c.Download(a.Exports.Path(export.ID), filename)
+}
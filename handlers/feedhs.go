@@ -2,21 +2,20 @@ package handlers
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/navid-m/versed/database"
-	"github.com/navid-m/versed/feeds"
 )
 
-func FeedSourceHandler(c *fiber.Ctx) error {
+func (a *App) FeedSourceHandler(c *fiber.Ctx) error {
 	sourceName := c.Params("source")
 	limit := min(c.QueryInt("limit", 30), 100)
-	source, err := feeds.GetFeedSourceByName(database.GetDB(), sourceName)
-	if err != nil {
+	source, err := a.Sources.ByName(sourceName)
+	// Newsletters are private to the user they were sent to
+	if err != nil || source.IsNewsletter() {
 		return c.Status(404).JSON(fiber.Map{
 			"error": "Feed source not found",
 		})
 	}
 
-	items, err := feeds.GetFeedItemsBySource(database.GetDB(), source.ID, limit)
+	items, err := a.FeedItems.BySource(source.ID, limit)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to retrieve feed items",
@@ -30,21 +29,13 @@ func FeedSourceHandler(c *fiber.Ctx) error {
 	})
 }
 
-func FeedsHandler(c *fiber.Ctx) error {
-	userID := c.Locals("userID")
+func (a *App) FeedsHandler(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(int)
 	page := c.QueryInt("page", 1)
 	limit := min(c.QueryInt("limit", 20), 50)
 	offset := (page - 1) * limit
 
-	var items []feeds.FeedItem
-	var err error
-
-	if userID != nil {
-		items, err = feeds.GetAllFeedItemsWithPaginationForUser(database.GetDB(), userID.(int), limit, offset)
-	} else {
-		items, err = feeds.GetAllFeedItemsWithPagination(database.GetDB(), limit, offset)
-	}
-
+	items, err := a.FeedItems.Latest(userID, limit, offset)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to retrieve feed items",
@@ -0,0 +1,1274 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/gofiber/template/django/v3"
+	"github.com/valyala/fasthttp"
+
+	"github.com/navid-m/versed/accounts"
+	"github.com/navid-m/versed/digest"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/mailer/mailertest"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/newsletters"
+	"github.com/navid-m/versed/passwords"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/repository/repositorytest"
+	"github.com/navid-m/versed/totp"
+)
+
+// Builds an app on in-memory repositories; a non-zero userID is treated as signed in
+func newTestApp(t *testing.T, userID int) (*fiber.App, repository.Repositories) {
+	t.Helper()
+	return newTestAppWith(t, userID, nil)
+}
+
+// Like newTestApp, but lets configure change the App before its routes are
+// registered
+func newTestAppWith(t *testing.T, userID int, configure func(*App)) (*fiber.App, repository.Repositories) {
+	t.Helper()
+	repos := repositorytest.New()
+	a := &App{
+		Repositories: repos,
+		Store:        session.New(session.Config{Storage: repos.Sessions}),
+		// Without a mail server addresses are trusted as they are
+		Verifier:      accounts.NewVerifier(repos.Users, nil, mailer.New(mailer.Config{}), accounts.Config{}),
+		TwoFactorAuth: accounts.NewTwoFactor(repos.TwoFactor, repos.Users, "Versed"),
+		Tokens:        accounts.NewTokens(repos.APITokens, repos.Users),
+	}
+	if configure != nil {
+		configure(a)
+	}
+	// Built last so it picks up a replaced verifier or repositories
+	if a.Settings == nil {
+		a.Settings = accounts.NewSettings(a.Users, a.Sessions, a.APITokens, a.Verifier)
+	}
+
+	app := fiber.New(fiber.Config{Views: testViews(t)})
+	if userID != 0 {
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals("userID", userID)
+			c.Locals("userEmail", "reader@example.com")
+			c.Locals("userUsername", "reader")
+			return c.Next()
+		})
+	}
+	a.Register(app)
+	return app, repos
+}
+
+// The page templates, loaded once for every test app
+var loadViews = sync.OnceValues(func() (*django.Engine, error) {
+	engine := django.New("../views", ".html")
+	return engine, engine.Load()
+})
+
+func testViews(t *testing.T) *django.Engine {
+	t.Helper()
+	engine, err := loadViews()
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	return engine
+}
+
+func do(t *testing.T, app *fiber.App, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = strings.NewReader(string(raw))
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	var out map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("%s %s: decoding response: %v", method, path, err)
+	}
+	return resp.StatusCode, out
+}
+
+func seedItem(t *testing.T, repos repository.Repositories, id, title string) *feeds.FeedSource {
+	t.Helper()
+	source, err := repos.Sources.CreateOrUpdate("Example", "https://example.com/feed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := time.Now()
+	err = repos.FeedItems.Save([]feeds.FeedItem{{
+		ID:          id,
+		SourceID:    source.ID,
+		Title:       title,
+		URL:         "https://example.com/" + id,
+		PublishedAt: &published,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestRequiresSignIn(t *testing.T) {
+	app, _ := newTestApp(t, 0)
+
+	for _, path := range []string{"/api/categories", "/api/reading-list", "/api/graph", "/api/posts/hidden", "/api/saved-searches"} {
+		status, body := do(t, app, http.MethodGet, path, nil)
+		if status != http.StatusUnauthorized || body["error"] != "Unauthorized" {
+			t.Errorf("GET %s = %d %v, want 401 Unauthorized", path, status, body)
+		}
+	}
+}
+
+func TestCategories(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	source := seedItem(t, repos, "item-1", "Hello")
+
+	status, created := do(t, app, http.MethodPost, "/api/categories", fiber.Map{"name": " Tech "})
+	if status != http.StatusCreated || created["name"] != "Tech" {
+		t.Fatalf("create = %d %v", status, created)
+	}
+	categoryID := int(created["id"].(float64))
+
+	status, _ = do(t, app, http.MethodPost, fmt.Sprintf("/api/categories/%d/feeds", categoryID), fiber.Map{"feed_source_id": source.ID})
+	if status != http.StatusOK {
+		t.Fatalf("add feed = %d", status)
+	}
+
+	_, list := do(t, app, http.MethodGet, "/api/categories", nil)
+	if list["count"] != 1.0 {
+		t.Errorf("categories = %v, want 1", list)
+	}
+
+	_, items := do(t, app, http.MethodGet, fmt.Sprintf("/api/categories/%d/items", categoryID), nil)
+	if items["count"] != 1.0 {
+		t.Errorf("category items = %v, want 1", items)
+	}
+
+	_, graph := do(t, app, http.MethodGet, "/api/graph", nil)
+	if nodes := graph["nodes"].([]any); len(nodes) != 3 {
+		t.Errorf("graph nodes = %v, want root, category and item", nodes)
+	}
+
+	status, _ = do(t, app, http.MethodGet, "/api/categories/999/feeds", nil)
+	if status != http.StatusNotFound {
+		t.Errorf("feeds of a missing category = %d, want 404", status)
+	}
+
+	status, _ = do(t, app, http.MethodDelete, fmt.Sprintf("/api/categories/%d", categoryID), nil)
+	if status != http.StatusOK {
+		t.Errorf("delete = %d", status)
+	}
+	_, list = do(t, app, http.MethodGet, "/api/categories", nil)
+	if list["count"] != 0.0 {
+		t.Errorf("categories after delete = %v, want none", list)
+	}
+}
+
+func TestReadingListAndHiding(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	seedItem(t, repos, "item-1", "Hello")
+
+	_, saved := do(t, app, http.MethodPost, "/api/reading-list/save", fiber.Map{"item_id": "item-1"})
+	if saved["saved"] != true {
+		t.Errorf("first save = %v", saved)
+	}
+	_, saved = do(t, app, http.MethodPost, "/api/reading-list/save", fiber.Map{"item_id": "item-1"})
+	if saved["saved"] != false {
+		t.Errorf("second save = %v, want saved=false", saved)
+	}
+
+	_, list := do(t, app, http.MethodGet, "/api/reading-list", nil)
+	if list["count"] != 1.0 {
+		t.Errorf("reading list = %v", list)
+	}
+
+	do(t, app, http.MethodPost, "/api/posts/item-1/hide", nil)
+	_, feed := do(t, app, http.MethodGet, "/api/feeds", nil)
+	if feed["count"] != 0.0 {
+		t.Errorf("feed after hiding = %v, want no items", feed)
+	}
+	_, hidden := do(t, app, http.MethodGet, "/api/posts/hidden", nil)
+	if hidden["count"] != 1.0 {
+		t.Errorf("hidden = %v", hidden)
+	}
+
+	do(t, app, http.MethodPost, "/api/posts/item-1/unhide", nil)
+	_, feed = do(t, app, http.MethodGet, "/api/feeds", nil)
+	if feed["count"] != 1.0 {
+		t.Errorf("feed after unhiding = %v, want the item back", feed)
+	}
+}
+
+func TestVote(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	seedItem(t, repos, "item-1", "Hello")
+
+	for _, step := range []struct {
+		vote string
+		want float64
+	}{
+		{"upvote", 1},
+		{"downvote", -1},
+		{"downvote", 0},
+	} {
+		_, body := do(t, app, http.MethodPost, "/api/vote", fiber.Map{"feed_id": "item-1", "vote_type": step.vote})
+		if body["new_score"] != step.want {
+			t.Errorf("%s: new_score = %v, want %v", step.vote, body["new_score"], step.want)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	seedItem(t, repos, "item-1", "Hello")
+
+	status, parent := do(t, app, http.MethodPost, "/api/posts/item-1/comments", fiber.Map{"content": "First"})
+	if status != http.StatusCreated {
+		t.Fatalf("create = %d %v", status, parent)
+	}
+	parentID := int(parent["id"].(float64))
+	do(t, app, http.MethodPost, "/api/posts/item-1/comments", fiber.Map{"content": "Reply", "parent_id": fmt.Sprint(parentID)})
+
+	status, _ = do(t, app, http.MethodPost, "/api/posts/item-1/comments", fiber.Map{"content": "see example.com"})
+	if status != http.StatusBadRequest {
+		t.Errorf("comment with a link = %d, want 400", status)
+	}
+
+	_, view := do(t, app, http.MethodGet, "/api/posts/item-1", nil)
+	comments := view["comments"].([]any)
+	if len(comments) != 1 {
+		t.Fatalf("top-level comments = %v, want 1", comments)
+	}
+	replies := comments[0].(map[string]any)["replies"].([]any)
+	if len(replies) != 1 || !strings.HasSuffix(replies[0].(map[string]any)["content"].(string), "Reply") {
+		t.Errorf("replies = %v", replies)
+	}
+
+	status, _ = do(t, app, http.MethodDelete, fmt.Sprintf("/api/comments/%d", parentID), nil)
+	if status != http.StatusOK {
+		t.Errorf("delete own comment = %d", status)
+	}
+	status, _ = do(t, app, http.MethodGet, fmt.Sprintf("/api/comments/%d", parentID), nil)
+	if status != http.StatusNotFound {
+		t.Errorf("deleted comment = %d, want 404", status)
+	}
+}
+
+func TestRequestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	if err := logging.Setup(&buf, logging.Config{Level: "info", Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { logging.Setup(os.Stderr, logging.Config{Level: "info", Format: "text"}) })
+
+	app, repos := newTestApp(t, 1)
+	seedItem(t, repos, "item-1", "Hello")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/posts/item-1/comments?q=private", strings.NewReader(`{"content":"my private thoughts"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	id := resp.Header.Get("X-Request-ID")
+	if id == "" {
+		t.Fatal("response has no X-Request-ID")
+	}
+
+	if strings.Contains(buf.String(), "private") {
+		t.Errorf("log holds the comment or query string:\n%s", buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("want one JSON log line, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{
+		"subsystem":  "http",
+		"request_id": id,
+		"method":     "POST",
+		"path":       "/api/posts/item-1/comments",
+		"status":     float64(http.StatusCreated),
+		"user_id":    1.0,
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+}
+
+func TestAdminAndBans(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	if err := repos.Users.Create("reader@example.com", "reader", "secret", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/users", nil)
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("admin route for a regular user = %d, want 403", resp.StatusCode)
+	}
+
+	_, status := do(t, app, http.MethodGet, "/api/user/status", nil)
+	if status["isAdmin"] != false {
+		t.Errorf("user status = %v", status)
+	}
+
+	// app.Test requests come from 0.0.0.0
+	if err := repos.Bans.Ban("0.0.0.0", "spam", 1); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/api/feeds", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("request from a banned IP = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	app, repos := newTestApp(t, 0)
+	seedItem(t, repos, "item-1", "Go generics")
+	seedItem(t, repos, "item-2", "Go errors")
+	seedItem(t, repos, "item-3", "Rust traits")
+
+	_, first := do(t, app, http.MethodGet, "/api/search?q=go&limit=1", nil)
+	_, second := do(t, app, http.MethodGet, "/api/search?q=go&limit=1&offset=1", nil)
+	if first["count"] != 1.0 || second["count"] != 1.0 {
+		t.Fatalf("pages = %v, %v; want one item each", first, second)
+	}
+	if first["items"].([]any)[0].(map[string]any)["id"] == second["items"].([]any)[0].(map[string]any)["id"] {
+		t.Errorf("both pages returned the same item")
+	}
+
+	_, filtered := do(t, app, http.MethodGet, "/api/search?q=go+-errors+source:example+domain:example.com", nil)
+	if filtered["count"] != 1.0 || filtered["items"].([]any)[0].(map[string]any)["id"] != "item-1" {
+		t.Errorf("filtered search = %v", filtered)
+	}
+
+	status, bad := do(t, app, http.MethodGet, "/api/search?q=go+score:lots", nil)
+	if status != http.StatusBadRequest || bad["offset"] != 9.0 {
+		t.Errorf("malformed query = %d %v, want 400 at offset 9", status, bad)
+	}
+
+	_, empty := do(t, app, http.MethodGet, "/api/search?q=%20", nil)
+	if empty["count"] != 0.0 {
+		t.Errorf("blank query = %v", empty)
+	}
+
+	if _, err := repos.Comments.Create("item-3", 1, "reader", "Traits beat interfaces", nil); err != nil {
+		t.Fatal(err)
+	}
+	_, comments := do(t, app, http.MethodGet, "/api/search/comments?q=interfaces", nil)
+	if comments["count"] != 1.0 {
+		t.Errorf("comment search = %v", comments)
+	}
+}
+
+func TestSearchAll(t *testing.T) {
+	app, repos := newTestApp(t, 0)
+	seedItem(t, repos, "item-1", "Go generics")
+	seedItem(t, repos, "item-2", "Go errors")
+	subverse, err := repos.Subverses.Create("golang")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repos.Posts.Create(subverse.ID, 1, "reader", "Go modules", "How?", "text", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	status, all := do(t, app, http.MethodGet, "/api/search/all?q=go", nil)
+	results, _ := all["results"].(map[string]any)
+	if status != http.StatusOK || all["limit"] != 5.0 || len(results["items"].([]any)) != 2 || len(results["posts"].([]any)) != 1 {
+		t.Fatalf("search = %d %v", status, all)
+	}
+	types := results["facets"].(map[string]any)["types"].(map[string]any)
+	if types["items"] != 2.0 || types["posts"] != 1.0 {
+		t.Errorf("type facets = %v", types)
+	}
+
+	_, narrowed := do(t, app, http.MethodGet, "/api/search/all?q=go&type=items&limit=1", nil)
+	results = narrowed["results"].(map[string]any)
+	if len(results["items"].([]any)) != 1 || results["posts"] != nil {
+		t.Errorf("narrowed search = %v", narrowed)
+	}
+
+	if status, _ := do(t, app, http.MethodGet, "/api/search/all?q=go&type=everything", nil); status != http.StatusBadRequest {
+		t.Errorf("unknown type = %d, want 400", status)
+	}
+	if status, bad := do(t, app, http.MethodGet, "/api/search/all?q=go+score:lots", nil); status != http.StatusBadRequest || bad["offset"] != 9.0 {
+		t.Errorf("malformed query = %d %v, want 400 at offset 9", status, bad)
+	}
+}
+
+func TestSavedSearches(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	if err := repos.Users.Create("reader@example.com", "reader", "secret", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, created := do(t, app, http.MethodPost, "/api/saved-searches", fiber.Map{"name": " Rust ", "query": "rust -crypto"})
+	if status != http.StatusCreated || created["name"] != "Rust" || created["unseen"] != 0.0 {
+		t.Fatalf("create = %d %v", status, created)
+	}
+	id := int(created["id"].(float64))
+
+	status, bad := do(t, app, http.MethodPost, "/api/saved-searches", fiber.Map{"name": "Bad", "query": "go score:lots"})
+	if status != http.StatusBadRequest || bad["offset"] != 9.0 {
+		t.Errorf("malformed query = %d %v, want 400 at offset 9", status, bad)
+	}
+	status, _ = do(t, app, http.MethodPost, "/api/saved-searches", fiber.Map{"name": "Empty", "query": " - "})
+	if status != http.StatusBadRequest {
+		t.Errorf("empty query = %d, want 400", status)
+	}
+	status, _ = do(t, app, http.MethodPost, "/api/saved-searches", fiber.Map{"name": "rust", "query": "rust"})
+	if status != http.StatusConflict {
+		t.Errorf("duplicate name = %d, want 409", status)
+	}
+
+	_, userStatus := do(t, app, http.MethodGet, "/api/user/status", nil)
+	searches, _ := userStatus["savedSearches"].([]any)
+	if len(searches) != 1 || userStatus["unseenMatches"] != 0.0 {
+		t.Errorf("user status = %v, want one saved search and no unseen matches", userStatus)
+	}
+
+	status, _ = do(t, app, http.MethodPut, fmt.Sprintf("/api/saved-searches/%d", id), fiber.Map{"name": "Rust news", "query": "rust"})
+	if status != http.StatusOK {
+		t.Errorf("update = %d", status)
+	}
+	status, _ = do(t, app, http.MethodPost, fmt.Sprintf("/api/saved-searches/%d/seen", id), nil)
+	if status != http.StatusOK {
+		t.Errorf("mark seen = %d", status)
+	}
+	_, list := do(t, app, http.MethodGet, "/api/saved-searches", nil)
+	if list["count"] != 1.0 || list["searches"].([]any)[0].(map[string]any)["name"] != "Rust news" {
+		t.Errorf("saved searches = %v", list)
+	}
+
+	status, _ = do(t, app, http.MethodDelete, fmt.Sprintf("/api/saved-searches/%d", id), nil)
+	if status != http.StatusOK {
+		t.Errorf("delete = %d", status)
+	}
+	status, _ = do(t, app, http.MethodPost, fmt.Sprintf("/api/saved-searches/%d/seen", id), nil)
+	if status != http.StatusNotFound {
+		t.Errorf("mark seen after delete = %d, want 404", status)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	repos := repositorytest.New()
+	if err := repos.Users.Create("reader@example.com", "reader", "hash", "127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := repos.Users.ByEmail("reader@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allow, err := metrics.ParseAllowList([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &App{
+		Repositories:  repos,
+		Store:         session.New(session.Config{Storage: repos.Sessions}),
+		MetricsAccess: metrics.Access{Token: "scrape-token", Allow: allow},
+	}
+
+	var signedIn int
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if signedIn != 0 {
+			c.Locals("userID", signedIn)
+		}
+		return c.Next()
+	})
+	a.Register(app)
+
+	scrape := func(authorization string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, string(body)
+	}
+
+	if status, _ := scrape(""); status != http.StatusUnauthorized {
+		t.Errorf("anonymous scrape: status %d, want 401", status)
+	}
+	if status, _ := scrape("Bearer wrong"); status != http.StatusUnauthorized {
+		t.Errorf("scrape with the wrong token: status %d, want 401", status)
+	}
+	signedIn = reader.ID
+	if status, _ := scrape(""); status != http.StatusForbidden {
+		t.Errorf("scrape by a non-admin: status %d, want 403", status)
+	}
+	signedIn = 0
+
+	do(t, app, http.MethodGet, "/api/posts/missing/comments", nil)
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/no/such/page", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	status, body := scrape("Bearer scrape-token")
+	if status != http.StatusOK {
+		t.Fatalf("scrape with the token: status %d, want 200", status)
+	}
+	for _, want := range []string{
+		`versed_http_requests_total{method="GET",route="/api/posts/:itemId/comments",status=`,
+		`versed_http_requests_total{method="GET",route="/metrics",status="401"} 2`,
+		`versed_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		"# TYPE versed_http_request_duration_seconds histogram",
+		"# TYPE versed_workers_busy gauge",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+
+	// app.Test requests come from 0.0.0.0
+	a.MetricsAccess.Allow, _ = metrics.ParseAllowList([]string{"0.0.0.0"})
+	if status, _ := scrape(""); status != http.StatusOK {
+		t.Errorf("scrape from an allowed address: status %d, want 200", status)
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	repos := repositorytest.New()
+	var schedulerErr error
+	a := &App{
+		Repositories: repos,
+		Store:        session.New(session.Config{Storage: repos.Sessions}),
+		ReadinessChecks: []ReadinessCheck{
+			{Name: "database", Check: func(context.Context) error { return nil }},
+			{Name: "scheduler", Check: func(context.Context) error { return schedulerErr }},
+		},
+	}
+	app := fiber.New()
+	a.Register(app)
+
+	if status, body := do(t, app, http.MethodGet, "/healthz", nil); status != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("GET /healthz = %d %v", status, body)
+	}
+
+	status, body := do(t, app, http.MethodGet, "/readyz", nil)
+	if status != http.StatusOK || body["status"] != "ok" {
+		t.Fatalf("GET /readyz = %d %v, want 200 ok", status, body)
+	}
+	checks, _ := body["checks"].(map[string]any)
+	for _, name := range []string{"database", "scheduler"} {
+		check, _ := checks[name].(map[string]any)
+		if check["status"] != "ok" {
+			t.Errorf("%s check = %v, want ok", name, check)
+		}
+		if _, ok := check["latency_ms"].(float64); !ok {
+			t.Errorf("%s check has no latency: %v", name, check)
+		}
+	}
+
+	schedulerErr = fmt.Errorf("no feed update cycle has finished yet")
+	status, body = do(t, app, http.MethodGet, "/readyz", nil)
+	checks, _ = body["checks"].(map[string]any)
+	if status != http.StatusServiceUnavailable || body["status"] != "fail" {
+		t.Errorf("GET /readyz with a failing check = %d %v, want 503 fail", status, body)
+	}
+	if check, _ := checks["scheduler"].(map[string]any); check["status"] != "fail" {
+		t.Errorf("scheduler check = %v, want fail", check)
+	}
+
+	schedulerErr = nil
+	a.Drain()
+	if status, body := do(t, app, http.MethodGet, "/readyz", nil); status != http.StatusServiceUnavailable || body["status"] != "draining" {
+		t.Errorf("GET /readyz while draining = %d %v, want 503 draining", status, body)
+	}
+	if status, _ := do(t, app, http.MethodGet, "/healthz", nil); status != http.StatusOK {
+		t.Errorf("GET /healthz while draining = %d, want 200", status)
+	}
+}
+
+func TestInboundBodyLimit(t *testing.T) {
+	app, _ := newTestAppWith(t, 0, func(a *App) {
+		a.Inbound = newsletters.NewService(nil, nil, newsletters.Config{Secret: "inbound-secret"})
+	})
+	// The server turns away a body over its limit before any handler runs,
+	// which app.Test reports as fasthttp.ErrBodyTooLarge
+	post := func(path string, size int) (int, error) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(strings.Repeat("x", size)))
+		req.Header.Set("Content-Type", "message/rfc822")
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	overDefault := fiber.DefaultBodyLimit + 1
+	if _, err := post("/signin", overDefault); !errors.Is(err, fasthttp.ErrBodyTooLarge) {
+		t.Errorf("POST /signin with %d bytes = %v, want ErrBodyTooLarge", overDefault, err)
+	}
+	// Read in full, so it gets as far as checking the secret
+	if status, err := post("/api/inbound/email?secret=wrong", overDefault); status != http.StatusUnauthorized {
+		t.Errorf("POST /api/inbound/email with %d bytes = %d, %v; want 401", overDefault, status, err)
+	}
+	overMessage := newsletters.MaxMessageSize + 2<<20
+	if _, err := post("/api/inbound/email?secret=wrong", overMessage); !errors.Is(err, fasthttp.ErrBodyTooLarge) {
+		t.Errorf("POST /api/inbound/email with %d bytes = %v, want ErrBodyTooLarge", overMessage, err)
+	}
+}
+
+func TestUpdateProfile(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	if err := repos.Users.Create("reader@example.com", "reader", "old-password", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Users.Create("taken@example.com", "taken", "their-password", ""); err != nil {
+		t.Fatal(err)
+	}
+	if user, err := repos.Users.ByID(1); err != nil || user.Username != "reader" {
+		t.Fatalf("want the reader to be user 1, got %v, %v", user, err)
+	}
+	for _, id := range []string{"this-device", "other-device"} {
+		var data bytes.Buffer
+		if err := gob.NewEncoder(&data).Encode(map[string]any{"user_id": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Sessions.Set(id, data.Bytes(), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repos.APITokens.Create(1, "Scripts", "token-hash", []string{"read"}); err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(form url.Values) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/profile/update", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session_id", Value: "this-device"})
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+	form := func(email, username, current, newPassword, confirm string) url.Values {
+		return url.Values{
+			"email":            {email},
+			"username":         {username},
+			"current_password": {current},
+			"new_password":     {newPassword},
+			"confirm_password": {confirm},
+		}
+	}
+
+	for _, tt := range []struct {
+		name   string
+		form   url.Values
+		status int
+		body   string
+	}{
+		{"wrong password", form("reader@example.com", "reader", "guess", "", ""), 401, "Invalid current password"},
+		{"hash as password", form("reader@example.com", "reader", mustPasswordHash(t, repos, 1), "", ""), 401, "Invalid current password"},
+		{"short password", form("reader@example.com", "reader", "old-password", "short", "short"), 400, "at least 8 characters"},
+		{"mismatch", form("reader@example.com", "reader", "old-password", "new-password", "new-passw0rd"), 400, "do not match"},
+		{"taken email", form("taken@example.com", "reader", "old-password", "", ""), 400, "already registered"},
+		{"taken username", form("reader@example.com", "taken", "old-password", "", ""), 400, "already taken"},
+		{"bad username", form("reader@example.com", "no spaces", "old-password", "", ""), 400, "letters, numbers"},
+	} {
+		resp, body := update(tt.form)
+		if resp.StatusCode != tt.status || !strings.Contains(body, tt.body) {
+			t.Errorf("%s: got %d %q, want %d containing %q", tt.name, resp.StatusCode, body, tt.status, tt.body)
+		}
+	}
+
+	// Changing only the username keeps the password and every session
+	resp, _ := update(form("reader@example.com", "reader_2", "old-password", "", ""))
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("username change: status %d, want a redirect", resp.StatusCode)
+	}
+	user, _ := repos.Users.ByID(1)
+	if user.Username != "reader_2" || passwords.Verify(user.Password, "old-password") != nil {
+		t.Errorf("after a username change the user is %+v", user)
+	}
+	if data, _ := repos.Sessions.Get("other-device"); data == nil {
+		t.Error("a username change ended another session")
+	}
+	if tokens, _ := repos.APITokens.List(1); len(tokens) != 1 {
+		t.Error("a username change revoked an API token")
+	}
+
+	resp, _ = update(form("reader@example.com", "reader_2", "old-password", "new-password", "new-password"))
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("password change: status %d, want a redirect", resp.StatusCode)
+	}
+	user, _ = repos.Users.ByID(1)
+	if err := passwords.Verify(user.Password, "new-password"); err != nil {
+		t.Errorf("new password was not stored hashed: %v", err)
+	}
+	for _, id := range []string{"this-device", "other-device"} {
+		if data, _ := repos.Sessions.Get(id); data != nil {
+			t.Errorf("session %s survived the password change", id)
+		}
+	}
+	if tokens, _ := repos.APITokens.List(1); len(tokens) != 0 {
+		t.Errorf("API tokens %+v survived the password change", tokens)
+	}
+	var rotated string
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" {
+			rotated = cookie.Value
+		}
+	}
+	if rotated == "" || rotated == "this-device" {
+		t.Fatalf("session ID was not rotated, cookie = %q", rotated)
+	}
+	if data, _ := repos.Sessions.Get(rotated); data == nil {
+		t.Error("the rotated session was not saved")
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	engine := django.New("../views", ".html")
+	if err := engine.Load(); err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	server := mailertest.NewServer(t)
+	var verifier *accounts.Verifier
+	app, repos := newTestAppWith(t, 1, func(a *App) {
+		verifier = accounts.NewVerifier(a.Users, engine, mailer.New(server.Config()), accounts.Config{BaseURL: "https://versed.test"})
+		a.Verifier = verifier
+	})
+	if err := repos.Users.Create("reader@example.com", "reader", "old-password", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/api/vote", "/api/posts/item-1/comments", "/s/golang/posts", "/api/posts/post-1/vote", "/api/digest/test"} {
+		code, body := do(t, app, http.MethodPost, path, map[string]string{"itemId": "item-1", "voteType": "up", "content": "hi"})
+		if code != http.StatusForbidden || body["verification_required"] != true {
+			t.Errorf("POST %s while unverified = %d %v, want 403", path, code, body)
+		}
+	}
+	if _, status := do(t, app, http.MethodGet, "/api/user/status", nil); status["emailVerified"] != false {
+		t.Errorf("user status while unverified = %v", status)
+	}
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/api/admin/users/1/verify", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("admin verify by a regular user = %d, want 403", resp.StatusCode)
+	}
+
+	for i := 0; i < 3; i++ {
+		if code, body := do(t, app, http.MethodPost, "/api/account/verification", nil); code != http.StatusOK {
+			t.Fatalf("resend %d = %d %v", i+1, code, body)
+		}
+	}
+	if code, _ := do(t, app, http.MethodPost, "/api/account/verification", nil); code != http.StatusTooManyRequests {
+		t.Errorf("resend over the limit = %d, want 429", code)
+	}
+	verifier.Stop()
+	if messages := server.WaitFor(3, 5*time.Second); len(messages) != 3 || messages[0].To[0] != "reader@example.com" {
+		t.Errorf("got %d verification emails, want 3 to the reader", len(messages))
+	}
+
+	if err := repos.Users.ConfirmEmail(1, "reader@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := do(t, app, http.MethodPost, "/api/vote", map[string]string{"itemId": "item-1", "voteType": "up"}); code == http.StatusForbidden {
+		t.Error("vote still refused once verified")
+	}
+	if code, _ := do(t, app, http.MethodPost, "/api/account/verification", nil); code != http.StatusBadRequest {
+		t.Errorf("resend once verified = %d, want 400", code)
+	}
+
+	// A new address waits for its own verification
+	req := httptest.NewRequest(http.MethodPost, "/profile/update", strings.NewReader(url.Values{
+		"email":            {"new@example.com"},
+		"username":         {"reader"},
+		"current_password": {"old-password"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location := resp.Header.Get("Location"); !strings.Contains(location, "verify=1") {
+		t.Errorf("email change redirected to %q, want the profile asking to verify", location)
+	}
+	user, _ := repos.Users.ByID(1)
+	if user.Email != "reader@example.com" || user.PendingEmail != "new@example.com" {
+		t.Errorf("after an email change the user is %+v, want the new address pending", user)
+	}
+	verifier.Stop()
+	if messages := server.WaitFor(4, 5*time.Second); len(messages) != 4 || messages[3].To[0] != "new@example.com" {
+		t.Errorf("no verification email went to the new address")
+	}
+}
+
+func TestTwoFactor(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	if err := repos.Users.Create("reader@example.com", "reader", "password", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, _ := do(t, app, http.MethodPost, "/api/account/2fa/setup", map[string]string{"password": "guess"}); code != http.StatusForbidden {
+		t.Errorf("setup with the wrong password = %d, want 403", code)
+	}
+	code, setup := do(t, app, http.MethodPost, "/api/account/2fa/setup", map[string]string{"password": "password"})
+	secret, _ := setup["secret"].(string)
+	if code != http.StatusOK || secret == "" || !strings.HasPrefix(setup["uri"].(string), "otpauth://totp/") {
+		t.Fatalf("setup = %d %v", code, setup)
+	}
+	if code, _ := do(t, app, http.MethodPost, "/api/account/2fa/enable", map[string]string{"code": "12345"}); code != http.StatusBadRequest {
+		t.Errorf("enable with a wrong code = %d, want 400", code)
+	}
+	current, _ := totp.Code(secret, totp.Step(time.Now()))
+	code, enabled := do(t, app, http.MethodPost, "/api/account/2fa/enable", map[string]string{"code": current})
+	if codes, _ := enabled["recovery_codes"].([]any); code != http.StatusOK || len(codes) != accounts.RecoveryCodeCount {
+		t.Fatalf("enable = %d %v", code, enabled)
+	}
+	if _, status := do(t, app, http.MethodGet, "/api/account/2fa", nil); status["enabled"] != true {
+		t.Errorf("status once enabled = %v", status)
+	}
+
+	// Signing in with the password alone only gets as far as the code
+	signIn, repos := newTestApp(t, 0)
+	if err := repos.Users.Create("reader@example.com", "reader", "password", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.SetSecret(1, secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.TwoFactor.Enable(1, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/signin", strings.NewReader(url.Values{
+		"email":    {"reader@example.com"},
+		"password": {"password"},
+	}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := signIn.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body["two_factor"] != true || body["redirect"] != "/signin/2fa" {
+		t.Fatalf("sign-in with two-factor on = %v", body)
+	}
+	var pending *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" {
+			pending = cookie
+		}
+	}
+	if pending == nil {
+		t.Fatal("sign-in set no session cookie")
+	}
+	withCookie := func(req *http.Request, cookie *http.Cookie) *http.Response {
+		t.Helper()
+		req.AddCookie(cookie)
+		resp, err := signIn.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp = withCookie(httptest.NewRequest(http.MethodGet, "/api/user/status", nil), pending)
+	json.NewDecoder(resp.Body).Decode(&body)
+	if _, signedIn := body["emailVerified"]; signedIn {
+		t.Error("signed in before entering a code")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/signin/2fa", strings.NewReader(url.Values{"code": {current}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp = withCookie(req, pending)
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/" {
+		t.Fatalf("second step = %d to %q, want a redirect home", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	var session *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "session_id" {
+			session = cookie
+		}
+	}
+	if session == nil || session.Value == pending.Value {
+		t.Fatal("session ID was not rotated on sign-in")
+	}
+	resp = withCookie(httptest.NewRequest(http.MethodGet, "/api/user/status", nil), session)
+	json.NewDecoder(resp.Body).Decode(&body)
+	if _, signedIn := body["emailVerified"]; !signedIn {
+		t.Errorf("not signed in after entering the code: %v", body)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	if err := repos.Users.Create("reader@example.com", "reader", "password", ""); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := do(t, app, http.MethodPost, "/api/account/tokens", map[string]any{"name": "Scripts", "scopes": []string{"admin"}}); code != http.StatusBadRequest {
+		t.Errorf("admin token for a regular user = %d %v, want 400", code, body)
+	}
+	code, created := do(t, app, http.MethodPost, "/api/account/tokens", map[string]any{"name": "Scripts", "scopes": []string{"read"}})
+	if raw, _ := created["token"].(string); code != http.StatusCreated || !strings.HasPrefix(raw, accounts.TokenPrefix) {
+		t.Fatalf("create token = %d %v", code, created)
+	}
+	id := created["api_token"].(map[string]any)["id"]
+	if _, list := do(t, app, http.MethodGet, "/api/account/tokens", nil); len(list["tokens"].([]any)) != 1 {
+		t.Errorf("tokens = %v, want the new one", list)
+	}
+	if code, _ := do(t, app, http.MethodDelete, fmt.Sprintf("/api/account/tokens/%v", id), nil); code != http.StatusOK {
+		t.Errorf("revoke = %d", code)
+	}
+	if code, _ := do(t, app, http.MethodDelete, fmt.Sprintf("/api/account/tokens/%v", id), nil); code != http.StatusNotFound {
+		t.Errorf("revoking twice = %d, want 404", code)
+	}
+
+	// Scripts send the token instead of a session cookie
+	anonymous, repos := newTestApp(t, 0)
+	if err := repos.Users.Create("reader@example.com", "reader", "password", ""); err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := accounts.NewTokens(repos.APITokens, repos.Users).Create(1, "Scripts", []string{accounts.ScopeRead, accounts.ScopeCategories})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withToken := func(method, path, token string, body any) int {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := anonymous.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+	for _, tt := range []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/api/categories", token, http.StatusOK},
+		{http.MethodPost, "/api/categories", token, http.StatusCreated},
+		{http.MethodPost, "/api/vote", token, http.StatusForbidden},
+		{http.MethodGet, "/api/admin/users", token, http.StatusForbidden},
+		{http.MethodGet, "/api/account/tokens", token, http.StatusForbidden},
+		{http.MethodGet, "/API/ACCOUNT/tokens", token, http.StatusForbidden},
+		{http.MethodGet, "/api/Account/2fa", token, http.StatusForbidden},
+		{http.MethodGet, "/API/ADMIN/users", token, http.StatusForbidden},
+		{http.MethodPost, "/API/Vote", token, http.StatusForbidden},
+		{http.MethodPost, "/api/reading-list/save", token, http.StatusForbidden},
+		{http.MethodGet, "/api/categories", accounts.TokenPrefix + "guess", http.StatusUnauthorized},
+		// Left for handlers that take other bearer tokens, like /metrics
+		{http.MethodGet, "/api/categories", "scraper-token", http.StatusUnauthorized},
+	} {
+		if got := withToken(tt.method, tt.path, tt.token, map[string]string{"name": "Tech", "itemId": "item-1", "voteType": "up"}); got != tt.want {
+			t.Errorf("%s %s with token %.12q = %d, want %d", tt.method, tt.path, tt.token, got, tt.want)
+		}
+	}
+	categories, _ := repos.Categories.List(1)
+	if !slices.ContainsFunc(categories, func(c models.UserCategory) bool { return c.Name == "Tech" }) {
+		t.Errorf("category created with a token is missing: %+v", categories)
+	}
+}
+
+func mustPasswordHash(t *testing.T, repos repository.Repositories, userID int) string {
+	t.Helper()
+	user, err := repos.Users.ByID(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.Password
+}
+
+func TestWebhooks(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+
+	hook := fiber.Map{"name": "Go news", "url": "https://93.184.216.34/hook", "match_type": "Keyword", "match_value": "golang"}
+	status, created := do(t, app, http.MethodPost, "/api/webhooks", hook)
+	if status != http.StatusCreated || created["match_type"] != models.WebhookMatchKeyword || created["secret"] == "" || created["enabled"] != true {
+		t.Fatalf("create = %d %v", status, created)
+	}
+	id := int(created["id"].(float64))
+
+	for _, bad := range []fiber.Map{
+		{"name": "Local", "url": "http://127.0.0.1:8080/hook", "match_type": "keyword", "match_value": "golang"},
+		{"name": "Bad type", "url": "https://93.184.216.34/hook", "match_type": "author", "match_value": "golang"},
+		{"name": "No value", "url": "https://93.184.216.34/hook", "match_type": "keyword"},
+	} {
+		if status, body := do(t, app, http.MethodPost, "/api/webhooks", bad); status != http.StatusBadRequest {
+			t.Errorf("create %v = %d %v, want 400", bad, status, body)
+		}
+	}
+
+	status, list := do(t, app, http.MethodGet, "/api/webhooks", nil)
+	hooks, _ := list["webhooks"].([]any)
+	if status != http.StatusOK || len(hooks) != 1 || hooks[0].(map[string]any)["secret"] != nil {
+		t.Errorf("list = %d %v, want one webhook without its secret", status, list)
+	}
+
+	path := fmt.Sprintf("/api/webhooks/%d", id)
+	if status, body := do(t, app, http.MethodPut, path, fiber.Map{"enabled": false, "match_value": "rust"}); status != http.StatusOK {
+		t.Fatalf("update = %d %v", status, body)
+	}
+	if updated, err := repos.Webhooks.ByID(1, id); err != nil || updated.Enabled || updated.MatchValue != "rust" || updated.Name != "Go news" {
+		t.Errorf("after update = %+v, %v", updated, err)
+	}
+	if status, _ := do(t, app, http.MethodPut, path, fiber.Map{"url": "http://[::1]/hook"}); status != http.StatusBadRequest {
+		t.Errorf("update to a loopback URL = %d, want 400", status)
+	}
+
+	if status, body := do(t, app, http.MethodGet, path+"/deliveries", nil); status != http.StatusOK || body["count"] != float64(0) {
+		t.Errorf("deliveries = %d %v", status, body)
+	}
+
+	other, _ := newTestAppWith(t, 2, func(a *App) { a.Repositories = repos })
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		if status, _ := do(t, other, method, path, fiber.Map{"name": "Mine"}); status != http.StatusNotFound {
+			t.Errorf("%s of another user's webhook = %d, want 404", method, status)
+		}
+	}
+
+	if status, _ := do(t, app, http.MethodDelete, path, nil); status != http.StatusOK {
+		t.Errorf("delete = %d", status)
+	}
+	if status, _ := do(t, app, http.MethodGet, path+"/deliveries", nil); status != http.StatusNotFound {
+		t.Errorf("deliveries of a deleted webhook = %d, want 404", status)
+	}
+}
+
+func TestDigestSettings(t *testing.T) {
+	app, repos := newTestApp(t, 1)
+	if err := repos.Users.Create("reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, body := do(t, app, http.MethodGet, "/api/digest", nil); status != http.StatusOK || body["frequency"] != models.DigestOff {
+		t.Errorf("get = %d %v, want digests off", status, body)
+	}
+	if status, _ := do(t, app, http.MethodPut, "/api/digest", fiber.Map{"frequency": "hourly"}); status != http.StatusBadRequest {
+		t.Errorf("update to an unknown frequency = %d, want 400", status)
+	}
+	if status, body := do(t, app, http.MethodPut, "/api/digest", fiber.Map{"frequency": " Weekly "}); status != http.StatusOK || body["frequency"] != models.DigestWeekly {
+		t.Errorf("update = %d %v", status, body)
+	}
+
+	sub, err := repos.Digests.Subscription(1)
+	if err != nil || sub.Frequency != models.DigestWeekly {
+		t.Fatalf("subscription = %+v, %v", sub, err)
+	}
+	signedOut, _ := newTestAppWith(t, 0, func(a *App) { a.Repositories = repos })
+	path := "/digest/unsubscribe/" + sub.UnsubscribeToken
+	resp, err := signedOut.Test(httptest.NewRequest(http.MethodGet, path, nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unsubscribe page = %v, %v", resp, err)
+	}
+	if page, _ := io.ReadAll(resp.Body); !strings.Contains(string(page), `action="`+path+`"`) {
+		t.Errorf("unsubscribe page has no form posting to %s", path)
+	}
+	if sub, _ := repos.Digests.Subscription(1); sub.Frequency != models.DigestWeekly {
+		t.Errorf("frequency after opening the unsubscribe page = %q, want it unchanged", sub.Frequency)
+	}
+
+	resp, err = signedOut.Test(httptest.NewRequest(http.MethodPost, path, nil))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("unsubscribe = %v, %v", resp, err)
+	}
+	if page, _ := io.ReadAll(resp.Body); !strings.Contains(string(page), "You have been unsubscribed") {
+		t.Error("unsubscribing did not show the unsubscribed page")
+	}
+	if sub, _ := repos.Digests.Subscription(1); sub.Frequency != models.DigestOff {
+		t.Errorf("frequency after unsubscribing = %q, want off", sub.Frequency)
+	}
+
+	if status, _ := do(t, app, http.MethodPut, "/api/digest", fiber.Map{"frequency": models.DigestDaily}); status != http.StatusOK {
+		t.Fatalf("resubscribe = %d", status)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = signedOut.Test(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("one-click unsubscribe = %v, %v", resp, err)
+	}
+	if page, _ := io.ReadAll(resp.Body); strings.Contains(string(page), "<html") {
+		t.Error("one-click unsubscribe rendered a page")
+	}
+	if sub, _ := repos.Digests.Subscription(1); sub.Frequency != models.DigestOff {
+		t.Errorf("frequency after one-click unsubscribe = %q, want off", sub.Frequency)
+	}
+	resp, err = signedOut.Test(httptest.NewRequest(http.MethodPost, "/digest/unsubscribe/not-a-token", nil))
+	if err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unsubscribe with an unknown token = %v, %v", resp, err)
+	}
+}
+
+func TestSendTestDigestWithoutMailer(t *testing.T) {
+	app, repos := newTestAppWith(t, 1, func(a *App) {
+		a.DigestSender = digest.NewService(nil, nil, mailer.New(mailer.Config{}), "")
+	})
+	if err := repos.Users.Create("reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, body := do(t, app, http.MethodPost, "/api/digest/test", nil); status != http.StatusServiceUnavailable || body["error"] == nil {
+		t.Errorf("test digest without a mail server = %d %v, want 503", status, body)
+	}
+}
+
+func TestNewsletterAddresses(t *testing.T) {
+	app, repos := newTestAppWith(t, 1, func(a *App) {
+		a.Inbound = newsletters.NewService(nil, nil, newsletters.Config{Domain: "in.example.com"})
+	})
+
+	if status, _ := do(t, app, http.MethodPost, "/api/newsletters", fiber.Map{"name": "  "}); status != http.StatusBadRequest {
+		t.Errorf("create without a name = %d, want 400", status)
+	}
+	if status, _ := do(t, app, http.MethodPost, "/api/newsletters", fiber.Map{"name": "Weekly", "category_id": 99}); status != http.StatusNotFound {
+		t.Errorf("create into a missing category = %d, want 404", status)
+	}
+	category, err := repos.Categories.Create(1, "Reading", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, created := do(t, app, http.MethodPost, "/api/newsletters", fiber.Map{"name": "Weekly", "category_id": category.ID})
+	address, _ := created["address"].(string)
+	if status != http.StatusCreated || !strings.HasPrefix(address, "weekly.") || !strings.HasSuffix(address, "@in.example.com") {
+		t.Fatalf("create = %d %v", status, created)
+	}
+	if feeds, _ := repos.Categories.Feeds(1, category.ID); len(feeds) != 1 || feeds[0].ID != int(created["feed_source_id"].(float64)) {
+		t.Errorf("category feeds = %+v, want the newsletter's source", feeds)
+	}
+
+	status, list := do(t, app, http.MethodGet, "/api/newsletters", nil)
+	addrs, _ := list["newsletters"].([]any)
+	if status != http.StatusOK || len(addrs) != 1 || addrs[0].(map[string]any)["address"] != address {
+		t.Errorf("list = %d %v", status, list)
+	}
+
+	path := fmt.Sprintf("/api/newsletters/%d", int(created["id"].(float64)))
+	other, _ := newTestAppWith(t, 2, func(a *App) { a.Repositories = repos })
+	if status, _ := do(t, other, http.MethodDelete, path, nil); status != http.StatusNotFound {
+		t.Errorf("delete of another user's address = %d, want 404", status)
+	}
+	if status, _ := do(t, app, http.MethodDelete, path, nil); status != http.StatusOK {
+		t.Errorf("delete = %d", status)
+	}
+	if addrs, _ := repos.Newsletters.Addresses(1); len(addrs) != 0 {
+		t.Errorf("addresses after delete = %+v", addrs)
+	}
+}
+
+func TestNewsletterPrivacy(t *testing.T) {
+	owner, repos := newTestApp(t, 1)
+	other, _ := newTestAppWith(t, 2, func(a *App) { a.Repositories = repos })
+	anonymous, _ := newTestAppWith(t, 0, func(a *App) { a.Repositories = repos })
+
+	addr, err := repos.Newsletters.CreateAddress(1, "Weekly", "weekly.abcd1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := time.Now()
+	if err := repos.FeedItems.Save([]feeds.FeedItem{{ID: "letter", SourceID: addr.FeedSourceID, Title: "Private newsletter", URL: "/newsletters/items/letter", PublishedAt: &received}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Newsletters.SaveMessage(models.NewsletterMessage{ItemID: "letter", AddressID: addr.ID, UserID: 1, FromAddress: "editor@example.com", ReceivedAt: received}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		app  *fiber.App
+		want int
+	}{
+		{"owner", owner, http.StatusOK},
+		{"another user", other, http.StatusNotFound},
+		{"anonymous", anonymous, http.StatusFound},
+	} {
+		resp, err := tt.app.Test(httptest.NewRequest(http.MethodGet, "/newsletters/items/letter", nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.want || strings.Contains(string(body), "editor@example.com") != (tt.want == http.StatusOK) {
+			t.Errorf("newsletter page for the %s = %d %.80q, want %d", tt.name, resp.StatusCode, body, tt.want)
+		}
+	}
+
+	for _, path := range []string{"/api/feeds", "/api/search?q=private"} {
+		if status, body := do(t, other, http.MethodGet, path, nil); status != http.StatusOK || body["count"] != float64(0) {
+			t.Errorf("GET %s = %d %v, want no newsletters", path, status, body)
+		}
+	}
+	if status, _ := do(t, other, http.MethodGet, "/api/feeds/Weekly", nil); status != http.StatusNotFound {
+		t.Errorf("newsletter source by name = %d, want 404", status)
+	}
+
+	category, err := repos.Categories.Create(2, "Reading", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/api/categories/%d/feeds", category.ID)
+	if status, _ := do(t, other, http.MethodPost, path, fiber.Map{"feed_source_id": addr.FeedSourceID}); status != http.StatusNotFound {
+		t.Errorf("adding another user's newsletter to a category = %d, want 404", status)
+	}
+	if status, _ := do(t, other, http.MethodPost, path+"/create", fiber.Map{"name": "Mine now", "url": "newsletter:weekly.abcd1234"}); status != http.StatusBadRequest {
+		t.Errorf("creating a source with a newsletter URL = %d, want 400", status)
+	}
+	if feeds, _ := repos.Categories.Feeds(2, category.ID); len(feeds) != 0 {
+		t.Errorf("category feeds = %+v, want none", feeds)
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// How long the readiness checks may take between them
+const readinessTimeout = 5 * time.Second
+
+// A dependency /readyz checks before the server is sent traffic
+type ReadinessCheck struct {
+	Name string
+	// Returns an error when the dependency is not ready
+	Check func(ctx context.Context) error
+}
+
+// The outcome of one readiness check
+type checkResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+}
+
+// Makes /readyz fail from now on, ahead of a graceful shutdown
+func (a *App) Drain() {
+	a.draining.Store(true)
+}
+
+// Reports that the process is up without checking anything it depends on
+func (a *App) Healthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"status": "ok"})
+}
+
+// Runs every readiness check, answering 503 when one fails or the server is
+// draining. Failures are logged rather than returned, as the endpoint is
+// public.
+func (a *App) Readyz(c *fiber.Ctx) error {
+	if a.draining.Load() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "draining"})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), readinessTimeout)
+	defer cancel()
+
+	ready := true
+	checks := make(map[string]checkResult, len(a.ReadinessChecks))
+	for _, check := range a.ReadinessChecks {
+		started := time.Now()
+		err := check.Check(ctx)
+		result := checkResult{
+			Status:    "ok",
+			LatencyMS: float64(time.Since(started).Microseconds()) / 1000,
+		}
+		if err != nil {
+			ready = false
+			result.Status = "fail"
+			requestLog(c).Warn("Readiness check failed", "check", check.Name, "err", err)
+		}
+		checks[check.Name] = result
+	}
+
+	status := "ok"
+	if !ready {
+		status = "fail"
+		c.Status(fiber.StatusServiceUnavailable)
+	}
+	return c.JSON(fiber.Map{"status": status, "checks": checks})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/navid-m/versed/metrics"
+)
+
+var (
+	httpRequests = metrics.NewCounter("versed_http_requests_total",
+		"HTTP requests handled, by method, route and status.", "method", "route", "status")
+	httpDuration = metrics.NewHistogram("versed_http_request_duration_seconds",
+		"Time taken to handle HTTP requests, by method and route.", metrics.DefaultBuckets, "method", "route")
+)
+
+// Counts and times every request by the route that handled it. Routes are
+// labelled by their pattern, e.g. /api/posts/:itemId, to keep the number of
+// series down; requests no route matched are labelled "unmatched".
+func CountRequests(c *fiber.Ctx) error {
+	started := time.Now()
+	err := c.Next()
+
+	// When no route matches, the router answers with a not found error and
+	// c.Route() is whichever middleware ran last
+	route := c.Route().Path
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusNotFound {
+		route = "unmatched"
+	}
+	httpRequests.Inc(c.Method(), route, strconv.Itoa(responseStatus(c, err)))
+	httpDuration.ObserveSince(started, c.Method(), route)
+	return err
+}
+
+// Serves the metrics in the Prometheus text format to admins and to the
+// scrapers allowed by MetricsAccess
+func (a *App) Metrics(c *fiber.Ctx) error {
+	if !a.MetricsAccess.Allows(c.IP(), c.Get(fiber.HeaderAuthorization)) {
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).SendString("Unauthorized")
+		}
+		isAdmin, err := a.Users.IsAdmin(userID)
+		if err != nil {
+			requestLog(c).Error("Failed to check admin status", "user_id", userID, "err", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Internal server error")
+		}
+		if !isAdmin {
+			return c.Status(fiber.StatusForbidden).SendString("Forbidden")
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := metrics.WriteText(&buf); err != nil {
+		requestLog(c).Error("Failed to write metrics", "err", err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to write metrics")
+	}
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.Send(buf.Bytes())
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/gofiber/fiber/v2/utils"
+
+	"github.com/navid-m/versed/logging"
+)
+
+var logger = logging.For("http")
+
+// Gives every request an ID, taken from the X-Request-ID header when a proxy
+// has set one, and echoes it back in the response
+var RequestID = requestid.New(requestid.Config{
+	Generator:  utils.UUIDv4,
+	ContextKey: "requestID",
+})
+
+// Returns the logger for a request, which tags every record with its ID
+func requestLog(c *fiber.Ctx) *slog.Logger {
+	if id, ok := c.Locals("requestID").(string); ok {
+		return logger.With("request_id", id)
+	}
+	return logger
+}
+
+// Logs every request once it has been handled. Only the path is logged, as
+// query strings can hold search terms and tokens.
+func LogRequests(c *fiber.Ctx) error {
+	started := time.Now()
+	err := c.Next()
+	status := responseStatus(c, err)
+
+	level := slog.LevelInfo
+	switch {
+	case c.Path() == "/healthz" || c.Path() == "/readyz":
+		// Probed every few seconds; failed readiness checks log themselves
+		level = slog.LevelDebug
+	case status >= 500:
+		level = slog.LevelError
+	case strings.HasPrefix(c.Path(), "/static/"):
+		level = slog.LevelDebug
+	}
+	attrs := []any{
+		"method", c.Method(),
+		"path", c.Path(),
+		"status", status,
+		"duration", time.Since(started),
+	}
+	if userID, ok := c.Locals("userID").(int); ok {
+		attrs = append(attrs, "user_id", userID)
+	}
+	if err != nil && status >= 500 {
+		attrs = append(attrs, "err", err)
+	}
+	requestLog(c).Log(c.UserContext(), level, "Request", attrs...)
+	return err
+}
+
+// Returns the status a handled request is answered with. When the handler
+// returned an error the app's error handler has not set it yet.
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// Copies the signed-in user from the session into the request locals, or
+// from the personal access token in an Authorization: Bearer header
+func (a *App) SessionLocals(c *fiber.Ctx) error {
+	if token, ok := bearerToken(c); ok {
+		return a.tokenLocals(c, token)
+	}
+
+	sess, err := a.Store.Get(c)
+	if err == nil {
+		userID := sess.Get("user_id")
+		userEmail := sess.Get("user_email")
+		userUsername := sess.Get("user_username")
+		if userID != nil && userEmail != nil {
+			c.Locals("userID", userID)
+			c.Locals("userEmail", userEmail)
+			c.Locals("userUsername", userUsername)
+		}
+	}
+	return c.Next()
+}
+
+// Rejects requests from banned IP addresses
+func (a *App) BlockBannedIPs(c *fiber.Ctx) error {
+	clientIP := c.IP()
+
+	isBanned, err := a.Bans.IsBanned(clientIP)
+	if err != nil {
+		requestLog(c).Error("Failed to check IP ban status", "err", err)
+		return c.Next()
+	}
+
+	if isBanned {
+		requestLog(c).Info("Blocked access from banned IP")
+		return c.Status(403).SendString("Access denied. Your IP address has been banned.")
+	}
+	return c.Next()
+}
+
+// Hides the admin scripts and styles from everyone but admins
+func (a *App) GuardAdminStatic(c *fiber.Ctx) error {
+	path := c.Path()
+	if strings.HasPrefix(path, "/static/js/admin") ||
+		strings.HasPrefix(path, "/static/css/admin") ||
+		strings.Contains(path, "/admin/") {
+
+		userID, ok := c.Locals("userID").(int)
+		if !ok {
+			return c.Status(404).SendString("Cannot GET /static/js/")
+		}
+
+		isAdmin, err := a.Users.IsAdmin(userID)
+		if err != nil {
+			requestLog(c).Error("Failed to check admin status", "user_id", userID, "err", err)
+			return c.Status(404).SendString("Cannot GET /static/js/")
+		}
+
+		if !isAdmin {
+			return c.Status(404).SendString("Cannot GET /static/js/")
+		}
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/navid-m/versed/newsletters"
+	"github.com/valyala/fasthttp"
+)
+
+// Returns the authenticated user's inbound newsletter addresses
+func (a *App) GetNewsletterAddresses(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	addrs, err := a.Newsletters.Addresses(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get newsletter addresses", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get newsletter addresses",
+		})
+	}
+	for i := range addrs {
+		addrs[i].Address = a.Inbound.Address(addrs[i].LocalPart)
+	}
+
+	return c.JSON(fiber.Map{
+		"newsletters": addrs,
+		"count":       len(addrs),
+	})
+}
+
+// Creates a new inbound address, optionally adding its feed source to a category
+func (a *App) CreateNewsletterAddress(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req struct {
+		Name       string `json:"name"`
+		CategoryID int    `json:"category_id"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Name is required and must be at most 100 characters",
+		})
+	}
+
+	if req.CategoryID > 0 {
+		if _, err := a.Categories.ByID(userID, req.CategoryID); err != nil {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "Category not found",
+			})
+		}
+	}
+
+	localPart, err := a.Inbound.NewLocalPart(req.Name)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to generate address",
+		})
+	}
+
+	addr, err := a.Newsletters.CreateAddress(userID, req.Name, localPart)
+	if err != nil {
+		requestLog(c).Error("Failed to create newsletter address", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create newsletter address",
+		})
+	}
+	addr.Address = a.Inbound.Address(addr.LocalPart)
+
+	if req.CategoryID > 0 {
+		if err := a.Categories.AddFeed(userID, req.CategoryID, addr.FeedSourceID); err != nil {
+			requestLog(c).Error("Failed to add newsletter to category", "user_id", userID, "newsletter_id", addr.ID, "category_id", req.CategoryID, "err", err)
+		}
+	}
+
+	return c.Status(201).JSON(addr)
+}
+
+// Deletes an inbound address; items already received stay in the feed
+func (a *App) DeleteNewsletterAddress(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid newsletter ID",
+		})
+	}
+
+	if err := a.Newsletters.DeleteAddress(userID, id); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Newsletter not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Newsletter address deleted successfully",
+	})
+}
+
+// Where mail forwarders POST inbound newsletters
+const inboundEmailPath = "/api/inbound/email"
+
+// Gives the inbound email endpoint a body limit that fits the largest
+// newsletter, with room for form encoding. Every other route keeps the
+// server's default limit.
+func inboundBodyLimit(header *fasthttp.RequestHeader) fasthttp.RequestConfig {
+	path, _, _ := bytes.Cut(header.RequestURI(), []byte("?"))
+	if header.IsPost() && strings.EqualFold(strings.TrimSuffix(string(path), "/"), inboundEmailPath) {
+		return fasthttp.RequestConfig{MaxRequestBodySize: newsletters.MaxMessageSize + 1<<20}
+	}
+	return fasthttp.RequestConfig{}
+}
+
+// Accepts a message POSTed by a mail forwarder.
+//
+// The request must carry the inbound secret in the X-Versed-Inbound-Secret
+// header or the secret query parameter. The body is either the raw RFC 5322
+// message, or a form with the message in body-mime, email or raw and the
+// recipient in recipient or to. Without an explicit recipient the message's
+// own headers are used.
+func (a *App) ReceiveInboundEmail(c *fiber.Ctx) error {
+	secret := a.Inbound.Secret()
+	if secret == "" {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Inbound email is not enabled",
+		})
+	}
+	provided := c.Get("X-Versed-Inbound-Secret")
+	if provided == "" {
+		provided = c.Query("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var (
+		raw        []byte
+		recipients []string
+	)
+	if form, err := c.MultipartForm(); err == nil {
+		for _, key := range []string{"body-mime", "email", "raw"} {
+			if values := form.Value[key]; len(values) > 0 && values[0] != "" {
+				raw = []byte(values[0])
+				break
+			}
+			if files := form.File[key]; len(files) > 0 {
+				file, err := files[0].Open()
+				if err != nil {
+					break
+				}
+				raw, err = io.ReadAll(io.LimitReader(file, newsletters.MaxMessageSize+1))
+				file.Close()
+				if err != nil {
+					raw = nil
+				}
+				break
+			}
+		}
+		for _, key := range []string{"recipient", "to"} {
+			for _, value := range form.Value[key] {
+				for _, rcpt := range strings.Split(value, ",") {
+					if rcpt = strings.TrimSpace(rcpt); rcpt != "" {
+						recipients = append(recipients, rcpt)
+					}
+				}
+			}
+		}
+	} else {
+		raw = c.Body()
+		if to := c.Query("to"); to != "" {
+			recipients = strings.Split(to, ",")
+		}
+	}
+
+	if len(raw) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Message body is required",
+		})
+	}
+	if len(raw) > newsletters.MaxMessageSize {
+		return c.Status(413).JSON(fiber.Map{
+			"error": "Message is too large",
+		})
+	}
+
+	created, err := a.Inbound.Deliver(recipients, raw)
+	if err != nil {
+		if errors.Is(err, newsletters.ErrUnknownRecipient) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "No matching newsletter address",
+			})
+		}
+		requestLog(c).Warn("Failed to process inbound email", "err", err)
+		return c.Status(422).JSON(fiber.Map{
+			"error": "Message could not be processed",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"created": created,
+	})
+}
+
+// Shows the full sanitized body of a received newsletter to the user it was
+// sent to; everyone else gets a 404
+func (a *App) NewsletterItemHandler(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Redirect("/signin")
+	}
+	itemID := c.Params("itemId")
+
+	msg, err := a.Newsletters.Message(userID, itemID)
+	if err != nil {
+		return c.Status(404).SendString("Newsletter not found")
+	}
+
+	item, err := a.FeedItems.ByID(itemID)
+	if err != nil {
+		return c.Status(404).SendString("Newsletter not found")
+	}
+
+	data := fiber.Map{
+		"Item":    item,
+		"Message": msg,
+	}
+	if userEmail := c.Locals("userEmail"); userEmail != nil {
+		data["Email"] = userEmail
+	}
+	if userUsername := c.Locals("userUsername"); userUsername != nil {
+		data["Username"] = userUsername
+	}
+
+	return c.Render("newsletter", data)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/navid-m/versed/accounts"
+)
+
+// The same whether or not an account has the address, so the form cannot be
+// used to find out who has signed up
+const resetRequestedMessage = "If an account uses that address, a link to reset its password is on its way."
+
+// Shows the form to ask for a password reset email
+func (a *App) ForgotPasswordPage(c *fiber.Ctx) error {
+	return c.Render("forgot-password", fiber.Map{})
+}
+
+// Emails a password reset link to the address in the form, if it belongs to
+// an account
+func (a *App) RequestPasswordReset(c *fiber.Ctx) error {
+	email := c.FormValue("email")
+	if email == "" {
+		return c.Status(400).Render("forgot-password", fiber.Map{"Error": "Email is required"})
+	}
+
+	err := a.PasswordResets.Request(email, c.IP(), time.Now())
+	switch {
+	case errors.Is(err, accounts.ErrResetRateLimited):
+		requestLog(c).Warn("Password reset rate limited")
+		return c.Status(429).Render("forgot-password", fiber.Map{
+			"Error":        "Too many reset requests, please try again later",
+			"EmailAddress": email,
+		})
+	case errors.Is(err, accounts.ErrResetUnavailable):
+		return c.Status(503).Render("forgot-password", fiber.Map{
+			"Error":        "Password reset by email is not available on this server",
+			"EmailAddress": email,
+		})
+	case err != nil:
+		requestLog(c).Error("Failed to request password reset", "err", err)
+		return c.Status(500).Render("forgot-password", fiber.Map{
+			"Error":        "Failed to send reset link",
+			"EmailAddress": email,
+		})
+	}
+	return c.Render("forgot-password", fiber.Map{"Message": resetRequestedMessage})
+}
+
+// Shows the form to choose a new password with a token from a reset email
+func (a *App) ResetPasswordPage(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if !a.PasswordResets.Valid(token, time.Now()) {
+		return c.Status(404).Render("reset-password", fiber.Map{"Invalid": true})
+	}
+	return c.Render("reset-password", fiber.Map{"Token": token})
+}
+
+// Sets a new password with a token from a reset email and signs the user out
+// everywhere
+func (a *App) ResetPassword(c *fiber.Ctx) error {
+	token := c.Params("token")
+	err := a.PasswordResets.Reset(token, c.FormValue("password"), c.FormValue("confirm-password"), time.Now())
+	var invalid *accounts.ValidationError
+	switch {
+	case errors.Is(err, accounts.ErrInvalidResetToken):
+		return c.Status(404).Render("reset-password", fiber.Map{"Invalid": true})
+	case errors.As(err, &invalid):
+		return c.Status(400).Render("reset-password", fiber.Map{"Token": token, "Error": invalid.Message})
+	case err != nil:
+		requestLog(c).Error("Failed to reset password", "err", err)
+		return c.Status(500).Render("reset-password", fiber.Map{"Token": token, "Error": "Failed to reset password"})
+	}
+	return c.Redirect("/signin")
+}
@@ -1,17 +1,15 @@
 package handlers
 
 import (
-	"log"
 	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/navid-m/versed/database"
 	"github.com/navid-m/versed/models"
 )
 
 // Handles creating a new post in a subverse
-func CreatePost(c *fiber.Ctx) error {
+func (a *App) CreatePost(c *fiber.Ctx) error {
 	userID := c.Locals("userID")
 	username := c.Locals("userUsername")
 	if userID == nil || username == nil {
@@ -64,37 +62,32 @@ func CreatePost(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-
-	var subverseID int
-	err := db.QueryRow("SELECT id FROM subverses WHERE name = ?", subverseName).Scan(&subverseID)
+	subverse, err := a.Subverses.ByName(subverseName)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Subverse not found",
 		})
 	}
 
-	log.Printf("Creating post in subverse '%s' (ID: %d)", subverseName, subverseID)
-	log.Printf("Getting post with ID: %s", req.Title)
-	post, err := database.CreatePost(db, subverseID, userID.(int), username.(string), req.Title, req.Content, req.PostType, req.URL)
+	post, err := a.Posts.Create(subverse.ID, userID.(int), username.(string), req.Title, req.Content, req.PostType, req.URL)
 	if err != nil {
-		log.Printf("Failed to create post: %v", err)
+		requestLog(c).Error("Failed to create post", "subverse_id", subverse.ID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create post",
 		})
 	}
-	log.Printf("Successfully created post with ID %s", post.ID)
+	requestLog(c).Info("Created post", "post_id", post.ID, "subverse_id", subverse.ID)
 
-	err = database.UpdateSubversePostCount(db, subverseID)
+	err = a.Subverses.UpdatePostCount(subverse.ID)
 	if err != nil {
-		log.Printf("Failed to update subverse post count: %v", err)
+		requestLog(c).Error("Failed to update subverse post count", "subverse_id", subverse.ID, "err", err)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(post)
 }
 
 // Handles retrieving a single post
-func GetPost(c *fiber.Ctx) error {
+func (a *App) GetPost(c *fiber.Ctx) error {
 	postIDStr := c.Params("postID")
 	if postIDStr == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -104,26 +97,23 @@ func GetPost(c *fiber.Ctx) error {
 
 	postID := strings.TrimSpace(postIDStr)
 
-	db := database.GetDB()
-	post, err := database.GetPostByID(db, postID)
+	post, err := a.Posts.ByID(postID)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Post not found",
 		})
 	}
 
-	var subverse models.Subverse
-	err = db.QueryRow("SELECT id, name, created_at FROM subverses WHERE id = ?", post.SubverseID).Scan(
-		&subverse.ID, &subverse.Name, &subverse.CreatedAt)
+	subverse, err := a.Subverses.ByID(post.SubverseID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get subverse information",
 		})
 	}
 
-	comments, err := database.GetPostComments(db, postID)
+	comments, err := a.Posts.Comments(postID)
 	if err != nil {
-		log.Printf("Failed to get comments: %v", err)
+		requestLog(c).Error("Failed to get comments", "post_id", postID, "err", err)
 		comments = []models.PostComment{}
 	}
 	userEmail := c.Locals("userEmail")
@@ -151,7 +141,7 @@ func GetPost(c *fiber.Ctx) error {
 }
 
 // Handles retrieving posts for a subverse
-func GetSubversePosts(c *fiber.Ctx) error {
+func (a *App) GetSubversePosts(c *fiber.Ctx) error {
 	subverseName := c.Params("subverseName")
 	if subverseName == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -165,19 +155,16 @@ func GetSubversePosts(c *fiber.Ctx) error {
 	}
 	offset := c.QueryInt("offset", 0)
 
-	db := database.GetDB()
-
-	var subverseID int
-	err := db.QueryRow("SELECT id FROM subverses WHERE name = ?", subverseName).Scan(&subverseID)
+	subverse, err := a.Subverses.ByName(subverseName)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"error": "Subverse not found",
 		})
 	}
 
-	posts, err := database.GetPostsBySubverse(db, subverseID, limit, offset)
+	posts, err := a.Posts.ForSubverse(subverse.ID, limit, offset)
 	if err != nil {
-		log.Printf("Failed to get subverse posts: %v", err)
+		requestLog(c).Error("Failed to get subverse posts", "subverse_id", subverse.ID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get posts",
 		})
@@ -192,7 +179,7 @@ func GetSubversePosts(c *fiber.Ctx) error {
 }
 
 // Handles updating a post
-func UpdatePost(c *fiber.Ctx) error {
+func (a *App) UpdatePost(c *fiber.Ctx) error {
 	userID := c.Locals("userID")
 	if userID == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -225,10 +212,9 @@ func UpdatePost(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-	err := database.UpdatePost(db, postID, userID.(int), req.Title, req.Content)
+	err := a.Posts.Update(postID, userID.(int), req.Title, req.Content)
 	if err != nil {
-		log.Printf("Failed to update post: %v", err)
+		requestLog(c).Error("Failed to update post", "post_id", postID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update post",
 		})
@@ -241,7 +227,7 @@ func UpdatePost(c *fiber.Ctx) error {
 }
 
 // Handles deleting a post
-func DeletePost(c *fiber.Ctx) error {
+func (a *App) DeletePost(c *fiber.Ctx) error {
 	userID := c.Locals("userID")
 	if userID == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -258,10 +244,9 @@ func DeletePost(c *fiber.Ctx) error {
 
 	postID := strings.TrimSpace(postIDStr)
 
-	db := database.GetDB()
-	err := database.DeletePost(db, postID, userID.(int))
+	err := a.Posts.Delete(postID, userID.(int))
 	if err != nil {
-		log.Printf("Failed to delete post: %v", err)
+		requestLog(c).Error("Failed to delete post", "post_id", postID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete post",
 		})
@@ -274,7 +259,7 @@ func DeletePost(c *fiber.Ctx) error {
 }
 
 // Handles creating a new comment on a post
-func CreatePostComment(c *fiber.Ctx) error {
+func (a *App) CreatePostComment(c *fiber.Ctx) error {
 	userID := c.Locals("userID")
 	username := c.Locals("userUsername")
 	if userID == nil || username == nil {
@@ -298,48 +283,30 @@ func CreatePostComment(c *fiber.Ctx) error {
 	}
 
 	if err := c.BodyParser(&req); err != nil {
-		log.Printf("BodyParser error: %v", err)
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
-	log.Printf("Received comment request: content='%s', parent_id=%v", req.Content, req.ParentID)
-
 	if req.Content == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Content is required",
 		})
 	}
 
-	db := database.GetDB()
-	comment, err := database.CreatePostComment(db, postID, userID.(int), username.(string), req.Content, req.ParentID)
+	comment, err := a.Posts.CreateComment(postID, userID.(int), username.(string), req.Content, req.ParentID)
 	if err != nil {
-		log.Printf("Failed to create comment: %v", err)
+		requestLog(c).Error("Failed to create comment", "post_id", postID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create comment",
 		})
 	}
 
-	log.Printf("=== SERVER: About to return comment ===")
-	log.Printf("SERVER: Comment ID: %s", comment.ID)
-	log.Printf("SERVER: Comment PostID: %s", comment.PostID)
-	log.Printf("SERVER: Comment UserID: %d", comment.UserID)
-	log.Printf("SERVER: Comment Username: %s", comment.Username)
-	log.Printf("SERVER: Comment Content: %s", comment.Content)
-	if comment.ParentID != nil {
-		log.Printf("SERVER: Comment ParentID: %s", *comment.ParentID)
-	} else {
-		log.Printf("SERVER: Comment ParentID: nil")
-	}
-	log.Printf("SERVER: Full comment structure: %+v", comment)
-	log.Printf("=== SERVER: Returning comment to client ===")
-
 	return c.Status(fiber.StatusCreated).JSON(comment)
 }
 
 // Handles retrieving comments for a post
-func GetPostComments(c *fiber.Ctx) error {
+func (a *App) GetPostComments(c *fiber.Ctx) error {
 	postIDStr := c.Params("postID")
 	if postIDStr == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -349,10 +316,9 @@ func GetPostComments(c *fiber.Ctx) error {
 
 	postID := strings.TrimSpace(postIDStr)
 
-	db := database.GetDB()
-	comments, err := database.GetPostComments(db, postID)
+	comments, err := a.Posts.Comments(postID)
 	if err != nil {
-		log.Printf("Failed to get post comments: %v", err)
+		requestLog(c).Error("Failed to get post comments", "post_id", postID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get comments",
 		})
@@ -365,7 +331,7 @@ func GetPostComments(c *fiber.Ctx) error {
 }
 
 // Handles updating a comment
-func UpdatePostComment(c *fiber.Ctx) error {
+func (a *App) UpdatePostComment(c *fiber.Ctx) error {
 	userID := c.Locals("userID")
 	if userID == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -396,10 +362,9 @@ func UpdatePostComment(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-	err = database.UpdatePostComment(db, strconv.Itoa(commentID), userID.(int), req.Content)
+	err = a.Posts.UpdateComment(strconv.Itoa(commentID), userID.(int), req.Content)
 	if err != nil {
-		log.Printf("Failed to update comment: %v", err)
+		requestLog(c).Error("Failed to update comment", "comment_id", commentID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update comment",
 		})
@@ -412,7 +377,7 @@ func UpdatePostComment(c *fiber.Ctx) error {
 }
 
 // Handles deleting a comment
-func DeletePostComment(c *fiber.Ctx) error {
+func (a *App) DeletePostComment(c *fiber.Ctx) error {
 	userID := c.Locals("userID")
 	if userID == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -427,10 +392,9 @@ func DeletePostComment(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-	err = database.DeletePostComment(db, strconv.Itoa(commentID), userID.(int))
+	err = a.Posts.DeleteComment(strconv.Itoa(commentID), userID.(int))
 	if err != nil {
-		log.Printf("Failed to delete comment: %v", err)
+		requestLog(c).Error("Failed to delete comment", "comment_id", commentID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete comment",
 		})
@@ -443,7 +407,7 @@ func DeletePostComment(c *fiber.Ctx) error {
 }
 
 // VotePost handles voting on a post (upvote/downvote)
-func VotePost(c *fiber.Ctx) error {
+func (a *App) VotePost(c *fiber.Ctx) error {
 	userID := c.Locals("userID")
 	if userID == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -476,16 +440,14 @@ func VotePost(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-
-	err := database.VoteOnPost(db, userID.(int), postID, req.VoteType)
+	err := a.Posts.Vote(userID.(int), postID, req.VoteType)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to vote on post",
 		})
 	}
 
-	post, err := database.GetPostByID(db, postID)
+	post, err := a.Posts.ByID(postID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get updated post",
@@ -500,7 +462,7 @@ func VotePost(c *fiber.Ctx) error {
 }
 
 // Handles searching for posts within a subverse
-func SearchPosts(c *fiber.Ctx) error {
+func (a *App) SearchPosts(c *fiber.Ctx) error {
 	subverseName := c.Params("subverseName")
 	if subverseName == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -509,12 +471,10 @@ func SearchPosts(c *fiber.Ctx) error {
 	}
 
 	var (
-		subverseID int
-		query      = c.Query("q", "")
-		limit      = min(c.QueryInt("limit", 20), 50)
-		offset     = c.QueryInt("offset", 0)
-		db         = database.GetDB()
-		err        = db.QueryRow("SELECT id FROM subverses WHERE name = ?", subverseName).Scan(&subverseID)
+		query         = c.Query("q", "")
+		limit         = min(c.QueryInt("limit", 20), 50)
+		offset        = c.QueryInt("offset", 0)
+		subverse, err = a.Subverses.ByName(subverseName)
 	)
 
 	if err != nil {
@@ -523,9 +483,9 @@ func SearchPosts(c *fiber.Ctx) error {
 		})
 	}
 
-	posts, err := database.SearchPostsBySubverse(db, subverseID, query, limit, offset)
+	posts, err := a.Posts.Search(subverse.ID, query, limit, offset)
 	if err != nil {
-		log.Printf("Failed to search posts: %v", err)
+		requestLog(c).Error("Failed to search posts", "subverse_id", subverse.ID, "err", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to search posts",
 		})
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/navid-m/versed/accounts"
+	"github.com/navid-m/versed/repository"
+)
+
+// Renders the signed-in user's profile page
+func (a *App) ProfilePage(c *fiber.Ctx) error {
+	userID := c.Locals("userID")
+	userEmail := c.Locals("userEmail")
+	userUsername := c.Locals("userUsername")
+
+	if userID == nil || userEmail == nil {
+		return c.Redirect("/signin")
+	}
+
+	data := fiber.Map{
+		"Email":    userEmail,
+		"Username": userUsername,
+	}
+	if user, err := a.Users.ByID(userID.(int)); err != nil {
+		requestLog(c).Error("Failed to get user", "user_id", userID, "err", err)
+	} else {
+		data["Unverified"] = a.Verifier.Required() && !user.EmailVerified
+		data["PendingEmail"] = user.PendingEmail
+		data["IsAdmin"] = user.IsAdmin
+	}
+
+	return c.Render("profile", data)
+}
+
+// Changes the signed-in user's email, username and optionally password.
+//
+// A new email address only takes effect once it is verified. A password
+// change signs the user out everywhere else and gives this session a new ID.
+func (a *App) UpdateProfile(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Redirect("/signin")
+	}
+
+	change := accounts.SettingsChange{
+		Email:           c.FormValue("email"),
+		Username:        c.FormValue("username"),
+		CurrentPassword: c.FormValue("current_password"),
+		NewPassword:     c.FormValue("new_password"),
+		ConfirmPassword: c.FormValue("confirm_password"),
+	}
+	if change.Email == "" || change.Username == "" || change.CurrentPassword == "" {
+		return c.Status(400).SendString("Email, username, and current password are required")
+	}
+
+	// Loaded before the change, which may delete it from storage
+	sess, err := a.Store.Get(c)
+	if err != nil {
+		requestLog(c).Error("Failed to get session", "user_id", userID, "err", err)
+		return c.Status(500).SendString("Failed to update profile")
+	}
+
+	result, err := a.Settings.Update(userID, change)
+	var invalid *accounts.ValidationError
+	switch {
+	case errors.Is(err, accounts.ErrWrongPassword):
+		return c.Status(401).SendString("Invalid current password")
+	case errors.As(err, &invalid):
+		return c.Status(400).SendString(invalid.Message)
+	case errors.Is(err, repository.ErrEmailTaken):
+		return c.Status(400).SendString("This email is already registered")
+	case errors.Is(err, repository.ErrUsernameTaken):
+		return c.Status(400).SendString("This username is already taken")
+	case err != nil && !result.PasswordChanged:
+		requestLog(c).Error("Failed to update profile", "user_id", userID, "err", err)
+		return c.Status(500).SendString("Failed to update profile")
+	case err != nil:
+		// The password did change, so carry on and rotate this session
+		requestLog(c).Error("Failed to end other sessions", "user_id", userID, "err", err)
+	}
+
+	if result.PasswordChanged {
+		if err := sess.Regenerate(); err != nil {
+			requestLog(c).Error("Failed to rotate session", "user_id", userID, "err", err)
+			return c.Redirect("/signin")
+		}
+	}
+	sess.Set("user_id", userID)
+	sess.Set("user_email", result.Email)
+	sess.Set("user_username", strings.TrimSpace(change.Username))
+	if err := sess.Save(); err != nil {
+		requestLog(c).Error("Failed to save session", "user_id", userID, "err", err)
+		return c.Redirect("/signin")
+	}
+
+	if result.PendingEmail != "" && result.PendingEmail == strings.TrimSpace(change.Email) {
+		return c.Redirect("/profile?success=1&verify=1")
+	}
+	return c.Redirect("/profile?success=1")
+}
+
+// Renders the category graph page
+func (a *App) GraphPage(c *fiber.Ctx) error {
+	userEmail := c.Locals("userEmail")
+	userUsername := c.Locals("userUsername")
+
+	if userEmail == nil {
+		return c.Redirect("/signin")
+	}
+
+	data := fiber.Map{
+		"Email":    userEmail,
+		"Username": userUsername,
+	}
+
+	return c.Render("graph", data)
+}
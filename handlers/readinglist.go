@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/navid-m/versed/feeds"
+)
+
+// Records the authenticated user's vote on a feed item
+func (a *App) VoteFeedItem(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var voteRequest struct {
+		FeedID   string `json:"feed_id"`
+		VoteType string `json:"vote_type"`
+	}
+
+	if err := c.BodyParser(&voteRequest); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	newScore, err := a.FeedItems.Vote(userID, voteRequest.FeedID, voteRequest.VoteType)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"new_score": newScore,
+	})
+}
+
+// Saves an item to the authenticated user's reading list
+func (a *App) SaveToReadingList(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var saveRequest struct {
+		ItemID string `json:"item_id"`
+	}
+
+	if err := c.BodyParser(&saveRequest); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	saved, err := a.Users.SaveToReadingList(userID, saveRequest.ItemID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to save item to reading list",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"saved":   saved,
+	})
+}
+
+// Removes an item from the authenticated user's reading list
+func (a *App) RemoveFromReadingList(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var removeRequest struct {
+		ItemID string `json:"item_id"`
+	}
+
+	if err := c.BodyParser(&removeRequest); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	err := a.Users.RemoveFromReadingList(userID, removeRequest.ItemID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to remove item from reading list",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"removed": true,
+	})
+}
+
+// Renders the authenticated user's reading list
+func (a *App) ReadingListPage(c *fiber.Ctx) error {
+	userEmail := c.Locals("userEmail")
+	userUsername := c.Locals("userUsername")
+	userID, ok := c.Locals("userID").(int)
+	if userEmail == nil || !ok {
+		return c.Redirect("/signin")
+	}
+
+	feedItems, err := a.Users.ReadingList(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get reading list", "user_id", userID, "err", err)
+	}
+	for i, item := range feedItems {
+		if strings.TrimSpace(item.Description) == "" {
+			feedItems[i].Description = "No description."
+		}
+	}
+
+	data := fiber.Map{
+		"FeedItems": feedItems,
+		"Email":     userEmail,
+		"Username":  userUsername,
+	}
+
+	return c.Render("reading-list", data)
+}
+
+// Returns the authenticated user's reading list, newest first
+func (a *App) GetReadingList(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	items, err := a.Users.ReadingList(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to retrieve reading list",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"items": items,
+		"count": len(items),
+	})
+}
+
+// Reports whether an item is in the authenticated user's reading list
+func (a *App) CheckReadingList(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	itemID := c.Params("itemId")
+	saved, err := a.Users.IsInReadingList(userID, itemID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check reading list status",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"saved": saved,
+	})
+}
+
+// Hides a feed item from the authenticated user's feeds
+func (a *App) HidePost(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	itemID := c.Params("itemId")
+	if itemID == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Item ID is required",
+		})
+	}
+
+	err := a.Users.Hide(userID, itemID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to hide post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Post hidden successfully",
+	})
+}
+
+// Shows a previously hidden feed item again
+func (a *App) UnhidePost(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	itemID := c.Params("itemId")
+	if itemID == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Item ID is required",
+		})
+	}
+
+	err := a.Users.Unhide(userID, itemID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to unhide post",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Post unhidden successfully",
+	})
+}
+
+// Reports whether the authenticated user has hidden a feed item
+func (a *App) IsPostHidden(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	itemID := c.Params("itemId")
+	if itemID == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Item ID is required",
+		})
+	}
+
+	hidden, err := a.Users.IsHidden(userID, itemID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check if post is hidden",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"hidden": hidden,
+	})
+}
+
+// Returns the feed items the authenticated user has hidden
+func (a *App) GetHiddenPosts(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	itemIDs, err := a.Users.HiddenIDs(userID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get hidden posts",
+		})
+	}
+
+	var hiddenItems []feeds.FeedItem
+	for _, itemID := range itemIDs {
+		item, err := a.FeedItems.ByID(itemID)
+		if err != nil {
+			continue
+		}
+		hiddenItems = append(hiddenItems, *item)
+	}
+
+	return c.JSON(fiber.Map{
+		"hiddenItems": hiddenItems,
+		"count":       len(hiddenItems),
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Installs the middleware and every route on the given fiber app
+func (a *App) Register(app *fiber.App) {
+	app.Server().HeaderReceived = inboundBodyLimit
+	app.Use(RequestID)
+	app.Use(LogRequests)
+	app.Use(CountRequests)
+	// Ahead of the session middleware so probes never touch the database
+	// unless a check does
+	app.Get("/healthz", a.Healthz)
+	app.Get("/readyz", a.Readyz)
+	app.Use(a.SessionLocals)
+	app.Use(a.BlockBannedIPs)
+	app.Use("/static", a.GuardAdminStatic)
+	app.Static("/static", "./static")
+
+	app.Get("/", a.IndexHandler)
+	app.Get("/signin", func(c *fiber.Ctx) error {
+		return c.Render("signin", fiber.Map{})
+	})
+	app.Get("/signup", func(c *fiber.Ctx) error {
+		return c.Render("signup", fiber.Map{})
+	})
+	app.Get("/about", a.AboutHandler)
+	app.Post("/signup", a.SignUpHandler)
+	app.Post("/signin", a.SignInHandler)
+	app.Get("/signin/2fa", a.TwoFactorSignInPage)
+	app.Post("/signin/2fa", a.TwoFactorSignIn)
+	app.Get("/signout", a.SignOutHandler)
+	app.Get("/forgot-password", a.ForgotPasswordPage)
+	app.Post("/forgot-password", a.RequestPasswordReset)
+	app.Get("/reset-password/:token", a.ResetPasswordPage)
+	app.Post("/reset-password/:token", a.ResetPassword)
+	app.Get("/verify-email", a.VerifyEmail)
+
+	app.Get("/api/feeds", a.FeedsHandler)
+	app.Get("/api/feeds/:source", a.FeedSourceHandler)
+	app.Get("/api/search", a.SearchFeedItems)
+	app.Get("/api/search/comments", a.SearchComments)
+	app.Get("/api/search/all", a.SearchAll)
+	app.Get("/search", a.SearchPage)
+	app.Post("/api/vote", a.RequireVerifiedEmail, a.VoteFeedItem)
+
+	app.Post("/api/reading-list/save", a.SaveToReadingList)
+	app.Post("/api/reading-list/remove", a.RemoveFromReadingList)
+	app.Get("/reading-list", a.ReadingListPage)
+	app.Get("/api/reading-list", a.GetReadingList)
+	app.Get("/api/reading-list/check/:itemId", a.CheckReadingList)
+
+	app.Post("/api/posts/:itemId/hide", a.HidePost)
+	app.Post("/api/posts/:itemId/unhide", a.UnhidePost)
+	app.Get("/api/posts/:itemId/hidden", a.IsPostHidden)
+	app.Get("/api/posts/hidden", a.GetHiddenPosts)
+
+	app.Get("/u/:username/c/:categoryName", a.CategoryPage)
+	app.Get("/u/:username/s/:searchName", a.SavedSearchPage)
+
+	app.Get("/api/categories", a.GetUserCategories)
+	app.Post("/api/categories", a.CreateUserCategory)
+	app.Put("/api/categories/:id", a.UpdateUserCategory)
+	app.Delete("/api/categories/:id", a.DeleteUserCategory)
+	app.Get("/api/categories/:id/feeds", a.GetCategoryFeeds)
+	app.Get("/api/categories/:id/items", a.GetCategoryFeedItems)
+	app.Post("/api/categories/:id/feeds", a.AddFeedToCategory)
+	app.Delete("/api/categories/:categoryId/feeds/:feedId", a.RemoveFeedFromCategory)
+	app.Post("/api/categories/:id/feeds/create", a.CreateAndAddFeedToCategory)
+
+	app.Get("/api/saved-searches", a.GetSavedSearches)
+	app.Post("/api/saved-searches", a.CreateSavedSearch)
+	app.Put("/api/saved-searches/:id", a.UpdateSavedSearch)
+	app.Delete("/api/saved-searches/:id", a.DeleteSavedSearch)
+	app.Post("/api/saved-searches/:id/seen", a.MarkSavedSearchSeen)
+
+	app.Get("/api/webhooks", a.GetWebhooks)
+	app.Post("/api/webhooks", a.CreateWebhook)
+	app.Put("/api/webhooks/:id", a.UpdateWebhook)
+	app.Delete("/api/webhooks/:id", a.DeleteWebhook)
+	app.Get("/api/webhooks/:id/deliveries", a.GetWebhookDeliveries)
+
+	app.Get("/api/digest", a.GetDigestSettings)
+	app.Put("/api/digest", a.UpdateDigestSettings)
+	app.Post("/api/digest/test", a.RequireVerifiedEmail, a.SendTestDigest)
+	app.Get("/digest/unsubscribe/:token", a.UnsubscribeDigestPage)
+	app.Post("/digest/unsubscribe/:token", a.UnsubscribeDigest)
+
+	app.Get("/api/newsletters", a.GetNewsletterAddresses)
+	app.Post("/api/newsletters", a.CreateNewsletterAddress)
+	app.Delete("/api/newsletters/:id", a.DeleteNewsletterAddress)
+	app.Post(inboundEmailPath, a.ReceiveInboundEmail)
+	app.Get("/newsletters/items/:itemId", a.NewsletterItemHandler)
+
+	app.Get("/api/exports", a.GetDataExports)
+	app.Post("/api/exports", a.RequestDataExport)
+	app.Get("/exports/:id/download", a.DownloadDataExport)
+
+	app.Get("/api/account/deletion", a.GetAccountDeletion)
+	app.Post("/api/account/deletion", a.ScheduleAccountDeletion)
+	app.Delete("/api/account/deletion", a.CancelAccountDeletion)
+	app.Post("/api/account/verification", a.ResendVerification)
+	app.Get("/api/account/2fa", a.GetTwoFactor)
+	app.Post("/api/account/2fa/setup", a.SetupTwoFactor)
+	app.Post("/api/account/2fa/enable", a.EnableTwoFactor)
+	app.Post("/api/account/2fa/disable", a.DisableTwoFactor)
+	app.Post("/api/account/2fa/recovery-codes", a.RegenerateRecoveryCodes)
+	app.Get("/api/account/tokens", a.GetAPITokens)
+	app.Post("/api/account/tokens", a.CreateAPIToken)
+	app.Delete("/api/account/tokens/:id", a.RevokeAPIToken)
+
+	app.Get("/api/graph", a.GraphHandler)
+	app.Get("/post/:itemId", a.PostItemHandler)
+
+	app.Get("/api/posts/:itemId", a.GetPostView)
+	app.Get("/api/posts/:itemId/comments", a.GetComments)
+	app.Post("/api/posts/:itemId/comments", a.RequireVerifiedEmail, a.CreateComment)
+	app.Get("/api/comments/:commentId", a.GetComment)
+	app.Put("/api/comments/:commentId", a.UpdateComment)
+	app.Delete("/api/comments/:commentId", a.DeleteComment)
+
+	app.Get("/profile", a.ProfilePage)
+	app.Get("/graph", a.GraphPage)
+	app.Post("/profile/update", a.UpdateProfile)
+
+	app.Get("/metrics", a.Metrics)
+	app.Get("/admin", a.RequireAdmin, a.AdminPage)
+	app.Get("/api/admin/users", a.RequireAdmin, a.GetUsers)
+	app.Get("/api/admin/banned-ips", a.RequireAdmin, a.GetBannedIPs)
+	app.Post("/api/admin/ban-ip", a.RequireAdmin, a.BanIP)
+	app.Post("/api/admin/unban-ip", a.RequireAdmin, a.UnbanIP)
+	app.Delete("/api/admin/users/:id", a.RequireAdmin, a.AdminDeleteUser)
+	app.Post("/api/admin/users/:id/verify", a.RequireAdmin, a.AdminVerifyUser)
+	app.Get("/api/admin/settings", a.RequireAdmin, a.GetAdminSettings)
+	app.Put("/api/admin/settings", a.RequireAdmin, a.UpdateAdminSettings)
+
+	app.Post("/api/admin/subverses", a.RequireAdmin, a.CreateSubverse)
+	app.Get("/api/subverses", a.GetSubverses)
+	app.Get("/s/:subverseName", a.ViewSubverse)
+
+	app.Get("/api/admin/subverses/:subverseId/feeds", a.RequireAdmin, a.GetSubverseFeeds)
+	app.Post("/api/admin/subverses/:subverseId/feeds", a.RequireAdmin, a.AddFeedToSubverse)
+	app.Delete("/api/admin/subverses/:subverseId/feeds/:feedId", a.RequireAdmin, a.RemoveFeedFromSubverse)
+
+	app.Get("/s/:subverseName/posts", a.GetSubversePosts)
+	app.Get("/s/:subverseName/posts/search", a.SearchPosts)
+	app.Post("/s/:subverseName/posts", a.RequireVerifiedEmail, a.CreatePost)
+	app.Get("/posts/:postID", a.GetPost)
+	app.Put("/posts/:postID", a.UpdatePost)
+	app.Delete("/posts/:postID", a.DeletePost)
+	app.Post("/api/posts/:postID/vote", a.RequireVerifiedEmail, a.VotePost)
+
+	app.Get("/api/user/status", a.UserStatus)
+}
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/search"
+)
+
+// Checks the name and query of a saved search, returning the response body
+// for a 400 if either is invalid
+func validateSavedSearch(name, query string) fiber.Map {
+	if name == "" || len(name) > 100 {
+		return fiber.Map{
+			"error": "Name is required and must be at most 100 characters",
+		}
+	}
+	parsed, err := search.Parse(query)
+	if err != nil {
+		return queryError(err)
+	}
+	if parsed.Empty() {
+		return fiber.Map{
+			"error": "Search query is required",
+		}
+	}
+	return nil
+}
+
+// Body of requests creating or updating a saved search
+type savedSearchRequest struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// Returns the authenticated user's saved searches with their unseen match counts
+func (a *App) GetSavedSearches(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	searches, err := a.SavedSearches.List(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get saved searches", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get saved searches",
+		})
+	}
+	if searches == nil {
+		searches = []models.SavedSearch{}
+	}
+
+	return c.JSON(fiber.Map{
+		"searches": searches,
+		"count":    len(searches),
+	})
+}
+
+// Saves a search query for the authenticated user.
+//
+// Only items ingested from now on count as new matches.
+func (a *App) CreateSavedSearch(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req savedSearchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	name, query := strings.TrimSpace(req.Name), strings.TrimSpace(req.Query)
+	if invalid := validateSavedSearch(name, query); invalid != nil {
+		return c.Status(400).JSON(invalid)
+	}
+
+	if _, err := a.SavedSearches.ByName(userID, name); err == nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "A saved search with that name already exists",
+		})
+	}
+
+	saved, err := a.SavedSearches.Create(userID, name, query)
+	if err != nil {
+		requestLog(c).Error("Failed to create saved search", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create saved search",
+		})
+	}
+
+	return c.Status(201).JSON(saved)
+}
+
+// Renames a saved search or changes its query
+func (a *App) UpdateSavedSearch(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid saved search ID",
+		})
+	}
+
+	var req savedSearchRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	name, query := strings.TrimSpace(req.Name), strings.TrimSpace(req.Query)
+	if invalid := validateSavedSearch(name, query); invalid != nil {
+		return c.Status(400).JSON(invalid)
+	}
+
+	if _, err := a.SavedSearches.ByID(userID, id); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved search not found",
+		})
+	}
+	if existing, err := a.SavedSearches.ByName(userID, name); err == nil && existing.ID != id {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "A saved search with that name already exists",
+		})
+	}
+
+	if err := a.SavedSearches.Update(userID, id, name, query); err != nil {
+		requestLog(c).Error("Failed to update saved search", "user_id", userID, "saved_search_id", id, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update saved search",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Saved search updated successfully",
+	})
+}
+
+// Deletes a saved search
+func (a *App) DeleteSavedSearch(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid saved search ID",
+		})
+	}
+
+	if err := a.SavedSearches.Delete(userID, id); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved search not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Saved search deleted successfully",
+	})
+}
+
+// Marks every match of a saved search as seen
+func (a *App) MarkSavedSearchSeen(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid saved search ID",
+		})
+	}
+
+	if _, err := a.SavedSearches.ByID(userID, id); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Saved search not found",
+		})
+	}
+	if err := a.SavedSearches.MarkSeen(userID, id); err != nil {
+		requestLog(c).Error("Failed to mark saved search seen", "user_id", userID, "saved_search_id", id, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to mark saved search seen",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Saved search marked as seen",
+	})
+}
+
+// Renders the items matching one of the signed-in user's saved searches, the
+// same way a category is shown, and marks its matches as seen
+func (a *App) SavedSearchPage(c *fiber.Ctx) error {
+	userEmail := c.Locals("userEmail")
+	userUsername := c.Locals("userUsername")
+	userID, ok := c.Locals("userID").(int)
+	if userEmail == nil || !ok {
+		return c.Redirect("/signin")
+	}
+
+	// The sidebar escapes names, which may hold any character
+	searchName, err := url.PathUnescape(c.Params("searchName"))
+	if err != nil {
+		return c.Status(404).SendString("Saved search not found")
+	}
+	searchName = strings.ReplaceAll(strings.TrimSpace(searchName), "-", " ")
+
+	saved, err := a.SavedSearches.ByName(userID, searchName)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			requestLog(c).Error("Failed to get saved search", "user_id", userID, "err", err)
+		}
+		return c.Status(404).SendString("Saved search not found")
+	}
+
+	var items []feeds.FeedItem
+	if parsed, err := search.Parse(saved.Query); err != nil {
+		requestLog(c).Warn("Saved search has a malformed query", "saved_search_id", saved.ID, "err", err)
+	} else if items, err = a.FeedItems.Search(parsed, 50, 0); err != nil {
+		requestLog(c).Error("Failed to run saved search", "saved_search_id", saved.ID, "err", err)
+	}
+
+	for i, item := range items {
+		if strings.TrimSpace(item.Description) == "" {
+			items[i].Description = "No description."
+		}
+	}
+
+	if err := a.SavedSearches.MarkSeen(userID, saved.ID); err != nil {
+		requestLog(c).Error("Failed to mark saved search seen", "user_id", userID, "saved_search_id", saved.ID, "err", err)
+	}
+
+	data := fiber.Map{
+		"FeedItems":    items,
+		"CategoryName": saved.Name,
+		"Username":     c.Params("username"),
+		"Email":        userEmail,
+	}
+	if userUsername != nil {
+		data["Username"] = userUsername
+	}
+
+	return c.Render("index", data)
+}
@@ -1,47 +1,254 @@
 package handlers
 
 import (
-	"github.com/navid-m/versed/database"
+	"errors"
+
 	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/search"
 
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// Searches for feed items based on query string
-func SearchFeedItems(c *fiber.Ctx) error {
+// Reads the limit and offset query parameters of a search
+func searchPage(c *fiber.Ctx) (limit, offset int) {
+	limit = min(max(c.QueryInt("limit", 50), 1), 100)
+	offset = max(c.QueryInt("offset", 0), 0)
+	return limit, offset
+}
+
+// Describes a malformed search query, with the character offset of the problem when it is known
+func queryError(err error) fiber.Map {
+	var parseErr *search.Error
+	if errors.As(err, &parseErr) {
+		return fiber.Map{
+			"error":  parseErr.Message,
+			"offset": parseErr.Offset,
+		}
+	}
+	return fiber.Map{
+		"error": "Invalid search query",
+	}
+}
+
+// Searches for feed items based on query string.
+//
+// The query may mix free text with field filters, see the search package.
+// A malformed query is rejected with the character offset of the problem.
+// Results are paged with limit and offset.
+func (a *App) SearchFeedItems(c *fiber.Ctx) error {
 	query := c.Query("q", "")
-	if strings.TrimSpace(query) == "" {
+	limit, offset := searchPage(c)
+
+	parsed, err := search.Parse(query)
+	if err != nil {
+		return c.Status(400).JSON(queryError(err))
+	}
+	if parsed.Empty() {
 		return c.JSON(fiber.Map{
-			"items": []feeds.FeedItem{},
-			"count": 0,
+			"items":  []feeds.FeedItem{},
+			"count":  0,
+			"limit":  limit,
+			"offset": offset,
 		})
 	}
 
-	rows, err := database.GetFeedItemsToQuery(query)
+	items, err := a.FeedItems.Search(parsed, limit, offset)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"error": "Failed to search feed items",
 		})
 	}
-	defer rows.Close()
+	if items == nil {
+		items = []feeds.FeedItem{}
+	}
+
+	return c.JSON(fiber.Map{
+		"items":  items,
+		"count":  len(items),
+		"limit":  limit,
+		"offset": offset,
+		"query":  query,
+	})
+}
+
+// Searches comments on feed items, with the same query syntax and paging as SearchFeedItems
+func (a *App) SearchComments(c *fiber.Ctx) error {
+	query := c.Query("q", "")
+	limit, offset := searchPage(c)
+	if strings.TrimSpace(query) == "" {
+		return c.JSON(fiber.Map{
+			"comments": []models.Comment{},
+			"count":    0,
+			"limit":    limit,
+			"offset":   offset,
+		})
+	}
+
+	comments, err := a.Comments.Search(query, limit, offset)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to search comments",
+		})
+	}
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+
+	return c.JSON(fiber.Map{
+		"comments": comments,
+		"count":    len(comments),
+		"limit":    limit,
+		"offset":   offset,
+		"query":    query,
+	})
+}
+
+// Labels for each global search content type
+var searchTypeLabels = map[string]string{
+	repository.SearchFeedItems:    "Feed items",
+	repository.SearchPosts:        "Posts",
+	repository.SearchComments:     "Comments",
+	repository.SearchPostComments: "Post comments",
+	repository.SearchSubverses:    "Subverses",
+	repository.SearchUsers:        "Users",
+}
 
-	var items []feeds.FeedItem
-	for rows.Next() {
-		var item feeds.FeedItem
-		var sourceName string
-		err := rows.Scan(&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
-			&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &sourceName)
-		if err != nil {
-			continue
+// Results shown per content type when a global search is not narrowed to one
+const searchGroupSize = 5
+
+// Reads a global search from the q, type, source, subverse, limit and offset
+// query parameters, returning the response body for a 400 if it is invalid
+func globalSearchRequest(c *fiber.Ctx) (*search.Query, repository.SearchOptions, fiber.Map) {
+	opts := repository.SearchOptions{
+		Type:     c.Query("type"),
+		Source:   strings.TrimSpace(c.Query("source")),
+		Subverse: strings.TrimSpace(c.Query("subverse")),
+	}
+	if _, ok := searchTypeLabels[opts.Type]; opts.Type != "" && !ok {
+		return nil, opts, fiber.Map{
+			"error": "Unknown search type",
 		}
-		item.SourceName = sourceName
-		items = append(items, item)
+	}
+
+	opts.Limit, opts.Offset = searchPage(c)
+	if opts.Type == "" && c.Query("limit") == "" {
+		opts.Limit = searchGroupSize
+	}
+
+	parsed, err := search.Parse(c.Query("q"))
+	if err != nil {
+		return nil, opts, queryError(err)
+	}
+	return parsed, opts, nil
+}
+
+// Searches feed items, posts, comments, subverses and users at once.
+//
+// Results are grouped by type, with facet counts per type, feed source and
+// subverse. Passing type narrows the results to one type and pages them with
+// limit and offset; source and subverse narrow feed items and posts.
+func (a *App) SearchAll(c *fiber.Ctx) error {
+	query, opts, invalid := globalSearchRequest(c)
+	if invalid != nil {
+		return c.Status(400).JSON(invalid)
+	}
+
+	results, err := a.Search.All(query, opts)
+	if err != nil {
+		requestLog(c).Error("Failed to search", "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to search",
+		})
 	}
 
 	return c.JSON(fiber.Map{
-		"items": items,
-		"count": len(items),
+		"query":   c.Query("q"),
+		"type":    opts.Type,
+		"limit":   opts.Limit,
+		"offset":  opts.Offset,
+		"results": results,
 	})
 }
+
+// One entry of the content type facet on the search page
+type searchTypeFacet struct {
+	Type   string
+	Label  string
+	Count  int
+	Active bool
+}
+
+// Renders the search page with the same parameters as SearchAll
+func (a *App) SearchPage(c *fiber.Ctx) error {
+	data := fiber.Map{
+		"Query":    c.Query("q"),
+		"Email":    c.Locals("userEmail"),
+		"Username": c.Locals("userUsername"),
+	}
+
+	query, opts, invalid := globalSearchRequest(c)
+	if invalid != nil {
+		data["Error"] = invalid["error"]
+		return c.Status(400).Render("search", data)
+	}
+	data["Type"] = opts.Type
+	data["Source"] = opts.Source
+	data["Subverse"] = opts.Subverse
+	data["Offset"] = opts.Offset
+
+	results, err := a.Search.All(query, opts)
+	if err != nil {
+		requestLog(c).Error("Failed to search", "err", err)
+		data["Error"] = "Search failed, please try again"
+		return c.Status(500).Render("search", data)
+	}
+
+	total := 0
+	types := make([]searchTypeFacet, 0, len(repository.SearchTypes))
+	for _, contentType := range repository.SearchTypes {
+		count := results.Facets.Types[contentType]
+		total += count
+		types = append(types, searchTypeFacet{
+			Type:   contentType,
+			Label:  searchTypeLabels[contentType],
+			Count:  count,
+			Active: contentType == opts.Type,
+		})
+	}
+	for i, item := range results.FeedItems {
+		if strings.TrimSpace(item.Snippet) == "" && strings.TrimSpace(item.Description) == "" {
+			results.FeedItems[i].Description = "No description."
+		}
+	}
+
+	data["Results"] = results
+	data["Types"] = types
+	data["Total"] = total
+	if opts.Type != "" && resultCount(results, opts.Type) == opts.Limit {
+		data["NextOffset"] = opts.Offset + opts.Limit
+	}
+	return c.Render("search", data)
+}
+
+// The number of results of one content type on a page of global search results
+func resultCount(results *repository.SearchResults, contentType string) int {
+	switch contentType {
+	case repository.SearchFeedItems:
+		return len(results.FeedItems)
+	case repository.SearchPosts:
+		return len(results.Posts)
+	case repository.SearchComments:
+		return len(results.Comments)
+	case repository.SearchPostComments:
+		return len(results.PostComments)
+	case repository.SearchSubverses:
+		return len(results.Subverses)
+	case repository.SearchUsers:
+		return len(results.Users)
+	}
+	return 0
+}
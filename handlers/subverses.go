@@ -1,16 +1,13 @@
 package handlers
 
 import (
-	"log"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/navid-m/versed/database"
-	"github.com/navid-m/versed/models"
 )
 
 // Handles the creation of a new subverse
-func CreateSubverse(c *fiber.Ctx) error {
+func (a *App) CreateSubverse(c *fiber.Ctx) error {
 	isAdmin := c.Locals("isAdmin").(bool)
 	if !isAdmin {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -18,8 +15,6 @@ func CreateSubverse(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-
 	var req struct {
 		Name string `json:"name"`
 	}
@@ -37,7 +32,7 @@ func CreateSubverse(c *fiber.Ctx) error {
 		})
 	}
 
-	subverse, err := database.CreateSubverse(db, req.Name)
+	subverse, err := a.Subverses.Create(req.Name)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create subverse",
@@ -48,10 +43,8 @@ func CreateSubverse(c *fiber.Ctx) error {
 }
 
 // Handles retrieving all subverses
-func GetSubverses(c *fiber.Ctx) error {
-	db := database.GetDB()
-
-	subverses, err := database.GetSubverses(db)
+func (a *App) GetSubverses(c *fiber.Ctx) error {
+	subverses, err := a.Subverses.List()
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get subverses",
@@ -65,7 +58,7 @@ func GetSubverses(c *fiber.Ctx) error {
 }
 
 // Handles adding a feed to a subverse
-func AddFeedToSubverse(c *fiber.Ctx) error {
+func (a *App) AddFeedToSubverse(c *fiber.Ctx) error {
 	isAdmin := c.Locals("isAdmin").(bool)
 	if !isAdmin {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -96,8 +89,7 @@ func AddFeedToSubverse(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-	err = database.AddFeedToSubverse(db, subverseID, req.FeedSourceID)
+	err = a.Subverses.AddFeed(subverseID, req.FeedSourceID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to add feed to subverse",
@@ -111,7 +103,7 @@ func AddFeedToSubverse(c *fiber.Ctx) error {
 }
 
 // Handles removing a feed from a subverse
-func RemoveFeedFromSubverse(c *fiber.Ctx) error {
+func (a *App) RemoveFeedFromSubverse(c *fiber.Ctx) error {
 	isAdmin := c.Locals("isAdmin").(bool)
 	if !isAdmin {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -133,8 +125,7 @@ func RemoveFeedFromSubverse(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-	err = database.RemoveFeedFromSubverse(db, subverseID, feedSourceID)
+	err = a.Subverses.RemoveFeed(subverseID, feedSourceID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to remove feed from subverse",
@@ -148,7 +139,7 @@ func RemoveFeedFromSubverse(c *fiber.Ctx) error {
 }
 
 // Handles getting all feeds for a subverse
-func GetSubverseFeeds(c *fiber.Ctx) error {
+func (a *App) GetSubverseFeeds(c *fiber.Ctx) error {
 	subverseID, err := c.ParamsInt("subverseId")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -156,8 +147,7 @@ func GetSubverseFeeds(c *fiber.Ctx) error {
 		})
 	}
 
-	db := database.GetDB()
-	feeds, err := database.GetSubverseFeeds(db, subverseID)
+	feeds, err := a.Subverses.Feeds(subverseID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to get subverse feeds",
@@ -171,24 +161,20 @@ func GetSubverseFeeds(c *fiber.Ctx) error {
 }
 
 // Handles viewing a specific subverse page
-func ViewSubverse(c *fiber.Ctx) error {
+func (a *App) ViewSubverse(c *fiber.Ctx) error {
 	subverseName := c.Params("subverseName")
 	if subverseName == "" {
 		return c.Status(fiber.StatusBadRequest).SendString("Subverse name is required")
 	}
 
-	db := database.GetDB()
-
-	var subverse models.Subverse
-	err := db.QueryRow("SELECT id, name, created_at FROM subverses WHERE name = ?", subverseName).Scan(
-		&subverse.ID, &subverse.Name, &subverse.CreatedAt)
+	subverse, err := a.Subverses.ByName(subverseName)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).SendString("Subverse not found")
 	}
 
-	posts, err := database.GetPostsBySubverse(db, subverse.ID, 20, 0)
+	posts, err := a.Posts.ForSubverse(subverse.ID, 20, 0)
 	if err != nil {
-		log.Printf("Failed to get subverse posts: %v", err)
+		requestLog(c).Error("Failed to get subverse posts", "err", err)
 		return c.Status(fiber.StatusInternalServerError).SendString("Failed to get posts")
 	}
 
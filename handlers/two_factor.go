@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+
+	"github.com/navid-m/versed/accounts"
+)
+
+// How long users have to enter a two-factor code after their password
+const twoFactorSignInTimeout = 5 * time.Minute
+
+// Returns the user who entered their password and still has to enter a
+// two-factor code, or false once the time to do so ran out
+func pendingTwoFactorUser(sess *session.Session) (int, bool) {
+	userID, ok := sess.Get("pending_user_id").(int)
+	if !ok {
+		return 0, false
+	}
+	since, ok := sess.Get("pending_since").(int64)
+	if !ok || time.Since(time.Unix(since, 0)) > twoFactorSignInTimeout {
+		return 0, false
+	}
+	return userID, true
+}
+
+// Shows the form for the code of a user who entered their password
+func (a *App) TwoFactorSignInPage(c *fiber.Ctx) error {
+	sess, err := a.Store.Get(c)
+	if err != nil {
+		return c.Redirect("/signin")
+	}
+	if _, ok := pendingTwoFactorUser(sess); !ok {
+		return c.Redirect("/signin")
+	}
+	return c.Render("signin-2fa", fiber.Map{})
+}
+
+// Signs in a user who entered their password once their two-factor or
+// recovery code checks out
+func (a *App) TwoFactorSignIn(c *fiber.Ctx) error {
+	sess, err := a.Store.Get(c)
+	if err != nil {
+		requestLog(c).Error("Failed to get session", "err", err)
+		return c.Status(500).Render("signin-2fa", fiber.Map{"Error": "Session error"})
+	}
+	userID, ok := pendingTwoFactorUser(sess)
+	if !ok {
+		return c.Redirect("/signin")
+	}
+
+	err = a.TwoFactorAuth.Verify(userID, c.FormValue("code"), time.Now())
+	switch {
+	case errors.Is(err, accounts.ErrInvalidCode):
+		requestLog(c).Info("Sign-in failed with wrong two-factor code", "user_id", userID)
+		return c.Status(401).Render("signin-2fa", fiber.Map{"Error": "Invalid code"})
+	case errors.Is(err, accounts.ErrTooManyAttempts):
+		requestLog(c).Warn("Two-factor sign-in rate limited", "user_id", userID)
+		return c.Status(429).Render("signin-2fa", fiber.Map{"Error": "Too many attempts, please try again in a few minutes"})
+	case errors.Is(err, accounts.ErrTwoFactorNotEnabled):
+		// Turned off since the password was entered; start over
+		return c.Redirect("/signin")
+	case err != nil:
+		requestLog(c).Error("Failed to verify two-factor code", "user_id", userID, "err", err)
+		return c.Status(500).Render("signin-2fa", fiber.Map{"Error": "Failed to check code"})
+	}
+
+	user, err := a.Users.ByID(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get user", "user_id", userID, "err", err)
+		return c.Status(500).Render("signin-2fa", fiber.Map{"Error": "Failed to sign in"})
+	}
+	if err := sess.Regenerate(); err != nil {
+		requestLog(c).Error("Failed to rotate session", "user_id", userID, "err", err)
+		return c.Status(500).Render("signin-2fa", fiber.Map{"Error": "Failed to sign in"})
+	}
+	sess.Delete("pending_user_id")
+	sess.Delete("pending_since")
+	sess.Set("user_id", user.ID)
+	sess.Set("user_email", user.Email)
+	sess.Set("user_username", user.Username)
+	if err := sess.Save(); err != nil {
+		requestLog(c).Error("Failed to save session", "user_id", userID, "err", err)
+		return c.Status(500).Render("signin-2fa", fiber.Map{"Error": "Failed to save session"})
+	}
+	return c.Redirect("/")
+}
+
+// Reports whether the signed-in user has two-factor sign-in on
+func (a *App) GetTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	user, err := a.Users.ByID(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get user", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get two-factor status",
+		})
+	}
+	status, err := a.TwoFactorAuth.Status(user)
+	if err != nil {
+		requestLog(c).Error("Failed to get two-factor status", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get two-factor status",
+		})
+	}
+	return c.JSON(status)
+}
+
+// Starts setting up two-factor sign-in, returning the secret to add to an
+// authenticator app
+func (a *App) SetupTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	setup, err := a.TwoFactorAuth.Setup(userID, req.Password)
+	switch {
+	case errors.Is(err, accounts.ErrWrongPassword):
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Incorrect password",
+		})
+	case errors.Is(err, accounts.ErrTwoFactorEnabled):
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	case err != nil:
+		requestLog(c).Error("Failed to set up two-factor", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to set up two-factor authentication",
+		})
+	}
+	return c.JSON(setup)
+}
+
+// Turns on two-factor sign-in once the user enters a code from their app,
+// returning their recovery codes
+func (a *App) EnableTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	codes, err := a.TwoFactorAuth.Enable(userID, req.Code, time.Now())
+	if err != nil {
+		return a.twoFactorError(c, userID, "Failed to enable two-factor authentication", err)
+	}
+	return c.JSON(fiber.Map{
+		"success":        true,
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// Turns off two-factor sign-in once the user's password and a code check out
+func (a *App) DisableTwoFactor(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	err := a.TwoFactorAuth.Disable(userID, req.Password, req.Code, time.Now())
+	if err != nil {
+		return a.twoFactorError(c, userID, "Failed to disable two-factor authentication", err)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// Replaces the signed-in user's recovery codes once a code checks out
+func (a *App) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	codes, err := a.TwoFactorAuth.RegenerateRecoveryCodes(userID, req.Code, time.Now())
+	if err != nil {
+		return a.twoFactorError(c, userID, "Failed to generate recovery codes", err)
+	}
+	return c.JSON(fiber.Map{
+		"success":        true,
+		"recovery_codes": codes,
+	})
+}
+
+// Responds to an error from the two-factor service, logging unexpected ones
+// with message
+func (a *App) twoFactorError(c *fiber.Ctx, userID int, message string, err error) error {
+	switch {
+	case errors.Is(err, accounts.ErrWrongPassword):
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Incorrect password",
+		})
+	case errors.Is(err, accounts.ErrInvalidCode):
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid code",
+		})
+	case errors.Is(err, accounts.ErrTooManyAttempts):
+		return c.Status(429).JSON(fiber.Map{
+			"error": "Too many attempts, please try again in a few minutes",
+		})
+	case errors.Is(err, accounts.ErrTwoFactorEnabled):
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	case errors.Is(err, accounts.ErrTwoFactorNotEnabled):
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Two-factor authentication is not enabled",
+		})
+	case errors.Is(err, accounts.ErrTwoFactorRequired):
+		return c.Status(403).JSON(fiber.Map{
+			"error": "Two-factor authentication is required for admins",
+		})
+	}
+	requestLog(c).Error(message, "user_id", userID, "err", err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// Returns the site settings admins manage
+func (a *App) GetAdminSettings(c *fiber.Ctx) error {
+	required, err := a.TwoFactorAuth.RequiredForAdmins()
+	if err != nil {
+		requestLog(c).Error("Failed to get admin settings", "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get settings",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"require_admin_2fa": required,
+	})
+}
+
+// Changes the site settings admins manage
+func (a *App) UpdateAdminSettings(c *fiber.Ctx) error {
+	adminID := c.Locals("userID").(int)
+
+	var req struct {
+		RequireAdmin2FA *bool `json:"require_admin_2fa"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.RequireAdmin2FA == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "require_admin_2fa is required",
+		})
+	}
+
+	err := a.TwoFactorAuth.SetRequiredForAdmins(adminID, *req.RequireAdmin2FA)
+	if errors.Is(err, accounts.ErrTwoFactorNotEnabled) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Enable two-factor authentication on your own account first",
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to update admin settings", "admin_id", adminID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update settings",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success":           true,
+		"require_admin_2fa": *req.RequireAdmin2FA,
+	})
+}
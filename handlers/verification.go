@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/navid-m/versed/accounts"
+	"github.com/navid-m/versed/repository"
+)
+
+// Turns away users who have not verified their email address while
+// verification is required. Requests without a signed-in user are left for
+// the handler to reject.
+func (a *App) RequireVerifiedEmail(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok || !a.Verifier.Required() {
+		return c.Next()
+	}
+
+	user, err := a.Users.ByID(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get user", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to check email verification",
+		})
+	}
+	if !user.EmailVerified {
+		return c.Status(403).JSON(fiber.Map{
+			"error":                 "Verify your email address to post, comment, vote or get digests",
+			"verification_required": true,
+		})
+	}
+	return c.Next()
+}
+
+// Sends the signed-in user's verification email again
+func (a *App) ResendVerification(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Authentication required",
+		})
+	}
+
+	err := a.Verifier.Resend(userID, time.Now())
+	switch {
+	case errors.Is(err, accounts.ErrAlreadyVerified):
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Your email address is already verified",
+		})
+	case errors.Is(err, accounts.ErrVerificationRateLimited):
+		return c.Status(429).JSON(fiber.Map{
+			"error": "Too many verification emails, please try again later",
+		})
+	case err != nil:
+		requestLog(c).Error("Failed to resend verification email", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to send verification email",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Verification email sent",
+	})
+}
+
+// Follows a link from a verification email
+func (a *App) VerifyEmail(c *fiber.Ctx) error {
+	data := fiber.Map{}
+	if userEmail := c.Locals("userEmail"); userEmail != nil {
+		data["Email"] = userEmail
+	}
+	if userUsername := c.Locals("userUsername"); userUsername != nil {
+		data["Username"] = userUsername
+	}
+
+	userID, err := strconv.Atoi(c.Query("user"))
+	if err != nil {
+		err = accounts.ErrInvalidVerificationLink
+	} else {
+		err = a.Verifier.Confirm(userID, c.Query("email"), c.Query("expires"), c.Query("signature"), time.Now())
+	}
+	switch {
+	case errors.Is(err, repository.ErrEmailTaken):
+		data["Error"] = "Another account has started using this email address."
+		return c.Status(409).Render("verify-email", data)
+	case errors.Is(err, accounts.ErrInvalidVerificationLink):
+		data["Error"] = "This verification link is invalid or has expired."
+		return c.Status(400).Render("verify-email", data)
+	case err != nil:
+		requestLog(c).Error("Failed to verify email", "user_id", userID, "err", err)
+		data["Error"] = "Failed to verify your email address."
+		return c.Status(500).Render("verify-email", data)
+	}
+
+	// The address may have just replaced the one this session was signed in with
+	if signedIn, ok := c.Locals("userID").(int); ok && signedIn == userID {
+		if sess, err := a.Store.Get(c); err == nil {
+			sess.Set("user_email", c.Query("email"))
+			if err := sess.Save(); err != nil {
+				requestLog(c).Error("Failed to save session", "user_id", userID, "err", err)
+			}
+			data["Email"] = c.Query("email")
+		}
+	}
+	data["Verified"] = c.Query("email")
+	return c.Render("verify-email", data)
+}
+
+// Marks a user's email address verified without them following a link
+func (a *App) AdminVerifyUser(c *fiber.Ctx) error {
+	adminID := c.Locals("userID").(int)
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	user, err := a.Users.ByID(userID)
+	if err == nil {
+		err = a.Users.ConfirmEmail(userID, user.Email)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to verify user", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to verify user",
+		})
+	}
+
+	requestLog(c).Info("Admin verified user email", "admin_id", adminID, "user_id", userID)
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Email address verified",
+	})
+}
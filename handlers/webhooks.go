@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/webhooks"
+)
+
+// Request body shared by webhook create and update
+type webhookRequest struct {
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	MatchType  string `json:"match_type"`
+	MatchValue string `json:"match_value"`
+	Enabled    *bool  `json:"enabled,omitempty"`
+}
+
+// Trims and validates a webhook request, returning a user-facing error message
+func (req *webhookRequest) validate() string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.URL = strings.TrimSpace(req.URL)
+	req.MatchType = strings.ToLower(strings.TrimSpace(req.MatchType))
+	req.MatchValue = strings.TrimSpace(req.MatchValue)
+
+	if req.Name == "" || req.URL == "" {
+		return "Name and URL are required"
+	}
+	switch err := webhooks.CheckURL(req.URL); {
+	case errors.Is(err, webhooks.ErrPrivateAddress):
+		return "URL must not point to a loopback, private or link-local address"
+	case errors.Is(err, webhooks.ErrUnresolvableHost):
+		return "URL host could not be resolved"
+	case err != nil:
+		return "URL must be an absolute http or https URL"
+	}
+	if !models.IsValidWebhookMatchType(req.MatchType) {
+		return "Match type must be one of category, source, keyword or tag"
+	}
+	if req.MatchValue == "" {
+		return "Match value is required"
+	}
+	return ""
+}
+
+// Returns all webhooks for the authenticated user
+func (a *App) GetWebhooks(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	hooks, err := a.Webhooks.List(userID)
+	if err != nil {
+		requestLog(c).Error("Failed to get webhooks", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get webhooks",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"webhooks": hooks,
+		"count":    len(hooks),
+	})
+}
+
+// Registers a new webhook; the signing secret is only returned here
+func (a *App) CreateWebhook(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	var req webhookRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	secret, err := webhooks.GenerateSecret()
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to generate webhook secret",
+		})
+	}
+
+	hook, err := a.Webhooks.Create(userID, req.Name, req.URL, secret, req.MatchType, req.MatchValue)
+	if err != nil {
+		requestLog(c).Error("Failed to create webhook", "user_id", userID, "err", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to create webhook",
+		})
+	}
+
+	return c.Status(201).JSON(hook)
+}
+
+// Updates a webhook's endpoint or rule, or enables/disables it
+func (a *App) UpdateWebhook(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	webhookID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+	}
+
+	existing, err := a.Webhooks.ByID(userID, webhookID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Webhook not found",
+		})
+	}
+
+	req := webhookRequest{
+		Name:       existing.Name,
+		URL:        existing.URL,
+		MatchType:  existing.MatchType,
+		MatchValue: existing.MatchValue,
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	enabled := existing.Enabled
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	err = a.Webhooks.Update(userID, webhookID, req.Name, req.URL, req.MatchType, req.MatchValue, enabled)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to update webhook",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Webhook updated successfully",
+	})
+}
+
+// Deletes a webhook and its delivery log
+func (a *App) DeleteWebhook(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	webhookID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+	}
+
+	err = a.Webhooks.Delete(userID, webhookID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Webhook not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// Returns the recent delivery log for a webhook
+func (a *App) GetWebhookDeliveries(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(int)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "Unauthorized",
+		})
+	}
+
+	webhookID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "Invalid webhook ID",
+		})
+	}
+
+	if _, err := a.Webhooks.ByID(userID, webhookID); err != nil {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "Webhook not found",
+		})
+	}
+
+	limit := min(c.QueryInt("limit", 50), 200)
+	deliveries, err := a.Webhooks.Deliveries(webhookID, limit)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{
+			"error": "Failed to get webhook deliveries",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"deliveries": deliveries,
+		"count":      len(deliveries),
+	})
+}
@@ -0,0 +1,113 @@
+// Package logging sets up the structured, leveled logger that the rest of
+// Versed writes to through per-subsystem loggers.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Configures the log output
+type Config struct {
+	// One of debug, info, warn or error
+	Level string
+	// text for human-readable lines, json for one JSON object per line
+	Format string
+}
+
+// The handler records go to once Setup has run; slog's default until then
+var root atomic.Pointer[slog.Handler]
+
+// Parses a level name such as "debug" or "warn"
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", name)
+	}
+	return level, nil
+}
+
+// Creates a handler writing to w as configured
+func NewHandler(w io.Writer, cfg Config) (slog.Handler, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+}
+
+// Sends every log record, including those written with the standard log
+// package, to w as configured
+func Setup(w io.Writer, cfg Config) error {
+	h, err := NewHandler(w, cfg)
+	if err != nil {
+		return err
+	}
+	root.Store(&h)
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// Returns the logger for a subsystem such as "scheduler" or "db". Every
+// record it writes carries the subsystem's name.
+//
+// The logger can be created before Setup runs, e.g. in a package variable,
+// and still follows the configuration.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&handler{attrs: []slog.Attr{slog.String("subsystem", subsystem)}})
+}
+
+// Passes records on to whichever handler is current when they are written
+type handler struct {
+	attrs []slog.Attr
+	group string
+}
+
+func current() slog.Handler {
+	if h := root.Load(); h != nil {
+		return *h
+	}
+	return slog.Default().Handler()
+}
+
+func (h *handler) resolve() slog.Handler {
+	target := current().WithAttrs(h.attrs)
+	if h.group != "" {
+		target = target.WithGroup(h.group)
+	}
+	return target
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return current().Enabled(ctx, level)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.resolve().Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if h.group != "" {
+		return h.resolve().WithAttrs(attrs)
+	}
+	return &handler{attrs: append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if h.group != "" {
+		return h.resolve().WithGroup(name)
+	}
+	return &handler{attrs: h.attrs, group: name}
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestForFollowsSetup(t *testing.T) {
+	t.Cleanup(func() { Setup(os.Stderr, Config{Level: "info", Format: "text"}) })
+
+	// Created before Setup, like a package-level logger
+	logger := For("feeds").With("source_id", 7)
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, Config{Level: "info", Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+	logger.Debug("Fetched feed")
+	logger.Info("Updated feed", "new", 3)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want only the info one:\n%s", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	want := map[string]any{"level": "INFO", "msg": "Updated feed", "subsystem": "feeds", "source_id": 7.0, "new": 3.0}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s = %v, want %v", key, record[key], value)
+		}
+	}
+}
+
+func TestSetupText(t *testing.T) {
+	t.Cleanup(func() { Setup(os.Stderr, Config{Level: "info", Format: "text"}) })
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, Config{Level: "debug", Format: "text"}); err != nil {
+		t.Fatal(err)
+	}
+	For("db").WithGroup("query").Debug("Ran query", "rows", 2)
+
+	out := buf.String()
+	for _, want := range []string{"level=DEBUG", `msg="Ran query"`, "subsystem=db", "query.rows=2"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log line %q does not contain %q", out, want)
+		}
+	}
+}
+
+func TestSetupErrors(t *testing.T) {
+	if err := Setup(&bytes.Buffer{}, Config{Level: "loud", Format: "text"}); err == nil {
+		t.Error("Setup accepted an unknown level")
+	}
+	if err := Setup(&bytes.Buffer{}, Config{Level: "info", Format: "xml"}); err == nil {
+		t.Error("Setup accepted an unknown format")
+	}
+}
@@ -0,0 +1,158 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTP settings used to send outgoing mail
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// An outgoing email with optional plain-text and HTML bodies
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Sends mail over SMTP
+type Mailer struct {
+	cfg Config
+}
+
+// Creates a new mailer
+func New(cfg Config) *Mailer {
+	return &Mailer{cfg: cfg}
+}
+
+// Reports whether an SMTP host has been configured
+func (m *Mailer) Enabled() bool {
+	return m != nil && m.cfg.Host != ""
+}
+
+// Sends a message, using PLAIN auth when credentials are configured
+func (m *Mailer) Send(msg Message) error {
+	if !m.Enabled() {
+		return fmt.Errorf("mailer is not configured")
+	}
+	if msg.To == "" {
+		return fmt.Errorf("message has no recipient")
+	}
+
+	body, err := m.build(msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, m.cfg.Port)
+	if err := smtp.SendMail(addr, auth, envelopeAddress(m.cfg.From), []string{msg.To}, body); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// Builds the RFC 5322 message, using multipart/alternative when both bodies are set
+func (m *Mailer) build(msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	writeHeader := func(key, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+	writeHeader("From", m.cfg.From)
+	writeHeader("To", msg.To)
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", messageID(m.cfg.From))
+	writeHeader("MIME-Version", "1.0")
+	for key, value := range msg.Headers {
+		writeHeader(key, value)
+	}
+
+	switch {
+	case msg.Text != "" && msg.HTML != "":
+		boundary := randomToken()
+		writeHeader("Content-Type", fmt.Sprintf(`multipart/alternative; boundary="%s"`, boundary))
+		buf.WriteString("\r\n")
+		for _, part := range []struct{ contentType, content string }{
+			{"text/plain; charset=utf-8", msg.Text},
+			{"text/html; charset=utf-8", msg.HTML},
+		} {
+			fmt.Fprintf(&buf, "--%s\r\n", boundary)
+			if err := writeBody(&buf, part.contentType, part.content); err != nil {
+				return nil, err
+			}
+		}
+		fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	case msg.HTML != "":
+		if err := writeBody(&buf, "text/html; charset=utf-8", msg.HTML); err != nil {
+			return nil, err
+		}
+	default:
+		if err := writeBody(&buf, "text/plain; charset=utf-8", msg.Text); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Writes a quoted-printable body part with its content headers
+func writeBody(buf *bytes.Buffer, contentType, content string) error {
+	fmt.Fprintf(buf, "Content-Type: %s\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(buf)
+	if _, err := w.Write([]byte(content)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	buf.WriteString("\r\n")
+	return nil
+}
+
+// Extracts the bare address from a "Name <addr>" From value
+func envelopeAddress(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		if end := strings.LastIndex(from, ">"); end > start {
+			return from[start+1 : end]
+		}
+	}
+	return from
+}
+
+// Builds a unique Message-ID in the sender's domain
+func messageID(from string) string {
+	domain := "versed.local"
+	if at := strings.LastIndex(envelopeAddress(from), "@"); at >= 0 {
+		domain = envelopeAddress(from)[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", randomToken(), domain)
+}
+
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,83 @@
+package mailer_test
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/mailer/mailertest"
+)
+
+func TestSendMultipart(t *testing.T) {
+	server := mailertest.NewServer(t)
+	m := mailer.New(server.Config())
+
+	err := m.Send(mailer.Message{
+		To:      "reader@example.com",
+		Subject: "Your daily digest",
+		Text:    "plain body",
+		HTML:    "<p>html body</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://versed.test/u>"},
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msgs := server.WaitFor(1, 2*time.Second)
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	if msgs[0].From != "no-reply@versed.test" {
+		t.Errorf("envelope from = %q", msgs[0].From)
+	}
+	if len(msgs[0].To) != 1 || msgs[0].To[0] != "reader@example.com" {
+		t.Errorf("envelope to = %v", msgs[0].To)
+	}
+
+	parsed, err := msgs[0].Parse()
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := parsed.Header.Get("List-Unsubscribe"); got != "<https://versed.test/u>" {
+		t.Errorf("List-Unsubscribe = %q", got)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Your daily digest" {
+		t.Errorf("subject = %q", subject)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, %v", mediaType, err)
+	}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	var bodies []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		bodies = append(bodies, part.Header.Get("Content-Type")+": "+strings.TrimSpace(string(body)))
+	}
+	want := []string{
+		"text/plain; charset=utf-8: plain body",
+		"text/html; charset=utf-8: <p>html body</p>",
+	}
+	if strings.Join(bodies, "\n") != strings.Join(want, "\n") {
+		t.Errorf("parts = %q, want %q", bodies, want)
+	}
+}
+
+func TestSendRequiresConfig(t *testing.T) {
+	if err := mailer.New(mailer.Config{}).Send(mailer.Message{To: "a@example.com"}); err == nil {
+		t.Fatal("expected error from unconfigured mailer")
+	}
+}
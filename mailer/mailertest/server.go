@@ -0,0 +1,168 @@
+// Package mailertest provides a local SMTP stand-in for tests, in the spirit
+// of net/http/httptest.
+package mailertest
+
+import (
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/mailer"
+)
+
+// A message received by the stand-in server
+type Message struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Parses the raw message data
+func (m Message) Parse() (*mail.Message, error) {
+	return mail.ReadMessage(strings.NewReader(m.Data))
+}
+
+// A minimal SMTP server that accepts every message and records it
+type Server struct {
+	Addr string
+
+	listener net.Listener
+	mu       sync.Mutex
+	messages []Message
+	received chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Starts a server on a random local port and stops it when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("mailertest: failed to listen: %v", err)
+	}
+
+	s := &Server{
+		Addr:     listener.Addr().String(),
+		listener: listener,
+		received: make(chan struct{}, 64),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Returns a mailer config pointing at the server
+func (s *Server) Config() mailer.Config {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	return mailer.Config{Host: host, Port: port, From: "Versed <no-reply@versed.test>"}
+}
+
+// Returns a copy of every message received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Waits until at least n messages have been received or the timeout elapses
+func (s *Server) WaitFor(n int, timeout time.Duration) []Message {
+	deadline := time.After(timeout)
+	for {
+		if msgs := s.Messages(); len(msgs) >= n {
+			return msgs
+		}
+		select {
+		case <-s.received:
+		case <-deadline:
+			return s.Messages()
+		}
+	}
+}
+
+// Stops accepting connections
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// Speaks just enough SMTP for net/smtp.SendMail
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 mailertest ESMTP")
+
+	var current Message
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-mailertest")
+			tp.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			current = Message{From: addressArg(line)}
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			current.To = append(current.To, addressArg(line))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			current.Data = strings.Join(lines, "\r\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			select {
+			case s.received <- struct{}{}:
+			default:
+			}
+			tp.PrintfLine("250 OK")
+		case "RSET":
+			current = Message{}
+			tp.PrintfLine("250 OK")
+		case "NOOP":
+			tp.PrintfLine("250 OK")
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// Extracts the address from "MAIL FROM:<addr>" or "RCPT TO:<addr>"
+func addressArg(line string) string {
+	start := strings.Index(line, "<")
+	end := strings.LastIndex(line, ">")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return line[start+1 : end]
+}
@@ -7,926 +7,240 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/gofiber/template/django/v3"
 
+	"github.com/navid-m/versed/accounts"
 	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/digest"
+	"github.com/navid-m/versed/exports"
 	"github.com/navid-m/versed/feeds"
 	"github.com/navid-m/versed/handlers"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/mailer"
+	"github.com/navid-m/versed/newsletters"
+	"github.com/navid-m/versed/webhooks"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func main() {
-	if err := database.InitDatabase(); err != nil {
-		log.Fatal("Failed to initialize database:", err)
-	}
-	err := feeds.ResetAllFeedTimestamps(database.GetDB())
-	if err != nil {
-		log.Printf("Warning: Failed to reset feed timestamps: %v", err)
-	}
-	feeds.DebugFeeds(database.GetDB())
-
-	var (
-		customStorage = database.NewDBSessionStorage(database.GetDB())
-		store         = session.New(session.Config{
-			Storage:    customStorage,
-			KeyLookup:  "cookie:session_id",
-			Expiration: 24 * time.Hour,
-		})
-		viewsPath, _ = filepath.Abs("./views")
-		engine       = django.New(viewsPath, ".html")
-		app          = fiber.New(fiber.Config{Views: engine})
-		scheduler    = NewFeedScheduler(database.GetDB())
-	)
-
-	scheduler.Start()
-	defer scheduler.Stop()
-
-	app.Use(func(c *fiber.Ctx) error {
-		sess, err := store.Get(c)
-		if err == nil {
-			userID := sess.Get("user_id")
-			userEmail := sess.Get("user_email")
-			userUsername := sess.Get("user_username")
-			if userID != nil && userEmail != nil {
-				c.Locals("userID", userID)
-				c.Locals("userEmail", userEmail)
-				c.Locals("userUsername", userUsername)
-			}
-		}
-		return c.Next()
-	})
-
-	app.Use(func(c *fiber.Ctx) error {
-		clientIP := c.IP()
-
-		isBanned, err := database.IsIPBanned(clientIP)
-		if err != nil {
-			log.Printf("Error checking IP ban status for %s: %v", clientIP, err)
-			return c.Next()
-		}
-
-		if isBanned {
-			log.Printf("Blocked access from banned IP: %s", clientIP)
-			return c.Status(403).SendString("Access denied. Your IP address has been banned.")
-		}
-		return c.Next()
-	})
-
-	app.Use("/static", func(c *fiber.Ctx) error {
-		path := c.Path()
-		if strings.HasPrefix(path, "/static/js/admin") ||
-			strings.HasPrefix(path, "/static/css/admin") ||
-			strings.Contains(path, "/admin/") {
-
-			userID := c.Locals("userID")
-			if userID == nil {
-				return c.Status(404).SendString("Cannot GET /static/js/")
-			}
-
-			isAdmin, err := database.IsUserAdmin(userID.(int))
-			if err != nil {
-				log.Printf("Error checking admin status for user %v: %v", userID, err)
-				return c.Status(404).SendString("Cannot GET /static/js/")
-			}
-
-			if !isAdmin {
-				return c.Status(404).SendString("Cannot GET /static/js/")
-			}
-		}
-
-		return c.Next()
-	})
-
-	app.Static("/static", "./static")
-
-	app.Get("/", func(c *fiber.Ctx) error {
-		return handlers.IndexHandler(c)
-	})
-
-	app.Get("/signin", func(c *fiber.Ctx) error {
-		return c.Render("signin", fiber.Map{})
-	})
-
-	app.Get("/signup", func(c *fiber.Ctx) error {
-		return c.Render("signup", fiber.Map{})
-	})
-
-	app.Get("/about", func(c *fiber.Ctx) error {
-		return handlers.AboutHandler(c)
-	})
-
-	app.Post("/signup", func(c *fiber.Ctx) error {
-		return handlers.SignUpHandler(c, store)
-	})
-
-	app.Post("/signin", func(c *fiber.Ctx) error {
-		return handlers.SignInHandler(c, store)
-	})
-
-	app.Get("/signout", func(c *fiber.Ctx) error {
-		return handlers.SignOutHandler(store, c)
-	})
-
-	app.Get("/api/feeds", func(c *fiber.Ctx) error {
-		return handlers.FeedsHandler(c)
-	})
-
-	app.Get("/api/feeds/:source", func(c *fiber.Ctx) error {
-		return handlers.FeedSourceHandler(c)
-	})
-
-	app.Get("/api/search", handlers.SearchFeedItems)
-
-	app.Post("/api/vote", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		var voteRequest struct {
-			FeedID   string `json:"feed_id"`
-			VoteType string `json:"vote_type"`
-		}
-
-		if err := c.BodyParser(&voteRequest); err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid request body",
-			})
-		}
-
-		newScore, err := feeds.HandleVote(database.GetDB(), voteRequest.FeedID, int(userID), voteRequest.VoteType)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"new_score": newScore,
-		})
-	})
-
-	app.Post("/api/reading-list/save", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		var saveRequest struct {
-			ItemID string `json:"item_id"`
-		}
-
-		if err := c.BodyParser(&saveRequest); err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid request body",
-			})
-		}
-
-		saved, err := database.SaveToReadingList(userID, saveRequest.ItemID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to save item to reading list",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"success": true,
-			"saved":   saved,
-		})
-	})
-
-	app.Post("/api/reading-list/remove", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		var removeRequest struct {
-			ItemID string `json:"item_id"`
-		}
-
-		if err := c.BodyParser(&removeRequest); err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid request body",
-			})
-		}
+// How long in-flight requests get to finish after a shutdown signal
+const shutdownTimeout = 10 * time.Second
 
-		err = database.RemoveFromReadingList(userID, removeRequest.ItemID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to remove item from reading list",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"success": true,
-			"removed": true,
-		})
-	})
-
-	app.Post("/api/posts/:itemId/hide", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		itemID := c.Params("itemId")
-		if itemID == "" {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Item ID is required",
-			})
-		}
-
-		err := database.HideFeedItem(userID, itemID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to hide post",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"success": true,
-			"message": "Post hidden successfully",
-		})
-	})
-
-	app.Post("/api/posts/:itemId/unhide", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		itemID := c.Params("itemId")
-		if itemID == "" {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Item ID is required",
-			})
-		}
-
-		err := database.UnhideFeedItem(userID, itemID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to unhide post",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"success": true,
-			"message": "Post unhidden successfully",
-		})
-	})
-
-	app.Get("/api/posts/:itemId/hidden", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		itemID := c.Params("itemId")
-		if itemID == "" {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Item ID is required",
-			})
-		}
-
-		hidden, err := database.IsFeedItemHidden(userID, itemID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to check if post is hidden",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"hidden": hidden,
-		})
-	})
-
-	app.Get("/api/posts/hidden", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
+const serveUsage = `usage: versed serve [-tls] [-no-scheduler]
 
-		itemIDs, err := database.GetHiddenFeedItems(userID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to get hidden posts",
-			})
-		}
-
-		var hiddenItems []feeds.FeedItem
-		for _, itemID := range itemIDs {
-			var item feeds.FeedItem
-			var sourceName string
-			err := database.GetDB().QueryRow(database.FeedItemsQueryVariation, itemID).Scan(
-				&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
-				&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &sourceName)
-			if err != nil {
-				continue
-			}
-			item.SourceName = sourceName
-			hiddenItems = append(hiddenItems, item)
-		}
-
-		return c.JSON(fiber.Map{
-			"hiddenItems": hiddenItems,
-			"count":       len(hiddenItems),
-		})
-	})
-
-	app.Get("/reading-list", func(c *fiber.Ctx) error {
-		userEmail := c.Locals("userEmail")
-		userUsername := c.Locals("userUsername")
-		if userEmail == nil {
-			return c.Redirect("/signin")
-		}
-
-		userID := c.Locals("userID").(int)
-		rows, err := database.RetrieveReadingList(userID)
-		if err != nil {
-			log.Printf("Failed to get reading list: %v", err)
-		}
-		defer rows.Close()
-
-		var feedItems []feeds.FeedItem
-		for rows.Next() {
-			var item feeds.FeedItem
-			var sourceName string
-			err := rows.Scan(&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
-				&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &sourceName)
-			if err != nil {
-				log.Printf("Failed to scan reading list item: %v", err)
-			}
-			if strings.TrimSpace(item.Description) == "" {
-				item.Description = "No description."
-			}
-			item.SourceName = sourceName
-			feedItems = append(feedItems, item)
-		}
-
-		data := fiber.Map{
-			"FeedItems": feedItems,
-			"Email":     userEmail,
-			"Username":  userUsername,
-		}
-
-		return c.Render("reading-list", data)
-	})
-
-	app.Get("/api/reading-list", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		rows, err := database.RetrieveReadingList(userID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to retrieve reading list",
-			})
-		}
-		defer rows.Close()
-
-		var items []feeds.FeedItem
-		for rows.Next() {
-			var item feeds.FeedItem
-			var sourceName string
-
-			err := rows.Scan(
-				&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
-				&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &sourceName,
-			)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"error": "Failed to scan reading list item",
-				})
-			}
-			item.SourceName = sourceName
-			items = append(items, item)
-		}
-
-		return c.JSON(fiber.Map{
-			"items": items,
-			"count": len(items),
-		})
-	})
-
-	app.Get("/api/reading-list/check/:itemId", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.Status(401).JSON(fiber.Map{
-				"error": "Unauthorized",
-			})
-		}
-
-		itemID := c.Params("itemId")
-		saved, err := database.IsInReadingList(userID, itemID)
-		if err != nil {
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to check reading list status",
-			})
-		}
-
-		return c.JSON(fiber.Map{
-			"saved": saved,
-		})
-	})
+Runs the web server along with the background workers: the feed scheduler,
+webhook deliveries, digests, inbound newsletters, data exports and account
+deletions.
 
-	app.Get("/u/:username/c/:categoryName", func(c *fiber.Ctx) error {
-		username := c.Params("username")
-		categoryName := c.Params("categoryName")
+  -tls           serve HTTPS, with the versed.cc certificates unless
+                 server.tls.cert_file and key_file are set
+  -no-scheduler  leave feed updates and snapshots to a separate versed worker`
 
-		log.Printf("=== URL Route Handler: /u/%s/c/%s ===", username, categoryName)
+var serverLog = logging.For("server")
 
-		userEmail := c.Locals("userEmail")
-		userUsername := c.Locals("userUsername")
-
-		log.Printf("User info - Email: %v, Username: %v", userEmail, userUsername)
-
-		if userEmail == nil {
-			return c.Redirect("/signin")
-		}
-
-		userID := c.Locals("userID").(int)
-		db := database.GetDB()
-
-		log.Printf("UserID: %d", userID)
-
-		categoryName = strings.TrimSpace(categoryName)
-		categoryName = strings.ReplaceAll(categoryName, "-", " ")
-
-		var categoryID int
-		err := db.QueryRow(database.CategoryQueryVariation, userID, categoryName).Scan(&categoryID)
-		if err != nil {
-			log.Printf("Category not found: %v (user_id=%d, name='%s')", err, userID, categoryName)
-			return c.Status(404).SendString("Category not found")
-		}
-
-		log.Printf("Found category ID: %d", categoryID)
-
-		feedRows, err := db.Query(database.FeedsQuery, userID, categoryID)
-		feedCount := 0
-		if err != nil {
-			log.Printf("Failed to get category feeds: %v", err)
-		} else {
-			log.Printf("Checking feeds associated with category...")
-			for feedRows.Next() {
-				var feedID int
-				var feedName, feedURL string
-				var lastUpdated time.Time
-				err := feedRows.Scan(&feedID, &feedName, &feedURL, &lastUpdated)
-				if err != nil {
-					log.Printf("Feed row scan error: %v", err)
-					continue
-				}
-				feedCount++
-				log.Printf("Feed %d: %s (%s) - Last updated: %v", feedID, feedName, feedURL, lastUpdated)
-			}
-			feedRows.Close()
-		}
-		log.Printf("Total feeds in category: %d", feedCount)
-
-		rows, err := db.Query(database.PostFeedNextQuery, userID, categoryID)
-		if err != nil {
-			log.Printf("Database query error: %v", err)
-		} else {
-			log.Printf("Database query executed successfully")
-		}
-		defer func() {
-			if rows != nil {
-				rows.Close()
-			}
-		}()
-
-		var items []feeds.FeedItem
-		if rows != nil {
-			for rows.Next() {
-				var item feeds.FeedItem
-				var sourceName string
-				err := rows.Scan(&item.ID, &item.SourceID, &item.Title, &item.URL, &item.Description,
-					&item.Author, &item.PublishedAt, &item.Score, &item.CommentsCount, &item.CreatedAt, &sourceName)
-				if err != nil {
-					log.Printf("Row scan error: %v", err)
-					continue
-				}
-				item.SourceName = sourceName
-				items = append(items, item)
-			}
-		}
-
-		log.Printf("Found %d feed items for category", len(items))
-		if len(items) > 0 {
-			log.Printf("Sample item: %s", items[0].Title)
-		}
-
-		if feedCount > 0 && len(items) == 0 {
-			log.Printf("No feed items found, triggering feed processing for category feeds...")
-
-			result, err := db.Exec(database.ResetQuery, userID, categoryID)
-			if err != nil {
-				log.Printf("Failed to reset feed timestamps: %v", err)
-			} else {
-				rowsAffected, _ := result.RowsAffected()
-				log.Printf("Reset timestamps for %d feeds in category", rowsAffected)
-				if rowsAffected > 0 {
-					log.Printf("Attempting immediate feed processing...")
-					var feedList []struct {
-						id   int
-						name string
-						url  string
-					}
-
-					feedRows, err := db.Query(database.SurpFeedsQuery, userID, categoryID)
-					if err != nil {
-						log.Printf("Failed to get category feeds: %v", err)
-					} else {
-						for feedRows.Next() {
-							var feed struct {
-								id   int
-								name string
-								url  string
-							}
-							err := feedRows.Scan(&feed.id, &feed.name, &feed.url)
-							if err != nil {
-								log.Printf("Feed row scan error: %v", err)
-								continue
-							}
-							feedList = append(feedList, feed)
-						}
-						feedRows.Close()
-					}
-
-					for _, feed := range feedList {
-						log.Printf("Processing feed: %s (%s)", feed.name, feed.url)
-
-						source := feeds.FeedSource{
-							ID:             feed.id,
-							Name:           feed.name,
-							URL:            feed.url,
-							LastUpdated:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
-							UpdateInterval: 3600,
-						}
-
-						if feeds.ShouldUpdateFeed(source) {
-							log.Printf("Feed needs update, fetching...")
-
-							content, err := feeds.FetchFeed(feed.url)
-							if err != nil {
-								log.Printf("Failed to fetch feed %s: %v", feed.url, err)
-								continue
-							}
-
-							parsedItems, err := feeds.ParseFeedWithParser(content, feed.id, feed.name)
-							if err != nil {
-								log.Printf("Failed to parse feed %s: %v", feed.url, err)
-								continue
-							}
-
-							log.Printf("Parsed %d items from feed %s", len(parsedItems), feed.name)
-							if len(parsedItems) > 0 {
-								err = feeds.SaveFeedItems(db, parsedItems)
-								if err != nil {
-									log.Printf("Failed to save feed items for %s: %v", feed.name, err)
-									continue
-								}
-								err = feeds.UpdateFeedSourceTimestamp(db, feed.id)
-								if err != nil {
-									log.Printf("Failed to update timestamp for feed %s: %v", feed.name, err)
-								} else {
-									log.Printf("Successfully processed and saved %d items for feed %s", len(parsedItems), feed.name)
-								}
-							}
-						}
-					}
-				}
-			}
-		}
-
-		for i, item := range items {
-			if strings.TrimSpace(item.Description) == "" {
-				items[i].Description = "No description."
-			}
-			if strings.TrimSpace(item.Description) == "Comments" {
-				items[i].Description = "No description."
-			}
-		}
-
-		data := fiber.Map{
-			"FeedItems":    items,
-			"CategoryName": categoryName,
-			"Username":     username,
-		}
-
-		data["Email"] = userEmail
-		if userUsername != nil {
-			data["Username"] = userUsername
-		}
-
-		log.Printf("Rendering template with %d items, category: %s", len(items), categoryName)
-		return c.Render("index", data)
-	})
-
-	app.Get("/api/categories", handlers.GetUserCategories)
-	app.Post("/api/categories", handlers.CreateUserCategory)
-	app.Put("/api/categories/:id", handlers.UpdateUserCategory)
-	app.Delete("/api/categories/:id", handlers.DeleteUserCategory)
-	app.Get("/api/categories/:id/feeds", handlers.GetCategoryFeeds)
-	app.Get("/api/categories/:id/items", handlers.GetCategoryFeedItems)
-	app.Post("/api/categories/:id/feeds", handlers.AddFeedToCategory)
-	app.Delete("/api/categories/:categoryId/feeds/:feedId", handlers.RemoveFeedFromCategory)
-	app.Post("/api/categories/:id/feeds/create", handlers.CreateAndAddFeedToCategory)
-
-	app.Get("/api/graph", func(c *fiber.Ctx) error {
-		return handlers.GraphHandler(c)
-	})
-
-	app.Get("/post/:itemId", func(c *fiber.Ctx) error {
-		return handlers.PostItemHandler(c)
-	})
-
-	app.Get("/api/posts/:itemId", handlers.GetPostView)
-	app.Get("/api/posts/:itemId/comments", handlers.GetComments)
-	app.Post("/api/posts/:itemId/comments", handlers.CreateComment)
-	app.Get("/api/comments/:commentId", handlers.GetComment)
-	app.Put("/api/comments/:commentId", handlers.UpdateComment)
-	app.Delete("/api/comments/:commentId", handlers.DeleteComment)
-
-	app.Get("/profile", func(c *fiber.Ctx) error {
-		userID := c.Locals("userID")
-		userEmail := c.Locals("userEmail")
-		userUsername := c.Locals("userUsername")
-
-		if userID == nil || userEmail == nil {
-			return c.Redirect("/signin")
-		}
-
-		data := fiber.Map{
-			"Email":    userEmail,
-			"Username": userUsername,
-		}
-
-		return c.Render("profile", data)
-	})
-
-	app.Get("/graph", func(c *fiber.Ctx) error {
-		userEmail := c.Locals("userEmail")
-		userUsername := c.Locals("userUsername")
-
-		if userEmail == nil {
-			return c.Redirect("/signin")
-		}
-
-		data := fiber.Map{
-			"Email":    userEmail,
-			"Username": userUsername,
-		}
-
-		return c.Render("graph", data)
-	})
-
-	app.Post("/profile/update", func(c *fiber.Ctx) error {
-		userID := c.Locals("userID")
-		if userID == nil {
-			return c.Redirect("/signin")
-		}
-
-		var (
-			email           = c.FormValue("email")
-			username        = c.FormValue("username")
-			currentPassword = c.FormValue("current_password")
-			newPassword     = c.FormValue("new_password")
-			confirmPassword = c.FormValue("confirm_password")
-		)
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
 
-		if email == "" || username == "" || currentPassword == "" {
-			return c.Status(400).SendString("Email, username, and current password are required")
-		}
-		user, err := database.GetUserByEmail(c.Locals("userEmail").(string))
-		if err != nil || user.Password != currentPassword {
-			return c.Status(401).SendString("Invalid current password")
-		}
-		password := user.Password
-		if newPassword != "" {
-			if newPassword != confirmPassword {
-				return c.Status(400).SendString("New passwords do not match")
-			}
-			password = newPassword
-		}
-		err = database.UpdateUser(userID.(int), email, username, password)
-		if err != nil {
-			return c.Status(500).SendString("Failed to update profile")
-		}
-		sess, err := store.Get(c)
+// Runs `versed serve ...` and returns the process exit code
+func runServeCommand(args []string) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, serveUsage) }
+	useTLS := flags.Bool("tls", false, "serve HTTPS")
+	noScheduler := flags.Bool("no-scheduler", false, "do not run the feed scheduler")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
 		if err == nil {
-			sess.Set("user_email", email)
-			sess.Set("user_username", username)
-			sess.Save()
-		}
-
-		return c.Redirect("/profile?success=1")
-	})
-
-	adminMiddleware := func(c *fiber.Ctx) error {
-		userID := c.Locals("userID")
-		if userID == nil {
-			return c.Status(401).Redirect("/signin")
+			flags.Usage()
 		}
-
-		isAdmin, err := database.IsUserAdmin(userID.(int))
-		if err != nil {
-			log.Printf("Error checking admin status for user %v: %v", userID, err)
-			return c.Status(500).SendString("Internal server error")
-		}
-
-		if !isAdmin {
-			return c.Status(403).SendString("Access denied. Admin privileges required.")
-		}
-
-		c.Locals("isAdmin", isAdmin)
-		return c.Next()
+		return 2
 	}
 
-	app.Get("/admin", adminMiddleware, func(c *fiber.Ctx) error {
-		userEmail := c.Locals("userEmail")
-		userUsername := c.Locals("userUsername")
-
-		data := fiber.Map{}
-		if userEmail != nil {
-			data["Email"] = userEmail
-		}
-		if userUsername != nil {
-			data["Username"] = userUsername
-		}
-
-		return c.Render("admin", data)
-	})
-
-	app.Get("/api/admin/users", adminMiddleware, func(c *fiber.Ctx) error {
-		users, err := database.GetAllUsers()
-		if err != nil {
-			log.Printf("Error getting users: %v", err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to retrieve users",
-			})
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *useTLS {
+		cfg.Server.TLS.Enabled = true
+		if cfg.Server.TLS.CertFile == "" && cfg.Server.TLS.KeyFile == "" {
+			cfg.Server.TLS.CertFile = "/etc/letsencrypt/live/versed.cc/fullchain.pem"
+			cfg.Server.TLS.KeyFile = "/etc/letsencrypt/live/versed.cc/privkey.pem"
 		}
+	}
+	if cfg.Path != "" {
+		serverLog.Info("Loaded configuration", "path", cfg.Path)
+	}
+	serverLog.Info("Effective configuration", "config", cfg)
 
-		return c.JSON(fiber.Map{
-			"users": users,
-		})
-	})
-
-	app.Get("/api/admin/banned-ips", adminMiddleware, func(c *fiber.Ctx) error {
-		bannedIPs, err := database.GetAllBannedIPs()
-		if err != nil {
-			log.Printf("Error getting banned IPs: %v", err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to retrieve banned IPs",
-			})
-		}
+	if err := database.InitDatabase(cfg.Database.URL); err != nil {
+		serverLog.Error("Failed to initialize database", "err", err)
+		return 1
+	}
+	if err := feeds.ResetAllFeedTimestamps(database.GetDB()); err != nil {
+		serverLog.Warn("Failed to reset feed timestamps", "err", err)
+	}
+	feeds.DebugFeeds(database.GetDB())
 
-		return c.JSON(fiber.Map{
-			"bannedIPs": bannedIPs,
+	var (
+		repos = database.NewRepositories(database.GetDB())
+		store = session.New(session.Config{
+			Storage:    repos.Sessions,
+			KeyLookup:  "cookie:session_id",
+			Expiration: time.Duration(cfg.Session.Expiration),
 		})
-	})
-
-	app.Post("/api/admin/ban-ip", adminMiddleware, func(c *fiber.Ctx) error {
-		userID := c.Locals("userID").(int)
-
-		var banRequest struct {
-			IPAddress string `json:"ipAddress"`
-			Reason    string `json:"reason"`
-		}
-
-		if err := c.BodyParser(&banRequest); err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid request body",
-			})
-		}
-
-		if banRequest.IPAddress == "" {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "IP address is required",
-			})
-		}
-
-		err := database.BanIP(banRequest.IPAddress, banRequest.Reason, userID)
-		if err != nil {
-			log.Printf("Error banning IP %s: %v", banRequest.IPAddress, err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to ban IP address",
-			})
-		}
+		viewsPath, _ = filepath.Abs(cfg.Server.ViewsDir)
+		engine       = django.New(viewsPath, ".html")
+		app          = fiber.New(fiber.Config{Views: engine, DisableStartupMessage: cfg.Log.Format == "json"})
+		dispatcher   = webhooks.NewDispatcher(database.GetDB())
+		scheduler    = NewFeedScheduler(database.GetDB(), dispatcher, time.Duration(cfg.Scheduler.Interval))
+		mail         = mailer.New(cfg.MailerConfig())
+		digests      = digest.NewService(database.GetDB(), engine, mail, cfg.Server.BaseURL)
+		inbound      = newsletters.NewService(database.GetDB(), dispatcher, cfg.NewslettersConfig())
+		exporter     = exports.NewService(repos.Users, repos.DataExports, mail, cfg.ExportsConfig())
+		deleter      = accounts.NewService(repos.Users, repos.AccountDeletions, mail, exporter, cfg.AccountsConfig())
+		resets       = accounts.NewPasswordResets(repos.Users, repos.Sessions, repos.APITokens, repos.ResetTokens, engine, mail, cfg.Server.BaseURL)
+		verifier     = accounts.NewVerifier(repos.Users, engine, mail, cfg.AccountsConfig())
+		settings     = accounts.NewSettings(repos.Users, repos.Sessions, repos.APITokens, verifier)
+		twoFactor    = accounts.NewTwoFactor(repos.TwoFactor, repos.Users, "Versed")
+		tokens       = accounts.NewTokens(repos.APITokens, repos.Users)
+	)
 
-		log.Printf("Admin %d banned IP: %s (reason: %s)", userID, banRequest.IPAddress, banRequest.Reason)
-		return c.JSON(fiber.Map{
-			"success": true,
-			"message": "IP address banned successfully",
+	dispatcher.Start()
+	if *noScheduler {
+		serverLog.Info("Not running the feed scheduler, leaving it to versed worker")
+	} else {
+		scheduler.ScheduleSnapshots(cfg.SnapshotConfig())
+		scheduler.Start()
+	}
+	digests.Start()
+	if err := inbound.Start(); err != nil {
+		serverLog.Warn("Failed to start inbound SMTP listener", "err", err)
+	}
+	if err := exporter.Start(); err != nil {
+		serverLog.Warn("Failed to start data export service", "err", err)
+	}
+	deleter.Start()
+
+	routes := &handlers.App{
+		Repositories:   repos,
+		Store:          store,
+		DigestSender:   digests,
+		Inbound:        inbound,
+		Exports:        exporter,
+		Accounts:       deleter,
+		PasswordResets: resets,
+		Verifier:       verifier,
+		Settings:       settings,
+		TwoFactorAuth:  twoFactor,
+		Tokens:         tokens,
+		MetricsAccess:  cfg.MetricsAccess(),
+		ReadinessChecks: []handlers.ReadinessCheck{
+			{Name: "database", Check: database.GetDB().PingContext},
+			{Name: "migrations", Check: func(context.Context) error { return database.CheckSchemaCurrent(database.GetDB()) }},
+			{Name: "views", Check: func(context.Context) error { return checkViews(engine) }},
+		},
+	}
+	if !*noScheduler {
+		staleness := time.Duration(cfg.Scheduler.Staleness)
+		routes.ReadinessChecks = append(routes.ReadinessChecks, handlers.ReadinessCheck{
+			Name:  "scheduler",
+			Check: func(context.Context) error { return scheduler.CheckFresh(staleness) },
 		})
-	})
-
-	app.Post("/api/admin/unban-ip", adminMiddleware, func(c *fiber.Ctx) error {
-		userID := c.Locals("userID").(int)
-
-		var unbanRequest struct {
-			IPAddress string `json:"ipAddress"`
-		}
+	}
+	routes.Register(app)
 
-		if err := c.BodyParser(&unbanRequest); err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "Invalid request body",
-			})
+	serverErr := make(chan error, 1)
+	go func() {
+		if tls := cfg.Server.TLS; tls.Enabled {
+			serverErr <- app.ListenTLS(tls.Addr, tls.CertFile, tls.KeyFile)
+			return
 		}
+		serverErr <- app.Listen(cfg.Server.Addr)
+	}()
 
-		if unbanRequest.IPAddress == "" {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "IP address is required",
-			})
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-		err := database.UnbanIP(unbanRequest.IPAddress, userID)
+	code := 0
+	select {
+	case <-ctx.Done():
+		serverLog.Info("Shutdown signal received, shutting down")
+	case err := <-serverErr:
 		if err != nil {
-			log.Printf("Error unbanning IP %s: %v", unbanRequest.IPAddress, err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to unban IP address",
-			})
+			serverLog.Error("Server error", "err", err)
+			code = 1
 		}
+	}
+	stop()
 
-		log.Printf("Admin %d unbanned IP: %s", userID, unbanRequest.IPAddress)
-		return c.JSON(fiber.Map{
-			"success": true,
-			"message": "IP address unbanned successfully",
-		})
-	})
-
-	app.Post("/api/admin/subverses", adminMiddleware, handlers.CreateSubverse)
-	app.Get("/api/subverses", handlers.GetSubverses)
-	app.Get("/s/:subverseName", handlers.ViewSubverse)
+	routes.Drain()
+	if delay := time.Duration(cfg.Server.DrainDelay); delay > 0 && code == 0 {
+		serverLog.Info("Draining before shutdown", "delay", delay)
+		time.Sleep(delay)
+	}
+	shutdown(app, workers{
+		scheduler:  scheduler,
+		dispatcher: dispatcher,
+		digests:    digests,
+		inbound:    inbound,
+		exporter:   exporter,
+		deleter:    deleter,
+		resets:     resets,
+		verifier:   verifier,
+	}, database.CloseConnection)
+	return code
+}
 
-	app.Get("/api/admin/subverses/:subverseId/feeds", adminMiddleware, handlers.GetSubverseFeeds)
-	app.Post("/api/admin/subverses/:subverseId/feeds", adminMiddleware, handlers.AddFeedToSubverse)
-	app.Delete("/api/admin/subverses/:subverseId/feeds/:feedId", adminMiddleware, handlers.RemoveFeedFromSubverse)
+// Fails unless the templates were parsed when the app was created
+func checkViews(engine *django.Engine) error {
+	engine.Mutex.RLock()
+	defer engine.Mutex.RUnlock()
+	if !engine.Loaded || len(engine.Templates) == 0 {
+		return fmt.Errorf("no templates loaded from %s", engine.Directory)
+	}
+	return nil
+}
 
-	app.Get("/s/:subverseName/posts", handlers.GetSubversePosts)
-	app.Get("/s/:subverseName/posts/search", handlers.SearchPosts)
-	app.Post("/s/:subverseName/posts", handlers.CreatePost)
-	app.Get("/posts/:postID", handlers.GetPost)
-	app.Put("/posts/:postID", handlers.UpdatePost)
-	app.Delete("/posts/:postID", handlers.DeletePost)
-	app.Post("/api/posts/:postID/vote", handlers.VotePost)
+// Something run alongside the HTTP server that has to be stopped on exit
+type stopper interface {
+	Stop()
+}
 
-	app.Get("/api/user/status", func(c *fiber.Ctx) error {
-		userID, ok := c.Locals("userID").(int)
-		if !ok {
-			return c.JSON(fiber.Map{
-				"isAdmin": false,
-			})
-		}
+// The background workers versed serve runs
+type workers struct {
+	scheduler, dispatcher, digests, inbound, exporter, deleter, resets, verifier stopper
+}
 
-		isAdmin, err := database.IsUserAdmin(userID)
-		if err != nil {
-			log.Printf("Error checking admin status for user %d: %v", userID, err)
-			return c.Status(500).JSON(fiber.Map{
-				"error": "Failed to check admin status",
-			})
-		}
+// Returns the workers in the order they are stopped. The scheduler and
+// inbound listener come before the webhook dispatcher so that items saved by
+// in-flight updates are still queued for delivery.
+func (w workers) stopOrder() []stopper {
+	return []stopper{w.inbound, w.scheduler, w.digests, w.deleter, w.resets, w.verifier, w.exporter, w.dispatcher}
+}
 
-		return c.JSON(fiber.Map{
-			"isAdmin": isAdmin,
-		})
-	})
+// Stops the HTTP server, then the background workers, and closes the
+// database last
+func shutdown(app *fiber.App, w workers, closeDB func() error) {
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		serverLog.Error("Failed to shut down server", "err", err)
+	}
+	for _, worker := range w.stopOrder() {
+		worker.Stop()
+	}
 
-	port := 3000
-	if len(os.Args) > 1 {
-		if os.Args[1] == "prod" {
-			log.Fatal(app.ListenTLS(":443", "/etc/letsencrypt/live/versed.cc/fullchain.pem", "/etc/letsencrypt/live/versed.cc/privkey.pem"))
-		}
-	} else {
-		log.Fatal(app.Listen(fmt.Sprintf(":%d", port)))
+	if err := closeDB(); err != nil {
+		serverLog.Error("Failed to close database", "err", err)
 	}
+	serverLog.Info("Shutdown complete")
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Records the order things are stopped in
+type stopLog []string
+
+type fakeWorker struct {
+	name string
+	log  *stopLog
+}
+
+func (w fakeWorker) Stop() { *w.log = append(*w.log, w.name) }
+
+func TestShutdownOrder(t *testing.T) {
+	var log stopLog
+	worker := func(name string) fakeWorker { return fakeWorker{name, &log} }
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- app.Listener(ln) }()
+	// Shutting down before the server took the listener would leave it serving
+	for range 100 {
+		if resp, err := http.Get("http://" + ln.Addr().String()); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shutdown(app, workers{
+		scheduler:  worker("scheduler"),
+		dispatcher: worker("dispatcher"),
+		digests:    worker("digests"),
+		inbound:    worker("inbound"),
+		exporter:   worker("exporter"),
+		deleter:    worker("deleter"),
+		resets:     worker("resets"),
+		verifier:   worker("verifier"),
+	}, func() error {
+		log = append(log, "database")
+		return nil
+	})
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("HTTP server still running after shutdown")
+	}
+	if len(log) != 9 || log[len(log)-1] != "database" {
+		t.Fatalf("stopped %q, want every worker once and the database last", log)
+	}
+	dispatcher := slices.Index(log, "dispatcher")
+	for _, before := range []string{"scheduler", "inbound"} {
+		if i := slices.Index(log, before); i < 0 || i > dispatcher {
+			t.Errorf("stopped %q, want %s before the dispatcher", log, before)
+		}
+	}
+}
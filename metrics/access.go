@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Who may scrape the metrics besides signed-in admins
+type Access struct {
+	// Bearer token scrapers can present; none is accepted when empty
+	Token string
+	// Networks whose clients need no token
+	Allow []netip.Prefix
+}
+
+// Parses addresses and CIDR ranges such as "10.0.0.0/8" or "127.0.0.1"
+func ParseAllowList(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Reports whether a client may scrape, going by its IP address and the
+// Authorization header it sent
+func (a Access) Allows(ip, authorization string) bool {
+	if a.Token != "" {
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1 {
+			return true
+		}
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
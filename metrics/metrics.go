@@ -0,0 +1,343 @@
+// Package metrics keeps counters, gauges and histograms in memory and writes
+// them in the Prometheus text exposition format.
+//
+// Metrics are declared as package variables where they are recorded, e.g.
+//
+//	var fetches = metrics.NewCounter("versed_feed_fetches_total", "Feed fetches.", "source", "result")
+//
+// and every one of them is written by WriteText.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Histogram buckets for latencies, in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram buckets for slow operations such as feed fetches, in seconds
+var SlowBuckets = []float64{.1, .25, .5, 1, 2.5, 5, 10, 20, 30, 60}
+
+// How many of each background worker's jobs are running. Averaged over time
+// it shows how much of the time each worker is busy.
+var WorkersBusy = NewGauge("versed_workers_busy", "Background jobs running, by worker.", "worker")
+
+// A metric as the registry sees it
+type metric interface {
+	name() string
+	write(w io.Writer) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]metric)
+)
+
+// Adds a metric to the registry, replacing any of the same name
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[m.name()] = m
+}
+
+// Writes every metric in the Prometheus text format, sorted by name
+func WriteText(w io.Writer) error {
+	registryMu.Lock()
+	all := make([]metric, 0, len(registry))
+	for _, m := range registry {
+		all = append(all, m)
+	}
+	registryMu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool { return all[i].name() < all[j].name() })
+	for _, m := range all {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// What every kind of metric has in common: a name, help text and the names of
+// its labels
+type desc struct {
+	metricName string
+	help       string
+	labels     []string
+}
+
+func (d *desc) name() string { return d.metricName }
+
+func (d *desc) writeHeader(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, escapeHelp(d.help), d.metricName, kind)
+	return err
+}
+
+// Joins label values into a map key
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// Formats label pairs as {a="1",b="2"}, with extra pairs appended
+func (d *desc) labelString(key string, extra ...string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabel(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// A value that only goes up, such as a number of requests
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Creates and registers a counter with the given label names
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{desc: desc{name, help, labels}, values: make(map[string]float64)}
+	register(c)
+	return c
+}
+
+// Adds one for the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Adds v, which must not be negative, for the given label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Returns the current value for the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return writeSamples(w, &c.desc, "counter", c.values)
+}
+
+// A value that goes up and down, such as a number of running workers
+type Gauge struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// Creates and registers a gauge with the given label names
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{desc: desc{name, help, labels}, values: make(map[string]float64)}
+	register(g)
+	return g
+}
+
+// Sets the value for the given label values
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	g.values[key] = v
+	g.mu.Unlock()
+}
+
+// Adds v, which may be negative, for the given label values
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	g.values[key] += v
+	g.mu.Unlock()
+}
+
+// Adds one for the given label values
+func (g *Gauge) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+
+// Subtracts one for the given label values
+func (g *Gauge) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+// Returns the current value for the given label values
+func (g *Gauge) Value(labelValues ...string) float64 {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.values[key]
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return writeSamples(w, &g.desc, "gauge", g.values)
+}
+
+// A gauge whose values are read when the metrics are written, for numbers
+// that already live elsewhere such as in the database
+type GaugeFunc struct {
+	desc
+	collect func(emit func(v float64, labelValues ...string))
+}
+
+// Creates and registers a gauge that calls collect to get its values.
+// collect calls emit once for every combination of label values.
+func NewGaugeFunc(name, help string, labels []string, collect func(emit func(v float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name, help, labels}, collect: collect}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	values := make(map[string]float64)
+	g.collect(func(v float64, labelValues ...string) {
+		values[g.key(labelValues)] = v
+	})
+	return writeSamples(w, &g.desc, "gauge", values)
+}
+
+// Counts observations, such as request durations, into buckets
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Creates and registers a histogram with the given upper bucket bounds,
+// which must be sorted, and label names
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, labels},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+// Records a value for the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+// Records the time passed since start, in seconds
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+// Returns how many values were recorded for the given label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	if err := h.writeHeader(w, "histogram"); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelString(key, "le", formatFloat(bound)), cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, h.labelString(key, "le", "+Inf"), s.count,
+			h.metricName, h.labelString(key), formatFloat(s.sum),
+			h.metricName, h.labelString(key), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeSamples(w io.Writer, d *desc, kind string, values map[string]float64) error {
+	if err := d.writeHeader(w, kind); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(values) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", d.metricName, d.labelString(key), formatFloat(values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Requests handled.", "route", "status")
+	requests.Inc("/a", "200")
+	requests.Add(2, "/a", "200")
+	requests.Inc(`/b"`, "500")
+
+	busy := NewGauge("test_busy", "Busy workers.")
+	busy.Inc()
+	busy.Inc()
+	busy.Dec()
+
+	latency := NewHistogram("test_latency_seconds", "Latency.\nIn seconds.", []float64{0.1, 1})
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	NewGaugeFunc("test_sessions", "Open sessions.", nil, func(emit func(float64, ...string)) {
+		emit(4)
+	})
+
+	var buf bytes.Buffer
+	if err := WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"# HELP test_requests_total Requests handled.\n# TYPE test_requests_total counter\n" +
+			`test_requests_total{route="/a",status="200"} 3` + "\n" +
+			`test_requests_total{route="/b\"",status="500"} 1` + "\n",
+		"# TYPE test_busy gauge\ntest_busy 1\n",
+		"# HELP test_latency_seconds Latency.\\nIn seconds.\n# TYPE test_latency_seconds histogram\n" +
+			`test_latency_seconds_bucket{le="0.1"} 1` + "\n" +
+			`test_latency_seconds_bucket{le="1"} 2` + "\n" +
+			`test_latency_seconds_bucket{le="+Inf"} 3` + "\n" +
+			"test_latency_seconds_sum 3.55\ntest_latency_seconds_count 3\n",
+		"# TYPE test_sessions gauge\ntest_sessions 4\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain\n%s\ngot:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "test_busy") > strings.Index(out, "test_requests_total") {
+		t.Error("metrics are not sorted by name")
+	}
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	counter := NewCounter("test_labelled_total", "Labelled.", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with too few label values did not panic")
+		}
+	}()
+	counter.Inc("only-a")
+}
+
+func TestAccess(t *testing.T) {
+	allow, err := ParseAllowList([]string{"127.0.0.1", "10.0.0.0/8", " "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	access := Access{Token: "s3cret", Allow: allow}
+
+	tests := []struct {
+		ip, authorization string
+		want              bool
+	}{
+		{"127.0.0.1", "", true},
+		{"::ffff:10.1.2.3", "", true},
+		{"192.168.1.1", "", false},
+		{"192.168.1.1", "Bearer s3cret", true},
+		{"192.168.1.1", "Bearer wrong", false},
+		{"192.168.1.1", "s3cret", false},
+	}
+	for _, tt := range tests {
+		if got := access.Allows(tt.ip, tt.authorization); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.ip, tt.authorization, got, tt.want)
+		}
+	}
+
+	if (Access{}).Allows("192.168.1.1", "Bearer ") {
+		t.Error("an empty token was accepted")
+	}
+	if _, err := ParseAllowList([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParseAllowList accepted an invalid network")
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+)
+
+const migrateUsage = `usage: versed migrate [command]
+
+commands:
+  up          apply all pending migrations (default)
+  down [N]    roll back the last N migrations (default 1)
+  to VERSION  migrate up or down to VERSION
+  status      list migrations and whether they have been applied
+  copy FROM TO
+              copy all data from one database into another, empty one,
+              e.g. versed migrate copy ./data.db postgres://user@host/versed
+
+The database is taken from database.url in the configuration file or from
+VERSED_DATABASE_URL (default ./data.db).`
+
+// Runs `versed migrate ...` and returns the process exit code
+func runMigrateCommand(args []string) int {
+	if len(args) > 0 && args[0] == "copy" {
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		return copyDatabase(args[1], args[2])
+	}
+
+	dsn, err := configuredDatabaseURL()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := database.OpenDatabase(dsn); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open database:", err)
+		return 1
+	}
+	defer database.CloseConnection()
+	db := database.GetDB()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	var changed []database.Migration
+	switch command {
+	case "up":
+		if err = database.CheckSchemaVersion(db); err == nil {
+			changed, err = database.Migrate(db)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return 2
+			}
+		}
+		changed, err = database.Rollback(db, steps)
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		target, convErr := strconv.Atoi(args[1])
+		if convErr != nil || target < 0 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		if err = database.CheckSchemaVersion(db); err == nil {
+			changed, err = database.MigrateTo(db, target)
+		}
+	case "status":
+		return printMigrationStatus()
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Migration failed:", err)
+		return 1
+	}
+	if len(changed) == 0 {
+		fmt.Println("Nothing to do")
+	}
+	version, err := database.SchemaVersion(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("Schema is at version %d\n", version)
+	return 0
+}
+
+func printMigrationStatus() int {
+	statuses, err := database.MigrationStatuses(database.GetDB())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to get migration status:", err)
+		return 1
+	}
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d  %-30s %s\n", s.Version, s.Name, applied)
+	}
+	return 0
+}
+
+// Copies everything from one database into another, e.g. SQLite into PostgreSQL
+func copyDatabase(fromDSN, toDSN string) int {
+	src, err := sqldb.Open(fromDSN)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open source database:", err)
+		return 1
+	}
+	defer src.Close()
+
+	dst, err := sqldb.Open(toDSN)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to open destination database:", err)
+		return 1
+	}
+	defer dst.Close()
+
+	copied, err := database.CopyData(src, dst)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Copy failed:", err)
+		return 1
+	}
+
+	tables := make([]string, 0, len(copied))
+	total := 0
+	for table, n := range copied {
+		tables = append(tables, table)
+		total += n
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("%-30s %d\n", table, copied[table])
+	}
+	fmt.Printf("Copied %d rows from %s to %s\n", total, src.Dialect, dst.Dialect)
+	return 0
+}
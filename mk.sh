@@ -4,4 +4,4 @@ npm install
 npm run build
 cd ..
 cd ..
-go build
+go build -tags sqlite_fts5
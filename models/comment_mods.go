@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Represents a comment on a feed item
+type Comment struct {
+	ID        int       `json:"id"`
+	ItemID    string    `json:"item_id"`
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Content   string    `json:"content"`
+	ParentID  *int      `json:"parent_id"`
+	Replies   []Comment `json:"replies,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Highlighted extract of the matching text, only set on search results
+	Snippet string `json:"snippet,omitempty"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Digest frequencies a user can choose
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSubscription holds a user's email digest schedule
+type DigestSubscription struct {
+	UserID           int        `json:"user_id"`
+	Email            string     `json:"-"`
+	Username         string     `json:"-"`
+	Frequency        string     `json:"frequency"`
+	LastSentAt       *time.Time `json:"last_sent_at,omitempty"`
+	UnsubscribeToken string     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
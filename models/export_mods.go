@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// States of a data export job
+const (
+	ExportPending = "pending"
+	ExportRunning = "running"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// DataExport is a user's request for an archive of their data, built in the background
+type DataExport struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"`
+	FileSize    int64      `json:"file_size"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// A user's vote on a feed item
+type ItemVote struct {
+	ItemID    string    `json:"item_id"`
+	Title     string    `json:"title"`
+	VoteType  string    `json:"vote_type"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// A feed item a user has hidden from their feed
+type HiddenItem struct {
+	ItemID   string    `json:"item_id"`
+	Title    string    `json:"title"`
+	HiddenAt time.Time `json:"hidden_at"`
+}
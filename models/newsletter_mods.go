@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// NewsletterAddress is an inbound email address whose mail becomes feed items
+type NewsletterAddress struct {
+	ID           int       `json:"id"`
+	UserID       int       `json:"user_id"`
+	Name         string    `json:"name"`
+	LocalPart    string    `json:"local_part"`
+	Address      string    `json:"address"`
+	FeedSourceID int       `json:"feed_source_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NewsletterMessage holds the full body of a received newsletter, which only
+// the user it was sent to may read
+type NewsletterMessage struct {
+	ItemID      string    `json:"item_id"`
+	AddressID   int       `json:"address_id"`
+	UserID      int       `json:"user_id"`
+	FromAddress string    `json:"from_address"`
+	FromName    string    `json:"from_name"`
+	Subject     string    `json:"subject"`
+	HTML        string    `json:"html"`
+	Text        string    `json:"text"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
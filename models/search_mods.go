@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SavedSearch is a feed search query a user keeps, along with how many new items matched it since they last looked
+type SavedSearch struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Unseen    int       `json:"unseen"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -10,8 +10,15 @@ type User struct {
 	Password string `json:"password"`
 	IsAdmin  bool   `json:"is_admin"`
 	IPAddress string `json:"ip_address"`
+	// Whether the user has proven they own Email
+	EmailVerified bool `json:"email_verified"`
+	// Address the user is changing to, which takes effect once verified
+	PendingEmail string `json:"pending_email,omitempty"`
 }
 
+// The name comments and posts from deleted accounts are shown under
+const DeletedUsername = "[deleted]"
+
 // BannedIP represents a banned IP address
 type BannedIP struct {
 	ID         int        `json:"id"`
@@ -46,3 +53,55 @@ type UserCategoryFeed struct {
 	FeedSourceID int       `json:"feed_source_id"`
 	CreatedAt    time.Time `json:"created_at"`
 }
+
+// A feed that new users get in one of their default categories
+type DefaultFeed struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+}
+
+// A category new users start with, along with its feeds
+type DefaultCategory struct {
+	Name  string        `yaml:"name"`
+	Feeds []DefaultFeed `yaml:"feeds"`
+}
+
+// The categories and feeds every new user starts with, unless the
+// configuration replaces them
+var DefaultCategories = []DefaultCategory{
+	{"Technology", []DefaultFeed{
+		{"Hacker News", "https://hnrss.org/frontpage"},
+		{"Reddit - Programming", "https://www.reddit.com/r/programming/.rss"},
+		{"Lobsters", "https://lobste.rs/rss"},
+	}},
+	{"News", []DefaultFeed{
+		{"Reddit - Technology", "https://www.reddit.com/r/technology/.rss"},
+		{"BBC News - Technology", "http://feeds.bbci.co.uk/news/technology/rss.xml"},
+	}},
+	{"Science", []DefaultFeed{
+		{"Reddit - Science", "https://www.reddit.com/r/science/.rss"},
+		{"Nature News", "https://www.nature.com/nature.rss"},
+	}},
+}
+
+// A user's TOTP two-factor settings
+type TwoFactor struct {
+	UserID int    `json:"user_id"`
+	Secret string `json:"-"`
+	// Nil until the user confirms a code from their authenticator app
+	EnabledAt *time.Time `json:"enabled_at,omitempty"`
+	// Time step of the last code accepted, so that no code is used twice
+	LastStep int64 `json:"-"`
+}
+
+// A personal access token a user created for scripts. Only a hash of the
+// token itself is stored.
+type APIToken struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+	// What the token may be used for, such as "read" or "categories"
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
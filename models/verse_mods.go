@@ -22,6 +22,8 @@ type Post struct {
 	Score      int       `json:"score"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+	// Highlighted extract of the matching text, only set on search results
+	Snippet string `json:"snippet,omitempty"`
 }
 
 // PostComment represents a comment on a post
@@ -35,6 +37,8 @@ type PostComment struct {
 	CreatedAt time.Time     `json:"created_at"`
 	UpdatedAt time.Time     `json:"updated_at"`
 	Replies   []PostComment `json:"replies,omitempty"`
+	// Highlighted extract of the matching text, only set on search results
+	Snippet string `json:"snippet,omitempty"`
 }
 
 // Vote represents a user's vote on a post
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Match types a webhook rule can filter new feed items on
+const (
+	WebhookMatchCategory = "category"
+	WebhookMatchSource   = "source"
+	WebhookMatchKeyword  = "keyword"
+	WebhookMatchTag      = "tag"
+)
+
+// Reports whether the given match type is one a webhook rule can use
+func IsValidWebhookMatchType(matchType string) bool {
+	switch matchType {
+	case WebhookMatchCategory, WebhookMatchSource, WebhookMatchKeyword, WebhookMatchTag:
+		return true
+	}
+	return false
+}
+
+// Delivery states recorded in the webhook delivery log
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook represents a user-registered endpoint that receives new feed items
+type Webhook struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"secret,omitempty"`
+	MatchType  string    `json:"match_type"`
+	MatchValue string    `json:"match_value"`
+	Enabled    bool      `json:"enabled"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDelivery represents one payload sent, or due to be sent, to a webhook
+type WebhookDelivery struct {
+	ID             int        `json:"id"`
+	WebhookID      int        `json:"webhook_id"`
+	ItemID         string     `json:"item_id"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"-"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,256 @@
+package newsletters
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/webhooks"
+)
+
+var logger = logging.For("newsletters")
+
+// Returned when none of a message's recipients is a known newsletter address
+var ErrUnknownRecipient = errors.New("no matching newsletter address")
+
+const excerptLength = 280
+
+var slugPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Configures where inbound newsletter email is accepted
+type Config struct {
+	// Domain newsletter addresses live under
+	Domain string
+	// Address of the built-in SMTP listener, which is disabled when empty
+	SMTPAddr string
+	// Shared secret mail forwarders must present to the HTTP endpoint, which
+	// is disabled when empty
+	Secret string
+}
+
+// Turns inbound newsletter email into feed items.
+//
+// Mail arrives either through the built-in SMTP listener or through the HTTP
+// endpoint used by mail forwarders.
+type Service struct {
+	db         *sqldb.DB
+	cfg        Config
+	dispatcher *webhooks.Dispatcher
+	smtp       *SMTPServer
+}
+
+// Creates a new newsletter service
+func NewService(db *sqldb.DB, dispatcher *webhooks.Dispatcher, cfg Config) *Service {
+	cfg.Domain = strings.ToLower(strings.TrimSpace(cfg.Domain))
+	if cfg.Domain == "" {
+		cfg.Domain = "in.versed.cc"
+	}
+	return &Service{
+		db:         db,
+		cfg:        cfg,
+		dispatcher: dispatcher,
+	}
+}
+
+// Starts the SMTP listener if one is configured
+func (s *Service) Start() error {
+	if s.cfg.SMTPAddr == "" {
+		logger.Info("No inbound SMTP address is configured, inbound SMTP is disabled")
+		return nil
+	}
+	s.smtp = NewSMTPServer(s.cfg.Domain, s.Accepts, func(from string, to []string, data []byte) error {
+		_, err := s.Deliver(to, data)
+		return err
+	})
+	addr, err := s.smtp.Listen(s.cfg.SMTPAddr)
+	if err != nil {
+		s.smtp = nil
+		return err
+	}
+	logger.Info("Accepting inbound newsletters over SMTP", "addr", addr)
+	return nil
+}
+
+// Returns the secret mail forwarders must present, or "" if the HTTP endpoint
+// is disabled
+func (s *Service) Secret() string {
+	return s.cfg.Secret
+}
+
+// Stops the SMTP listener
+func (s *Service) Stop() {
+	if s.smtp != nil {
+		s.smtp.Close()
+	}
+}
+
+// Returns the full email address for a local part
+func (s *Service) Address(localPart string) string {
+	return localPart + "@" + s.cfg.Domain
+}
+
+// Generates a new unguessable local part based on the newsletter name
+func (s *Service) NewLocalPart(name string) (string, error) {
+	slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(slug) > 24 {
+		slug = strings.Trim(slug[:24], "-")
+	}
+	if slug == "" {
+		slug = "newsletter"
+	}
+
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return slug + "." + hex.EncodeToString(buf), nil
+}
+
+// Resolves a recipient to a newsletter address, or nil if it is not one of ours
+func (s *Service) lookup(rcpt string) *models.NewsletterAddress {
+	local, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(rcpt)), "@")
+	if !ok || domain != s.cfg.Domain {
+		return nil
+	}
+	local, _, _ = strings.Cut(local, "+")
+	addr, err := database.GetNewsletterAddressByLocalPart(s.db, local)
+	if err != nil {
+		return nil
+	}
+	return addr
+}
+
+// Reports whether a recipient is a known newsletter address
+func (s *Service) Accepts(rcpt string) bool {
+	return s.lookup(rcpt) != nil
+}
+
+// Files a raw message as a feed item under every newsletter address it was sent to.
+//
+// If recipients is empty the message headers are used instead. Returns the
+// number of new items; redelivering the same message creates no duplicates.
+func (s *Service) Deliver(recipients []string, raw []byte) (int, error) {
+	if len(raw) > MaxMessageSize {
+		return 0, fmt.Errorf("message exceeds %d bytes", MaxMessageSize)
+	}
+	email, err := ParseEmail(raw)
+	if err != nil {
+		return 0, err
+	}
+	if len(recipients) == 0 {
+		recipients = email.To
+	}
+
+	seen := make(map[int]bool)
+	var addrs []*models.NewsletterAddress
+	for _, rcpt := range recipients {
+		addr := s.lookup(rcpt)
+		if addr == nil || seen[addr.ID] {
+			continue
+		}
+		seen[addr.ID] = true
+		addrs = append(addrs, addr)
+	}
+	if len(addrs) == 0 {
+		return 0, ErrUnknownRecipient
+	}
+
+	created := 0
+	for _, addr := range addrs {
+		isNew, err := s.file(addr, email)
+		if err != nil {
+			return created, err
+		}
+		if isNew {
+			created++
+		}
+	}
+	return created, nil
+}
+
+// Saves one message as a feed item and stores its sanitized body
+func (s *Service) file(addr *models.NewsletterAddress, email *Email) (bool, error) {
+	source, err := feeds.GetFeedSourceByID(s.db, addr.FeedSourceID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get newsletter feed source: %w", err)
+	}
+
+	item := BuildFeedItem(addr, source.Name, email)
+	newItems, err := feeds.SaveNewFeedItems(s.db, []feeds.FeedItem{item})
+	if err != nil {
+		return false, err
+	}
+	if len(newItems) == 0 {
+		return false, nil
+	}
+
+	err = database.SaveNewsletterMessage(s.db, models.NewsletterMessage{
+		ItemID:      item.ID,
+		AddressID:   addr.ID,
+		UserID:      addr.UserID,
+		FromAddress: email.From,
+		FromName:    email.FromName,
+		Subject:     email.Subject,
+		HTML:        SanitizeHTML(email.HTML),
+		Text:        email.Text,
+		ReceivedAt:  time.Now(),
+	})
+	if err != nil {
+		return true, err
+	}
+
+	logger.Info("Filed newsletter", "source", source.Name, "source_id", source.ID)
+	if s.dispatcher != nil {
+		s.dispatcher.NotifyUser(addr.UserID, newItems)
+	}
+	return true, nil
+}
+
+// Builds the feed item for a message received at a newsletter address
+func BuildFeedItem(addr *models.NewsletterAddress, sourceName string, email *Email) feeds.FeedItem {
+	hash := sha256.Sum256([]byte("newsletter:" + addr.LocalPart + ":" + email.MessageID))
+	id := hex.EncodeToString(hash[:])[:16]
+
+	title := email.Subject
+	if title == "" {
+		title = "(no subject)"
+	}
+	author := email.FromName
+	if author == "" {
+		author = email.From
+	}
+
+	text := email.Text
+	if strings.TrimSpace(text) == "" {
+		text = htmlToText(email.HTML)
+	}
+
+	now := time.Now()
+	publishedAt := now
+	if !email.Date.IsZero() && email.Date.Before(now.Add(time.Hour)) {
+		publishedAt = email.Date
+	}
+
+	return feeds.FeedItem{
+		ID:          id,
+		SourceID:    addr.FeedSourceID,
+		SourceName:  sourceName,
+		Title:       title,
+		URL:         "/newsletters/items/" + id,
+		Description: html.EscapeString(excerpt(text, excerptLength)),
+		Author:      author,
+		PublishedAt: &publishedAt,
+		CreatedAt:   &now,
+	}
+}
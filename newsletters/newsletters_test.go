@@ -0,0 +1,277 @@
+package newsletters
+
+import (
+	"bufio"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	raw, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	return raw
+}
+
+func TestParseEmailMultipart(t *testing.T) {
+	email, err := ParseEmail(readFixture(t, "multipart.eml"))
+	if err != nil {
+		t.Fatalf("ParseEmail: %v", err)
+	}
+
+	checks := []struct{ name, got, want string }{
+		{"MessageID", email.MessageID, "abc123@mail.example.com"},
+		{"From", email.From, "news@example.com"},
+		{"FromName", email.FromName, "Morning Brüw"},
+		{"Subject", email.Subject, "Today’s top stories"},
+		{"Text", email.Text, "Good morning! Here are today’s stories.\n\n1. Markets rally"},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+	if !strings.Contains(email.HTML, "<script>") {
+		t.Errorf("HTML should be returned unsanitized, got %q", email.HTML)
+	}
+	if !email.Date.Equal(time.Date(2025, 1, 6, 7, 30, 0, 0, time.UTC)) {
+		t.Errorf("Date = %v", email.Date)
+	}
+	if len(email.To) == 0 || email.To[0] != "brew.1a2b3c4d@in.versed.test" {
+		t.Errorf("To = %v", email.To)
+	}
+}
+
+func TestParseEmailCharsetAndAttachments(t *testing.T) {
+	email, err := ParseEmail(readFixture(t, "latin1.eml"))
+	if err != nil {
+		t.Fatalf("ParseEmail: %v", err)
+	}
+	if email.Subject != "Résumé du jour" {
+		t.Errorf("Subject = %q", email.Subject)
+	}
+	if email.HTML != "<p>Café crème</p>" {
+		t.Errorf("HTML = %q", email.HTML)
+	}
+	if email.Text != "" {
+		t.Errorf("attachment should be skipped, Text = %q", email.Text)
+	}
+	if email.MessageID == "" {
+		t.Error("missing Message-ID should fall back to a content hash")
+	}
+}
+
+func TestParseEmailRejectsEmptyBody(t *testing.T) {
+	raw := "From: a@example.com\r\nContent-Type: image/png\r\n\r\nxxxx"
+	if _, err := ParseEmail([]byte(raw)); err == nil {
+		t.Fatal("expected error for message without text parts")
+	}
+}
+
+func TestSanitizeHTML(t *testing.T) {
+	cases := []struct{ name, in, want string }{
+		{"script", `<p>a</p><script>alert(1)</script><p>b</p>`, `<p>a</p><p>b</p>`},
+		{"style and head", `<html><head><title>t</title><style>p{}</style></head><body><p>x</p></body></html>`, `<p>x</p>`},
+		{"event handlers and inline style", `<p onclick="x()" style="color:red">hi</p>`, `<p>hi</p>`},
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a rel="nofollow noopener noreferrer" target="_blank">x</a>`},
+		{"safe link", `<a href="https://example.com/?a=1&b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2" rel="nofollow noopener noreferrer" target="_blank">x</a>`},
+		{"tracking pixel", `<img src="https://t.example.com/o.gif" width="1" height="1">`, ``},
+		{"data image", `<img src="data:image/png;base64,AAAA">`, ``},
+		{"image", `<img src="https://example.com/a.png" alt="a">`, `<img src="https://example.com/a.png" alt="a">`},
+		{"unknown tags unwrapped", `<center><font color="red">hello</font></center>`, `hello`},
+		{"unbalanced", `<div><p><b>bold`, `<div><p><b>bold</b></p></div>`},
+		{"stray end tags", `</div>text</p>`, `text`},
+		{"escaped text", `<p>&lt;script&gt;</p>`, `<p>&lt;script&gt;</p>`},
+		{"iframe", `<iframe src="https://evil.example.com"><p>x</p></iframe>ok`, `ok`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := SanitizeHTML(c.in); got != c.want {
+				t.Errorf("SanitizeHTML(%q) = %q, want %q", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	if got := excerpt("  short \n text ", 20); got != "short text" {
+		t.Errorf("excerpt = %q", got)
+	}
+	if got := excerpt("one two three four five six", 14); got != "one two three…" {
+		t.Errorf("excerpt = %q", got)
+	}
+	if got := htmlToText(`<style>p{}</style><p>Hello</p><p>world</p>`); strings.Join(strings.Fields(got), " ") != "Hello world" {
+		t.Errorf("htmlToText = %q", got)
+	}
+}
+
+func TestSMTPServer(t *testing.T) {
+	type delivery struct {
+		from string
+		to   []string
+		data []byte
+	}
+	var (
+		mu       sync.Mutex
+		received []delivery
+	)
+	server := NewSMTPServer("in.versed.test",
+		func(rcpt string) bool { return strings.HasSuffix(strings.ToLower(rcpt), "@in.versed.test") },
+		func(from string, to []string, data []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, delivery{from, to, data})
+			return nil
+		})
+	addr, err := server.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer server.Close()
+
+	raw := readFixture(t, "multipart.eml")
+	err = smtp.SendMail(addr.String(), nil, "news@example.com", []string{"Brew.1a2b3c4d@in.versed.test"}, raw)
+	if err != nil {
+		t.Fatalf("SendMail: %v", err)
+	}
+
+	err = smtp.SendMail(addr.String(), nil, "news@example.com", []string{"someone@elsewhere.test"}, raw)
+	if err == nil || !strings.Contains(err.Error(), "550") {
+		t.Fatalf("expected 550 for unknown recipient, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(received))
+	}
+	got := received[0]
+	if got.from != "news@example.com" || len(got.to) != 1 || got.to[0] != "brew.1a2b3c4d@in.versed.test" {
+		t.Errorf("envelope = %q -> %v", got.from, got.to)
+	}
+	email, err := ParseEmail(got.data)
+	if err != nil {
+		t.Fatalf("ParseEmail of received data: %v", err)
+	}
+	if email.Subject != "Today’s top stories" {
+		t.Errorf("Subject = %q", email.Subject)
+	}
+}
+
+// Connects to an SMTP server, returning the connection and its first reply
+func dialSMTP(t *testing.T, addr net.Addr) (net.Conn, *bufio.Reader, string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr.String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading greeting: %v", err)
+	}
+	return conn, r, greeting
+}
+
+func TestSMTPServerLineLimit(t *testing.T) {
+	server := NewSMTPServer("in.versed.test", func(string) bool { return true }, func(string, []string, []byte) error { return nil })
+	addr, err := server.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer server.Close()
+
+	conn, r, _ := dialSMTP(t, addr)
+	if _, err := conn.Write([]byte("EHLO " + strings.Repeat("a", 64<<10) + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, _ := r.ReadString('\n')
+	if !strings.HasPrefix(reply, "500 ") {
+		t.Errorf("reply to an overlong line = %q, want 500", reply)
+	}
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("connection still open after an overlong line")
+	}
+}
+
+func TestSMTPServerConnectionLimit(t *testing.T) {
+	server := NewSMTPServer("in.versed.test", func(string) bool { return true }, func(string, []string, []byte) error { return nil })
+	server.MaxConnections = 1
+	addr, err := server.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer server.Close()
+
+	first, _, greeting := dialSMTP(t, addr)
+	if !strings.HasPrefix(greeting, "220 ") {
+		t.Fatalf("first greeting = %q", greeting)
+	}
+	if _, _, greeting := dialSMTP(t, addr); !strings.HasPrefix(greeting, "421 ") {
+		t.Errorf("greeting over the limit = %q, want 421", greeting)
+	}
+
+	first.Write([]byte("QUIT\r\n"))
+	first.Close()
+	for range 100 {
+		if _, _, greeting := dialSMTP(t, addr); strings.HasPrefix(greeting, "220 ") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("still turned away after the first session ended")
+}
+
+func TestDeliverFilesForTheOwner(t *testing.T) {
+	db, err := sqldb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := database.CreateUser(db, "reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := database.GetUserByEmail(db, "reader@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if _, err := database.CreateNewsletterAddress(db, user.ID, "Morning Brew", "brew.1a2b3c4d"); err != nil {
+		t.Fatalf("CreateNewsletterAddress: %v", err)
+	}
+
+	s := NewService(db, nil, Config{Domain: "in.versed.test"})
+	if created, err := s.Deliver(nil, readFixture(t, "multipart.eml")); err != nil || created != 1 {
+		t.Fatalf("Deliver = %d, %v; want 1 new item", created, err)
+	}
+	items, err := feeds.GetAllFeedItemsWithPagination(db, 10, 0)
+	if err != nil || len(items) != 0 {
+		t.Errorf("shared feed items = %+v, %v; want the newsletter left out", items, err)
+	}
+	var itemID string
+	if err := db.QueryRow(`SELECT item_id FROM newsletter_messages`).Scan(&itemID); err != nil {
+		t.Fatalf("no message was stored: %v", err)
+	}
+	if msg, err := database.GetNewsletterMessage(db, user.ID, itemID); err != nil || msg.FromAddress != "news@example.com" {
+		t.Errorf("GetNewsletterMessage for the owner = %+v, %v", msg, err)
+	}
+	if _, err := database.GetNewsletterMessage(db, user.ID+1, itemID); err == nil {
+		t.Error("another user read the newsletter")
+	}
+}
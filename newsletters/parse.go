@@ -0,0 +1,186 @@
+package newsletters
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Largest message accepted by either the SMTP listener or the HTTP endpoint
+const MaxMessageSize = 10 << 20
+
+// Multipart nesting deeper than this is ignored
+const maxPartDepth = 8
+
+// An inbound email reduced to the parts a feed item needs
+type Email struct {
+	MessageID string
+	From      string
+	FromName  string
+	Subject   string
+	Date      time.Time
+	To        []string
+	Text      string
+	HTML      string
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charsetReader}
+
+// Parses a raw RFC 5322 message, keeping the first text/plain and text/html
+// bodies found outside of attachments
+func ParseEmail(raw []byte) (*Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+
+	email := &Email{
+		MessageID: strings.Trim(strings.TrimSpace(msg.Header.Get("Message-Id")), "<>"),
+		Subject:   decodeHeader(msg.Header.Get("Subject")),
+	}
+	if email.MessageID == "" {
+		email.MessageID = fmt.Sprintf("%x", sha256.Sum256(raw))
+	}
+
+	if from, err := parseAddress(msg.Header.Get("From")); err == nil {
+		email.From = strings.ToLower(from.Address)
+		email.FromName = from.Name
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		email.Date = date
+	}
+	for _, key := range []string{"Delivered-To", "X-Original-To", "To", "Cc"} {
+		for _, value := range msg.Header[key] {
+			addrs, err := (&mail.AddressParser{WordDecoder: headerDecoder}).ParseList(value)
+			if err != nil {
+				continue
+			}
+			for _, addr := range addrs {
+				email.To = append(email.To, strings.ToLower(addr.Address))
+			}
+		}
+	}
+
+	header := map[string][]string(msg.Header)
+	if err := email.readPart(header, msg.Body, 0); err != nil {
+		return nil, err
+	}
+	if email.Text == "" && email.HTML == "" {
+		return nil, fmt.Errorf("message has no text or html body")
+	}
+	return email, nil
+}
+
+// Walks a MIME part, recursing into multiparts and keeping the first text bodies
+func (e *Email) readPart(header map[string][]string, body io.Reader, depth int) error {
+	get := func(key string) string {
+		if values := header[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	mediaType, params, err := mime.ParseMediaType(get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if disposition, _, _ := mime.ParseMediaType(get("Content-Disposition")); disposition == "attachment" {
+		return nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxPartDepth {
+			return nil
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read multipart body: %w", err)
+			}
+			if err := e.readPart(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return nil
+	}
+	if (mediaType == "text/plain" && e.Text != "") || (mediaType == "text/html" && e.HTML != "") {
+		return nil
+	}
+
+	content, err := decodeBody(body, get("Content-Transfer-Encoding"), params["charset"])
+	if err != nil {
+		return err
+	}
+	if mediaType == "text/plain" {
+		e.Text = content
+	} else {
+		e.HTML = content
+	}
+	return nil
+}
+
+// Undoes the transfer encoding and converts the charset to UTF-8
+func decodeBody(body io.Reader, encoding, charset string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	if charset != "" {
+		converted, err := charsetReader(charset, body)
+		if err == nil {
+			body = converted
+		}
+	}
+
+	content, err := io.ReadAll(io.LimitReader(body, MaxMessageSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode body: %w", err)
+	}
+	return strings.ReplaceAll(string(content), "\r\n", "\n"), nil
+}
+
+// Returns a reader converting from the named charset to UTF-8
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		return input, nil
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	return enc.NewDecoder().Reader(input), nil
+}
+
+// Decodes RFC 2047 encoded words, falling back to the raw value
+func decodeHeader(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+func parseAddress(value string) (*mail.Address, error) {
+	return (&mail.AddressParser{WordDecoder: headerDecoder}).Parse(value)
+}
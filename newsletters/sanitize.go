@@ -0,0 +1,263 @@
+package newsletters
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Tags kept by the sanitizer, with the attributes each may carry
+var allowedTags = map[string][]string{
+	"a":          {"href", "title"},
+	"abbr":       {"title"},
+	"b":          nil,
+	"blockquote": nil,
+	"br":         nil,
+	"caption":    nil,
+	"code":       nil,
+	"div":        nil,
+	"em":         nil,
+	"figcaption": nil,
+	"figure":     nil,
+	"h1":         nil,
+	"h2":         nil,
+	"h3":         nil,
+	"h4":         nil,
+	"h5":         nil,
+	"h6":         nil,
+	"hr":         nil,
+	"i":          nil,
+	"img":        {"src", "alt", "title", "width", "height"},
+	"li":         nil,
+	"ol":         nil,
+	"p":          nil,
+	"pre":        nil,
+	"s":          nil,
+	"small":      nil,
+	"span":       nil,
+	"strong":     nil,
+	"sub":        nil,
+	"sup":        nil,
+	"table":      nil,
+	"tbody":      nil,
+	"td":         {"colspan", "rowspan", "align"},
+	"tfoot":      nil,
+	"th":         {"colspan", "rowspan", "align"},
+	"thead":      nil,
+	"tr":         nil,
+	"u":          nil,
+	"ul":         nil,
+}
+
+// Tags removed together with everything inside them
+var droppedTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"head":     true,
+	"title":    true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+	"math":     true,
+	"select":   true,
+	"textarea": true,
+}
+
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true}
+
+// Reduces newsletter HTML to a safe subset.
+//
+// Scripts, styles, embeds, event handlers and inline styles are removed, links
+// are limited to http, https and mailto and open in a new tab, and 1x1
+// tracking pixels are dropped. Tags outside the allowlist are unwrapped so
+// their text is kept. The output is always balanced.
+func SanitizeHTML(input string) string {
+	var (
+		out       strings.Builder
+		tokenizer = xhtml.NewTokenizer(strings.NewReader(input))
+		open      []string
+		skipDepth int
+		skipTag   string
+	)
+
+	for {
+		tt := tokenizer.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		name := token.Data
+
+		if skipDepth > 0 {
+			switch {
+			case tt == xhtml.StartTagToken && name == skipTag:
+				skipDepth++
+			case tt == xhtml.EndTagToken && name == skipTag:
+				skipDepth--
+			}
+			continue
+		}
+
+		switch tt {
+		case xhtml.TextToken:
+			out.WriteString(html.EscapeString(token.Data))
+
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if droppedTags[name] {
+				if tt == xhtml.StartTagToken {
+					skipDepth, skipTag = 1, name
+				}
+				continue
+			}
+			attrs, ok := allowedTags[name]
+			if !ok {
+				continue
+			}
+			kept, ok := sanitizeAttrs(name, token.Attr, attrs)
+			if !ok {
+				continue
+			}
+			out.WriteString("<" + name)
+			for _, attr := range kept {
+				out.WriteString(" " + attr.Key + `="` + html.EscapeString(attr.Val) + `"`)
+			}
+			out.WriteString(">")
+			if !voidTags[name] {
+				open = append(open, name)
+			}
+
+		case xhtml.EndTagToken:
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i] == name {
+					for j := len(open) - 1; j >= i; j-- {
+						out.WriteString("</" + open[j] + ">")
+					}
+					open = open[:i]
+					break
+				}
+			}
+		}
+	}
+
+	for i := len(open) - 1; i >= 0; i-- {
+		out.WriteString("</" + open[i] + ">")
+	}
+	return strings.TrimSpace(out.String())
+}
+
+// Filters a tag's attributes, returning false if the whole tag should be dropped
+func sanitizeAttrs(tag string, attrs []xhtml.Attribute, allowed []string) ([]xhtml.Attribute, bool) {
+	var kept []xhtml.Attribute
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+		if !contains(allowed, key) {
+			continue
+		}
+		value := strings.TrimSpace(attr.Val)
+		switch key {
+		case "href":
+			if !safeURL(value, "http", "https", "mailto") {
+				continue
+			}
+		case "src":
+			if !safeURL(value, "http", "https") {
+				continue
+			}
+		case "width", "height":
+			if value == "0" || value == "1" || value == "1px" {
+				return nil, false
+			}
+		}
+		kept = append(kept, xhtml.Attribute{Key: key, Val: value})
+	}
+
+	switch tag {
+	case "img":
+		if !hasAttr(kept, "src") {
+			return nil, false
+		}
+	case "a":
+		kept = append(kept,
+			xhtml.Attribute{Key: "rel", Val: "nofollow noopener noreferrer"},
+			xhtml.Attribute{Key: "target", Val: "_blank"})
+	}
+	return kept, true
+}
+
+func safeURL(value string, schemes ...string) bool {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return contains(schemes, strings.ToLower(parsed.Scheme))
+}
+
+func hasAttr(attrs []xhtml.Attribute, key string) bool {
+	for _, attr := range attrs {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Extracts the visible text from HTML, skipping the content of dropped tags
+func htmlToText(input string) string {
+	var (
+		out       strings.Builder
+		tokenizer = xhtml.NewTokenizer(strings.NewReader(input))
+		skipDepth int
+	)
+	for {
+		tt := tokenizer.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		token := tokenizer.Token()
+		switch tt {
+		case xhtml.StartTagToken:
+			if droppedTags[token.Data] {
+				skipDepth++
+			}
+		case xhtml.EndTagToken:
+			if droppedTags[token.Data] && skipDepth > 0 {
+				skipDepth--
+			}
+		case xhtml.TextToken:
+			if skipDepth == 0 {
+				out.WriteString(token.Data)
+				out.WriteString(" ")
+			}
+		}
+	}
+	return out.String()
+}
+
+// Builds a short single-line summary for the feed item description
+func excerpt(text string, limit int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	runes := []rune(text)
+	cut := string(runes[:limit])
+	if i := strings.LastIndex(cut, " "); i > limit/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
@@ -0,0 +1,286 @@
+package newsletters
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	smtpIdleTimeout = 5 * time.Minute
+	maxRecipients   = 50
+	// Longest command line accepted, CRLF included; RFC 5321 allows 512
+	// octets, with room here for ESMTP parameters
+	maxLineLength = 1000
+	// Sessions served at once unless MaxConnections says otherwise
+	defaultMaxConnections = 100
+)
+
+var (
+	errServerClosed       = errors.New("smtp server closed")
+	errTooManyConnections = errors.New("too many smtp connections")
+	errLineTooLong        = errors.New("smtp line too long")
+)
+
+// A minimal receive-only SMTP server for inbound newsletters.
+//
+// Recipients are checked with accept while the envelope is being built so
+// unknown addresses are refused before any data is sent; accepted messages
+// are handed to deliver once DATA completes.
+type SMTPServer struct {
+	Hostname string
+	// Sessions served at once; further connections are turned away with a
+	// 421 until one ends
+	MaxConnections int
+
+	accept   func(rcpt string) bool
+	deliver  func(from string, to []string, data []byte) error
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// Creates a new inbound SMTP server
+func NewSMTPServer(hostname string, accept func(rcpt string) bool, deliver func(from string, to []string, data []byte) error) *SMTPServer {
+	return &SMTPServer{
+		Hostname:       hostname,
+		MaxConnections: defaultMaxConnections,
+		accept:         accept,
+		deliver:        deliver,
+		conns:          make(map[net.Conn]struct{}),
+	}
+}
+
+// Starts accepting connections on addr in the background and returns the bound address
+func (s *SMTPServer) Listen(addr string) (net.Addr, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for smtp: %w", err)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			switch err := s.track(conn); {
+			case errors.Is(err, errServerClosed):
+				conn.Close()
+				return
+			case errors.Is(err, errTooManyConnections):
+				conn.SetWriteDeadline(time.Now().Add(time.Second))
+				fmt.Fprintf(conn, "421 4.3.2 %s Too many connections, try again later\r\n", s.Hostname)
+				conn.Close()
+				continue
+			}
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				defer s.untrack(conn)
+				s.handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr(), nil
+}
+
+// Stops the listener, closes open sessions and waits for them to finish
+func (s *SMTPServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+func (s *SMTPServer) track(conn net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errServerClosed
+	}
+	if len(s.conns) >= s.MaxConnections {
+		return errTooManyConnections
+	}
+	s.conns[conn] = struct{}{}
+	return nil
+}
+
+func (s *SMTPServer) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// Runs a single SMTP session
+func (s *SMTPServer) handle(conn net.Conn) {
+	br := bufio.NewReaderSize(conn, maxLineLength)
+	tr := textproto.NewReader(br)
+	tw := textproto.NewWriter(bufio.NewWriter(conn))
+	reply := func(format string, args ...any) {
+		tw.PrintfLine(format, args...)
+	}
+
+	conn.SetDeadline(time.Now().Add(smtpIdleTimeout))
+	reply("220 %s ESMTP Versed", s.Hostname)
+
+	var (
+		greeted bool
+		from    string
+		hasFrom bool
+		rcpts   []string
+	)
+	reset := func() {
+		from, hasFrom, rcpts = "", false, nil
+	}
+
+	for {
+		conn.SetDeadline(time.Now().Add(smtpIdleTimeout))
+		line, err := readLine(br)
+		if errors.Is(err, errLineTooLong) {
+			reply("500 5.5.2 Line too long")
+			return
+		}
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			greeted = true
+			reset()
+			reply("250-%s", s.Hostname)
+			reply("250-SIZE %d", MaxMessageSize)
+			reply("250 8BITMIME")
+		case "HELO":
+			greeted = true
+			reset()
+			reply("250 %s", s.Hostname)
+		case "MAIL":
+			if !greeted {
+				reply("503 5.5.1 Send EHLO first")
+				continue
+			}
+			addr, ok := pathArg(arg, "FROM:")
+			if !ok {
+				reply("501 5.5.4 Syntax: MAIL FROM:<address>")
+				continue
+			}
+			reset()
+			from, hasFrom = addr, true
+			reply("250 2.1.0 OK")
+		case "RCPT":
+			if !hasFrom {
+				reply("503 5.5.1 Send MAIL first")
+				continue
+			}
+			addr, ok := pathArg(arg, "TO:")
+			if !ok || addr == "" {
+				reply("501 5.5.4 Syntax: RCPT TO:<address>")
+				continue
+			}
+			if len(rcpts) >= maxRecipients {
+				reply("452 4.5.3 Too many recipients")
+				continue
+			}
+			if !s.accept(addr) {
+				reply("550 5.1.1 No such mailbox")
+				continue
+			}
+			rcpts = append(rcpts, strings.ToLower(addr))
+			reply("250 2.1.5 OK")
+		case "DATA":
+			if len(rcpts) == 0 {
+				reply("503 5.5.1 Send RCPT first")
+				continue
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			body := tr.DotReader()
+			data, err := io.ReadAll(io.LimitReader(body, MaxMessageSize+1))
+			if err != nil {
+				return
+			}
+			if len(data) > MaxMessageSize {
+				if _, err := io.Copy(io.Discard, body); err != nil {
+					return
+				}
+				reply("552 5.3.4 Message too large")
+				reset()
+				continue
+			}
+			if err := s.deliver(from, rcpts, data); err != nil {
+				logger.Warn("Failed to deliver inbound newsletter", "recipients", len(rcpts), "err", err)
+				if errors.Is(err, ErrUnknownRecipient) {
+					reply("550 5.1.1 No such mailbox")
+				} else {
+					reply("554 5.6.0 Message could not be processed")
+				}
+			} else {
+				reply("250 2.0.0 OK")
+			}
+			reset()
+		case "RSET":
+			reset()
+			reply("250 2.0.0 OK")
+		case "NOOP":
+			reply("250 2.0.0 OK")
+		case "VRFY":
+			reply("252 2.5.2 Cannot verify user")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// Reads a command line without its CRLF. Unlike textproto.Reader.ReadLine it
+// never buffers more than maxLineLength bytes, failing with errLineTooLong.
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// Extracts the address from a "FROM:<addr> PARAMS" or "TO:<addr>" argument
+func pathArg(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", false
+	}
+	end := strings.Index(rest, ">")
+	if end < 0 {
+		return "", false
+	}
+	return rest[1:end], true
+}
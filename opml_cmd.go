@@ -0,0 +1,286 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+)
+
+const importOPMLUsage = `usage: versed import-opml [-user USER] [-category NAME] FILE
+
+Adds every feed in an OPML file as a feed source. With -user the feeds are
+also put into that user's categories, named after the file's top-level
+folders; feeds outside any folder go into the -category one, "Imported" by
+default. Categories the user does not have yet are created.
+
+USER is a user ID or email address.`
+
+const exportOPMLUsage = `usage: versed export-opml [-user USER] [-o FILE]
+
+Writes every feed source as OPML, or with -user that user's categories and
+their feeds. The OPML goes to standard output unless -o is given.
+
+USER is a user ID or email address.`
+
+// Runs `versed import-opml ...` and returns the process exit code
+func runImportOPMLCommand(args []string) int {
+	flags := flag.NewFlagSet("import-opml", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, importOPMLUsage) }
+	userRef := flags.String("user", "", "user to add the feeds for")
+	fallback := flags.String("category", "Imported", "category for feeds outside any folder")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return 2
+	}
+	if len(args) != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	doc, err := feeds.ParseOPML(file)
+	file.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if _, ok := openConfiguredDatabase(); !ok {
+		return 1
+	}
+	defer database.CloseConnection()
+	db := database.GetDB()
+
+	userID := 0
+	if *userRef != "" {
+		user, err := findUser(db, *userRef)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		userID = user.ID
+	}
+
+	imported, failed := 0, 0
+	categories := make(map[string]int)
+	for _, feed := range doc.Feeds() {
+		if !isFeedURL(feed.URL) {
+			fmt.Fprintf(os.Stderr, "Skipping %s: %q is not an http or https URL\n", feed.Name, feed.URL)
+			failed++
+			continue
+		}
+		source, err := importFeedSource(db, feed.Name, feed.URL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to add %s: %v\n", feed.Name, err)
+			failed++
+			continue
+		}
+
+		if userID != 0 {
+			name := feed.Category
+			if name == "" {
+				name = *fallback
+			}
+			categoryID, known := categories[name]
+			if !known {
+				if categoryID, err = ensureUserCategory(db, userID, name); err != nil {
+					fmt.Fprintf(os.Stderr, "Failed to create category %s: %v\n", name, err)
+					failed++
+					continue
+				}
+				categories[name] = categoryID
+			}
+			if err := database.AddFeedToUserCategory(db, userID, categoryID, source.ID); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to add %s to %s: %v\n", source.Name, name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("%s: %s (%s)\n", name, source.Name, source.URL)
+		} else {
+			fmt.Printf("%s (%s)\n", source.Name, source.URL)
+		}
+		imported++
+	}
+
+	fmt.Printf("Imported %d feeds", imported)
+	if failed > 0 {
+		fmt.Printf(", %d failed", failed)
+	}
+	fmt.Println()
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// How many numbered variants of a taken feed source name importFeedSource
+// tries before giving up
+const maxNameVariants = 100
+
+// Returns the feed source for a URL, adding it if there is none. Feed source
+// names are unique, so a new source whose name is taken gets the URL's host
+// added to it, and then a number if that is taken too.
+func importFeedSource(db *sqldb.DB, name, feedURL string) (*feeds.FeedSource, error) {
+	if source, err := feeds.GetFeedSourceByURL(db, feedURL); err == nil {
+		return source, nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	candidate := name
+	withHost := name
+	if u, err := url.Parse(feedURL); err == nil && u.Host != "" {
+		withHost = fmt.Sprintf("%s (%s)", name, u.Host)
+	}
+	for n := 1; ; n++ {
+		_, err := feeds.GetFeedSourceByName(db, candidate)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n > maxNameVariants {
+			return nil, fmt.Errorf("%q and %d variants of it are already taken by other feed sources", name, maxNameVariants)
+		}
+		candidate = withHost
+		if n > 1 {
+			candidate = fmt.Sprintf("%s %d", withHost, n)
+		}
+	}
+	return feeds.CreateOrUpdateFeedSource(db, candidate, feedURL)
+}
+
+// Returns the ID of the user's category with the given name, creating it if
+// the user does not have one
+func ensureUserCategory(db *sqldb.DB, userID int, name string) (int, error) {
+	category, err := database.GetUserCategoryByName(db, userID, name)
+	if err == nil {
+		return category.ID, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+	category, err = database.CreateUserCategory(db, userID, name, "")
+	if err != nil {
+		return 0, err
+	}
+	return category.ID, nil
+}
+
+// Runs `versed export-opml ...` and returns the process exit code
+func runExportOPMLCommand(args []string) int {
+	flags := flag.NewFlagSet("export-opml", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, exportOPMLUsage) }
+	userRef := flags.String("user", "", "user whose categories to export")
+	output := flags.String("o", "", "file to write to")
+	args, ok := parseFlags(flags, args)
+	if !ok {
+		return 2
+	}
+	if len(args) != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if _, ok := openConfiguredDatabase(); !ok {
+		return 1
+	}
+	defer database.CloseConnection()
+	db := database.GetDB()
+
+	var (
+		doc *feeds.OPML
+		err error
+	)
+	if *userRef != "" {
+		doc, err = userOPML(db, *userRef)
+	} else {
+		doc, err = allSourcesOPML(db)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+	if err := doc.Write(w); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write OPML:", err)
+		return 1
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Wrote %d feeds to %s\n", len(doc.Feeds()), *output)
+	}
+	return 0
+}
+
+// Builds OPML listing every feed source that can be fetched over HTTP
+func allSourcesOPML(db *sqldb.DB) (*feeds.OPML, error) {
+	sources, err := feeds.GetAllFeedSources(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feed sources: %w", err)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].Name < sources[j].Name })
+
+	doc := feeds.NewOPML("Versed feeds", time.Now())
+	for _, source := range sources {
+		// Newsletter sources have no URL a feed reader could fetch
+		if !isFeedURL(source.URL) {
+			continue
+		}
+		doc.Body = append(doc.Body, feeds.OPMLOutline{Text: source.Name, Type: "rss", XMLURL: source.URL})
+	}
+	return doc, nil
+}
+
+// Builds OPML with a folder for each of a user's categories
+func userOPML(db *sqldb.DB, ref string) (*feeds.OPML, error) {
+	user, err := findUser(db, ref)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := database.GetUserCategories(db, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list categories: %w", err)
+	}
+
+	doc := feeds.NewOPML(user.Username+"'s Versed feeds", time.Now())
+	for _, category := range categories {
+		sources, err := database.GetFeedsInUserCategory(db, user.ID, category.ID)
+		if err != nil {
+			return nil, err
+		}
+		folder := feeds.OPMLOutline{Text: category.Name}
+		for _, source := range sources {
+			if !isFeedURL(source.URL) {
+				continue
+			}
+			folder.Outlines = append(folder.Outlines, feeds.OPMLOutline{Text: source.Name, Type: "rss", XMLURL: source.URL})
+		}
+		doc.Body = append(doc.Body, folder)
+	}
+	return doc, nil
+}
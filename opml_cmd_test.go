@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/navid-m/versed/feeds"
+)
+
+const testOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Reader export</title></head>
+  <body>
+    <outline text="Tech">
+      <outline text="Lobsters" type="rss" xmlUrl="https://lobste.rs/rss"/>
+      <outline text="Go blog" type="rss" xmlUrl="https://go.dev/blog/feed.atom"/>
+    </outline>
+    <outline text="News">
+      <outline text="Example" type="rss" xmlUrl="https://example.com/feed"/>
+    </outline>
+    <outline text="Loose" type="rss" xmlUrl="https://loose.example.org/rss"/>
+    <outline text="Mail" type="rss" xmlUrl="mailto:someone@example.com"/>
+  </body>
+</opml>`
+
+// Returns the feeds of an OPML file sorted, for comparing documents
+func opmlFeeds(t *testing.T, path string) []feeds.OPMLFeed {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	doc, err := feeds.ParseOPML(file)
+	if err != nil {
+		t.Fatalf("ParseOPML: %v", err)
+	}
+	found := doc.Feeds()
+	sort.Slice(found, func(i, j int) bool { return found[i].URL < found[j].URL })
+	return found
+}
+
+func TestOPMLRoundTrip(t *testing.T) {
+	configFile, _ := writeCLIConfig(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.opml")
+	if err := os.WriteFile(input, []byte(testOPML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, stderr := runCLI(t, "", "-config", configFile, "user", "create", "-password", "correct-horse-battery", "reader@example.com", "reader"); code != 0 {
+		t.Fatalf("user create = %d: %s", code, stderr)
+	}
+
+	code, stdout, stderr := runCLI(t, "", "-config", configFile, "import-opml", "-user", "reader@example.com", "-category", "Misc", input)
+	if code != 1 || !strings.Contains(stdout, "Imported 4 feeds, 1 failed") || !strings.Contains(stderr, "Skipping Mail") {
+		t.Errorf("import-opml = %d, stdout %q, stderr %q; want the mailto feed skipped", code, stdout, stderr)
+	}
+	// Importing again finds the same sources rather than adding copies
+	if code, stdout, _ := runCLI(t, "", "-config", configFile, "import-opml", input); code != 1 || !strings.Contains(stdout, "Imported 4 feeds") {
+		t.Errorf("second import-opml = %d, %q", code, stdout)
+	}
+
+	output := filepath.Join(dir, "out.opml")
+	if code, _, stderr := runCLI(t, "", "-config", configFile, "export-opml", "-user", "reader@example.com", "-o", output); code != 0 {
+		t.Fatalf("export-opml = %d: %s", code, stderr)
+	}
+	want := []feeds.OPMLFeed{
+		{Category: "News", Name: "Example", URL: "https://example.com/feed"},
+		{Category: "Tech", Name: "Go blog", URL: "https://go.dev/blog/feed.atom"},
+		{Category: "Tech", Name: "Lobsters", URL: "https://lobste.rs/rss"},
+		{Category: "Misc", Name: "Loose", URL: "https://loose.example.org/rss"},
+	}
+	if got := opmlFeeds(t, output); !reflect.DeepEqual(got, want) {
+		t.Errorf("exported feeds = %+v, want %+v", got, want)
+	}
+
+	code, stdout, stderr = runCLI(t, "", "-config", configFile, "export-opml")
+	if code != 0 || !strings.Contains(stdout, `xmlUrl="https://lobste.rs/rss"`) || strings.Contains(stdout, "mailto:") {
+		t.Errorf("export-opml of every source = %d, stdout %q, stderr %q", code, stdout, stderr)
+	}
+	if code, _, stderr := runCLI(t, "", "-config", configFile, "export-opml", "-user", "nobody@example.com"); code != 1 || !strings.Contains(stderr, "no user matches") {
+		t.Errorf("export-opml for a missing user = %d, %q", code, stderr)
+	}
+}
+
+func TestImportFeedSourceNameCollision(t *testing.T) {
+	db := openTestDB(t)
+	blog, err := feeds.CreateOrUpdateFeedSource(db, "Blog", "https://blog.example.com/rss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := feeds.CreateOrUpdateFeedSource(db, "Blog (example.com)", "https://other.example.net/rss"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url, want string
+	}{
+		{"https://blog.example.com/rss", "Blog"},
+		{"https://example.com/feed", "Blog (example.com) 2"},
+		{"https://example.com/atom", "Blog (example.com) 3"},
+		{"https://example.com/feed", "Blog (example.com) 2"},
+	}
+	for _, tt := range tests {
+		source, err := importFeedSource(db, "Blog", tt.url)
+		if err != nil || source.Name != tt.want || source.URL != tt.url {
+			t.Errorf("importFeedSource(%q) = %+v, %v; want %q", tt.url, source, err, tt.want)
+		}
+	}
+	if source, _ := importFeedSource(db, "Blog", blog.URL); source == nil || source.ID != blog.ID {
+		t.Errorf("importing an existing URL returned %+v, want source %d", source, blog.ID)
+	}
+
+	for n := 4; n <= maxNameVariants; n++ {
+		name := fmt.Sprintf("Blog (example.com) %d", n)
+		if _, err := feeds.CreateOrUpdateFeedSource(db, name, fmt.Sprintf("https://example.com/%d", n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if source, err := importFeedSource(db, "Blog", "https://example.com/one-too-many"); err == nil {
+		t.Errorf("importFeedSource with every name taken = %+v, want an error", source)
+	}
+}
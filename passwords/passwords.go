@@ -0,0 +1,23 @@
+// Package passwords hashes users' passwords for storage and checks
+// passwords against the stored hashes.
+package passwords
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hashes a password the way every stored password is hashed
+func Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("error hashing password: %v", err)
+	}
+	return string(hashed), nil
+}
+
+// Checks a password against a hash made by Hash, failing if they do not match
+func Verify(hashed, password string) error {
+	return bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
+}
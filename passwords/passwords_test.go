@@ -0,0 +1,22 @@
+package passwords
+
+import "testing"
+
+func TestHashAndVerify(t *testing.T) {
+	hashed, err := Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if hashed == "correct horse" {
+		t.Fatal("Hash returned the password itself")
+	}
+	if err := Verify(hashed, "correct horse"); err != nil {
+		t.Errorf("Verify with the right password = %v", err)
+	}
+	if err := Verify(hashed, "wrong horse"); err == nil {
+		t.Error("Verify accepted the wrong password")
+	}
+	if err := Verify("", "correct horse"); err == nil {
+		t.Error("Verify accepted a password for an account without one")
+	}
+}
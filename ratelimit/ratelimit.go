@@ -0,0 +1,68 @@
+// Package ratelimit counts recent attempts per key, such as an IP address or
+// an email address, to turn away callers who try too often.
+//
+// Counts are kept in memory, so each process limits on its own and the
+// counts start over when it restarts.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// How many Allow calls pass between sweeps of keys that have gone quiet
+const sweepEvery = 1024
+
+// Allows up to a number of attempts per key within a sliding window
+type Limiter struct {
+	limit  int
+	window time.Duration
+
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+	calls    int
+}
+
+// Creates a limiter allowing limit attempts per key in any window
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		window:   window,
+		attempts: make(map[string][]time.Time),
+	}
+}
+
+// Records an attempt for key at now and reports whether it is within the
+// limit. Turned-away attempts are not counted.
+func (l *Limiter) Allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		for k, times := range l.attempts {
+			if len(recent(times, now, l.window)) == 0 {
+				delete(l.attempts, k)
+			}
+		}
+	}
+
+	times := recent(l.attempts[key], now, l.window)
+	if len(times) >= l.limit {
+		l.attempts[key] = times
+		return false
+	}
+	l.attempts[key] = append(times, now)
+	return true
+}
+
+// Drops the attempts that fell out of the window before now. times is oldest
+// first.
+func recent(times []time.Time, now time.Time, window time.Duration) []time.Time {
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
@@ -0,0 +1,40 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := New(2, time.Hour)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, want := range []bool{true, true, false, false} {
+		if got := l.Allow("a", start.Add(time.Duration(i)*time.Minute)); got != want {
+			t.Errorf("attempt %d = %v, want %v", i+1, got, want)
+		}
+	}
+	if !l.Allow("b", start) {
+		t.Error("another key was limited")
+	}
+
+	// The first attempt falls out of the window; refused ones never counted
+	if !l.Allow("a", start.Add(time.Hour+time.Second)) {
+		t.Error("attempt after the window was refused")
+	}
+	if l.Allow("a", start.Add(time.Hour+2*time.Second)) {
+		t.Error("third attempt within the window was allowed")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	l := New(1, time.Minute)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	l.Allow("quiet", start)
+	for i := 0; i < sweepEvery; i++ {
+		l.Allow("busy", start.Add(time.Hour))
+	}
+	if _, ok := l.attempts["quiet"]; ok {
+		t.Error("a key with no recent attempts was not swept")
+	}
+}
@@ -0,0 +1,418 @@
+// Package repository defines the storage interfaces the web handlers depend on.
+//
+// The SQL implementation lives in the database package (see
+// database.NewRepositories); repositorytest provides an in-memory fake for
+// tests.
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/search"
+)
+
+// Returned when a looked-up record does not exist
+var ErrNotFound = errors.New("not found")
+
+// Returned when creating or updating a user with another user's email address
+var ErrEmailTaken = errors.New("email already in use")
+
+// Returned when creating or updating a user with another user's username
+var ErrUsernameTaken = errors.New("username already taken")
+
+// Aggregated feed items
+type FeedItems interface {
+	// Newest items first, paged; when userID is non-zero the user's hidden items are left out
+	Latest(userID, limit, offset int) ([]feeds.FeedItem, error)
+	BySource(sourceID, limit int) ([]feeds.FeedItem, error)
+	ByID(itemID string) (*feeds.FeedItem, error)
+	// Newest items from the feeds in one of a user's categories
+	ForCategory(userID, categoryID, limit int) ([]feeds.FeedItem, error)
+	// Runs a parsed search query, best matches first
+	Search(query *search.Query, limit, offset int) ([]feeds.FeedItem, error)
+	Save(items []feeds.FeedItem) error
+	// Records an upvote or downvote and returns the item's new score
+	Vote(userID int, itemID, voteType string) (int, error)
+}
+
+// Feed sources that get fetched
+type Sources interface {
+	ByID(id int) (*feeds.FeedSource, error)
+	ByName(name string) (*feeds.FeedSource, error)
+	// Returns the source with the given URL, creating it if needed
+	CreateOrUpdate(name, url string) (*feeds.FeedSource, error)
+	All() ([]feeds.FeedSource, error)
+	MarkUpdated(id int) error
+	// Marks the feeds in a user's category as due for fetching, returning how many were reset
+	ResetForCategory(userID, categoryID int) (int64, error)
+}
+
+// User accounts along with their reading lists and hidden items
+type Users interface {
+	// Creates a user with a hashed password and the default categories
+	Create(email, username, password, ipAddress string) error
+	ByID(userID int) (*models.User, error)
+	// Matches the address ignoring case, preferring an exact match
+	ByEmail(email string) (*models.User, error)
+	// Hashes password when it is not empty and leaves the old one otherwise
+	Update(userID int, email, username, password string) error
+	// Records the address a user is changing to until it is confirmed; an
+	// empty email clears it. Fails with ErrEmailTaken.
+	SetPendingEmail(userID int, email string) error
+	// Marks email as verified, making it the user's address when it was the
+	// pending one. Fails with ErrNotFound when it is neither, or ErrEmailTaken.
+	ConfirmEmail(userID int, email string) error
+	All() ([]models.User, error)
+	IsAdmin(userID int) (bool, error)
+
+	// Returns false if the item was already saved
+	SaveToReadingList(userID int, itemID string) (bool, error)
+	RemoveFromReadingList(userID int, itemID string) error
+	IsInReadingList(userID int, itemID string) (bool, error)
+	ReadingList(userID int) ([]feeds.FeedItem, error)
+
+	Hide(userID int, itemID string) error
+	Unhide(userID int, itemID string) error
+	IsHidden(userID int, itemID string) (bool, error)
+	HiddenIDs(userID int) ([]string, error)
+}
+
+// Users' own groupings of feed sources
+type Categories interface {
+	Create(userID int, name, description string) (*models.UserCategory, error)
+	List(userID int) ([]models.UserCategory, error)
+	ByID(userID, categoryID int) (*models.UserCategory, error)
+	// Looks a category up by name, ignoring case
+	ByName(userID int, name string) (*models.UserCategory, error)
+	Update(userID, categoryID int, name, description string) error
+	Delete(userID, categoryID int) error
+	AddFeed(userID, categoryID, feedSourceID int) error
+	RemoveFeed(userID, categoryID, feedSourceID int) error
+	Feeds(userID, categoryID int) ([]feeds.FeedSource, error)
+}
+
+// Comments on feed items
+type Comments interface {
+	Create(itemID string, userID int, username, content string, parentID *int) (*models.Comment, error)
+	// Top-level comments for an item, oldest first, with replies nested
+	ForItem(itemID string) ([]models.Comment, error)
+	ByID(commentID int) (*models.Comment, error)
+	// Full-text search over comment content, best matches first
+	Search(query string, limit, offset int) ([]models.Comment, error)
+	Update(commentID int, content string) error
+	Delete(commentID int) error
+}
+
+// User-submitted subverse posts and their comments
+type Posts interface {
+	Create(subverseID, userID int, username, title, content, postType, url string) (*models.Post, error)
+	ByID(postID string) (*models.Post, error)
+	ForSubverse(subverseID, limit, offset int) ([]models.Post, error)
+	Search(subverseID int, query string, limit, offset int) ([]models.Post, error)
+	// Only the author may update or delete a post
+	Update(postID string, userID int, title, content string) error
+	Delete(postID string, userID int) error
+	Vote(userID int, postID, voteType string) error
+
+	CreateComment(postID string, userID int, username, content string, parentID *string) (*models.PostComment, error)
+	Comments(postID string) ([]models.PostComment, error)
+	UpdateComment(commentID string, userID int, content string) error
+	DeleteComment(commentID string, userID int) error
+}
+
+// Subverses and the feeds attached to them
+type Subverses interface {
+	Create(name string) (*models.Subverse, error)
+	List() ([]models.Subverse, error)
+	ByID(id int) (*models.Subverse, error)
+	ByName(name string) (*models.Subverse, error)
+	AddFeed(subverseID, feedSourceID int) error
+	RemoveFeed(subverseID, feedSourceID int) error
+	Feeds(subverseID int) ([]feeds.FeedSource, error)
+	UpdatePostCount(subverseID int) error
+}
+
+// Users' saved feed searches, which count the new items matching them
+type SavedSearches interface {
+	Create(userID int, name, query string) (*models.SavedSearch, error)
+	// A user's saved searches by name, with their unseen match counts
+	List(userID int) ([]models.SavedSearch, error)
+	ByID(userID, id int) (*models.SavedSearch, error)
+	// Looks a saved search up by name, ignoring case
+	ByName(userID int, name string) (*models.SavedSearch, error)
+	// Changing the query drops the matches recorded so far
+	Update(userID, id int, name, query string) error
+	Delete(userID, id int) error
+	// Marks every match recorded so far as seen
+	MarkSeen(userID, id int) error
+}
+
+// Searches every kind of content at once
+type Search interface {
+	// Runs a query over each content type, one page per type, with facet counts
+	All(query *search.Query, opts SearchOptions) (*SearchResults, error)
+}
+
+// Content types a global search covers
+const (
+	SearchFeedItems    = "items"
+	SearchPosts        = "posts"
+	SearchComments     = "comments"
+	SearchPostComments = "post_comments"
+	SearchSubverses    = "subverses"
+	SearchUsers        = "users"
+)
+
+// Every content type, in the order results are shown
+var SearchTypes = []string{SearchFeedItems, SearchPosts, SearchComments, SearchPostComments, SearchSubverses, SearchUsers}
+
+// Narrows a global search
+type SearchOptions struct {
+	// Only searches this content type when set
+	Type string
+	// Only feed items from the source with this name when set
+	Source string
+	// Only posts in the subverse with this name when set
+	Subverse string
+	// Applies to each content type separately
+	Limit, Offset int
+}
+
+// One page of global search results per content type.
+//
+// Field filters such as source: or score: only apply to feed items, so a
+// query using them matches no other type.
+type SearchResults struct {
+	FeedItems    []feeds.FeedItem     `json:"items"`
+	Posts        []models.Post        `json:"posts"`
+	Comments     []models.Comment     `json:"comments"`
+	PostComments []models.PostComment `json:"post_comments"`
+	Subverses    []models.Subverse    `json:"subverses"`
+	Users        []UserMatch          `json:"users"`
+	Facets       SearchFacets         `json:"facets"`
+}
+
+// A user found by a global search, without any private details
+type UserMatch struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// Match counts for a global search.
+//
+// They cover every match of the query, ignoring the type, source and
+// subverse the results were narrowed to, so they can be used to narrow them.
+type SearchFacets struct {
+	// Matches per content type
+	Types map[string]int `json:"types"`
+	// Feed item matches per source name, most first
+	Sources []FacetCount `json:"sources"`
+	// Post matches per subverse name, most first
+	Subverses []FacetCount `json:"subverses"`
+}
+
+// The number of matches with one facet value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Banned client IP addresses
+type Bans interface {
+	Ban(ipAddress, reason string, bannedBy int) error
+	Unban(ipAddress string, unbannedBy int) error
+	IsBanned(ipAddress string) (bool, error)
+	List() ([]models.BannedIP, error)
+}
+
+// Web session storage; satisfies fiber.Storage
+type Sessions interface {
+	Get(key string) ([]byte, error)
+	Set(key string, val []byte, exp time.Duration) error
+	Delete(key string) error
+	Reset() error
+	Close() error
+	// Ends every session signed in as the given user
+	DeleteForUser(userID int) error
+}
+
+// Users' TOTP secrets and recovery codes, and whether admins must use them
+type TwoFactor interface {
+	// Fails with ErrNotFound when the user never started setting it up
+	ByUser(userID int) (*models.TwoFactor, error)
+	// Stores a secret awaiting its first code, replacing any earlier one that
+	// was never confirmed
+	SetSecret(userID int, secret string) error
+	// Turns two-factor sign-in on once a code for the secret checked out at
+	// step, and replaces the recovery codes with the given hashes
+	Enable(userID int, step int64, recoveryHashes []string) error
+	// Turns two-factor sign-in off, forgetting the secret and recovery codes
+	Disable(userID int) error
+	// Records the step of an accepted code, returning false when a code from
+	// it or a later step was already used
+	UseStep(userID int, step int64) (bool, error)
+	// Uses up a recovery code by its hash, returning false when the user has
+	// no such unused code
+	UseRecoveryCode(userID int, hash string) (bool, error)
+	ReplaceRecoveryCodes(userID int, hashes []string) error
+	RecoveryCodesLeft(userID int) (int, error)
+
+	RequiredForAdmins() (bool, error)
+	SetRequiredForAdmins(required bool) error
+}
+
+// Users' personal access tokens, looked up by the hash of the token
+type APITokens interface {
+	Create(userID int, name, hash string, scopes []string) (*models.APIToken, error)
+	// A user's tokens, newest first
+	List(userID int) ([]models.APIToken, error)
+	// Fails with ErrNotFound for a token that does not exist or was revoked
+	ByHash(hash string) (*models.APIToken, error)
+	MarkUsed(id int) error
+	// Revokes one of a user's tokens, failing with ErrNotFound if they have
+	// no such token
+	Delete(userID, id int) error
+	// Revokes every token a user has, when their password is reset or changed
+	DeleteForUser(userID int) error
+}
+
+// Single-use password reset tokens, looked up by the hash of the token
+type ResetTokens interface {
+	// Records a token that works until expiresAt
+	Create(userID int, hash, ipAddress string, expiresAt time.Time) error
+	// Returns the user an unused, unexpired token belongs to, failing with
+	// ErrNotFound if there is no such token or the user was deleted
+	User(hash string, now time.Time) (int, error)
+	// Uses up a token along with every other token its user has and returns
+	// the user, failing with ErrNotFound if it was used or expired meanwhile
+	Use(hash string, now time.Time) (int, error)
+	DeleteExpired(before time.Time) error
+}
+
+// Users' webhooks and the log of what was sent to them
+type Webhooks interface {
+	Create(userID int, name, url, secret, matchType, matchValue string) (*models.Webhook, error)
+	// A user's webhooks, newest first, without their secrets
+	List(userID int) ([]models.Webhook, error)
+	// Fails with ErrNotFound if the user has no such webhook
+	ByID(userID, id int) (*models.Webhook, error)
+	// Fails with ErrNotFound if the user has no such webhook
+	Update(userID, id int, name, url, matchType, matchValue string, enabled bool) error
+	// Deletes a webhook along with its delivery log, failing with ErrNotFound
+	// if the user has no such webhook
+	Delete(userID, id int) error
+	// A webhook's most recent deliveries, newest first
+	Deliveries(webhookID, limit int) ([]models.WebhookDelivery, error)
+}
+
+// Users' email digest schedules
+type Digests interface {
+	// Creates a subscription with digests off the first time it is asked for
+	Subscription(userID int) (*models.DigestSubscription, error)
+	// Fails for a frequency other than off, daily or weekly
+	SetFrequency(userID int, frequency string) error
+	// Turns off digests for the subscription with the given unsubscribe
+	// token, returning false when there is none
+	Unsubscribe(token string) (bool, error)
+}
+
+// Users' inbound newsletter addresses and the mail received on them
+type Newsletters interface {
+	// Also creates the feed source the address's mail is filed under, named
+	// after the address or, when that is taken, the address and local part
+	CreateAddress(userID int, name, localPart string) (*models.NewsletterAddress, error)
+	// A user's addresses by name
+	Addresses(userID int) ([]models.NewsletterAddress, error)
+	// Fails with ErrNotFound if the user has no such address
+	DeleteAddress(userID, id int) error
+	// Stores the full body of a newsletter filed as a feed item
+	SaveMessage(msg models.NewsletterMessage) error
+	// The newsletter filed as the given feed item, failing with ErrNotFound
+	// unless it was sent to the user
+	Message(userID int, itemID string) (*models.NewsletterMessage, error)
+}
+
+// Deletions of user accounts, which wait out a grace period once scheduled
+type AccountDeletions interface {
+	// Fails with ErrNotFound for a user that does not exist or was deleted
+	Schedule(userID int, at time.Time) error
+	Cancel(userID int) error
+	// When the user's account is to be deleted, or nil if it is not
+	// scheduled. Fails with ErrNotFound for a user that does not exist.
+	Scheduled(userID int) (*time.Time, error)
+	// The users whose scheduled deletion is due at now, by ID
+	Due(now time.Time) ([]int, error)
+	// Removes the user's personal data, takes back their votes and ends their
+	// sessions. Their comments and posts stay up, shown under
+	// models.DeletedUsername. Deleting an account twice does nothing.
+	Delete(userID int, now time.Time) error
+}
+
+// Users' data exports and the data that goes into them
+type DataExports interface {
+	// Queues an export of the user's data
+	Create(userID int) (*models.DataExport, error)
+	// Fails with ErrNotFound if there is no such export
+	ByID(id int) (*models.DataExport, error)
+	// A user's exports, newest first
+	List(userID int) ([]models.DataExport, error)
+	// The exports still waiting to be built, oldest first, including any a
+	// previous process left running
+	Pending() ([]models.DataExport, error)
+	MarkRunning(id int) error
+	// Records that an export's archive can be downloaded until expiresAt
+	MarkReady(id int, fileSize int64, completedAt, expiresAt time.Time) error
+	// Records why an export could not be built
+	MarkFailed(id int, reason string, completedAt time.Time) error
+	// Marks ready exports whose download window has passed as expired,
+	// returning their IDs
+	Expire(now time.Time) ([]int, error)
+	// Everything the user has put into Versed, failing with ErrNotFound for
+	// a user that does not exist
+	UserData(userID int) (*UserData, error)
+}
+
+// Everything a user has put into Versed, as gathered for a data export
+type UserData struct {
+	User         models.User
+	Categories   []CategoryFeeds
+	ReadingList  []feeds.FeedItem
+	Hidden       []models.HiddenItem
+	ItemVotes    []models.ItemVote
+	PostVotes    []models.Vote
+	Comments     []models.Comment
+	PostComments []models.PostComment
+	Posts        []models.Post
+}
+
+// One of a user's categories along with its feeds
+type CategoryFeeds struct {
+	models.UserCategory
+	Feeds []feeds.FeedSource `json:"feeds"`
+}
+
+// Every repository the web handlers use
+type Repositories struct {
+	FeedItems        FeedItems
+	Sources          Sources
+	Users            Users
+	Categories       Categories
+	Comments         Comments
+	Posts            Posts
+	Subverses        Subverses
+	SavedSearches    SavedSearches
+	Search           Search
+	Bans             Bans
+	Sessions         Sessions
+	TwoFactor        TwoFactor
+	APITokens        APITokens
+	Webhooks         Webhooks
+	Digests          Digests
+	Newsletters      Newsletters
+	ResetTokens      ResetTokens
+	AccountDeletions AccountDeletions
+	DataExports      DataExports
+}
@@ -0,0 +1,2481 @@
+// Package repositorytest provides in-memory repositories for tests, so
+// handlers can be exercised without a database.
+package repositorytest
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+	"github.com/navid-m/versed/repository"
+	"github.com/navid-m/versed/search"
+)
+
+// Holds every record; the repositories returned by New share one store.
+//
+// Strings that end up as map keys are cloned first: fiber hands handlers
+// route parameters that alias its request buffer, which the SQL
+// implementation copies implicitly.
+type store struct {
+	mu     sync.Mutex
+	nextID int
+
+	items         map[string]feeds.FeedItem
+	itemVotes     map[string]map[int]string
+	sources       map[int]feeds.FeedSource
+	users         map[int]models.User
+	readingList   map[int]map[string]time.Time
+	hidden        map[int]map[string]bool
+	categories    map[int]models.UserCategory
+	categoryFeeds map[int]map[int]bool
+	comments      map[int]models.Comment
+	posts         map[string]models.Post
+	postVotes     map[string]map[int]string
+	postComments  map[string]models.PostComment
+	subverses     map[int]models.Subverse
+	subverseFeeds map[int]map[int]bool
+	savedSearches map[int]models.SavedSearch
+	bans          map[string]models.BannedIP
+	sessions      map[string]session
+	twoFactor     map[int]models.TwoFactor
+	// Recovery code hashes by user, mapped to whether they were used
+	recoveryCodes map[int]map[string]bool
+	adminsNeed2FA bool
+	apiTokens     map[int]apiToken
+	webhooks      map[int]models.Webhook
+	deliveries    map[int]models.WebhookDelivery
+	digests       map[int]models.DigestSubscription
+	newsletters   map[int]models.NewsletterAddress
+	messages      map[string]models.NewsletterMessage
+	resetTokens   map[string]resetToken
+	// When each user's account is scheduled to be deleted
+	deletions map[int]time.Time
+	deleted   map[int]bool
+	exports   map[int]models.DataExport
+}
+
+type apiToken struct {
+	models.APIToken
+	hash string
+}
+
+type resetToken struct {
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+type session struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// Returns a fresh set of empty in-memory repositories
+func New() repository.Repositories {
+	s := &store{
+		items:         make(map[string]feeds.FeedItem),
+		itemVotes:     make(map[string]map[int]string),
+		sources:       make(map[int]feeds.FeedSource),
+		users:         make(map[int]models.User),
+		readingList:   make(map[int]map[string]time.Time),
+		hidden:        make(map[int]map[string]bool),
+		categories:    make(map[int]models.UserCategory),
+		categoryFeeds: make(map[int]map[int]bool),
+		comments:      make(map[int]models.Comment),
+		posts:         make(map[string]models.Post),
+		postVotes:     make(map[string]map[int]string),
+		postComments:  make(map[string]models.PostComment),
+		subverses:     make(map[int]models.Subverse),
+		subverseFeeds: make(map[int]map[int]bool),
+		savedSearches: make(map[int]models.SavedSearch),
+		bans:          make(map[string]models.BannedIP),
+		sessions:      make(map[string]session),
+		twoFactor:     make(map[int]models.TwoFactor),
+		recoveryCodes: make(map[int]map[string]bool),
+		apiTokens:     make(map[int]apiToken),
+		webhooks:      make(map[int]models.Webhook),
+		deliveries:    make(map[int]models.WebhookDelivery),
+		digests:       make(map[int]models.DigestSubscription),
+		newsletters:   make(map[int]models.NewsletterAddress),
+		messages:      make(map[string]models.NewsletterMessage),
+		resetTokens:   make(map[string]resetToken),
+		deletions:     make(map[int]time.Time),
+		deleted:       make(map[int]bool),
+		exports:       make(map[int]models.DataExport),
+	}
+	return repository.Repositories{
+		FeedItems:        feedItems{s},
+		Sources:          sources{s},
+		Users:            users{s},
+		Categories:       categories{s},
+		Comments:         comments{s},
+		Posts:            posts{s},
+		Subverses:        subverses{s},
+		SavedSearches:    savedSearches{s},
+		Search:           searcher{s},
+		Bans:             bans{s},
+		Sessions:         sessions{s},
+		TwoFactor:        twoFactor{s},
+		APITokens:        apiTokens{s},
+		Webhooks:         webhooks{s},
+		Digests:          digests{s},
+		Newsletters:      newsletters{s},
+		ResetTokens:      resetTokens{s},
+		AccountDeletions: accountDeletions{s},
+		DataExports:      dataExports{s},
+	}
+}
+
+// Hands out IDs for every table; callers must hold the lock
+func (s *store) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+// Reports whether an item is one of a user's newsletters, which is left out
+// of listings shared between users; callers must hold the lock
+func (s *store) private(item feeds.FeedItem) bool {
+	return s.sources[item.SourceID].IsNewsletter()
+}
+
+// Fills in the source name and returns a copy; callers must hold the lock
+func (s *store) item(item feeds.FeedItem) feeds.FeedItem {
+	item.SourceName = s.sources[item.SourceID].Name
+	return item
+}
+
+// Sorts items newest first by publication date, like the SQL queries do
+func sortByPublished(items []feeds.FeedItem) {
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].PublishedAt, items[j].PublishedAt
+		if a == nil || b == nil {
+			return b == nil && a != nil
+		}
+		return a.After(*b)
+	})
+}
+
+// Applies LIMIT and OFFSET to a slice
+func page[T any](all []T, limit, offset int) []T {
+	if offset >= len(all) {
+		return nil
+	}
+	all = all[offset:]
+	if limit >= 0 && limit < len(all) {
+		all = all[:limit]
+	}
+	return all
+}
+
+type feedItems struct{ s *store }
+
+func (r feedItems) Latest(userID, limit, offset int) ([]feeds.FeedItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var items []feeds.FeedItem
+	for _, item := range r.s.items {
+		if userID != 0 && r.s.hidden[userID][item.ID] || r.s.private(item) {
+			continue
+		}
+		items = append(items, r.s.item(item))
+	}
+	sortByPublished(items)
+	return page(items, limit, offset), nil
+}
+
+func (r feedItems) BySource(sourceID, limit int) ([]feeds.FeedItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var items []feeds.FeedItem
+	for _, item := range r.s.items {
+		if item.SourceID == sourceID {
+			items = append(items, item)
+		}
+	}
+	sortByPublished(items)
+	return page(items, limit, 0), nil
+}
+
+func (r feedItems) ByID(itemID string) (*feeds.FeedItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	item, ok := r.s.items[itemID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	item = r.s.item(item)
+	return &item, nil
+}
+
+func (r feedItems) ForCategory(userID, categoryID, limit int) ([]feeds.FeedItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	category, ok := r.s.categories[categoryID]
+	if !ok || category.UserID != userID {
+		return nil, nil
+	}
+	var items []feeds.FeedItem
+	for _, item := range r.s.items {
+		if r.s.categoryFeeds[categoryID][item.SourceID] {
+			items = append(items, r.s.item(item))
+		}
+	}
+	sortByPublished(items)
+	return page(items, limit, 0), nil
+}
+
+func (r feedItems) Search(query *search.Query, limit, offset int) ([]feeds.FeedItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var items []feeds.FeedItem
+	if query.Empty() {
+		return nil, nil
+	}
+	for _, item := range r.s.items {
+		item = r.s.item(item)
+		if !r.s.private(item) && r.s.matchesItem(query, item) {
+			items = append(items, item)
+		}
+	}
+	sortByPublished(items)
+	return page(items, limit, offset), nil
+}
+
+func (r feedItems) Save(items []feeds.FeedItem) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, item := range items {
+		if existing, ok := r.s.items[item.ID]; ok {
+			item.Score = existing.Score
+			item.CreatedAt = existing.CreatedAt
+		} else if item.CreatedAt == nil {
+			now := time.Now()
+			item.CreatedAt = &now
+		}
+		item.SourceName = ""
+		r.s.items[item.ID] = item
+	}
+	return nil
+}
+
+func (r feedItems) Vote(userID int, itemID, voteType string) (int, error) {
+	itemID = strings.Clone(itemID)
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	item, ok := r.s.items[itemID]
+	if !ok {
+		return 0, fmt.Errorf("failed to get current score: %w", repository.ErrNotFound)
+	}
+	votes := r.s.itemVotes[itemID]
+	if votes == nil {
+		votes = make(map[int]string)
+		r.s.itemVotes[itemID] = votes
+	}
+
+	delta := map[string]int{"upvote": 1, "downvote": -1}
+	if existing, voted := votes[userID]; voted {
+		item.Score -= delta[existing]
+		delete(votes, userID)
+		if existing == voteType {
+			r.s.items[itemID] = item
+			return item.Score, nil
+		}
+	}
+	votes[userID] = voteType
+	item.Score += delta[voteType]
+	r.s.items[itemID] = item
+	return item.Score, nil
+}
+
+type sources struct{ s *store }
+
+func (r sources) find(match func(feeds.FeedSource) bool) (*feeds.FeedSource, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, source := range r.s.sources {
+		if match(source) {
+			return &source, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r sources) ByID(id int) (*feeds.FeedSource, error) {
+	return r.find(func(source feeds.FeedSource) bool { return source.ID == id })
+}
+
+func (r sources) ByName(name string) (*feeds.FeedSource, error) {
+	return r.find(func(source feeds.FeedSource) bool { return source.Name == name })
+}
+
+func (r sources) CreateOrUpdate(name, url string) (*feeds.FeedSource, error) {
+	if existing, err := r.find(func(source feeds.FeedSource) bool { return source.URL == url }); err == nil {
+		return existing, nil
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	source := feeds.FeedSource{
+		ID:             r.s.id(),
+		Name:           name,
+		URL:            url,
+		LastUpdated:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdateInterval: 3600,
+	}
+	r.s.sources[source.ID] = source
+	return &source, nil
+}
+
+func (r sources) All() ([]feeds.FeedSource, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var all []feeds.FeedSource
+	for _, source := range r.s.sources {
+		all = append(all, source)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all, nil
+}
+
+func (r sources) MarkUpdated(id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if source, ok := r.s.sources[id]; ok {
+		source.LastUpdated = time.Now().UTC()
+		r.s.sources[id] = source
+	}
+	return nil
+}
+
+func (r sources) ResetForCategory(userID, categoryID int) (int64, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if category, ok := r.s.categories[categoryID]; !ok || category.UserID != userID {
+		return 0, nil
+	}
+	var reset int64
+	for id := range r.s.categoryFeeds[categoryID] {
+		source := r.s.sources[id]
+		source.LastUpdated = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		r.s.sources[id] = source
+		reset++
+	}
+	return reset, nil
+}
+
+type users struct{ s *store }
+
+func (r users) Create(email, username, password, ipAddress string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, user := range r.s.users {
+		if user.Email == email {
+			return repository.ErrEmailTaken
+		}
+		if user.Username == username {
+			return repository.ErrUsernameTaken
+		}
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %v", err)
+	}
+	id := r.s.id()
+	r.s.users[id] = models.User{ID: id, Email: email, Username: username, Password: string(hashed), IPAddress: ipAddress}
+
+	for _, defaults := range models.DefaultCategories {
+		category := models.UserCategory{ID: r.s.id(), UserID: id, Name: defaults.Name, Description: "Default " + defaults.Name + " feeds", CreatedAt: time.Now()}
+		r.s.categories[category.ID] = category
+		r.s.categoryFeeds[category.ID] = make(map[int]bool)
+		for _, feed := range defaults.Feeds {
+			r.s.categoryFeeds[category.ID][r.s.ensureSource(feed.Name, feed.URL)] = true
+		}
+	}
+	return nil
+}
+
+// Returns the ID of the source with the given name, creating it if needed;
+// callers must hold the lock
+func (s *store) ensureSource(name, url string) int {
+	for _, source := range s.sources {
+		if source.Name == name {
+			return source.ID
+		}
+	}
+	source := feeds.FeedSource{
+		ID:             s.id(),
+		Name:           name,
+		URL:            url,
+		LastUpdated:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		UpdateInterval: 3600,
+	}
+	s.sources[source.ID] = source
+	return source.ID
+}
+
+func (r users) ByID(userID int) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r users) ByEmail(email string) (*models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var found *models.User
+	for _, user := range r.s.users {
+		if user.Email == email {
+			return &user, nil
+		}
+		if strings.EqualFold(user.Email, email) && (found == nil || user.ID < found.ID) {
+			found = &user
+		}
+	}
+	if found == nil {
+		return nil, repository.ErrNotFound
+	}
+	return found, nil
+}
+
+func (r users) Update(userID int, email, username, password string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return nil
+	}
+	for id, other := range r.s.users {
+		if id == userID {
+			continue
+		}
+		if other.Email == email {
+			return repository.ErrEmailTaken
+		}
+		if other.Username == username {
+			return repository.ErrUsernameTaken
+		}
+	}
+	user.Email = email
+	user.Username = username
+	if password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			return err
+		}
+		user.Password = string(hashed)
+	}
+	r.s.users[userID] = user
+	return nil
+}
+
+func (r users) SetPendingEmail(userID int, email string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	for id, other := range r.s.users {
+		if id != userID && email != "" && other.Email == email {
+			return repository.ErrEmailTaken
+		}
+	}
+	user.PendingEmail = email
+	r.s.users[userID] = user
+	return nil
+}
+
+func (r users) ConfirmEmail(userID int, email string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	switch {
+	case email == user.Email:
+	case user.PendingEmail != "" && email == user.PendingEmail:
+		for id, other := range r.s.users {
+			if id != userID && other.Email == email {
+				return repository.ErrEmailTaken
+			}
+		}
+		user.Email = email
+		user.PendingEmail = ""
+	default:
+		return repository.ErrNotFound
+	}
+	user.EmailVerified = true
+	r.s.users[userID] = user
+	return nil
+}
+
+func (r users) All() ([]models.User, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var all []models.User
+	for _, user := range r.s.users {
+		all = append(all, user)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all, nil
+}
+
+func (r users) IsAdmin(userID int) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return false, repository.ErrNotFound
+	}
+	return user.IsAdmin, nil
+}
+
+func (r users) SaveToReadingList(userID int, itemID string) (bool, error) {
+	itemID = strings.Clone(itemID)
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, saved := r.s.readingList[userID][itemID]; saved {
+		return false, nil
+	}
+	if r.s.readingList[userID] == nil {
+		r.s.readingList[userID] = make(map[string]time.Time)
+	}
+	r.s.readingList[userID][itemID] = time.Now()
+	return true, nil
+}
+
+func (r users) RemoveFromReadingList(userID int, itemID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.readingList[userID], itemID)
+	return nil
+}
+
+func (r users) IsInReadingList(userID int, itemID string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	_, saved := r.s.readingList[userID][itemID]
+	return saved, nil
+}
+
+func (r users) ReadingList(userID int) ([]feeds.FeedItem, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var items []feeds.FeedItem
+	for itemID := range r.s.readingList[userID] {
+		if item, ok := r.s.items[itemID]; ok {
+			items = append(items, r.s.item(item))
+			continue
+		}
+		if post, ok := r.s.posts[itemID]; ok {
+			createdAt := post.CreatedAt
+			items = append(items, feeds.FeedItem{
+				ID:          post.ID,
+				SourceName:  "Subverse Post",
+				Title:       post.Title,
+				URL:         post.URL,
+				Description: post.Content,
+				Author:      post.Username,
+				PublishedAt: &createdAt,
+				Score:       post.Score,
+				CreatedAt:   &createdAt,
+			})
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].CreatedAt, items[j].CreatedAt
+		return a != nil && (b == nil || a.After(*b))
+	})
+	return items, nil
+}
+
+func (r users) Hide(userID int, itemID string) error {
+	itemID = strings.Clone(itemID)
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.hidden[userID] == nil {
+		r.s.hidden[userID] = make(map[string]bool)
+	}
+	r.s.hidden[userID][itemID] = true
+	return nil
+}
+
+func (r users) Unhide(userID int, itemID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.hidden[userID], itemID)
+	return nil
+}
+
+func (r users) IsHidden(userID int, itemID string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.hidden[userID][itemID], nil
+}
+
+func (r users) HiddenIDs(userID int) ([]string, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var ids []string
+	for id := range r.s.hidden[userID] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+type categories struct{ s *store }
+
+func (r categories) Create(userID int, name, description string) (*models.UserCategory, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, category := range r.s.categories {
+		if category.UserID == userID && category.Name == name {
+			return nil, fmt.Errorf("failed to create category: UNIQUE constraint failed")
+		}
+	}
+	category := models.UserCategory{ID: r.s.id(), UserID: userID, Name: name, Description: description, CreatedAt: time.Now()}
+	r.s.categories[category.ID] = category
+	return &category, nil
+}
+
+func (r categories) List(userID int) ([]models.UserCategory, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.UserCategory
+	for _, category := range r.s.categories {
+		if category.UserID == userID {
+			list = append(list, category)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r categories) ByID(userID, categoryID int) (*models.UserCategory, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	category, ok := r.s.categories[categoryID]
+	if !ok || category.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return &category, nil
+}
+
+func (r categories) ByName(userID int, name string) (*models.UserCategory, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, category := range r.s.categories {
+		if category.UserID == userID && strings.EqualFold(category.Name, name) {
+			return &category, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r categories) Update(userID, categoryID int, name, description string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	category, ok := r.s.categories[categoryID]
+	if !ok || category.UserID != userID {
+		return errors.New("category not found or no changes made")
+	}
+	category.Name = name
+	category.Description = description
+	r.s.categories[categoryID] = category
+	return nil
+}
+
+func (r categories) Delete(userID, categoryID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	category, ok := r.s.categories[categoryID]
+	if !ok || category.UserID != userID {
+		return errors.New("category not found")
+	}
+	delete(r.s.categories, categoryID)
+	delete(r.s.categoryFeeds, categoryID)
+	return nil
+}
+
+func (r categories) AddFeed(userID, categoryID, feedSourceID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if category, ok := r.s.categories[categoryID]; !ok || category.UserID != userID {
+		return fmt.Errorf("invalid category: %w", repository.ErrNotFound)
+	}
+	if _, ok := r.s.sources[feedSourceID]; !ok {
+		return errors.New("feed source not found")
+	}
+	if r.s.categoryFeeds[categoryID] == nil {
+		r.s.categoryFeeds[categoryID] = make(map[int]bool)
+	}
+	r.s.categoryFeeds[categoryID][feedSourceID] = true
+	return nil
+}
+
+func (r categories) RemoveFeed(userID, categoryID, feedSourceID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	category, ok := r.s.categories[categoryID]
+	if !ok || category.UserID != userID || !r.s.categoryFeeds[categoryID][feedSourceID] {
+		return errors.New("feed not found in category")
+	}
+	delete(r.s.categoryFeeds[categoryID], feedSourceID)
+	return nil
+}
+
+func (r categories) Feeds(userID, categoryID int) ([]feeds.FeedSource, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if category, ok := r.s.categories[categoryID]; !ok || category.UserID != userID {
+		return nil, nil
+	}
+	var list []feeds.FeedSource
+	for id := range r.s.categoryFeeds[categoryID] {
+		list = append(list, r.s.sources[id])
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+type comments struct{ s *store }
+
+func (r comments) Create(itemID string, userID int, username, content string, parentID *int) (*models.Comment, error) {
+	itemID = strings.Clone(itemID)
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	comment := models.Comment{
+		ID:        r.s.id(),
+		ItemID:    itemID,
+		UserID:    userID,
+		Username:  username,
+		Content:   content,
+		ParentID:  parentID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	r.s.comments[comment.ID] = comment
+	if item, ok := r.s.items[itemID]; ok {
+		item.CommentsCount++
+		r.s.items[itemID] = item
+	}
+	return &comment, nil
+}
+
+func (r comments) ForItem(itemID string) ([]models.Comment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var flat []models.Comment
+	for _, comment := range r.s.comments {
+		if comment.ItemID == itemID {
+			flat = append(flat, comment)
+		}
+	}
+	sort.Slice(flat, func(i, j int) bool { return flat[i].ID < flat[j].ID })
+
+	var nest func(parentID *int) []models.Comment
+	nest = func(parentID *int) []models.Comment {
+		var level []models.Comment
+		for _, comment := range flat {
+			if (parentID == nil) != (comment.ParentID == nil) || (parentID != nil && *parentID != *comment.ParentID) {
+				continue
+			}
+			comment.Replies = nest(&comment.ID)
+			level = append(level, comment)
+		}
+		return level
+	}
+	return nest(nil), nil
+}
+
+func (r comments) Search(query string, limit, offset int) ([]models.Comment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.Comment
+	if search.ParseText(query).Empty() {
+		return nil, nil
+	}
+	for _, comment := range r.s.comments {
+		if matchesSearch(query, comment.Content) {
+			list = append(list, comment)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return page(list, limit, offset), nil
+}
+
+func (r comments) ByID(commentID int) (*models.Comment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.comments[commentID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &comment, nil
+}
+
+func (r comments) Update(commentID int, content string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if comment, ok := r.s.comments[commentID]; ok {
+		comment.Content = content
+		comment.UpdatedAt = time.Now()
+		r.s.comments[commentID] = comment
+	}
+	return nil
+}
+
+func (r comments) Delete(commentID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.comments[commentID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.s.comments, commentID)
+	if item, ok := r.s.items[comment.ItemID]; ok {
+		item.CommentsCount--
+		r.s.items[comment.ItemID] = item
+	}
+	return nil
+}
+
+type posts struct{ s *store }
+
+func (r posts) Create(subverseID, userID int, username, title, content, postType, url string) (*models.Post, error) {
+	switch {
+	case postType != "text" && postType != "link":
+		return nil, errors.New("invalid post type: must be 'text' or 'link'")
+	case postType == "link" && url == "":
+		return nil, errors.New("URL is required for link posts")
+	case postType == "text" && content == "":
+		return nil, errors.New("content is required for text posts")
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	post := models.Post{
+		ID:         uuid.New().String(),
+		SubverseID: subverseID,
+		UserID:     userID,
+		Username:   username,
+		Title:      title,
+		Content:    content,
+		PostType:   postType,
+		URL:        url,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	r.s.posts[post.ID] = post
+	return &post, nil
+}
+
+func (r posts) ByID(postID string) (*models.Post, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	post, ok := r.s.posts[postID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &post, nil
+}
+
+// Posts in a subverse matching a filter, newest first; callers must hold the lock
+func (r posts) list(subverseID int, match func(models.Post) bool) []models.Post {
+	var list []models.Post
+	for _, post := range r.s.posts {
+		if post.SubverseID == subverseID && match(post) {
+			list = append(list, post)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+func (r posts) ForSubverse(subverseID, limit, offset int) ([]models.Post, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	all := r.list(subverseID, func(models.Post) bool { return true })
+	return page(all, limit, offset), nil
+}
+
+func (r posts) Search(subverseID int, query string, limit, offset int) ([]models.Post, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	all := r.list(subverseID, func(post models.Post) bool {
+		return matchesSearch(query, post.Title, post.Content)
+	})
+	return page(all, limit, offset), nil
+}
+
+func (r posts) Update(postID string, userID int, title, content string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	post, ok := r.s.posts[postID]
+	if !ok || post.UserID != userID {
+		return errors.New("post not found or user not authorized")
+	}
+	post.Title = title
+	post.Content = content
+	post.UpdatedAt = time.Now()
+	r.s.posts[postID] = post
+	return nil
+}
+
+func (r posts) Delete(postID string, userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	post, ok := r.s.posts[postID]
+	if !ok || post.UserID != userID {
+		return errors.New("post not found or user not authorized")
+	}
+	delete(r.s.posts, postID)
+	for id, comment := range r.s.postComments {
+		if comment.PostID == postID {
+			delete(r.s.postComments, id)
+		}
+	}
+	return nil
+}
+
+func (r posts) Vote(userID int, postID, voteType string) error {
+	if voteType != "upvote" && voteType != "downvote" {
+		return errors.New("invalid vote type: must be 'upvote' or 'downvote'")
+	}
+
+	postID = strings.Clone(postID)
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	votes := r.s.postVotes[postID]
+	if votes == nil {
+		votes = make(map[int]string)
+		r.s.postVotes[postID] = votes
+	}
+	if votes[userID] == voteType {
+		delete(votes, userID)
+	} else {
+		votes[userID] = voteType
+	}
+
+	r.s.recountPost(postID)
+	return nil
+}
+
+// Recounts a post's score from its votes; callers must hold the lock
+func (s *store) recountPost(postID string) {
+	post, ok := s.posts[postID]
+	if !ok {
+		return
+	}
+	post.Score = 0
+	for _, vote := range s.postVotes[postID] {
+		if vote == "upvote" {
+			post.Score++
+		} else {
+			post.Score--
+		}
+	}
+	s.posts[postID] = post
+}
+
+func (r posts) CreateComment(postID string, userID int, username, content string, parentID *string) (*models.PostComment, error) {
+	postID = strings.Clone(postID)
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	now := time.Now()
+	comment := models.PostComment{
+		ID:        strconv.Itoa(r.s.id()),
+		PostID:    postID,
+		UserID:    userID,
+		Username:  username,
+		Content:   content,
+		ParentID:  parentID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if parentID != nil && (*parentID == "" || *parentID == "undefined" || *parentID == "null") {
+		comment.ParentID = nil
+	}
+	r.s.postComments[comment.ID] = comment
+
+	comment.ParentID = parentID
+	return &comment, nil
+}
+
+func (r posts) Comments(postID string) ([]models.PostComment, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var flat []models.PostComment
+	for _, comment := range r.s.postComments {
+		if comment.PostID == postID {
+			flat = append(flat, comment)
+		}
+	}
+	sort.Slice(flat, func(i, j int) bool { return flat[i].CreatedAt.Before(flat[j].CreatedAt) })
+
+	byID := make(map[string]bool, len(flat))
+	for _, comment := range flat {
+		byID[comment.ID] = true
+	}
+	var nest func(parentID *string) []models.PostComment
+	nest = func(parentID *string) []models.PostComment {
+		level := []models.PostComment{}
+		for _, comment := range flat {
+			orphan := comment.ParentID != nil && !byID[*comment.ParentID]
+			switch {
+			case parentID == nil && comment.ParentID != nil && !orphan:
+				continue
+			case parentID != nil && (comment.ParentID == nil || *comment.ParentID != *parentID):
+				continue
+			}
+			comment.Replies = nest(&comment.ID)
+			level = append(level, comment)
+		}
+		return level
+	}
+	return nest(nil), nil
+}
+
+func (r posts) UpdateComment(commentID string, userID int, content string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.postComments[commentID]
+	if !ok || comment.UserID != userID {
+		return errors.New("comment not found or user not authorized")
+	}
+	comment.Content = content
+	comment.UpdatedAt = time.Now()
+	r.s.postComments[commentID] = comment
+	return nil
+}
+
+func (r posts) DeleteComment(commentID string, userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	comment, ok := r.s.postComments[commentID]
+	if !ok || comment.UserID != userID {
+		return errors.New("comment not found or user not authorized")
+	}
+	delete(r.s.postComments, commentID)
+	for id, reply := range r.s.postComments {
+		if reply.ParentID != nil && *reply.ParentID == commentID {
+			delete(r.s.postComments, id)
+		}
+	}
+	return nil
+}
+
+type subverses struct{ s *store }
+
+func (r subverses) Create(name string) (*models.Subverse, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return nil, errors.New("subverse name cannot be empty")
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, subverse := range r.s.subverses {
+		if subverse.Name == name {
+			return nil, errors.New("failed to create subverse: UNIQUE constraint failed")
+		}
+	}
+	subverse := models.Subverse{ID: r.s.id(), Name: name, CreatedAt: time.Now()}
+	r.s.subverses[subverse.ID] = subverse
+	return &subverse, nil
+}
+
+func (r subverses) List() ([]models.Subverse, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.Subverse
+	for _, subverse := range r.s.subverses {
+		list = append(list, subverse)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r subverses) ByID(id int) (*models.Subverse, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	subverse, ok := r.s.subverses[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &subverse, nil
+}
+
+func (r subverses) ByName(name string) (*models.Subverse, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, subverse := range r.s.subverses {
+		if subverse.Name == name {
+			return &subverse, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r subverses) AddFeed(subverseID, feedSourceID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if r.s.subverseFeeds[subverseID][feedSourceID] {
+		return errors.New("failed to add feed to subverse: UNIQUE constraint failed")
+	}
+	if r.s.subverseFeeds[subverseID] == nil {
+		r.s.subverseFeeds[subverseID] = make(map[int]bool)
+	}
+	r.s.subverseFeeds[subverseID][feedSourceID] = true
+	return nil
+}
+
+func (r subverses) RemoveFeed(subverseID, feedSourceID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.subverseFeeds[subverseID], feedSourceID)
+	return nil
+}
+
+func (r subverses) Feeds(subverseID int) ([]feeds.FeedSource, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []feeds.FeedSource
+	for id := range r.s.subverseFeeds[subverseID] {
+		list = append(list, r.s.sources[id])
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r subverses) UpdatePostCount(subverseID int) error {
+	return nil
+}
+
+// Saved searches never have unseen matches here, since nothing ingests items
+// in the background
+type savedSearches struct{ s *store }
+
+func (r savedSearches) Create(userID int, name, query string) (*models.SavedSearch, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, saved := range r.s.savedSearches {
+		if saved.UserID == userID && saved.Name == name {
+			return nil, fmt.Errorf("failed to create saved search: UNIQUE constraint failed")
+		}
+	}
+	saved := models.SavedSearch{ID: r.s.id(), UserID: userID, Name: name, Query: query, CreatedAt: time.Now()}
+	r.s.savedSearches[saved.ID] = saved
+	return &saved, nil
+}
+
+func (r savedSearches) List(userID int) ([]models.SavedSearch, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.SavedSearch
+	for _, saved := range r.s.savedSearches {
+		if saved.UserID == userID {
+			list = append(list, saved)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r savedSearches) ByID(userID, id int) (*models.SavedSearch, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	saved, ok := r.s.savedSearches[id]
+	if !ok || saved.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return &saved, nil
+}
+
+func (r savedSearches) ByName(userID int, name string) (*models.SavedSearch, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, saved := range r.s.savedSearches {
+		if saved.UserID == userID && strings.EqualFold(saved.Name, name) {
+			return &saved, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r savedSearches) Update(userID, id int, name, query string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	saved, ok := r.s.savedSearches[id]
+	if !ok || saved.UserID != userID {
+		return fmt.Errorf("saved search not found: %w", repository.ErrNotFound)
+	}
+	saved.Name = name
+	saved.Query = query
+	r.s.savedSearches[id] = saved
+	return nil
+}
+
+func (r savedSearches) Delete(userID, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	saved, ok := r.s.savedSearches[id]
+	if !ok || saved.UserID != userID {
+		return errors.New("saved search not found")
+	}
+	delete(r.s.savedSearches, id)
+	return nil
+}
+
+func (r savedSearches) MarkSeen(userID, id int) error {
+	return nil
+}
+
+type searcher struct{ s *store }
+
+func (r searcher) All(query *search.Query, opts repository.SearchOptions) (*repository.SearchResults, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	results := &repository.SearchResults{
+		Facets: repository.SearchFacets{
+			Types:     make(map[string]int),
+			Sources:   []repository.FacetCount{},
+			Subverses: []repository.FacetCount{},
+		},
+	}
+	if query.Empty() {
+		return results, nil
+	}
+	wants := func(contentType string) bool {
+		return opts.Type == "" || opts.Type == contentType
+	}
+
+	var items []feeds.FeedItem
+	sources := make(map[string]int)
+	for _, item := range r.s.items {
+		item = r.s.item(item)
+		if r.s.private(item) || !r.s.matchesItem(query, item) {
+			continue
+		}
+		sources[item.SourceName]++
+		if opts.Source == "" || strings.EqualFold(item.SourceName, opts.Source) {
+			items = append(items, item)
+		}
+	}
+	sortByPublished(items)
+	results.Facets.Types[repository.SearchFeedItems] = countValues(sources)
+	results.Facets.Sources = facetCounts(sources)
+	if wants(repository.SearchFeedItems) {
+		results.FeedItems = page(items, opts.Limit, opts.Offset)
+	}
+
+	// Field filters only apply to feed items
+	texts := query.Text()
+	if len(texts) != len(query.Exprs) {
+		return results, nil
+	}
+
+	var posts []models.Post
+	subverses := make(map[string]int)
+	for _, post := range r.s.posts {
+		if !matchesTexts(texts, post.Title, post.Content) {
+			continue
+		}
+		name := r.s.subverses[post.SubverseID].Name
+		subverses[name]++
+		if opts.Subverse == "" || strings.EqualFold(name, opts.Subverse) {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreatedAt.After(posts[j].CreatedAt) })
+	results.Facets.Types[repository.SearchPosts] = countValues(subverses)
+	results.Facets.Subverses = facetCounts(subverses)
+	if wants(repository.SearchPosts) {
+		results.Posts = page(posts, opts.Limit, opts.Offset)
+	}
+
+	var comments []models.Comment
+	for _, comment := range r.s.comments {
+		if matchesTexts(texts, comment.Content) {
+			comments = append(comments, comment)
+		}
+	}
+	sort.Slice(comments, func(i, j int) bool { return comments[i].ID > comments[j].ID })
+	results.Facets.Types[repository.SearchComments] = len(comments)
+	if wants(repository.SearchComments) {
+		results.Comments = page(comments, opts.Limit, opts.Offset)
+	}
+
+	var postComments []models.PostComment
+	for _, comment := range r.s.postComments {
+		if matchesTexts(texts, comment.Content) {
+			postComments = append(postComments, comment)
+		}
+	}
+	sort.Slice(postComments, func(i, j int) bool { return postComments[i].CreatedAt.After(postComments[j].CreatedAt) })
+	results.Facets.Types[repository.SearchPostComments] = len(postComments)
+	if wants(repository.SearchPostComments) {
+		results.PostComments = page(postComments, opts.Limit, opts.Offset)
+	}
+
+	var subverseMatches []models.Subverse
+	for _, subverse := range r.s.subverses {
+		if matchesTexts(texts, subverse.Name) {
+			subverseMatches = append(subverseMatches, subverse)
+		}
+	}
+	sort.Slice(subverseMatches, func(i, j int) bool { return subverseMatches[i].Name < subverseMatches[j].Name })
+	results.Facets.Types[repository.SearchSubverses] = len(subverseMatches)
+	if wants(repository.SearchSubverses) {
+		results.Subverses = page(subverseMatches, opts.Limit, opts.Offset)
+	}
+
+	var users []repository.UserMatch
+	for _, user := range r.s.users {
+		if matchesTexts(texts, user.Username) {
+			users = append(users, repository.UserMatch{ID: user.ID, Username: user.Username})
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	results.Facets.Types[repository.SearchUsers] = len(users)
+	if wants(repository.SearchUsers) {
+		results.Users = page(users, opts.Limit, opts.Offset)
+	}
+
+	return results, nil
+}
+
+// Adds up the counts of a facet
+func countValues(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// Lists facet counts most first, then by value, like database.SearchAll
+func facetCounts(counts map[string]int) []repository.FacetCount {
+	facets := []repository.FacetCount{}
+	for value, n := range counts {
+		facets = append(facets, repository.FacetCount{Value: value, Count: n})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return facets[i].Value < facets[j].Value
+	})
+	return page(facets, 20, 0)
+}
+
+type bans struct{ s *store }
+
+func (r bans) Ban(ipAddress, reason string, bannedBy int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	ban, ok := r.s.bans[ipAddress]
+	if !ok {
+		ban.ID = r.s.id()
+	}
+	ban.IPAddress = ipAddress
+	ban.BannedAt = time.Now()
+	ban.BannedBy = bannedBy
+	ban.Reason = reason
+	ban.IsActive = true
+	ban.UnbannedAt = nil
+	ban.UnbannedBy = nil
+	r.s.bans[ipAddress] = ban
+	return nil
+}
+
+func (r bans) Unban(ipAddress string, unbannedBy int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	ban, ok := r.s.bans[ipAddress]
+	if !ok || !ban.IsActive {
+		return nil
+	}
+	now := time.Now()
+	ban.IsActive = false
+	ban.UnbannedAt = &now
+	ban.UnbannedBy = &unbannedBy
+	r.s.bans[ipAddress] = ban
+	return nil
+}
+
+func (r bans) IsBanned(ipAddress string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.bans[ipAddress].IsActive, nil
+}
+
+func (r bans) List() ([]models.BannedIP, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.BannedIP
+	for _, ban := range r.s.bans {
+		list = append(list, ban)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].BannedAt.After(list[j].BannedAt) })
+	return list, nil
+}
+
+type twoFactor struct{ s *store }
+
+func (r twoFactor) ByUser(userID int) (*models.TwoFactor, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tf, ok := r.s.twoFactor[userID]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &tf, nil
+}
+
+func (r twoFactor) SetSecret(userID int, secret string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if tf, ok := r.s.twoFactor[userID]; ok && tf.EnabledAt != nil {
+		return nil
+	}
+	r.s.twoFactor[userID] = models.TwoFactor{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r twoFactor) Enable(userID int, step int64, recoveryHashes []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tf, ok := r.s.twoFactor[userID]
+	if !ok || tf.EnabledAt != nil {
+		return repository.ErrNotFound
+	}
+	now := time.Now()
+	tf.EnabledAt = &now
+	tf.LastStep = step
+	r.s.twoFactor[userID] = tf
+	r.replaceRecoveryCodes(userID, recoveryHashes)
+	return nil
+}
+
+func (r twoFactor) Disable(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.twoFactor, userID)
+	delete(r.s.recoveryCodes, userID)
+	return nil
+}
+
+func (r twoFactor) UseStep(userID int, step int64) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	tf, ok := r.s.twoFactor[userID]
+	if !ok || tf.LastStep >= step {
+		return false, nil
+	}
+	tf.LastStep = step
+	r.s.twoFactor[userID] = tf
+	return true, nil
+}
+
+func (r twoFactor) UseRecoveryCode(userID int, hash string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	used, ok := r.s.recoveryCodes[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	r.s.recoveryCodes[userID][hash] = true
+	return true, nil
+}
+
+func (r twoFactor) ReplaceRecoveryCodes(userID int, hashes []string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.replaceRecoveryCodes(userID, hashes)
+	return nil
+}
+
+// Callers must hold the lock
+func (r twoFactor) replaceRecoveryCodes(userID int, hashes []string) {
+	codes := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		codes[hash] = false
+	}
+	r.s.recoveryCodes[userID] = codes
+}
+
+func (r twoFactor) RecoveryCodesLeft(userID int) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	left := 0
+	for _, used := range r.s.recoveryCodes[userID] {
+		if !used {
+			left++
+		}
+	}
+	return left, nil
+}
+
+func (r twoFactor) RequiredForAdmins() (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.s.adminsNeed2FA, nil
+}
+
+func (r twoFactor) SetRequiredForAdmins(required bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.adminsNeed2FA = required
+	return nil
+}
+
+type apiTokens struct{ s *store }
+
+func (r apiTokens) Create(userID int, name, hash string, scopes []string) (*models.APIToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, token := range r.s.apiTokens {
+		if token.hash == hash {
+			return nil, errors.New("token hash already exists")
+		}
+	}
+	token := apiToken{
+		APIToken: models.APIToken{
+			ID:        r.s.id(),
+			UserID:    userID,
+			Name:      name,
+			Scopes:    append([]string(nil), scopes...),
+			CreatedAt: time.Now(),
+		},
+		hash: hash,
+	}
+	r.s.apiTokens[token.ID] = token
+	created := token.APIToken
+	return &created, nil
+}
+
+func (r apiTokens) List(userID int) ([]models.APIToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.APIToken
+	for _, token := range r.s.apiTokens {
+		if token.UserID == userID {
+			list = append(list, token.APIToken)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+func (r apiTokens) ByHash(hash string) (*models.APIToken, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for _, token := range r.s.apiTokens {
+		if token.hash == hash {
+			found := token.APIToken
+			return &found, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r apiTokens) MarkUsed(id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.s.apiTokens[id]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	token.LastUsedAt = &now
+	r.s.apiTokens[id] = token
+	return nil
+}
+
+func (r apiTokens) Delete(userID, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if token, ok := r.s.apiTokens[id]; !ok || token.UserID != userID {
+		return repository.ErrNotFound
+	}
+	delete(r.s.apiTokens, id)
+	return nil
+}
+
+func (r apiTokens) DeleteForUser(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for id, token := range r.s.apiTokens {
+		if token.UserID == userID {
+			delete(r.s.apiTokens, id)
+		}
+	}
+	return nil
+}
+
+type webhooks struct{ s *store }
+
+func (r webhooks) Create(userID int, name, url, secret, matchType, matchValue string) (*models.Webhook, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	hook := models.Webhook{
+		ID:         r.s.id(),
+		UserID:     userID,
+		Name:       name,
+		URL:        url,
+		Secret:     secret,
+		MatchType:  matchType,
+		MatchValue: matchValue,
+		Enabled:    true,
+		CreatedAt:  time.Now(),
+	}
+	r.s.webhooks[hook.ID] = hook
+	return &hook, nil
+}
+
+func (r webhooks) List(userID int) ([]models.Webhook, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.Webhook
+	for _, hook := range r.s.webhooks {
+		if hook.UserID == userID {
+			hook.Secret = ""
+			list = append(list, hook)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+func (r webhooks) ByID(userID, id int) (*models.Webhook, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	hook, ok := r.s.webhooks[id]
+	if !ok || hook.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return &hook, nil
+}
+
+func (r webhooks) Update(userID, id int, name, url, matchType, matchValue string, enabled bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	hook, ok := r.s.webhooks[id]
+	if !ok || hook.UserID != userID {
+		return repository.ErrNotFound
+	}
+	hook.Name, hook.URL, hook.MatchType, hook.MatchValue, hook.Enabled = name, url, matchType, matchValue, enabled
+	r.s.webhooks[id] = hook
+	return nil
+}
+
+func (r webhooks) Delete(userID, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if hook, ok := r.s.webhooks[id]; !ok || hook.UserID != userID {
+		return repository.ErrNotFound
+	}
+	delete(r.s.webhooks, id)
+	for deliveryID, delivery := range r.s.deliveries {
+		if delivery.WebhookID == id {
+			delete(r.s.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (r webhooks) Deliveries(webhookID, limit int) ([]models.WebhookDelivery, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.WebhookDelivery
+	for _, delivery := range r.s.deliveries {
+		if delivery.WebhookID == webhookID {
+			list = append(list, delivery)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return page(list, limit, 0), nil
+}
+
+type digests struct{ s *store }
+
+// Returns a user's subscription, creating one with digests off; callers
+// must hold the lock
+func (s *store) digest(userID int) models.DigestSubscription {
+	sub, ok := s.digests[userID]
+	if !ok {
+		sub = models.DigestSubscription{
+			UserID:           userID,
+			Frequency:        models.DigestOff,
+			UnsubscribeToken: uuid.NewString(),
+			CreatedAt:        time.Now(),
+		}
+		s.digests[userID] = sub
+	}
+	user := s.users[userID]
+	sub.Email, sub.Username = user.Email, user.Username
+	return sub
+}
+
+func (r digests) Subscription(userID int) (*models.DigestSubscription, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sub := r.s.digest(userID)
+	return &sub, nil
+}
+
+func (r digests) SetFrequency(userID int, frequency string) error {
+	switch frequency {
+	case models.DigestOff, models.DigestDaily, models.DigestWeekly:
+	default:
+		return errors.New("invalid digest frequency")
+	}
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sub := r.s.digest(userID)
+	sub.Frequency = frequency
+	r.s.digests[userID] = sub
+	return nil
+}
+
+func (r digests) Unsubscribe(token string) (bool, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for userID, sub := range r.s.digests {
+		if sub.UnsubscribeToken == token {
+			sub.Frequency = models.DigestOff
+			r.s.digests[userID] = sub
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type newsletters struct{ s *store }
+
+func (r newsletters) CreateAddress(userID int, name, localPart string) (*models.NewsletterAddress, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sourceName := name
+	for _, source := range r.s.sources {
+		if source.Name == name {
+			sourceName = fmt.Sprintf("%s (%s)", name, localPart)
+		}
+	}
+	for _, addr := range r.s.newsletters {
+		if addr.LocalPart == localPart {
+			return nil, errors.New("local part already in use")
+		}
+	}
+	source := feeds.FeedSource{
+		ID:             r.s.id(),
+		Name:           sourceName,
+		URL:            feeds.NewsletterURLPrefix + localPart,
+		LastUpdated:    time.Now().UTC(),
+		UpdateInterval: feeds.DefaultUpdateInterval,
+	}
+	r.s.sources[source.ID] = source
+
+	addr := models.NewsletterAddress{
+		ID:           r.s.id(),
+		UserID:       userID,
+		Name:         name,
+		LocalPart:    strings.Clone(localPart),
+		FeedSourceID: source.ID,
+		CreatedAt:    time.Now(),
+	}
+	r.s.newsletters[addr.ID] = addr
+	return &addr, nil
+}
+
+func (r newsletters) Addresses(userID int) ([]models.NewsletterAddress, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var list []models.NewsletterAddress
+	for _, addr := range r.s.newsletters {
+		if addr.UserID == userID {
+			list = append(list, addr)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r newsletters) DeleteAddress(userID, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if addr, ok := r.s.newsletters[id]; !ok || addr.UserID != userID {
+		return repository.ErrNotFound
+	}
+	delete(r.s.newsletters, id)
+	return nil
+}
+
+func (r newsletters) SaveMessage(msg models.NewsletterMessage) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.messages[msg.ItemID]; !ok {
+		r.s.messages[strings.Clone(msg.ItemID)] = msg
+	}
+	return nil
+}
+
+func (r newsletters) Message(userID int, itemID string) (*models.NewsletterMessage, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	msg, ok := r.s.messages[itemID]
+	if !ok || msg.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return &msg, nil
+}
+
+type resetTokens struct{ s *store }
+
+func (r resetTokens) Create(userID int, hash, ipAddress string, expiresAt time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.resetTokens[hash]; ok {
+		return errors.New("token hash already exists")
+	}
+	r.s.resetTokens[strings.Clone(hash)] = resetToken{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+// Returns the token if it can still be used; callers must hold the lock
+func (r resetTokens) usable(hash string, now time.Time) (resetToken, bool) {
+	token, ok := r.s.resetTokens[hash]
+	if !ok || token.used || !token.expiresAt.After(now) {
+		return resetToken{}, false
+	}
+	return token, true
+}
+
+func (r resetTokens) User(hash string, now time.Time) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.usable(hash, now)
+	if _, exists := r.s.users[token.userID]; !ok || !exists {
+		return 0, repository.ErrNotFound
+	}
+	return token.userID, nil
+}
+
+func (r resetTokens) Use(hash string, now time.Time) (int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	token, ok := r.usable(hash, now)
+	if !ok {
+		return 0, repository.ErrNotFound
+	}
+	for key, other := range r.s.resetTokens {
+		if other.userID == token.userID {
+			other.used = true
+			r.s.resetTokens[key] = other
+		}
+	}
+	return token.userID, nil
+}
+
+func (r resetTokens) DeleteExpired(before time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	for key, token := range r.s.resetTokens {
+		if token.expiresAt.Before(before) {
+			delete(r.s.resetTokens, key)
+		}
+	}
+	return nil
+}
+
+type accountDeletions struct{ s *store }
+
+func (r accountDeletions) Schedule(userID int, at time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok || r.s.deleted[userID] {
+		return repository.ErrNotFound
+	}
+	r.s.deletions[userID] = at
+	return nil
+}
+
+func (r accountDeletions) Cancel(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.deletions, userID)
+	return nil
+}
+
+func (r accountDeletions) Scheduled(userID int) (*time.Time, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if _, ok := r.s.users[userID]; !ok {
+		return nil, repository.ErrNotFound
+	}
+	at, ok := r.s.deletions[userID]
+	if !ok {
+		return nil, nil
+	}
+	return &at, nil
+}
+
+func (r accountDeletions) Due(now time.Time) ([]int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var ids []int
+	for userID, at := range r.s.deletions {
+		if !at.After(now) {
+			ids = append(ids, userID)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (r accountDeletions) Delete(userID int, now time.Time) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	user, ok := r.s.users[userID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if r.s.deleted[userID] {
+		return nil
+	}
+
+	delta := map[string]int{"upvote": 1, "downvote": -1}
+	for itemID, votes := range r.s.itemVotes {
+		if vote, voted := votes[userID]; voted {
+			item := r.s.items[itemID]
+			item.Score -= delta[vote]
+			r.s.items[itemID] = item
+			delete(votes, userID)
+		}
+	}
+	for postID, votes := range r.s.postVotes {
+		if _, voted := votes[userID]; voted {
+			delete(votes, userID)
+			r.s.recountPost(postID)
+		}
+	}
+
+	delete(r.s.readingList, userID)
+	delete(r.s.hidden, userID)
+	for id, category := range r.s.categories {
+		if category.UserID == userID {
+			delete(r.s.categories, id)
+			delete(r.s.categoryFeeds, id)
+		}
+	}
+	for id, hook := range r.s.webhooks {
+		if hook.UserID != userID {
+			continue
+		}
+		delete(r.s.webhooks, id)
+		for deliveryID, delivery := range r.s.deliveries {
+			if delivery.WebhookID == id {
+				delete(r.s.deliveries, deliveryID)
+			}
+		}
+	}
+	delete(r.s.digests, userID)
+	for id, saved := range r.s.savedSearches {
+		if saved.UserID == userID {
+			delete(r.s.savedSearches, id)
+		}
+	}
+	for itemID, msg := range r.s.messages {
+		if msg.UserID == userID {
+			delete(r.s.messages, itemID)
+		}
+	}
+	for id, addr := range r.s.newsletters {
+		if addr.UserID == userID {
+			delete(r.s.newsletters, id)
+		}
+	}
+	for id, export := range r.s.exports {
+		if export.UserID == userID {
+			delete(r.s.exports, id)
+		}
+	}
+	for hash, token := range r.s.resetTokens {
+		if token.userID == userID {
+			delete(r.s.resetTokens, hash)
+		}
+	}
+	delete(r.s.twoFactor, userID)
+	delete(r.s.recoveryCodes, userID)
+	for id, token := range r.s.apiTokens {
+		if token.UserID == userID {
+			delete(r.s.apiTokens, id)
+		}
+	}
+
+	for id, comment := range r.s.comments {
+		if comment.UserID == userID {
+			comment.Username = models.DeletedUsername
+			r.s.comments[id] = comment
+		}
+	}
+	for id, comment := range r.s.postComments {
+		if comment.UserID == userID {
+			comment.Username = models.DeletedUsername
+			r.s.postComments[id] = comment
+		}
+	}
+	for id, post := range r.s.posts {
+		if post.UserID == userID {
+			post.Username = models.DeletedUsername
+			r.s.posts[id] = post
+		}
+	}
+
+	r.s.users[userID] = models.User{
+		ID:            userID,
+		Email:         fmt.Sprintf("deleted-%d@deleted.invalid", userID),
+		Username:      models.DeletedUsername,
+		EmailVerified: user.EmailVerified,
+	}
+	delete(r.s.deletions, userID)
+	r.s.deleted[userID] = true
+	r.s.endSessions(userID)
+	return nil
+}
+
+type dataExports struct{ s *store }
+
+func (r dataExports) Create(userID int) (*models.DataExport, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	export := models.DataExport{ID: r.s.id(), UserID: userID, Status: models.ExportPending, CreatedAt: time.Now()}
+	r.s.exports[export.ID] = export
+	return &export, nil
+}
+
+func (r dataExports) ByID(id int) (*models.DataExport, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	export, ok := r.s.exports[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &export, nil
+}
+
+// Exports matching a filter, oldest first; callers must hold the lock
+func (r dataExports) list(match func(models.DataExport) bool) []models.DataExport {
+	var list []models.DataExport
+	for _, export := range r.s.exports {
+		if match(export) {
+			list = append(list, export)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (r dataExports) List(userID int) ([]models.DataExport, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	list := r.list(func(export models.DataExport) bool { return export.UserID == userID })
+	slices.Reverse(list)
+	return list, nil
+}
+
+func (r dataExports) Pending() ([]models.DataExport, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	return r.list(func(export models.DataExport) bool {
+		return export.Status == models.ExportPending || export.Status == models.ExportRunning
+	}), nil
+}
+
+// Applies a change to an export if it exists
+func (r dataExports) update(id int, change func(*models.DataExport)) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	if export, ok := r.s.exports[id]; ok {
+		change(&export)
+		r.s.exports[id] = export
+	}
+	return nil
+}
+
+func (r dataExports) MarkRunning(id int) error {
+	return r.update(id, func(export *models.DataExport) { export.Status = models.ExportRunning })
+}
+
+func (r dataExports) MarkReady(id int, fileSize int64, completedAt, expiresAt time.Time) error {
+	return r.update(id, func(export *models.DataExport) {
+		export.Status = models.ExportReady
+		export.FileSize = fileSize
+		export.Error = ""
+		export.CompletedAt = &completedAt
+		export.ExpiresAt = &expiresAt
+	})
+}
+
+func (r dataExports) MarkFailed(id int, reason string, completedAt time.Time) error {
+	return r.update(id, func(export *models.DataExport) {
+		export.Status = models.ExportFailed
+		export.Error = reason
+		export.CompletedAt = &completedAt
+	})
+}
+
+func (r dataExports) Expire(now time.Time) ([]int, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	var ids []int
+	for _, export := range r.list(func(export models.DataExport) bool {
+		return export.Status == models.ExportReady && export.ExpiresAt != nil && !export.ExpiresAt.After(now)
+	}) {
+		export.Status = models.ExportExpired
+		r.s.exports[export.ID] = export
+		ids = append(ids, export.ID)
+	}
+	return ids, nil
+}
+
+func (r dataExports) UserData(userID int) (*repository.UserData, error) {
+	user, err := users(r).ByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	data := &repository.UserData{User: *user}
+
+	list, _ := categories(r).List(userID)
+	for _, category := range list {
+		sources, _ := categories(r).Feeds(userID, category.ID)
+		data.Categories = append(data.Categories, repository.CategoryFeeds{UserCategory: category, Feeds: sources})
+	}
+	data.ReadingList, _ = users(r).ReadingList(userID)
+
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	// The store keeps no times for hiding or voting, so those are left zero
+	for itemID := range r.s.hidden[userID] {
+		data.Hidden = append(data.Hidden, models.HiddenItem{ItemID: itemID, Title: r.s.items[itemID].Title})
+	}
+	sort.Slice(data.Hidden, func(i, j int) bool { return data.Hidden[i].ItemID < data.Hidden[j].ItemID })
+	for itemID, votes := range r.s.itemVotes {
+		if vote, ok := votes[userID]; ok {
+			data.ItemVotes = append(data.ItemVotes, models.ItemVote{ItemID: itemID, Title: r.s.items[itemID].Title, VoteType: vote})
+		}
+	}
+	sort.Slice(data.ItemVotes, func(i, j int) bool { return data.ItemVotes[i].ItemID < data.ItemVotes[j].ItemID })
+	for postID, votes := range r.s.postVotes {
+		if vote, ok := votes[userID]; ok {
+			data.PostVotes = append(data.PostVotes, models.Vote{UserID: userID, PostID: postID, VoteType: vote})
+		}
+	}
+	sort.Slice(data.PostVotes, func(i, j int) bool { return data.PostVotes[i].PostID < data.PostVotes[j].PostID })
+
+	for _, comment := range r.s.comments {
+		if comment.UserID == userID {
+			data.Comments = append(data.Comments, comment)
+		}
+	}
+	sort.Slice(data.Comments, func(i, j int) bool { return data.Comments[i].ID < data.Comments[j].ID })
+	for _, comment := range r.s.postComments {
+		if comment.UserID == userID {
+			data.PostComments = append(data.PostComments, comment)
+		}
+	}
+	sort.Slice(data.PostComments, func(i, j int) bool {
+		return data.PostComments[i].CreatedAt.Before(data.PostComments[j].CreatedAt)
+	})
+	for _, post := range r.s.posts {
+		if post.UserID == userID {
+			data.Posts = append(data.Posts, post)
+		}
+	}
+	sort.Slice(data.Posts, func(i, j int) bool { return data.Posts[i].CreatedAt.Before(data.Posts[j].CreatedAt) })
+	return data, nil
+}
+
+type sessions struct{ s *store }
+
+func (r sessions) Get(key string) ([]byte, error) {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sess, ok := r.s.sessions[key]
+	if !ok || (!sess.expiresAt.IsZero() && time.Now().After(sess.expiresAt)) {
+		return nil, nil
+	}
+	return sess.data, nil
+}
+
+func (r sessions) Set(key string, val []byte, exp time.Duration) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	sess := session{data: append([]byte(nil), val...)}
+	if exp > 0 {
+		sess.expiresAt = time.Now().Add(exp)
+	}
+	r.s.sessions[key] = sess
+	return nil
+}
+
+func (r sessions) Delete(key string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	delete(r.s.sessions, key)
+	return nil
+}
+
+func (r sessions) Reset() error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	clear(r.s.sessions)
+	return nil
+}
+
+func (r sessions) Close() error {
+	return nil
+}
+
+func (r sessions) DeleteForUser(userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+
+	r.s.endSessions(userID)
+	return nil
+}
+
+// Deletes every session signed in as the user; callers must hold the lock
+func (s *store) endSessions(userID int) {
+	for key, sess := range s.sessions {
+		// Stored the way fiber encodes sessions, as a gob of their values
+		var values map[string]any
+		if err := gob.NewDecoder(bytes.NewReader(sess.data)).Decode(&values); err != nil {
+			continue
+		}
+		if owner, ok := values["user_id"].(int); ok && owner == userID {
+			delete(s.sessions, key)
+		}
+	}
+}
+
+// Reports whether a text expression's words appear, in order, in one of the fields
+func matchesText(text search.Text, fields ...string) bool {
+	phrase := strings.ToLower(strings.Join(text.Words, " "))
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// Like the LIKE fallback of the SQL search, every positive term has to appear in one of the fields and no negated one may
+func matchesSearch(query string, fields ...string) bool {
+	return matchesTexts(search.ParseText(query).Text(), fields...)
+}
+
+// Reports whether every positive term appears in one of the fields and no negated one does
+func matchesTexts(texts []search.Text, fields ...string) bool {
+	for _, text := range texts {
+		if matchesText(text, fields...) == text.Not {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluates a parsed feed item query the way database.SearchFeedItems does without the full-text index
+func (s *store) matchesItem(query *search.Query, item feeds.FeedItem) bool {
+	for _, expr := range query.Exprs {
+		var ok bool
+		switch e := expr.(type) {
+		case search.Text:
+			ok = matchesText(e, item.Title, item.Description, item.Author)
+		case search.Match:
+			switch e.Field {
+			case search.Source:
+				ok = strings.EqualFold(item.SourceName, e.Value)
+			case search.Author:
+				ok = strings.Contains(strings.ToLower(item.Author), strings.ToLower(e.Value))
+			case search.Domain:
+				host := ""
+				if u, err := url.Parse(item.URL); err == nil {
+					host = strings.ToLower(u.Hostname())
+				}
+				ok = host == e.Value || strings.HasSuffix(host, "."+e.Value)
+			case search.Tag:
+				for id, subverse := range s.subverses {
+					if subverse.Name == strings.ToLower(e.Value) && s.subverseFeeds[id][item.SourceID] {
+						ok = true
+					}
+				}
+			}
+		case search.Compare:
+			value := item.Score
+			if e.Field == search.Comments {
+				value = item.CommentsCount
+			}
+			ok = e.Op.Compare(value, e.Value)
+		case search.Date:
+			if item.PublishedAt == nil {
+				// NULL never satisfies the SQL condition, negated or not
+				return false
+			}
+			if e.Field == search.Before {
+				ok = item.PublishedAt.Before(e.Value)
+			} else {
+				ok = !item.PublishedAt.Before(e.Value)
+			}
+		}
+		if ok == expr.Negated() {
+			return false
+		}
+	}
+	return true
+}
@@ -1,176 +1,308 @@
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
 	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/webhooks"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+var schedulerLog = logging.For("scheduler")
+
+var (
+	feedFetches = metrics.NewCounter("versed_feed_fetches_total",
+		"Scheduled feed updates, by source and result: ok, or the step that failed.", "source", "result")
+	feedFetchDuration = metrics.NewHistogram("versed_feed_fetch_duration_seconds",
+		"Time taken to download a feed, by source.", metrics.SlowBuckets, "source")
+	feedItemsIngested = metrics.NewCounter("versed_feed_items_ingested_total",
+		"Feed items stored for the first time, by source.", "source")
+	schedulerLag = metrics.NewGauge("versed_scheduler_lag_seconds",
+		"How late the latest feed update cycle started.")
+	schedulerLastCycle = metrics.NewGauge("versed_scheduler_last_cycle_timestamp_seconds",
+		"When the latest feed update cycle finished, as a Unix timestamp.")
+)
+
 // Manages periodic feed updates
 type FeedScheduler struct {
-	db          *sql.DB
+	db          *sqldb.DB
 	feedManager *feeds.FeedManager
+	webhooks    *webhooks.Dispatcher
+	snapshots   database.SnapshotConfig
+	interval    time.Duration
 	ticker      *time.Ticker
-	stopChan    chan bool
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+
+	// When the latest update cycle finished, in Unix nanoseconds
+	lastCycle atomic.Int64
 }
 
-// Creates a new feed scheduler
-func NewFeedScheduler(db *sql.DB) *FeedScheduler {
+// Creates a new feed scheduler that updates every feed once per interval
+func NewFeedScheduler(db *sqldb.DB, dispatcher *webhooks.Dispatcher, interval time.Duration) *FeedScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &FeedScheduler{
 		db:          db,
 		feedManager: feeds.NewFeedManager(),
-		stopChan:    make(chan bool),
+		webhooks:    dispatcher,
+		interval:    interval,
+		ctx:         ctx,
+		cancel:      cancel,
 	}
 }
 
 // Begins the periodic feed update process
 func (fs *FeedScheduler) Start() {
-	log.Println("Starting feed scheduler...")
+	schedulerLog.Info("Starting feed scheduler", "interval", fs.interval)
 
-	fs.updateAllFeeds()
+	fs.updateAllFeeds(time.Now())
 
-	fs.ticker = time.NewTicker(1 * time.Hour)
+	fs.ticker = time.NewTicker(fs.interval)
 
+	fs.wg.Add(1)
 	go func() {
+		defer fs.wg.Done()
 		for {
 			select {
-			case <-fs.ticker.C:
-				fs.updateAllFeeds()
-			case <-fs.stopChan:
+			case due := <-fs.ticker.C:
+				fs.updateAllFeeds(due)
+			case <-fs.ctx.Done():
 				fs.ticker.Stop()
 				return
 			}
 		}
 	}()
+
+	if fs.snapshots.Dir != "" {
+		fs.wg.Add(1)
+		go fs.runSnapshots()
+	}
 }
 
-// Stops the scheduler
-func (fs *FeedScheduler) Stop() {
-	if fs.stopChan != nil {
-		fs.stopChan <- true
+// Takes periodic snapshots of the database as configured; call before Start
+func (fs *FeedScheduler) ScheduleSnapshots(cfg database.SnapshotConfig) {
+	fs.snapshots = cfg
+}
+
+// Snapshots the database every interval until the scheduler stops
+func (fs *FeedScheduler) runSnapshots() {
+	defer fs.wg.Done()
+	if fs.db.Dialect != sqldb.SQLite {
+		schedulerLog.Warn("Snapshots are only supported for SQLite, back the database up with its own tools", "dialect", fs.db.Dialect)
+		return
+	}
+	schedulerLog.Info("Snapshotting the database", "dir", fs.snapshots.Dir, "interval", fs.snapshots.Interval)
+
+	ticker := time.NewTicker(fs.snapshots.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			path, err := database.Snapshot(fs.db, fs.snapshots, time.Now())
+			if err != nil {
+				schedulerLog.Error("Failed to snapshot database", "err", err)
+				continue
+			}
+			schedulerLog.Info("Snapshotted database", "path", path)
+		case <-fs.ctx.Done():
+			return
+		}
 	}
 }
 
-// Fetches and caches feeds from all sources
-func (fs *FeedScheduler) updateAllFeeds() {
-	log.Println("Starting feed update process...")
+// Stops the scheduler, cancelling in-flight fetches and waiting for
+// any feed updates that are already saving to finish
+func (fs *FeedScheduler) Stop() {
+	fs.cancel()
+	fs.wg.Wait()
+	schedulerLog.Info("Feed scheduler stopped")
+}
 
+// Fetches and caches feeds from all sources.
+//
+// Once every source has been fetched, the saved searches are run against the
+// items the cycle added.
+func (fs *FeedScheduler) updateAllFeeds(due time.Time) {
+	schedulerLag.Set(time.Since(due).Seconds())
+	schedulerLog.Info("Updating all feeds", "sources", len(fs.feedManager.Sources))
+
+	var (
+		cycle    sync.WaitGroup
+		mu       sync.Mutex
+		newItems []feeds.FeedItem
+	)
 	for _, source := range fs.feedManager.Sources {
-		go fs.updateFeed(source)
+		fs.wg.Add(1)
+		cycle.Add(1)
+		go func() {
+			defer fs.wg.Done()
+			defer cycle.Done()
+			metrics.WorkersBusy.Inc("scheduler")
+			defer metrics.WorkersBusy.Dec("scheduler")
+			items := fs.updateFeed(fs.ctx, source)
+			mu.Lock()
+			newItems = append(newItems, items...)
+			mu.Unlock()
+		}()
 	}
+
+	fs.wg.Add(1)
+	go func() {
+		defer fs.wg.Done()
+		cycle.Wait()
+		finished := time.Now()
+		fs.lastCycle.Store(finished.UnixNano())
+		schedulerLastCycle.Set(float64(finished.Unix()))
+		fs.runSavedSearches(newItems)
+	}()
+}
+
+// Fails unless an update cycle has finished within maxAge
+func (fs *FeedScheduler) CheckFresh(maxAge time.Duration) error {
+	last := fs.lastCycle.Load()
+	if last == 0 {
+		return errors.New("no feed update cycle has finished yet")
+	}
+	if age := time.Since(time.Unix(0, last)); age > maxAge {
+		return fmt.Errorf("last feed update cycle finished %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// Records which of an ingest cycle's new items match users' saved searches
+func (fs *FeedScheduler) runSavedSearches(items []feeds.FeedItem) {
+	if len(items) == 0 || fs.ctx.Err() != nil {
+		return
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	matched, err := database.RunSavedSearches(fs.db, ids)
+	if err != nil {
+		schedulerLog.Error("Failed to run saved searches", "err", err)
+		return
+	}
+	schedulerLog.Info("Ran saved searches", "new_items", len(items), "matches", matched)
 }
 
 // Creates or updates a feed source
-func CreateOrUpdateFeedSource(db *sql.DB, name, url string) (*feeds.FeedSource, error) {
+func CreateOrUpdateFeedSource(db *sqldb.DB, name, url string) (*feeds.FeedSource, error) {
 	existing, err := feeds.GetFeedSourceByName(db, name)
 	if err == nil {
-		log.Printf(
-			"Found existing source: %s (ID: %d, LastUpdated: %v)",
-			name,
-			existing.ID,
-			existing.LastUpdated,
-		)
 		return existing, nil
 	}
 
-	log.Printf("Creating new feed source: %s", name)
-	val, args, _ := database.FeedInsertionBuilder.ToSql()
-	result, err := db.Exec(val, args...)
+	schedulerLog.Debug("Creating feed source", "source", name)
+	val, args, err := database.FeedInsertionBuilder.Values(name, url, "2000-01-01 00:00:00", 3600).ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert feed source: %w", err)
+		return nil, fmt.Errorf("failed to build feed source insert: %w", err)
 	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+	var id int
+	if err := db.QueryRow(val, args...).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to insert feed source: %w", err)
 	}
 
 	source := &feeds.FeedSource{
-		ID:             int(id),
+		ID:             id,
 		Name:           name,
 		URL:            url,
 		LastUpdated:    time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
 		UpdateInterval: 3600,
 	}
 
-	log.Printf("Created new feed source with ID: %d", source.ID)
+	schedulerLog.Info("Created feed source", "source", name, "source_id", source.ID)
 	return source, nil
 }
 
 // Resets all feed timestamps to force updates
-func ResetAllFeedTimestamps(db *sql.DB) error {
+func ResetAllFeedTimestamps(db *sqldb.DB) error {
 	query := database.ResetAllFeedTimestampsQuery
 	_, err := db.Exec(query)
 	if err != nil {
 		return fmt.Errorf("failed to reset feed timestamps: %w", err)
 	}
-	log.Println("Reset all feed timestamps to force updates")
+	schedulerLog.Info("Reset all feed timestamps to force updates")
 	return nil
 }
 
-// Updates a feed source
-func (fs *FeedScheduler) updateFeed(source feeds.FeedSourceInterface) {
+// Updates a feed source, returning the items that were not stored before
+func (fs *FeedScheduler) updateFeed(ctx context.Context, source feeds.FeedSourceInterface) []feeds.FeedItem {
 	var (
 		sourceName    = source.GetSourceName()
 		feedURL       = source.GetFeedURL()
 		dbSource, err = feeds.CreateOrUpdateFeedSource(fs.db, sourceName, feedURL)
 	)
 	if err != nil {
-		log.Printf("ERROR: Failed to create/update feed source %s: %v", sourceName, err)
-		return
+		schedulerLog.Error("Failed to create or update feed source", "source", sourceName, "err", err)
+		return nil
 	}
 
-	log.Printf("DB Source - ID: %d, LastUpdated: %v", dbSource.ID, dbSource.LastUpdated)
-	shouldUpdate := feeds.ShouldUpdateFeed(*dbSource)
-	log.Printf("Should update feed %s: %v", sourceName, shouldUpdate)
-	if !shouldUpdate {
-		log.Printf("SKIPPING: Feed %s is up to date (last updated: %v)", sourceName, dbSource.LastUpdated)
-		return
+	logger := schedulerLog.With("source", sourceName, "source_id", dbSource.ID)
+	if dbSource.Disabled {
+		logger.Debug("Skipping disabled feed")
+		return nil
+	}
+	if !feeds.ShouldUpdateFeed(*dbSource) {
+		logger.Debug("Skipping feed that is up to date", "last_updated", dbSource.LastUpdated)
+		return nil
 	}
 
-	log.Printf("FETCHING: RSS content from %s", feedURL)
-	content, err := feeds.FetchFeed(feedURL)
+	started := time.Now()
+	content, err := feeds.FetchFeed(ctx, feedURL)
+	feedFetchDuration.ObserveSince(started, sourceName)
 	if err != nil {
-		log.Printf("ERROR: Failed to fetch feed %s: %v", sourceName, err)
-		return
+		feedFetches.Inc(sourceName, "fetch_error")
+		logger.Error("Failed to fetch feed", "url", feedURL, "err", err)
+		return nil
 	}
+	logger.Debug("Fetched feed", "bytes", len(content), "duration", time.Since(started))
 
-	log.Printf("SUCCESS: Fetched %d bytes from %s", len(content), sourceName)
 	items, err := source.ParseFeed(content, dbSource.ID)
 	if err != nil {
-		log.Printf("ERROR: Failed to parse feed %s: %v", sourceName, err)
-		return
+		feedFetches.Inc(sourceName, "parse_error")
+		logger.Error("Failed to parse feed", "err", err)
+		return nil
 	}
 
-	log.Printf("SUCCESS: Parsed %d items from %s", len(items), sourceName)
+	for i := range items {
+		items[i].SourceName = dbSource.Name
+	}
 
-	for i, item := range items {
-		if i >= 2 {
-			break
-		}
-		log.Printf("  Sample item %d: %s", i+1, item.Title)
+	if ctx.Err() != nil {
+		logger.Info("Shutting down before saving feed items")
+		return nil
 	}
 
-	err = feeds.SaveFeedItems(fs.db, items)
+	newItems, err := feeds.SaveNewFeedItems(fs.db, items)
 	if err != nil {
-		log.Printf("ERROR: Failed to save feed items for %s: %v", sourceName, err)
-		return
+		feedFetches.Inc(sourceName, "save_error")
+		logger.Error("Failed to save feed items", "err", err)
+		return nil
 	}
 
-	log.Printf("SUCCESS: Saved %d items for %s", len(items), sourceName)
+	feedFetches.Inc(sourceName, "ok")
+	feedItemsIngested.Add(float64(len(newItems)), sourceName)
+	logger.Info("Updated feed", "items", len(items), "new", len(newItems))
+
+	if fs.webhooks != nil {
+		fs.webhooks.Notify(newItems)
+	}
 
 	err = feeds.UpdateFeedSourceTimestamp(fs.db, dbSource.ID)
 	if err != nil {
-		log.Printf("ERROR: Failed to update timestamp for %s: %v", sourceName, err)
-		return
+		logger.Error("Failed to update feed source timestamp", "err", err)
 	}
-
-	log.Printf("SUCCESS: Updated timestamp for %s", sourceName)
-	log.Printf("=== Finished processing: %s ===\n", sourceName)
+	return newItems
 }
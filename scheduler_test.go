@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+)
+
+// Opens a migrated SQLite database in a temporary directory
+func openTestDB(t *testing.T) *sqldb.DB {
+	t.Helper()
+	db, err := sqldb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+// A feed source served from url
+type testSource struct {
+	url string
+}
+
+func (s testSource) GetFeedURL() string    { return s.url }
+func (s testSource) GetSourceName() string { return "Slow feed" }
+func (s testSource) ParseFeed(content []byte, sourceID int) ([]feeds.FeedItem, error) {
+	return []feeds.FeedItem{{ID: "slow-1", SourceID: sourceID, Title: "Slow item", URL: "https://example.com/slow"}}, nil
+}
+
+func TestSchedulerStopCancelsFetches(t *testing.T) {
+	fetching := make(chan struct{})
+	cancelled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(fetching)
+		// Only returns once the scheduler gives up on the request
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer server.Close()
+
+	db := openTestDB(t)
+	fs := NewFeedScheduler(db, nil, time.Hour)
+	fs.feedManager = &feeds.FeedManager{Sources: []feeds.FeedSourceInterface{testSource{url: server.URL}}}
+	fs.Start()
+
+	select {
+	case <-fetching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("scheduler never fetched the feed")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		fs.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return while a fetch was blocked")
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the in-flight request was not cancelled")
+	}
+
+	var saved int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM feed_items`).Scan(&saved); err != nil || saved != 0 {
+		t.Errorf("saved %d items from a cancelled fetch, %v", saved, err)
+	}
+}
@@ -0,0 +1,201 @@
+package search
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Parses a query, returning an *Error if it is malformed
+func Parse(input string) (*Query, error) {
+	p := &parser{in: []rune(input), fields: true}
+	return p.parse()
+}
+
+// Parses a query as free text only.
+//
+// Field filters are read as ordinary words and nothing is rejected, which
+// suits searches that have no fields to filter on.
+func ParseText(input string) *Query {
+	p := &parser{in: []rune(input)}
+	q, _ := p.parse()
+	return q
+}
+
+type parser struct {
+	in     []rune
+	pos    int
+	fields bool
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.in)
+}
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.in[p.pos]
+}
+
+func (p *parser) parse() (*Query, error) {
+	q := &Query{}
+	for {
+		for !p.eof() && unicode.IsSpace(p.peek()) {
+			p.pos++
+		}
+		if p.eof() {
+			return q, nil
+		}
+
+		start := p.pos
+		not := false
+		if p.peek() == '-' {
+			not = true
+			p.pos++
+			if p.eof() || unicode.IsSpace(p.peek()) {
+				continue
+			}
+		}
+
+		if p.peek() == '"' {
+			phrase, err := p.quoted()
+			if err != nil {
+				return nil, err
+			}
+			prefix := p.peek() == '*'
+			if prefix {
+				p.pos++
+			}
+			q.add(Text{Offset: start, Words: words(phrase), Prefix: prefix, Not: not})
+			continue
+		}
+
+		if field, ok := p.field(); ok {
+			expr, err := p.filter(start, field, not)
+			if err != nil {
+				return nil, err
+			}
+			q.Exprs = append(q.Exprs, expr)
+			continue
+		}
+
+		word := p.until(func(r rune) bool { return unicode.IsSpace(r) || r == '"' })
+		q.add(Text{Offset: start, Words: words(word), Prefix: strings.HasSuffix(word, "*"), Not: not})
+	}
+}
+
+// Adds a text expression unless it has no words, like a lone * or punctuation
+func (q *Query) add(text Text) {
+	if len(text.Words) > 0 {
+		q.Exprs = append(q.Exprs, text)
+	}
+}
+
+// Reads runes up to, not including, the first one stop accepts
+func (p *parser) until(stop func(rune) bool) string {
+	start := p.pos
+	for !p.eof() && !stop(p.peek()) {
+		p.pos++
+	}
+	return string(p.in[start:p.pos])
+}
+
+// Reads a "quoted" string starting at the current quote.
+//
+// An unterminated quote is an error when fields are parsed, and otherwise runs to the end.
+func (p *parser) quoted() (string, error) {
+	open := p.pos
+	p.pos++
+	text := p.until(func(r rune) bool { return r == '"' })
+	if p.eof() {
+		if p.fields {
+			return "", &Error{Offset: open, Message: "unterminated quote"}
+		}
+		return text, nil
+	}
+	p.pos++
+	return text, nil
+}
+
+// Consumes a known field name and its colon, if the query continues with one
+func (p *parser) field() (Field, bool) {
+	if !p.fields {
+		return "", false
+	}
+	end := p.pos
+	for end < len(p.in) && unicode.IsLetter(p.in[end]) {
+		end++
+	}
+	if end == p.pos || end >= len(p.in) || p.in[end] != ':' {
+		return "", false
+	}
+	field := Field(strings.ToLower(string(p.in[p.pos:end])))
+	if _, ok := fieldKinds[field]; !ok {
+		return "", false
+	}
+	p.pos = end + 1
+	return field, true
+}
+
+// Reads the value of a field filter that started at start
+func (p *parser) filter(start int, field Field, not bool) (Expr, error) {
+	valueStart := p.pos
+	var value string
+	if p.peek() == '"' {
+		var err error
+		if value, err = p.quoted(); err != nil {
+			return nil, err
+		}
+	} else {
+		value = p.until(unicode.IsSpace)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, &Error{Offset: valueStart, Message: "missing value for " + string(field) + ":"}
+	}
+
+	switch fieldKinds[field] {
+	case "number":
+		op, number := splitOp(value)
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return nil, &Error{Offset: valueStart + len([]rune(string(op))), Message: "expected a whole number for " + string(field) + ":"}
+		}
+		if op == "" {
+			op = Eq
+		}
+		return Compare{Offset: start, Field: field, Op: op, Value: n, Not: not}, nil
+
+	case "date":
+		day, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return nil, &Error{Offset: valueStart, Message: "expected a date like 2026-01-31 for " + string(field) + ":"}
+		}
+		return Date{Offset: start, Field: field, Value: day, Not: not}, nil
+	}
+
+	if field == Domain {
+		value = strings.TrimSuffix(strings.ToLower(value), "/")
+	}
+	return Match{Offset: start, Field: field, Value: value, Not: not}, nil
+}
+
+// Splits a leading comparison operator off a value
+func splitOp(value string) (Op, string) {
+	for _, op := range []Op{Ge, Le, Gt, Lt, Eq} {
+		if rest, ok := strings.CutPrefix(value, string(op)); ok {
+			return op, rest
+		}
+	}
+	return "", value
+}
+
+// Splits text into words; anything other than letters and digits separates them
+func words(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,101 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Expr
+	}{
+		{"", nil},
+		{`  "" * - `, nil},
+		{"go rust", []Expr{
+			Text{Offset: 0, Words: []string{"go"}},
+			Text{Offset: 3, Words: []string{"rust"}},
+		}},
+		{`"open sour"* data*`, []Expr{
+			Text{Offset: 0, Words: []string{"open", "sour"}, Prefix: true},
+			Text{Offset: 13, Words: []string{"data"}, Prefix: true},
+		}},
+		{`-crypto -"web 3"`, []Expr{
+			Text{Offset: 0, Words: []string{"crypto"}, Not: true},
+			Text{Offset: 8, Words: []string{"web", "3"}, Not: true},
+		}},
+		{`source:"Hacker News" author:foo`, []Expr{
+			Match{Offset: 0, Field: Source, Value: "Hacker News"},
+			Match{Offset: 21, Field: Author, Value: "foo"},
+		}},
+		{"score:>100 comments:>=20 score:5", []Expr{
+			Compare{Offset: 0, Field: Score, Op: Gt, Value: 100},
+			Compare{Offset: 11, Field: Comments, Op: Ge, Value: 20},
+			Compare{Offset: 25, Field: Score, Op: Eq, Value: 5},
+		}},
+		{"after:2026-01-01 -before:2026-06-01", []Expr{
+			Date{Offset: 0, Field: After, Value: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+			Date{Offset: 17, Field: Before, Value: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), Not: true},
+		}},
+		{"Domain:GitHub.com/ tag:go", []Expr{
+			Match{Offset: 0, Field: Domain, Value: "github.com"},
+			Match{Offset: 19, Field: Tag, Value: "go"},
+		}},
+		// Unknown fields are plain words
+		{"note:later", []Expr{Text{Offset: 0, Words: []string{"note", "later"}}}},
+		// Offsets count characters, not bytes
+		{"café author:zoë", []Expr{
+			Text{Offset: 0, Words: []string{"café"}},
+			Match{Offset: 5, Field: Author, Value: "zoë"},
+		}},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Exprs, tt.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", tt.query, q.Exprs, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query  string
+		offset int
+	}{
+		{`rust "type system`, 5},
+		{`source:"Hacker News`, 7},
+		{"score:lots", 6},
+		{"score:>=many", 8},
+		{"comments:", 9},
+		{"ünï after:yesterday", 10},
+		{`before:""`, 7},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		var parseErr *Error
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%q) error = %v, want *Error", tt.query, err)
+			continue
+		}
+		if parseErr.Offset != tt.offset {
+			t.Errorf("Parse(%q) error offset = %d (%v), want %d", tt.query, parseErr.Offset, err, tt.offset)
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+	q := ParseText(`score:>100 "open source`)
+	want := []Expr{
+		Text{Offset: 0, Words: []string{"score", "100"}},
+		Text{Offset: 11, Words: []string{"open", "source"}},
+	}
+	if !reflect.DeepEqual(q.Exprs, want) {
+		t.Errorf("ParseText = %#v, want %#v", q.Exprs, want)
+	}
+}
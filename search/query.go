@@ -0,0 +1,158 @@
+// Package search parses the query language of the feed search box.
+//
+// A query is a list of space-separated expressions that must all match:
+//
+//	rust "type system" gener*   free text; quotes make a phrase, * a prefix
+//	source:"Hacker News"        feed source name
+//	author:foo                  author contains foo
+//	domain:github.com           item link is on the domain or a subdomain of it
+//	tag:go                      source belongs to the go subverse
+//	score:>100 comments:>=20    numeric comparisons with >, >=, <, <= or =
+//	after:2026-01-01            published on or after the date (UTC)
+//	before:2026-06-01           published before the date (UTC)
+//
+// Any expression can be negated with a leading -, as in -crypto or
+// -source:reddit. Offsets in the syntax tree and in errors count characters
+// (runes) from the start of the query, not bytes.
+package search
+
+import (
+	"fmt"
+	"time"
+)
+
+// A parsed query whose expressions must all match
+type Query struct {
+	Exprs []Expr
+}
+
+// Reports whether the query has no expressions
+func (q *Query) Empty() bool {
+	return q == nil || len(q.Exprs) == 0
+}
+
+// Returns the free-text expressions of the query
+func (q *Query) Text() []Text {
+	var texts []Text
+	for _, expr := range q.Exprs {
+		if text, ok := expr.(Text); ok {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// One expression of a query: Text, Match, Compare or Date
+type Expr interface {
+	// Character offset of the expression in the query, including any leading -
+	Pos() int
+	// Reports whether the expression was negated with -
+	Negated() bool
+}
+
+// A word or quoted phrase
+type Text struct {
+	Offset int
+	Words  []string
+	// Matches any word starting with the last word, written as a trailing *
+	Prefix bool
+	Not    bool
+}
+
+// A filter matching a text field
+type Match struct {
+	Offset int
+	Field  Field
+	Value  string
+	Not    bool
+}
+
+// A filter comparing a numeric field
+type Compare struct {
+	Offset int
+	Field  Field
+	Op     Op
+	Value  int
+	Not    bool
+}
+
+// A filter on the publication date
+type Date struct {
+	Offset int
+	Field  Field
+	// Midnight UTC of the given day
+	Value time.Time
+	Not   bool
+}
+
+func (e Text) Pos() int    { return e.Offset }
+func (e Match) Pos() int   { return e.Offset }
+func (e Compare) Pos() int { return e.Offset }
+func (e Date) Pos() int    { return e.Offset }
+
+func (e Text) Negated() bool    { return e.Not }
+func (e Match) Negated() bool   { return e.Not }
+func (e Compare) Negated() bool { return e.Not }
+func (e Date) Negated() bool    { return e.Not }
+
+// A field that can be filtered on with name:value
+type Field string
+
+const (
+	Source   Field = "source"
+	Author   Field = "author"
+	Domain   Field = "domain"
+	Tag      Field = "tag"
+	Score    Field = "score"
+	Comments Field = "comments"
+	After    Field = "after"
+	Before   Field = "before"
+)
+
+// The kind of value each field takes
+var fieldKinds = map[Field]string{
+	Source:   "text",
+	Author:   "text",
+	Domain:   "text",
+	Tag:      "text",
+	Score:    "number",
+	Comments: "number",
+	After:    "date",
+	Before:   "date",
+}
+
+// A numeric comparison operator
+type Op string
+
+const (
+	Eq Op = "="
+	Gt Op = ">"
+	Ge Op = ">="
+	Lt Op = "<"
+	Le Op = "<="
+)
+
+// Reports whether value op operand holds
+func (op Op) Compare(value, operand int) bool {
+	switch op {
+	case Gt:
+		return value > operand
+	case Ge:
+		return value >= operand
+	case Lt:
+		return value < operand
+	case Le:
+		return value <= operand
+	}
+	return value == operand
+}
+
+// A malformed query, located by the character offset where the problem was found
+type Error struct {
+	Offset  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at character %d", e.Message, e.Offset)
+}
@@ -6,6 +6,7 @@ class AdminPanel {
    init() {
       this.loadBannedIPs();
       this.loadSubverses();
+      this.loadSettings();
       this.setupEventListeners();
    }
 
@@ -21,6 +22,58 @@ class AdminPanel {
             this.createSubverse()
          );
       }
+
+      const requireAdmin2FA = document.getElementById("requireAdmin2FA");
+      if (requireAdmin2FA) {
+         requireAdmin2FA.addEventListener("change", () =>
+            this.updateSettings()
+         );
+      }
+   }
+
+   async loadSettings() {
+      const requireAdmin2FA = document.getElementById(
+         "requireAdmin2FA"
+      ) as HTMLInputElement | null;
+      if (!requireAdmin2FA) return;
+
+      try {
+         const response = await fetch("/api/admin/settings");
+         if (response.ok) {
+            const settings = await response.json();
+            requireAdmin2FA.checked = settings.require_admin_2fa;
+         }
+      } catch (error) {
+         console.error("Error loading settings:", error);
+      }
+   }
+
+   async updateSettings() {
+      const requireAdmin2FA = document.getElementById(
+         "requireAdmin2FA"
+      ) as HTMLInputElement;
+
+      try {
+         const response = await fetch("/api/admin/settings", {
+            method: "PUT",
+            headers: {
+               "Content-Type": "application/json",
+            },
+            body: JSON.stringify({ require_admin_2fa: requireAdmin2FA.checked }),
+         });
+
+         if (response.ok) {
+            this.showMessage("Settings saved", "success");
+         } else {
+            const error = await response.json();
+            requireAdmin2FA.checked = !requireAdmin2FA.checked;
+            this.showMessage(error.error || "Failed to save settings", "error");
+         }
+      } catch (error) {
+         console.error("Error saving settings:", error);
+         requireAdmin2FA.checked = !requireAdmin2FA.checked;
+         this.showMessage("Failed to save settings", "error");
+      }
    }
 
    async createSubverse() {
@@ -26,7 +26,7 @@ document.addEventListener("DOMContentLoaded", function () {
             const data = await response.json();
 
             if (response.ok) {
-               window.location.href = "/";
+               window.location.href = data.redirect || "/";
             } else if (data.toast) {
                (window as any).showToast[data.toast.type || "error"](data.toast.message);
             } else {
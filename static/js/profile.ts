@@ -151,3 +151,690 @@ document.addEventListener("DOMContentLoaded", function () {
       }
    }
 });
+
+document.addEventListener("DOMContentLoaded", function () {
+   const frequencySelect = document.getElementById(
+      "digestFrequency"
+   ) as HTMLSelectElement | null;
+   const sendTestBtn = document.getElementById(
+      "sendTestDigest"
+   ) as HTMLButtonElement | null;
+   const statusElement = document.getElementById("digestStatus");
+
+   if (!frequencySelect) return;
+
+   function setStatus(message: string, isError = false) {
+      if (!statusElement) return;
+      statusElement.textContent = message;
+      statusElement.classList.toggle("text-red-500", isError);
+   }
+
+   fetch("/api/digest")
+      .then((response) => response.json())
+      .then((data) => {
+         if (data.frequency) {
+            frequencySelect.value = data.frequency;
+         }
+      })
+      .catch((error) => console.error("Error loading digest settings:", error));
+
+   frequencySelect.addEventListener("change", async function () {
+      try {
+         const response = await fetch("/api/digest", {
+            method: "PUT",
+            headers: {
+               "Content-Type": "application/json",
+            },
+            body: JSON.stringify({ frequency: frequencySelect.value }),
+         });
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to update digest");
+         }
+         setStatus("Digest settings saved.");
+      } catch (error) {
+         setStatus(error.message, true);
+      }
+   });
+
+   if (sendTestBtn) {
+      sendTestBtn.addEventListener("click", async function () {
+         sendTestBtn.disabled = true;
+         try {
+            const response = await fetch("/api/digest/test", {
+               method: "POST",
+            });
+            const data = await response.json();
+            if (!response.ok) {
+               throw new Error(data.error || "Failed to send test digest");
+            }
+            setStatus("Test digest sent. Check your inbox.");
+         } catch (error) {
+            setStatus(error.message, true);
+         } finally {
+            sendTestBtn.disabled = false;
+         }
+      });
+   }
+});
+
+document.addEventListener("DOMContentLoaded", function () {
+   const form = document.getElementById("newsletterForm") as HTMLFormElement | null;
+   const nameInput = document.getElementById(
+      "newsletterName"
+   ) as HTMLInputElement | null;
+   const categorySelect = document.getElementById(
+      "newsletterCategory"
+   ) as HTMLSelectElement | null;
+   const list = document.getElementById("newsletterList");
+
+   if (!form || !list) return;
+
+   function escapeHTML(value: string): string {
+      const div = document.createElement("div");
+      div.textContent = value;
+      return div.innerHTML;
+   }
+
+   async function loadCategories() {
+      try {
+         const response = await fetch("/api/categories");
+         if (!response.ok) return;
+         const data = await response.json();
+         (data.categories || []).forEach((category) => {
+            const option = document.createElement("option");
+            option.value = String(category.id);
+            option.textContent = category.name;
+            categorySelect.appendChild(option);
+         });
+      } catch (error) {
+         console.error("Error loading categories:", error);
+      }
+   }
+
+   async function loadNewsletters() {
+      try {
+         const response = await fetch("/api/newsletters");
+         if (!response.ok) {
+            throw new Error("Failed to load newsletters");
+         }
+         const data = await response.json();
+         renderNewsletters(data.newsletters || []);
+      } catch (error) {
+         list.innerHTML = `<p class="text-sm text-red-500">${escapeHTML(
+            error.message
+         )}</p>`;
+      }
+   }
+
+   function renderNewsletters(newsletters) {
+      if (newsletters.length === 0) {
+         list.innerHTML = `<p class="text-sm text-gray-500 dark:text-gray-400">No newsletter addresses yet.</p>`;
+         return;
+      }
+
+      list.innerHTML = newsletters
+         .map(
+            (newsletter) => `
+         <div class="flex items-center justify-between bg-gray-50 dark:bg-gray-700 rounded-lg p-3 border border-gray-200 dark:border-gray-600">
+            <div class="min-w-0">
+               <div class="text-sm font-semibold text-gray-900 dark:text-gray-100">${escapeHTML(
+                  newsletter.name
+               )}</div>
+               <code class="text-xs text-gray-600 dark:text-gray-300 break-all">${escapeHTML(
+                  newsletter.address
+               )}</code>
+            </div>
+            <div class="flex items-center space-x-2 ml-3">
+               <button class="copy-newsletter px-2 py-1 text-xs rounded-md bg-gray-200 dark:bg-gray-600 text-gray-700 dark:text-gray-200"
+                  data-address="${escapeHTML(newsletter.address)}">
+                  <i class="far fa-copy"></i>
+               </button>
+               <button class="delete-newsletter px-2 py-1 text-xs rounded-md bg-red-600 hover:bg-red-700 text-white"
+                  data-id="${newsletter.id}">
+                  <i class="fas fa-trash"></i>
+               </button>
+            </div>
+         </div>
+      `
+         )
+         .join("");
+
+      list.querySelectorAll(".copy-newsletter").forEach((button) => {
+         button.addEventListener("click", function () {
+            navigator.clipboard.writeText(this.getAttribute("data-address"));
+         });
+      });
+      list.querySelectorAll(".delete-newsletter").forEach((button) => {
+         button.addEventListener("click", async function () {
+            if (!confirm("Stop accepting mail at this address? Items already received are kept.")) {
+               return;
+            }
+            const response = await fetch(
+               `/api/newsletters/${this.getAttribute("data-id")}`,
+               { method: "DELETE" }
+            );
+            if (response.ok) {
+               loadNewsletters();
+            }
+         });
+      });
+   }
+
+   form.addEventListener("submit", async function (event) {
+      event.preventDefault();
+      try {
+         const response = await fetch("/api/newsletters", {
+            method: "POST",
+            headers: {
+               "Content-Type": "application/json",
+            },
+            body: JSON.stringify({
+               name: nameInput.value,
+               category_id: parseInt(categorySelect.value, 10) || 0,
+            }),
+         });
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to create newsletter address");
+         }
+         nameInput.value = "";
+         loadNewsletters();
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   loadCategories();
+   loadNewsletters();
+});
+
+document.addEventListener("DOMContentLoaded", function () {
+   const requestBtn = document.getElementById(
+      "requestDataExport"
+   ) as HTMLButtonElement | null;
+   const list = document.getElementById("dataExportList");
+
+   if (!requestBtn || !list) return;
+
+   let pollTimer: number | undefined;
+
+   function escapeHTML(value: string): string {
+      const div = document.createElement("div");
+      div.textContent = value;
+      return div.innerHTML;
+   }
+
+   function formatSize(bytes: number): string {
+      if (bytes < 1024) return `${bytes} B`;
+      if (bytes < 1024 * 1024) return `${(bytes / 1024).toFixed(1)} KB`;
+      return `${(bytes / (1024 * 1024)).toFixed(1)} MB`;
+   }
+
+   function describe(dataExport): string {
+      switch (dataExport.status) {
+         case "pending":
+         case "running":
+            return "Preparing your archive...";
+         case "ready":
+            return `Ready, ${formatSize(dataExport.file_size)}. Available until ${new Date(
+               dataExport.expires_at
+            ).toLocaleString()}`;
+         case "failed":
+            return dataExport.error || "Export failed";
+         default:
+            return "Expired";
+      }
+   }
+
+   async function loadExports() {
+      try {
+         const response = await fetch("/api/exports");
+         if (!response.ok) {
+            throw new Error("Failed to load exports");
+         }
+         const data = await response.json();
+         renderExports(data.exports || []);
+      } catch (error) {
+         list.innerHTML = `<p class="text-sm text-red-500">${escapeHTML(
+            error.message
+         )}</p>`;
+      }
+   }
+
+   function renderExports(dataExports) {
+      const inProgress = dataExports.some(
+         (dataExport) =>
+            dataExport.status === "pending" || dataExport.status === "running"
+      );
+      requestBtn.disabled = inProgress;
+
+      window.clearTimeout(pollTimer);
+      if (inProgress) {
+         pollTimer = window.setTimeout(loadExports, 3000);
+      }
+
+      if (dataExports.length === 0) {
+         list.innerHTML = `<p class="text-sm text-gray-500 dark:text-gray-400">No exports yet.</p>`;
+         return;
+      }
+
+      list.innerHTML = dataExports
+         .map(
+            (dataExport) => `
+         <div class="flex items-center justify-between bg-gray-50 dark:bg-gray-700 rounded-lg p-3 border border-gray-200 dark:border-gray-600">
+            <div class="min-w-0">
+               <div class="text-sm font-semibold text-gray-900 dark:text-gray-100">${escapeHTML(
+                  new Date(dataExport.created_at).toLocaleString()
+               )}</div>
+               <div class="text-xs text-gray-600 dark:text-gray-300">${escapeHTML(
+                  describe(dataExport)
+               )}</div>
+            </div>
+            ${
+               dataExport.download_url
+                  ? `<a href="${escapeHTML(dataExport.download_url)}"
+                  class="ml-3 px-3 py-1 text-xs rounded-md bg-blue-600 hover:bg-blue-700 text-white">
+                  <i class="fas fa-download mr-1"></i>Download
+               </a>`
+                  : ""
+            }
+         </div>
+      `
+         )
+         .join("");
+   }
+
+   requestBtn.addEventListener("click", async function () {
+      requestBtn.disabled = true;
+      try {
+         const response = await fetch("/api/exports", { method: "POST" });
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to request export");
+         }
+      } catch (error) {
+         alert(error.message);
+      } finally {
+         loadExports();
+      }
+   });
+
+   loadExports();
+});
+
+document.addEventListener("DOMContentLoaded", function () {
+   const form = document.getElementById(
+      "accountDeletionForm"
+   ) as HTMLFormElement | null;
+   const passwordInput = document.getElementById(
+      "deletionPassword"
+   ) as HTMLInputElement | null;
+   const scheduled = document.getElementById("accountDeletionScheduled");
+   const dateElement = document.getElementById("accountDeletionDate");
+   const cancelBtn = document.getElementById(
+      "cancelAccountDeletion"
+   ) as HTMLButtonElement | null;
+
+   if (!form || !scheduled) return;
+
+   function render(data) {
+      if (data.scheduled) {
+         dateElement.textContent = `Your account will be deleted on ${new Date(
+            data.scheduled_at
+         ).toLocaleString()}.`;
+         scheduled.classList.remove("hidden");
+         form.classList.add("hidden");
+      } else {
+         scheduled.classList.add("hidden");
+         form.classList.remove("hidden");
+      }
+   }
+
+   fetch("/api/account/deletion")
+      .then((response) => response.json())
+      .then(render)
+      .catch((error) =>
+         console.error("Error loading account deletion:", error)
+      );
+
+   form.addEventListener("submit", async function (event) {
+      event.preventDefault();
+      if (
+         !confirm(
+            "Delete your account? You can still cancel before the deletion date."
+         )
+      ) {
+         return;
+      }
+      try {
+         const response = await fetch("/api/account/deletion", {
+            method: "POST",
+            headers: {
+               "Content-Type": "application/json",
+            },
+            body: JSON.stringify({ password: passwordInput.value }),
+         });
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to delete account");
+         }
+         passwordInput.value = "";
+         render(data);
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   if (cancelBtn) {
+      cancelBtn.addEventListener("click", async function () {
+         try {
+            const response = await fetch("/api/account/deletion", {
+               method: "DELETE",
+            });
+            const data = await response.json();
+            if (!response.ok) {
+               throw new Error(data.error || "Failed to cancel deletion");
+            }
+            render(data);
+         } catch (error) {
+            alert(error.message);
+         }
+      });
+   }
+});
+
+document.addEventListener("DOMContentLoaded", function () {
+   const resendBtn = document.getElementById(
+      "resendVerification"
+   ) as HTMLButtonElement | null;
+   const statusElement = document.getElementById("verificationStatus");
+
+   if (!resendBtn) return;
+
+   resendBtn.addEventListener("click", async function () {
+      resendBtn.disabled = true;
+      try {
+         const response = await fetch("/api/account/verification", {
+            method: "POST",
+         });
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to send verification email");
+         }
+         statusElement.textContent = "Sent. Check your inbox.";
+      } catch (error) {
+         statusElement.textContent = error.message;
+      } finally {
+         resendBtn.disabled = false;
+      }
+   });
+});
+
+document.addEventListener("DOMContentLoaded", function () {
+   const statusElement = document.getElementById("twoFactorStatus");
+   const setupForm = document.getElementById(
+      "twoFactorSetupForm"
+   ) as HTMLFormElement | null;
+   const setupPassword = document.getElementById(
+      "twoFactorSetupPassword"
+   ) as HTMLInputElement | null;
+   const enrol = document.getElementById("twoFactorEnrol");
+   const qrCode = document.getElementById("twoFactorQRCode");
+   const secretElement = document.getElementById("twoFactorSecret");
+   const enableForm = document.getElementById(
+      "twoFactorEnableForm"
+   ) as HTMLFormElement | null;
+   const enableCode = document.getElementById(
+      "twoFactorEnableCode"
+   ) as HTMLInputElement | null;
+   const recoveryCodes = document.getElementById("twoFactorRecoveryCodes");
+   const recoveryCodeList = document.getElementById(
+      "twoFactorRecoveryCodeList"
+   );
+   const manageForm = document.getElementById(
+      "twoFactorManageForm"
+   ) as HTMLFormElement | null;
+   const managePassword = document.getElementById(
+      "twoFactorManagePassword"
+   ) as HTMLInputElement | null;
+   const manageCode = document.getElementById(
+      "twoFactorManageCode"
+   ) as HTMLInputElement | null;
+   const regenerateBtn = document.getElementById("regenerateRecoveryCodes");
+   const disableBtn = document.getElementById("disableTwoFactor");
+
+   if (!statusElement || !setupForm) return;
+
+   async function post(path: string, body: object) {
+      const response = await fetch(path, {
+         method: "POST",
+         headers: {
+            "Content-Type": "application/json",
+         },
+         body: JSON.stringify(body),
+      });
+      const data = await response.json();
+      if (!response.ok) {
+         throw new Error(data.error || "Request failed");
+      }
+      return data;
+   }
+
+   function showRecoveryCodes(codes: string[]) {
+      recoveryCodeList.textContent = codes.join("\n");
+      recoveryCodes.classList.remove("hidden");
+   }
+
+   function render(data) {
+      enrol.classList.add("hidden");
+      if (data.enabled) {
+         let text = `Two-factor authentication is on. ${data.recovery_codes_left} recovery codes left.`;
+         if (data.required) {
+            text += " It is required for admins, so it cannot be turned off.";
+         }
+         statusElement.textContent = text;
+         setupForm.classList.add("hidden");
+         manageForm.classList.remove("hidden");
+         disableBtn.classList.toggle("hidden", data.required);
+      } else {
+         statusElement.textContent = data.required
+            ? "Two-factor authentication is off. Admin features are unavailable until you turn it on."
+            : "Two-factor authentication is off.";
+         setupForm.classList.remove("hidden");
+         manageForm.classList.add("hidden");
+      }
+   }
+
+   function load() {
+      fetch("/api/account/2fa")
+         .then((response) => response.json())
+         .then(render)
+         .catch((error) =>
+            console.error("Error loading two-factor status:", error)
+         );
+   }
+
+   setupForm.addEventListener("submit", async function (event) {
+      event.preventDefault();
+      try {
+         const data = await post("/api/account/2fa/setup", {
+            password: setupPassword.value,
+         });
+         setupPassword.value = "";
+         secretElement.textContent = data.secret;
+         qrCode.innerHTML = "";
+         const QRCode = (window as any).QRCode;
+         if (QRCode) {
+            new QRCode(qrCode, { text: data.uri, width: 180, height: 180 });
+         }
+         setupForm.classList.add("hidden");
+         enrol.classList.remove("hidden");
+         enableCode.focus();
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   enableForm.addEventListener("submit", async function (event) {
+      event.preventDefault();
+      try {
+         const data = await post("/api/account/2fa/enable", {
+            code: enableCode.value,
+         });
+         enableCode.value = "";
+         showRecoveryCodes(data.recovery_codes);
+         load();
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   regenerateBtn.addEventListener("click", async function () {
+      try {
+         const data = await post("/api/account/2fa/recovery-codes", {
+            code: manageCode.value,
+         });
+         manageCode.value = "";
+         showRecoveryCodes(data.recovery_codes);
+         load();
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   disableBtn.addEventListener("click", async function () {
+      if (!confirm("Turn off two-factor authentication?")) {
+         return;
+      }
+      try {
+         await post("/api/account/2fa/disable", {
+            password: managePassword.value,
+            code: manageCode.value,
+         });
+         managePassword.value = "";
+         manageCode.value = "";
+         recoveryCodes.classList.add("hidden");
+         load();
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   load();
+});
+
+document.addEventListener("DOMContentLoaded", function () {
+   const form = document.getElementById(
+      "apiTokenForm"
+   ) as HTMLFormElement | null;
+   const nameInput = document.getElementById(
+      "apiTokenName"
+   ) as HTMLInputElement | null;
+   const created = document.getElementById("apiTokenCreated");
+   const valueElement = document.getElementById("apiTokenValue");
+   const list = document.getElementById("apiTokenList");
+
+   if (!form || !list) return;
+
+   function escapeHTML(value: string): string {
+      const div = document.createElement("div");
+      div.textContent = value;
+      return div.innerHTML;
+   }
+
+   function render(tokens) {
+      if (!tokens || tokens.length === 0) {
+         list.innerHTML = `<p class="text-sm text-gray-500 dark:text-gray-400">No API tokens yet.</p>`;
+         return;
+      }
+      list.innerHTML = tokens
+         .map(
+            (token) => `
+         <div class="flex items-center justify-between gap-3 p-3 bg-gray-50 dark:bg-gray-700 rounded-md">
+            <div class="min-w-0">
+               <p class="text-sm font-medium text-gray-900 dark:text-gray-100">${escapeHTML(token.name)}</p>
+               <p class="text-xs text-gray-500 dark:text-gray-400">
+                  ${token.scopes.join(", ")} &middot; created ${new Date(
+                     token.created_at
+                  ).toLocaleDateString()} &middot; ${
+                     token.last_used_at
+                        ? `last used ${new Date(token.last_used_at).toLocaleString()}`
+                        : "never used"
+                  }
+               </p>
+            </div>
+            <button data-token-id="${token.id}"
+               class="revoke-api-token px-3 py-1 text-sm text-red-600 dark:text-red-400 hover:underline">
+               Revoke
+            </button>
+         </div>
+      `
+         )
+         .join("");
+   }
+
+   async function load() {
+      try {
+         const response = await fetch("/api/account/tokens");
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to load API tokens");
+         }
+         render(data.tokens);
+      } catch (error) {
+         console.error("Error loading API tokens:", error);
+      }
+   }
+
+   form.addEventListener("submit", async function (event) {
+      event.preventDefault();
+      const scopes = Array.from(
+         form.querySelectorAll('input[name="apiTokenScope"]:checked')
+      ).map((input) => (input as HTMLInputElement).value);
+      try {
+         const response = await fetch("/api/account/tokens", {
+            method: "POST",
+            headers: {
+               "Content-Type": "application/json",
+            },
+            body: JSON.stringify({ name: nameInput.value, scopes }),
+         });
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to create API token");
+         }
+         nameInput.value = "";
+         valueElement.textContent = data.token;
+         created.classList.remove("hidden");
+         load();
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   list.addEventListener("click", async function (event) {
+      const button = (event.target as HTMLElement).closest(
+         ".revoke-api-token"
+      ) as HTMLElement | null;
+      if (!button) return;
+      if (!confirm("Revoke this token? Scripts using it will stop working.")) {
+         return;
+      }
+      try {
+         const response = await fetch(
+            `/api/account/tokens/${button.dataset.tokenId}`,
+            { method: "DELETE" }
+         );
+         const data = await response.json();
+         if (!response.ok) {
+            throw new Error(data.error || "Failed to revoke API token");
+         }
+         load();
+      } catch (error) {
+         alert(error.message);
+      }
+   });
+
+   load();
+});
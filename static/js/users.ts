@@ -37,13 +37,33 @@ document.addEventListener("DOMContentLoaded", function () {
                                     }</h3>
                                     <p class="text-gray-600 dark:text-gray-400">${
                                        user.email
-                                    }</p>
+                                    }${user.email_verified ? "" : " (unverified)"}</p>
                                     <p class="text-gray-600 dark:text-gray-400">IP: ${
                                        user.ip_address || "N/A"
                                     }</p>
                                 </div>
+                                <div class="flex gap-2">
+                                    ${
+                                       user.email_verified
+                                          ? ""
+                                          : `<button class="verify-user px-3 py-1 text-sm rounded-md bg-blue-600 hover:bg-blue-700 text-white"
+                                    data-id="${user.id}">
+                                    <i class="fas fa-check mr-1"></i>Verify
+                                </button>`
+                                    }
+                                    <button class="delete-user px-3 py-1 text-sm rounded-md bg-red-600 hover:bg-red-700 text-white"
+                                        data-id="${user.id}">
+                                        <i class="fas fa-user-slash mr-1"></i>Delete
+                                    </button>
+                                </div>
                             </div>
                         `;
+                  userElement
+                     .querySelector(".delete-user")
+                     .addEventListener("click", () => deleteUser(user));
+                  userElement
+                     .querySelector(".verify-user")
+                     ?.addEventListener("click", () => verifyUser(user));
                   usersList.appendChild(userElement);
                });
                noUsers.style.display = "none";
@@ -65,5 +85,37 @@ document.addEventListener("DOMContentLoaded", function () {
             noUsers.style.display = "none";
          });
    }
+   function deleteUser(user) {
+      if (
+         !confirm(
+            `Delete ${user.username} now? Their comments and posts will be shown as [deleted].`
+         )
+      ) {
+         return;
+      }
+      fetch(`/api/admin/users/${user.id}`, { method: "DELETE" })
+         .then((response) =>
+            response.json().then((data) => {
+               if (!response.ok) {
+                  throw new Error(data.error || "Failed to delete user");
+               }
+               fetchUsers();
+            })
+         )
+         .catch((error) => alert(error.message));
+   }
+   function verifyUser(user) {
+      fetch(`/api/admin/users/${user.id}/verify`, { method: "POST" })
+         .then((response) =>
+            response.json().then((data) => {
+               if (!response.ok) {
+                  throw new Error(data.error || "Failed to verify user");
+               }
+               fetchUsers();
+            })
+         )
+         .catch((error) => alert(error.message));
+   }
+
    fetchUsers();
 });
@@ -0,0 +1,71 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors from RFC 6238 appendix B, cut to six digits
+func TestCodeMatchesRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	for _, tt := range []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	} {
+		got, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 || strings.Contains(secret, "=") {
+		t.Errorf("secret %q is not 32 unpadded base32 characters", secret)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := Code(secret, Step(now))
+
+	if step, ok := Validate(secret, code, now); !ok || step != Step(now) {
+		t.Errorf("Validate current code = %d, %v", step, ok)
+	}
+	if _, ok := Validate(secret, code[:3]+" "+code[3:], now); !ok {
+		t.Error("code with a space in it rejected")
+	}
+	if _, ok := Validate(secret, code, now.Add(Period)); !ok {
+		t.Error("code from the previous step rejected")
+	}
+	if _, ok := Validate(secret, code, now.Add(3*Period)); ok {
+		t.Error("code from three steps ago accepted")
+	}
+	if _, ok := Validate(secret, "000000", now); ok && code != "000000" {
+		t.Error("wrong code accepted")
+	}
+	if _, ok := Validate("not base32!", code, now); ok {
+		t.Error("code accepted for an invalid secret")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	got := ProvisioningURI("JBSWY3DPEHPK3PXP", "Versed", "reader@example.com")
+	want := "otpauth://totp/Versed:reader@example.com?algorithm=SHA1&digits=6&issuer=Versed&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Errorf("ProvisioningURI = %s, want %s", got, want)
+	}
+}
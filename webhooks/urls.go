@@ -0,0 +1,154 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// Returned for a webhook URL that is not an absolute http(s) URL
+	ErrInvalidURL = errors.New("webhook URL must be an absolute http or https URL")
+	// Returned for a webhook URL whose host is, or resolves to, a loopback,
+	// private, link-local or other reserved address
+	ErrPrivateAddress = errors.New("webhook URL points to a private address")
+	// Returned for a webhook URL whose host does not resolve
+	ErrUnresolvableHost = errors.New("webhook URL host could not be resolved")
+)
+
+// How long CheckURL waits on DNS
+const resolveTimeout = 5 * time.Second
+
+// Looks up a host's addresses; replaced in tests
+var lookupHost = net.DefaultResolver.LookupNetIP
+
+// Checks that a webhook URL is absolute http(s) and that its host does not
+// point into the server's own network, where deliveries could be used to
+// probe internal services. The dispatcher checks again on connect, as DNS
+// may change after this.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrInvalidURL
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !isPublicAddr(addr) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := lookupHost(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return ErrUnresolvableHost
+	}
+	for _, addr := range addrs {
+		if !isPublicAddr(addr) {
+			return ErrPrivateAddress
+		}
+	}
+	return nil
+}
+
+// Special-purpose ranges that IsGlobalUnicast and IsPrivate let through but
+// that no webhook endpoint should be in
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"),   // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("192.88.99.0/24"),  // 6to4 relay anycast
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("::/96"),           // IPv4-compatible, deprecated
+	netip.MustParsePrefix("::ffff:0:0:0/96"), // IPv4-translated
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local-use NAT64
+	netip.MustParsePrefix("100::/64"),        // discard-only
+	netip.MustParsePrefix("2001::/32"),       // Teredo, which tunnels to an address hidden inside
+	netip.MustParsePrefix("2001:2::/48"),     // benchmarking
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("fec0::/10"),       // site-local, deprecated
+}
+
+// IPv6 ranges that carry an IPv4 address and are routed on to it
+var (
+	nat64Prefix     = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+)
+
+// Reports whether addr is one deliveries may be sent to: not loopback,
+// private, link-local, multicast, unspecified or otherwise reserved, nor an
+// IPv6 address standing in for an IPv4 one that is
+func isPublicAddr(addr netip.Addr) bool {
+	addr = embeddedIPv4(addr.Unmap())
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the IPv4 address a NAT64 or 6to4 address leads to, or addr itself
+// for any other address
+func embeddedIPv4(addr netip.Addr) netip.Addr {
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[12:16]))
+	case sixToFourPrefix.Contains(addr):
+		return netip.AddrFrom4([4]byte(b[2:6]))
+	}
+	return addr
+}
+
+// Refuses connections to addresses CheckURL would reject, after DNS has been
+// resolved, so a hostname cannot be re-pointed at an internal address once
+// the webhook is saved
+func dialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("unexpected dial address %q: %w", address, err)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// Returns the client deliveries are sent with. It bypasses any proxy so the
+// dial check sees the address actually connected to, including on redirects.
+func newClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: dialControl,
+	}
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: 5 * time.Second,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
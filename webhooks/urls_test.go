@@ -0,0 +1,135 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestCheckURL(t *testing.T) {
+	defaultLookupHost := lookupHost
+	t.Cleanup(func() { lookupHost = defaultLookupHost })
+	lookupHost = func(_ context.Context, _, host string) ([]netip.Addr, error) {
+		switch host {
+		case "hooks.example.com":
+			return []netip.Addr{netip.MustParseAddr("93.184.216.34")}, nil
+		case "internal.example.com":
+			return []netip.Addr{netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("10.0.0.5")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://hooks.example.com/versed", nil},
+		{"http://93.184.216.34:8080/hook", nil},
+		{"https://[2606:4700::1111]/hook", nil},
+		{"ftp://hooks.example.com/", ErrInvalidURL},
+		{"/relative", ErrInvalidURL},
+		{"https://", ErrInvalidURL},
+		{"http://localhost:8080/", ErrPrivateAddress},
+		{"http://LOCALHOST./", ErrPrivateAddress},
+		{"http://admin.localhost/", ErrPrivateAddress},
+		{"http://127.0.0.1/", ErrPrivateAddress},
+		{"http://[::1]/", ErrPrivateAddress},
+		{"http://[::ffff:127.0.0.1]/", ErrPrivateAddress},
+		{"http://0.0.0.0/", ErrPrivateAddress},
+		{"http://10.1.2.3/", ErrPrivateAddress},
+		{"http://172.16.0.1/", ErrPrivateAddress},
+		{"http://192.168.1.1/", ErrPrivateAddress},
+		{"http://169.254.169.254/latest/meta-data/", ErrPrivateAddress},
+		{"http://[fe80::1]/", ErrPrivateAddress},
+		{"http://[fd00::1]/", ErrPrivateAddress},
+		{"http://100.100.100.200/", ErrPrivateAddress},
+		{"http://[64:ff9b::a9fe:a9fe]/", ErrPrivateAddress},
+		{"https://internal.example.com/", ErrPrivateAddress},
+		{"https://nowhere.invalid/", ErrUnresolvableHost},
+	}
+	for _, tt := range tests {
+		if err := CheckURL(tt.url); !errors.Is(err, tt.want) {
+			t.Errorf("CheckURL(%q) = %v, want %v", tt.url, err, tt.want)
+		}
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:4700::1111", true},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::5db8:d822", true}, // NAT64 for 93.184.216.34
+		{"2002:5db8:d822::1", true},  // 6to4 for 93.184.216.34
+
+		{"0.0.0.0", false},
+		{"0.1.2.3", false},
+		{"10.0.0.1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"172.16.0.1", false},
+		{"192.0.0.170", false},
+		{"192.0.2.1", false},
+		{"192.88.99.1", false},
+		{"192.168.1.1", false},
+		{"198.18.0.1", false},
+		{"198.19.255.254", false},
+		{"198.51.100.1", false},
+		{"203.0.113.1", false},
+		{"224.0.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+
+		{"::", false},
+		{"::1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::10.0.0.1", false},
+		{"::ffff:0:10.0.0.1", false},
+		{"64:ff9b::7f00:1", false},   // NAT64 for 127.0.0.1
+		{"64:ff9b::a00:1", false},    // NAT64 for 10.0.0.1
+		{"64:ff9b::6440:1", false},   // NAT64 for 100.64.0.1
+		{"64:ff9b:1::a00:1", false},  // local-use NAT64
+		{"2002:7f00:1::1", false},    // 6to4 for 127.0.0.1
+		{"2002:a9fe:a9fe::1", false}, // 6to4 for 169.254.169.254
+		{"2002:c0a8:101::1", false},  // 6to4 for 192.168.1.1
+		{"100::1", false},
+		{"2001::1", false},
+		{"2001:2::1", false},
+		{"2001:db8::1", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"fec0::1", false},
+		{"ff02::1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+	defer server.Close()
+
+	// httptest listens on loopback, as a rebound hostname would resolve
+	resp, err := newClient().Post(server.URL, "application/json", nil)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("POST to %s = %v, want ErrPrivateAddress", server.URL, err)
+	}
+	if hits != 0 {
+		t.Errorf("endpoint was reached %d times", hits)
+	}
+}
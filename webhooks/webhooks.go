@@ -0,0 +1,270 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/logging"
+	"github.com/navid-m/versed/metrics"
+	"github.com/navid-m/versed/models"
+)
+
+var logger = logging.For("webhooks")
+
+// Event name sent for every newly ingested feed item
+const EventFeedItemCreated = "feed_item.created"
+
+const (
+	maxAttempts  = 6
+	baseBackoff  = 30 * time.Second
+	pollInterval = 5 * time.Second
+	batchSize    = 20
+)
+
+// Headers attached to every delivery
+const (
+	HeaderEvent     = "X-Versed-Event"
+	HeaderDelivery  = "X-Versed-Delivery"
+	HeaderTimestamp = "X-Versed-Timestamp"
+	HeaderSignature = "X-Versed-Signature"
+)
+
+// Payload is the JSON body POSTed to webhook endpoints
+type Payload struct {
+	Event     string         `json:"event"`
+	WebhookID int            `json:"webhook_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Item      feeds.FeedItem `json:"item"`
+}
+
+// Matches new feed items against webhook rules and delivers them with retries
+type Dispatcher struct {
+	db       *sqldb.DB
+	client   *http.Client
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Creates a new webhook dispatcher
+func NewDispatcher(db *sqldb.DB) *Dispatcher {
+	return &Dispatcher{
+		db:       db,
+		client:   newClient(),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Generates a random signing secret for a new webhook
+func GenerateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Computes the signature header value for a delivery body.
+//
+// Receivers verify a delivery by computing HMAC-SHA256 over
+// "<timestamp>.<body>" with the webhook secret and comparing it with the
+// hex digest after the "sha256=" prefix.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Begins polling for due deliveries in the background
+func (d *Dispatcher) Start() {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.deliverDue()
+			case <-d.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Stops the dispatcher and waits for the current batch to finish
+func (d *Dispatcher) Stop() {
+	close(d.stopChan)
+	d.wg.Wait()
+}
+
+// Queues deliveries for every enabled webhook whose rule matches one of the items
+func (d *Dispatcher) Notify(items []feeds.FeedItem) {
+	d.notify(0, items)
+}
+
+// Like Notify, but only for the user's own webhooks, for items nobody else
+// may see such as their newsletters
+func (d *Dispatcher) NotifyUser(userID int, items []feeds.FeedItem) {
+	d.notify(userID, items)
+}
+
+// Queues deliveries for matching webhooks, only those of the given user
+// unless it is 0
+func (d *Dispatcher) notify(userID int, items []feeds.FeedItem) {
+	if len(items) == 0 {
+		return
+	}
+
+	hooks, err := database.GetEnabledWebhooks(d.db)
+	if err != nil {
+		logger.Error("Failed to load webhooks", "err", err)
+		return
+	}
+
+	queued := 0
+	for _, hook := range hooks {
+		if userID != 0 && hook.UserID != userID {
+			continue
+		}
+		for _, item := range items {
+			matches, err := database.WebhookMatchesItem(d.db, hook, item)
+			if err != nil {
+				logger.Error("Failed to match webhook against item", "webhook_id", hook.ID, "item_id", item.ID, "err", err)
+				continue
+			}
+			if !matches {
+				continue
+			}
+
+			body, err := json.Marshal(Payload{
+				Event:     EventFeedItemCreated,
+				WebhookID: hook.ID,
+				CreatedAt: time.Now().UTC(),
+				Item:      item,
+			})
+			if err != nil {
+				logger.Error("Failed to encode webhook payload", "item_id", item.ID, "err", err)
+				continue
+			}
+
+			err = database.EnqueueWebhookDelivery(d.db, hook.ID, item.ID, EventFeedItemCreated, string(body))
+			if err != nil {
+				logger.Error("Failed to queue webhook delivery", "webhook_id", hook.ID, "item_id", item.ID, "err", err)
+				continue
+			}
+			queued++
+		}
+	}
+
+	if queued > 0 {
+		logger.Info("Queued webhook deliveries", "deliveries", queued, "new_items", len(items))
+	}
+}
+
+// Attempts every pending delivery whose retry time has passed
+func (d *Dispatcher) deliverDue() {
+	metrics.WorkersBusy.Inc("webhooks")
+	defer metrics.WorkersBusy.Dec("webhooks")
+
+	deliveries, err := database.GetDueWebhookDeliveries(d.db, time.Now(), batchSize)
+	if err != nil {
+		logger.Error("Failed to get due webhook deliveries", "err", err)
+		return
+	}
+
+	hooks := make(map[int]*models.Webhook)
+	for _, delivery := range deliveries {
+		hook, ok := hooks[delivery.WebhookID]
+		if !ok {
+			hook, err = database.GetWebhookByID(d.db, delivery.WebhookID)
+			if err != nil {
+				logger.Error("Failed to load webhook", "webhook_id", delivery.WebhookID, "err", err)
+				continue
+			}
+			hooks[delivery.WebhookID] = hook
+		}
+		d.attempt(hook, delivery)
+	}
+}
+
+// Sends a single delivery and records the outcome, scheduling a retry on failure
+func (d *Dispatcher) attempt(hook *models.Webhook, delivery models.WebhookDelivery) {
+	attempts := delivery.Attempts + 1
+	statusCode, err := d.send(hook, delivery)
+
+	var responseStatus *int
+	if statusCode != 0 {
+		responseStatus = &statusCode
+	}
+
+	if err == nil {
+		if recErr := database.RecordWebhookAttempt(d.db, delivery.ID, models.DeliverySucceeded, attempts, responseStatus, "", nil); recErr != nil {
+			logger.Error("Failed to record webhook delivery", "delivery_id", delivery.ID, "err", recErr)
+		}
+		return
+	}
+
+	status := models.DeliveryPending
+	var nextAttemptAt *time.Time
+	if attempts >= maxAttempts {
+		status = models.DeliveryFailed
+		logger.Warn("Webhook delivery failed permanently", "webhook_id", hook.ID, "delivery_id", delivery.ID, "attempts", attempts, "err", err)
+	} else {
+		next := time.Now().Add(backoff(attempts))
+		nextAttemptAt = &next
+	}
+
+	if recErr := database.RecordWebhookAttempt(d.db, delivery.ID, status, attempts, responseStatus, err.Error(), nextAttemptAt); recErr != nil {
+		logger.Error("Failed to record webhook delivery", "delivery_id", delivery.ID, "err", recErr)
+	}
+}
+
+// POSTs the signed payload, returning the response status if one was received
+func (d *Dispatcher) send(hook *models.Webhook, delivery models.WebhookDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("invalid webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Versed-Webhooks/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Returns the wait before the next attempt: 30s, 1m, 2m, 4m, 8m...
+func backoff(attempts int) time.Duration {
+	return baseBackoff << (attempts - 1)
+}
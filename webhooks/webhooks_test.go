@@ -0,0 +1,254 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/navid-m/versed/database"
+	"github.com/navid-m/versed/database/sqldb"
+	"github.com/navid-m/versed/feeds"
+	"github.com/navid-m/versed/models"
+)
+
+func TestSign(t *testing.T) {
+	got := Sign("whsec_test", "1700000000", []byte(`{"event":"feed_item.created"}`))
+	want := "sha256=7293afa61f9b65e6e5f9a63f1f1cb2c0a7d662f66c09145e28dfc280485cc580"
+	if got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+	if Sign("whsec_other", "1700000000", []byte(`{"event":"feed_item.created"}`)) == want {
+		t.Error("signature does not depend on the secret")
+	}
+	if Sign("whsec_test", "1700000001", []byte(`{"event":"feed_item.created"}`)) == want {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, w := range want {
+		if got := backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+// A webhook endpoint answering with the queued statuses, then 204
+type endpoint struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newEndpoint(t *testing.T, statuses ...int) *endpoint {
+	e := &endpoint{statuses: statuses}
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.requests = append(e.requests, r)
+		e.bodies = append(e.bodies, body)
+		status := http.StatusNoContent
+		if len(e.statuses) > 0 {
+			status, e.statuses = e.statuses[0], e.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+func (e *endpoint) hits() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.requests)
+}
+
+// Returns a dispatcher over a fresh database with one user whose keyword
+// webhook points at the endpoint. Deliveries go through the endpoint's own
+// client, as the real one refuses the loopback address it listens on.
+func newTestDispatcher(t *testing.T, e *endpoint) (*Dispatcher, *sqldb.DB, *models.Webhook) {
+	t.Helper()
+	db, err := sqldb.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := database.CreateUser(db, "reader@example.com", "reader", "secret", ""); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	user, err := database.GetUserByEmail(db, "reader@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	hook, err := database.CreateWebhook(db, user.ID, "Go news", e.URL+"/hook", "whsec_test", models.WebhookMatchKeyword, "golang")
+	if err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+
+	d := NewDispatcher(db)
+	d.client = e.Client()
+	return d, db, hook
+}
+
+// Makes every pending delivery due now rather than after its backoff
+func makeDue(t *testing.T, db *sqldb.DB) {
+	t.Helper()
+	_, err := db.Exec(`UPDATE webhook_deliveries SET next_attempt_at = ? WHERE status = ?`,
+		time.Now().UTC().Add(-time.Second), models.DeliveryPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func deliveries(t *testing.T, db *sqldb.DB, hook *models.Webhook) []models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := database.GetWebhookDeliveries(db, hook.ID, 10)
+	if err != nil {
+		t.Fatalf("GetWebhookDeliveries: %v", err)
+	}
+	return deliveries
+}
+
+var testItems = []feeds.FeedItem{
+	{ID: "item-1", SourceID: 1, Title: "Golang 1.30 released", URL: "https://go.dev/blog/go1.30"},
+	{ID: "item-2", SourceID: 1, Title: "Rust 2.0 released"},
+}
+
+func TestDeliver(t *testing.T) {
+	e := newEndpoint(t)
+	d, db, hook := newTestDispatcher(t, e)
+
+	d.Notify(testItems)
+	d.Notify(testItems[:1])
+	queued := deliveries(t, db, hook)
+	if len(queued) != 1 || queued[0].ItemID != "item-1" || queued[0].Status != models.DeliveryPending {
+		t.Fatalf("queued deliveries = %+v, want one pending for item-1", queued)
+	}
+
+	d.deliverDue()
+	if e.hits() != 1 {
+		t.Fatalf("endpoint got %d requests, want 1", e.hits())
+	}
+	req, body := e.requests[0], e.bodies[0]
+	if req.URL.Path != "/hook" || req.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("request = %s %s", req.Header.Get("Content-Type"), req.URL.Path)
+	}
+	if got := req.Header.Get(HeaderEvent); got != EventFeedItemCreated {
+		t.Errorf("%s = %q", HeaderEvent, got)
+	}
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if got, want := req.Header.Get(HeaderSignature), Sign("whsec_test", timestamp, body); got != want {
+		t.Errorf("%s = %q, want %q", HeaderSignature, got, want)
+	}
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if payload.Event != EventFeedItemCreated || payload.WebhookID != hook.ID || payload.Item.ID != "item-1" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	delivered := deliveries(t, db, hook)[0]
+	if delivered.Status != models.DeliverySucceeded || delivered.Attempts != 1 ||
+		delivered.ResponseStatus == nil || *delivered.ResponseStatus != http.StatusNoContent {
+		t.Errorf("delivery = %+v, want succeeded after one attempt", delivered)
+	}
+	d.deliverDue()
+	if e.hits() != 1 {
+		t.Errorf("a succeeded delivery was sent again")
+	}
+}
+
+func TestNotifyUser(t *testing.T) {
+	e := newEndpoint(t)
+	d, db, hook := newTestDispatcher(t, e)
+
+	d.NotifyUser(hook.UserID+1, testItems)
+	if queued := deliveries(t, db, hook); len(queued) != 0 {
+		t.Errorf("another user's item queued %+v", queued)
+	}
+	d.NotifyUser(hook.UserID, testItems)
+	if queued := deliveries(t, db, hook); len(queued) != 1 || queued[0].ItemID != "item-1" {
+		t.Errorf("queued deliveries = %+v, want one for the owner's item-1", queued)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	e := newEndpoint(t, http.StatusInternalServerError, http.StatusBadGateway)
+	d, db, hook := newTestDispatcher(t, e)
+	d.Notify(testItems)
+
+	before := time.Now()
+	d.deliverDue()
+	retrying := deliveries(t, db, hook)[0]
+	if retrying.Status != models.DeliveryPending || retrying.Attempts != 1 ||
+		retrying.ResponseStatus == nil || *retrying.ResponseStatus != http.StatusInternalServerError ||
+		retrying.LastError == "" {
+		t.Fatalf("delivery after a 500 = %+v, want pending with the error recorded", retrying)
+	}
+	if retrying.NextAttemptAt == nil || retrying.NextAttemptAt.Before(before.Add(baseBackoff-time.Second)) {
+		t.Errorf("next attempt at %v, want about %v from now", retrying.NextAttemptAt, baseBackoff)
+	}
+
+	d.deliverDue()
+	if e.hits() != 1 {
+		t.Fatalf("retried before the backoff passed")
+	}
+	makeDue(t, db)
+	d.deliverDue()
+	makeDue(t, db)
+	d.deliverDue()
+	delivered := deliveries(t, db, hook)[0]
+	if e.hits() != 3 || delivered.Status != models.DeliverySucceeded || delivered.Attempts != 3 || delivered.LastError != "" {
+		t.Errorf("after %d requests delivery = %+v, want succeeded on the third attempt", e.hits(), delivered)
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	statuses := make([]int, maxAttempts+1)
+	for i := range statuses {
+		statuses[i] = http.StatusServiceUnavailable
+	}
+	e := newEndpoint(t, statuses...)
+	d, db, hook := newTestDispatcher(t, e)
+	d.Notify(testItems)
+
+	for range maxAttempts + 2 {
+		makeDue(t, db)
+		d.deliverDue()
+	}
+	failed := deliveries(t, db, hook)[0]
+	if e.hits() != maxAttempts {
+		t.Errorf("endpoint got %d requests, want %d", e.hits(), maxAttempts)
+	}
+	if failed.Status != models.DeliveryFailed || failed.Attempts != maxAttempts || failed.NextAttemptAt != nil {
+		t.Errorf("delivery = %+v, want failed after %d attempts", failed, maxAttempts)
+	}
+}
+
+func TestDeliverSkipsDisabledWebhooks(t *testing.T) {
+	e := newEndpoint(t)
+	d, db, hook := newTestDispatcher(t, e)
+	d.Notify(testItems)
+	if err := database.UpdateWebhook(db, hook.UserID, hook.ID, hook.Name, hook.URL, hook.MatchType, hook.MatchValue, false); err != nil {
+		t.Fatal(err)
+	}
+
+	d.deliverDue()
+	d.Notify([]feeds.FeedItem{{ID: "item-3", SourceID: 1, Title: "More golang"}})
+	if e.hits() != 0 || len(deliveries(t, db, hook)) != 1 {
+		t.Errorf("disabled webhook got %d requests and %d deliveries", e.hits(), len(deliveries(t, db, hook)))
+	}
+}